@@ -234,11 +234,13 @@ foreach ($dir in $binaryDirs) {
     }
 
     $buildDate = Get-Date -Format s
+    $goVersion = (go env GOVERSION)
 
     $ldflags = "-X github.com/windowsadmins/gorilla/pkg/version.appName=$binaryName " +
                "-X github.com/windowsadmins/gorilla/pkg/version.version=$env:RELEASE_VERSION " +
                "-X github.com/windowsadmins/gorilla/pkg/version.branch=$branchName " +
                "-X github.com/windowsadmins/gorilla/pkg/version.buildDate=$buildDate " +
+               "-X github.com/windowsadmins/gorilla/pkg/version.goVersion=$goVersion " +
                "-X github.com/windowsadmins/gorilla/pkg/version.revision=$revision"
 
     go build -v -o "bin\$binaryName.exe" -ldflags="$ldflags" "./cmd/$binaryName"
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// argumentsFlag collects each use of a flag that can be repeated, such as --installer-arg
+type argumentsFlag []string
+
+func (a *argumentsFlag) String() string {
+	return strings.Join(*a, " ")
+}
+
+func (a *argumentsFlag) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+// installerArguments returns the arguments written to the installer of a pkginfo: the ones given
+// with --installer-arg, or else the default_arguments_<type> of the config for the installer type
+func installerArguments(conf config.Configuration, installerType string, flagArgs []string) []string {
+	if len(flagArgs) > 0 {
+		return flagArgs
+	}
+	var defaults []string
+	switch installerType {
+	case "msi":
+		defaults = conf.DefaultArgumentsMSI
+	case "exe":
+		defaults = conf.DefaultArgumentsEXE
+	case "nupkg":
+		defaults = conf.DefaultArgumentsNupkg
+	}
+	return append([]string(nil), defaults...)
+}
+
+// argumentsSummary returns the arguments as they are shown before importing, or none
+func argumentsSummary(arguments []string) string {
+	if len(arguments) == 0 {
+		return "none"
+	}
+	return strings.Join(arguments, " ")
+}
+
+// promptArguments asks for a list of arguments separated by spaces.
+// An empty answer keeps the current arguments, and "none" clears them.
+func promptArguments(prompt string, current []string) []string {
+	fmt.Printf("%s [%s]: ", prompt, strings.Join(current, " "))
+	line := readLine()
+	switch line {
+	case "":
+		return current
+	case "none":
+		return nil
+	}
+	return strings.Fields(line)
+}
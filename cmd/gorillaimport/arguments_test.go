@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// TestInstallerArguments validates --installer-arg overrides the defaults, and the defaults
+// are chosen by installer type
+func TestInstallerArguments(t *testing.T) {
+	conf := config.Configuration{
+		DefaultArgumentsMSI:   []string{"/qn", "/norestart"},
+		DefaultArgumentsEXE:   []string{"/S"},
+		DefaultArgumentsNupkg: []string{"--force"},
+	}
+	tests := []struct {
+		installerType string
+		flagArgs      []string
+		expected      []string
+	}{
+		{"msi", nil, []string{"/qn", "/norestart"}},
+		{"exe", nil, []string{"/S"}},
+		{"nupkg", nil, []string{"--force"}},
+		{"ps1", nil, nil},
+		{"msi", []string{"ALLUSERS=1"}, []string{"ALLUSERS=1"}},
+		{"ps1", []string{"-Silent"}, []string{"-Silent"}},
+	}
+	for _, tt := range tests {
+		if got := installerArguments(conf, tt.installerType, tt.flagArgs); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s with %q: expected %q, got %q", tt.installerType, tt.flagArgs, tt.expected, got)
+		}
+	}
+
+	// The pkginfo gets its own copy, not the config's
+	installerArguments(conf, "msi", nil)[0] = "/quiet"
+	if conf.DefaultArgumentsMSI[0] != "/qn" {
+		t.Errorf("expected the config defaults unchanged, got %q", conf.DefaultArgumentsMSI)
+	}
+}
+
+// TestPromptArguments validates an empty answer keeps the current arguments, none clears them,
+// and anything else is split on spaces
+func TestPromptArguments(t *testing.T) {
+	current := []string{"/qn"}
+	tests := []struct {
+		answer   string
+		expected []string
+	}{
+		{"\n", []string{"/qn"}},
+		{"none\n", nil},
+		{"/qn  /norestart ALLUSERS=1\n", []string{"/qn", "/norestart", "ALLUSERS=1"}},
+	}
+	for _, tt := range tests {
+		useAnswers(t, tt.answer)
+		if got := promptArguments("Enter Default MSI Arguments", current); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %q, got %q", tt.answer, tt.expected, got)
+		}
+	}
+}
+
+// TestArgumentsSummary validates the arguments shown before importing
+func TestArgumentsSummary(t *testing.T) {
+	if got := argumentsSummary(nil); got != "none" {
+		t.Errorf("expected none, got %q", got)
+	}
+	if got := argumentsSummary([]string{"/qn", "/norestart"}); got != "/qn /norestart" {
+		t.Errorf("unexpected summary %q", got)
+	}
+}
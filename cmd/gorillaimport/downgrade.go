@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/extract"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"gopkg.in/yaml.v3"
+)
+
+// newestInRepo returns the highest version of an item in All.yaml for an architecture, so the
+// x86_64 and arm64 lines of an item are compared on their own. Items without
+// supported_architectures count for every architecture. A repo without All.yaml has no versions.
+func newestInRepo(repoPath, name, arch string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, "catalogs", "All.yaml"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read All.yaml: %v", err)
+	}
+	var allPackages []pkginfo.PkgsInfo
+	if err := yaml.Unmarshal(data, &allPackages); err != nil {
+		return "", fmt.Errorf("failed to unmarshal All.yaml: %v", err)
+	}
+
+	arch = extract.NormalizeArch(arch)
+	newest := ""
+	for _, item := range allPackages {
+		if !strings.EqualFold(strings.TrimSpace(item.Name), strings.TrimSpace(name)) || !supportsArch(item, arch) {
+			continue
+		}
+		if newest == "" || catalog.NewerVersion(item.Version, newest) {
+			newest = item.Version
+		}
+	}
+	return newest, nil
+}
+
+// supportsArch returns true if a pkginfo is for the architecture, or for all of them
+func supportsArch(item pkginfo.PkgsInfo, arch string) bool {
+	if len(item.SupportedArch) == 0 || arch == "" {
+		return true
+	}
+	for _, supported := range item.SupportedArch {
+		if extract.NormalizeArch(supported) == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDowngrade stops an import of a version older than the newest one in the repo
+// unless it is confirmed, or allowed with --allow-downgrade
+func checkDowngrade(repoPath, name, version, arch string, allowDowngrade bool) error {
+	newest, err := newestInRepo(repoPath, name, arch)
+	if err != nil {
+		logging.Warn("Unable to compare with the versions in the repo", "error", err)
+		return nil
+	}
+	if newest == "" || !catalog.NewerVersion(newest, version) {
+		return nil
+	}
+
+	logging.Warnf("\nWARNING: newer version %s of %s (%s) already exists in the repo, %s is older.\n\n", newest, name, arch, version)
+	if allowDowngrade {
+		return nil
+	}
+	if !confirmAction(fmt.Sprintf("Newer version %s already exists, import %s anyway?", newest, version)) {
+		return fmt.Errorf("newer version %s of %s already exists, use --allow-downgrade to import %s", newest, name, version)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// downgradeRepo returns a repo whose All.yaml has a newer x64 Zoom than x86, and a Tool for every architecture
+func downgradeRepo(t *testing.T) string {
+	t.Helper()
+	repoPath := t.TempDir()
+	catalogsDir := filepath.Join(repoPath, "catalogs")
+	if err := os.MkdirAll(catalogsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	all := `- name: Zoom
+  version: "6.1.0"
+  supported_architectures: [x86]
+- name: Zoom
+  version: "6.2.0"
+  supported_architectures: [x64]
+- name: Zoom
+  version: "5.17.0"
+  supported_architectures: [x86_64]
+- name: Tool
+  version: "2.0"
+`
+	if err := os.WriteFile(filepath.Join(catalogsDir, "All.yaml"), []byte(all), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return repoPath
+}
+
+// TestNewestInRepo validates each architecture is compared with its own versions, and items
+// without supported_architectures count for every architecture
+func TestNewestInRepo(t *testing.T) {
+	repoPath := downgradeRepo(t)
+	tests := []struct {
+		name, arch, expected string
+	}{
+		{"Zoom", "x86", "6.1.0"},
+		{"Zoom", "x86_64", "6.2.0"},
+		{"Zoom", "amd64", "6.2.0"},
+		{"zoom", "x64", "6.2.0"},
+		{"Zoom", "arm64", ""},
+		{"Tool", "arm64", "2.0"},
+		{"Missing", "x64", ""},
+	}
+	for _, tt := range tests {
+		newest, err := newestInRepo(repoPath, tt.name, tt.arch)
+		if err != nil || newest != tt.expected {
+			t.Errorf("%s %s: expected %q, got %q %v", tt.name, tt.arch, tt.expected, newest, err)
+		}
+	}
+
+	if newest, err := newestInRepo(t.TempDir(), "Zoom", "x64"); err != nil || newest != "" {
+		t.Errorf("expected no versions without All.yaml, got %q %v", newest, err)
+	}
+}
+
+// TestCheckDowngrade validates an import older than the newest version for its architecture
+// is refused unless confirmed or allowed, and a newer version for another architecture doesn't count
+func TestCheckDowngrade(t *testing.T) {
+	repoPath := downgradeRepo(t)
+	tests := []struct {
+		description   string
+		version, arch string
+		allow         bool
+		answer        string
+		refused       bool
+	}{
+		{"newest x86", "6.1.5", "x86", false, "", false},
+		{"older x64", "6.1.5", "x64", false, "n\n", true},
+		{"older x64 confirmed", "6.1.5", "x64", false, "y\n", false},
+		{"older x64 allowed", "6.1.5", "x64", true, "", false},
+		{"same x64", "6.2.0", "x64", false, "", false},
+		{"newer x64", "6.3.0", "x64", false, "", false},
+	}
+	for _, tt := range tests {
+		useAnswers(t, tt.answer)
+		err := checkDowngrade(repoPath, "Zoom", tt.version, tt.arch, tt.allow)
+		if (err != nil) != tt.refused {
+			t.Errorf("%s: expected refused %v, got %v", tt.description, tt.refused, err)
+		}
+	}
+}
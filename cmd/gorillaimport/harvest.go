@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/installer"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// perUserPath matches the parts of a path that are under the profile of the user who installed it
+var perUserPath = regexp.MustCompile(`(?i)(\\users\\|%userprofile%|%localappdata%|%appdata%|\\appdata\\)`)
+
+// harvestUninstaller builds the uninstaller of the application installed on this machine
+// with a display name, from the QuietUninstallString or UninstallString it registered
+func harvestUninstaller(displayName string) (*pkginfo.InstallerItem, error) {
+	app, err := status.FindApplication(displayName)
+	if err != nil {
+		return nil, err
+	}
+	uninstaller, ok := installer.InstalledUninstaller(app)
+	if !ok {
+		return nil, fmt.Errorf("%s has no uninstall command registered", app.Name)
+	}
+
+	command := strings.Join(append([]string{uninstaller.Location}, uninstaller.Arguments...), " ")
+	logging.Printf("Using the uninstall command of %s: %s\n", app.Name, command)
+	if perUserPath.MatchString(command) {
+		logging.Warnf("Warning: the uninstall command is in the profile of the user who installed %s on this machine, "+
+			"so it may not exist on the clients: %s\n", app.Name, command)
+	}
+	return &uninstaller, nil
+}
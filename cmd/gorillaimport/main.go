@@ -3,55 +3,30 @@
 package main
 
 import (
-    "encoding/xml"
-    "encoding/json"
     "crypto/sha256"
     "flag"
     "fmt"
     "io"
     "os"
-    "log"
     "os/exec"
+    "os/user"
+    "path"
     "path/filepath"
     "runtime"
     "strings"
-    "bytes"
+    "time"
     "gopkg.in/yaml.v3"
     "github.com/AlecAivazis/survey/v2"
+    "github.com/windowsadmins/gorilla/pkg/auth"
+    "github.com/windowsadmins/gorilla/pkg/catalog"
     "github.com/windowsadmins/gorilla/pkg/logging"
     "github.com/windowsadmins/gorilla/pkg/config"
+    "github.com/windowsadmins/gorilla/pkg/extract"
+    "github.com/windowsadmins/gorilla/pkg/pkginfo"
+    "github.com/windowsadmins/gorilla/pkg/utils"
+    "github.com/windowsadmins/gorilla/pkg/version"
 )
 
-type PkgsInfo struct {
-    Name                string     `yaml:"name"`
-    DisplayName         string     `yaml:"display_name"`
-    Version             string     `yaml:"version"`
-    Description         string     `yaml:"description"`
-    Catalogs            []string   `yaml:"catalogs"`
-    Category            string     `yaml:"category"`
-    Developer           string     `yaml:"developer"`
-    UnattendedInstall   bool       `yaml:"unattended_install"`
-    UnattendedUninstall bool       `yaml:"unattended_uninstall"`
-    Installer           *Installer `yaml:"installer"`
-    Uninstaller         *Installer `yaml:"uninstaller,omitempty"`
-    SupportedArch       []string   `yaml:"supported_architectures"`
-    ProductCode         string     `yaml:"product_code,omitempty"`
-    UpgradeCode         string     `yaml:"upgrade_code,omitempty"`
-    PreinstallScript    string     `yaml:"preinstall_script,omitempty"`
-    PostinstallScript   string     `yaml:"postinstall_script,omitempty"`
-    PreuninstallScript  string     `yaml:"preuninstall_script,omitempty"`
-    PostuninstallScript string     `yaml:"postuninstall_script,omitempty"`
-    InstallCheckScript  string     `yaml:"installcheck_script,omitempty"`
-    UninstallCheckScript string    `yaml:"uninstallcheck_script,omitempty"`
-}
-
-type Installer struct {
-    Location  string   `yaml:"location"`
-    Hash      string   `yaml:"hash"`
-    Arguments []string `yaml:"arguments,omitempty"`
-    Type      string   `yaml:"type"`
-}
-
 // Configuration holds the configurable options for Gorilla in YAML format
 type Configuration struct {
     RepoPath       string `yaml:"repo_path"`
@@ -71,37 +46,69 @@ type Metadata struct {
     Readme       string `xml:"readme,omitempty"`
     ProductCode  string // For MSI packages
     UpgradeCode  string // For MSI packages
+    Language     string // For MSI packages, the language ids of the Template summary property
+    Dependencies []string // For NuGet packages
 }
 
 func main() {
-    // Load configuration.
-    conf, err := config.LoadConfig()
-    if err != nil {
-        log.Fatalf("Error loading config: %v", err)
-    }
-
     // Parse command-line flags.
     configFlag := flag.Bool("config", false, "Run interactive configuration setup.")
     archFlag := flag.String("arch", "", "Specify the architecture (e.g., x86_64, arm64)")
     repoPath := flag.String("repo_path", "", "Path to the Gorilla repo.")
-    installerFlag := flag.String("installer", "", "Path to the installer .exe or .msi file.")
-    uninstallerFlag := flag.String("uninstaller", "", "Path to the uninstaller .exe or .msi file.")
-    installScriptFlag := flag.String("installscript", "", "Path to the install script (.bat or .ps1).")
+    installerFlag := flag.String("installer", "", "Path or http(s) URL of the installer .exe, .msi or .reg file.")
+    uninstallerFlag := flag.String("uninstaller", "", "Path to the uninstaller .exe, .msi or .reg file.")
+    uninstallerArm64Flag := flag.String("uninstaller-arm64", "", "Path to the uninstaller .exe or .msi file for arm64, when it differs.")
+    harvestUninstallFlag := flag.String("harvest-uninstall", "", "Display name of the application installed on this machine whose registered uninstall command is the uninstaller.")
+    installScriptFlag := flag.String("installscript", "", "Path to the install script (.bat, .cmd or .ps1).")
     preuninstallScriptFlag := flag.String("preuninstallscript", "", "Path to the preuninstall script.")
     postuninstallScriptFlag := flag.String("postuninstallscript", "", "Path to the postuninstall script.")
     postinstallScriptFlag := flag.String("postinstallscript", "", "Path to the post-install script.")
     installCheckScriptFlag := flag.String("installcheckscript", "", "Path to the install check script.")
     uninstallCheckScriptFlag := flag.String("uninstallcheckscript", "", "Path to the uninstall check script.")
+    installsLimitFlag := flag.Int("installs_limit", 3, "Number of versioned EXE/DLL files from an MSI to add as file checks (0 to disable).")
+    iconFlag := flag.String("icon", "", "Path to a PNG icon. By default the icon is extracted from the installer.")
+    noIconFlag := flag.Bool("no-icon", false, "Do not add an icon to the pkgsinfo.")
+    pkginfoOnlyFlag := flag.Bool("pkginfo-only", false, "Only write the pkgsinfo, for an installer already in the repo at --location.")
+    locationFlag := flag.String("location", "", "Location of the installer under pkgs, such as apps/Firefox/Firefox-128-x64.msi, with --pkginfo-only.")
+    hashFlag := flag.String("hash", "", "SHA256 of the installer, with --pkginfo-only when the installer is not available locally.")
+    notesFlag := flag.String("notes", "", "A note recorded in the pkgsinfo for the repo tooling, left out of the catalogs.")
+    allowDowngradeFlag := flag.Bool("allow-downgrade", false, "Import a version older than the newest in the repo without asking.")
+    minimumOSVersionFlag := flag.String("minimum-os-version", "", "Minimum version of Windows the item installs on, such as 10.0.22000.")
+    maximumOSVersionFlag := flag.String("maximum-os-version", "", "Maximum version of Windows the item installs on, such as 10.0.19045.")
+    sha256Flag := flag.String("sha256", "", "SHA256 from the vendor to verify an installer downloaded from a URL.")
+    subdirFlag := flag.String("subdir", "", "Subdirectory of pkgs and pkgsinfo to import to, such as drivers/dell. Defaults to default_import_subdir, or apps.")
+    var installerArgsFlag argumentsFlag
+    flag.Var(&installerArgsFlag, "installer-arg", "An argument for the installer, repeat it for each one. Replaces the default_arguments_<type> of the config.")
+    logFileFlag, quietFlag := logging.ToolFlags()
+    showVersion, versionJSON := version.Flags()
     flag.Parse()
 
+    if *showVersion {
+        if err := version.Show(*versionJSON); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+        return
+    }
+
     // Initialize the logger.
-    logging.InitLogger(*conf)
+    if err := logging.InitTool(*logFileFlag, *quietFlag); err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        os.Exit(1)
+    }
     defer logging.CloseLogger()
 
+    // Load configuration.
+    conf, err := config.LoadConfig()
+    if err != nil {
+        logging.Errorf("Error loading config: %v\n", err)
+        os.Exit(1)
+    }
+
     // Run interactive configuration setup if --config is provided.
     if *configFlag {
         configureGorillaImport()
-        fmt.Println("Configuration saved successfully.")
+        logging.Printf("Configuration saved successfully.\n")
         return
     }
 
@@ -109,45 +116,90 @@ func main() {
     if *repoPath != "" {
         conf.RepoPath = *repoPath
     }
-    if *archFlag != "" {
-        conf.DefaultArch = *archFlag
+
+    // Credentials are only sent to the repo, such as to check a payload is already on it
+    if err := auth.Configure(*conf); err != nil {
+        logging.Warnf("Warning: unable to configure authentication, continuing without it: %v\n", err)
+    }
+
+    if err := catalog.ValidOSVersions(*minimumOSVersionFlag, *maximumOSVersionFlag); err != nil {
+        logging.Errorf("Error: %v\n", err)
+        os.Exit(1)
+    }
+
+    if *pkginfoOnlyFlag && *locationFlag == "" {
+        logging.Errorf("Error: --pkginfo-only requires --location.\n")
+        os.Exit(1)
+    }
+
+    subdir, err := importSubdir(*subdirFlag, conf.DefaultImportSubdir)
+    if err != nil {
+        logging.Errorf("Error: %v\n", err)
+        os.Exit(1)
     }
 
-    packagePath := getInstallerPath(*installerFlag)
+    // With --pkginfo-only the installer in the repo is read, unless a local copy is given
+    var packagePath string
+    if *pkginfoOnlyFlag && *installerFlag == "" && flag.NArg() == 0 {
+        packagePath = repoPayloadPath(conf.RepoPath, *locationFlag)
+    } else {
+        packagePath = getInstallerPath(*installerFlag)
+    }
     if packagePath == "" {
-        fmt.Println("Error: No installer provided.")
+        logging.Errorf("Error: No installer provided.\n")
+        os.Exit(1)
+    }
+
+    // An installer at a URL is downloaded to a temporary directory, removed once it is imported
+    var sourceURL string
+    cleanup := func() {}
+    if isURL(packagePath) {
+        sourceURL = packagePath
+        packagePath, cleanup, err = downloadInstaller(sourceURL, *sha256Flag)
+        if err != nil {
+            logging.Errorf("Error: %v\n", err)
+            os.Exit(1)
+        }
+    } else if *sha256Flag != "" {
+        logging.Errorf("Error: --sha256 is only used with an installer URL.\n")
         os.Exit(1)
     }
+    conf.DefaultArch = resolveArch(packagePath, *archFlag, conf.DefaultArch)
     
+    uninstallerPath := uninstallerForArch(conf.DefaultArch, *uninstallerFlag, *uninstallerArm64Flag)
+
     importSuccess, err := gorillaImport(
         packagePath, *conf, *installScriptFlag, *preuninstallScriptFlag,
-        *postuninstallScriptFlag, *postinstallScriptFlag, *uninstallerFlag,
-        *installCheckScriptFlag, *uninstallCheckScriptFlag,
+        *postuninstallScriptFlag, *postinstallScriptFlag, uninstallerPath,
+        *installCheckScriptFlag, *uninstallCheckScriptFlag, *installsLimitFlag,
+        *iconFlag, *noIconFlag,
+        *pkginfoOnlyFlag, *locationFlag, *hashFlag,
+        *notesFlag, *allowDowngradeFlag, sourceURL,
+        *minimumOSVersionFlag, *maximumOSVersionFlag, *harvestUninstallFlag,
+        installerArgsFlag, subdir,
     )
+    // Before any exit, including an import canceled at a prompt
+    cleanup()
     if err != nil {
-        logging.LogError(err, "Import Error")
-        fmt.Printf("Error: %v\n", err)
+        logging.Errorf("Error: %v\n", err)
         os.Exit(1)
     }
 
-    if importSuccess && conf.CloudProvider != "none" {
+    if importSuccess && !*pkginfoOnlyFlag && conf.CloudProvider != "none" {
         if err := uploadToCloud(*conf); err != nil {
-            fmt.Printf("Error uploading to cloud: %v\n", err)
+            logging.Errorf("Error uploading to cloud: %v\n", err)
             os.Exit(1)
         }
     }
 
     if confirmAction("Run makecatalogs? (y/n)") {
-        if err := runMakeCatalogs(); err != nil {
-            log.Fatalf("makecatalogs error: %v", err)
+        if err := runMakeCatalogs(*logFileFlag, *quietFlag); err != nil {
+            logging.Errorf("makecatalogs error: %v\n", err)
+            os.Exit(1)
         }
     }
 
-    fmt.Println("Gorilla import completed successfully.")
-}
-
-func initLogger(conf config.Configuration) {
-    logging.InitLogger(conf)
+    logging.Printf("Gorilla import completed successfully.\n")
 }
 
 func checkTools() error {
@@ -168,7 +220,7 @@ func checkTools() error {
     return nil
 }
 
-func findMatchingItem(pkgsInfos []PkgsInfo, name, version string) *PkgsInfo {
+func findMatchingItem(pkgsInfos []pkginfo.PkgsInfo, name, version string) *pkginfo.PkgsInfo {
     for _, item := range pkgsInfos {
         if item.Name == name && item.Version == version {
             return &item
@@ -177,8 +229,8 @@ func findMatchingItem(pkgsInfos []PkgsInfo, name, version string) *PkgsInfo {
     return nil
 }
 
-func scanRepo(repoPath string) ([]PkgsInfo, error) {
-    var pkgsInfos []PkgsInfo
+func scanRepo(repoPath string) ([]pkginfo.PkgsInfo, error) {
+    var pkgsInfos []pkginfo.PkgsInfo
 
     err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
         if err != nil {
@@ -189,8 +241,8 @@ func scanRepo(repoPath string) ([]PkgsInfo, error) {
             if err != nil {
                 return err
             }
-            var pkgsInfo PkgsInfo
-            if err := yaml.Unmarshal(content, &pkgsInfo); err != nil {
+            pkgsInfo, err := pkginfo.Decode(content)
+            if err != nil {
                 return err
             }
             pkgsInfos = append(pkgsInfos, pkgsInfo)
@@ -223,27 +275,28 @@ func getConfigPath() string {
 
 func configureGorillaImport() {
     conf := config.GetDefaultConfig()
+    promptConfig(conf)
 
-    fmt.Print("Enter Repo Path: ")
-    fmt.Scanln(&conf.RepoPath)
-
-    fmt.Print("Enter Cloud Provider (aws/azure/none): ")
-    fmt.Scanln(&conf.CloudProvider)
+    if err := config.SaveConfig(conf); err != nil {
+        logging.Errorf("Failed to save config: %v\n", err)
+        os.Exit(1)
+    }
+}
 
+// promptConfig asks for each setting of the interactive configuration, keeping the default on an empty answer
+func promptConfig(conf *config.Configuration) {
+    conf.RepoPath = getInputWithDefault("Enter Repo Path", conf.RepoPath)
+    conf.CloudProvider = getInputWithDefault("Enter Cloud Provider (aws/azure/none)", conf.CloudProvider)
     if conf.CloudProvider != "none" {
-        fmt.Print("Enter Cloud Bucket: ")
-        fmt.Scanln(&conf.CloudBucket)
+        conf.CloudBucket = getInputWithDefault("Enter Cloud Bucket", conf.CloudBucket)
     }
+    conf.DefaultCatalog = getInputWithDefault("Enter Default Catalog", conf.DefaultCatalog)
+    conf.DefaultArch = getInputWithDefault("Enter Default Architecture", conf.DefaultArch)
+    conf.DefaultImportSubdir = getInputWithDefault("Enter Default Import Subdirectory", conf.DefaultImportSubdir)
 
-    fmt.Print("Enter Default Catalog: ")
-    fmt.Scanln(&conf.DefaultCatalog)
-
-    fmt.Print("Enter Default Architecture: ")
-    fmt.Scanln(&conf.DefaultArch)
-
-    if err := config.SaveConfig(conf); err != nil {
-        log.Fatalf("Failed to save config: %v", err)
-    }
+    conf.DefaultArgumentsMSI = promptArguments("Enter Default MSI Arguments, such as /qn /norestart ALLUSERS=1", conf.DefaultArgumentsMSI)
+    conf.DefaultArgumentsEXE = promptArguments("Enter Default EXE Arguments, such as /VERYSILENT /NORESTART", conf.DefaultArgumentsEXE)
+    conf.DefaultArgumentsNupkg = promptArguments("Enter Default Nupkg Arguments", conf.DefaultArgumentsNupkg)
 }
 
 func extractInstallerMetadata(packagePath string) (Metadata, error) {
@@ -253,96 +306,137 @@ func extractInstallerMetadata(packagePath string) (Metadata, error) {
         return extractNuGetMetadata(packagePath)
     case ".msi":
         return extractMSIMetadata(packagePath)
-    case ".exe", ".bat", ".ps1":
-        return promptForMetadata(packagePath)
+    case ".exe":
+        return extractExeMetadata(packagePath)
+    case ".bat", ".cmd", ".ps1":
+        return promptForMetadata(packagePath, Metadata{})
+    case ".reg":
+        return extractRegMetadata(packagePath)
     default:
         return Metadata{}, fmt.Errorf("unsupported installer type: %s", ext)
     }
 }
 
 func extractNuGetMetadata(nupkgPath string) (Metadata, error) {
-    tempDir, err := os.MkdirTemp("", "nuget-extract-")
+    info, err := extract.NupkgDetails(nupkgPath)
     if err != nil {
-        return Metadata{}, fmt.Errorf("failed to create temp directory: %v", err)
+        return Metadata{}, fmt.Errorf("failed to read .nupkg: %v", err)
     }
-    defer os.RemoveAll(tempDir)
 
-    cmd := exec.Command("nuget", "install", nupkgPath, "-OutputDirectory", tempDir, "-NoCache")
-    if err := cmd.Run(); err != nil {
-        return Metadata{}, fmt.Errorf("failed to extract .nupkg: %v", err)
+    if info.HasInstallScript {
+        logging.Warnf("Warning: tools\\chocolateyInstall.ps1 found in %s, check it for embedded silent arguments.\n", nupkgPath)
     }
 
-    nuspecFiles, err := filepath.Glob(filepath.Join(tempDir, "*", "*.nuspec"))
-    if err != nil || len(nuspecFiles) == 0 {
-        return Metadata{}, fmt.Errorf(".nuspec file not found")
+    title := info.Title
+    if title == "" {
+        title = info.ID
     }
+    return Metadata{
+        Title:        title,
+        ID:           info.ID,
+        Version:      info.Version,
+        Authors:      info.Authors,
+        Description:  info.Description,
+        Dependencies: info.Dependencies,
+    }, nil
+}
 
-    content, err := os.ReadFile(nuspecFiles[0])
+// extractExeMetadata prompts for the metadata of an EXE, defaulting to its version resource
+func extractExeMetadata(exeFilePath string) (Metadata, error) {
+    info, err := extract.ExeMetadata(exeFilePath)
     if err != nil {
-        return Metadata{}, fmt.Errorf("failed to read .nuspec: %v", err)
+        logging.Warn("Unable to read the EXE version resource", "path", exeFilePath, "error", err)
+        return promptForMetadata(exeFilePath, Metadata{})
     }
 
-    var metadata Metadata
-    if err := xml.Unmarshal(content, &metadata); err != nil {
-        return Metadata{}, fmt.Errorf("failed to parse .nuspec: %v", err)
+    version := info.FileVersion
+    if version == "" {
+        version = info.ProductVersion
     }
-
-    return metadata, nil
+    return promptForMetadata(exeFilePath, Metadata{
+        Title:       info.ProductName,
+        ID:          strings.ReplaceAll(info.ProductName, " ", ""),
+        Version:     version,
+        Authors:     info.CompanyName,
+        Description: info.FileDescription,
+    })
 }
 
 func extractMSIMetadata(msiFilePath string) (Metadata, error) {
-    // Ensure we're on Windows
-    if runtime.GOOS != "windows" {
-        return Metadata{}, fmt.Errorf("MSI metadata extraction is only supported on Windows")
+    info, err := extract.MsiMetadata(msiFilePath)
+    if err != nil {
+        return Metadata{}, fmt.Errorf("failed to read MSI properties: %v", err)
     }
 
-    // Escape backslashes in the file path
-    msiFilePathEscaped := strings.ReplaceAll(msiFilePath, `\`, `\\`)
-
-    // PowerShell script to extract MSI properties
-    psScript := fmt.Sprintf(`$WindowsInstaller = New-Object -ComObject WindowsInstaller.Installer
-$Database = $WindowsInstaller.GetType().InvokeMember('OpenDatabase', 'InvokeMethod', $null, $WindowsInstaller, @("%s", 0))
-$View = $Database.GetType().InvokeMember('OpenView', 'InvokeMethod', $null, $Database, @('SELECT * FROM Property'))
-$View.GetType().InvokeMember('Execute', 'InvokeMethod', $null, $View, $null)
-$Record = $View.GetType().InvokeMember('Fetch', 'InvokeMethod', $null, $View, $null)
+    // Extract the desired properties
+    metadata := Metadata{
+        Title:       info.ProductName,
+        ID:          info.ProductCode, // Use ProductCode as ID
+        Version:     info.ProductVersion,
+        Authors:     info.Manufacturer,
+        Description: info.Comments,
+        ProductCode: info.ProductCode,
+        UpgradeCode: info.UpgradeCode,
+    }
+
+    // The summary information declares the languages, the architecture is read with BinaryArch
+    if summary, err := extract.MsiSummary(msiFilePath); err != nil {
+        logging.Warn("Unable to read the MSI summary information", "path", msiFilePath, "error", err)
+    } else {
+        metadata.Language = summary.Language()
+    }
 
-$properties = @{}
-while ($Record -ne $null) {
-    $property = $Record.StringData(1)
-    $value = $Record.StringData(2)
-    $properties[$property] = $value
-    $Record = $View.GetType().InvokeMember('Fetch', 'InvokeMethod', $null, $View, $null)
+    return metadata, nil
 }
 
-$properties | ConvertTo-Json -Compress`, msiFilePathEscaped)
-
-    // Prepare the command to execute the PowerShell script
-    cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", psScript)
-
-    // Execute the command and capture the output
-    output, err := cmd.Output()
+// msiFileChecks builds file checks from the largest versioned files an MSI installs
+func msiFileChecks(msiFilePath string, limit int) *pkginfo.InstallCheck {
+    files, err := extract.MsiFiles(msiFilePath)
     if err != nil {
-        return Metadata{}, fmt.Errorf("failed to execute PowerShell script: %v", err)
+        logging.Warn("Unable to read the MSI File table", "path", msiFilePath, "error", err)
+        return nil
     }
 
-    // Parse the JSON output
-    var properties map[string]string
-    if err := json.Unmarshal(output, &properties); err != nil {
-        return Metadata{}, fmt.Errorf("failed to parse JSON output: %v", err)
+    keyFiles := extract.KeyFiles(files, limit)
+    if len(keyFiles) == 0 {
+        return nil
     }
 
-    // Extract the desired properties
-    metadata := Metadata{
-        Title:       properties["ProductName"],
-        ID:          properties["ProductCode"], // Use ProductCode as ID
-        Version:     properties["ProductVersion"],
-        Authors:     properties["Manufacturer"],
-        Description: properties["Comments"],     // If available
-        ProductCode: properties["ProductCode"],
-        UpgradeCode: properties["UpgradeCode"],
+    check := &pkginfo.InstallCheck{}
+    for _, file := range keyFiles {
+        check.File = append(check.File, pkginfo.FileCheck{Path: file.Path, Version: file.Version})
     }
+    return check
+}
 
-    return metadata, nil
+// importIcon writes the icon for an item to <repo>/icons/<name>.png and returns its file name.
+// Nothing is written when the installer type has no icon to extract.
+func importIcon(packagePath, installerType, iconPath, repoPath, name string) (string, error) {
+    var data []byte
+    var err error
+    switch {
+    case iconPath != "":
+        data, err = os.ReadFile(iconPath)
+    case installerType == "exe":
+        data, err = extract.ExeIcon(packagePath)
+    case installerType == "msi":
+        data, err = extract.MsiIcon(packagePath)
+    default:
+        return "", nil
+    }
+    if err != nil {
+        return "", err
+    }
+
+    iconName := name + ".png"
+    iconsPath := filepath.Join(repoPath, "icons")
+    if err := os.MkdirAll(iconsPath, 0755); err != nil {
+        return "", fmt.Errorf("failed to create icons directory: %v", err)
+    }
+    if err := os.WriteFile(filepath.Join(iconsPath, iconName), data, 0644); err != nil {
+        return "", fmt.Errorf("failed to write icon: %v", err)
+    }
+    return iconName, nil
 }
 
 func calculateSHA256(packagePath string) (string, error) {
@@ -360,25 +454,37 @@ func calculateSHA256(packagePath string) (string, error) {
     return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-func copyFile(src, dst string) (int64, error) {
-    srcFile, err := os.Open(src)
-    if err != nil {
-        return 0, err
+// copyVerified copies a payload into the repo and checks the copy has the size and SHA256
+// of the source, so a share that fails mid-copy never leaves a truncated payload behind.
+// A copy that fails or doesn't match is removed.
+func copyVerified(src, dst, srcHash string, srcSize int64) error {
+    // A payload imported from its place in the repo is already there
+    if srcInfo, err := os.Stat(src); err == nil {
+        if dstInfo, err := os.Stat(dst); err == nil && os.SameFile(srcInfo, dstInfo) {
+            return nil
+        }
     }
-    defer srcFile.Close()
 
-    dstFile, err := os.Create(dst)
-    if err != nil {
-        return 0, err
+    written, err := utils.CopyFile(src, dst)
+    if err == nil && written != srcSize {
+        err = fmt.Errorf("copied %d bytes of %d", written, srcSize)
+    }
+    if err == nil {
+        var dstHash string
+        dstHash, err = calculateSHA256(dst)
+        if err == nil && !strings.EqualFold(dstHash, srcHash) {
+            err = fmt.Errorf("the copy has the hash %s, the source %s", dstHash, srcHash)
+        }
     }
-    defer dstFile.Close()
-
-    nBytes, err := io.Copy(dstFile, srcFile)
     if err != nil {
-        return 0, err
+        if removeErr := os.Remove(dst); removeErr != nil && !os.IsNotExist(removeErr) {
+            logging.Warn("Unable to remove the failed copy", "path", dst, "error", removeErr)
+        }
+        return err
     }
 
-    return nBytes, dstFile.Sync()
+    logging.Printf("Verified %s: SHA256 %s, %d bytes\n", dst, srcHash, written)
+    return nil
 }
 
 func cleanScriptInput(script string) string {
@@ -401,103 +507,6 @@ func indentScriptForYaml(script string) string {
     return strings.Join(indentedLines, "\n")
 }
 
-func encodeWithSelectiveBlockScalars(pkgsInfo PkgsInfo) ([]byte, error) {
-    var buf bytes.Buffer
-    encoder := yaml.NewEncoder(&buf)
-    encoder.SetIndent(2)
-
-    if err := encoder.Encode(&pkgsInfo); err != nil {
-        return nil, fmt.Errorf("failed to encode pkgsinfo: %v", err)
-    }
-    return buf.Bytes(), nil
-}
-
-func handleScriptField(node *yaml.Node, value interface{}) error {
-    if script, ok := value.(string); ok && script != "" {
-        node.Kind = yaml.ScalarNode
-        node.Style = yaml.LiteralStyle // Use block scalar style
-        node.Value = "\n" + script // Ensure script starts with a newline
-    } else {
-        node.Kind = yaml.ScalarNode
-        node.Tag = "!!null"
-    }
-    return nil
-}
-
-func addField(node *yaml.Node, key string, value interface{}) {
-    keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: key}
-    valueNode := &yaml.Node{}
-
-    switch v := value.(type) {
-    case string:
-        valueNode.Kind = yaml.ScalarNode
-        valueNode.Value = v
-    case bool:
-        valueNode.Kind = yaml.ScalarNode
-        valueNode.Value = fmt.Sprintf("%v", v)
-    case []string:
-        valueNode.Kind = yaml.SequenceNode
-        for _, item := range v {
-            valueNode.Content = append(valueNode.Content, &yaml.Node{
-                Kind: yaml.ScalarNode, Value: item,
-            })
-        }
-    }
-
-    node.Content = append(node.Content, keyNode, valueNode)
-}
-
-func addScriptField(node *yaml.Node, key string, value string) {
-    keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: key}
-    valueNode := &yaml.Node{
-        Kind:  yaml.ScalarNode,
-        Style: yaml.LiteralStyle,
-        Value: value,
-    }
-    node.Content = append(node.Content, keyNode, valueNode)
-}
-
-func getEmptyIfEmptyString(s string) interface{} {
-    if s == "" {
-        return "" // Or nil to omit the field entirely
-    }
-    return s
-}
-
-func isScriptField(fieldName string) bool {
-    scriptFields := []string{
-        "preinstall_script", "postinstall_script",
-        "preuninstall_script", "postuninstall_script",
-        "installcheck_script", "uninstallcheck_script",
-    }
-    for _, field := range scriptFields {
-        if fieldName == field {
-            return true
-        }
-    }
-    return false
-}
-
-func populateStandardFields(m map[string]interface{}, info PkgsInfo) {
-    m["name"] = info.Name
-    m["display_name"] = info.DisplayName
-    m["version"] = info.Version
-    m["description"] = info.Description
-    m["catalogs"] = info.Catalogs
-    m["category"] = info.Category
-    m["developer"] = info.Developer
-    m["unattended_install"] = info.UnattendedInstall
-    m["unattended_uninstall"] = info.UnattendedUninstall
-    m["installer"] = info.Installer
-    m["supported_architectures"] = info.SupportedArch
-    m["product_code"] = info.ProductCode
-    m["upgrade_code"] = info.UpgradeCode
-
-    if info.Uninstaller != nil {
-        m["uninstaller"] = info.Uninstaller
-    }
-}
-
 func createPkgsInfo(
     filePath string,
     outputDir string,
@@ -520,14 +529,14 @@ func createPkgsInfo(
     postuninstallScript string,
     installCheckScript string,
     uninstallCheckScript string,
-    uninstaller *Installer,
+    uninstaller *pkginfo.InstallerItem,
 ) error {
-    installerLocation := filepath.Join("/", installerSubPath, fmt.Sprintf("%s-%s%s", name, version, filepath.Ext(filePath)))
+    installerLocation := repoLocation(filepath.Join(installerSubPath, fmt.Sprintf("%s-%s%s", name, version, filepath.Ext(filePath))))
 
-    pkgsInfo := PkgsInfo{
+    pkgsInfo := pkginfo.PkgsInfo{
         Name:                name,
         Version:             version,
-        Installer:           &Installer{Location: installerLocation, Hash: fileHash, Type: filepath.Ext(filePath)[1:]},
+        Installer:           &pkginfo.InstallerItem{Location: installerLocation, Hash: fileHash, Type: filepath.Ext(filePath)[1:]},
         Uninstaller:         uninstaller,
         Catalogs:            catalogs,
         Category:            category,
@@ -535,8 +544,8 @@ func createPkgsInfo(
         SupportedArch:       supportedArch,
         ProductCode:         strings.TrimSpace(productCode),
         UpgradeCode:         strings.TrimSpace(upgradeCode),
-        UnattendedInstall:   unattendedInstall,
-        UnattendedUninstall: unattendedUninstall,
+        UnattendedInstall:   pkginfo.Bool(unattendedInstall),
+        UnattendedUninstall: pkginfo.Bool(unattendedUninstall),
         PreinstallScript:    preinstallScript,
         PostinstallScript:   postinstallScript,
         PreuninstallScript:  preuninstallScript,
@@ -544,9 +553,8 @@ func createPkgsInfo(
         InstallCheckScript:  installCheckScript,
         UninstallCheckScript: uninstallCheckScript,
     }
-
     outputPath := filepath.Join(outputDir, fmt.Sprintf("%s-%s.yaml", name, version))
-    pkgsInfoContent, err := encodeWithSelectiveBlockScalars(pkgsInfo)
+    pkgsInfoContent, err := pkginfo.Encode(pkgsInfo)
     if err != nil {
         return fmt.Errorf("failed to encode pkgsinfo: %v", err)
     }
@@ -558,14 +566,14 @@ func createPkgsInfo(
     return nil
 }
 
-func findMatchingItemInAllCatalog(repoPath, productCode, upgradeCode, currentFileHash string) (*PkgsInfo, bool, error) {
+func findMatchingItemInAllCatalog(repoPath, productCode, upgradeCode, currentFileHash string) (*pkginfo.PkgsInfo, bool, error) {
     allCatalogPath := filepath.Join(repoPath, "catalogs", "All.yaml")
     fileContent, err := os.ReadFile(allCatalogPath)
     if err != nil {
         return nil, false, fmt.Errorf("failed to read All.yaml: %v", err)
     }
 
-    var allPackages []PkgsInfo
+    var allPackages []pkginfo.PkgsInfo
     if err := yaml.Unmarshal(fileContent, &allPackages); err != nil {
         return nil, false, fmt.Errorf("failed to unmarshal All.yaml: %v", err)
     }
@@ -582,14 +590,14 @@ func findMatchingItemInAllCatalog(repoPath, productCode, upgradeCode, currentFil
     return nil, false, nil
 }
 
-func findMatchingItemInAllCatalogWithDifferentVersion(repoPath, name, version string) (*PkgsInfo, error) {
+func findMatchingItemInAllCatalogWithDifferentVersion(repoPath, name, version string) (*pkginfo.PkgsInfo, error) {
     allCatalogPath := filepath.Join(repoPath, "catalogs", "All.yaml")
     fileContent, err := os.ReadFile(allCatalogPath)
     if err != nil {
         return nil, fmt.Errorf("failed to read All.yaml: %v", err)
     }
 
-    var allPackages []PkgsInfo
+    var allPackages []pkginfo.PkgsInfo
     if err := yaml.Unmarshal(fileContent, &allPackages); err != nil {
         return nil, fmt.Errorf("failed to unmarshal All.yaml: %v", err)
     }
@@ -618,7 +626,7 @@ func processScript(scriptPath, wrapperType string) (string, error) {
 
     scriptContent := strings.ReplaceAll(string(content), "\r\n", "\n")
 
-    if wrapperType == ".bat" {
+    if wrapperType == ".bat" || wrapperType == ".cmd" {
         return generateWrapperScript(scriptContent, "bat"), nil
     } else if wrapperType == ".ps1" {
         return scriptContent, nil
@@ -626,13 +634,41 @@ func processScript(scriptPath, wrapperType string) (string, error) {
     return scriptContent, nil
 }
 
-func processUninstaller(uninstallerPath, pkgsFolderPath, installerSubPath string) (*Installer, error) {
+// installerTypeFor derives the installer type the client runs a payload with from its extension:
+// nupkg, msi, exe, ps1, bat and cmd for scripts run by cmd.exe, or reg for .reg files imported into the registry
+func installerTypeFor(payloadPath string) string {
+    return strings.TrimPrefix(strings.ToLower(filepath.Ext(payloadPath)), ".")
+}
+
+// uninstallerForArch picks the uninstaller for the architecture being imported. The arm64
+// uninstaller is used for arm64 builds, and the default one for every other architecture,
+// or for arm64 too when there is no arm64 uninstaller.
+func uninstallerForArch(arch, uninstallerPath, arm64UninstallerPath string) string {
+    if strings.EqualFold(arch, extract.ArchARM64) && arm64UninstallerPath != "" {
+        return arm64UninstallerPath
+    }
+    if uninstallerPath == "" && arm64UninstallerPath != "" {
+        logging.Warnf("Warning: --uninstaller-arm64 %s is not used for a %s installer.\n", arm64UninstallerPath, arch)
+    }
+    return uninstallerPath
+}
+
+// uninstallerFilename names a copied uninstaller name-arch-version, so uninstallers
+// of different versions and architectures don't overwrite each other in the repo
+func uninstallerFilename(name, arch, version, uninstallerPath string) string {
+    return fmt.Sprintf("%s-%s-%s-uninstaller%s", name, arch, version, strings.ToLower(filepath.Ext(uninstallerPath)))
+}
+
+func processUninstaller(uninstallerPath, pkgsFolderPath, installerSubPath, filename string) (*pkginfo.InstallerItem, error) {
     if uninstallerPath == "" {
         return nil, nil
     }
 
-    if _, err := os.Stat(uninstallerPath); os.IsNotExist(err) {
+    fileInfo, err := os.Stat(uninstallerPath)
+    if os.IsNotExist(err) {
         return nil, fmt.Errorf("uninstaller '%s' does not exist", uninstallerPath)
+    } else if err != nil {
+        return nil, fmt.Errorf("failed to read uninstaller: %v", err)
     }
 
     uninstallerHash, err := calculateSHA256(uninstallerPath)
@@ -640,20 +676,44 @@ func processUninstaller(uninstallerPath, pkgsFolderPath, installerSubPath string
         return nil, fmt.Errorf("error calculating uninstaller hash: %v", err)
     }
 
-    uninstallerFilename := filepath.Base(uninstallerPath)
-    uninstallerDest := filepath.Join(pkgsFolderPath, uninstallerFilename)
+    uninstallerDir := filepath.Join(pkgsFolderPath, installerSubPath)
+    if err := os.MkdirAll(uninstallerDir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create the uninstaller directory: %v", err)
+    }
+    uninstallerDest := filepath.Join(uninstallerDir, filename)
 
-    if _, err := copyFile(uninstallerPath, uninstallerDest); err != nil {
+    if err := copyVerified(uninstallerPath, uninstallerDest, uninstallerHash, fileInfo.Size()); err != nil {
         return nil, fmt.Errorf("failed to copy uninstaller: %v", err)
     }
 
-    return &Installer{
-        Location: filepath.Join("/", installerSubPath, uninstallerFilename),
+    return &pkginfo.InstallerItem{
+        Location: repoLocation(filepath.Join(installerSubPath, filename)),
         Hash:     uninstallerHash,
-        Type:     strings.TrimPrefix(filepath.Ext(uninstallerPath), "."),
+        Size:     fileInfo.Size() / 1024, // Size in KB
+        Type:     installerTypeFor(uninstallerPath),
     }, nil
 }
 
+// resolveArch picks the architecture for supported_architectures. The --arch override wins,
+// then the architecture the installer was built for, then the configured default.
+func resolveArch(packagePath, override, defaultArch string) string {
+    arch, err := extract.BinaryArch(packagePath)
+    if err != nil {
+        logging.Warn("Unable to detect the installer architecture", "path", packagePath, "error", err)
+    }
+
+    if override != "" {
+        if arch != extract.ArchUnknown && !strings.EqualFold(override, arch) {
+            logging.Warnf("Warning: --arch %s does not match the installer, which was built for %s.\n", override, arch)
+        }
+        return override
+    }
+    if arch != extract.ArchUnknown {
+        return arch
+    }
+    return defaultArch
+}
+
 func getInstallerPath(installerFlag string) string {
     if installerFlag != "" {
         return installerFlag
@@ -664,19 +724,17 @@ func getInstallerPath(installerFlag string) string {
     }
 
     fmt.Print("Enter the path to the installer file: ")
-    var path string
-    fmt.Scanln(&path)
-    return path
+    return readLine()
 }
 
-func generatePkgsInfo(config config.Configuration, installerSubPath string, info PkgsInfo) error {
+func generatePkgsInfo(config config.Configuration, installerSubPath string, info pkginfo.PkgsInfo) error {
     outputDir := filepath.Join(config.RepoPath, "pkgsinfo", installerSubPath)
     if err := os.MkdirAll(outputDir, 0755); err != nil {
         return fmt.Errorf("failed to create output directory: %v", err)
     }
 
     outputFile := filepath.Join(outputDir, fmt.Sprintf("%s-%s.yaml", info.Name, info.Version))
-    pkgsInfoContent, err := encodeWithSelectiveBlockScalars(info)
+    pkgsInfoContent, err := pkginfo.Encode(info)
     if err != nil {
         return fmt.Errorf("failed to encode pkgsinfo: %v", err)
     }
@@ -689,19 +747,84 @@ func gorillaImport(
     conf config.Configuration,
     installScriptPath, preuninstallScriptPath, postuninstallScriptPath string,
     postinstallScriptPath, uninstallerPath, installCheckScriptPath, uninstallCheckScriptPath string,
+    installsLimit int,
+    iconPath string, noIcon bool,
+    pkginfoOnly bool, location, hash string,
+    notes string, allowDowngrade bool, sourceURL string,
+    minimumOSVersion, maximumOSVersion string,
+    harvestUninstall string,
+    installerArgs []string, subdir string,
 ) (bool, error) {
-    if _, err := os.Stat(packagePath); os.IsNotExist(err) {
+    _, statErr := os.Stat(packagePath)
+    if os.IsNotExist(statErr) && !pkginfoOnly {
         return false, fmt.Errorf("package '%s' does not exist", packagePath)
     }
 
-    fmt.Printf("Processing package: %s\n", packagePath)
+    logging.Printf("Processing package: %s\n", packagePath)
 
-    // Extract metadata
-    metadata, err := extractInstallerMetadata(packagePath)
+    // Extract metadata, or ask for it when the installer is only in the cloud
+    var metadata Metadata
+    var err error
+    if statErr == nil {
+        metadata, err = extractInstallerMetadata(packagePath)
+    } else {
+        metadata, err = promptForMetadata(location, Metadata{})
+    }
     if err != nil {
         return false, fmt.Errorf("metadata extraction failed: %v", err)
     }
 
+    // Catch an old installer imported by mistake before the catalogs regress
+    if err := checkDowngrade(conf.RepoPath, metadata.ID, metadata.Version, conf.DefaultArch, allowDowngrade); err != nil {
+        return false, err
+    }
+
+    // Show where the item lands in the repo before anything is copied there
+    installerRepoPath := path.Join("pkgs", subdir, filepath.Base(packagePath))
+    if pkginfoOnly {
+        installerRepoPath = path.Join("pkgs", strings.TrimLeft(pkginfo.NormalizeLocation(location), "/"))
+    }
+    pkginfoRepoPath := path.Join("pkgsinfo", subdir, fmt.Sprintf("%s-%s.yaml", metadata.ID, metadata.Version))
+
+    // Determine installer type, and the arguments it is run with
+    installerType := installerTypeFor(packagePath)
+    if pkginfoOnly {
+        installerType = installerTypeFor(location)
+    }
+    arguments := installerArguments(conf, installerType, installerArgs)
+
+    // Hash the installer, so what is imported can be checked against the vendor's before confirming
+    var fileHash string
+    var fileSize, fileBytes int64
+    if pkginfoOnly {
+        // Reference the installer already in the repo instead of copying it
+        fileHash, fileSize, err = existingPayload(conf, location, packagePath, hash)
+        if err != nil {
+            return false, fmt.Errorf("unable to use the installer at %s: %v", location, err)
+        }
+    } else {
+        fileHash, err = calculateSHA256(packagePath)
+        if err != nil {
+            return false, fmt.Errorf("failed to calculate file hash: %v", err)
+        }
+        fileInfo, err := os.Stat(packagePath)
+        if err != nil {
+            return false, fmt.Errorf("failed to read file size: %v", err)
+        }
+        fileBytes = fileInfo.Size()
+        fileSize = fileBytes / 1024
+    }
+
+    logging.Printf("Installer: %s\n", installerRepoPath)
+    logging.Printf("Pkginfo: %s\n", pkginfoRepoPath)
+    logging.Printf("Arguments: %s\n", argumentsSummary(arguments))
+    logging.Printf("SHA256: %s\n", fileHash)
+    logging.Printf("Size: %d KB\n", fileSize)
+    if interactive() && !confirmAction("Import to these paths?") {
+        logging.Printf("Import canceled.\n")
+        return false, nil
+    }
+
     // Process scripts
     preinstallScript, _ := processScript(installScriptPath, filepath.Ext(installScriptPath))
     postinstallScript, _ := processScript(postinstallScriptPath, filepath.Ext(postinstallScriptPath))
@@ -710,32 +833,47 @@ func gorillaImport(
     installCheckScript, _ := processScript(installCheckScriptPath, filepath.Ext(installCheckScriptPath))
     uninstallCheckScript, _ := processScript(uninstallCheckScriptPath, filepath.Ext(uninstallCheckScriptPath))
 
-    // Process uninstaller
-    uninstaller, err := processUninstaller(uninstallerPath, filepath.Join(conf.RepoPath, "pkgs"), "apps")
+    // A .reg file is undone by the _undo.reg next to it, unless another uninstaller is given
+    if uninstallerPath == "" && statErr == nil && installerTypeFor(packagePath) == "reg" {
+        uninstallerPath = regUndoFile(packagePath)
+    }
+
+    // Process the uninstaller for this architecture
+    uninstaller, err := processUninstaller(
+        uninstallerPath, filepath.Join(conf.RepoPath, "pkgs"), filepath.FromSlash(subdir),
+        uninstallerFilename(metadata.ID, conf.DefaultArch, metadata.Version, uninstallerPath),
+    )
     if err != nil {
         return false, fmt.Errorf("uninstaller processing failed: %v", err)
     }
 
-    // Determine installer type
-    installerType := strings.TrimPrefix(strings.ToLower(filepath.Ext(packagePath)), ".")
-
-    // Calculate installer hash
-    fileHash, err := calculateSHA256(packagePath)
-    if err != nil {
-        return false, fmt.Errorf("failed to calculate file hash: %v", err)
+    // Without an uninstaller, the uninstall command the application registered on this machine is used
+    if uninstaller == nil && harvestUninstall != "" {
+        uninstaller, err = harvestUninstaller(harvestUninstall)
+        if err != nil {
+            return false, fmt.Errorf("unable to harvest the uninstaller: %v", err)
+        }
     }
 
-    // Copy installer to pkgs directory
-    installerFilename := filepath.Base(packagePath)
-    pkgsFolderPath := filepath.Join(conf.RepoPath, "pkgs", "apps")
-    os.MkdirAll(pkgsFolderPath, 0755)
-    installerDest := filepath.Join(pkgsFolderPath, installerFilename)
-    if _, err := copyFile(packagePath, installerDest); err != nil {
-        return false, fmt.Errorf("failed to copy installer: %v", err)
+    var installerLocation string
+    if pkginfoOnly {
+        installerLocation = repoLocation(location)
+    } else {
+        // Copy installer to pkgs directory
+        installerFilename := filepath.Base(packagePath)
+        pkgsFolderPath := filepath.Join(conf.RepoPath, "pkgs", filepath.FromSlash(subdir))
+        if err := os.MkdirAll(pkgsFolderPath, 0755); err != nil {
+            return false, fmt.Errorf("failed to create the installer directory: %v", err)
+        }
+        installerDest := filepath.Join(pkgsFolderPath, installerFilename)
+        if err := copyVerified(packagePath, installerDest, fileHash, fileBytes); err != nil {
+            return false, fmt.Errorf("failed to copy installer: %v", err)
+        }
+        installerLocation = repoLocation(path.Join(subdir, installerFilename))
     }
 
     // Create PkgsInfo struct with extracted metadata
-    pkgsInfo := PkgsInfo{
+    pkgsInfo := pkginfo.PkgsInfo{
         Name:                metadata.ID,
         DisplayName:         metadata.Title,
         Version:             metadata.Version,
@@ -743,11 +881,15 @@ func gorillaImport(
         Description:         metadata.Description,
         Catalogs:            []string{conf.DefaultCatalog},
         SupportedArch:       []string{conf.DefaultArch},
-        Installer: &Installer{
-            Location:  filepath.Join("/", "apps", installerFilename),
+        Language:            metadata.Language,
+        MinimumOSVersion:    minimumOSVersion,
+        MaximumOSVersion:    maximumOSVersion,
+        Installer: &pkginfo.InstallerItem{
+            Location:  installerLocation,
             Hash:      fileHash,
+            Size:      fileSize, // Size in KB
             Type:      installerType,
-            Arguments: []string{}, // Add arguments if needed
+            Arguments: arguments,
         },
         Uninstaller:          uninstaller,
         PreinstallScript:     preinstallScript,
@@ -756,21 +898,58 @@ func gorillaImport(
         PostuninstallScript:  postuninstallScript,
         InstallCheckScript:   installCheckScript,
         UninstallCheckScript: uninstallCheckScript,
-        UnattendedInstall:    true,
-        UnattendedUninstall:  true,
+        UnattendedInstall:    pkginfo.Bool(true),
+        UnattendedUninstall:  pkginfo.Bool(true),
         ProductCode:          metadata.ProductCode,
         UpgradeCode:          metadata.UpgradeCode,
+        Dependencies:         metadata.Dependencies,
+        Notes:                notes,
+        ImportedBy:           importOwner(),
+        ImportDate:           time.Now().UTC().Format(time.RFC3339),
+        SourceURL:            sourceURL,
+    }
+
+    // Check for the key files an MSI installs
+    if installerType == "msi" && installsLimit > 0 {
+        pkgsInfo.Check = msiFileChecks(packagePath, installsLimit)
+    }
+
+    // Record the keys a .reg file sets and check the first of its values
+    if installerType == "reg" && statErr == nil {
+        if err := addRegDetails(&pkgsInfo, packagePath); err != nil {
+            return false, err
+        }
+    }
+
+    // Add an icon, extracted from the installer unless one was supplied
+    if !noIcon {
+        iconName, err := importIcon(packagePath, installerType, iconPath, conf.RepoPath, metadata.ID)
+        if err != nil {
+            logging.Warn("Unable to import icon", "path", packagePath, "error", err)
+        }
+        pkgsInfo.IconName = iconName
     }
 
     // Generate pkgsinfo
-    if err := generatePkgsInfo(conf, "apps", pkgsInfo); err != nil {
+    if err := generatePkgsInfo(conf, filepath.FromSlash(subdir), pkgsInfo); err != nil {
         return false, fmt.Errorf("failed to generate pkgsinfo: %v", err)
     }
 
-    fmt.Printf("Pkgsinfo created at: /apps/%s-%s.yaml\n", metadata.ID, metadata.Version)
+    logging.Printf("Pkgsinfo created at: %s\n", pkginfoRepoPath)
+    if args := pkgsInfo.Installer.Arguments; len(args) > 0 {
+        logging.Printf("Installer arguments: %s\n", strings.Join(args, " "))
+    }
     return true, nil
 }
 
+// importOwner returns the user running the import, recorded as imported_by
+func importOwner() string {
+    if current, err := user.Current(); err == nil {
+        return current.Username
+    }
+    return os.Getenv("USERNAME")
+}
+
 func generateWrapperScript(batchContent, scriptType string) string {
     if scriptType == "bat" {
         return fmt.Sprintf(`
@@ -789,16 +968,25 @@ Remove-Item $batchFile
     return ""
 }
 
-func promptForMetadata(packagePath string) (Metadata, error) {
+func promptForMetadata(packagePath string, defaults Metadata) (Metadata, error) {
     var metadata Metadata
 
     defaultName := strings.TrimSuffix(filepath.Base(packagePath), filepath.Ext(packagePath))
+    if defaults.Title == "" {
+        defaults.Title = defaultName
+    }
+    if defaults.ID == "" {
+        defaults.ID = defaultName
+    }
+    if defaults.Version == "" {
+        defaults.Version = "1.0.0"
+    }
 
-    promptSurvey(&metadata.Title, "Enter the display name", defaultName)
-    promptSurvey(&metadata.ID, "Enter the package name (unique identifier)", defaultName)
-    promptSurvey(&metadata.Version, "Enter the version", "1.0.0")
-    promptSurvey(&metadata.Authors, "Enter the developer/author", "")
-    promptSurvey(&metadata.Description, "Enter the description", "")
+    promptSurvey(&metadata.Title, "Enter the display name", defaults.Title)
+    promptSurvey(&metadata.ID, "Enter the package name (unique identifier)", defaults.ID)
+    promptSurvey(&metadata.Version, "Enter the version", defaults.Version)
+    promptSurvey(&metadata.Authors, "Enter the developer/author", defaults.Authors)
+    promptSurvey(&metadata.Description, "Enter the description", defaults.Description)
 
     return metadata, nil
 }
@@ -810,27 +998,10 @@ func promptSurvey(value *string, prompt string, defaultValue string) {
     }, value)
 }
 
-func getInputWithDefault(prompt, defaultValue string) string {
-    fmt.Printf("%s [%s]: ", prompt, cleanTextForPrompt(defaultValue))
-    var input string
-    fmt.Scanln(&input)
-    if input == "" {
-        return defaultValue
-    }
-    return input
-}
-
 func cleanTextForPrompt(input string) string {
     return strings.TrimSpace(input)
 }
 
-func confirmAction(prompt string) bool {
-    fmt.Printf("%s (y/n): ", prompt)
-    var response string
-    fmt.Scanln(&response)
-    return strings.ToLower(response) == "y"
-}
-
 func uploadToCloud(conf config.Configuration) error {
     localPkgsPath := filepath.Join(conf.RepoPath, "pkgs")
 
@@ -858,7 +1029,8 @@ func uploadToCloud(conf config.Configuration) error {
     return nil
 }
 
-func runMakeCatalogs() error {
+// runMakeCatalogs runs makecatalogs, passing along where to log and whether to be quiet
+func runMakeCatalogs(logFile string, quiet bool) error {
     var makeCatalogsBinary string
 
     switch runtime.GOOS {
@@ -874,15 +1046,22 @@ func runMakeCatalogs() error {
         return fmt.Errorf("makecatalogs binary not found at %s", makeCatalogsBinary)
     }
 
-    cmd := exec.Command(makeCatalogsBinary)
+    var args []string
+    if logFile != "" {
+        args = append(args, "--log-file", logFile)
+    }
+    if quiet {
+        args = append(args, "--quiet")
+    }
+    cmd := exec.Command(makeCatalogsBinary, args...)
     cmd.Stdout = os.Stdout
     cmd.Stderr = os.Stderr
 
-    fmt.Printf("Running makecatalogs from: %s\n", makeCatalogsBinary)
+    logging.Printf("Running makecatalogs from: %s\n", makeCatalogsBinary)
     if err := cmd.Run(); err != nil {
         return fmt.Errorf("makecatalogs execution failed: %v", err)
     }
 
-    fmt.Println("makecatalogs completed successfully.")
+    logging.Printf("makecatalogs completed successfully.\n")
     return nil
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCopyVerified validates a copy is kept only when its size and SHA256 match the source,
+// and a payload already in place is left alone
+func TestCopyVerified(t *testing.T) {
+	const payload = "installer payload"
+	dir := t.TempDir()
+	src := filepath.Join(dir, "Tool-1.0.msi")
+	if err := os.WriteFile(src, []byte(payload), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(payload)))
+
+	tests := []struct {
+		description string
+		hash        string
+		size        int64
+		valid       bool
+	}{
+		{"matching", hash, int64(len(payload)), true},
+		{"hash mismatch", "0000", int64(len(payload)), false},
+		{"size mismatch", hash, int64(len(payload)) + 1, false},
+	}
+	for _, tt := range tests {
+		dst := filepath.Join(dir, "pkgs", tt.description, "Tool-1.0.msi")
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := copyVerified(src, dst, tt.hash, tt.size)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got %v", tt.description, tt.valid, err)
+		}
+		if _, statErr := os.Stat(dst); os.IsNotExist(statErr) == tt.valid {
+			t.Errorf("%s: expected the copy kept %v, got %v", tt.description, tt.valid, statErr)
+		}
+	}
+
+	if err := copyVerified(src, src, hash, int64(len(payload))); err != nil {
+		t.Errorf("expected a payload already in place to be kept, got %v", err)
+	}
+	if data, err := os.ReadFile(src); err != nil || string(data) != payload {
+		t.Errorf("expected the payload unchanged, got %q %v", data, err)
+	}
+}
+
+// TestProcessUninstaller validates the uninstaller is copied next to the installer,
+// and an error is returned when its directory can't be created
+func TestProcessUninstaller(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "uninstall.exe")
+	if err := os.WriteFile(src, []byte("uninstaller"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pkgs := filepath.Join(dir, "pkgs")
+
+	uninstaller, err := processUninstaller(src, pkgs, "apps", "Tool-uninstall.exe")
+	if err != nil {
+		t.Fatalf("processUninstaller failed: %v", err)
+	}
+	if uninstaller.Location != "/apps/Tool-uninstall.exe" || uninstaller.Type != "exe" {
+		t.Errorf("unexpected uninstaller: %+v", uninstaller)
+	}
+	if _, err := os.Stat(filepath.Join(pkgs, "apps", "Tool-uninstall.exe")); err != nil {
+		t.Errorf("expected the uninstaller copied: %v", err)
+	}
+
+	// A file where the directory should be
+	if _, err := processUninstaller(src, pkgs, filepath.Join("apps", "Tool-uninstall.exe", "sub"), "Tool-uninstall.exe"); err == nil {
+		t.Error("expected an error when the uninstaller directory can't be created")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/utils"
+)
+
+// repoLocation returns a location under pkgs as it is written to a pkginfo,
+// with a leading slash and forward slashes on every OS. It warns about names that
+// are escaped in the URL clients download from, which some servers and CDNs mishandle.
+func repoLocation(location string) string {
+	location = "/" + strings.TrimLeft(pkginfo.NormalizeLocation(location), "/")
+	for _, segment := range strings.Split(location, "/") {
+		if catalog.NeedsEscaping(segment) {
+			logging.Warnf("Warning: %s has spaces or other characters that are escaped in its URL, consider renaming it.\n", segment)
+		}
+	}
+	return location
+}
+
+// repoPayloadPath returns where a location is in the local repo
+func repoPayloadPath(repoPath, location string) string {
+	return filepath.Join(repoPath, "pkgs", filepath.FromSlash(strings.TrimLeft(pkginfo.NormalizeLocation(location), "/")))
+}
+
+// existingPayload verifies an installer that is already in the repo and returns its hash and size in KB.
+// The installer is read from <repo>/pkgs when it is there. Otherwise it must answer a HEAD request
+// at the repo URL, and the hash is the one supplied or computed from a local copy of the installer.
+func existingPayload(conf config.Configuration, location, localPath, hash string) (string, int64, error) {
+	repoFile := repoPayloadPath(conf.RepoPath, location)
+	if info, err := os.Stat(repoFile); err == nil {
+		fileHash, err := calculateSHA256(repoFile)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to calculate the hash of %s: %v", repoFile, err)
+		}
+		if hash != "" && !strings.EqualFold(hash, fileHash) {
+			return "", 0, fmt.Errorf("--hash %s does not match %s, which has the hash %s", hash, repoFile, fileHash)
+		}
+		return fileHash, info.Size() / 1024, nil
+	}
+
+	// The payload is only in the cloud, check the repo has it
+	if conf.URL == "" {
+		return "", 0, fmt.Errorf("%s is not in the repo and no repo URL is configured to check for it", location)
+	}
+	item := catalog.Item{Installer: catalog.InstallerItem{Location: location}}
+	payloadURL := catalog.ItemURL(conf, item)
+	size, err := headPayload(payloadURL)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if hash != "" {
+		return strings.ToLower(hash), size / 1024, nil
+	}
+	if info, err := os.Stat(localPath); err == nil {
+		fileHash, err := calculateSHA256(localPath)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to calculate the hash of %s: %v", localPath, err)
+		}
+		if size <= 0 {
+			size = info.Size()
+		}
+		return fileHash, size / 1024, nil
+	}
+	return "", 0, fmt.Errorf("unable to get the hash of %s, pass --hash or the installer", location)
+}
+
+// headPayload checks a payload exists on the repo server and returns its size, or -1 when unknown
+func headPayload(payloadURL string) (int64, error) {
+	req, err := utils.NewAuthenticatedRequest(http.MethodHead, payloadURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := utils.NewClient(30 * time.Second).Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("unable to check %s: %v", payloadURL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s is not in the repo: %s", payloadURL, resp.Status)
+	}
+	return resp.ContentLength, nil
+}
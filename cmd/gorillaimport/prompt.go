@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdin reads the answers to the prompts a line at a time, so an answer can have spaces.
+// This abstraction allows us to override when testing
+var stdin = bufio.NewReader(os.Stdin)
+
+// interactive returns true when stdin is a terminal. Prompts that scripts piping their answers
+// don't expect, such as the repo subdirectory, are only asked then.
+// This abstraction allows us to override when testing
+var interactive = func() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// readLine reads one answer without its line ending. At the end of piped input
+// it returns the last line even without a line ending, then empty answers.
+func readLine() string {
+	line, err := stdin.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return ""
+	}
+	return strings.TrimSpace(line)
+}
+
+// getInputWithDefault asks for a value, showing the default, and returns the default when the answer is empty
+func getInputWithDefault(prompt, defaultValue string) string {
+	fmt.Printf("%s [%s]: ", prompt, cleanTextForPrompt(defaultValue))
+	if input := readLine(); input != "" {
+		return input
+	}
+	return defaultValue
+}
+
+// confirmAction asks a yes or no question, anything but y is no
+func confirmAction(prompt string) bool {
+	fmt.Printf("%s (y/n): ", prompt)
+	return strings.ToLower(readLine()) == "y"
+}
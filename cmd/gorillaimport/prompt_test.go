@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// useAnswers answers the prompts with the lines of input for the duration of the test
+func useAnswers(t *testing.T, input string) {
+	origStdin := stdin
+	t.Cleanup(func() { stdin = origStdin })
+	stdin = bufio.NewReader(strings.NewReader(input))
+}
+
+// TestPromptConfig validates answers with spaces land in their own settings, and empty answers keep the defaults
+func TestPromptConfig(t *testing.T) {
+	useAnswers(t, "C:\\Gorilla Repo\\main\r\naws\nsoftware bucket\n\n\ndrivers/dell\n/qn /norestart\n\nnone\n")
+	conf := config.GetDefaultConfig()
+	conf.DefaultArgumentsNupkg = []string{"--force"}
+
+	promptConfig(conf)
+
+	if conf.RepoPath != `C:\Gorilla Repo\main` || conf.CloudProvider != "aws" || conf.CloudBucket != "software bucket" {
+		t.Errorf("unexpected repo settings: %q %q %q", conf.RepoPath, conf.CloudProvider, conf.CloudBucket)
+	}
+	if conf.DefaultCatalog != "testing" || conf.DefaultArch != "x86_64" {
+		t.Errorf("expected the default catalog and arch, got %q %q", conf.DefaultCatalog, conf.DefaultArch)
+	}
+	if conf.DefaultImportSubdir != "drivers/dell" {
+		t.Errorf("expected the import subdirectory drivers/dell, got %q", conf.DefaultImportSubdir)
+	}
+	if !reflect.DeepEqual(conf.DefaultArgumentsMSI, []string{"/qn", "/norestart"}) || conf.DefaultArgumentsEXE != nil || conf.DefaultArgumentsNupkg != nil {
+		t.Errorf("unexpected arguments: %q %q %q", conf.DefaultArgumentsMSI, conf.DefaultArgumentsEXE, conf.DefaultArgumentsNupkg)
+	}
+}
+
+// TestPromptsPipedInput validates each prompt takes a whole line, including the last one
+// without a line ending, and later prompts get empty answers once the input ends
+func TestPromptsPipedInput(t *testing.T) {
+	useAnswers(t, "Mozilla Firefox\nC:\\Installers\\Firefox Setup 128.0.exe\ny")
+
+	if developer := getInputWithDefault("Developer", "Mozilla"); developer != "Mozilla Firefox" {
+		t.Errorf("expected the developer Mozilla Firefox, got %q", developer)
+	}
+	if path := getInstallerPath(""); path != `C:\Installers\Firefox Setup 128.0.exe` {
+		t.Errorf("unexpected installer path %q", path)
+	}
+	if !confirmAction("Import?") {
+		t.Error("expected the last answer y without a line ending to confirm")
+	}
+	if confirmAction("Run makecatalogs?") {
+		t.Error("expected no answer at the end of the input to decline")
+	}
+	if catalog := getInputWithDefault("Catalog", "testing"); catalog != "testing" {
+		t.Errorf("expected the default at the end of the input, got %q", catalog)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/regfile"
+)
+
+// regUndoSuffix names the .reg file that undoes another, Policy.reg is undone by Policy_undo.reg
+const regUndoSuffix = "_undo.reg"
+
+// extractRegMetadata checks a .reg file parses before asking for its metadata,
+// so a file the client couldn't import is never added to the repo
+func extractRegMetadata(regPath string) (Metadata, error) {
+	if _, err := regfile.ParseFile(regPath); err != nil {
+		return Metadata{}, err
+	}
+	return promptForMetadata(regPath, Metadata{})
+}
+
+// regUndoFile returns the undo file next to a .reg file, if there is one
+func regUndoFile(regPath string) string {
+	undoPath := strings.TrimSuffix(regPath, filepath.Ext(regPath)) + regUndoSuffix
+	if _, err := os.Stat(undoPath); err != nil {
+		return ""
+	}
+	logging.Printf("Using %s as the uninstaller\n", undoPath)
+	return undoPath
+}
+
+// addRegDetails records the keys a .reg file sets, which are deleted to uninstall it without
+// an undo file, and checks the first value it sets when there is no other check
+func addRegDetails(info *pkginfo.PkgsInfo, regPath string) error {
+	keys, err := regfile.ParseFile(regPath)
+	if err != nil {
+		return err
+	}
+
+	var check *pkginfo.InstallCheck
+	for _, key := range keys {
+		if key.Delete {
+			continue
+		}
+		info.RegistryKeys = append(info.RegistryKeys, key.Path)
+		for _, value := range key.Values {
+			if check == nil && !value.Delete {
+				check = &pkginfo.InstallCheck{Registry: pkginfo.RegCheck{Key: key.Path, Value: value.Name, Data: value.String()}}
+			}
+		}
+	}
+
+	if info.Check == nil && info.InstallCheckScript == "" && check != nil {
+		info.Check = check
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// defaultSubdir is where items are imported under pkgs and pkgsinfo without
+// --subdir or default_import_subdir
+const defaultSubdir = "apps"
+
+// importSubdir returns the subdirectory of pkgs and pkgsinfo an item is imported to: the --subdir flag,
+// or the answer to a prompt that defaults to default_import_subdir. Without a terminal to prompt on,
+// the flag or config value is used as it is.
+func importSubdir(flagSubdir, configSubdir string) (string, error) {
+	if flagSubdir != "" {
+		return cleanSubdir(flagSubdir)
+	}
+	subdir := configSubdir
+	if subdir == "" {
+		subdir = defaultSubdir
+	}
+	if interactive() {
+		subdir = getInputWithDefault("Enter the repo subdirectory for the installer and pkginfo", subdir)
+	}
+	return cleanSubdir(subdir)
+}
+
+// cleanSubdir validates a subdirectory stays under pkgs and pkgsinfo, and returns it
+// with forward slashes, such as drivers/dell
+func cleanSubdir(subdir string) (string, error) {
+	slashed := strings.ReplaceAll(strings.TrimSpace(subdir), `\`, "/")
+	if slashed == "" {
+		return "", fmt.Errorf("the repo subdirectory is empty")
+	}
+	// A drive letter or leading slash, such as C:\repo or \\server\share, is outside the repo
+	if strings.HasPrefix(slashed, "/") || strings.Contains(slashed, ":") {
+		return "", fmt.Errorf("the repo subdirectory %s must be relative to the repo", subdir)
+	}
+	for _, segment := range strings.Split(slashed, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("the repo subdirectory %s must not contain ..", subdir)
+		}
+	}
+	cleaned := path.Clean(slashed)
+	if cleaned == "." {
+		return "", fmt.Errorf("the repo subdirectory is empty")
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// TestCleanSubdir validates subdirectories are returned with forward slashes,
+// and the ones that leave the repo are refused
+func TestCleanSubdir(t *testing.T) {
+	valid := map[string]string{
+		"apps":              "apps",
+		"drivers/dell":      "drivers/dell",
+		`drivers\dell\`:     "drivers/dell",
+		" drivers//dell/. ": "drivers/dell",
+	}
+	for subdir, expected := range valid {
+		if got, err := cleanSubdir(subdir); err != nil || got != expected {
+			t.Errorf("%q: expected %q, got %q %v", subdir, expected, got, err)
+		}
+	}
+	for _, subdir := range []string{"", ".", "..", "apps/../../pkgs", `drivers\..\..`, "/apps", `\apps`, `C:\repo\apps`, `\\server\share`, "C:apps"} {
+		if got, err := cleanSubdir(subdir); err == nil {
+			t.Errorf("%q: expected an error, got %q", subdir, got)
+		}
+	}
+}
+
+// TestImportSubdir validates the flag is used without prompting, the prompt defaults to
+// default_import_subdir, and without a terminal the config value is used as it is
+func TestImportSubdir(t *testing.T) {
+	origInteractive := interactive
+	t.Cleanup(func() { interactive = origInteractive })
+	tests := []struct {
+		interactive bool
+		answers     string
+		flagSubdir  string
+		config      string
+		expected    string
+	}{
+		{true, "", "drivers/dell", "tools", "drivers/dell"},
+		{true, "\n", "", "tools", "tools"},
+		{true, "\n", "", "", "apps"},
+		{true, "fonts/adobe\n", "", "tools", "fonts/adobe"},
+		{false, "fonts/adobe\n", "", "tools", "tools"},
+		{false, "", "", "", "apps"},
+	}
+	for _, tt := range tests {
+		useAnswers(t, tt.answers)
+		interactive = func() bool { return tt.interactive }
+		if got, err := importSubdir(tt.flagSubdir, tt.config); err != nil || got != tt.expected {
+			t.Errorf("flag %q, config %q, interactive %v: expected %q, got %q %v",
+				tt.flagSubdir, tt.config, tt.interactive, tt.expected, got, err)
+		}
+	}
+
+	if _, err := importSubdir("../pkgs", ""); err == nil {
+		t.Error("expected a subdirectory outside the repo to be refused")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/download"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// isURL returns true if an installer argument is an http(s) URL rather than a path
+func isURL(installer string) bool {
+	lower := strings.ToLower(installer)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// installerName returns the file name of the installer at a URL. A vendor's stable URL often
+// redirects to the versioned file, so the name is taken from the server's Content-Disposition,
+// then the URL it redirects to, then the URL itself.
+func installerName(installerURL string) (string, error) {
+	target := installerURL
+	req, err := http.NewRequest(http.MethodHead, installerURL, nil)
+	if err != nil {
+		return "", err
+	}
+	// The vendor never receives the repo credentials
+	client := &http.Client{Timeout: 30 * time.Second}
+	if resp, err := client.Do(req); err != nil {
+		logging.Warn("Unable to check the installer URL, naming it from the URL", "url", installerURL, "error", err)
+	} else {
+		resp.Body.Close()
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			return filepath.Base(params["filename"]), nil
+		}
+		target = resp.Request.URL.String()
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" || path.Ext(name) == "" {
+		return "", fmt.Errorf("unable to tell the installer file name from %s, use the URL of the installer itself", installerURL)
+	}
+	return name, nil
+}
+
+// downloadInstaller downloads the installer at a URL to a temporary directory and checks it
+// against the SHA256 from the vendor, when there is one. The returned cleanup removes it.
+func downloadInstaller(installerURL, sha256 string) (string, func(), error) {
+	name, err := installerName(installerURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "gorillaimport-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create a temporary directory: %v", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			logging.Warn("Unable to remove the downloaded installer", "path", tmpDir, "error", err)
+		}
+	}
+
+	packagePath := filepath.Join(tmpDir, name)
+	logging.Printf("Downloading %s\n", installerURL)
+	if err := download.FetchPublic(installerURL, packagePath); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to download %s: %v", installerURL, err)
+	}
+
+	if sha256 != "" {
+		fileHash, err := calculateSHA256(packagePath)
+		if err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to calculate file hash: %v", err)
+		}
+		if !strings.EqualFold(strings.TrimSpace(sha256), fileHash) {
+			cleanup()
+			return "", nil, fmt.Errorf("--sha256 %s does not match the download, which has the hash %s", sha256, fileHash)
+		}
+		logging.Printf("SHA256 verified: %s\n", fileHash)
+	}
+	return packagePath, cleanup, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/auth"
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// installerServer serves an installer at /download/latest, named by Content-Disposition,
+// a redirect from /latest to /files/Tool-2.1.msi, and the installer itself
+func installerServer(t *testing.T, payload string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/download/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="Zoom Installer 6.1.exe"`)
+		fmt.Fprint(w, payload)
+	})
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/files/Tool-2.1.msi", http.StatusFound)
+	})
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, payload)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestInstallerName validates the name is taken from Content-Disposition, then the URL
+// redirected to, then the URL, and a URL without a file name is refused
+func TestInstallerName(t *testing.T) {
+	server := installerServer(t, "installer")
+	tests := map[string]string{
+		"/download/latest":    "Zoom Installer 6.1.exe",
+		"/latest":             "Tool-2.1.msi",
+		"/files/Tool-2.0.msi": "Tool-2.0.msi",
+	}
+	for urlPath, expected := range tests {
+		if name, err := installerName(server.URL + urlPath); err != nil || name != expected {
+			t.Errorf("%s: expected %q, got %q %v", urlPath, expected, name, err)
+		}
+	}
+	if name, err := installerName(server.URL + "/files/"); err == nil {
+		t.Errorf("expected an error without a file name, got %q", name)
+	}
+}
+
+// useTempDir creates the temporary directories of the test in dir
+func useTempDir(t *testing.T, dir string) {
+	origTmp, hadTmp := os.LookupEnv("TMPDIR")
+	t.Cleanup(func() {
+		if hadTmp {
+			os.Setenv("TMPDIR", origTmp)
+		} else {
+			os.Unsetenv("TMPDIR")
+		}
+	})
+	os.Setenv("TMPDIR", dir)
+}
+
+// TestDownloadInstaller validates a download matching --sha256 is kept under its name
+// until cleanup, and one that doesn't match is removed
+func TestDownloadInstaller(t *testing.T) {
+	const payload = "installer payload"
+	server := installerServer(t, payload)
+	tmp := t.TempDir()
+	useTempDir(t, tmp)
+
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(payload)))
+	packagePath, cleanup, err := downloadInstaller(server.URL+"/latest", hash)
+	if err != nil {
+		t.Fatalf("downloadInstaller failed: %v", err)
+	}
+	if filepath.Base(packagePath) != "Tool-2.1.msi" {
+		t.Errorf("expected the redirected name, got %s", packagePath)
+	}
+	if data, err := ioutil.ReadFile(packagePath); err != nil || string(data) != payload {
+		t.Errorf("unexpected download %q %v", data, err)
+	}
+	cleanup()
+	if _, err := os.Stat(packagePath); !os.IsNotExist(err) {
+		t.Errorf("expected the cleanup to remove the download, got %v", err)
+	}
+
+	if _, _, err := downloadInstaller(server.URL+"/latest", "0000"); err == nil {
+		t.Fatal("expected a --sha256 mismatch to fail")
+	}
+	if entries, err := ioutil.ReadDir(tmp); err != nil || len(entries) != 0 {
+		t.Errorf("expected the mismatched download removed, got %v %v", entries, err)
+	}
+}
+
+// TestDownloadInstallerWithoutCredentials validates the vendor never receives the repo credentials,
+// even from a host the repo credentials are configured for
+func TestDownloadInstallerWithoutCredentials(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("Authorization"))
+		fmt.Fprint(w, "installer payload")
+	}))
+	t.Cleanup(server.Close)
+	useTempDir(t, t.TempDir())
+
+	t.Cleanup(func() { auth.Configure(config.Configuration{}) })
+	if err := auth.Configure(config.Configuration{URL: server.URL, AuthProvider: "bearer", AuthBearerToken: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, cleanup, err := downloadInstaller(server.URL+"/Tool-2.1.msi", "")
+	if err != nil {
+		t.Fatalf("downloadInstaller failed: %v", err)
+	}
+	cleanup()
+	if len(received) != 2 {
+		t.Errorf("expected a HEAD and a GET request, got %d", len(received))
+	}
+	for _, header := range received {
+		if header != "" {
+			t.Errorf("expected no Authorization header, got %q", header)
+		}
+	}
+}
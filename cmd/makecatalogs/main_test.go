@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestCatalogNames validates the --catalogs flag is split on commas, without spaces or empty names
+func TestCatalogNames(t *testing.T) {
+	tests := []struct {
+		flagValue string
+		expected  []string
+	}{
+		{"", nil},
+		{"Production", []string{"Production"}},
+		{"Production,All", []string{"Production", "All"}},
+		{" Production , Testing,,", []string{"Production", "Testing"}},
+	}
+	for _, tt := range tests {
+		if got := catalogNames(tt.flagValue); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("catalogNames(%q): expected %v, got %v", tt.flagValue, tt.expected, got)
+		}
+	}
+}
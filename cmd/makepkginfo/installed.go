@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/windowsadmins/gorilla/pkg/installer"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// applyInstalled fills a pkginfo from an installed application: its name, version and developer
+// unless a payload already set them, a registry check and the uninstaller it registered
+func applyInstalled(pkgsinfo *pkginfo.PkgsInfo, app status.RegistryApplication) {
+	if pkgsinfo.Name == "" {
+		pkgsinfo.Name = app.Name
+	}
+	if pkgsinfo.Version == "" {
+		pkgsinfo.Version = app.Version
+	}
+	if pkgsinfo.Developer == "" {
+		pkgsinfo.Developer = app.Publisher
+	}
+	if pkgsinfo.ProductCode == "" {
+		pkgsinfo.ProductCode = app.ProductCode
+	}
+
+	pkgsinfo.Check = &pkginfo.InstallCheck{Registry: pkginfo.RegCheck{Name: app.Name, Version: app.Version}}
+	if uninstaller, ok := installer.InstalledUninstaller(app); ok {
+		pkgsinfo.Uninstaller = &uninstaller
+	}
+}
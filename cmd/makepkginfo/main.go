@@ -8,79 +8,96 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
-	"gopkg.in/yaml.v3"
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/extract"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/status"
+	"github.com/windowsadmins/gorilla/pkg/utils"
+	"github.com/windowsadmins/gorilla/pkg/version"
 )
 
-// PkgsInfo represents the package information
-type PkgsInfo struct {
-	Name                string   `yaml:"name"`
-	DisplayName         string   `yaml:"display_name,omitempty"`
-	Version             string   `yaml:"version"`
-	Catalogs            []string `yaml:"catalogs,omitempty"`
-	Category            string   `yaml:"category,omitempty"`
-	Description         string   `yaml:"description,omitempty"`
-	Developer           string   `yaml:"developer,omitempty"`
-	InstallerType       string   `yaml:"installer_type,omitempty"`
-	InstallerItemHash   string   `yaml:"installer_item_hash,omitempty"`
-	InstallerItemSize   int64    `yaml:"installer_item_size,omitempty"`
-	InstallerItemLocation string `yaml:"installer_item_location,omitempty"`
-	UnattendedInstall   bool     `yaml:"unattended_install,omitempty"`
-	Installs            []string `yaml:"installs,omitempty"`
-	InstallCheckScript  string   `yaml:"installcheck_script,omitempty"`
-	UninstallCheckScript string  `yaml:"uninstallcheck_script,omitempty"`
-	PreinstallScript    string   `yaml:"preinstall_script,omitempty"`
-	PostinstallScript   string   `yaml:"postinstall_script,omitempty"`
+// Function to extract metadata from an MSI installer
+func extractMSIMetadata(msiPath string) (extract.MsiInfo, error) {
+	info, err := extract.MsiMetadata(msiPath)
+	if err != nil {
+		return extract.MsiInfo{}, fmt.Errorf("error extracting MSI metadata: %v", err)
+	}
+	if info.ProductName == "" || info.ProductVersion == "" || info.Manufacturer == "" {
+		return extract.MsiInfo{}, fmt.Errorf("failed to extract MSI metadata")
+	}
+	return info, nil
 }
 
-// Helper function to execute a command and return its output
-func execCommand(name string, arg ...string) (string, error) {
-	cmd := exec.Command(name, arg...)
-	out, err := cmd.Output()
+// Function to extract metadata from a NuGet or Chocolatey package
+func extractNupkgMetadata(nupkgPath string) (extract.NupkgInfo, error) {
+	info, err := extract.NupkgDetails(nupkgPath)
 	if err != nil {
-		return "", err
+		return extract.NupkgInfo{}, fmt.Errorf("error extracting nupkg metadata: %v", err)
 	}
-	return string(out), nil
+	if info.HasInstallScript {
+		logging.Warnf("Warning: %s has a tools\\chocolateyInstall.ps1, check it for embedded silent arguments\n", nupkgPath)
+	}
+	return info, nil
 }
 
-// Function to extract metadata from an MSI installer (Windows-only)
-func extractMSIMetadata(msiPath string) (string, string, string, error) {
-    return extractMSIMetadataWindows(msiPath)
+// Function to build file checks from the largest versioned files an MSI installs
+func msiFileChecks(msiPath string, limit int) (*pkginfo.InstallCheck, error) {
+	files, err := extract.MsiFiles(msiPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFiles := extract.KeyFiles(files, limit)
+	if len(keyFiles) == 0 {
+		return nil, nil
+	}
+
+	check := &pkginfo.InstallCheck{}
+	for _, file := range keyFiles {
+		check.File = append(check.File, pkginfo.FileCheck{Path: file.Path, Version: file.Version})
+	}
+	return check, nil
 }
 
-// Windows-specific MSI metadata extraction using PowerShell
-func extractMSIMetadataWindows(msiPath string) (string, string, string, error) {
-	output, err := execCommand("powershell", "-Command", fmt.Sprintf("Get-MSIInfo -FilePath %s", msiPath))
+// Function to build a file check from a file on this machine, with the version it has
+func localFileCheck(path string) pkginfo.FileCheck {
+	check := pkginfo.FileCheck{Path: path}
+	info, err := utils.FileVersionInfo(path)
 	if err != nil {
-		return "", "", "", fmt.Errorf("error extracting MSI metadata: %v", err)
+		logging.Warnf("Warning: unable to read the version of %s, checking only that it exists: %v\n", path, err)
+		return check
 	}
-	return parseMSIInfoOutput(output)
+	check.Version = info.FileVersion
+	check.ProductName = info.ProductName
+	check.CompanyName = info.CompanyName
+	return check
 }
 
-// Function to parse MSI metadata output (works for both platforms)
-func parseMSIInfoOutput(output string) (string, string, string, error) {
-	var productName, version, manufacturer string
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "ProductName") {
-			productName = strings.TrimSpace(strings.Split(line, ":")[1])
-		}
-		if strings.Contains(line, "ProductVersion") {
-			version = strings.TrimSpace(strings.Split(line, ":")[1])
+// Function to build a directory check from a directory on this machine, requiring the files
+// and whole megabytes it has now rather than a file check for each file
+func localDirectoryCheck(path string) pkginfo.FileCheck {
+	check := pkginfo.FileCheck{Path: path, Type: pkginfo.DirectoryCheck}
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
-		if strings.Contains(line, "Manufacturer") {
-			manufacturer = strings.TrimSpace(strings.Split(line, ":")[1])
+		if info.Mode().IsRegular() {
+			check.MinFiles++
+			size += info.Size()
 		}
+		return nil
+	})
+	if err != nil {
+		logging.Warnf("Warning: unable to read all of %s, checking only that it exists: %v\n", path, err)
+		return pkginfo.FileCheck{Path: path, Type: pkginfo.DirectoryCheck}
 	}
-
-	if productName == "" || version == "" || manufacturer == "" {
-		return "", "", "", fmt.Errorf("failed to extract MSI metadata")
-	}
-
-	return productName, version, manufacturer, nil
+	check.MinSizeMB = int(size / (1024 * 1024))
+	return check
 }
 
 // Function to calculate file size and hash
@@ -102,6 +119,78 @@ func getFileInfo(pkgPath string) (int64, string, error) {
 	return fileSize, fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
+// addPayload fills a pkginfo from an MSI or nupkg payload: its metadata, architecture,
+// installer and the key files the MSI installs
+func addPayload(pkgsinfo *pkginfo.PkgsInfo, installerItem, arch string, installsLimit int) {
+	// Extract installer metadata
+	installerType := "msi"
+	var productName, version, manufacturer, productCode string
+	var dependencies []string
+	var err error
+	if strings.EqualFold(filepath.Ext(installerItem), ".nupkg") {
+		installerType = "nupkg"
+		var info extract.NupkgInfo
+		info, err = extractNupkgMetadata(installerItem)
+		productName, version, manufacturer, dependencies = info.ID, info.Version, info.Authors, info.Dependencies
+		if pkgsinfo.Description == "" {
+			pkgsinfo.Description = info.Description
+		}
+	} else {
+		var info extract.MsiInfo
+		info, err = extractMSIMetadata(installerItem)
+		productName, version, manufacturer, productCode = info.ProductName, info.ProductVersion, info.Manufacturer, info.ProductCode
+	}
+	if err != nil {
+		logging.Errorf("Error extracting %s metadata: %v\n", strings.ToUpper(installerType), err)
+		os.Exit(1)
+	}
+
+	// Detect the architecture, a user override wins
+	detectedArch, err := extract.BinaryArch(installerItem)
+	if err != nil {
+		logging.Warnf("Warning: unable to detect the installer architecture: %v\n", err)
+	}
+	switch {
+	case arch != "" && detectedArch != extract.ArchUnknown && !strings.EqualFold(arch, detectedArch):
+		logging.Warnf("Warning: -arch %s does not match the installer, which was built for %s\n", arch, detectedArch)
+	case arch == "" && detectedArch != extract.ArchUnknown:
+		arch = detectedArch
+	}
+
+	// Get file size and hash
+	fileSize, fileHash, err := getFileInfo(installerItem)
+	if err != nil {
+		logging.Errorf("Error getting file info: %v\n", err)
+		os.Exit(1)
+	}
+
+	pkgsinfo.Name = productName
+	pkgsinfo.Version = version
+	pkgsinfo.Developer = manufacturer
+	pkgsinfo.Dependencies = dependencies
+	pkgsinfo.Installer = &pkginfo.InstallerItem{
+		Type:     installerType,
+		Location: filepath.Base(installerItem),
+		Size:     fileSize / 1024, // Size in KB
+		Hash:     fileHash,
+
+		// MSIs are uninstalled by their product code, which doesn't need the payload
+		ProductCode: productCode,
+	}
+	if arch != "" {
+		pkgsinfo.SupportedArch = []string{arch}
+	}
+
+	// Check for the key files the MSI installs
+	if installerType == "msi" && installsLimit > 0 {
+		check, err := msiFileChecks(installerItem, installsLimit)
+		if err != nil {
+			logging.Warnf("Warning: unable to read the MSI File table: %v\n", err)
+		}
+		pkgsinfo.Check = check
+	}
+}
+
 // Main function
 func main() {
 	// Command-line flags
@@ -117,6 +206,13 @@ func main() {
 		displayName          string
 		description          string
 		unattendedInstall    bool
+		installsLimit        int
+		arch                 string
+		fromInstalled        string
+		files                string
+		asDirectory          bool
+		minimumOSVersion     string
+		maximumOSVersion     string
 	)
 	flag.StringVar(&installCheckScript, "installcheck_script", "", "Path to install check script")
 	flag.StringVar(&uninstallCheckScript, "uninstallcheck_script", "", "Path to uninstall check script")
@@ -129,52 +225,100 @@ func main() {
 	flag.StringVar(&displayName, "displayname", "", "Display name")
 	flag.StringVar(&description, "description", "", "Description")
 	flag.BoolVar(&unattendedInstall, "unattended_install", false, "Set unattended_install to true")
+	flag.StringVar(&arch, "arch", "", "Architecture (e.g., x86_64, arm64), detected from the installer by default")
+	flag.StringVar(&fromInstalled, "from-installed", "", "Display name of an application installed on this machine to take the name, version, developer, registry check and uninstaller from")
+	flag.StringVar(&files, "file", "", "Comma-separated paths of files on this machine to add as file checks, with their version")
+	flag.BoolVar(&asDirectory, "as-directory", false, "Add a --file path that is a directory as one directory check, with its current file count and size as the minimums")
+	flag.StringVar(&minimumOSVersion, "minimum-os-version", "", "Minimum version of Windows the item installs on, such as 10.0.22000")
+	flag.StringVar(&maximumOSVersion, "maximum-os-version", "", "Maximum version of Windows the item installs on, such as 10.0.19045")
+	flag.IntVar(&installsLimit, "installs_limit", 3, "Number of versioned EXE/DLL files to add as file checks (0 to disable)")
+	logFile, quiet := logging.ToolFlags()
+	showVersion, versionJSON := version.Flags()
 	flag.Parse()
 
-	if flag.NArg() < 1 {
-		fmt.Println("Usage: makepkginfo [options] /path/to/installer.msi")
-		flag.PrintDefaults()
-		os.Exit(1)
+	if *showVersion {
+		if err := version.Show(*versionJSON); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	installerItem := flag.Arg(0)
-	installerItem = strings.TrimSuffix(installerItem, "/")
+	if err := logging.InitTool(*logFile, *quiet); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer logging.CloseLogger()
 
-	// Extract MSI metadata
-	productName, version, manufacturer, err := extractMSIMetadata(installerItem)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error extracting MSI metadata: %v\n", err)
+	if flag.NArg() < 1 && fromInstalled == "" {
+		fmt.Println("Usage: makepkginfo [options] /path/to/installer.msi|.nupkg")
+		fmt.Println("       makepkginfo [options] --from-installed \"Display Name\" [/path/to/installer.msi|.nupkg]")
+		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	// Get file size and hash
-	fileSize, fileHash, err := getFileInfo(installerItem)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting file info: %v\n", err)
+	if err := catalog.ValidOSVersions(minimumOSVersion, maximumOSVersion); err != nil {
+		logging.Errorf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Build pkgsinfo
-	pkgsinfo := PkgsInfo{
-		Name:                 productName,
-		DisplayName:          displayName,
-		Version:              version,
-		Catalogs:             strings.Split(catalogs, ","),
-		Category:             category,
-		Developer:            manufacturer,
-		Description:          description,
-		InstallerType:        "msi",
-		InstallerItemLocation: filepath.Base(installerItem),
-		InstallerItemSize:    fileSize / 1024, // Size in KB
-		InstallerItemHash:    fileHash,
-		UnattendedInstall:    unattendedInstall,
+	// Look up the installed application first, so a typo fails before the payload is read
+	var app status.RegistryApplication
+	if fromInstalled != "" {
+		var err error
+		app, err = status.FindApplication(fromInstalled)
+		if err != nil {
+			logging.Errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	pkgsinfo := pkginfo.PkgsInfo{
+		DisplayName:      displayName,
+		Catalogs:         strings.Split(catalogs, ","),
+		Category:         category,
+		Description:      description,
+		MinimumOSVersion: minimumOSVersion,
+		MaximumOSVersion: maximumOSVersion,
+	}
+	// Without the flag unattended_install is left out, so the item installs in automatic runs
+	if unattendedInstall {
+		pkgsinfo.UnattendedInstall = pkginfo.Bool(true)
+	}
+	if flag.NArg() > 0 {
+		// The registry check replaces the file checks of an installed application
+		if fromInstalled != "" {
+			installsLimit = 0
+		}
+		addPayload(&pkgsinfo, strings.TrimSuffix(flag.Arg(0), "/"), arch, installsLimit)
+	}
+	if fromInstalled != "" {
+		if pkgsinfo.Version != "" && app.Version != "" && pkgsinfo.Version != app.Version {
+			logging.Warnf("Warning: the installer is version %s, but version %s is installed\n", pkgsinfo.Version, app.Version)
+		}
+		applyInstalled(&pkgsinfo, app)
+	}
+
+	// Check for files on this machine
+	if files != "" {
+		if pkgsinfo.Check == nil {
+			pkgsinfo.Check = &pkginfo.InstallCheck{}
+		}
+		for _, path := range strings.Split(files, ",") {
+			path = strings.TrimSpace(path)
+			if info, err := os.Stat(path); asDirectory && err == nil && info.IsDir() {
+				pkgsinfo.Check.File = append(pkgsinfo.Check.File, localDirectoryCheck(path))
+				continue
+			}
+			pkgsinfo.Check.File = append(pkgsinfo.Check.File, localFileCheck(path))
+		}
 	}
 
 	// Handle scripts
 	if installCheckScript != "" {
 		content, err := os.ReadFile(installCheckScript)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading installcheck script: %v\n", err)
+			logging.Errorf("Error reading installcheck script: %v\n", err)
 			os.Exit(1)
 		}
 		pkgsinfo.InstallCheckScript = string(content)
@@ -182,7 +326,7 @@ func main() {
 	if uninstallCheckScript != "" {
 		content, err := os.ReadFile(uninstallCheckScript)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading uninstallcheck script: %v\n", err)
+			logging.Errorf("Error reading uninstallcheck script: %v\n", err)
 			os.Exit(1)
 		}
 		pkgsinfo.UninstallCheckScript = string(content)
@@ -190,7 +334,7 @@ func main() {
 	if preinstallScript != "" {
 		content, err := os.ReadFile(preinstallScript)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading preinstall script: %v\n", err)
+			logging.Errorf("Error reading preinstall script: %v\n", err)
 			os.Exit(1)
 		}
 		pkgsinfo.PreinstallScript = string(content)
@@ -198,16 +342,16 @@ func main() {
 	if postinstallScript != "" {
 		content, err := os.ReadFile(postinstallScript)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading postinstall script: %v\n", err)
+			logging.Errorf("Error reading postinstall script: %v\n", err)
 			os.Exit(1)
 		}
 		pkgsinfo.PostinstallScript = string(content)
 	}
 
 	// Output pkgsinfo as YAML
-	yamlData, err := yaml.Marshal(&pkgsinfo)
+	yamlData, err := pkginfo.Encode(pkgsinfo)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error marshaling YAML: %v\n", err)
+		logging.Errorf("Error marshaling YAML: %v\n", err)
 		os.Exit(1)
 	}
 	fmt.Println(string(yamlData))
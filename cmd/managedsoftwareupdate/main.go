@@ -3,39 +3,86 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
     "flag"
     "fmt"
+    "io"
+    "net/http"
     "os"
     "os/signal"
     "path/filepath"
+    "strings"
     "syscall"
+    "time"
     "unsafe"
 
+    "github.com/windowsadmins/gorilla/pkg/auth"
     "github.com/windowsadmins/gorilla/pkg/catalog"
     "github.com/windowsadmins/gorilla/pkg/config"
+    "github.com/windowsadmins/gorilla/pkg/crypto"
+    "github.com/windowsadmins/gorilla/pkg/download"
+    "github.com/windowsadmins/gorilla/pkg/facts"
     "github.com/windowsadmins/gorilla/pkg/installer"
     "github.com/windowsadmins/gorilla/pkg/logging"
     "github.com/windowsadmins/gorilla/pkg/manifest"
+    "github.com/windowsadmins/gorilla/pkg/pkginfo"
     "github.com/windowsadmins/gorilla/pkg/preflight"
     "github.com/windowsadmins/gorilla/pkg/process"
+    "github.com/windowsadmins/gorilla/pkg/progress"
+    "github.com/windowsadmins/gorilla/pkg/report"
+    "github.com/windowsadmins/gorilla/pkg/runlock"
     "github.com/windowsadmins/gorilla/pkg/status"
+    "github.com/windowsadmins/gorilla/pkg/utils"
+    "github.com/windowsadmins/gorilla/pkg/version"
 
+    "github.com/AlecAivazis/survey/v2"
     "golang.org/x/sys/windows"
     "gopkg.in/yaml.v3"
 )
 
 var verbosity int
 
+// exitInterrupted is the exit code of a run stopped by SIGTERM or SIGINT, 128 + SIGINT as shells report it
+const exitInterrupted = 130
+
+// errInterrupted is why a run stopped by a signal ended early
+var errInterrupted = fmt.Errorf("interrupted")
+
+// runResult is what became of every item processed in the run, for the summary and the exit code
+var runResult process.ProcessResult
+
+// runLock is held for the whole run, so runs never overlap
+var runLock *runlock.Lock
+
 func main() {
     // Define command-line flags
     var (
-        showConfig  = flag.Bool("show-config", false, "Display the current configuration and exit.")
-        checkOnly   = flag.Bool("checkonly", false, "Check for updates, but don't install them.")
-        installOnly = flag.Bool("installonly", false, "Install pending updates without checking for new ones.")
-        auto        = flag.Bool("auto", false, "Perform automatic updates.")
+        showConfig       = flag.Bool("show-config", false, "Display each configuration value and its source, and exit.")
+        checkOnly        = flag.Bool("checkonly", false, "Check for updates, but don't install them.")
+        installOnly      = flag.Bool("installonly", false, "Install pending updates without checking for new ones.")
+        downloadOnly     = flag.Bool("download-only", false, "Check for updates and download them, but don't install them.")
+        metadataOnly     = flag.Bool("metadata-only", false, "Refresh the manifests and catalogs and check in, without checking or installing items.")
+        registerTasks    = flag.Bool("register-tasks", false, "Create or remove the scheduled task of metadata only runs, as metadata_run_interval_minutes says, and exit.")
+        auto             = flag.Bool("auto", false, "Perform automatic updates.")
+        includeAttended  = flag.Bool("include-attended", false, "With --auto, also install the items with unattended_install false.")
+        setAuth          = flag.Bool("set-auth", false, "Prompt for repo credentials and store them in the registry.")
+        encryptSecret    = flag.Bool("encrypt-secret", false, "Read a value from stdin and print it encrypted with DPAPI for Config.yaml, and exit.")
+        verifyAuth       = flag.Bool("verify-auth", false, "Send a HEAD request to the repo and report the status.")
+        decommissionFlag = flag.Bool("decommission", false, "Uninstall every managed item and clear the cache.")
+        assumeYes        = flag.Bool("yes", false, "Don't ask for confirmation with --decommission.")
+        showStatus       = flag.Bool("status", false, "Print the status of the last run and exit.")
+        showHistory      = flag.Bool("history", false, "Print the install history, or that of the item named after the flags, and exit.")
+        showFacts        = flag.Bool("facts", false, "Print the facts gathered about this machine and exit.")
+        showPending      = flag.Bool("show-pending", false, "Print the items a check only or download only run left pending, marking those deferred after repeated failures, and exit.")
+        retryFailed      = flag.Bool("retry-failed", false, "Clear the backoff of items that failed repeatedly, so they are attempted in this run.")
+        showResolution   = flag.String("show-resolution", "", "Print which catalog an item is taken from, and the versions it shadows, and exit.")
+        echoCommands     = flag.Bool("echo-commands", false, "Log every command and each of its arguments before it runs. With --checkonly, log the commands without running them.")
+        progressPipe     = flag.String("progress-pipe", "", "Write progress events as lines of JSON to this named pipe or file.")
     )
 
     flag.IntVar(&verbosity, "v", 0, "Increase verbosity with multiple -v flags.")
+    showVersion, versionJSON := version.Flags()
 
     // Custom usage function
     flag.Usage = func() {
@@ -46,13 +93,85 @@ func main() {
         fmt.Println("  -v, --verbose       Increase verbosity. Can be used multiple times.")
         fmt.Println("  --checkonly         Check for updates, but don't install them.")
         fmt.Println("  --installonly       Install pending updates without checking for new ones.")
+        fmt.Println("  --download-only     Check for updates and download them, but don't install them.")
+        fmt.Println("  --metadata-only     Refresh the manifests and catalogs and check in, without checking or installing items.")
         fmt.Println("  --auto              Perform automatic updates.")
-        fmt.Println("  --show-config       Display the current configuration and exit.")
+        fmt.Println("  --include-attended  With --auto, also install the items with unattended_install false.")
+        fmt.Println("  --show-config       Display each configuration value and its source, and exit. Add --json to print it as JSON.")
+        fmt.Println("  --set-auth          Prompt for repo credentials and store them in the registry.")
+        fmt.Println("  --verify-auth       Send a HEAD request to the repo and report the status.")
+        fmt.Println("  --encrypt-secret    Read a value from stdin and print it encrypted with DPAPI for Config.yaml, and exit.")
+        fmt.Println("  --decommission      Uninstall every managed item and clear the cache.")
+        fmt.Println("  --yes               Don't ask for confirmation with --decommission.")
+        fmt.Println("  --status            Print the status of the last run and exit.")
+        fmt.Println("  --history [item]    Print the install history, or that of one item, and exit. Add --json to print it as JSON.")
+        fmt.Println("  --facts             Print the facts gathered about this machine as YAML and exit. Add --json to print them as JSON.")
+        fmt.Println("  --show-pending      Print the items a check only or download only run left pending, marking those deferred after repeated failures, and exit.")
+        fmt.Println("  --retry-failed      Clear the backoff of items that failed repeatedly, so they are attempted in this run.")
+        fmt.Println("  --show-resolution <item>  Print which catalog an item is taken from, and the versions it shadows, and exit.")
+        fmt.Println("  --progress-pipe <path>    Write progress events as lines of JSON to this named pipe or file.")
+        fmt.Println("  --register-tasks    Create or remove the scheduled task of metadata only runs, as metadata_run_interval_minutes says, and exit.")
+        fmt.Println("  --echo-commands     Log every command and each of its arguments before it runs. With --checkonly, log the commands without running them.")
+        fmt.Println("  --version           Print the version and exit. Add --json to print it as JSON.")
     }
 
     // Parse flags early
     flag.Parse()
 
+    if *showVersion {
+        if err := version.Show(*versionJSON); err != nil {
+            fmt.Fprintf(os.Stderr, "Unable to print the version: %v\n", err)
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
+
+    // Report the last run without starting a new one
+    if *showStatus {
+        data, err := report.ReadStatus()
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Unable to read %s: %v\n", report.StatusPath(), err)
+            os.Exit(1)
+        }
+        fmt.Print(string(data))
+        os.Exit(0)
+    }
+
+    if *showHistory {
+        if err := printHistory(flag.Arg(0), *versionJSON); err != nil {
+            fmt.Fprintf(os.Stderr, "Unable to read %s: %v\n", report.HistoryPath(), err)
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
+
+    if *showFacts {
+        if err := printFacts(*versionJSON); err != nil {
+            fmt.Fprintf(os.Stderr, "Unable to print the facts: %v\n", err)
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
+
+    if *encryptSecret {
+        encrypted, err := readSecret(os.Stdin)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Unable to encrypt the secret: %v\n", err)
+            os.Exit(1)
+        }
+        fmt.Println(encrypted)
+        os.Exit(0)
+    }
+
+    // The status is only saved for runs, not for the commands that exit early
+    run := runType(*auto, *checkOnly, *installOnly, *downloadOnly, *metadataOnly)
+    if *decommissionFlag {
+        run = "decommission"
+    }
+    if *showConfig || *showPending || *setAuth || *verifyAuth || *registerTasks || *showResolution != "" {
+        run = ""
+    }
+
     // Initialize logging functions after parsing flags
     logInfo := func(message string, args ...interface{}) {
         if verbosity >= 1 {
@@ -64,27 +183,48 @@ func main() {
         fmt.Fprintf(os.Stderr, message+"\n", args...)
     }
 
-    // Handle system signals for cleanup
+    // On a signal, let the item being installed finish and start no new ones.
+    // A second signal kills the installer that is running. The run still ends here
+    // on the main goroutine, which saves its status.
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
     signalChan := make(chan os.Signal, 1)
     signal.Notify(signalChan, syscall.SIGTERM, syscall.SIGINT)
     go func() {
         <-signalChan
-        logInfo("Signal received, exiting gracefully...")
-        os.Exit(1)
+        logInfo("Signal received, finishing the current item...")
+        logging.Warn("Shutdown requested, no new items will start")
+        cancel()
+        <-signalChan
+        logInfo("Signal received again, stopping the current item...")
+        logging.Warn("Shutdown requested again, the running installer is stopped")
+        installer.EndShutdownGrace()
     }()
 
-    // Run the preflight script regardless of flags
-    err := preflight.RunPreflight(verbosity, logInfo, logError)
-    if err != nil {
-        logError("Preflight script failed: %v", err)
-        os.Exit(1)
+    // Run the preflight scripts before every run. The commands that exit early aren't runs,
+    // such as --register-tasks when the MSI installs, so they don't run the scripts.
+    if run != "" {
+        // The preflight scripts are found with the configuration as it is before they run
+        preflightCfg, err := config.LoadConfig()
+        if err != nil {
+            preflightCfg = &config.Configuration{}
+        }
+        err = preflight.RunPreflight(preflightCfg, runType(*auto, *checkOnly, *installOnly, *downloadOnly, *metadataOnly), verbosity, logInfo, logError)
+        if err != nil {
+            logError("Preflight script failed: %v", err)
+            finish(run, 1, fmt.Errorf("preflight script failed: %v", err))
+        }
     }
 
     // Load configuration (in case preflight modified it)
     cfg, err := config.LoadConfig()
     if err != nil {
         logError("Failed to load configuration: %v", err)
-        os.Exit(1)
+        finish(run, 1, fmt.Errorf("failed to load configuration: %v", err))
+    }
+
+    if *echoCommands {
+        cfg.EchoCommands = true
     }
 
     // Initialize logger with loaded configuration
@@ -92,10 +232,16 @@ func main() {
     defer logging.CloseLogger()
 
     logInfo("Initializing...")
+    logging.Info("Starting", "version", version.Version().String())
+
+    // Select how requests to the repo are authenticated
+    if err := auth.Configure(*cfg); err != nil {
+        logging.Warn("Unable to configure authentication, continuing without it", "error", err)
+    }
 
     // Check for conflicting flags
-    if *checkOnly && *installOnly {
-        fmt.Fprintln(os.Stderr, "--checkonly and --installonly options are mutually exclusive!")
+    if exclusive(*checkOnly, *installOnly, *downloadOnly, *metadataOnly) > 1 {
+        fmt.Fprintln(os.Stderr, "--checkonly, --installonly, --download-only and --metadata-only options are mutually exclusive!")
         flag.Usage()
         os.Exit(1)
     }
@@ -104,7 +250,37 @@ func main() {
     admin, err := adminCheck()
     if err != nil || !admin {
         logError("Administrative access is required. Please run as an administrator.")
-        os.Exit(1)
+        finish(run, 1, fmt.Errorf("administrative access is required"))
+    }
+
+    if *setAuth {
+        if err := promptAuth(); err != nil {
+            logError("Failed to store credentials: %v", err)
+            os.Exit(1)
+        }
+        fmt.Println("Credentials stored.")
+        os.Exit(0)
+    }
+
+    if *verifyAuth {
+        status, err := checkAuth(cfg)
+        if err != nil {
+            logError("Failed to reach %s: %v", cfg.URL, err)
+            os.Exit(1)
+        }
+        fmt.Printf("%s: %d %s\n", cfg.URL, status, http.StatusText(status))
+        if status != http.StatusOK {
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
+
+    if *registerTasks {
+        if err := registerMetadataTask(cfg); err != nil {
+            logError("Failed to register the scheduled task: %v", err)
+            os.Exit(1)
+        }
+        os.Exit(0)
     }
 
     // Create the cache directory if needed
@@ -112,38 +288,176 @@ func main() {
     err = os.MkdirAll(filepath.Clean(cachePath), 0755)
     if err != nil {
         logError("Failed to create cache directory: %v", err)
-        os.Exit(1)
+        finish(run, 1, fmt.Errorf("failed to create cache directory: %v", err))
+    }
+
+    // Remove downloads a crash or power loss interrupted
+    download.SweepPartial(cachePath)
+    if filepath.Clean(download.CachePath) != filepath.Clean(cachePath) {
+        download.SweepPartial(download.CachePath)
     }
 
+    // Manifests and catalogs that haven't changed are not downloaded again
+    download.UseConditionalRequests(filepath.Join(cachePath, "conditional"))
+
     if *showConfig {
-        // Pretty-print the configuration as YAML
-        cfgYaml, err := yaml.Marshal(cfg)
-        if err != nil {
-            logError("Failed to marshal configuration: %v", err)
+        if err := printConfig(cfg, *versionJSON); err != nil {
+            logError("Failed to print configuration: %v", err)
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
+
+    if *showResolution != "" {
+        if err := printResolution(cfg, *showResolution); err != nil {
+            logError("Failed to resolve %s: %v", *showResolution, err)
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
+
+    if *showPending {
+        pending, err := process.LoadPending(cachePath)
+        if err != nil && !os.IsNotExist(err) {
+            logError("Failed to read the pending items: %v", err)
+            os.Exit(1)
+        }
+        if err := process.PrintPending(os.Stdout, pending, *cfg); err != nil {
+            logError("Failed to read the item failures: %v", err)
             os.Exit(1)
         }
-        fmt.Printf("Current Configuration:\n%s\n", cfgYaml)
         os.Exit(0)
     }
 
+    // Stagger automatic runs, so scheduled clients don't all reach the repo at the same moment
+    if *auto {
+        if delay := process.SplayDelay(*cfg); delay > 0 {
+            logInfo("Waiting %s before starting the automatic run...", delay)
+            logging.Info("Delaying the automatic run", "splay", delay.String())
+            if !waitSplay(ctx, delay) {
+                finish(run, exitInterrupted, errInterrupted)
+            }
+        }
+    }
+
+    // Full runs and metadata only runs never overlap
+    if run != "" {
+        lock, err := runlock.Acquire(runlock.DefaultPath)
+        if err != nil {
+            logError("Unable to start the run: %v", err)
+            os.Exit(1)
+        }
+        runLock = lock
+    }
+
+    // Items deferred after repeated failures are attempted again
+    if *retryFailed {
+        if err := process.ClearFailures(); err != nil {
+            logError("Failed to clear the item failures: %v", err)
+            finish(run, 1, fmt.Errorf("failed to clear the item failures: %v", err))
+        }
+        logInfo("Cleared the backoff of items that failed repeatedly.")
+    }
+
+    // Start recording the run for the report
+    report.Configure(*cfg)
+    report.Start()
+    installer.Configure(*cfg)
+
+    // Send progress events to a UI that wraps the run
+    if *progressPipe != "" {
+        if err := progress.Open(*progressPipe); err != nil {
+            logging.Warn("Unable to open the progress pipe, continuing without it", "path", *progressPipe, "error", err)
+        }
+    }
+    progress.RunStarted(run)
+
+    if *metadataOnly {
+        // Refresh the manifests and catalogs and check in, the items are checked by full runs
+        logInfo("Running in metadata-only mode.")
+        if _, _, _, _, err := getManifestItems(cfg); err != nil {
+            logError("Failed to get manifest items: %v", err)
+            report.CheckIn()
+            finish(run, 1, err)
+        }
+        report.CheckIn()
+        finish(run, 0, nil)
+    }
+
+    if *decommissionFlag {
+        // Remove everything Gorilla manages, for a device being repurposed
+        logInfo("Running in decommission mode.")
+        manual, err := decommission(ctx, cfg, *assumeYes)
+        report.End()
+        logResult()
+        if ctx.Err() != nil {
+            finish(run, exitInterrupted, errInterrupted)
+        }
+        if err != nil {
+            logError("Decommission failed: %v", err)
+            finish(run, 1, err)
+        }
+        if len(manual) > 0 {
+            fmt.Println("These items must be removed manually:")
+            for _, name := range manual {
+                fmt.Printf("  %s\n", name)
+            }
+            finish(run, 1, nil)
+        }
+        finish(run, 0, nil)
+    }
+
     // Determine run type based on flags
     if *auto {
         *checkOnly = false
         *installOnly = false
+        *downloadOnly = false
+        // Items that must not install in the background wait for an interactive run
+        cfg.Unattended = !*includeAttended
+    }
+
+    // Don't start downloading or installing on a nearly full disk
+    if !*checkOnly {
+        if err := installer.CheckMinimumFreeSpace(*cfg); err != nil {
+            logError("Not enough free space for the run: %v", err)
+            report.RecordError(err.Error())
+            report.End()
+            finish(run, 1, err)
+        }
+    }
+
+    // Installing while Windows waits for a reboot tends to fail with 1603 or ask for yet another reboot
+    if checkPendingReboot(cfg) && !*checkOnly && !*downloadOnly {
+        logInfo("Windows is waiting for a reboot. Skipping installs.")
+        if !*installOnly {
+            downloadPendingUpdates(ctx, cfg)
+        }
+        finishRun(ctx, run, 0)
+    }
+
+    if *downloadOnly {
+        // Download what is needed for the next install only run
+        logInfo("Running in download-only mode.")
+        downloadPendingUpdates(ctx, cfg)
+        finishRun(ctx, run, 0)
     }
 
     if *installOnly {
         // Skip checking, just install pending updates
         logInfo("Running in install-only mode.")
-        installPendingUpdates(cfg)
-        os.Exit(0)
+        if err := installDownloadedUpdates(ctx, cfg); err != nil {
+            logError("Not installing: %v", err)
+            report.End()
+            finish(run, 1, err)
+        }
+        finishRun(ctx, run, 0)
     }
 
     if *checkOnly {
         // Only check for updates, do not install
         logInfo("Running in check-only mode.")
-        checkForUpdates(cfg)
-        os.Exit(1)
+        checkForUpdates(ctx, cfg)
+        finishRun(ctx, run, 1)
     }
 
     // Default behavior: check for updates and install them
@@ -151,25 +465,187 @@ func main() {
         // For automatic updates, we might want to check for user activity
         if isUserActive() {
             logInfo("User is active. Skipping automatic updates.")
-            os.Exit(0)
+            installForcedUpdates(ctx, cfg)
+            finishRun(ctx, run, 0)
         }
     }
 
-    // Check for updates
-    updatesAvailable := checkForUpdates(cfg)
-    if updatesAvailable {
-        // Install updates
-        installPendingUpdates(cfg)
-    } else {
-        logInfo("No updates available.")
+    // Check for updates and install them
+    installPendingUpdates(ctx, cfg)
+    if ctx.Err() == nil {
+        logInfo("Software updates completed.")
+    }
+    finishRun(ctx, run, 0)
+}
+
+// printConfig prints the effective value of every configuration key and where it came from,
+// Config.yaml, a conf.d fragment or the default, with sensitive values redacted
+func printConfig(cfg *config.Configuration, asJSON bool) error {
+    settings := cfg.Settings()
+    if asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(settings)
+    }
+
+    fmt.Println("Current Configuration:")
+    for _, setting := range settings {
+        value, err := json.Marshal(setting.Value)
+        if err != nil {
+            return err
+        }
+        fmt.Printf("  %s: %s (%s)\n", setting.Key, value, setting.Source)
+    }
+    return nil
+}
+
+// readSecret reads a value from r and returns it encrypted with machine scope DPAPI,
+// as `!dpapi <base64>` to paste into Config.yaml. The line ending is not part of the value.
+func readSecret(r io.Reader) (string, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return "", err
+    }
+    value := strings.TrimRight(string(data), "\r\n")
+    if value == "" {
+        return "", fmt.Errorf("no value on stdin")
     }
+    encrypted, err := crypto.EncryptSecret(value)
+    if err != nil {
+        return "", err
+    }
+    return crypto.SecretTag + " " + encrypted, nil
+}
+
+// printHistory prints the installs and uninstalls in the history, oldest first,
+// only those of an item when one is named
+func printHistory(item string, asJSON bool) error {
+    entries, err := report.ReadHistory()
+    if err != nil {
+        return err
+    }
+    if item != "" {
+        entries = report.ItemHistory(entries, item)
+    }
+    if asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(entries)
+    }
+
+    for _, entry := range entries {
+        versions := entry.ToVersion
+        if entry.FromVersion != "" {
+            versions = entry.FromVersion + " -> " + entry.ToVersion
+        }
+        fmt.Printf("%s  %-9s %s %s (%s, %ds)\n", entry.Time, entry.Action, entry.Item, strings.TrimSpace(versions), entry.Method, int(entry.DurationSeconds))
+    }
+    return nil
+}
+
+// printFacts prints the facts gathered about this machine, and the facts that couldn't be read on stderr
+func printFacts(asJSON bool) error {
+    machine, errs := facts.Gather()
+    for _, err := range errs {
+        fmt.Fprintf(os.Stderr, "Unable to read %v\n", err)
+    }
+    if asJSON {
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(machine)
+    }
+    data, err := yaml.Marshal(machine)
+    if err != nil {
+        return err
+    }
+    fmt.Print(string(data))
+    return nil
+}
+
+// finish saves the status of the run for monitoring agents, then exits with the code.
+// runErr is why the run stopped early, if it did.
+func finish(run string, code int, runErr error) {
+    if run != "" {
+        if err := report.WriteStatus(run, runErr); err != nil {
+            fmt.Fprintf(os.Stderr, "Unable to write the status: %v\n", err)
+        }
+        progress.RunFinished(run, runSummary(code), runErr)
+    }
+    progress.Close()
+    os.Exit(code)
+}
+
+// runSummary counts the items installed, uninstalled and failed in the run for the progress events.
+// An item that failed any of its actions, such as verification after installing, counts only as failed.
+func runSummary(code int) progress.Summary {
+    return progress.Summary{
+        ExitCode:    code,
+        Installed:   runResult.CountAction("install", process.OutcomeSucceeded) + runResult.CountAction("update", process.OutcomeSucceeded),
+        Uninstalled: runResult.CountAction("uninstall", process.OutcomeSucceeded),
+        Failed:      runResult.Count(process.OutcomeFailed),
+        Pending:     len(report.PendingItems),
+    }
+}
+
+// waitSplay waits for the delay, returning false if a signal ended the wait
+func waitSplay(ctx context.Context, delay time.Duration) bool {
+    timer := time.NewTimer(delay)
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+        return true
+    case <-ctx.Done():
+        return false
+    }
+}
+
+// finishRun ends the report, records what was installed and uninstalled for --decommission,
+// and exits with the code, or with exitInterrupted
+// if a signal stopped the run before every item was done. A run where an item failed
+// or a download filled the disk exits with 1.
+func finishRun(ctx context.Context, run string, code int) {
+    // The items left after a download filled the disk were not started
+    diskErr := download.DiskFull()
+    if diskErr != nil {
+        logError("Stopped the run: %v", diskErr)
+    }
+    report.End()
+    logResult()
+    if err := process.RecordInstalls(runResult); err != nil {
+        logging.Warn("Unable to update the install record", "error", err)
+    }
+    if ctx.Err() != nil {
+        finish(run, exitInterrupted, errInterrupted)
+    }
+    if diskErr != nil {
+        finish(run, 1, diskErr)
+    }
+    if code == 0 && runResult.Failed() {
+        code = 1
+    }
+    finish(run, code, nil)
+}
 
-    logInfo("Software updates completed.")
-    os.Exit(0)
+// logResult logs how many items of the run succeeded, failed and were skipped, and why each was skipped or failed
+func logResult() {
+    if len(runResult.Items) == 0 {
+        return
+    }
+    for _, item := range runResult.Items {
+        switch item.Outcome {
+        case process.OutcomeFailed, process.OutcomeSkipped:
+            logging.Debug("Item result:", item.Name, item.Action, item.Outcome, item.Reason, item.Err)
+        }
+    }
+    logging.Info(fmt.Sprintf("%d succeeded, %d failed, %d skipped, %d pending, %d not needed",
+        runResult.Count(process.OutcomeSucceeded), runResult.Count(process.OutcomeFailed),
+        runResult.Count(process.OutcomeSkipped), runResult.Count(process.OutcomePending),
+        runResult.Count(process.OutcomeNotNeeded)))
 }
 
 func logError(message string, args ...interface{}) {
     fmt.Fprintf(os.Stderr, message+"\n", args...)
+    report.RecordError(fmt.Sprintf(message, args...))
 }
 
 func logInfo(message string, args ...interface{}) {
@@ -190,6 +666,35 @@ func logVeryVerbose(message string, args ...interface{}) {
     }
 }
 
+// runType names the kind of run for the preflight scripts
+func runType(auto, checkOnly, installOnly, downloadOnly, metadataOnly bool) string {
+    switch {
+    case metadataOnly:
+        return report.MetadataRun
+    case auto:
+        return "auto"
+    case checkOnly:
+        return "checkonly"
+    case installOnly:
+        return "installonly"
+    case downloadOnly:
+        return "downloadonly"
+    default:
+        return "checkandinstall"
+    }
+}
+
+// exclusive counts the modes that are set
+func exclusive(modes ...bool) int {
+    count := 0
+    for _, mode := range modes {
+        if mode {
+            count++
+        }
+    }
+    return count
+}
+
 // adminCheck checks if the program is running with admin privileges.
 func adminCheck() (bool, error) {
     // Skip the check if this is test
@@ -222,6 +727,39 @@ func adminCheck() (bool, error) {
     return admin, nil
 }
 
+// promptAuth asks for the repo username and password and stores them in the registry.
+// The password is not echoed.
+func promptAuth() error {
+    var username, password string
+    err := survey.AskOne(&survey.Input{Message: "Username:"}, &username, survey.WithValidator(survey.Required))
+    if err != nil {
+        return err
+    }
+    err = survey.AskOne(&survey.Password{Message: "Password:"}, &password)
+    if err != nil {
+        return err
+    }
+
+    return auth.SetAuthHeader(username, password)
+}
+
+// checkAuth sends an authenticated HEAD request to the repo and returns the status code,
+// so deployment scripts can confirm the stored credentials are accepted.
+func checkAuth(cfg *config.Configuration) (int, error) {
+    req, err := utils.NewAuthenticatedRequest("HEAD", cfg.URL, nil)
+    if err != nil {
+        return 0, err
+    }
+
+    resp, err := utils.NewClient(0).Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+
+    return resp.StatusCode, nil
+}
+
 // getIdleSeconds uses the Windows API to get the system's idle time in seconds.
 type LASTINPUTINFO struct {
     CbSize uint32
@@ -255,97 +793,250 @@ func isUserActive() bool {
     return idleSeconds < 300
 }
 
+// getManifestItems retrieves the manifests and the catalogs they reference,
+// then compiles the items to install, uninstall, and update.
+func getManifestItems(cfg *config.Configuration) (installs, uninstalls, updates []string, catalogsMap map[int]map[string]catalog.Item, err error) {
+    // Fetch the manifests and any catalogs they add
+    manifests, newCatalogs := manifest.Get(*cfg)
+
+    catalogsMap, err = catalog.Get(*cfg, catalogOrder(cfg, newCatalogs))
+    if err != nil {
+        return nil, nil, nil, nil, err
+    }
+
+    installs, uninstalls, updates = process.Manifests(manifests, catalogsMap)
+    return installs, uninstalls, updates, catalogsMap, nil
+}
+
+// catalogOrder returns the catalogs in priority order. Catalogs from the config come first,
+// followed by those of the primary manifest and then those of the included manifests.
+func catalogOrder(cfg *config.Configuration, newCatalogs []string) []string {
+    var catalogs []string
+    catalogs = append(catalogs, cfg.Catalogs...)
+    catalogs = append(catalogs, newCatalogs...)
+    return catalogs
+}
+
+// printResolution prints every catalog that has an item, in priority order,
+// with the one it is taken from and the versions that one shadows
+func printResolution(cfg *config.Configuration, itemName string) error {
+    _, newCatalogs := manifest.Get(*cfg)
+    catalogs := catalogOrder(cfg, newCatalogs)
+    catalogsMap, err := catalog.Get(*cfg, catalogs)
+    if err != nil {
+        return err
+    }
+
+    entries := process.Resolution(itemName, catalogsMap)
+    if len(entries) == 0 {
+        return fmt.Errorf("not in any of the catalogs %v", catalogs)
+    }
+
+    fmt.Printf("%s in catalog priority order:\n", itemName)
+    var used *process.CatalogEntry
+    for i, entry := range entries {
+        state := "shadowed"
+        switch {
+        case !entry.Valid:
+            state = "skipped, no installer or uninstaller"
+        case used == nil:
+            state = "used"
+            used = &entries[i]
+        case catalog.NewerVersion(entry.Item.Version, used.Item.Version):
+            state = "shadowed, newer than the version used"
+        }
+        fmt.Printf("  %d. %s: %s (%s)\n", entry.Priority, catalogs[entry.Priority-1], entry.Item.Version, state)
+    }
+    return nil
+}
+
 // checkForUpdates checks for available updates and returns true if updates are available.
-func checkForUpdates(cfg *config.Configuration) bool {
+func checkForUpdates(ctx context.Context, cfg *config.Configuration) bool {
     logInfo("Checking for updates...")
 
-    updatesAvailable := false
-
-    // Fetch manifest items
-    manifestItems, err := manifest.Get(*cfg)
+    installs, uninstalls, updates, catalogsMap, err := getManifestItems(cfg)
     if err != nil {
         logError("Failed to get manifest items: %v", err)
         return false
     }
 
-    // Check each item for updates
-    for _, item := range manifestItems {
-        logInfo("Checking for updates: %s", item.Name)
-        if needsUpdate(item, cfg) {
-            logInfo("Update available for %s", item.Name)
-            updatesAvailable = true
+    // Run through every item without taking action
+    checkCfg := *cfg
+    checkCfg.CheckOnly = true
+    var result process.ProcessResult
+    result.Merge(process.Installs(ctx, installs, catalogsMap, checkCfg))
+    result.Merge(process.Uninstalls(ctx, uninstalls, catalogsMap, checkCfg))
+    result.Merge(process.Updates(ctx, updates, catalogsMap, checkCfg))
+    runResult.Merge(result)
+
+    // Save what needs action for the next install only run, unless the checks were interrupted
+    if ctx.Err() == nil {
+        if err := process.SavePending(cfg.CachePath, process.CheckedPending(result)); err != nil {
+            logError("Failed to save the pending actions: %v", err)
         }
     }
 
-    return updatesAvailable
+    return result.Count(process.OutcomePending) > 0
+}
+
+// checkPendingReboot records whether Windows is waiting for a reboot, and returns true when
+// installs are skipped for it. `on_pending_reboot` is warn, the default, skip-installs or proceed.
+func checkPendingReboot(cfg *config.Configuration) bool {
+    reasons := status.PendingReboot()
+    if len(reasons) == 0 {
+        return false
+    }
+    report.RecordPendingReboot(reasons)
+
+    message := "Windows is waiting for a reboot: " + strings.Join(reasons, ", ")
+    switch {
+    case strings.EqualFold(cfg.OnPendingReboot, "skip-installs"):
+        logging.Warn("Windows is waiting for a reboot, skipping installs", "reasons", reasons)
+        report.RecordWarning(message)
+        return true
+    case strings.EqualFold(cfg.OnPendingReboot, "proceed"):
+        logging.Info("Windows is waiting for a reboot, installing anyway", "reasons", reasons)
+    default:
+        logging.Warn("Windows is waiting for a reboot", "reasons", reasons)
+        report.RecordWarning(message)
+    }
+    return false
 }
 
 // installPendingUpdates installs updates for all items that need updating.
-func installPendingUpdates(cfg *config.Configuration) {
+func installPendingUpdates(ctx context.Context, cfg *config.Configuration) {
     logInfo("Installing updates...")
 
-    // Fetch manifest items
-    manifestItems, err := manifest.Get(*cfg)
+    installs, uninstalls, updates, catalogsMap, err := getManifestItems(cfg)
     if err != nil {
         logError("Failed to get manifest items: %v", err)
         return
     }
 
-    // Install updates for each item
-    for _, item := range manifestItems {
-        logInfo("Checking for updates: %s", item.Name)
-        if needsUpdate(item, cfg) {
-            logInfo("Installing update for %s...", item.Name)
-            installUpdate(item, cfg)
-        }
+    runResult.Merge(process.Installs(ctx, installs, catalogsMap, *cfg))
+    runResult.Merge(process.Uninstalls(ctx, uninstalls, catalogsMap, *cfg))
+    runResult.Merge(process.Updates(ctx, updates, catalogsMap, *cfg))
+    if ctx.Err() != nil {
+        return
     }
 
+    // The items were checked again, so the pending actions of an earlier run are outdated
+    process.ClearPending(cfg.CachePath)
+
     // Clean up cache
     cachePath := cfg.CachePath
     logInfo("Cleaning up old cache...")
     process.CleanUp(cachePath)
+    installer.PruneInstallLogs(cachePath, cfg.InstallLogRetentionDays)
 }
 
-func needsUpdate(item manifest.Item, cfg *config.Configuration) bool {
-    catalogItem := catalog.Item{
-        Name:    item.Name,
-        Version: item.Version,
+// installForcedUpdates installs only the items past their force_install_after_date,
+// for automatic runs that are skipped because the user is active.
+func installForcedUpdates(ctx context.Context, cfg *config.Configuration) {
+    installs, _, updates, catalogsMap, err := getManifestItems(cfg)
+    if err != nil {
+        logError("Failed to get manifest items: %v", err)
+        return
     }
-    cachePath := cfg.CachePath
-    actionNeeded, err := status.CheckStatus(catalogItem, "install", cachePath)
-    return err != nil || actionNeeded
+
+    runResult.Merge(process.ForceInstalls(ctx, installs, updates, catalogsMap, *cfg))
+}
+
+// downloadPendingUpdates downloads the items that need action and records them
+// as pending for the next install only run, without installing anything
+func downloadPendingUpdates(ctx context.Context, cfg *config.Configuration) {
+    logInfo("Downloading updates...")
+
+    installs, uninstalls, updates, catalogsMap, err := getManifestItems(cfg)
+    if err != nil {
+        logError("Failed to get manifest items: %v", err)
+        return
+    }
+
+    pending, err := process.DownloadOnly(ctx, installs, uninstalls, updates, catalogsMap, *cfg)
+    if err != nil {
+        logError("Failed to save the pending items: %v", err)
+        return
+    }
+    logInfo("%d installs, %d uninstalls and %d updates pending.", len(pending.Installs), len(pending.Uninstalls), len(pending.Updates))
 }
 
-func installUpdate(item manifest.Item, cfg *config.Configuration) {
-    catalogItem := catalog.Item{
-        DisplayName: item.Name,
-        Version:     item.Version,
-        Installer: catalog.InstallerItem{
-            Type:     getInstallerType(item.InstallerLocation),
-            Location: item.InstallerLocation,
-        },
+// installDownloadedUpdates installs the items a check only or download only run left pending.
+// It returns an error without installing anything when there are none or they are stale,
+// rather than guessing from the manifests.
+func installDownloadedUpdates(ctx context.Context, cfg *config.Configuration) error {
+    pending, err := process.LoadPending(cfg.CachePath)
+    if os.IsNotExist(err) {
+        return fmt.Errorf("no pending actions, run with --checkonly or --download-only first")
     }
+    if err != nil {
+        return fmt.Errorf("failed to read the pending actions: %v", err)
+    }
+    if maxAge := process.PendingMaxAge(*cfg); pending.Stale(maxAge) {
+        return fmt.Errorf("the pending actions from %s are older than %s, run with --checkonly or --download-only again",
+            pending.Created.Format("2006-01-02 15:04:05"), maxAge)
+    }
+
+    logInfo("Installing pending updates...")
+    runResult.Merge(process.InstallPending(ctx, pending, *cfg))
+    return nil
+}
 
-    result := installer.Install(catalogItem, "install", cfg.URLPkgsInfo, cfg.CachePath, false)
+// decommission uninstalls the managed_installs of the manifests and the items recorded
+// in InstallInfo.yaml, then clears the cache. It returns the items to remove manually.
+func decommission(ctx context.Context, cfg *config.Configuration, assumeYes bool) ([]string, error) {
+    installs, _, _, catalogsMap, err := getManifestItems(cfg)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get manifest items: %v", err)
+    }
 
-    if result != "" && result != "Item not needed" {
-        fmt.Printf("Failed to install %s: %s\n", item.Name, result)
+    // Items installed outside of the current manifests are in the install record
+    names := installs
+    installInfo, err := pkginfo.ReadInstallInfo(pkginfo.InstallInfoPath)
+    if err != nil {
+        logging.Warn("Unable to read the install record", "error", err)
+    }
+    for _, item := range installInfo.InstalledItems {
+        names = append(names, item.Name)
+    }
+
+    items := process.DecommissionOrder(names, catalogsMap)
+    if len(items) == 0 {
+        fmt.Println("No managed items to remove.")
     } else {
-        fmt.Printf("Successfully installed %s\n", item.Name)
+        fmt.Println("These items will be uninstalled:")
+        for _, item := range items {
+            fmt.Printf("  %s %s\n", item.Name, item.Version)
+        }
     }
-}
 
-func getInstallerType(installerLocation string) string {
-    switch filepath.Ext(installerLocation) {
-    case ".msi":
-        return "msi"
-    case ".exe":
-        return "exe"
-    case ".ps1":
-        return "ps1"
-    case ".nupkg":
-        return "nupkg"
-    default:
-        return ""
+    if !assumeYes {
+        confirmed := false
+        err := survey.AskOne(&survey.Confirm{Message: "Uninstall every managed item and clear the cache?"}, &confirmed)
+        if err != nil {
+            return nil, err
+        }
+        if !confirmed {
+            return nil, fmt.Errorf("canceled")
+        }
+    }
+
+    manual, result := process.Decommission(ctx, items, *cfg)
+    runResult.Merge(result)
+    if ctx.Err() != nil {
+        return manual, errInterrupted
+    }
+
+    // Clear the cache, keeping the directory itself
+    logInfo("Clearing the cache...")
+    entries, err := os.ReadDir(cfg.CachePath)
+    if err != nil {
+        return manual, fmt.Errorf("failed to read the cache: %v", err)
+    }
+    for _, entry := range entries {
+        if err := os.RemoveAll(filepath.Join(cfg.CachePath, entry.Name())); err != nil {
+            logging.Warn("Unable to remove from the cache", "path", entry.Name(), "error", err)
+        }
     }
+    return manual, nil
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// metadataTaskName is the scheduled task of metadata only runs, next to the Gorilla task of full runs
+const metadataTaskName = "Gorilla Metadata"
+
+// maxTaskMinutes is the longest interval schtasks accepts for a task that repeats by the minute
+const maxTaskMinutes = 1439
+
+// registerMetadataTask creates the scheduled task that runs managedsoftwareupdate --metadata-only
+// every metadata_run_interval_minutes, as SYSTEM. Without an interval the task is removed.
+func registerMetadataTask(cfg *config.Configuration) error {
+	minutes := cfg.MetadataRunIntervalMinutes
+	if minutes <= 0 {
+		if err := exec.Command("schtasks.exe", "/QUERY", "/TN", metadataTaskName).Run(); err != nil {
+			logInfo("No metadata_run_interval_minutes and no %s task, nothing to do.", metadataTaskName)
+			return nil
+		}
+		if out, err := exec.Command("schtasks.exe", "/DELETE", "/F", "/TN", metadataTaskName).CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %s", err, out)
+		}
+		logging.Info("Removed the scheduled task", "task", metadataTaskName)
+		fmt.Printf("Removed the %s task.\n", metadataTaskName)
+		return nil
+	}
+	if minutes > maxTaskMinutes {
+		return fmt.Errorf("metadata_run_interval_minutes is %d, the longest interval is %d", minutes, maxTaskMinutes)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if out, err := exec.Command("schtasks.exe", metadataTaskArgs(executable, minutes)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	logging.Info("Registered the scheduled task", "task", metadataTaskName, "minutes", minutes)
+	fmt.Printf("The %s task runs every %d minutes.\n", metadataTaskName, minutes)
+	return nil
+}
+
+// metadataTaskArgs returns the schtasks arguments that create or replace the metadata only task
+func metadataTaskArgs(executable string, minutes int) []string {
+	return []string{
+		"/CREATE", "/F",
+		"/SC", "MINUTE", "/MO", strconv.Itoa(minutes),
+		"/TN", metadataTaskName,
+		"/TR", fmt.Sprintf(`"%s" --metadata-only`, executable),
+		"/RU", "SYSTEM", "/RL", "HIGHEST",
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/repo"
+)
+
+// manifestsJSON is the JSON form of manifests that --export-json writes and --import-json reads,
+// keyed by name as the client requests them, such as `site/default` for manifests/site/default.yaml
+type manifestsJSON struct {
+	Manifests map[string]Manifest `json:"manifests"`
+}
+
+// importResult is what --import-json did with each manifest
+type importResult struct {
+	Created   []string
+	Updated   []string
+	Unchanged []string
+}
+
+// readManifestsTree reads every manifest in the repo, by name
+func readManifestsTree(r *repo.Repo) (map[string]Manifest, error) {
+	manifests := make(map[string]Manifest)
+	err := r.WalkManifests(func(name, path string) error {
+		manifest, err := repo.ReadManifestFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		manifests[name] = manifest.Normalize()
+		return nil
+	})
+	return manifests, err
+}
+
+// exportJSON writes one manifest, or all of them for "all", as JSON
+func exportJSON(w io.Writer, r *repo.Repo, which string) error {
+	manifests, err := readManifestsTree(r)
+	if err != nil {
+		return err
+	}
+	if which != "all" {
+		manifest, ok := manifests[which]
+		if !ok {
+			return fmt.Errorf("manifest %q does not exist", which)
+		}
+		manifests = map[string]Manifest{which: manifest}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifestsJSON{Manifests: manifests})
+}
+
+// decodeManifestsJSON reads manifests written by --export-json, or made the same way
+func decodeManifestsJSON(data []byte) (map[string]Manifest, error) {
+	var imported manifestsJSON
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&imported); err != nil {
+		return nil, err
+	}
+	if len(imported.Manifests) == 0 {
+		return nil, fmt.Errorf("no manifests")
+	}
+
+	manifests := make(map[string]Manifest, len(imported.Manifests))
+	for name, manifest := range imported.Manifests {
+		if err := repo.ValidName(name); err != nil {
+			return nil, err
+		}
+		manifests[name] = manifest.Normalize()
+	}
+	return manifests, nil
+}
+
+// validateImport checks the items of imported manifests are in the catalogs of the repo
+// and the manifests they include exist, either in the import or already in the repo
+func validateImport(r *repo.Repo, imported, existing map[string]Manifest) ([]string, error) {
+	items, err := catalogItemNames(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, name := range sortedManifestNames(imported) {
+		manifest := imported[name]
+		for _, list := range [][]string{manifest.ManagedInstalls, manifest.ManagedUninstalls, manifest.ManagedUpdates} {
+			for _, item := range list {
+				if !items[item] {
+					problems = append(problems, fmt.Sprintf("%s: %q is not in any catalog", name, item))
+				}
+			}
+		}
+		for _, include := range manifest.IncludedManifests {
+			_, inImport := imported[include]
+			_, inRepo := existing[include]
+			if !inImport && !inRepo {
+				problems = append(problems, fmt.Sprintf("%s: included manifest %q does not exist", name, include))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// catalogItemNames returns the names of the items in the catalogs built under catalogs/
+func catalogItemNames(r *repo.Repo) (map[string]bool, error) {
+	names := make(map[string]bool)
+	catalogs, err := r.CatalogNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, catalog := range catalogs {
+		items, err := r.ReadCatalog(catalog)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			names[item.Name] = true
+		}
+	}
+	return names, nil
+}
+
+// importJSON creates and updates the manifests in a JSON file. Manifests that are already
+// the same are not written again. Unless force is set, nothing is written if the
+// manifests don't validate.
+func importJSON(r *repo.Repo, jsonPath string, force bool) (importResult, error) {
+	var result importResult
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return result, err
+	}
+	imported, err := decodeManifestsJSON(data)
+	if err != nil {
+		return result, fmt.Errorf("%s: %v", jsonPath, err)
+	}
+
+	existing, err := readManifestsTree(r)
+	if err != nil {
+		return result, err
+	}
+
+	if !force {
+		problems, err := validateImport(r, imported, existing)
+		if err != nil {
+			return result, err
+		}
+		if len(problems) > 0 {
+			return result, fmt.Errorf("the manifests don't validate, use --force to import them anyway:\n  %s", strings.Join(problems, "\n  "))
+		}
+	}
+
+	for _, name := range sortedManifestNames(imported) {
+		manifest := imported[name]
+		current, ok := existing[name]
+		if ok && reflect.DeepEqual(current, manifest) {
+			result.Unchanged = append(result.Unchanged, name)
+			continue
+		}
+
+		if err := r.WriteManifest(name, manifest); err != nil {
+			return result, err
+		}
+		if ok {
+			result.Updated = append(result.Updated, name)
+		} else {
+			result.Created = append(result.Created, name)
+		}
+	}
+	return result, nil
+}
+
+// sortedManifestNames returns the names of manifests in order, for output that doesn't change between runs
+func sortedManifestNames(manifests map[string]Manifest) []string {
+	names := make([]string, 0, len(manifests))
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printImportResult lists what --import-json created, updated and left unchanged
+func printImportResult(w io.Writer, result importResult) {
+	for _, group := range []struct {
+		label string
+		names []string
+	}{
+		{"Created", result.Created},
+		{"Updated", result.Updated},
+		{"Unchanged", result.Unchanged},
+	} {
+		fmt.Fprintf(w, "%s: %d\n", group.label, len(group.names))
+		for _, name := range group.names {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/repo"
+)
+
+// testRepo creates a repo with the files, by their paths under the repo
+func testRepo(t *testing.T, files map[string]string) *repo.Repo {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range []string{"manifests", "catalogs"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := repo.OpenConfig(config.Configuration{RepoPath: root})
+	if err != nil {
+		t.Fatalf("OpenConfig failed: %v", err)
+	}
+	return r
+}
+
+// exportToFile exports every manifest of a repo to a JSON file and returns its path
+func exportToFile(t *testing.T, r *repo.Repo) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := exportJSON(&buf, r, "all"); err != nil {
+		t.Fatalf("exportJSON failed: %v", err)
+	}
+	jsonPath := filepath.Join(t.TempDir(), "manifests.json")
+	if err := os.WriteFile(jsonPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return jsonPath
+}
+
+// TestJSONRoundTrip validates manifests exported to JSON and imported into another repo are the same,
+// including keys only the client reads, and importing them again changes nothing
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		description string
+		manifests   map[string]string
+	}{
+		{"lists", map[string]string{
+			"manifests/site_default.yaml": "name: site_default\nmanaged_installs: [Firefox, Chrome]\nmanaged_uninstalls: [Java]\ncatalogs: [Production]\n",
+		}},
+		{"nested names and includes", map[string]string{
+			"manifests/site_default.yaml": "name: site_default\nmanaged_installs: [Firefox]\n",
+			"manifests/site/lab.yaml":     "name: site/lab\nincluded_manifests: [site_default]\nmanaged_updates: [Chrome]\n",
+		}},
+		{"keys the client reads", map[string]string{
+			"manifests/pinned.yaml": "name: pinned\nversion: \"1.2\"\ninstaller_location: /apps/Tool-1.2.msi\nmanaged_installs: [Tool]\n",
+		}},
+		{"empty lists", map[string]string{
+			"manifests/empty.yaml": "name: empty\n",
+		}},
+	}
+	for _, tt := range tests {
+		source := testRepo(t, tt.manifests)
+		jsonPath := exportToFile(t, source)
+
+		target := testRepo(t, nil)
+		result, err := importJSON(target, jsonPath, true)
+		if err != nil {
+			t.Fatalf("%s: importJSON failed: %v", tt.description, err)
+		}
+		if len(result.Created) != len(tt.manifests) {
+			t.Errorf("%s: expected %d manifests created, got %+v", tt.description, len(tt.manifests), result)
+		}
+
+		exported, err := readManifestsTree(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported, err := readManifestsTree(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(exported, imported) {
+			t.Errorf("%s: expected the imported manifests to match\n%+v\ngot\n%+v", tt.description, exported, imported)
+		}
+
+		result, err = importJSON(target, jsonPath, true)
+		if err != nil || len(result.Unchanged) != len(tt.manifests) {
+			t.Errorf("%s: expected every manifest unchanged on the second import, got %+v %v", tt.description, result, err)
+		}
+	}
+}
+
+// TestImportJSONKeepsClientKeys validates importing over an existing manifest keeps the keys
+// the client reads that aren't manifest lists
+func TestImportJSONKeepsClientKeys(t *testing.T) {
+	r := testRepo(t, map[string]string{
+		"manifests/pinned.yaml": "name: pinned\nmanaged_installs: [Tool]\n",
+	})
+	jsonPath := filepath.Join(t.TempDir(), "manifests.json")
+	data := `{"manifests": {"pinned": {"name": "pinned", "version": "1.2", "installer_location": "/apps/Tool-1.2.msi", "managed_installs": ["Tool"]}}}`
+	if err := os.WriteFile(jsonPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := importJSON(r, jsonPath, true)
+	if err != nil || len(result.Updated) != 1 {
+		t.Fatalf("expected pinned updated, got %+v %v", result, err)
+	}
+	manifest, err := r.ReadManifest("pinned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Extras["version"] != "1.2" || manifest.Extras["installer_location"] != "/apps/Tool-1.2.msi" {
+		t.Errorf("expected the version and installer_location to be written, got %v", manifest.Extras)
+	}
+}
+
+// TestImportJSONValidates validates nothing is written when an item isn't in a catalog
+// or an included manifest doesn't exist, unless forced
+func TestImportJSONValidates(t *testing.T) {
+	r := testRepo(t, map[string]string{
+		"catalogs/Production.yaml": "- name: Firefox\n  version: \"128.0\"\n",
+	})
+	jsonPath := filepath.Join(t.TempDir(), "manifests.json")
+	data := `{"manifests": {"site_default": {"name": "site_default", "managed_installs": ["Firefox", "Missing"], "included_manifests": ["nowhere"]}}}`
+	if err := os.WriteFile(jsonPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := importJSON(r, jsonPath, false); err == nil {
+		t.Error("expected the unknown item and include to fail validation")
+	}
+	if names, _ := r.ManifestNames(); len(names) != 0 {
+		t.Errorf("expected nothing written, got %v", names)
+	}
+	if result, err := importJSON(r, jsonPath, true); err != nil || len(result.Created) != 1 {
+		t.Errorf("expected the forced import to create site_default, got %+v %v", result, err)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/repo"
+)
+
+// Severities of lint findings, in increasing order
+const (
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// severityRank orders the severities for the --lint-fail-on threshold
+var severityRank = map[string]int{severityWarning: 1, severityError: 2}
+
+// Finding is a problem lint found in a manifest
+type Finding struct {
+	File     string `json:"file"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// manifestsTree is every manifest under manifests/, by name as the client requests it,
+// such as `site/default` for manifests/site/default.yaml
+type manifestsTree struct {
+	root      string
+	manifests map[string]Manifest
+	findings  []Finding
+}
+
+// add records a finding for a manifest
+func (t *manifestsTree) add(name, severity, format string, args ...interface{}) {
+	t.findings = append(t.findings, Finding{
+		File:     filepath.Join(t.root, filepath.FromSlash(name)+".yaml"),
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// lintManifests checks the manifests tree under manifestDir against the catalogs and
+// pkgsinfo next to it in the repo, and returns the findings sorted by file
+func lintManifests(r *repo.Repo) ([]Finding, error) {
+	tree := &manifestsTree{root: r.ManifestsDir(), manifests: make(map[string]Manifest)}
+	err := r.WalkManifests(func(name, path string) error {
+		manifest, err := repo.ReadManifestFile(path)
+		if err != nil {
+			tree.add(name, severityError, "unable to parse: %v", err)
+			return nil
+		}
+		tree.manifests[name] = manifest
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := readRepoIndex(r)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(tree.manifests))
+	for name := range tree.manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		manifest := tree.manifests[name]
+		for _, include := range manifest.IncludedManifests {
+			if _, ok := tree.manifests[include]; !ok {
+				tree.add(name, severityError, "included manifest %q does not exist", include)
+			}
+		}
+		for _, catalog := range manifest.Catalogs {
+			switch {
+			case index.catalogs[catalog]:
+			case index.pkgsinfoCatalogs[catalog]:
+				tree.add(name, severityWarning, "catalog %q is in pkgsinfo but not built, run makecatalogs", catalog)
+			default:
+				tree.add(name, severityError, "catalog %q does not exist", catalog)
+			}
+		}
+		tree.checkItems(name, "managed_installs", manifest.ManagedInstalls, index)
+		tree.checkItems(name, "managed_uninstalls", manifest.ManagedUninstalls, index)
+		tree.checkItems(name, "managed_updates", manifest.ManagedUpdates, index)
+	}
+	tree.checkCycles(names)
+	for _, name := range names {
+		tree.checkConflicts(name)
+	}
+
+	sort.SliceStable(tree.findings, func(i, j int) bool {
+		return tree.findings[i].File < tree.findings[j].File
+	})
+	return tree.findings, nil
+}
+
+// repoIndex is what manifests can reference: the catalogs built under catalogs/ and their items,
+// and the catalogs and items in pkgsinfo, which makecatalogs would build
+type repoIndex struct {
+	catalogs, pkgsinfoCatalogs map[string]bool
+	items, pkgsinfoItems       map[string]bool
+}
+
+// readRepoIndex reads the catalogs and items of the repo
+func readRepoIndex(r *repo.Repo) (repoIndex, error) {
+	index := repoIndex{catalogs: make(map[string]bool), pkgsinfoCatalogs: make(map[string]bool), pkgsinfoItems: make(map[string]bool)}
+
+	catalogs, err := r.CatalogNames()
+	if err != nil {
+		return index, err
+	}
+	for _, catalog := range catalogs {
+		index.catalogs[catalog] = true
+	}
+	if index.items, err = catalogItemNames(r); err != nil {
+		return index, err
+	}
+
+	err = r.WalkPkgsinfo(func(path string, data []byte) error {
+		// An unreadable pkginfo is for makecatalogs to report
+		pkgsInfo, err := pkginfo.Decode(data)
+		if err != nil {
+			return nil
+		}
+		index.pkgsinfoItems[pkgsInfo.Name] = true
+		for _, catalog := range pkgsInfo.Catalogs {
+			index.pkgsinfoCatalogs[catalog] = true
+		}
+		return nil
+	})
+	return index, err
+}
+
+// checkItems reports the items of a list in a manifest that are listed more than once,
+// or that are in no catalog
+func (t *manifestsTree) checkItems(name, list string, items []string, index repoIndex) {
+	listed := make(map[string]bool)
+	for _, item := range items {
+		if listed[item] {
+			t.add(name, severityWarning, "%q is listed more than once in %s", item, list)
+			continue
+		}
+		listed[item] = true
+		switch {
+		case index.items[item]:
+		case index.pkgsinfoItems[item]:
+			t.add(name, severityWarning, "%q in %s is in pkgsinfo but not built, run makecatalogs", item, list)
+		default:
+			t.add(name, severityError, "%q in %s is not in any catalog", item, list)
+		}
+	}
+}
+
+// checkCycles reports each cycle of included_manifests once, on the manifest it was found from
+func (t *manifestsTree) checkCycles(names []string) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	reported := make(map[string]bool)
+	var stack []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, include := range t.manifests[name].IncludedManifests {
+			if _, ok := t.manifests[include]; !ok {
+				continue
+			}
+			switch state[include] {
+			case visiting:
+				var cycle []string
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == include {
+						cycle = append([]string{}, stack[i:]...)
+						break
+					}
+				}
+				members := append([]string{}, cycle...)
+				sort.Strings(members)
+				if key := strings.Join(members, "\x00"); !reported[key] {
+					reported[key] = true
+					t.add(name, severityError, "included_manifests cycle: %s -> %s", strings.Join(cycle, " -> "), include)
+				}
+			case 0:
+				visit(include)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+	}
+	for _, name := range names {
+		if state[name] == 0 {
+			visit(name)
+		}
+	}
+}
+
+// checkConflicts reports the items that are both installed and uninstalled by a manifest
+// once its included_manifests are expanded
+func (t *manifestsTree) checkConflicts(name string) {
+	installs := make(map[string]string)
+	uninstalls := make(map[string]string)
+	seen := make(map[string]bool)
+
+	var expand func(current string)
+	expand = func(current string) {
+		manifest, ok := t.manifests[current]
+		if !ok || seen[current] {
+			return
+		}
+		seen[current] = true
+		for _, item := range manifest.ManagedInstalls {
+			if _, ok := installs[item]; !ok {
+				installs[item] = current
+			}
+		}
+		for _, item := range manifest.ManagedUninstalls {
+			if _, ok := uninstalls[item]; !ok {
+				uninstalls[item] = current
+			}
+		}
+		for _, include := range manifest.IncludedManifests {
+			expand(include)
+		}
+	}
+	expand(name)
+
+	items := make([]string, 0, len(installs))
+	for item := range installs {
+		if _, ok := uninstalls[item]; ok {
+			items = append(items, item)
+		}
+	}
+	sort.Strings(items)
+	for _, item := range items {
+		t.add(name, severityError, "%q is in managed_installs of %s and managed_uninstalls of %s", item, installs[item], uninstalls[item])
+	}
+}
+
+// printFindings writes the findings grouped by file, or as JSON for CI annotations
+func printFindings(w io.Writer, findings []Finding, asJSON bool) error {
+	if asJSON {
+		if findings == nil {
+			findings = []Finding{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(findings)
+	}
+
+	file := ""
+	for _, finding := range findings {
+		if finding.File != file {
+			file = finding.File
+			fmt.Fprintln(w, file)
+		}
+		fmt.Fprintf(w, "  %s: %s\n", finding.Severity, finding.Message)
+	}
+	return nil
+}
+
+// lintFailed returns true if any finding is at or above the severity threshold
+func lintFailed(findings []Finding, threshold string) bool {
+	for _, finding := range findings {
+		if severityRank[finding.Severity] >= severityRank[threshold] {
+			return true
+		}
+	}
+	return false
+}
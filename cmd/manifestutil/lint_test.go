@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestLintManifests validates the findings for each kind of problem across a manifests tree
+func TestLintManifests(t *testing.T) {
+	const catalog = "catalogs/Production.yaml"
+	const catalogItems = "- name: Firefox\n  version: \"128.0\"\n- name: Chrome\n  version: \"126.0\"\n"
+	tests := []struct {
+		description string
+		files       map[string]string
+		expected    []Finding
+	}{
+		{"consistent", map[string]string{
+			catalog:                       catalogItems,
+			"manifests/site_default.yaml": "name: site_default\ncatalogs: [Production]\nmanaged_installs: [Firefox]\n",
+			"manifests/site/lab.yaml":     "name: site/lab\nincluded_manifests: [site_default]\nmanaged_updates: [Chrome]\n",
+		}, nil},
+		{"missing catalogs", map[string]string{
+			catalog:                       catalogItems,
+			"pkgsinfo/apps/Zoom.yaml":     "name: Zoom\nversion: \"6.1\"\ncatalogs: [Staging]\n",
+			"manifests/site_default.yaml": "name: site_default\ncatalogs: [Production, Staging, Testing]\n",
+		}, []Finding{
+			{"site_default.yaml", severityWarning, `catalog "Staging" is in pkgsinfo but not built, run makecatalogs`},
+			{"site_default.yaml", severityError, `catalog "Testing" does not exist`},
+		}},
+		{"unknown items", map[string]string{
+			catalog:                       catalogItems,
+			"pkgsinfo/apps/Zoom.yaml":     "name: Zoom\nversion: \"6.1\"\ncatalogs: [Production]\n",
+			"manifests/site_default.yaml": "name: site_default\nmanaged_installs: [Firefox, Zoom]\nmanaged_uninstalls: [Java]\n",
+		}, []Finding{
+			{"site_default.yaml", severityWarning, `"Zoom" in managed_installs is in pkgsinfo but not built, run makecatalogs`},
+			{"site_default.yaml", severityError, `"Java" in managed_uninstalls is not in any catalog`},
+		}},
+		{"duplicate items", map[string]string{
+			catalog:                       catalogItems,
+			"manifests/site_default.yaml": "name: site_default\nmanaged_installs: [Firefox, Chrome, Firefox]\nmanaged_updates: [Chrome, Chrome]\n",
+		}, []Finding{
+			{"site_default.yaml", severityWarning, `"Firefox" is listed more than once in managed_installs`},
+			{"site_default.yaml", severityWarning, `"Chrome" is listed more than once in managed_updates`},
+		}},
+		{"include cycles", map[string]string{
+			"manifests/a.yaml": "name: a\nincluded_manifests: [b]\n",
+			"manifests/b.yaml": "name: b\nincluded_manifests: [c, missing]\n",
+			"manifests/c.yaml": "name: c\nincluded_manifests: [a]\n",
+		}, []Finding{
+			{"b.yaml", severityError, `included manifest "missing" does not exist`},
+			{"c.yaml", severityError, "included_manifests cycle: a -> b -> c -> a"},
+		}},
+		{"conflicting install and uninstall", map[string]string{
+			catalog:                       catalogItems,
+			"manifests/site_default.yaml": "name: site_default\nmanaged_uninstalls: [Chrome]\n",
+			"manifests/site/lab.yaml":     "name: site/lab\nincluded_manifests: [site_default]\nmanaged_installs: [Chrome, Firefox]\n",
+		}, []Finding{
+			{"site/lab.yaml", severityError, `"Chrome" is in managed_installs of site/lab and managed_uninstalls of site_default`},
+		}},
+	}
+	for _, tt := range tests {
+		r := testRepo(t, tt.files)
+		findings, err := lintManifests(r)
+		if err != nil {
+			t.Fatalf("%s: lintManifests failed: %v", tt.description, err)
+		}
+		for i := range findings {
+			rel, err := filepath.Rel(r.ManifestsDir(), findings[i].File)
+			if err != nil {
+				t.Fatal(err)
+			}
+			findings[i].File = filepath.ToSlash(rel)
+		}
+		if !reflect.DeepEqual(findings, tt.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tt.description, tt.expected, findings)
+		}
+	}
+}
+
+// TestLintFailed validates the severity threshold of --lint-fail-on
+func TestLintFailed(t *testing.T) {
+	warning := []Finding{{File: "a.yaml", Severity: severityWarning, Message: "not built"}}
+	tests := []struct {
+		findings  []Finding
+		threshold string
+		expected  bool
+	}{
+		{nil, severityWarning, false},
+		{warning, severityError, false},
+		{warning, severityWarning, true},
+		{append(warning, Finding{File: "b.yaml", Severity: severityError}), severityError, true},
+	}
+	for _, tt := range tests {
+		if got := lintFailed(tt.findings, tt.threshold); got != tt.expected {
+			t.Errorf("%+v at %s: expected %v, got %v", tt.findings, tt.threshold, tt.expected, got)
+		}
+	}
+}
+
+// TestPrintFindings validates the findings are grouped by file, and JSON is an empty list without findings
+func TestPrintFindings(t *testing.T) {
+	var buf bytes.Buffer
+	findings := []Finding{
+		{File: "a.yaml", Severity: severityError, Message: "first"},
+		{File: "a.yaml", Severity: severityWarning, Message: "second"},
+		{File: "b.yaml", Severity: severityError, Message: "third"},
+	}
+	if err := printFindings(&buf, findings, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := "a.yaml\n  error: first\n  warning: second\nb.yaml\n  error: third\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := printFindings(&buf, nil, true); err != nil || strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("expected an empty JSON list, got %q %v", buf.String(), err)
+	}
+}
@@ -5,78 +5,19 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
-	"gopkg.in/yaml.v3"
-)
-
-// Manifest represents the structure of the manifest YAML files.
-type Manifest struct {
-	Name             string   `yaml:"name"`
-	ManagedInstalls  []string `yaml:"managed_installs"`
-	ManagedUninstalls []string `yaml:"managed_uninstalls"`
-	ManagedUpdates   []string `yaml:"managed_updates"`
-	IncludedManifests []string `yaml:"included_manifests"`
-	Catalogs         []string `yaml:"catalogs"`
-}
-
-// ListManifests lists all available manifests from the manifest directory.
-func ListManifests(manifestDir string) ([]string, error) {
-	files, err := ioutil.ReadDir(manifestDir)
-	if err != nil {
-		return nil, err
-	}
-
-	var manifests []string
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".yaml" {
-			manifests = append(manifests, file.Name())
-		}
-	}
-	return manifests, nil
-}
+	"os"
 
-// GetManifest reads and parses a manifest from a YAML file.
-func GetManifest(manifestPath string) (Manifest, error) {
-	var manifest Manifest
-	yamlFile, err := ioutil.ReadFile(manifestPath)
-	if err != nil {
-		return manifest, err
-	}
-
-	err = yaml.Unmarshal(yamlFile, &manifest)
-	if err != nil {
-		return manifest, err
-	}
-
-	return manifest, nil
-}
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/repo"
+	"github.com/windowsadmins/gorilla/pkg/version"
+)
 
-// SaveManifest saves a manifest back to its YAML file.
-func SaveManifest(manifestPath string, manifest Manifest) error {
-	data, err := yaml.Marshal(manifest)
-	if err != nil {
-		return err
-	}
-
-	err = ioutil.WriteFile(manifestPath, data, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
-}
+// Manifest is a manifest in the repo, and in --export-json
+type Manifest = repo.Manifest
 
 // CreateNewManifest creates a new manifest file.
-func CreateNewManifest(manifestPath, name string) error {
-	newManifest := Manifest{
-		Name:             name,
-		ManagedInstalls:  []string{},
-		ManagedUninstalls: []string{},
-		ManagedUpdates:   []string{},
-		IncludedManifests: []string{},
-		Catalogs:         []string{},
-	}
-	return SaveManifest(manifestPath, newManifest)
+func CreateNewManifest(r *repo.Repo, name string) error {
+	return r.WriteManifest(name, Manifest{Name: name}.Normalize())
 }
 
 // AddPackageToManifest adds a package to the specified section of a manifest.
@@ -89,7 +30,7 @@ func AddPackageToManifest(manifest *Manifest, pkg, section string) {
 	case "managed_updates":
 		manifest.ManagedUpdates = append(manifest.ManagedUpdates, pkg)
 	default:
-		fmt.Printf("Invalid section: %s\n", section)
+		logging.Errorf("Invalid section: %s\n", section)
 	}
 }
 
@@ -103,7 +44,7 @@ func RemovePackageFromManifest(manifest *Manifest, pkg, section string) {
 	case "managed_updates":
 		manifest.ManagedUpdates = removeItem(manifest.ManagedUpdates, pkg)
 	default:
-		fmt.Printf("Invalid section: %s\n", section)
+		logging.Errorf("Invalid section: %s\n", section)
 	}
 }
 
@@ -126,14 +67,80 @@ func main() {
 	section := flag.String("section", "managed_installs", "Manifest section (managed_installs, managed_uninstalls, managed_updates)")
 	manifestName := flag.String("manifest", "", "Manifest to operate on")
 	removePackage := flag.String("remove-pkg", "", "Package to remove from manifest")
+	lint := flag.Bool("lint", false, "Check every manifest under the manifests directory and exit non-zero on errors")
+	lintFailOn := flag.String("lint-fail-on", severityError, "Lowest severity that fails --lint (warning, error)")
+	lintJSON := flag.Bool("lint-json", false, "Print the --lint findings as JSON")
+	exportJSONFlag := flag.String("export-json", "", "Print a manifest, or all of them, as JSON")
+	importJSONFlag := flag.String("import-json", "", "Create and update manifests from a JSON file made like --export-json")
+	force := flag.Bool("force", false, "Import with --import-json even if the manifests don't validate")
+	logFile, quiet := logging.ToolFlags()
+	showVersion, versionJSON := version.Flags()
 
 	flag.Parse()
 
+	if *showVersion {
+		if err := version.Show(*versionJSON); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := logging.InitTool(*logFile, *quiet); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer logging.CloseLogger()
+
+	// The manifests are in the repo, next to its catalogs and pkgsinfo
+	r := repo.ForManifests(*manifestPath)
+
+	// Check the whole manifests tree, for CI
+	if *lint {
+		if _, ok := severityRank[*lintFailOn]; !ok {
+			logging.Errorf("Invalid --lint-fail-on: %s\n", *lintFailOn)
+			os.Exit(2)
+		}
+		findings, err := lintManifests(r)
+		if err != nil {
+			logging.Errorf("Error linting manifests: %v\n", err)
+			os.Exit(2)
+		}
+		if err := printFindings(os.Stdout, findings, *lintJSON); err != nil {
+			logging.Errorf("Error printing findings: %v\n", err)
+			os.Exit(2)
+		}
+		if lintFailed(findings, *lintFailOn) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Export manifests for systems that generate them
+	if *exportJSONFlag != "" {
+		if err := exportJSON(os.Stdout, r, *exportJSONFlag); err != nil {
+			logging.Errorf("Error exporting manifests: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Import manifests generated by another system
+	if *importJSONFlag != "" {
+		result, err := importJSON(r, *importJSONFlag, *force)
+		if err != nil {
+			logging.Errorf("Error importing manifests: %v\n", err)
+			os.Exit(1)
+		}
+		printImportResult(os.Stdout, result)
+		return
+	}
+
 	// List manifests
 	if *listManifests {
-		manifests, err := ListManifests(*manifestPath)
+		manifests, err := r.ManifestNames()
 		if err != nil {
-			fmt.Println("Error listing manifests:", err)
+			logging.Errorf("Error listing manifests: %v\n", err)
 			return
 		}
 		fmt.Println("Available manifests:")
@@ -145,44 +152,42 @@ func main() {
 
 	// Create a new manifest
 	if *newManifest != "" {
-		manifestFilePath := filepath.Join(*manifestPath, *newManifest+".yaml")
-		err := CreateNewManifest(manifestFilePath, *newManifest)
-		if err != nil {
-			fmt.Println("Error creating manifest:", err)
+		if err := CreateNewManifest(r, *newManifest); err != nil {
+			logging.Errorf("Error creating manifest: %v\n", err)
 			return
 		}
-		fmt.Println("New manifest created:", manifestFilePath)
+		manifestFilePath, _ := r.ManifestPath(*newManifest)
+		logging.Printf("New manifest created: %s\n", manifestFilePath)
 		return
 	}
 
 	// Load manifest to modify
 	if *manifestName != "" {
-		manifestFilePath := filepath.Join(*manifestPath, *manifestName+".yaml")
-		manifest, err := GetManifest(manifestFilePath)
+		manifest, err := r.ReadManifest(*manifestName)
 		if err != nil {
-			fmt.Println("Error loading manifest:", err)
+			logging.Errorf("Error loading manifest: %v\n", err)
 			return
 		}
 
 		// Add a package to the manifest
 		if *addPackage != "" {
 			AddPackageToManifest(&manifest, *addPackage, *section)
-			err = SaveManifest(manifestFilePath, manifest)
+			err = r.WriteManifest(*manifestName, manifest)
 			if err != nil {
-				fmt.Println("Error saving manifest:", err)
+				logging.Errorf("Error saving manifest: %v\n", err)
 			} else {
-				fmt.Printf("Added %s to %s in %s\n", *addPackage, *section, *manifestName)
+				logging.Printf("Added %s to %s in %s\n", *addPackage, *section, *manifestName)
 			}
 		}
 
 		// Remove a package from the manifest
 		if *removePackage != "" {
 			RemovePackageFromManifest(&manifest, *removePackage, *section)
-			err = SaveManifest(manifestFilePath, manifest)
+			err = r.WriteManifest(*manifestName, manifest)
 			if err != nil {
-				fmt.Println("Error saving manifest:", err)
+				logging.Errorf("Error saving manifest: %v\n", err)
 			} else {
-				fmt.Printf("Removed %s from %s in %s\n", *removePackage, *section, *manifestName)
+				logging.Printf("Removed %s from %s in %s\n", *removePackage, *section, *manifestName)
 			}
 		}
 	}
@@ -4,7 +4,7 @@ go 1.16
 
 require (
 	github.com/AlecAivazis/survey/v2 v2.3.7
-	github.com/gonutz/w32 v1.0.0
+	github.com/alexbrainman/sspi v0.0.0-20250919150558-7d374ff0d59e
 	github.com/hashicorp/go-version v1.3.0
 	github.com/kr/pretty v0.3.0 // indirect
 	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f
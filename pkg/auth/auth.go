@@ -0,0 +1,112 @@
+// pkg/auth/auth.go
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// Provider supplies the value of the Authorization header for requests to the repo.
+// An empty header with no error means requests should be sent without credentials.
+type Provider interface {
+	AuthHeader() (string, error)
+}
+
+var (
+	// current is the provider used by Header, the registry is used until Configure is called
+	current   Provider = RegistryProvider{}
+	currentMu sync.Mutex
+)
+
+// Configure selects the provider for this run from the configuration.
+// If the configuration is not usable, requests are sent without credentials.
+func Configure(cfg config.Configuration) error {
+	setAllowedHosts(cfg)
+	provider, err := NewProvider(cfg)
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = provider
+	return err
+}
+
+// Transport wraps base with the round tripper the configured provider needs,
+// requests are authenticated by the header alone for every provider but Negotiate
+func Transport(base http.RoundTripper) http.RoundTripper {
+	currentMu.Lock()
+	provider := current
+	currentMu.Unlock()
+
+	if negotiate, ok := provider.(NegotiateProvider); ok {
+		return &NegotiateTransport{Base: base, Fallback: negotiate.Fallback}
+	}
+	return base
+}
+
+// Header returns the Authorization header from the configured provider
+func Header() (string, error) {
+	currentMu.Lock()
+	provider := current
+	currentMu.Unlock()
+
+	if provider == nil {
+		return "", nil
+	}
+	return provider.AuthHeader()
+}
+
+// NewProvider returns the provider selected by `AuthProvider` in the configuration
+func NewProvider(cfg config.Configuration) (Provider, error) {
+	switch strings.ToLower(cfg.AuthProvider) {
+	case "", "registry":
+		return RegistryProvider{}, nil
+	case "bearer":
+		if cfg.AuthBearerToken == "" {
+			return nil, fmt.Errorf("auth_provider is bearer but auth_bearer_token is empty")
+		}
+		return BearerProvider{Token: cfg.AuthBearerToken}, nil
+	case "oauth2":
+		return NewOAuth2Provider(cfg)
+	case "negotiate":
+		return newNegotiateProvider(cfg)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown auth_provider: %s", cfg.AuthProvider)
+	}
+}
+
+// newNegotiateProvider returns a NegotiateProvider with the fallback from `AuthNegotiateFallback`
+func newNegotiateProvider(cfg config.Configuration) (Provider, error) {
+	switch strings.ToLower(cfg.AuthNegotiateFallback) {
+	case "", "none":
+		return NegotiateProvider{}, nil
+	case "registry":
+		return NegotiateProvider{Fallback: RegistryProvider{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth_negotiate_fallback: %s", cfg.AuthNegotiateFallback)
+	}
+}
+
+// RegistryProvider reads a Basic header stored with DPAPI in the registry
+type RegistryProvider struct{}
+
+// AuthHeader returns the Basic header from the registry
+func (RegistryProvider) AuthHeader() (string, error) {
+	return GetAuthHeader()
+}
+
+// BearerProvider sends a static Bearer token
+type BearerProvider struct {
+	Token string
+}
+
+// AuthHeader returns the Bearer header for the static token
+func (p BearerProvider) AuthHeader() (string, error) {
+	return "Bearer " + p.Token, nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// TestNewProvider validates the provider selected by each auth_provider value
+func TestNewProvider(t *testing.T) {
+	provider, err := NewProvider(config.Configuration{})
+	if err != nil {
+		t.Fatalf("unexpected error for default provider: %v", err)
+	}
+	if _, ok := provider.(RegistryProvider); !ok {
+		t.Errorf("default provider should be RegistryProvider, got %T", provider)
+	}
+
+	provider, err = NewProvider(config.Configuration{AuthProvider: "Bearer", AuthBearerToken: "abc"})
+	if err != nil {
+		t.Fatalf("unexpected error for bearer provider: %v", err)
+	}
+	header, _ := provider.AuthHeader()
+	if header != "Bearer abc" {
+		t.Errorf("bearer header: expected %q, got %q", "Bearer abc", header)
+	}
+
+	provider, err = NewProvider(config.Configuration{AuthProvider: "none"})
+	if err != nil || provider != nil {
+		t.Errorf("none provider: expected nil provider and no error, got %v, %v", provider, err)
+	}
+
+	provider, err = NewProvider(config.Configuration{AuthProvider: "negotiate", AuthNegotiateFallback: "registry"})
+	if err != nil {
+		t.Fatalf("unexpected error for negotiate provider: %v", err)
+	}
+	if _, ok := provider.(NegotiateProvider).Fallback.(RegistryProvider); !ok {
+		t.Errorf("negotiate fallback should be RegistryProvider, got %T", provider.(NegotiateProvider).Fallback)
+	}
+
+	provider, err = NewProvider(config.Configuration{
+		AuthProvider:     "oauth2",
+		AuthTenantID:     "contoso",
+		AuthClientID:     "client",
+		AuthClientSecret: "secret",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error for oauth2 provider: %v", err)
+	}
+	expectedURL := "https://login.microsoftonline.com/contoso/oauth2/v2.0/token"
+	if provider.(*OAuth2Provider).TokenURL != expectedURL {
+		t.Errorf("oauth2 token url: expected %q, got %q", expectedURL, provider.(*OAuth2Provider).TokenURL)
+	}
+}
+
+// TestNewProviderErrors validates incomplete configurations are rejected
+func TestNewProviderErrors(t *testing.T) {
+	tests := []config.Configuration{
+		{AuthProvider: "bearer"},
+		{AuthProvider: "kerberos"},
+		{AuthProvider: "negotiate", AuthNegotiateFallback: "basic"},
+		{AuthProvider: "oauth2", AuthClientID: "client", AuthClientSecret: "secret"},
+		{AuthProvider: "oauth2", AuthTenantID: "contoso", AuthClientSecret: "secret"},
+		{AuthProvider: "oauth2", AuthTenantID: "contoso", AuthClientID: "client"},
+	}
+
+	for _, cfg := range tests {
+		if _, err := NewProvider(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+// TestConfigure validates Header uses the configured provider
+func TestConfigure(t *testing.T) {
+	defer Configure(config.Configuration{})
+
+	if err := Configure(config.Configuration{AuthProvider: "bearer", AuthBearerToken: "abc"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	header, err := Header()
+	if err != nil || header != "Bearer abc" {
+		t.Errorf("expected %q, got %q, %v", "Bearer abc", header, err)
+	}
+
+	// A bad configuration leaves requests unauthenticated
+	if err := Configure(config.Configuration{AuthProvider: "bearer"}); err == nil {
+		t.Errorf("expected an error for bearer without a token")
+	}
+	header, err = Header()
+	if err != nil || header != "" {
+		t.Errorf("expected no header, got %q, %v", header, err)
+	}
+}
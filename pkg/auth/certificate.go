@@ -0,0 +1,123 @@
+//go:build windows
+// +build windows
+
+package auth
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	ncrypt               = windows.NewLazySystemDLL("ncrypt.dll")
+	procNCryptSignHash   = ncrypt.NewProc("NCryptSignHash")
+	procNCryptFreeObject = ncrypt.NewProc("NCryptFreeObject")
+)
+
+// bcryptPadPKCS1 selects PKCS #1 v1.5 padding for NCryptSignHash
+const bcryptPadPKCS1 = 0x00000002
+
+// bcryptPKCS1PaddingInfo is BCRYPT_PKCS1_PADDING_INFO
+type bcryptPKCS1PaddingInfo struct {
+	algID *uint16
+}
+
+// loadMachineCertificate finds a certificate by thumbprint in LocalMachine\My
+// and returns it with a signer backed by its CNG private key
+func loadMachineCertificate(thumbprint string) (*x509.Certificate, crypto.Signer, error) {
+	hash, err := hex.DecodeString(normalizeThumbprint(thumbprint))
+	if err != nil || len(hash) == 0 {
+		return nil, nil, fmt.Errorf("invalid thumbprint: %s", thumbprint)
+	}
+
+	storeName, err := windows.UTF16PtrFromString("MY")
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM, 0, 0,
+		windows.CERT_SYSTEM_STORE_LOCAL_MACHINE|windows.CERT_STORE_READONLY_FLAG, uintptr(unsafe.Pointer(storeName)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open machine certificate store: %v", err)
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	blob := windows.CryptHashBlob{Size: uint32(len(hash)), Data: &hash[0]}
+	certContext, err := windows.CertFindCertificateInStore(store,
+		windows.X509_ASN_ENCODING|windows.PKCS_7_ASN_ENCODING, 0, windows.CERT_FIND_HASH, unsafe.Pointer(&blob), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("certificate not found: %v", err)
+	}
+	defer windows.CertFreeCertificateContext(certContext)
+
+	// Copy the encoded certificate before the context is freed
+	encoded := make([]byte, certContext.Length)
+	copy(encoded, (*[1 << 20]byte)(unsafe.Pointer(certContext.EncodedCert))[:certContext.Length:certContext.Length])
+	cert, err := x509.ParseCertificate(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse certificate: %v", err)
+	}
+
+	var key windows.Handle
+	var keySpec uint32
+	var callerFree bool
+	err = windows.CryptAcquireCertificatePrivateKey(certContext,
+		windows.CRYPT_ACQUIRE_ONLY_NCRYPT_KEY_FLAG|windows.CRYPT_ACQUIRE_SILENT_FLAG, nil, &key, &keySpec, &callerFree)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to acquire private key: %v", err)
+	}
+
+	return cert, &ncryptSigner{key: key, public: cert.PublicKey}, nil
+}
+
+// ncryptSigner signs with a CNG key handle, the key never leaves the store
+type ncryptSigner struct {
+	key    windows.Handle
+	public crypto.PublicKey
+}
+
+// Public returns the public key of the certificate
+func (s *ncryptSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs a SHA-256 digest with PKCS #1 v1.5 padding
+func (s *ncryptSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported hash: %v", opts.HashFunc())
+	}
+
+	algID, err := windows.UTF16PtrFromString("SHA256")
+	if err != nil {
+		return nil, err
+	}
+	padding := bcryptPKCS1PaddingInfo{algID: algID}
+
+	// The first call returns the size of the signature
+	var size uint32
+	status, _, _ := procNCryptSignHash.Call(uintptr(s.key), uintptr(unsafe.Pointer(&padding)),
+		uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)), 0, 0, uintptr(unsafe.Pointer(&size)), bcryptPadPKCS1)
+	if status != 0 {
+		return nil, fmt.Errorf("NCryptSignHash failed: 0x%x", status)
+	}
+
+	signature := make([]byte, size)
+	status, _, _ = procNCryptSignHash.Call(uintptr(s.key), uintptr(unsafe.Pointer(&padding)),
+		uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)),
+		uintptr(unsafe.Pointer(&signature[0])), uintptr(size), uintptr(unsafe.Pointer(&size)), bcryptPadPKCS1)
+	if status != 0 {
+		return nil, fmt.Errorf("NCryptSignHash failed: 0x%x", status)
+	}
+
+	return signature[:size], nil
+}
+
+// Close releases the key handle
+func (s *ncryptSigner) Close() {
+	procNCryptFreeObject.Call(uintptr(s.key))
+}
@@ -0,0 +1,17 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package auth
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+)
+
+// loadMachineCertificate is just a placeholder on darwin, there is no machine store
+func loadMachineCertificate(thumbprint string) (*x509.Certificate, crypto.Signer, error) {
+	return nil, nil, fmt.Errorf("certificates from the machine store are only supported on Windows")
+}
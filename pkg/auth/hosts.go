@@ -0,0 +1,73 @@
+// pkg/auth/hosts.go
+
+package auth
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+var (
+	// allowedHosts are the hosts that may receive credentials, as host:port
+	// or a bare host matching any port. Empty until Configure is called.
+	allowedHosts []string
+)
+
+// setAllowedHosts collects the repo hosts from the configuration
+func setAllowedHosts(cfg config.Configuration) {
+	var hosts []string
+	for _, repoURL := range []string{cfg.URL, cfg.URLPkgsInfo} {
+		if repoURL == "" {
+			continue
+		}
+		u, err := url.Parse(repoURL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		hosts = append(hosts, canonicalHost(u))
+	}
+	for _, host := range cfg.AuthAdditionalHosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	allowedHosts = hosts
+}
+
+// ShouldAuthenticate reports whether credentials may be sent to the host of u.
+// Only the repo and `AuthAdditionalHosts` are trusted, so an installer hosted
+// elsewhere never receives them. If no repo is configured no host is trusted,
+// tools that send credentials call Configure first.
+func ShouldAuthenticate(u *url.URL) bool {
+	currentMu.Lock()
+	hosts := allowedHosts
+	currentMu.Unlock()
+
+	host := canonicalHost(u)
+	hostname := strings.ToLower(u.Hostname())
+	for _, allowed := range hosts {
+		if allowed == host || allowed == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalHost returns the lowercase host:port of u, with the default port for the scheme
+func canonicalHost(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if strings.EqualFold(u.Scheme, "http") {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
@@ -0,0 +1,210 @@
+// pkg/auth/negotiate.go
+
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// maxNegotiateRounds limits how many challenges are answered for one request
+const maxNegotiateRounds = 5
+
+// This abstraction allows us to override when testing
+var newNegotiateContext = newSSPIContext
+
+// negotiateContext is one SPNEGO handshake with a server
+type negotiateContext interface {
+	// Update processes a token from the server and returns the next token to send
+	Update(input []byte) (done bool, output []byte, err error)
+	Release() error
+}
+
+// NegotiateProvider authenticates as the machine or service account with
+// Windows Integrated authentication. The handshake needs several round trips,
+// so it is done by NegotiateTransport and AuthHeader never returns a header.
+type NegotiateProvider struct {
+	// Fallback is used when the handshake fails, nil sends no credentials
+	Fallback Provider
+}
+
+// AuthHeader returns an empty header, credentials are sent by NegotiateTransport
+func (NegotiateProvider) AuthHeader() (string, error) {
+	return "", nil
+}
+
+// NegotiateTransport answers Negotiate challenges from the server with tokens from SSPI
+type NegotiateTransport struct {
+	Base     http.RoundTripper
+	Fallback Provider
+}
+
+// RoundTrip sends the request and, if the server asks for Negotiate, repeats it
+// with the tokens of the handshake until the server accepts or rejects them
+func (t *NegotiateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized || !hasNegotiateChallenge(resp) || !ShouldAuthenticate(req.URL) {
+		return resp, nil
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// The body has been consumed and can't be sent again
+		return resp, nil
+	}
+
+	ctx, token, err := newNegotiateContext("HTTP/" + hostname(req))
+	if err != nil {
+		return t.fallback(req, resp, err)
+	}
+	defer ctx.Release()
+
+	for round := 0; round < maxNegotiateRounds; round++ {
+		retry, err := cloneRequest(req)
+		if err != nil {
+			return resp, nil
+		}
+		retry.Header.Set("Authorization", "Negotiate "+base64.StdEncoding.EncodeToString(token))
+
+		drain(resp)
+		resp, err = t.base().RoundTrip(retry)
+		if err != nil {
+			return nil, err
+		}
+
+		serverToken, err := negotiateToken(resp)
+		if err != nil {
+			return t.fallback(req, resp, err)
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			// The final token from the server completes mutual authentication
+			if len(serverToken) > 0 {
+				if _, _, err := ctx.Update(serverToken); err != nil {
+					logging.Debug("Unable to complete Negotiate handshake", "url", req.URL.String(), "status", sspiStatus(err), "error", err)
+				}
+			}
+			return resp, nil
+		}
+
+		if len(serverToken) == 0 {
+			return t.fallback(req, resp, fmt.Errorf("server rejected the Negotiate token"))
+		}
+
+		var done bool
+		done, token, err = ctx.Update(serverToken)
+		if err != nil {
+			return t.fallback(req, resp, err)
+		}
+		if done && len(token) == 0 {
+			return t.fallback(req, resp, fmt.Errorf("server rejected the completed Negotiate handshake"))
+		}
+	}
+
+	return t.fallback(req, resp, fmt.Errorf("no answer after %d Negotiate rounds", maxNegotiateRounds))
+}
+
+// fallback logs the failed handshake and resends the request with the fallback provider,
+// returning the unauthorized response if there is nothing to fall back to
+func (t *NegotiateTransport) fallback(req *http.Request, resp *http.Response, cause error) (*http.Response, error) {
+	logging.Warn("Negotiate authentication failed", "url", req.URL.String(), "status", sspiStatus(cause), "error", cause)
+
+	if t.Fallback == nil {
+		return resp, nil
+	}
+	header, err := t.Fallback.AuthHeader()
+	if err != nil || header == "" {
+		if err != nil {
+			logging.Warn("Unable to get fallback authentication header", "error", err)
+		}
+		return resp, nil
+	}
+
+	retry, err := cloneRequest(req)
+	if err != nil {
+		return resp, nil
+	}
+	retry.Header.Set("Authorization", header)
+
+	drain(resp)
+	return t.base().RoundTrip(retry)
+}
+
+// base returns the round tripper that sends the requests
+func (t *NegotiateTransport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// hasNegotiateChallenge reports whether the server offers Negotiate
+func hasNegotiateChallenge(resp *http.Response) bool {
+	for _, value := range resp.Header.Values("WWW-Authenticate") {
+		scheme := strings.Fields(value)
+		if len(scheme) > 0 && strings.EqualFold(scheme[0], "Negotiate") {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateToken returns the token sent with the Negotiate challenge, if any
+func negotiateToken(resp *http.Response) ([]byte, error) {
+	for _, value := range resp.Header.Values("WWW-Authenticate") {
+		fields := strings.Fields(value)
+		if len(fields) == 2 && strings.EqualFold(fields[0], "Negotiate") {
+			token, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid Negotiate token from server: %v", err)
+			}
+			return token, nil
+		}
+	}
+	return nil, nil
+}
+
+// cloneRequest copies the request so it can be sent again with other credentials
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
+
+// drain reads and closes the body so the connection is reused for the next round,
+// NTLM authenticates the connection rather than the request
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+}
+
+// hostname returns the host of the request without the port, for the service principal name
+func hostname(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.URL.Host)
+	if err != nil {
+		return req.URL.Host
+	}
+	return host
+}
+
+// sspiStatus formats the SECURITY_STATUS code of an SSPI error for the log
+func sspiStatus(err error) string {
+	if errno, ok := err.(syscall.Errno); ok {
+		return fmt.Sprintf("0x%08X", uint32(errno))
+	}
+	return "none"
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// fakeContext replays a fixed handshake, mapping each server token to the next client token
+type fakeContext struct {
+	replies  map[string]string
+	err      error
+	released bool
+}
+
+func (c *fakeContext) Update(input []byte) (bool, []byte, error) {
+	if c.err != nil {
+		return false, nil, c.err
+	}
+	reply, ok := c.replies[string(input)]
+	if !ok {
+		return false, nil, fmt.Errorf("unexpected server token %q", input)
+	}
+	return reply == "", []byte(reply), nil
+}
+
+func (c *fakeContext) Release() error {
+	c.released = true
+	return nil
+}
+
+// negotiateServer challenges with Negotiate and accepts the handshake client1, client2
+func negotiateServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "":
+			w.Header().Set("WWW-Authenticate", "Negotiate")
+			w.WriteHeader(http.StatusUnauthorized)
+		case "Negotiate " + b64("client1"):
+			w.Header().Set("WWW-Authenticate", "Negotiate "+b64("server1"))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "Negotiate " + b64("client2"):
+			w.Header().Set("WWW-Authenticate", "Negotiate "+b64("final"))
+			fmt.Fprint(w, "catalog")
+		case "Basic fallback":
+			fmt.Fprint(w, "basic")
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// withContext replaces newNegotiateContext for the duration of a test
+func withContext(t *testing.T, ctx *fakeContext, err error) {
+	orig := newNegotiateContext
+	t.Cleanup(func() { newNegotiateContext = orig })
+	newNegotiateContext = func(spn string) (negotiateContext, []byte, error) {
+		if spn != "HTTP/127.0.0.1" {
+			t.Errorf("unexpected service principal name: %s", spn)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return ctx, []byte("client1"), nil
+	}
+}
+
+// trustServer lets ts receive credentials for the duration of a test
+func trustServer(t *testing.T, ts *httptest.Server) {
+	t.Cleanup(func() { setAllowedHosts(config.Configuration{}) })
+	setAllowedHosts(config.Configuration{URL: ts.URL})
+}
+
+// TestNegotiateHandshake validates the challenge and response rounds
+func TestNegotiateHandshake(t *testing.T) {
+	ts := negotiateServer(t)
+	defer ts.Close()
+	trustServer(t, ts)
+
+	ctx := &fakeContext{replies: map[string]string{"server1": "client2", "final": ""}}
+	withContext(t, ctx, nil)
+
+	client := &http.Client{Transport: &NegotiateTransport{}}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	if !ctx.released {
+		t.Errorf("context should be released after the handshake")
+	}
+}
+
+// TestNegotiateNoChallenge validates responses without a Negotiate challenge are returned as is
+func TestNegotiateNoChallenge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="repo"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	withContext(t, nil, fmt.Errorf("context should not be created"))
+
+	client := &http.Client{Transport: &NegotiateTransport{}}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", resp.StatusCode)
+	}
+}
+
+// TestNegotiateFallback validates a failed handshake falls back according to the provider
+func TestNegotiateFallback(t *testing.T) {
+	ts := negotiateServer(t)
+	defer ts.Close()
+	trustServer(t, ts)
+
+	// SEC_E_LOGON_DENIED
+	ctx := &fakeContext{err: syscall.Errno(0x8009030C)}
+	withContext(t, ctx, nil)
+
+	client := &http.Client{Transport: &NegotiateTransport{}}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without a fallback expected status 401, got %d", resp.StatusCode)
+	}
+
+	client = &http.Client{Transport: &NegotiateTransport{Fallback: fakeProvider("Basic fallback")}}
+	resp, err = client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("with a fallback expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+// TestSSPIStatus validates SSPI errors are logged with their status code
+func TestSSPIStatus(t *testing.T) {
+	if status := sspiStatus(syscall.Errno(0x8009030C)); status != "0x8009030C" {
+		t.Errorf("expected 0x8009030C, got %s", status)
+	}
+	if status := sspiStatus(fmt.Errorf("other")); status != "none" {
+		t.Errorf("expected none, got %s", status)
+	}
+}
+
+// fakeProvider returns a fixed header
+type fakeProvider string
+
+func (p fakeProvider) AuthHeader() (string, error) {
+	return string(p), nil
+}
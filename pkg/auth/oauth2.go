@@ -0,0 +1,213 @@
+// pkg/auth/oauth2.go
+
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+const (
+	// refreshMargin is how long before expiry a token is refreshed
+	refreshMargin = 5 * time.Minute
+
+	// assertionLifetime is how long a certificate client assertion is valid
+	assertionLifetime = 10 * time.Minute
+)
+
+// These abstractions allow us to override when testing
+var (
+	loadCertificate = loadMachineCertificate
+	timeNow         = time.Now
+)
+
+// OAuth2Provider requests Bearer tokens with the OAuth2 client credentials flow,
+// authenticating with either a client secret or a certificate from the machine store.
+// Tokens are cached in memory and refreshed shortly before they expire.
+type OAuth2Provider struct {
+	TokenURL   string
+	ClientID   string
+	Secret     string
+	Thumbprint string
+	Scope      string
+	Client     *http.Client
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+	cert      *x509.Certificate
+	signer    crypto.Signer
+}
+
+// tokenResponse is the response from the token endpoint
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// NewOAuth2Provider returns an OAuth2Provider from the configuration.
+// The token URL defaults to the Azure AD v2 endpoint for `AuthTenantID`.
+func NewOAuth2Provider(cfg config.Configuration) (*OAuth2Provider, error) {
+	tokenURL := cfg.AuthTokenURL
+	if tokenURL == "" {
+		if cfg.AuthTenantID == "" {
+			return nil, fmt.Errorf("auth_provider is oauth2 but neither auth_token_url nor auth_tenant_id is set")
+		}
+		tokenURL = "https://login.microsoftonline.com/" + url.PathEscape(cfg.AuthTenantID) + "/oauth2/v2.0/token"
+	}
+	if cfg.AuthClientID == "" {
+		return nil, fmt.Errorf("auth_provider is oauth2 but auth_client_id is empty")
+	}
+	if cfg.AuthClientSecret == "" && cfg.AuthCertificateThumbprint == "" {
+		return nil, fmt.Errorf("auth_provider is oauth2 but neither auth_client_secret nor auth_certificate_thumbprint is set")
+	}
+
+	return &OAuth2Provider{
+		TokenURL:   tokenURL,
+		ClientID:   cfg.AuthClientID,
+		Secret:     cfg.AuthClientSecret,
+		Thumbprint: cfg.AuthCertificateThumbprint,
+		Scope:      cfg.AuthScope,
+		Client:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// AuthHeader returns a Bearer header, requesting a new token if needed
+func (p *OAuth2Provider) AuthHeader() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && timeNow().Before(p.refreshAt) {
+		return "Bearer " + p.token, nil
+	}
+
+	if err := p.refresh(); err != nil {
+		return "", err
+	}
+	return "Bearer " + p.token, nil
+}
+
+// refresh requests a new token from the token endpoint
+func (p *OAuth2Provider) refresh() error {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", p.ClientID)
+	if p.Scope != "" {
+		form.Set("scope", p.Scope)
+	}
+
+	if p.Secret != "" {
+		form.Set("client_secret", p.Secret)
+	} else {
+		assertion, err := p.clientAssertion()
+		if err != nil {
+			return err
+		}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", assertion)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.PostForm(p.TokenURL, form)
+	if err != nil {
+		return fmt.Errorf("unable to request token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("unable to parse token response (status %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return fmt.Errorf("token request failed (status %d): %s %s", resp.StatusCode, token.Error, token.Description)
+	}
+
+	// Refresh ahead of expiry, but never wait longer than half the lifetime
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	margin := refreshMargin
+	if lifetime/2 < margin {
+		margin = lifetime / 2
+	}
+
+	p.token = token.AccessToken
+	p.refreshAt = timeNow().Add(lifetime - margin)
+	return nil
+}
+
+// clientAssertion builds a JWT signed with the certificate's private key
+func (p *OAuth2Provider) clientAssertion() (string, error) {
+	if p.signer == nil {
+		cert, signer, err := loadCertificate(p.Thumbprint)
+		if err != nil {
+			return "", fmt.Errorf("unable to load certificate %s: %v", p.Thumbprint, err)
+		}
+		p.cert = cert
+		p.signer = signer
+	}
+
+	thumbprint := sha1.Sum(p.cert.Raw)
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := timeNow()
+	claims := map[string]interface{}{
+		"aud": p.TokenURL,
+		"iss": p.ClientID,
+		"sub": p.ClientID,
+		"jti": hex.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"exp": now.Add(assertionLifetime).Unix(),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := p.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign client assertion: %v", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// normalizeThumbprint removes the spaces and colons that are often copied with a thumbprint
+func normalizeThumbprint(thumbprint string) string {
+	thumbprint = strings.ReplaceAll(thumbprint, " ", "")
+	thumbprint = strings.ReplaceAll(thumbprint, ":", "")
+	return strings.ToLower(thumbprint)
+}
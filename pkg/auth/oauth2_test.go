@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenServer returns a token endpoint that counts requests and records the last form
+func tokenServer(t *testing.T, expiresIn int64, requests *int, form *url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("unable to parse form: %v", err)
+		}
+		*requests++
+		*form = r.PostForm
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"Bearer","expires_in":%d}`, *requests, expiresIn)
+	}))
+}
+
+// TestOAuth2Secret validates the client secret form and token caching
+func TestOAuth2Secret(t *testing.T) {
+	var requests int
+	var form url.Values
+	ts := tokenServer(t, 3600, &requests, &form)
+	defer ts.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	origTimeNow := timeNow
+	defer func() { timeNow = origTimeNow }()
+	timeNow = func() time.Time { return now }
+
+	p := &OAuth2Provider{TokenURL: ts.URL, ClientID: "client", Secret: "secret", Scope: "api://gorilla/.default"}
+
+	header, err := p.AuthHeader()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if header != "Bearer token1" {
+		t.Errorf("expected %q, got %q", "Bearer token1", header)
+	}
+	if form.Get("grant_type") != "client_credentials" || form.Get("client_id") != "client" ||
+		form.Get("client_secret") != "secret" || form.Get("scope") != "api://gorilla/.default" {
+		t.Errorf("unexpected token request form: %v", form)
+	}
+
+	// Still valid, the cached token is used
+	now = now.Add(50 * time.Minute)
+	header, _ = p.AuthHeader()
+	if header != "Bearer token1" || requests != 1 {
+		t.Errorf("expected cached token, got %q after %d requests", header, requests)
+	}
+
+	// Within the refresh margin, a new token is requested
+	now = now.Add(6 * time.Minute)
+	header, _ = p.AuthHeader()
+	if header != "Bearer token2" || requests != 2 {
+		t.Errorf("expected refreshed token, got %q after %d requests", header, requests)
+	}
+}
+
+// TestOAuth2Error validates a failed token request returns an error
+func TestOAuth2Error(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"invalid_client","error_description":"bad secret"}`)
+	}))
+	defer ts.Close()
+
+	p := &OAuth2Provider{TokenURL: ts.URL, ClientID: "client", Secret: "wrong"}
+	if _, err := p.AuthHeader(); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("expected invalid_client error, got %v", err)
+	}
+}
+
+// TestOAuth2Certificate validates the signed client assertion
+func TestOAuth2Certificate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gorilla"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	origLoadCertificate := loadCertificate
+	defer func() { loadCertificate = origLoadCertificate }()
+	loadCertificate = func(thumbprint string) (*x509.Certificate, crypto.Signer, error) {
+		if thumbprint != "AB:CD" {
+			t.Errorf("unexpected thumbprint: %s", thumbprint)
+		}
+		return cert, key, nil
+	}
+
+	var requests int
+	var form url.Values
+	ts := tokenServer(t, 3600, &requests, &form)
+	defer ts.Close()
+
+	p := &OAuth2Provider{TokenURL: ts.URL, ClientID: "client", Thumbprint: "AB:CD"}
+	if _, err := p.AuthHeader(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if form.Get("client_secret") != "" {
+		t.Errorf("client secret should not be sent with a certificate")
+	}
+	if form.Get("client_assertion_type") != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+		t.Errorf("unexpected client_assertion_type: %s", form.Get("client_assertion_type"))
+	}
+
+	parts := strings.Split(form.Get("client_assertion"), ".")
+	if len(parts) != 3 {
+		t.Fatalf("client assertion should have 3 parts, got %d", len(parts))
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("client assertion signature is invalid: %v", err)
+	}
+
+	var claims map[string]interface{}
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		t.Fatalf("unable to parse claims: %v", err)
+	}
+	if claims["aud"] != ts.URL || claims["iss"] != "client" || claims["sub"] != "client" {
+		t.Errorf("unexpected claims: %v", claims)
+	}
+}
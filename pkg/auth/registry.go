@@ -0,0 +1,85 @@
+//go:build windows
+// +build windows
+
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/crypto"
+	registry "golang.org/x/sys/windows/registry"
+)
+
+const (
+	// AuthKeyPath is the registry key under HKLM that stores the credentials
+	AuthKeyPath = `SOFTWARE\Gorilla`
+
+	// AuthValueName is the registry value that holds the encrypted credentials
+	AuthValueName = "AuthHeader"
+)
+
+// GetAuthHeader returns a Basic header built from the DPAPI encrypted,
+// base64 encoded credentials in HKLM\SOFTWARE\Gorilla\AuthHeader.
+// If no credentials are stored, an empty header is returned.
+func GetAuthHeader() (string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, AuthKeyPath, registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to open registry key: %v", err)
+	}
+	defer key.Close()
+
+	encoded, _, err := key.GetStringValue(AuthValueName)
+	if err == registry.ErrNotExist {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to read %s: %v", AuthValueName, err)
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("unable to decode %s: %v", AuthValueName, err)
+	}
+
+	decrypted, err := crypto.Unprotect(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt %s: %v", AuthValueName, err)
+	}
+
+	// The stored value may already include the scheme
+	credentials := strings.TrimSpace(string(decrypted))
+	if strings.HasPrefix(credentials, "Basic ") {
+		return credentials, nil
+	}
+	return "Basic " + credentials, nil
+}
+
+// SetAuthHeader stores Basic credentials for username and password in
+// HKLM\SOFTWARE\Gorilla\AuthHeader, encrypted with machine scope DPAPI
+// so that any process on this machine running as SYSTEM can read them.
+func SetAuthHeader(username, password string) error {
+	if username == "" {
+		return fmt.Errorf("username is empty")
+	}
+
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	encrypted, err := crypto.Protect([]byte("Basic " + credentials))
+	if err != nil {
+		return fmt.Errorf("unable to encrypt credentials: %v", err)
+	}
+
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, AuthKeyPath, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("unable to create registry key: %v", err)
+	}
+	defer key.Close()
+
+	err = key.SetStringValue(AuthValueName, base64.StdEncoding.EncodeToString(encrypted))
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %v", AuthValueName, err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package auth
+
+import "fmt"
+
+// GetAuthHeader is just a placeholder on darwin, there is no registry to read credentials from
+func GetAuthHeader() (string, error) {
+	return "", nil
+}
+
+// SetAuthHeader is just a placeholder on darwin, there is no registry to store credentials in
+func SetAuthHeader(username, password string) error {
+	return fmt.Errorf("storing credentials is only supported on Windows")
+}
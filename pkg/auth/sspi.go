@@ -0,0 +1,43 @@
+//go:build windows
+// +build windows
+
+package auth
+
+import (
+	"github.com/alexbrainman/sspi"
+	"github.com/alexbrainman/sspi/negotiate"
+)
+
+// sspiContext is a Negotiate client context for the current account
+type sspiContext struct {
+	cred *sspi.Credentials
+	ctx  *negotiate.ClientContext
+}
+
+// newSSPIContext starts a handshake with the service principal name
+// and returns the first token to send
+func newSSPIContext(spn string) (negotiateContext, []byte, error) {
+	cred, err := negotiate.AcquireCurrentUserCredentials()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, token, err := negotiate.NewClientContext(cred, spn)
+	if err != nil {
+		cred.Release()
+		return nil, nil, err
+	}
+
+	return &sspiContext{cred: cred, ctx: ctx}, token, nil
+}
+
+// Update passes the token from the server to SSPI
+func (c *sspiContext) Update(input []byte) (bool, []byte, error) {
+	return c.ctx.Update(input)
+}
+
+// Release frees the context and the credentials handle
+func (c *sspiContext) Release() error {
+	c.ctx.Release()
+	return c.cred.Release()
+}
@@ -0,0 +1,13 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package auth
+
+import "fmt"
+
+// newSSPIContext is just a placeholder on darwin, there is no SSPI
+func newSSPIContext(spn string) (negotiateContext, []byte, error) {
+	return nil, nil, fmt.Errorf("Negotiate authentication is only supported on Windows")
+}
@@ -1,64 +1,52 @@
 package catalog
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	version "github.com/hashicorp/go-version"
 	"github.com/windowsadmins/gorilla/pkg/config"
 	"github.com/windowsadmins/gorilla/pkg/download"
 	"github.com/windowsadmins/gorilla/pkg/logging"
-	"github.com/windowsadmins/gorilla/pkg/report"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
 	"gopkg.in/yaml.v3"
 )
 
-// Item contains an individual entry from the catalog
-type Item struct {
-	Name          string        `yaml:"name"`
-	Dependencies  []string      `yaml:"dependencies"`
-	DisplayName   string        `yaml:"display_name"`
-	Check         InstallCheck  `yaml:"check"`
-	Installer     InstallerItem `yaml:"installer"`
-	Uninstaller   InstallerItem `yaml:"uninstaller"`
-	Version       string        `yaml:"version"`
-	BlockingApps  []string      `yaml:"blocking_apps"`
-	PreScript     string        `yaml:"preinstall_script"`
-	PostScript    string        `yaml:"postinstall_script"`
-}
+// The catalog schema is shared with the authoring tools, which write catalogs
+// with the same types from pkginfo
+type (
+	// Item contains an individual entry from the catalog
+	Item = pkginfo.CatalogItem
 
-// InstallerItem holds information about how to install a catalog item
-type InstallerItem struct {
-	Type      string   `yaml:"type"`
-	Location  string   `yaml:"location"`
-	Hash      string   `yaml:"hash"`
-	Arguments []string `yaml:"arguments"`
-}
+	// InstallerItem holds information about how to install a catalog item
+	InstallerItem = pkginfo.InstallerItem
 
-// InstallCheck holds information about how to check the status of a catalog item
-type InstallCheck struct {
-	File     []FileCheck `yaml:"file"`
-	Script   string      `yaml:"script"`
-	Registry RegCheck    `yaml:"registry"`
-}
+	// InstallCheck holds information about how to check the status of a catalog item
+	InstallCheck = pkginfo.InstallCheck
 
-// FileCheck holds information about checking via a file
-type FileCheck struct {
-	Path        string `yaml:"path"`
-	Version     string `yaml:"version"`
-	ProductName string `yaml:"product_name"`
-	Hash        string `yaml:"hash"`
-}
+	// FileCheck holds information about checking via a file
+	FileCheck = pkginfo.FileCheck
 
-// RegCheck holds information about checking via registry
-type RegCheck struct {
-	Name    string `yaml:"name"`
-	Version string `yaml:"version"`
-}
+	// RegCheck holds information about checking via registry
+	RegCheck = pkginfo.RegCheck
+)
 
-// This abstraction allows us to override the function while testing
-var downloadGet = download.Get
+// These abstractions allow us to override the functions while testing
+var (
+	downloadGet = download.GetOnce
+	logDebug    = logging.Debug
+)
 
-// Get returns a map of `Item` from the catalog
-func Get(cfg config.Configuration) map[int]map[string]Item {
+// Get returns a map of `Item` from each of the provided catalogs.
+// The map is keyed by the priority of each catalog, its 1-based position in catalogs,
+// and an item is taken from the catalog with the lowest key that has it.
+// When a catalog cannot be downloaded, the copy cached by a previous run is used instead.
+func Get(cfg config.Configuration, catalogs []string) (map[int]map[string]Item, error) {
 
 	// catalogMap is an map of parsed catalogs
 	var catalogMap = make(map[int]map[string]Item)
@@ -66,44 +54,210 @@ func Get(cfg config.Configuration) map[int]map[string]Item {
 	// catalogCount allows us to be sure we are processing catalogs in order
 	var catalogCount = 0
 
-	// Setup to catch a potential failure
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println(r)
-			report.End()
-			os.Exit(1)
-
-		}
-	}()
-
 	// Error if dont have at least one catalog
-	if len(cfg.Catalogs) < 1 {
-		logging.Error("Unable to continue, no catalogs assigned: ", cfg.Catalogs)
+	if len(catalogs) < 1 {
+		return nil, fmt.Errorf("unable to continue, no catalogs assigned")
 	}
 
 	// Loop through the catalogs and get each one in order
-	for _, catalog := range cfg.Catalogs {
+	for _, catalogName := range catalogs {
 
 		catalogCount++
 
-		// Download the catalog
-		catalogURL := filepath.Join(cfg.URLPkgsInfo, catalog + ".yaml")
-		logging.Info("Catalog Url:", catalogURL)
-		yamlFile, err := downloadGet(catalogURL)
+		catalogItems, err := getCatalog(cfg, catalogName)
 		if err != nil {
-			logging.Error("Unable to retrieve catalog: ", err)
+			return nil, err
 		}
+		logUnknownFields(catalogName, catalogItems)
+		checkForceInstallDates(catalogName, catalogItems)
+		checkScripts(catalogName, catalogItems)
 
-		// Parse the catalog
-		var catalogItems map[string]Item
-		err = yaml.Unmarshal(yamlFile, &catalogItems)
+		// Add the new parsed catalog items to the catalogMap
+		catalogMap[catalogCount] = catalogItems
+	}
+
+	return catalogMap, nil
+}
+
+// parseCatalog parses a catalog in either map form (keyed by item name)
+// or list form, which is what makecatalogs writes.
+// When a list contains the same name more than once, the highest version is kept.
+func parseCatalog(yamlFile []byte) (map[string]Item, error) {
+	// An empty file is a download that went wrong, makecatalogs never writes one
+	if len(bytes.TrimSpace(yamlFile)) == 0 {
+		return nil, errors.New("empty catalog")
+	}
+
+	// Try the map form first
+	var catalogItems map[string]Item
+	mapErr := yaml.Unmarshal(yamlFile, &catalogItems)
+	if mapErr == nil {
+		for name, item := range catalogItems {
+			item.MigrateProductCode()
+			catalogItems[name] = item
+		}
+		return catalogItems, nil
+	}
+
+	// Fall back to the list form
+	var itemsList []Item
+	if listErr := yaml.Unmarshal(yamlFile, &itemsList); listErr != nil {
+		return nil, mapErr
+	}
+
+	catalogItems = make(map[string]Item)
+	for _, item := range itemsList {
+		item.MigrateProductCode()
+		existing, exists := catalogItems[item.Name]
+		if !exists {
+			catalogItems[item.Name] = item
+			continue
+		}
+
+		logging.Warn("Duplicate item name in catalog", "name", item.Name, "versions", existing.Version+", "+item.Version)
+		if NewerVersion(item.Version, existing.Version) {
+			catalogItems[item.Name] = item
+		}
+	}
+
+	return catalogItems, nil
+}
+
+// logUnknownFields logs the fields of each item that are not part of the schema
+func logUnknownFields(catalogName string, catalogItems map[string]Item) {
+	// Sort the item names so the output is consistent
+	names := make([]string, 0, len(catalogItems))
+	for name := range catalogItems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		extras := catalogItems[name].Extras
+		if len(extras) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(extras))
+		for key := range extras {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		logDebug("Unknown fields in catalog item", "catalog", catalogName, "item", name, "fields", strings.Join(keys, ","))
+	}
+}
+
+// checkForceInstallDates clears the force_install_after_date of items where it isn't
+// an RFC 3339 date, so those items are never forced
+func checkForceInstallDates(catalogName string, catalogItems map[string]Item) {
+	for name, item := range catalogItems {
+		if item.ForceInstallAfter == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, item.ForceInstallAfter); err != nil {
+			logging.Warn("Ignoring invalid force_install_after_date", "catalog", catalogName, "item", name, "error", err)
+			item.ForceInstallAfter = ""
+			catalogItems[name] = item
+		}
+	}
+}
+
+// checkScripts removes the items with a script installer or uninstaller that has no script,
+// there is nothing to run for them
+func checkScripts(catalogName string, catalogItems map[string]Item) {
+	for name, item := range catalogItems {
+		for _, payload := range []InstallerItem{item.Installer, item.Uninstaller} {
+			if payload.Type == pkginfo.ScriptType && strings.TrimSpace(payload.Script) == "" {
+				logging.Error("Ignoring item with an empty script", "catalog", catalogName, "item", name)
+				delete(catalogItems, name)
+				break
+			}
+		}
+	}
+}
+
+// ValidVersion returns an error when v is not a version NewerVersion can compare
+func ValidVersion(v string) error {
+	_, err := version.NewVersion(v)
+	return err
+}
+
+// ValidOSVersions returns an error when a minimum_os_version or maximum_os_version
+// can't be compared, or the minimum is above the maximum. Either may be empty.
+func ValidOSVersions(minimum, maximum string) error {
+	for _, v := range []string{minimum, maximum} {
+		if v == "" {
+			continue
+		}
+		if err := ValidVersion(v); err != nil {
+			return fmt.Errorf("invalid OS version %q, use a version such as 10.0.22631: %v", v, err)
+		}
+	}
+	if minimum != "" && maximum != "" && NewerVersion(minimum, maximum) {
+		return fmt.Errorf("minimum OS version %s is above the maximum %s", minimum, maximum)
+	}
+	return nil
+}
+
+// NewerVersion returns true if `a` is a higher version than `b`
+func NewerVersion(a, b string) bool {
+	versionA, errA := version.NewVersion(a)
+	versionB, errB := version.NewVersion(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return versionA.GreaterThan(versionB)
+}
+
+// getCatalog downloads and parses a catalog, and stores a copy in the catalogs path.
+// If the download fails or doesn't parse, such as a truncated download,
+// the previously stored copy is used instead.
+func getCatalog(cfg config.Configuration, catalogName string) (map[string]Item, error) {
+	catalogURL := cfg.URL + "catalogs/" + catalogName + ".yaml"
+	cachedCatalog := filepath.Join(cfg.CatalogsPath, catalogName+".yaml")
+
+	// Download the catalog, compressed by makecatalogs --compress if the repo has them,
+	// falling back to the plain catalog
+	var yamlFile []byte
+	var err error
+	if cfg.CompressedCatalogs {
+		logging.Info("Catalog Url", "url", catalogURL+".gz")
+		yamlFile, err = downloadGet(catalogURL + ".gz")
 		if err != nil {
-			logging.Error("Unable to parse yaml catalog: ", err)
+			logging.Warn("Unable to retrieve compressed catalog, trying uncompressed", "catalog", catalogName, "error", err)
 		}
+	}
+	if yamlFile == nil {
+		logging.Info("Catalog Url", "url", catalogURL)
+		yamlFile, err = downloadGet(catalogURL)
+	}
+	if err == nil {
+		var catalogItems map[string]Item
+		catalogItems, err = parseCatalog(yamlFile)
+		if err == nil {
+			// Keep a copy for the next time the repo is unreachable
+			if cfg.CatalogsPath != "" {
+				if storeErr := download.Store(cachedCatalog, yamlFile); storeErr != nil {
+					logging.Warn("Unable to cache catalog", "path", cachedCatalog, "error", storeErr)
+				}
+			}
+			return catalogItems, nil
+		}
+		logging.Error("Unable to parse yaml catalog", "catalog", catalogName, "error", err)
+		err = fmt.Errorf("unable to parse yaml catalog %s: %v", catalogName, err)
+	}
 
-		// Add the new parsed catalog items to the catalogMap
-		catalogMap[catalogCount] = catalogItems
+	// Fall back to the cached copy on disk, or the one before it
+	if cfg.CatalogsPath != "" {
+		var catalogItems map[string]Item
+		_, cacheErr := download.LastGood(cachedCatalog, func(data []byte) (parseErr error) {
+			catalogItems, parseErr = parseCatalog(data)
+			return parseErr
+		})
+		if cacheErr == nil {
+			logging.Warn("Unable to retrieve catalog, using cached copy", "catalog", catalogName, "error", err)
+			return catalogItems, nil
+		}
 	}
 
-	return catalogMap
+	return nil, fmt.Errorf("unable to retrieve catalog %s: %v", catalogName, err)
 }
@@ -0,0 +1,473 @@
+package catalog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// fakeCatalogs provides catalog data served by the test server
+	fakeCatalogs = map[string]string{
+		"/catalogs/production.yaml": `
+Firefox:
+  name: Firefox
+  version: 128.0
+  installer:
+    type: msi
+    location: apps/Firefox-128.msi
+`,
+		"/catalogs/testing.yaml": `
+Chrome:
+  name: Chrome
+  version: 127.0
+  installer:
+    type: msi
+    location: apps/Chrome-127.msi
+`,
+	}
+)
+
+// newCatalogServer returns a test server that serves fakeCatalogs
+func newCatalogServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := fakeCatalogs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+}
+
+// TestGet validates that catalogs are retrieved in the order provided
+func TestGet(t *testing.T) {
+	server := newCatalogServer()
+	defer server.Close()
+
+	cfg := config.Configuration{
+		URL:          server.URL + "/",
+		CatalogsPath: t.TempDir(),
+	}
+
+	catalogsMap, err := Get(cfg, []string{"production", "testing"})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	if _, exists := catalogsMap[1]["Firefox"]; !exists {
+		t.Errorf("Expected Firefox in the first catalog: %v", catalogsMap[1])
+	}
+	if _, exists := catalogsMap[2]["Chrome"]; !exists {
+		t.Errorf("Expected Chrome in the second catalog: %v", catalogsMap[2])
+	}
+
+	// Each catalog should be cached on disk
+	for _, name := range []string{"production", "testing"} {
+		if _, err := os.Stat(filepath.Join(cfg.CatalogsPath, name+".yaml")); err != nil {
+			t.Errorf("Expected %s to be cached: %v", name, err)
+		}
+	}
+}
+
+// TestGetNoCatalogs validates that an error is returned without catalogs
+func TestGetNoCatalogs(t *testing.T) {
+	_, err := Get(config.Configuration{}, nil)
+	if err == nil {
+		t.Errorf("Expected an error when no catalogs are provided")
+	}
+}
+
+// TestGetCachedFallback validates that the cached copy is used when the download fails
+func TestGetCachedFallback(t *testing.T) {
+	server := newCatalogServer()
+	cfg := config.Configuration{
+		URL:          server.URL + "/",
+		CatalogsPath: t.TempDir(),
+	}
+
+	// Populate the cache, then take the server away
+	if _, err := Get(cfg, []string{"production"}); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	server.Close()
+
+	catalogsMap, err := Get(cfg, []string{"production"})
+	if err != nil {
+		t.Fatalf("Expected the cached catalog to be used: %v", err)
+	}
+	if _, exists := catalogsMap[1]["Firefox"]; !exists {
+		t.Errorf("Expected Firefox from the cached catalog: %v", catalogsMap[1])
+	}
+
+	// A catalog that was never cached should return an error
+	if _, err := Get(cfg, []string{"testing"}); err == nil {
+		t.Errorf("Expected an error for a catalog that is not cached")
+	}
+}
+
+// TestGetCompressed validates compressed catalogs are used when configured, and cached decompressed,
+// with the uncompressed catalog used where there is no compressed one
+func TestGetCompressed(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path != "/catalogs/production.yaml.gz" {
+			content, ok := fakeCatalogs[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(content))
+			return
+		}
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(fakeCatalogs["/catalogs/production.yaml"]))
+		zw.Close()
+	}))
+	defer server.Close()
+
+	cfg := config.Configuration{
+		URL:                server.URL + "/",
+		CatalogsPath:       t.TempDir(),
+		CompressedCatalogs: true,
+	}
+	catalogsMap, err := Get(cfg, []string{"production", "testing"})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if _, exists := catalogsMap[1]["Firefox"]; !exists {
+		t.Errorf("Expected Firefox from the compressed catalog: %v", catalogsMap[1])
+	}
+	if _, exists := catalogsMap[2]["Chrome"]; !exists {
+		t.Errorf("Expected Chrome from the uncompressed catalog: %v", catalogsMap[2])
+	}
+
+	expected := []string{"/catalogs/production.yaml.gz", "/catalogs/testing.yaml.gz", "/catalogs/testing.yaml"}
+	if !reflect.DeepEqual(requested, expected) {
+		t.Errorf("Expected requests %v, got %v", expected, requested)
+	}
+
+	cached, err := os.ReadFile(filepath.Join(cfg.CatalogsPath, "production.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cached) != fakeCatalogs["/catalogs/production.yaml"] {
+		t.Errorf("Expected the catalog to be cached decompressed, got %q", cached)
+	}
+}
+
+// TestGetTruncated validates a download that doesn't parse falls back to the last stored copy
+// and is not stored, and a truncated stored copy falls back to the one before it
+func TestGetTruncated(t *testing.T) {
+	production := `
+Firefox:
+  name: Firefox
+  version: "128.0"
+  installer:
+    type: msi
+    location: apps/Firefox-128.msi
+`
+	content := production
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	cfg := config.Configuration{
+		URL:          server.URL + "/",
+		CatalogsPath: t.TempDir(),
+	}
+	cachedCatalog := filepath.Join(cfg.CatalogsPath, "production.yaml")
+
+	// Store two good copies, so there is a .bak
+	for i := 0; i < 2; i++ {
+		if _, err := Get(cfg, []string{"production"}); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+
+	// Cut off in the middle of the version
+	content = production[:strings.Index(production, `"128`)+4]
+	catalogsMap, err := Get(cfg, []string{"production"})
+	if err != nil {
+		t.Fatalf("Expected the cached catalog to be used: %v", err)
+	}
+	if _, exists := catalogsMap[1]["Firefox"]; !exists {
+		t.Errorf("Expected Firefox from the cached catalog: %v", catalogsMap[1])
+	}
+	if cached, _ := os.ReadFile(cachedCatalog); string(cached) != production {
+		t.Errorf("Expected the truncated download not to be stored, got %q", cached)
+	}
+
+	// A run that died writing the catalog before atomic writes
+	os.WriteFile(cachedCatalog, []byte(content), 0644)
+	catalogsMap, err = Get(cfg, []string{"production"})
+	if err != nil {
+		t.Fatalf("Expected the .bak catalog to be used: %v", err)
+	}
+	if _, exists := catalogsMap[1]["Firefox"]; !exists {
+		t.Errorf("Expected Firefox from the .bak catalog: %v", catalogsMap[1])
+	}
+
+	// A good download is stored again
+	content = production
+	if _, err := Get(cfg, []string{"production"}); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if cached, _ := os.ReadFile(cachedCatalog); string(cached) != production {
+		t.Errorf("Expected the download to be stored, got %q", cached)
+	}
+}
+
+// TestGetParseError validates that a malformed catalog returns an error
+func TestGetParseError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not: [valid"))
+	}))
+	defer server.Close()
+
+	cfg := config.Configuration{
+		URL:          server.URL + "/",
+		CatalogsPath: t.TempDir(),
+	}
+
+	if _, err := Get(cfg, []string{"production"}); err == nil {
+		t.Errorf("Expected an error for a malformed catalog")
+	}
+}
+
+// TestParseCatalogList validates that a catalog written by makecatalogs can be parsed
+func TestParseCatalogList(t *testing.T) {
+	yamlFile, err := os.ReadFile("testdata/makecatalogs_All.yaml")
+	if err != nil {
+		t.Fatalf("Unable to read fixture: %v", err)
+	}
+
+	catalogItems, err := parseCatalog(yamlFile)
+	if err != nil {
+		t.Fatalf("parseCatalog failed: %v", err)
+	}
+
+	if len(catalogItems) != 2 {
+		t.Errorf("Expected 2 unique items, got %d: %v", len(catalogItems), catalogItems)
+	}
+	if catalogItems["Chrome"].Version != "127.0.6533.100" {
+		t.Errorf("Unexpected Chrome version: %s", catalogItems["Chrome"].Version)
+	}
+
+	// The duplicate Firefox entry should resolve to the highest version
+	if catalogItems["Firefox"].Version != "128.0" {
+		t.Errorf("Expected Firefox 128.0, got %s", catalogItems["Firefox"].Version)
+	}
+}
+
+// TestParseCatalogMap validates that a catalog keyed by item name can be parsed
+func TestParseCatalogMap(t *testing.T) {
+	catalogItems, err := parseCatalog([]byte(fakeCatalogs["/catalogs/production.yaml"]))
+	if err != nil {
+		t.Fatalf("parseCatalog failed: %v", err)
+	}
+	if catalogItems["Firefox"].Installer.Location != "apps/Firefox-128.msi" {
+		t.Errorf("Unexpected Firefox item: %v", catalogItems["Firefox"])
+	}
+}
+
+// TestParseProductCodes validates the msi codes written by makecatalogs are read as fields,
+// and a product code older catalogs set only on the installer is moved to the item
+func TestParseProductCodes(t *testing.T) {
+	catalogItems, err := parseCatalog([]byte(`
+- name: Firefox
+  version: "128.0"
+  installer:
+    type: msi
+    location: apps/Firefox-128.msi
+    product_code: "{1A2B}"
+  product_code: "{1A2B}"
+  upgrade_code: "{3C4D}"
+- name: Zoom
+  version: "6.1"
+  installer:
+    type: msi
+    location: apps/Zoom-6.1.msi
+    product_code: "{5E6F}"
+`))
+	if err != nil {
+		t.Fatalf("parseCatalog failed: %v", err)
+	}
+	firefox := catalogItems["Firefox"]
+	if firefox.ProductCode != "{1A2B}" || firefox.UpgradeCode != "{3C4D}" || firefox.Installer.ProductCode != "" {
+		t.Errorf("unexpected codes: %+v", firefox)
+	}
+	if len(firefox.Extras) != 0 {
+		t.Errorf("expected no unknown fields, got %v", firefox.Extras)
+	}
+	if zoom := catalogItems["Zoom"]; zoom.ProductCode != "{5E6F}" || zoom.Installer.ProductCode != "" {
+		t.Errorf("expected the installer product code moved to the item, got %+v", zoom)
+	}
+}
+
+// TestExtrasRoundTrip validates that unknown fields are retained when an item is encoded again
+func TestExtrasRoundTrip(t *testing.T) {
+	yamlFile := []byte(`
+Firefox:
+  name: Firefox
+  version: "128.0"
+  notes: Imported from the vendor site
+  icon_name: Firefox.png
+  installer_item_size: 54321
+  dependancies:
+    - VCRedist
+`)
+
+	catalogItems, err := parseCatalog(yamlFile)
+	if err != nil {
+		t.Fatalf("parseCatalog failed: %v", err)
+	}
+
+	firefox := catalogItems["Firefox"]
+	if firefox.Extras["notes"] != "Imported from the vendor site" {
+		t.Errorf("Expected notes to be retained: %v", firefox.Extras)
+	}
+	if firefox.Extras["installer_item_size"] != 54321 {
+		t.Errorf("Expected installer_item_size to be retained: %v", firefox.Extras)
+	}
+	if _, exists := firefox.Extras["name"]; exists {
+		t.Errorf("Known fields should not be in Extras: %v", firefox.Extras)
+	}
+
+	// Encode and parse the item again
+	encoded, err := yaml.Marshal(catalogItems)
+	if err != nil {
+		t.Fatalf("Unable to encode catalog: %v", err)
+	}
+	reparsed, err := parseCatalog(encoded)
+	if err != nil {
+		t.Fatalf("parseCatalog failed: %v", err)
+	}
+	if !reflect.DeepEqual(reparsed["Firefox"].Extras, firefox.Extras) {
+		t.Errorf("Extras changed after round trip:\n%v\n%v", firefox.Extras, reparsed["Firefox"].Extras)
+	}
+	if reparsed["Firefox"].Version != firefox.Version {
+		t.Errorf("Version changed after round trip: %s", reparsed["Firefox"].Version)
+	}
+}
+
+// TestLogUnknownFields validates that each item with unknown fields is logged once
+func TestLogUnknownFields(t *testing.T) {
+	var logged []string
+	logDebug = func(message string, keyValues ...interface{}) {
+		logged = append(logged, fmt.Sprint(keyValues...))
+	}
+	defer func() {
+		logDebug = logging.Debug
+	}()
+
+	catalogItems := map[string]Item{
+		"Firefox": {Name: "Firefox", Extras: map[string]interface{}{"notes": "a", "dependancies": []string{"b"}}},
+		"Chrome":  {Name: "Chrome"},
+	}
+	logUnknownFields("production", catalogItems)
+
+	if len(logged) != 1 {
+		t.Fatalf("Expected one debug line, got %d: %v", len(logged), logged)
+	}
+	if !strings.Contains(logged[0], "dependancies,notes") {
+		t.Errorf("Expected the unknown keys to be listed: %s", logged[0])
+	}
+}
+
+// TestCheckForceInstallDates validates an invalid force_install_after_date is cleared
+func TestCheckForceInstallDates(t *testing.T) {
+	catalogItems, err := parseCatalog([]byte(`
+- name: Patch
+  version: "1.0"
+  force_install_after_date: 2024-07-12T17:00:00Z
+- name: Typo
+  version: "1.0"
+  force_install_after_date: friday
+`))
+	if err != nil {
+		t.Fatalf("parseCatalog failed: %v", err)
+	}
+	checkForceInstallDates("production", catalogItems)
+
+	if date := catalogItems["Patch"].ForceInstallAfter; date != "2024-07-12T17:00:00Z" {
+		t.Errorf("expected the valid date to be kept, got %q", date)
+	}
+	if date := catalogItems["Typo"].ForceInstallAfter; date != "" {
+		t.Errorf("expected the invalid date to be cleared, got %q", date)
+	}
+}
+
+// TestCheckScripts validates script items are kept with their script, and removed without one
+func TestCheckScripts(t *testing.T) {
+	catalogItems, err := parseCatalog([]byte(`
+- name: Wallpaper
+  version: "1.0"
+  installer:
+    type: script
+    script: |
+      Set-ItemProperty -Path 'HKCU:\Control Panel\Desktop' -Name Wallpaper -Value C:\Wallpaper.jpg
+  uninstaller:
+    type: script
+    script: Remove-ItemProperty -Path 'HKCU:\Control Panel\Desktop' -Name Wallpaper
+- name: Empty
+  version: "1.0"
+  installer:
+    type: script
+- name: EmptyUninstall
+  version: "1.0"
+  installer:
+    type: msi
+    location: apps/EmptyUninstall.msi
+  uninstaller:
+    type: script
+    script: "  "
+`))
+	if err != nil {
+		t.Fatalf("parseCatalog failed: %v", err)
+	}
+	checkScripts("production", catalogItems)
+
+	wallpaper, ok := catalogItems["Wallpaper"]
+	if !ok || !strings.HasPrefix(wallpaper.Installer.Script, "Set-ItemProperty") || !wallpaper.Installer.Runnable() {
+		t.Errorf("expected the script item to be kept with its script, got %+v", wallpaper)
+	}
+	for _, name := range []string{"Empty", "EmptyUninstall"} {
+		if _, ok := catalogItems[name]; ok {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+}
+
+// TestValidOSVersions validates the OS versions the authoring tools accept
+func TestValidOSVersions(t *testing.T) {
+	tests := []struct {
+		minimum, maximum string
+		valid            bool
+	}{
+		{"", "", true},
+		{"10.0.22000", "", true},
+		{"", "10.0.19045", true},
+		{"10.0.19041", "10.0.22631", true},
+		{"10.0.22631", "10.0.19045", false},
+		{"Windows 11", "", false},
+	}
+	for _, test := range tests {
+		err := ValidOSVersions(test.minimum, test.maximum)
+		if (err == nil) != test.valid {
+			t.Errorf("%q, %q: expected valid %v, got %v", test.minimum, test.maximum, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package catalog
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// ItemURL returns the full URL for an item's installer
+func ItemURL(cfg config.Configuration, item Item) string {
+	return pkgsURL(cfg, item.Installer.Location)
+}
+
+// UninstallerURL returns the full URL for an item's uninstaller
+func UninstallerURL(cfg config.Configuration, item Item) string {
+	return pkgsURL(cfg, item.Uninstaller.Location)
+}
+
+// pkgsURL joins a location from the catalog with the packages URL.
+// Locations are relative to the `pkgs` directory of the repo, but may or
+// may not include it, and may use backslashes or a leading slash.
+// Locations that are already absolute URLs are returned as they are.
+func pkgsURL(cfg config.Configuration, location string) string {
+	if isAbsoluteURL(location) {
+		return location
+	}
+
+	// URLPkgsInfo overrides the repo URL for packages
+	baseURL := cfg.URLPkgsInfo
+	if baseURL == "" {
+		baseURL = cfg.URL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	// Normalize the separators and drop any leading or empty segments
+	location = strings.ReplaceAll(location, `\`, "/")
+	var segments []string
+	for _, segment := range strings.Split(location, "/") {
+		if segment == "" {
+			continue
+		}
+		segments = append(segments, escapeSegment(segment))
+	}
+
+	// Only add the pkgs directory if neither side already has it
+	hasPkgs := strings.HasSuffix(baseURL, "/pkgs") || (len(segments) > 0 && segments[0] == "pkgs")
+	if !hasPkgs {
+		segments = append([]string{"pkgs"}, segments...)
+	}
+
+	return baseURL + "/" + strings.Join(segments, "/")
+}
+
+// escapeSegment escapes a single path segment, leaving
+// segments that are already escaped as they are. Plus signs are escaped
+// too, since some servers, such as S3, read them in a path as spaces.
+func escapeSegment(segment string) string {
+	if unescaped, err := url.PathUnescape(segment); err == nil {
+		segment = unescaped
+	}
+	return strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+}
+
+// UnescapeSegment returns a segment of a location as the file or directory name it stands for,
+// such as `Firefox Setup.msi` for `Firefox%20Setup.msi`. A segment that isn't validly escaped,
+// such as `100%.msi`, or that would unescape to a separator or `..`, is returned as it is.
+func UnescapeSegment(segment string) string {
+	unescaped, err := url.PathUnescape(segment)
+	if err != nil || strings.ContainsAny(unescaped, `/\`) || unescaped == ".." {
+		return segment
+	}
+	return unescaped
+}
+
+// NeedsEscaping returns true when a file name has characters that are escaped in its URL,
+// such as spaces, parentheses or non-ASCII letters
+func NeedsEscaping(name string) bool {
+	return strings.ReplaceAll(url.PathEscape(name), "+", "%2B") != name
+}
+
+// isAbsoluteURL returns true if the location already includes a scheme and host
+func isAbsoluteURL(location string) bool {
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
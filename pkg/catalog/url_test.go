@@ -0,0 +1,96 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// TestItemURL validates that installer locations are joined with the packages URL
+func TestItemURL(t *testing.T) {
+	cfg := config.Configuration{URL: "https://example.com/gorilla/"}
+
+	tests := []struct {
+		location string
+		expected string
+	}{
+		{"apps/Firefox/Firefox-128.msi", "https://example.com/gorilla/pkgs/apps/Firefox/Firefox-128.msi"},
+		{"/apps/Firefox/Firefox-128.msi", "https://example.com/gorilla/pkgs/apps/Firefox/Firefox-128.msi"},
+		{"pkgs/apps/Firefox/Firefox-128.msi", "https://example.com/gorilla/pkgs/apps/Firefox/Firefox-128.msi"},
+		{"/pkgs//apps/Firefox-128.msi", "https://example.com/gorilla/pkgs/apps/Firefox-128.msi"},
+		{`\apps\Firefox\Firefox-128.msi`, "https://example.com/gorilla/pkgs/apps/Firefox/Firefox-128.msi"},
+		{"apps/Mozilla Firefox/Firefox Setup 128.msi", "https://example.com/gorilla/pkgs/apps/Mozilla%20Firefox/Firefox%20Setup%20128.msi"},
+		{"apps/Firefox%20Setup.msi", "https://example.com/gorilla/pkgs/apps/Firefox%20Setup.msi"},
+		{"apps/VC/VC_redist (x64).exe", "https://example.com/gorilla/pkgs/apps/VC/VC_redist%20%28x64%29.exe"},
+		{"apps/Notepad++/npp+8.6.Installer.exe", "https://example.com/gorilla/pkgs/apps/Notepad%2B%2B/npp%2B8.6.Installer.exe"},
+		{"apps/Zürich Fonts/Schrift–1.0.msi", "https://example.com/gorilla/pkgs/apps/Z%C3%BCrich%20Fonts/Schrift%E2%80%931.0.msi"},
+		{"apps/Discount 100%.msi", "https://example.com/gorilla/pkgs/apps/Discount%20100%25.msi"},
+		{"https://cdn.example.com/Firefox-128.msi", "https://cdn.example.com/Firefox-128.msi"},
+	}
+
+	for _, test := range tests {
+		item := Item{Installer: InstallerItem{Location: test.location}}
+		if actual := ItemURL(cfg, item); actual != test.expected {
+			t.Errorf("location: %s; expected %s, got %s", test.location, test.expected, actual)
+		}
+	}
+}
+
+// TestItemURLPkgsOverride validates that URLPkgsInfo is used for packages when provided
+func TestItemURLPkgsOverride(t *testing.T) {
+	item := Item{Installer: InstallerItem{Location: "apps/Firefox-128.msi"}}
+
+	cfg := config.Configuration{
+		URL:         "https://example.com/gorilla/",
+		URLPkgsInfo: "https://cdn.example.com/gorilla/pkgs/",
+	}
+	expected := "https://cdn.example.com/gorilla/pkgs/apps/Firefox-128.msi"
+	if actual := ItemURL(cfg, item); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+
+	cfg.URLPkgsInfo = "https://cdn.example.com/gorilla"
+	expected = "https://cdn.example.com/gorilla/pkgs/apps/Firefox-128.msi"
+	if actual := ItemURL(cfg, item); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+// TestUninstallerURL validates that uninstaller locations are joined with the packages URL
+func TestUninstallerURL(t *testing.T) {
+	cfg := config.Configuration{URL: "https://example.com/gorilla"}
+	item := Item{
+		Installer:   InstallerItem{Location: "apps/Firefox-128.msi"},
+		Uninstaller: InstallerItem{Location: `apps\Firefox Uninstall.exe`},
+	}
+
+	expected := "https://example.com/gorilla/pkgs/apps/Firefox%20Uninstall.exe"
+	if actual := UninstallerURL(cfg, item); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+// TestUnescapeSegment validates escaped locations name the same file as unescaped ones,
+// and segments that can't be unescaped safely are kept as they are
+func TestUnescapeSegment(t *testing.T) {
+	tests := map[string]string{
+		"Firefox%20Setup%20%28x64%29.msi": "Firefox Setup (x64).msi",
+		"npp%2B8.6.exe":                   "npp+8.6.exe",
+		"npp+8.6.exe":                     "npp+8.6.exe",
+		"Z%C3%BCrich.msi":                 "Zürich.msi",
+		"100%.msi":                        "100%.msi",
+		"a%2Fb.msi":                       "a%2Fb.msi",
+		"%2E%2E":                          "%2E%2E",
+	}
+	for segment, expected := range tests {
+		if actual := UnescapeSegment(segment); actual != expected {
+			t.Errorf("UnescapeSegment(%q) = %q, want %q", segment, actual, expected)
+		}
+	}
+
+	for name, expected := range map[string]bool{"Firefox-128.0.msi": false, "Firefox Setup.msi": true, "npp+8.6.exe": true, "VC(x64).exe": true, "Zürich.msi": true} {
+		if NeedsEscaping(name) != expected {
+			t.Errorf("NeedsEscaping(%q) = %v, want %v", name, !expected, expected)
+		}
+	}
+}
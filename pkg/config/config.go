@@ -9,64 +9,119 @@ import (
 
 const ConfigPath = `C:\ProgramData\ManagedInstalls\Config.yaml`
 
-// Configuration holds the configurable options for Gorilla in YAML format
+// Configuration holds the configurable options for Gorilla in YAML format.
+// Fields tagged `sensitive:"true"` are redacted when the configuration is shown.
 type Configuration struct {
-    Catalogs        []string `yaml:"catalogs"`
-    CatalogsPath    string   `yaml:"catalogs_path"`
-    CachePath       string   `yaml:"cache_path"`
-    CheckOnly       bool     `yaml:"check_only"`
-    CloudBucket     string   `yaml:"cloud_bucket"`
-    CloudProvider   string   `yaml:"cloud_provider"`
-    Debug           bool     `yaml:"debug"`
-    DefaultArch     string   `yaml:"default_arch"`
-    DefaultCatalog  string   `yaml:"default_catalog"`
-    InstallPath     string   `yaml:"install_path"`
-    LocalManifests  []string `yaml:"local_manifests"`
-    LogLevel        string   `yaml:"log_level"`
-    Manifest        string   `yaml:"manifest"`
-    RepoPath        string   `yaml:"repo_path"`
-    URL             string   `yaml:"url"`
-    URLPkgsInfo     string   `yaml:"url_pkgsinfo"`
-    Verbose         bool     `yaml:"verbose"`
+    AppDataPath               string   `yaml:"app_data_path"`
+    AuthAdditionalHosts       []string `yaml:"auth_additional_hosts"`
+    AuthBearerToken           string   `yaml:"auth_bearer_token" sensitive:"true"`
+    AuthCertificateThumbprint string   `yaml:"auth_certificate_thumbprint"`
+    AuthClientID              string   `yaml:"auth_client_id"`
+    AuthClientSecret          string   `yaml:"auth_client_secret" sensitive:"true"`
+    AuthNegotiateFallback     string   `yaml:"auth_negotiate_fallback"`
+    AuthProvider              string   `yaml:"auth_provider"`
+    AuthScope                 string   `yaml:"auth_scope"`
+    AuthTenantID              string   `yaml:"auth_tenant_id"`
+    AuthTokenURL              string   `yaml:"auth_token_url"`
+    AutoRunSplaySeconds       int      `yaml:"auto_run_splay_seconds"`
+    AutoRunSplayStable        bool     `yaml:"auto_run_splay_stable"`
+    Catalogs                  []string `yaml:"catalogs"`
+    CatalogsPath              string   `yaml:"catalogs_path"`
+    CatalogStripFields        []string `yaml:"catalog_strip_fields"`
+    CompressedCatalogs        bool     `yaml:"compressed_catalogs"`
+    CachePath                 string   `yaml:"cache_path"`
+    CheckOnly                 bool     `yaml:"check_only"`
+    ClientIdentifier          string   `yaml:"client_identifier"`
+    CloudBucket               string   `yaml:"cloud_bucket"`
+    CloudProvider             string   `yaml:"cloud_provider"`
+    Debug                     bool     `yaml:"debug"`
+    DefaultArch               string   `yaml:"default_arch"`
+    DefaultArgumentsEXE       []string `yaml:"default_arguments_exe"`
+    DefaultArgumentsMSI       []string `yaml:"default_arguments_msi"`
+    DefaultArgumentsNupkg     []string `yaml:"default_arguments_nupkg"`
+    DefaultCatalog            string   `yaml:"default_catalog"`
+    DefaultImportSubdir       string   `yaml:"default_import_subdir"`
+    EchoCommands              bool     `yaml:"echo_commands"`
+    FailureBackoffCount       int      `yaml:"failure_backoff_count"`
+    InstallLogRetentionDays   int      `yaml:"install_log_retention_days"`
+    InstallPath               string   `yaml:"install_path"`
+    LocalManifests            []string `yaml:"local_manifests"`
+    LogLevel                  string   `yaml:"log_level"`
+    Manifest                  string   `yaml:"manifest"`
+    ManifestsPath             string   `yaml:"manifests_path"`
+    MaxConcurrentChecks       int      `yaml:"max_concurrent_checks"`
+    MaxConcurrentScriptInstalls int    `yaml:"max_concurrent_script_installs"`
+    MetadataRunIntervalMinutes int     `yaml:"metadata_run_interval_minutes"`
+    MinimumFreeSpaceMB        int      `yaml:"minimum_free_space_mb"`
+    OnPendingReboot           string   `yaml:"on_pending_reboot"`
+    PendingMaxAgeHours        int      `yaml:"pending_max_age_hours"`
+    PreflightFailureMode      string   `yaml:"preflight_failure_mode"`
+    PreflightPath             string   `yaml:"preflight_path"`
+    PreflightTimeoutSeconds   int      `yaml:"preflight_timeout_seconds"`
+    ReportURL                 string   `yaml:"report_url"`
+    RepoPath                  string   `yaml:"repo_path"`
+    URL                       string   `yaml:"url"`
+    URLPkgsInfo               string   `yaml:"url_pkgsinfo"`
+    Variables                 map[string]string `yaml:"variables"`
+    Verbose                   bool     `yaml:"verbose"`
+
+    // Unattended is set for automatic runs, which defer the items with unattended_install
+    // or unattended_uninstall false to an interactive run
+    Unattended bool `yaml:"-"`
+
+    // Sources is the file that supplied each value, Config.yaml or conf.d fragments, by key
+    Sources map[string]string `yaml:"-"`
+
+    // secrets are the values that were encrypted with DPAPI, by key, so they are saved encrypted
+    secrets map[string]secret
 }
 
-// LoadConfig loads the configuration from a YAML file.
+// LoadConfig loads the configuration from a YAML file, with any conf.d fragments merged over it.
 func LoadConfig() (*Configuration, error) {
     if _, err := os.Stat(ConfigPath); os.IsNotExist(err) {
         log.Printf("Configuration file does not exist: %s", ConfigPath)
         return nil, err
     }
 
-    data, err := os.ReadFile(ConfigPath)
+    config, err := loadConfigFrom(ConfigPath, ConfDPath)
     if err != nil {
-        log.Printf("Failed to read configuration file: %v", err)
+        log.Printf("Failed to load configuration: %v", err)
         return nil, err
     }
 
-    var config Configuration
-    if err := yaml.Unmarshal(data, &config); err != nil {
-        log.Printf("Failed to parse configuration file: %v", err)
-        return nil, err
-    }
-
-    return &config, nil
+    return config, nil
 }
 
 // SaveConfig saves the current configuration to a YAML file.
+// Values that were loaded encrypted are saved encrypted, never decrypted.
 func SaveConfig(config *Configuration) error {
-    data, err := yaml.Marshal(config)
+    return saveConfigTo(ConfigPath, config)
+}
+
+// saveConfigTo saves the configuration to configPath
+func saveConfigTo(configPath string, config *Configuration) error {
+    var doc yaml.Node
+    err := doc.Encode(config)
+    if err == nil {
+        err = encryptSecrets(&doc, "", config.secrets)
+    }
+    if err != nil {
+        log.Printf("Failed to serialize configuration: %v", err)
+        return err
+    }
+    data, err := yaml.Marshal(&doc)
     if err != nil {
         log.Printf("Failed to serialize configuration: %v", err)
         return err
     }
 
-    err = os.MkdirAll(filepath.Dir(ConfigPath), 0755)
+    err = os.MkdirAll(filepath.Dir(configPath), 0755)
     if err != nil {
         log.Printf("Failed to create configuration directory: %v", err)
         return err
     }
 
-    err = os.WriteFile(ConfigPath, data, 0644)
+    err = os.WriteFile(configPath, data, 0644)
     if err != nil {
         log.Printf("Failed to write configuration file: %v", err)
         return err
@@ -82,6 +137,7 @@ func GetDefaultConfig() *Configuration {
         InstallPath:    `C:\Program Files\Gorilla`,
         RepoPath:       `C:\ProgramData\Gorilla\repo`,
         CatalogsPath:   `C:\ProgramData\ManagedInstalls\catalogs`,
+        ManifestsPath:  `C:\ProgramData\ManagedInstalls\manifests`,
         CachePath:      `C:\ProgramData\ManagedInstalls\Cache`,
         Debug:          false,
         Verbose:        false,
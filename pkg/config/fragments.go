@@ -0,0 +1,134 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfDPath is where configuration fragments are merged over Config.yaml from
+const ConfDPath = `C:\ProgramData\ManagedInstalls\conf.d`
+
+// appendSuffix on a fragment key, such as `catalogs+:`, appends its list to the
+// value so far instead of replacing it
+const appendSuffix = "+"
+
+// loadConfigFrom reads the configuration at configPath, then merges the *.yaml fragments
+// in confDir over it in lexical order. A fragment's scalars and lists replace the value so far,
+// and lists under a key ending in `+` are appended to it. The file that supplied each
+// effective value is recorded in Sources.
+func loadConfigFrom(configPath, confDir string) (*Configuration, error) {
+	secrets := make(map[string]secret)
+	values, err := readValues(configPath, secrets)
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]string, len(values))
+	for key := range values {
+		sources[key] = filepath.Base(configPath)
+	}
+
+	fragments, err := filepath.Glob(filepath.Join(confDir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(fragments)
+	for _, fragment := range fragments {
+		fragmentSecrets := make(map[string]secret)
+		fragmentValues, err := readValues(fragment, fragmentSecrets)
+		if err != nil {
+			return nil, err
+		}
+		if err := mergeValues(values, sources, fragmentValues, filepath.Base(fragment)); err != nil {
+			return nil, fmt.Errorf("%s: %v", fragment, err)
+		}
+		// A value the fragment replaces is only a secret if the fragment's value is
+		for key := range fragmentValues {
+			for secretKey := range secrets {
+				if secretKey == key || strings.HasPrefix(secretKey, key+".") {
+					delete(secrets, secretKey)
+				}
+			}
+		}
+		for key, s := range fragmentSecrets {
+			secrets[key] = s
+		}
+	}
+
+	// Decode the merged values, so fragments are held to the same types as Config.yaml
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	var config Configuration
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the merged configuration: %v", err)
+	}
+	config.Sources = sources
+	config.secrets = secrets
+	return &config, nil
+}
+
+// readValues reads a configuration file as its top level keys and values,
+// with its secrets decrypted and recorded in secrets
+func readValues(path string, secrets map[string]secret) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if err := decryptSecrets(&doc, "", secrets); err != nil {
+		return nil, fmt.Errorf("failed to decrypt a secret in %s: %v", path, err)
+	}
+	values := make(map[string]interface{})
+	if len(doc.Content) == 0 {
+		return values, nil
+	}
+	if err := doc.Decode(&values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return values, nil
+}
+
+// mergeValues merges the values of a fragment over the values so far
+func mergeValues(values map[string]interface{}, sources map[string]string, fragment map[string]interface{}, name string) error {
+	// Merge in key order, so a key and its `+` form in the same fragment apply predictably
+	keys := make([]string, 0, len(fragment))
+	for key := range fragment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := fragment[key]
+		if !strings.HasSuffix(key, appendSuffix) {
+			values[key] = value
+			sources[key] = name
+			continue
+		}
+
+		key = strings.TrimSuffix(key, appendSuffix)
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s%s must be a list", key, appendSuffix)
+		}
+		existing, ok := values[key].([]interface{})
+		if values[key] != nil && !ok {
+			return fmt.Errorf("%s%s can't append to a value that is not a list", key, appendSuffix)
+		}
+		values[key] = append(append([]interface{}{}, existing...), list...)
+		if sources[key] == "" {
+			sources[key] = name
+		} else {
+			sources[key] += " + " + name
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const baseConfig = `url: https://gorilla.example.com/
+catalogs:
+  - production
+log_level: INFO
+`
+
+// writeConfig writes Config.yaml and each fragment into a temporary conf.d, returning both paths
+func writeConfig(t *testing.T, fragments map[string]string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "Config.yaml")
+	if err := os.WriteFile(configPath, []byte(baseConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	confDir := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(confDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range fragments {
+		if err := os.WriteFile(filepath.Join(confDir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return configPath, confDir
+}
+
+// TestLoadConfigNoFragments validates Config.yaml is used as is without conf.d
+func TestLoadConfigNoFragments(t *testing.T) {
+	configPath, _ := writeConfig(t, nil)
+
+	cfg, err := loadConfigFrom(configPath, filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.URL != "https://gorilla.example.com/" || cfg.LogLevel != "INFO" {
+		t.Errorf("unexpected configuration: %+v", cfg)
+	}
+	if cfg.Sources["url"] != "Config.yaml" {
+		t.Errorf("expected url from Config.yaml, got %q", cfg.Sources["url"])
+	}
+}
+
+// TestLoadConfigOverride validates a fragment replaces scalars and lists
+func TestLoadConfigOverride(t *testing.T) {
+	configPath, confDir := writeConfig(t, map[string]string{
+		"10-site.yaml": "log_level: DEBUG\ncatalogs:\n  - testing\n",
+		"README.txt":   "log_level: ERROR\n",
+	})
+
+	cfg, err := loadConfigFrom(configPath, confDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogLevel != "DEBUG" {
+		t.Errorf("expected log_level DEBUG, got %q", cfg.LogLevel)
+	}
+	if !reflect.DeepEqual(cfg.Catalogs, []string{"testing"}) {
+		t.Errorf("expected catalogs [testing], got %v", cfg.Catalogs)
+	}
+	expected := map[string]string{
+		"url":       "Config.yaml",
+		"catalogs":  "10-site.yaml",
+		"log_level": "10-site.yaml",
+	}
+	if !reflect.DeepEqual(cfg.Sources, expected) {
+		t.Errorf("expected sources %v, got %v", expected, cfg.Sources)
+	}
+}
+
+// TestLoadConfigAppend validates a `+` key appends to the list so far
+func TestLoadConfigAppend(t *testing.T) {
+	configPath, confDir := writeConfig(t, map[string]string{
+		"10-testing.yaml": "catalogs+:\n  - testing\n",
+		"20-local.yaml":   "catalogs+:\n  - local\nlocal_manifests+:\n  - extra.yaml\n",
+	})
+
+	cfg, err := loadConfigFrom(configPath, confDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Catalogs, []string{"production", "testing", "local"}) {
+		t.Errorf("expected catalogs [production testing local], got %v", cfg.Catalogs)
+	}
+	if !reflect.DeepEqual(cfg.LocalManifests, []string{"extra.yaml"}) {
+		t.Errorf("expected local_manifests [extra.yaml], got %v", cfg.LocalManifests)
+	}
+	if source := cfg.Sources["catalogs"]; source != "Config.yaml + 10-testing.yaml + 20-local.yaml" {
+		t.Errorf("unexpected catalogs source %q", source)
+	}
+	if source := cfg.Sources["local_manifests"]; source != "20-local.yaml" {
+		t.Errorf("unexpected local_manifests source %q", source)
+	}
+}
+
+// TestLoadConfigConflict validates conflicting fragments apply in lexical order, so the last one wins
+func TestLoadConfigConflict(t *testing.T) {
+	configPath, confDir := writeConfig(t, map[string]string{
+		"20-b.yaml": "log_level: WARN\n",
+		"10-a.yaml": "log_level: DEBUG\ncatalogs+:\n  - testing\n",
+		"30-c.yaml": "catalogs:\n  - staging\n",
+	})
+
+	cfg, err := loadConfigFrom(configPath, confDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogLevel != "WARN" || cfg.Sources["log_level"] != "20-b.yaml" {
+		t.Errorf("expected log_level WARN from 20-b.yaml, got %q from %q", cfg.LogLevel, cfg.Sources["log_level"])
+	}
+	if !reflect.DeepEqual(cfg.Catalogs, []string{"staging"}) || cfg.Sources["catalogs"] != "30-c.yaml" {
+		t.Errorf("expected catalogs [staging] from 30-c.yaml, got %v from %q", cfg.Catalogs, cfg.Sources["catalogs"])
+	}
+}
+
+// TestLoadConfigInvalidAppend validates appending to or with a value that is not a list fails
+func TestLoadConfigInvalidAppend(t *testing.T) {
+	for name, fragment := range map[string]string{
+		"scalar value":  "catalogs+: testing\n",
+		"scalar target": "log_level+:\n  - DEBUG\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			configPath, confDir := writeConfig(t, map[string]string{"10-bad.yaml": fragment})
+			if _, err := loadConfigFrom(configPath, confDir); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+// secret is a value a configuration file had encrypted, as `!dpapi <base64>`,
+// with the value it decrypted to
+type secret struct {
+	encrypted string
+	value     string
+}
+
+// These abstractions allow us to override when testing
+var (
+	decryptSecret = crypto.DecryptSecret
+	encryptSecret = crypto.EncryptSecret
+)
+
+// decryptSecrets replaces each `!dpapi <base64>` value in a configuration file with the value
+// it decrypts to, and records it in secrets by its key, such as `variables.proxy_password`.
+// Values are found under keys at any depth, not in lists. The tag may also be written inside
+// a quoted string, as `"!dpapi <base64>"`.
+func decryptSecrets(node *yaml.Node, key string, secrets map[string]secret) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := decryptSecrets(child, key, secrets); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := decryptSecrets(node.Content[i+1], secretKey(key, node.Content[i].Value), secrets); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		encrypted, ok := encryptedValue(node)
+		if !ok || key == "" {
+			return nil
+		}
+		value, err := decryptSecret(encrypted)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		secrets[key] = secret{encrypted: encrypted, value: value}
+		node.Tag, node.Value = "!!str", value
+	}
+	return nil
+}
+
+// encryptSecrets puts the values that were decrypted back in their encrypted form before
+// the configuration is saved, so a decrypted secret is never written out. A value that was
+// changed since it was decrypted is encrypted again.
+func encryptSecrets(node *yaml.Node, key string, secrets map[string]secret) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := encryptSecrets(child, key, secrets); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := encryptSecrets(node.Content[i+1], secretKey(key, node.Content[i].Value), secrets); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		s, ok := secrets[key]
+		if !ok || node.Value == "" {
+			return nil
+		}
+		encrypted := s.encrypted
+		if node.Value != s.value {
+			var err error
+			if encrypted, err = encryptSecret(node.Value); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+		node.Tag, node.Value, node.Style = crypto.SecretTag, encrypted, 0
+	}
+	return nil
+}
+
+// encryptedValue returns the base64 of a `!dpapi` value
+func encryptedValue(node *yaml.Node) (string, bool) {
+	if node.Tag == crypto.SecretTag {
+		return node.Value, true
+	}
+	if node.ShortTag() == "!!str" && strings.HasPrefix(node.Value, crypto.SecretTag+" ") {
+		return strings.TrimPrefix(node.Value, crypto.SecretTag+" "), true
+	}
+	return "", false
+}
+
+// secretKey returns the key of a value under parent, joined with a `.`
+func secretKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
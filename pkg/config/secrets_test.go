@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useFakeSecrets replaces DPAPI with a reversible fake, so secrets are tested on every platform.
+// A secret is its value reversed, and "bad" fails to decrypt like one from another machine.
+func useFakeSecrets(t *testing.T) {
+	origDecrypt, origEncrypt := decryptSecret, encryptSecret
+	t.Cleanup(func() { decryptSecret, encryptSecret = origDecrypt, origEncrypt })
+	decryptSecret = func(encoded string) (string, error) {
+		if encoded == "bad" {
+			return "", errors.New("the key is not valid")
+		}
+		return reverse(encoded), nil
+	}
+	encryptSecret = func(value string) (string, error) {
+		return reverse(value), nil
+	}
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// TestLoadConfigSecrets validates tagged and quoted secrets are decrypted, in Config.yaml,
+// nested maps and fragments, and are redacted when the settings are shown
+func TestLoadConfigSecrets(t *testing.T) {
+	useFakeSecrets(t)
+	configPath, confDir := writeConfig(t, map[string]string{
+		"10-auth.yaml": "auth_client_secret: \"!dpapi 2retnuh\"\n",
+	})
+	data := baseConfig + "auth_bearer_token: !dpapi nekot\nvariables:\n  proxy_password: !dpapi drowssap\n  site: HQ\n"
+	if err := os.WriteFile(configPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfigFrom(configPath, confDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AuthBearerToken != "token" || cfg.AuthClientSecret != "hunter2" || cfg.Variables["proxy_password"] != "password" {
+		t.Errorf("expected the secrets decrypted, got %q %q %q", cfg.AuthBearerToken, cfg.AuthClientSecret, cfg.Variables["proxy_password"])
+	}
+
+	for _, setting := range cfg.Settings() {
+		if setting.Key != "variables" {
+			continue
+		}
+		variables := setting.Value.(map[string]string)
+		if variables["proxy_password"] != Redacted || variables["site"] != "HQ" {
+			t.Errorf("expected only the encrypted variable redacted, got %v", variables)
+		}
+	}
+}
+
+// TestLoadConfigSecretFails validates a secret that can't be decrypted fails the load with its key
+func TestLoadConfigSecretFails(t *testing.T) {
+	useFakeSecrets(t)
+	configPath, confDir := writeConfig(t, nil)
+	if err := os.WriteFile(configPath, []byte(baseConfig+"auth_client_secret: !dpapi bad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfigFrom(configPath, confDir); err == nil || !strings.Contains(err.Error(), "auth_client_secret") {
+		t.Errorf("expected an error naming auth_client_secret, got %v", err)
+	}
+}
+
+// TestSaveConfigSecrets validates secrets are saved encrypted, a changed secret is encrypted again,
+// and a secret a fragment replaced with a plain value is saved as it is
+func TestSaveConfigSecrets(t *testing.T) {
+	useFakeSecrets(t)
+	configPath, confDir := writeConfig(t, map[string]string{
+		"10-token.yaml": "auth_bearer_token: plain-token\n",
+	})
+	data := baseConfig + "auth_bearer_token: !dpapi nekot\nauth_client_secret: !dpapi 2retnuh\nvariables:\n  proxy_password: !dpapi drowssap\n"
+	if err := os.WriteFile(configPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfigFrom(configPath, confDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Variables["proxy_password"] = "changed"
+
+	savedPath := filepath.Join(t.TempDir(), "Config.yaml")
+	if err := saveConfigTo(savedPath, cfg); err != nil {
+		t.Fatalf("saveConfigTo failed: %v", err)
+	}
+	saved, err := os.ReadFile(savedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(saved)
+	for _, want := range []string{"auth_client_secret: !dpapi 2retnuh", "proxy_password: !dpapi degnahc", "auth_bearer_token: plain-token"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "hunter2") || strings.Contains(text, "changed") {
+		t.Errorf("a decrypted secret was saved:\n%s", text)
+	}
+
+	reloaded, err := loadConfigFrom(savedPath, filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.AuthClientSecret != "hunter2" || reloaded.Variables["proxy_password"] != "changed" {
+		t.Errorf("unexpected configuration after saving: %+v", reloaded)
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces the value of a sensitive setting when the configuration is shown
+const Redacted = "********"
+
+// SourceDefault is the source of a setting no configuration file supplied
+const SourceDefault = "default"
+
+// Setting is one key of the effective configuration, with the file that supplied it
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	// Sensitive settings have their value replaced by Redacted when they are set
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+// Settings lists the effective value of every configuration key in key order, with its source
+// from Sources, or SourceDefault for a key no file set. The values of fields tagged
+// `sensitive:"true"` and the values that were encrypted are redacted, so the settings
+// are safe to print or send.
+func (c *Configuration) Settings() []Setting {
+	value := reflect.ValueOf(c).Elem()
+	fields := value.Type()
+
+	var settings []Setting
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+
+		setting := Setting{
+			Key:       key,
+			Value:     value.Field(i).Interface(),
+			Source:    c.Sources[key],
+			Sensitive: field.Tag.Get("sensitive") == "true",
+		}
+		if setting.Source == "" {
+			setting.Source = SourceDefault
+		}
+		if _, encrypted := c.secrets[key]; encrypted {
+			setting.Sensitive = true
+		}
+		if setting.Sensitive && !value.Field(i).IsZero() {
+			setting.Value = Redacted
+		} else if values, ok := setting.Value.(map[string]string); ok {
+			setting.Value = c.redactSecrets(key, values)
+		}
+		settings = append(settings, setting)
+	}
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+// redactSecrets returns a copy of the values of a map setting, such as variables,
+// with the ones that were encrypted redacted
+func (c *Configuration) redactSecrets(key string, values map[string]string) map[string]string {
+	redacted := make(map[string]string, len(values))
+	for name, value := range values {
+		if _, encrypted := c.secrets[key+"."+name]; encrypted {
+			value = Redacted
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
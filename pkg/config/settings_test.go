@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+)
+
+// TestSettings validates each key has its effective value and source, and sensitive values are redacted
+func TestSettings(t *testing.T) {
+	cfg := &Configuration{
+		URL:              "https://gorilla.example.com/",
+		AuthClientSecret: "hunter2",
+		Sources: map[string]string{
+			"url":                "Config.yaml",
+			"auth_client_secret": "10-auth.yaml",
+		},
+	}
+
+	settings := make(map[string]Setting)
+	previous := ""
+	for _, setting := range cfg.Settings() {
+		if setting.Key <= previous {
+			t.Errorf("expected settings in key order, got %q after %q", setting.Key, previous)
+		}
+		previous = setting.Key
+		settings[setting.Key] = setting
+	}
+	if _, ok := settings["-"]; ok {
+		t.Error("expected Sources to be left out")
+	}
+
+	if url := settings["url"]; url.Value != "https://gorilla.example.com/" || url.Source != "Config.yaml" {
+		t.Errorf("unexpected url setting %+v", url)
+	}
+	if secret := settings["auth_client_secret"]; secret.Value != Redacted || !secret.Sensitive || secret.Source != "10-auth.yaml" {
+		t.Errorf("expected auth_client_secret redacted, got %+v", secret)
+	}
+	if token := settings["auth_bearer_token"]; token.Value != "" || !token.Sensitive || token.Source != SourceDefault {
+		t.Errorf("expected an empty auth_bearer_token from the default, got %+v", token)
+	}
+	if level := settings["log_level"]; level.Source != SourceDefault {
+		t.Errorf("expected log_level from the default, got %+v", level)
+	}
+}
@@ -0,0 +1,35 @@
+// pkg/crypto/crypto.go
+
+package crypto
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// SecretTag marks a configuration value encrypted with EncryptSecret, as `!dpapi <base64>`
+const SecretTag = "!dpapi"
+
+// EncryptSecret encrypts a value with machine scope DPAPI and returns it base64 encoded,
+// so any process on this machine can decrypt it and no other machine can
+func EncryptSecret(value string) (string, error) {
+	encrypted, err := Protect([]byte(value))
+	if err != nil {
+		return "", fmt.Errorf("unable to encrypt the secret: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// DecryptSecret decrypts a base64 value from EncryptSecret
+func DecryptSecret(encoded string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("unable to decode the secret: %v", err)
+	}
+	decrypted, err := Unprotect(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt the secret: %v", err)
+	}
+	return string(decrypted), nil
+}
@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"runtime"
+	"testing"
+)
+
+// TestSecretRoundTrip validates a secret decrypts to the value it was encrypted from
+func TestSecretRoundTrip(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("DPAPI is only available on Windows")
+	}
+
+	encoded, err := EncryptSecret("proxy password")
+	if err != nil {
+		t.Fatalf("EncryptSecret failed: %v", err)
+	}
+	if encoded == "" || encoded == "proxy password" {
+		t.Fatalf("unexpected encrypted value: %q", encoded)
+	}
+	decrypted, err := DecryptSecret(encoded)
+	if err != nil {
+		t.Fatalf("DecryptSecret failed: %v", err)
+	}
+	if decrypted != "proxy password" {
+		t.Errorf("expected the value back, got %q", decrypted)
+	}
+}
+
+// TestDecryptSecretInvalid validates a value that isn't base64 is refused before DPAPI is called
+func TestDecryptSecretInvalid(t *testing.T) {
+	if _, err := DecryptSecret("not base64!"); err == nil {
+		t.Error("expected an error for a value that isn't base64")
+	}
+}
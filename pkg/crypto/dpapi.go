@@ -0,0 +1,52 @@
+//go:build windows
+// +build windows
+
+package crypto
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Protect encrypts data with DPAPI for the local machine
+func Protect(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no data to encrypt")
+	}
+
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	err := windows.CryptProtectData(&in, nil, nil, 0, nil,
+		windows.CRYPTPROTECT_LOCAL_MACHINE|windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	// Copy the result before the buffer is freed
+	encrypted := make([]byte, out.Size)
+	copy(encrypted, (*[1 << 30]byte)(unsafe.Pointer(out.Data))[:out.Size:out.Size])
+	return encrypted, nil
+}
+
+// Unprotect decrypts data that was encrypted with DPAPI
+func Unprotect(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no data to decrypt")
+	}
+
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	// Copy the result before the buffer is freed
+	decrypted := make([]byte, out.Size)
+	copy(decrypted, (*[1 << 30]byte)(unsafe.Pointer(out.Data))[:out.Size:out.Size])
+	return decrypted, nil
+}
@@ -0,0 +1,21 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package crypto
+
+import "errors"
+
+// errUnsupported is returned on darwin, which has no DPAPI
+var errUnsupported = errors.New("DPAPI is only supported on Windows")
+
+// Protect is just a placeholder on darwin, nothing can be encrypted
+func Protect(data []byte) ([]byte, error) {
+	return nil, errUnsupported
+}
+
+// Unprotect is just a placeholder on darwin, nothing can be decrypted
+func Unprotect(data []byte) ([]byte, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,69 @@
+package download
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// conditionalDir keeps the bodies fetched with Get that had an ETag, each with its ETag,
+// so they are requested again with If-None-Match. Conditional requests are off when it is empty.
+var conditionalDir string
+
+// UseConditionalRequests keeps the manifests and catalogs fetched with Get in dir with their
+// ETags. The next request for one sends If-None-Match, and a 304 Not Modified returns the kept copy.
+func UseConditionalRequests(dir string) {
+    conditionalDir = dir
+}
+
+// conditionalPath returns where the body of a URL is kept, its ETag is kept next to it
+func conditionalPath(url string) string {
+    sum := sha256.Sum256([]byte(url))
+    return filepath.Join(conditionalDir, hex.EncodeToString(sum[:16]))
+}
+
+// conditionalETag returns the ETag of the kept body of a URL, or "" when there is none
+func conditionalETag(url string) string {
+    if conditionalDir == "" {
+        return ""
+    }
+    path := conditionalPath(url)
+    etag, err := os.ReadFile(path + ".etag")
+    if err != nil || !fileExists(path) {
+        return ""
+    }
+    return strings.TrimSpace(string(etag))
+}
+
+// conditionalBody returns the kept body of a URL, for a 304 Not Modified
+func conditionalBody(url string) ([]byte, error) {
+    return os.ReadFile(conditionalPath(url))
+}
+
+// keepConditional keeps the body of a URL with its ETag. A response without an ETag
+// removes what was kept, so it is requested in full the next time.
+func keepConditional(url, etag string, body []byte) {
+    if conditionalDir == "" {
+        return
+    }
+    path := conditionalPath(url)
+    if etag == "" {
+        os.Remove(path + ".etag")
+        os.Remove(path)
+        return
+    }
+    // The ETag goes last, so it never belongs to a body that wasn't written
+    os.Remove(path + ".etag")
+    if err := Store(path, body); err != nil {
+        logging.Debug("Unable to keep the body for conditional requests:", url, err)
+        return
+    }
+    os.Remove(path + backupSuffix)
+    if err := os.WriteFile(path+".etag", []byte(etag), 0644); err != nil {
+        logging.Debug("Unable to keep the ETag for conditional requests:", url, err)
+    }
+}
@@ -0,0 +1,66 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestGetConditional validates a body with an ETag is requested again with If-None-Match,
+// and the kept copy is returned for a 304 Not Modified
+func TestGetConditional(t *testing.T) {
+	origDir := conditionalDir
+	t.Cleanup(func() { conditionalDir = origDir })
+	UseConditionalRequests(t.TempDir())
+
+	var requests []string
+	var full int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("name: site_default\n"))
+	}))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		body, err := Get(server.URL + "/manifests/site_default.yaml")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if string(body) != "name: site_default\n" {
+			t.Errorf("request %d: unexpected body %q", i, body)
+		}
+	}
+	if len(requests) != 2 || requests[0] != "" || requests[1] != `"v1"` || full != 1 {
+		t.Errorf("expected one full and one conditional request, got %q", requests)
+	}
+}
+
+// TestGetWithoutConditional validates no If-None-Match is sent when conditional requests are off
+func TestGetWithoutConditional(t *testing.T) {
+	origDir := conditionalDir
+	t.Cleanup(func() { conditionalDir = origDir })
+	UseConditionalRequests("")
+
+	var conditional bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = conditional || r.Header.Get("If-None-Match") != ""
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("catalog"))
+	}))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := Get(server.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conditional {
+		t.Error("If-None-Match was sent with conditional requests off")
+	}
+}
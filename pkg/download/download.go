@@ -1,17 +1,25 @@
 package download
 
 import (
+    "bytes"
+    "compress/gzip"
     "crypto/sha256"
     "encoding/hex"
+    "errors"
     "fmt"
     "io"
     "net/http"
     "os"
     "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
     "time"
 
     "github.com/windowsadmins/gorilla/pkg/logging"
+    "github.com/windowsadmins/gorilla/pkg/progress"
     "github.com/windowsadmins/gorilla/pkg/retry"
+    "github.com/windowsadmins/gorilla/pkg/utils"
 )
 
 const (
@@ -20,90 +28,322 @@ const (
     Timeout             = 10 * time.Second
 )
 
-// DownloadFile handles downloading files with resumable capability and caching verification
+// partialSuffix is added to files while they are written, so a file is only ever
+// in place under its own name once it is complete
+const partialSuffix = ".partial"
+
+// ErrDiskFull is returned for a download that filled the disk, which isn't retried
+var ErrDiskFull = errors.New("disk full")
+
+var (
+    // How failed downloads are retried
+    retryConfig = retry.RetryConfig{MaxRetries: 3, InitialInterval: time.Second, Multiplier: 2.0, Jitter: 0.2}
+
+    // diskFull is the first download of the run that filled the disk
+    diskFull   error
+    diskFullMu sync.Mutex
+
+    // These abstractions allows us to override when testing
+    cacheDir    = CachePath
+    openPartial = func(path string) (*os.File, error) {
+        return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    }
+)
+
+// DiskFull returns the error of the first download of the run that filled the disk, or nil.
+// The run stops starting items once a download fills the disk, they would fail the same way.
+func DiskFull() error {
+    diskFullMu.Lock()
+    defer diskFullMu.Unlock()
+    return diskFull
+}
+
+// recordDiskFull keeps the first download that filled the disk and returns its error
+func recordDiskFull(url string, needed int64) error {
+    err := fmt.Errorf("%w while downloading %s", ErrDiskFull, url)
+    if needed > 0 {
+        err = fmt.Errorf("%w while downloading %s (needed %d MB)", ErrDiskFull, url, (needed+1<<20-1)>>20)
+    }
+    diskFullMu.Lock()
+    defer diskFullMu.Unlock()
+    if diskFull == nil {
+        diskFull = err
+    }
+    return err
+}
+
+// fileWriter keeps the error of writing to the file, to tell it apart from
+// an error reading the response
+type fileWriter struct {
+    w   io.Writer
+    err error
+}
+
+func (f *fileWriter) Write(p []byte) (int, error) {
+    n, err := f.w.Write(p)
+    if err != nil {
+        f.err = err
+    }
+    return n, err
+}
+
+// contentRangeTotal returns the start and the complete size of a 206 Partial Content response
+// from its `Content-Range: bytes <start>-<end>/<size>` header. size is -1 when the server doesn't know it.
+func contentRangeTotal(header string) (start, size int64, err error) {
+    spec := strings.TrimPrefix(strings.TrimSpace(header), "bytes ")
+    i, j := strings.Index(spec, "-"), strings.Index(spec, "/")
+    if i < 0 || j < i {
+        return 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+    }
+    if start, err = strconv.ParseInt(spec[:i], 10, 64); err != nil {
+        return 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+    }
+    if spec[j+1:] == "*" {
+        return start, -1, nil
+    }
+    if size, err = strconv.ParseInt(spec[j+1:], 10, 64); err != nil {
+        return 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+    }
+    return start, size, nil
+}
+
+// DownloadFile handles downloading files with resumable capability and caching verification.
+// The download is written to `<dest>.partial` and only renamed into place once it is
+// complete and synced to disk, so an interrupted download never looks like a valid file.
 func DownloadFile(url, dest string) error {
-    config := retry.RetryConfig{MaxRetries: 3, InitialInterval: time.Second, Multiplier: 2.0}
-    return retry.Retry(config, func() error {
-        logging.LogDownloadStart(url)
-        os.MkdirAll(CachePath, 0755)
-        cachedFilePath := filepath.Join(CachePath, filepath.Base(dest))
+    return DownloadVerified(url, dest, "")
+}
+
+// DownloadVerified downloads a file the same way as DownloadFile, and only renames it into place
+// when its SHA256 matches hash. A corrupt download is removed and tried again. No hash is checked when hash is empty.
+func DownloadVerified(url, dest, hash string) error {
+    return retry.Retry(retryConfig, func() error {
+        return downloadOnce(url, dest, hash, true, true)
+    })
+}
 
-        // Check if the cached file exists and is valid
+// Fetch downloads a URL to dest the same way as DownloadFile, resuming and retrying,
+// but without the client's download cache, for the tools that run on an admin's machine
+func Fetch(url, dest string) error {
+    return retry.Retry(retryConfig, func() error {
+        return downloadOnce(url, dest, "", false, true)
+    })
+}
+
+// FetchPublic downloads a URL to dest the same way as Fetch, without the repo credentials,
+// for installers downloaded from a vendor
+func FetchPublic(url, dest string) error {
+    return retry.Retry(retryConfig, func() error {
+        return downloadOnce(url, dest, "", false, false)
+    })
+}
+
+// downloadOnce makes one attempt at a download, using and filling the download cache when cached is set.
+// When hash is set, only a download or cached copy with that SHA256 is used. The repo credentials
+// are only sent when authenticated is set.
+func downloadOnce(url, dest, hash string, cached, authenticated bool) error {
+    logging.LogDownloadStart(url)
+    cachedFilePath := filepath.Join(cacheDir, filepath.Base(dest))
+
+    // Check if the cached file exists and is valid
+    if cached {
+        os.MkdirAll(cacheDir, 0755)
         if fileExists(cachedFilePath) {
-            if isValidCache(cachedFilePath) {
+            if isValidCache(cachedFilePath) && (hash == "" || Verify(cachedFilePath, hash)) {
                 logging.LogVerification(cachedFilePath, "Valid")
-                return copyFile(cachedFilePath, dest)
+                return utils.LinkOrCopy(cachedFilePath, dest)
             }
             logging.LogVerification(cachedFilePath, "Expired or Invalid")
         }
+    }
 
-        // Open the destination file with append mode for resumable download
-        out, err := os.OpenFile(dest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-        if err != nil {
-            logging.Error("Failed to open destination file:", err)
-            return fmt.Errorf("failed to open destination file: %v", err)
-        }
-        defer out.Close()
+    // Open the partial file with append mode for resumable download
+    partialPath := dest + partialSuffix
+    out, err := openPartial(partialPath)
+    if err != nil {
+        logging.Error("Failed to open destination file:", err)
+        return fmt.Errorf("failed to open destination file: %v", err)
+    }
+    defer out.Close()
 
-        // Get file size for resuming
-        existingFileSize, err := out.Seek(0, io.SeekEnd)
-        if err != nil {
-            logging.Error("Failed to get existing file size:", err)
-            return fmt.Errorf("failed to get existing file size: %v", err)
+    // Get file size for resuming
+    existingFileSize, err := out.Seek(0, io.SeekEnd)
+    if err != nil {
+        logging.Error("Failed to get existing file size:", err)
+        return fmt.Errorf("failed to get existing file size: %v", err)
+    }
+
+    // Create request with Range header
+    client := &http.Client{}
+    req, err := http.NewRequest("GET", url, nil)
+    if authenticated {
+        client = utils.NewClient(0)
+        req, err = utils.NewAuthenticatedRequest("GET", url, nil)
+    }
+    if err != nil {
+        logging.Error("Failed to create HTTP request:", err)
+        return fmt.Errorf("failed to create HTTP request: %v", err)
+    }
+    if existingFileSize > 0 {
+        req.Header.Set("Range", fmt.Sprintf("bytes=%d-", existingFileSize))
+    }
+
+    resp, err := client.Do(req)
+    if err != nil {
+        logging.Error("Failed to download file:", err)
+        return fmt.Errorf("failed to download file: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+        logging.Error("Unexpected HTTP status code:", resp.StatusCode)
+        return fmt.Errorf("unexpected HTTP status code: %d", resp.StatusCode)
+    }
+
+    // A server that ignores the Range header sends the whole file again
+    if resp.StatusCode == http.StatusOK && existingFileSize > 0 {
+        logging.Debug("Server did not resume the download, starting again:", url)
+        if err := out.Truncate(0); err != nil {
+            return fmt.Errorf("failed to restart the download: %v", err)
         }
+        existingFileSize = 0
+    }
 
-        // Create request with Range header
-        req, err := http.NewRequest("GET", url, nil)
+    // The complete size is the Content-Length, or the size in the Content-Range of a resume
+    total := int64(-1)
+    if resp.ContentLength >= 0 {
+        total = existingFileSize + resp.ContentLength
+    }
+    if contentRange := resp.Header.Get("Content-Range"); resp.StatusCode == http.StatusPartialContent && contentRange != "" {
+        start, size, err := contentRangeTotal(contentRange)
         if err != nil {
-            logging.Error("Failed to create HTTP request:", err)
-            return fmt.Errorf("failed to create HTTP request: %v", err)
+            return err
         }
-        if existingFileSize > 0 {
-            req.Header.Set("Range", fmt.Sprintf("bytes=%d-", existingFileSize))
+        // A resume from anywhere else would leave a gap or a repeat in the file, so it starts again
+        if start != existingFileSize {
+            logging.Error("The server resumed the download at the wrong offset:", url, start, existingFileSize)
+            out.Close()
+            os.Remove(partialPath)
+            return fmt.Errorf("the server resumed the download at byte %d instead of %d", start, existingFileSize)
         }
-
-        resp, err := http.DefaultClient.Do(req)
-        if err != nil {
-            logging.Error("Failed to download file:", err)
-            return fmt.Errorf("failed to download file: %v", err)
+        if size >= 0 {
+            total = size
         }
-        defer resp.Body.Close()
+    }
 
-        logging.LogDownloadComplete(dest)
+    // Write the response body to the partial file, hashing it for any MD5 headers
+    md5Check, err := newMD5Check(resp.Header, partialPath, existingFileSize > 0)
+    if err != nil {
+        logging.Error("Failed to prepare the MD5 check:", err)
+        return err
+    }
+    // UIs are sent the progress, counting what an earlier attempt downloaded
+    body := progress.Download(url, resp.Body, existingFileSize, total)
+    file := &fileWriter{w: out}
+    written, err := io.Copy(file, io.TeeReader(body, md5Check))
+    switch {
+    case file.err != nil && utils.IsDiskFull(file.err):
+        // Nothing is gained by keeping part of a file on a full disk
+        out.Close()
+        os.Remove(partialPath)
+        diskErr := recordDiskFull(url, total)
+        logging.Error("Disk full while downloading:", url, file.err)
+        return retry.Permanent(diskErr)
+    case file.err != nil:
+        logging.Error("Failed to write downloaded data to file:", file.err)
+        return fmt.Errorf("failed to write downloaded data to file: %v", file.err)
+    case err != nil:
+        // What arrived is kept, the next attempt resumes from it
+        logging.Error("Download interrupted:", url, err)
+        return fmt.Errorf("download interrupted after %d bytes: %v", existingFileSize+written, err)
+    }
 
-        if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-            logging.Error("Unexpected HTTP status code:", resp.StatusCode)
-            return fmt.Errorf("unexpected HTTP status code: %d", resp.StatusCode)
-        }
+    // Make sure everything the server said it would send arrived
+    if total >= 0 && existingFileSize+written != total {
+        logging.Error("Incomplete download:", url, existingFileSize+written, total)
+        return fmt.Errorf("incomplete download: received %d of %d bytes", existingFileSize+written, total)
+    }
+
+    // A corrupt transfer can't be resumed, so it is removed and the next attempt starts again
+    if err := md5Check.verify(); err != nil {
+        logging.Error("Download failed the MD5 check:", url, err)
+        out.Close()
+        os.Remove(partialPath)
+        return err
+    }
+
+    // Sync the file to disk before it is renamed into place
+    if err := out.Sync(); err != nil {
+        return fmt.Errorf("failed to sync the downloaded file: %v", err)
+    }
+    if err := out.Close(); err != nil {
+        return fmt.Errorf("failed to close the downloaded file: %v", err)
+    }
+    if hash != "" && !Verify(partialPath, hash) {
+        logging.Error("Download failed the SHA256 check:", url)
+        os.Remove(partialPath)
+        return fmt.Errorf("the download does not match the SHA256 %s", hash)
+    }
+    if err := os.Rename(partialPath, dest); err != nil {
+        logging.Error("Failed to move the downloaded file into place:", err)
+        return fmt.Errorf("failed to move the downloaded file into place: %v", err)
+    }
+    logging.LogDownloadComplete(dest)
+
+    // Cache the downloaded file
+    if !cached {
+        return nil
+    }
+    if err := utils.LinkOrCopy(dest, cachedFilePath); err != nil {
+        logging.Error("Failed to cache the downloaded file:", err)
+        return fmt.Errorf("failed to cache the downloaded file: %v", err)
+    }
 
-        // Write the response body to the destination file
-        _, err = io.Copy(out, resp.Body)
+    return nil
+}
+
+// SweepPartial removes the partial files of downloads and copies that were interrupted
+// more than a day ago, which a crash or power loss can leave behind
+func SweepPartial(root string) {
+    cutoff := time.Now().Add(-24 * time.Hour)
+    err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
         if err != nil {
-            logging.Error("Failed to write downloaded data to file:", err)
-            return fmt.Errorf("failed to write downloaded data to file: %v", err)
+            return nil
         }
-
-        // Cache the downloaded file
-        if err := copyFile(dest, cachedFilePath); err != nil {
-            logging.Error("Failed to cache the downloaded file:", err)
-            return fmt.Errorf("failed to cache the downloaded file: %v", err)
+        if info.IsDir() || filepath.Ext(path) != partialSuffix || !info.ModTime().Before(cutoff) {
+            return nil
+        }
+        logging.Info("Removing interrupted download:", path)
+        if err := os.Remove(path); err != nil {
+            logging.Warn("Unable to remove interrupted download:", path, err)
         }
-
         return nil
     })
+    if err != nil {
+        logging.Warn("Unable to sweep interrupted downloads:", root, err)
+    }
 }
 
-// Get downloads a URL and returns the body as a byte slice, with a 10-second timeout
+// Get downloads a URL and returns the body as a byte slice, with a 10-second timeout.
+// The body is always returned decompressed, whether the server gzip encoded the response
+// or the URL is a `.gz` file, so anything hashed or parsed is the original content.
 func Get(url string) ([]byte, error) {
-    client := &http.Client{
-        Timeout: Timeout,
-    }
+    client := utils.NewClient(Timeout)
 
     // Build the request
-    req, err := http.NewRequest("GET", url, nil)
+    req, err := utils.NewAuthenticatedRequest("GET", url, nil)
     if err != nil {
         return nil, err
     }
+    // Setting this ourselves turns off the transport's own decompression, so the
+    // response is decompressed below
+    req.Header.Set("Accept-Encoding", "gzip")
+
+    // Ask for the body only if it changed since it was kept
+    etag := conditionalETag(url)
+    if etag != "" {
+        req.Header.Set("If-None-Match", etag)
+    }
 
     // Actually send the request, using the client we set up
     resp, err := client.Do(req)
@@ -112,6 +352,15 @@ func Get(url string) ([]byte, error) {
     }
     defer resp.Body.Close()
 
+    if resp.StatusCode == http.StatusNotModified && etag != "" {
+        body, err := conditionalBody(url)
+        if err != nil {
+            return nil, fmt.Errorf("%s: not modified, but the kept copy is unreadable: %v", url, err)
+        }
+        logging.Debug("Not modified since it was kept:", url)
+        return body, nil
+    }
+
     // Check that the request was successful
     if resp.StatusCode != http.StatusOK {
         return nil, fmt.Errorf("%s: download status code: %d", url, resp.StatusCode)
@@ -123,9 +372,37 @@ func Get(url string) ([]byte, error) {
         return nil, err
     }
 
+    if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+        if body, err = gunzip(body); err != nil {
+            return nil, fmt.Errorf("%s: unable to decompress the response: %v", url, err)
+        }
+    }
+    // A `.gz` file may also have been served with Content-Encoding set, and is then already decompressed
+    if strings.HasSuffix(strings.ToLower(req.URL.Path), ".gz") && isGzip(body) {
+        if body, err = gunzip(body); err != nil {
+            return nil, fmt.Errorf("%s: unable to decompress: %v", url, err)
+        }
+    }
+
+    keepConditional(url, resp.Header.Get("ETag"), body)
     return body, nil
 }
 
+// isGzip returns true if data starts with the gzip magic number
+func isGzip(data []byte) bool {
+    return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// gunzip returns the decompressed content of gzip data
+func gunzip(data []byte) ([]byte, error) {
+    zr, err := gzip.NewReader(bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    return io.ReadAll(zr)
+}
+
 // Verify compares the actual hash of a file with the provided hash
 func Verify(file string, expectedHash string) bool {
     f, err := os.Open(file)
@@ -154,7 +431,7 @@ func IfNeeded(filePath, url, hash string) bool {
 
     if !verified {
         logging.Info("Downloading", url, "to", filePath)
-        err := DownloadFile(url, filePath)
+        err := DownloadVerified(url, filePath, hash)
         if err != nil {
             logging.Warn("Unable to retrieve package:", url, err)
             return false
@@ -204,23 +481,6 @@ func calculateHash(path string) string {
     return hex.EncodeToString(hasher.Sum(nil))
 }
 
-func copyFile(src, dest string) error {
-    input, err := os.Open(src)
-    if err != nil {
-        return err
-    }
-    defer input.Close()
-
-    output, err := os.Create(dest)
-    if err != nil {
-        return err
-    }
-    defer output.Close()
-
-    _, err = io.Copy(output, input)
-    return err
-}
-
 // getStoredHash retrieves the stored hash from a .hash file next to the given path.
 func getStoredHash(path string) string {
     hashFile := path + ".hash"
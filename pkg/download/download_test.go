@@ -0,0 +1,474 @@
+package download
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var payload = bytes.Repeat([]byte("gorilla payload "), 1024)
+
+// useCache points the download cache at a temporary directory for the duration of the test
+func useCache(t *testing.T) string {
+	origCache := cacheDir
+	t.Cleanup(func() { cacheDir = origCache })
+	cacheDir = t.TempDir()
+	return cacheDir
+}
+
+// payloadServer serves the payload, honoring Range requests when ranges is true
+func payloadServer(t *testing.T, ranges bool) (*httptest.Server, *[]string) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader := r.Header.Get("Range")
+		requested = append(requested, rangeHeader)
+		if ranges && strings.HasPrefix(rangeHeader, "bytes=") {
+			start, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rangeHeader, "bytes="), "-"))
+			w.Header().Set("Content-Length", strconv.Itoa(len(payload)-start))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(payload)-1, len(payload)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(payload[start:])
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		w.Write(payload)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requested
+}
+
+// checkDownloaded validates dest and its cache copy hold the payload, with no partial files left
+func checkDownloaded(t *testing.T, dest, cache string) {
+	t.Helper()
+	for _, path := range []string{dest, filepath.Join(cache, filepath.Base(dest))} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, payload) {
+			t.Errorf("%s: expected %d bytes of payload, got %d bytes", path, len(payload), len(data))
+		}
+		if _, err := os.Stat(path + partialSuffix); !os.IsNotExist(err) {
+			t.Errorf("%s: partial file left behind", path)
+		}
+	}
+}
+
+// TestDownloadFile validates a download is renamed into place and cached
+func TestDownloadFile(t *testing.T) {
+	cache := useCache(t)
+	server, _ := payloadServer(t, true)
+	dest := filepath.Join(t.TempDir(), "Example.msi")
+
+	if err := DownloadFile(server.URL+"/Example.msi", dest); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, cache)
+}
+
+// TestFetch validates a fetched file is renamed into place without touching the download cache
+func TestFetch(t *testing.T) {
+	cache := useCache(t)
+	server, _ := payloadServer(t, true)
+	dest := filepath.Join(t.TempDir(), "Example.msi")
+
+	if err := Fetch(server.URL+"/Example.msi", dest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Errorf("expected %d bytes of payload, got %d bytes", len(payload), len(data))
+	}
+	if entries, _ := os.ReadDir(cache); len(entries) != 0 {
+		t.Errorf("expected the download cache to be left alone, got %v", entries)
+	}
+}
+
+// TestDownloadFileResume validates an interrupted download is resumed from its partial file
+func TestDownloadFileResume(t *testing.T) {
+	cache := useCache(t)
+	server, requested := payloadServer(t, true)
+	dest := filepath.Join(t.TempDir(), "Example.msi")
+	if err := os.WriteFile(dest+partialSuffix, payload[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DownloadFile(server.URL+"/Example.msi", dest); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, cache)
+	if len(*requested) != 1 || (*requested)[0] != "bytes=1000-" {
+		t.Errorf("expected the download to resume at 1000, got %v", *requested)
+	}
+}
+
+// TestDownloadFileRangeIgnored validates the download starts again when the server sends the whole file
+func TestDownloadFileRangeIgnored(t *testing.T) {
+	cache := useCache(t)
+	server, _ := payloadServer(t, false)
+	dest := filepath.Join(t.TempDir(), "Example.msi")
+	if err := os.WriteFile(dest+partialSuffix, payload[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DownloadFile(server.URL+"/Example.msi", dest); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, cache)
+}
+
+// TestDownloadFileTruncated validates a response cut short of its Content-Length is retried,
+// resuming from what arrived
+func TestDownloadFileTruncated(t *testing.T) {
+	fastRetries(t)
+	cache := useCache(t)
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Header.Get("Range"))
+		if len(requested) == 1 {
+			// The connection drops after 1000 bytes of the promised payload
+			w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(payload[:1000])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 1000-%d/%d", len(payload)-1, len(payload)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)-1000))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(payload[1000:])
+	}))
+	t.Cleanup(server.Close)
+	dest := filepath.Join(t.TempDir(), "Example.msi")
+
+	if err := DownloadFile(server.URL+"/Example.msi", dest); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, cache)
+	if len(requested) != 2 || requested[1] != "bytes=1000-" {
+		t.Errorf("expected the second attempt to resume at 1000, got %v", requested)
+	}
+}
+
+// TestDownloadFileContentRange validates a resume is checked against its Content-Range,
+// and a resume at the wrong offset starts the download again
+func TestDownloadFileContentRange(t *testing.T) {
+	fastRetries(t)
+	tests := []struct {
+		name         string
+		contentRange string
+	}{
+		{"wrong offset", fmt.Sprintf("bytes 0-%d/%d", len(payload)-1001, len(payload))},
+		{"wrong size", fmt.Sprintf("bytes 1000-%d/%d", len(payload)-1, len(payload)+10)},
+	}
+	for _, tt := range tests {
+		useCache(t)
+		var requested []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, r.Header.Get("Range"))
+			w.Header().Set("Content-Range", tt.contentRange)
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(payload[1000:])
+		}))
+		dest := filepath.Join(t.TempDir(), "Example.msi")
+		if err := os.WriteFile(dest+partialSuffix, payload[:1000], 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := DownloadFile(server.URL+"/Example.msi", dest); err == nil {
+			t.Errorf("%s: expected the download to fail", tt.name)
+		}
+		if len(requested) != retryConfig.MaxRetries {
+			t.Errorf("%s: expected %d requests, got %d", tt.name, retryConfig.MaxRetries, len(requested))
+		}
+		if tt.name == "wrong offset" && requested[1] != "" {
+			t.Errorf("%s: expected the partial file to be removed, the next attempt asked for %q", tt.name, requested[1])
+		}
+		server.Close()
+	}
+}
+
+// TestDownloadFileDiskFull validates a download that fills the disk isn't retried,
+// leaves no partial file and is kept for the rest of the run
+func TestDownloadFileDiskFull(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	fastRetries(t)
+	useCache(t)
+	origOpen := openPartial
+	t.Cleanup(func() {
+		openPartial = origOpen
+		diskFull = nil
+	})
+	openPartial = func(path string) (*os.File, error) {
+		os.WriteFile(path, nil, 0644)
+		return os.OpenFile("/dev/full", os.O_WRONLY, 0)
+	}
+	server, requested := payloadServer(t, true)
+	dest := filepath.Join(t.TempDir(), "Example.msi")
+
+	err := DownloadFile(server.URL+"/Example.msi", dest)
+	if !errors.Is(err, ErrDiskFull) {
+		t.Fatalf("expected a disk full error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "needed 1 MB") {
+		t.Errorf("expected the space needed in %q", err)
+	}
+	if len(*requested) != 1 {
+		t.Errorf("expected 1 request, got %d", len(*requested))
+	}
+	if _, err := os.Stat(dest + partialSuffix); !os.IsNotExist(err) {
+		t.Error("partial file left behind")
+	}
+	if DiskFull() != err {
+		t.Errorf("expected the run to keep the error, got %v", DiskFull())
+	}
+}
+
+// TestSweepPartial validates only partial files older than a day are removed
+func TestSweepPartial(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	files := map[string]bool{
+		filepath.Join(root, "apps", "old.msi.partial"): false,
+		filepath.Join(root, "apps", "new.msi.partial"): true,
+		filepath.Join(root, "apps", "old.msi"):         true,
+		filepath.Join(root, "Example.nupkg.partial"):   false,
+	}
+	for path := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(path, "new") {
+			os.Chtimes(path, old, old)
+		}
+	}
+
+	SweepPartial(root)
+
+	for path, kept := range files {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("%s: expected kept %v", path, kept)
+		}
+	}
+}
+
+// md5Server serves the payload with the given MD5 headers on each request in turn, the last one repeating
+func md5Server(t *testing.T, headers ...map[string]string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := headers[len(headers)-1]
+		if requests < len(headers) {
+			header = headers[requests]
+		}
+		requests++
+		for name, value := range header {
+			w.Header().Set(name, value)
+		}
+		w.Write(payload)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// fastRetries shortens the waits between download attempts for the duration of the test
+func fastRetries(t *testing.T) {
+	origRetry := retryConfig
+	t.Cleanup(func() { retryConfig = origRetry })
+	retryConfig.InitialInterval = time.Millisecond
+}
+
+// TestDownloadFileMD5 validates downloads matching their MD5 headers are kept
+func TestDownloadFileMD5(t *testing.T) {
+	fastRetries(t)
+	sum := md5.Sum(payload)
+	right := base64.StdEncoding.EncodeToString(sum[:])
+
+	for _, name := range []string{"Content-MD5", "x-ms-blob-content-md5"} {
+		cache := useCache(t)
+		server, requests := md5Server(t, map[string]string{name: right})
+		dest := filepath.Join(t.TempDir(), "Example.msi")
+
+		if err := DownloadFile(server.URL+"/Example.msi", dest); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkDownloaded(t, dest, cache)
+		if *requests != 1 {
+			t.Errorf("%s: expected 1 request, got %d", name, *requests)
+		}
+	}
+}
+
+// TestDownloadFileMD5Mismatch validates a corrupt transfer is retried, and fails when it stays corrupt
+func TestDownloadFileMD5Mismatch(t *testing.T) {
+	fastRetries(t)
+	sum := md5.Sum(payload)
+	right := map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(sum[:])}
+	wrongSum := md5.Sum([]byte("something else"))
+	wrong := map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(wrongSum[:])}
+
+	// The first attempt is corrupt, the second is right
+	cache := useCache(t)
+	server, requests := md5Server(t, wrong, right)
+	dest := filepath.Join(t.TempDir(), "Example.msi")
+	if err := DownloadFile(server.URL+"/Example.msi", dest); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, cache)
+	if *requests != 2 {
+		t.Errorf("expected 2 requests, got %d", *requests)
+	}
+
+	// Every attempt is corrupt
+	useCache(t)
+	server, requests = md5Server(t, wrong)
+	dest = filepath.Join(t.TempDir(), "Example.msi")
+	if err := DownloadFile(server.URL+"/Example.msi", dest); err == nil {
+		t.Fatal("expected the download to fail")
+	}
+	if *requests != retryConfig.MaxRetries {
+		t.Errorf("expected %d requests, got %d", retryConfig.MaxRetries, *requests)
+	}
+	for _, path := range []string{dest, dest + partialSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: corrupt download left behind", path)
+		}
+	}
+}
+
+// TestDownloadVerified validates a download is only renamed into place when its SHA256 matches,
+// and a cached copy that doesn't match is downloaded again
+func TestDownloadVerified(t *testing.T) {
+	fastRetries(t)
+	sum := sha256.Sum256(payload)
+	hash := hex.EncodeToString(sum[:])
+
+	cache := useCache(t)
+	if err := os.WriteFile(filepath.Join(cache, "Example.msi"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server, requests := payloadServer(t, true)
+	dest := filepath.Join(t.TempDir(), "Example.msi")
+	if err := DownloadVerified(server.URL+"/Example.msi", dest, hash); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, cache)
+	if len(*requests) != 1 {
+		t.Errorf("expected the stale cached copy downloaded again, got %d requests", len(*requests))
+	}
+
+	useCache(t)
+	*requests = nil
+	dest = filepath.Join(t.TempDir(), "Example.msi")
+	if err := DownloadVerified(server.URL+"/Example.msi", dest, strings.Repeat("0", 64)); err == nil {
+		t.Fatal("expected the download to fail the SHA256 check")
+	}
+	if len(*requests) != retryConfig.MaxRetries {
+		t.Errorf("expected %d requests, got %d", retryConfig.MaxRetries, len(*requests))
+	}
+	for _, path := range []string{dest, dest + partialSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: download that failed the SHA256 check left behind", path)
+		}
+	}
+}
+
+// TestDownloadFileBlobMD5Resume validates the blob MD5 covers the bytes of a resumed download
+func TestDownloadFileBlobMD5Resume(t *testing.T) {
+	cache := useCache(t)
+	sum := md5.Sum(payload)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-blob-content-md5", base64.StdEncoding.EncodeToString(sum[:]))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(payload[1000:])
+	}))
+	t.Cleanup(server.Close)
+	dest := filepath.Join(t.TempDir(), "Example.msi")
+	if err := os.WriteFile(dest+partialSuffix, payload[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DownloadFile(server.URL+"/Example.msi", dest); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest, cache)
+}
+
+// gzipped returns data compressed with gzip
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestGetGzip validates Get asks for gzip and returns the decompressed content,
+// whether the response is gzip encoded, a .gz file, or both
+func TestGetGzip(t *testing.T) {
+	compressed := gzipped(t, payload)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("%s: expected Accept-Encoding gzip, got %q", r.URL.Path, r.Header.Get("Accept-Encoding"))
+		}
+		switch r.URL.Path {
+		case "/encoded.yaml", "/encoded.yaml.gz":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed)
+		case "/All.yaml.gz":
+			w.Write(compressed)
+		default:
+			w.Write(payload)
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/plain.yaml", "/encoded.yaml", "/All.yaml.gz", "/encoded.yaml.gz"} {
+		body, err := Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if !bytes.Equal(body, payload) {
+			t.Errorf("%s: expected %d bytes of payload, got %d bytes", path, len(payload), len(body))
+		}
+	}
+}
+
+// TestGetGzipCorrupt validates a .gz file that doesn't decompress is an error
+func TestGetGzipCorrupt(t *testing.T) {
+	compressed := gzipped(t, payload)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(compressed[:len(compressed)/2])
+	}))
+	defer server.Close()
+
+	if _, err := Get(server.URL + "/All.yaml.gz"); err == nil {
+		t.Errorf("expected an error for a truncated .gz file")
+	}
+}
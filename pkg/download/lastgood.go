@@ -0,0 +1,70 @@
+package download
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+
+    "github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// backupSuffix is added to the previous copy of a stored file, its last known good copy
+const backupSuffix = ".bak"
+
+// Store writes data to path for the next time it can't be downloaded. The data is written
+// to `<path>.partial` and synced before it is renamed into place, and the copy it replaces
+// is kept as `<path>.bak`, so a run that dies while storing never leaves a truncated file.
+// Only store data that was parsed successfully.
+func Store(path string, data []byte) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return err
+    }
+
+    partialPath := path + partialSuffix
+    output, err := os.Create(partialPath)
+    if err != nil {
+        return err
+    }
+    defer output.Close()
+
+    if _, err := output.Write(data); err != nil {
+        os.Remove(partialPath)
+        return err
+    }
+    if err := output.Sync(); err != nil {
+        os.Remove(partialPath)
+        return err
+    }
+    if err := output.Close(); err != nil {
+        os.Remove(partialPath)
+        return err
+    }
+
+    if _, err := os.Stat(path); err == nil {
+        if err := os.Rename(path, path+backupSuffix); err != nil {
+            os.Remove(partialPath)
+            return err
+        }
+    }
+    return os.Rename(partialPath, path)
+}
+
+// LastGood returns the copy of a file stored at path, or its `.bak` copy when that
+// one is missing or doesn't parse
+func LastGood(path string, parse func([]byte) error) ([]byte, error) {
+    var lastErr error
+    for _, candidate := range []string{path, path + backupSuffix} {
+        data, err := os.ReadFile(candidate)
+        if err != nil {
+            lastErr = err
+            continue
+        }
+        if err := parse(data); err != nil {
+            logging.Warn("Unable to parse stored copy:", candidate, err)
+            lastErr = err
+            continue
+        }
+        return data, nil
+    }
+    return nil, fmt.Errorf("no usable stored copy of %s: %v", filepath.Base(path), lastErr)
+}
@@ -0,0 +1,63 @@
+package download
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseComplete accepts data that ends with the "end" line, as a truncated file doesn't
+func parseComplete(data []byte) error {
+	if !strings.HasSuffix(string(data), "end\n") {
+		return errors.New("truncated")
+	}
+	return nil
+}
+
+// TestStore validates the stored copy is replaced whole and the previous one kept as .bak
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalogs", "production.yaml")
+	for _, content := range []string{"first\nend\n", "second\nend\n"} {
+		if err := Store(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, expected := range map[string]string{path: "second\nend\n", path + backupSuffix: "first\nend\n"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s: expected %q, got %q", file, expected, data)
+		}
+	}
+	if _, err := os.Stat(path + partialSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial file left behind")
+	}
+}
+
+// TestLastGood validates a stored copy that was truncated falls back to the .bak
+func TestLastGood(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "production.yaml")
+	if _, err := LastGood(path, parseComplete); err == nil {
+		t.Errorf("expected an error without a stored copy")
+	}
+
+	os.WriteFile(path+backupSuffix, []byte("first\nend\n"), 0644)
+	os.WriteFile(path, []byte("second\ne"), 0644)
+	data, err := LastGood(path, parseComplete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first\nend\n" {
+		t.Errorf("expected the .bak copy, got %q", data)
+	}
+
+	os.WriteFile(path, []byte("second\nend\n"), 0644)
+	if data, _ := LastGood(path, parseComplete); string(data) != "second\nend\n" {
+		t.Errorf("expected the stored copy, got %q", data)
+	}
+}
@@ -0,0 +1,90 @@
+package download
+
+import (
+    "bytes"
+    "crypto/md5"
+    "encoding/base64"
+    "fmt"
+    "hash"
+    "io"
+    "net/http"
+    "os"
+
+    "github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+const (
+    // contentMD5Header is the MD5 of the body sent, from S3 and other object stores
+    contentMD5Header = "Content-MD5"
+    // azureBlobMD5Header is the MD5 of the whole blob, which Azure also sends for ranges
+    azureBlobMD5Header = "x-ms-blob-content-md5"
+)
+
+// md5Check compares the MD5 hashes an object store sends in the response headers
+// with the bytes received, hashing them as they are written to the file
+type md5Check struct {
+    bodyWant, blobWant []byte
+    body, blob         hash.Hash
+}
+
+// headerMD5 decodes a base64 MD5 header, ignoring missing and malformed values
+func headerMD5(header http.Header, name string) []byte {
+    value := header.Get(name)
+    if value == "" {
+        return nil
+    }
+    sum, err := base64.StdEncoding.DecodeString(value)
+    if err != nil || len(sum) != md5.Size {
+        logging.Warn("Ignoring an invalid MD5 header:", name, value)
+        return nil
+    }
+    return sum
+}
+
+// newMD5Check prepares the checks for the MD5 headers of a response. When a download is
+// resumed the blob MD5 covers the bytes already in the partial file too, so they are hashed first.
+func newMD5Check(header http.Header, partialPath string, resumed bool) (*md5Check, error) {
+    c := &md5Check{
+        bodyWant: headerMD5(header, contentMD5Header),
+        blobWant: headerMD5(header, azureBlobMD5Header),
+    }
+    if c.bodyWant != nil {
+        c.body = md5.New()
+    }
+    if c.blobWant != nil {
+        c.blob = md5.New()
+        if resumed {
+            partial, err := os.Open(partialPath)
+            if err != nil {
+                return nil, fmt.Errorf("failed to hash the partial download: %v", err)
+            }
+            defer partial.Close()
+            if _, err := io.Copy(c.blob, partial); err != nil {
+                return nil, fmt.Errorf("failed to hash the partial download: %v", err)
+            }
+        }
+    }
+    return c, nil
+}
+
+// Write hashes the bytes received
+func (c *md5Check) Write(p []byte) (int, error) {
+    if c.body != nil {
+        c.body.Write(p)
+    }
+    if c.blob != nil {
+        c.blob.Write(p)
+    }
+    return len(p), nil
+}
+
+// verify returns an error if what was received doesn't match an MD5 header
+func (c *md5Check) verify() error {
+    if c.body != nil && !bytes.Equal(c.body.Sum(nil), c.bodyWant) {
+        return fmt.Errorf("%s mismatch: the download is corrupt", contentMD5Header)
+    }
+    if c.blob != nil && !bytes.Equal(c.blob.Sum(nil), c.blobWant) {
+        return fmt.Errorf("%s mismatch: the download is corrupt", azureBlobMD5Header)
+    }
+    return nil
+}
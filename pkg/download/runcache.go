@@ -0,0 +1,36 @@
+package download
+
+import (
+    "sync"
+
+    "github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+var (
+    // runCache holds the bodies fetched with GetOnce in this run, by URL
+    runCache   = make(map[string][]byte)
+    runCacheMu sync.Mutex
+
+    // This abstraction allows us to override when testing
+    runGet = Get
+)
+
+// GetOnce returns the body at url like Get, but downloads it only once per run. A catalog
+// or manifest asked for again in the same run, such as a catalog listed twice in the
+// `catalogs` of the configuration, uses the body already downloaded. Failed downloads
+// are not kept, so they are tried again.
+func GetOnce(url string) ([]byte, error) {
+    runCacheMu.Lock()
+    defer runCacheMu.Unlock()
+
+    if body, ok := runCache[url]; ok {
+        logging.Debug("Already downloaded in this run:", url)
+        return body, nil
+    }
+    body, err := runGet(url)
+    if err != nil {
+        return nil, err
+    }
+    runCache[url] = body
+    return body, nil
+}
@@ -0,0 +1,74 @@
+package download
+
+import (
+    "errors"
+    "testing"
+)
+
+// countingGet counts the downloads of each URL, failing those in fail
+type countingGet struct {
+    counts map[string]int
+    fail   map[string]bool
+}
+
+// use overrides the download for the duration of the test
+func (c *countingGet) use(t *testing.T) {
+    origGet, origCache := runGet, runCache
+    t.Cleanup(func() {
+        runGet, runCache = origGet, origCache
+    })
+    runCache = make(map[string][]byte)
+    c.counts = make(map[string]int)
+    runGet = func(url string) ([]byte, error) {
+        c.counts[url]++
+        if c.fail[url] {
+            return nil, errors.New("connection reset")
+        }
+        return []byte("body of " + url), nil
+    }
+}
+
+// TestGetOnce validates a URL is downloaded at most once per run
+func TestGetOnce(t *testing.T) {
+    fake := &countingGet{}
+    fake.use(t)
+
+    urls := []string{
+        "https://example.com/manifests/site.yaml",
+        "https://example.com/catalogs/production.yaml",
+        "https://example.com/manifests/site.yaml",
+        "https://example.com/catalogs/production.yaml",
+    }
+    for _, url := range urls {
+        body, err := GetOnce(url)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if string(body) != "body of "+url {
+            t.Errorf("unexpected body for %s: %q", url, body)
+        }
+    }
+    for url, count := range fake.counts {
+        if count != 1 {
+            t.Errorf("expected %s to be downloaded once, got %d", url, count)
+        }
+    }
+}
+
+// TestGetOnceFailure validates a failed download is tried again
+func TestGetOnceFailure(t *testing.T) {
+    url := "https://example.com/catalogs/testing.yaml"
+    fake := &countingGet{fail: map[string]bool{url: true}}
+    fake.use(t)
+
+    if _, err := GetOnce(url); err == nil {
+        t.Fatalf("expected the download to fail")
+    }
+    fake.fail[url] = false
+    if _, err := GetOnce(url); err != nil {
+        t.Fatal(err)
+    }
+    if fake.counts[url] != 2 {
+        t.Errorf("expected the failed download to be tried again, got %d downloads", fake.counts[url])
+    }
+}
@@ -0,0 +1,114 @@
+// pkg/extract/arch.go
+
+package extract
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Architecture names, matching the supported_architectures of pkgsinfo
+const (
+	ArchX86     = "x86"
+	ArchX64     = "x86_64"
+	ArchARM     = "arm"
+	ArchARM64   = "arm64"
+	ArchUnknown = "unknown"
+)
+
+// NormalizeArch returns the name supported_architectures uses for an architecture,
+// so x64 and amd64 are both x86_64
+func NormalizeArch(arch string) string {
+	switch strings.ToLower(strings.TrimSpace(arch)) {
+	case "x86_64", "x64", "amd64":
+		return ArchX64
+	case "x86", "386", "i386", "i686":
+		return ArchX86
+	case "arm64", "aarch64":
+		return ArchARM64
+	default:
+		return strings.ToLower(strings.TrimSpace(arch))
+	}
+}
+
+// peMachineArch maps the COFF header machine field to an architecture
+var peMachineArch = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  ArchX86,
+	pe.IMAGE_FILE_MACHINE_AMD64: ArchX64,
+	pe.IMAGE_FILE_MACHINE_ARMNT: ArchARM,
+	pe.IMAGE_FILE_MACHINE_ARM64: ArchARM64,
+}
+
+// msiPlatformArch maps the platform in the MSI Template property to an architecture
+var msiPlatformArch = map[string]string{
+	"intel": ArchX86,
+	"x64":   ArchX64,
+	"amd64": ArchX64,
+	"arm":   ArchARM,
+	"arm64": ArchARM64,
+}
+
+// BinaryArch returns the architecture an EXE, DLL or MSI was built for.
+// The PE header is read for EXEs and DLLs, the Template summary property for MSIs.
+// Scripts and other files return ArchUnknown without an error.
+func BinaryArch(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ArchUnknown, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(cfbSignature))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return ArchUnknown, nil
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		return peArch(f)
+	case bytes.Equal(magic, cfbSignature):
+		return msiArch(path)
+	default:
+		return ArchUnknown, nil
+	}
+}
+
+// peArch reads the machine field of the COFF header the DOS header points to
+func peArch(r io.ReaderAt) (string, error) {
+	var offset [4]byte
+	if _, err := r.ReadAt(offset[:], 0x3C); err != nil {
+		return ArchUnknown, fmt.Errorf("truncated DOS header")
+	}
+
+	var header [6]byte
+	if _, err := r.ReadAt(header[:], int64(binary.LittleEndian.Uint32(offset[:]))); err != nil {
+		return ArchUnknown, fmt.Errorf("truncated PE header")
+	}
+	if !bytes.Equal(header[:4], []byte("PE\x00\x00")) {
+		return ArchUnknown, fmt.Errorf("missing PE signature")
+	}
+
+	machine := binary.LittleEndian.Uint16(header[4:])
+	if arch, ok := peMachineArch[machine]; ok {
+		return arch, nil
+	}
+	return ArchUnknown, fmt.Errorf("unsupported machine type 0x%04X", machine)
+}
+
+// msiArch reads the platform from the Template summary property, such as "x64;1033".
+// An empty platform means Intel.
+func msiArch(msiPath string) (string, error) {
+	summary, err := MsiSummary(msiPath)
+	if err != nil {
+		return ArchUnknown, err
+	}
+	arch, err := summary.Arch()
+	if err != nil {
+		return ArchUnknown, fmt.Errorf("%s: %v", msiPath, err)
+	}
+	return arch, nil
+}
@@ -0,0 +1,84 @@
+package extract
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePEHeader writes a minimal DOS and COFF header for a machine type
+func writePEHeader(t *testing.T, machine uint16) string {
+	t.Helper()
+	data := make([]byte, 0x40+24)
+	copy(data, "MZ")
+	binary.LittleEndian.PutUint32(data[0x3C:], 0x40)
+	copy(data[0x40:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(data[0x44:], machine)
+
+	path := filepath.Join(t.TempDir(), "setup.exe")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestBinaryArchPE validates the machine field of hand-built headers
+func TestBinaryArchPE(t *testing.T) {
+	tests := map[uint16]string{
+		pe.IMAGE_FILE_MACHINE_I386:  ArchX86,
+		pe.IMAGE_FILE_MACHINE_AMD64: ArchX64,
+		pe.IMAGE_FILE_MACHINE_ARM64: ArchARM64,
+		pe.IMAGE_FILE_MACHINE_ARMNT: ArchARM,
+	}
+	for machine, expected := range tests {
+		arch, err := BinaryArch(writePEHeader(t, machine))
+		if err != nil {
+			t.Errorf("0x%04X: unexpected error: %v", machine, err)
+		}
+		if arch != expected {
+			t.Errorf("0x%04X: expected %s, got %s", machine, expected, arch)
+		}
+	}
+
+	arch, err := BinaryArch(writePEHeader(t, pe.IMAGE_FILE_MACHINE_IA64))
+	if err == nil || arch != ArchUnknown {
+		t.Errorf("expected an error for IA64, got %s, %v", arch, err)
+	}
+}
+
+// TestBinaryArchFixtures validates the architecture of the EXE and MSI fixtures
+func TestBinaryArchFixtures(t *testing.T) {
+	tests := map[string]string{
+		"pwsh.exe":          ArchX64,
+		"ClassLibrary1.dll": ArchX86,
+		"dummy.msi":         ArchX86,
+		"dummy-x64.msi":     ArchX64,
+	}
+	for name, expected := range tests {
+		arch, err := BinaryArch(filepath.Join("testdata", name))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+		if arch != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, arch)
+		}
+	}
+}
+
+// TestBinaryArchScript validates scripts are unknown without an error
+func TestBinaryArchScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "install.ps1")
+	if err := os.WriteFile(path, []byte("Write-Host 'Installing'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	arch, err := BinaryArch(path)
+	if err != nil || arch != ArchUnknown {
+		t.Errorf("expected unknown without an error, got %s, %v", arch, err)
+	}
+	if _, err := BinaryArch(filepath.Join("testdata", "missing.exe")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
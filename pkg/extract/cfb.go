@@ -0,0 +1,269 @@
+// pkg/extract/cfb.go
+
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Compound File Binary constants, see [MS-CFB]
+const (
+	cfbFreeSector   = 0xFFFFFFFF
+	cfbEndOfChain   = 0xFFFFFFFE
+	cfbNoStream     = 0xFFFFFFFF
+	cfbHeaderSize   = 512
+	cfbDirEntrySize = 128
+	cfbTypeStream   = 2
+	cfbTypeRoot     = 5
+)
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// compoundFile is a read-only view of the streams in the root storage
+// of a compound file, the container format of MSI databases
+type compoundFile struct {
+	data           []byte
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint32
+	fat            []uint32
+	miniFAT        []uint32
+	miniStream     []byte
+	streams        map[string]cfbEntry
+}
+
+// cfbEntry is a directory entry
+type cfbEntry struct {
+	name        string
+	kind        byte
+	left        uint32
+	right       uint32
+	child       uint32
+	startSector uint32
+	size        uint64
+}
+
+// openCompoundFile parses the header, allocation tables and directory of a compound file
+func openCompoundFile(data []byte) (*compoundFile, error) {
+	if len(data) < cfbHeaderSize || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, fmt.Errorf("not a compound file")
+	}
+
+	sectorShift := binary.LittleEndian.Uint16(data[0x1E:])
+	miniSectorShift := binary.LittleEndian.Uint16(data[0x20:])
+	if sectorShift != 9 && sectorShift != 12 || miniSectorShift != 6 {
+		return nil, fmt.Errorf("unsupported sector size")
+	}
+
+	cf := &compoundFile{
+		data:           data,
+		sectorSize:     1 << sectorShift,
+		miniSectorSize: 1 << miniSectorShift,
+		miniCutoff:     binary.LittleEndian.Uint32(data[0x38:]),
+		streams:        make(map[string]cfbEntry),
+	}
+	if err := cf.readFAT(); err != nil {
+		return nil, err
+	}
+
+	entries, err := cf.readDirectory(binary.LittleEndian.Uint32(data[0x30:]))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].kind != cfbTypeRoot {
+		return nil, fmt.Errorf("missing root entry")
+	}
+
+	// The root entry owns the mini stream that holds the small streams
+	root := entries[0]
+	cf.miniStream, err = cf.readChain(root.startSector, root.size, cf.fat, cf.sectorSize, cf.sector)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read mini stream: %v", err)
+	}
+	miniFATStart := binary.LittleEndian.Uint32(data[0x3C:])
+	if miniFATStart != cfbEndOfChain {
+		table, err := cf.readChain(miniFATStart, 0, cf.fat, cf.sectorSize, cf.sector)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read mini FAT: %v", err)
+		}
+		cf.miniFAT = toUint32s(table)
+	}
+
+	// Only the streams directly in the root storage are needed
+	visited := make(map[uint32]bool)
+	var walk func(id uint32) error
+	walk = func(id uint32) error {
+		if id == cfbNoStream {
+			return nil
+		}
+		if int(id) >= len(entries) || visited[id] {
+			return fmt.Errorf("invalid directory tree")
+		}
+		visited[id] = true
+		entry := entries[id]
+		if entry.kind == cfbTypeStream {
+			cf.streams[entry.name] = entry
+		}
+		if err := walk(entry.left); err != nil {
+			return err
+		}
+		return walk(entry.right)
+	}
+	if err := walk(root.child); err != nil {
+		return nil, err
+	}
+
+	return cf, nil
+}
+
+// readFAT collects the FAT sectors listed in the header and the DIFAT chain
+func (cf *compoundFile) readFAT() error {
+	numFATSectors := binary.LittleEndian.Uint32(cf.data[0x2C:])
+	var fatSectors []uint32
+	for i := 0; i < 109 && uint32(len(fatSectors)) < numFATSectors; i++ {
+		fatSectors = append(fatSectors, binary.LittleEndian.Uint32(cf.data[0x4C+i*4:]))
+	}
+
+	difat := binary.LittleEndian.Uint32(cf.data[0x44:])
+	perSector := cf.sectorSize/4 - 1
+	for seen := 0; difat != cfbEndOfChain && difat != cfbFreeSector && uint32(len(fatSectors)) < numFATSectors; seen++ {
+		sector, err := cf.sector(difat)
+		if err != nil || seen > len(cf.data)/cf.sectorSize {
+			return fmt.Errorf("invalid DIFAT chain")
+		}
+		for i := 0; i < perSector && uint32(len(fatSectors)) < numFATSectors; i++ {
+			fatSectors = append(fatSectors, binary.LittleEndian.Uint32(sector[i*4:]))
+		}
+		difat = binary.LittleEndian.Uint32(sector[perSector*4:])
+	}
+
+	for _, id := range fatSectors {
+		sector, err := cf.sector(id)
+		if err != nil {
+			return fmt.Errorf("invalid FAT sector: %v", err)
+		}
+		cf.fat = append(cf.fat, toUint32s(sector)...)
+	}
+	return nil
+}
+
+// readDirectory reads every directory entry
+func (cf *compoundFile) readDirectory(start uint32) ([]cfbEntry, error) {
+	data, err := cf.readChain(start, 0, cf.fat, cf.sectorSize, cf.sector)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read directory: %v", err)
+	}
+
+	var entries []cfbEntry
+	for offset := 0; offset+cfbDirEntrySize <= len(data); offset += cfbDirEntrySize {
+		raw := data[offset : offset+cfbDirEntrySize]
+		nameLen := int(binary.LittleEndian.Uint16(raw[64:]))
+		if nameLen > 64 {
+			nameLen = 64
+		}
+		name := make([]uint16, 0, 32)
+		for i := 0; i+1 < nameLen; i += 2 {
+			c := binary.LittleEndian.Uint16(raw[i:])
+			if c == 0 {
+				break
+			}
+			name = append(name, c)
+		}
+		entries = append(entries, cfbEntry{
+			name:        string(utf16.Decode(name)),
+			kind:        raw[66],
+			left:        binary.LittleEndian.Uint32(raw[68:]),
+			right:       binary.LittleEndian.Uint32(raw[72:]),
+			child:       binary.LittleEndian.Uint32(raw[76:]),
+			startSector: binary.LittleEndian.Uint32(raw[116:]),
+			size:        binary.LittleEndian.Uint64(raw[120:]),
+		})
+	}
+
+	// Version 3 files only use the low 32 bits of the size
+	if cf.sectorSize == 512 {
+		for i := range entries {
+			entries[i].size &= 0xFFFFFFFF
+		}
+	}
+	return entries, nil
+}
+
+// stream returns the content of a stream in the root storage
+func (cf *compoundFile) stream(name string) ([]byte, bool, error) {
+	entry, ok := cf.streams[name]
+	if !ok {
+		return nil, false, nil
+	}
+	var data []byte
+	var err error
+	if entry.size < uint64(cf.miniCutoff) {
+		data, err = cf.readChain(entry.startSector, entry.size, cf.miniFAT, cf.miniSectorSize, cf.miniSector)
+	} else {
+		data, err = cf.readChain(entry.startSector, entry.size, cf.fat, cf.sectorSize, cf.sector)
+	}
+	return data, true, err
+}
+
+// sector returns a regular sector
+func (cf *compoundFile) sector(id uint32) ([]byte, error) {
+	offset := (int64(id) + 1) * int64(cf.sectorSize)
+	if id >= cfbEndOfChain-1 || offset+int64(cf.sectorSize) > int64(len(cf.data)) {
+		// The last sector may be truncated in files written by some tools
+		if offset < int64(len(cf.data)) && id < cfbEndOfChain-1 {
+			padded := make([]byte, cf.sectorSize)
+			copy(padded, cf.data[offset:])
+			return padded, nil
+		}
+		return nil, fmt.Errorf("sector %d out of range", id)
+	}
+	return cf.data[offset : offset+int64(cf.sectorSize)], nil
+}
+
+// miniSector returns a sector of the mini stream
+func (cf *compoundFile) miniSector(id uint32) ([]byte, error) {
+	offset := int64(id) * int64(cf.miniSectorSize)
+	if offset+int64(cf.miniSectorSize) > int64(len(cf.miniStream)) {
+		return nil, fmt.Errorf("mini sector %d out of range", id)
+	}
+	return cf.miniStream[offset : offset+int64(cf.miniSectorSize)], nil
+}
+
+// readChain follows a sector chain through an allocation table.
+// A size of 0 reads the whole chain.
+func (cf *compoundFile) readChain(start uint32, size uint64, table []uint32, sectorSize int, read func(uint32) ([]byte, error)) ([]byte, error) {
+	var out []byte
+	for id, count := start, 0; id != cfbEndOfChain; count++ {
+		if size > 0 && uint64(len(out)) >= size {
+			break
+		}
+		if int(id) >= len(table) || count > len(table) {
+			return nil, fmt.Errorf("invalid sector chain")
+		}
+		sector, err := read(id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sector...)
+		id = table[id]
+	}
+	if size > 0 {
+		if uint64(len(out)) < size {
+			return nil, fmt.Errorf("stream is truncated")
+		}
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// toUint32s converts little endian bytes to integers
+func toUint32s(data []byte) []uint32 {
+	values := make([]uint32, len(data)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	return values
+}
@@ -0,0 +1,186 @@
+// pkg/extract/exe.go
+
+package extract
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// fixedFileInfoSignature starts the VS_FIXEDFILEINFO value
+const fixedFileInfoSignature = 0xFEEF04BD
+
+// ExeInfo is the version information of an EXE or DLL
+type ExeInfo struct {
+	ProductName     string
+	ProductVersion  string
+	FileVersion     string
+	CompanyName     string
+	FileDescription string
+	Comments        string
+}
+
+// versionNode is a node of the VS_VERSIONINFO tree
+type versionNode struct {
+	key      string
+	value    []byte
+	text     bool
+	children []versionNode
+}
+
+// ExeMetadata reads the version resource of an EXE or DLL. The resource is parsed
+// directly rather than through version.dll, so it works the same on any OS.
+func ExeMetadata(exePath string) (ExeInfo, error) {
+	f, err := pe.Open(exePath)
+	if err != nil {
+		return ExeInfo{}, err
+	}
+	defer f.Close()
+
+	resources, err := peResources(f)
+	if err != nil {
+		return ExeInfo{}, fmt.Errorf("%s: %v", exePath, err)
+	}
+	for _, r := range resources {
+		if r.kind == rtVersion {
+			info, err := parseVersionInfo(r.data)
+			if err != nil {
+				return ExeInfo{}, fmt.Errorf("%s: %v", exePath, err)
+			}
+			return info, nil
+		}
+	}
+	return ExeInfo{}, fmt.Errorf("%s has no version resource", exePath)
+}
+
+// parseVersionInfo reads the fixed file version and the strings of a VS_VERSIONINFO resource.
+// The US English string table is preferred, otherwise the first one is used.
+func parseVersionInfo(data []byte) (ExeInfo, error) {
+	root, _, err := parseVersionNode(data, 0)
+	if err != nil {
+		return ExeInfo{}, err
+	}
+	if root.key != "VS_VERSION_INFO" {
+		return ExeInfo{}, fmt.Errorf("invalid version resource")
+	}
+
+	var info ExeInfo
+	var productVersion string
+	if len(root.value) >= 52 && binary.LittleEndian.Uint32(root.value) == fixedFileInfoSignature {
+		info.FileVersion = fixedVersion(root.value[8:])
+		productVersion = fixedVersion(root.value[16:])
+	}
+
+	var table *versionNode
+	for _, child := range root.children {
+		if child.key != "StringFileInfo" {
+			continue
+		}
+		for i := range child.children {
+			if table == nil || strings.HasPrefix(strings.ToLower(child.children[i].key), "0409") {
+				table = &child.children[i]
+			}
+		}
+	}
+
+	strs := make(map[string]string)
+	if table != nil {
+		for _, s := range table.children {
+			strs[s.key] = decodeUTF16(s.value)
+		}
+	}
+	info.ProductName = strs["ProductName"]
+	info.ProductVersion = strs["ProductVersion"]
+	info.CompanyName = strs["CompanyName"]
+	info.FileDescription = strs["FileDescription"]
+	info.Comments = strs["Comments"]
+
+	// The fixed product version is only used when there is no string for it
+	if info.ProductVersion == "" {
+		info.ProductVersion = productVersion
+	}
+	if info.FileVersion == "" {
+		info.FileVersion = strs["FileVersion"]
+	}
+	return info, nil
+}
+
+// parseVersionNode reads a node and its children, returning the offset after it.
+// Each node is a length, value length, type and key, then the value and children
+// aligned to 32 bits.
+func parseVersionNode(data []byte, offset int) (versionNode, int, error) {
+	if offset+6 > len(data) {
+		return versionNode{}, 0, fmt.Errorf("version resource is truncated")
+	}
+	length := int(binary.LittleEndian.Uint16(data[offset:]))
+	valueLength := int(binary.LittleEndian.Uint16(data[offset+2:]))
+	node := versionNode{text: binary.LittleEndian.Uint16(data[offset+4:]) == 1}
+	end := offset + length
+	if length < 6 || end > len(data) {
+		return versionNode{}, 0, fmt.Errorf("version resource is truncated")
+	}
+
+	// The key is a NUL terminated UTF-16 string
+	pos := offset + 6
+	var key []uint16
+	for ; pos+1 < end; pos += 2 {
+		c := binary.LittleEndian.Uint16(data[pos:])
+		if c == 0 {
+			pos += 2
+			break
+		}
+		key = append(key, c)
+	}
+	node.key = string(utf16.Decode(key))
+	pos = align4(pos)
+
+	// Text values are measured in characters
+	if node.text {
+		valueLength *= 2
+	}
+	if pos+valueLength > end {
+		valueLength = end - pos
+	}
+	if valueLength > 0 {
+		node.value = data[pos : pos+valueLength]
+		pos += valueLength
+	}
+
+	for pos = align4(pos); pos < end; pos = align4(pos) {
+		child, next, err := parseVersionNode(data, pos)
+		if err != nil {
+			return versionNode{}, 0, err
+		}
+		node.children = append(node.children, child)
+		pos = next
+	}
+	return node, end, nil
+}
+
+// fixedVersion formats a version stored as two DWORDs, most significant first
+func fixedVersion(data []byte) string {
+	ms := binary.LittleEndian.Uint32(data)
+	ls := binary.LittleEndian.Uint32(data[4:])
+	return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xFFFF, ls>>16, ls&0xFFFF)
+}
+
+// decodeUTF16 converts a little endian UTF-16 value, dropping the NUL terminator
+func decodeUTF16(data []byte) string {
+	chars := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			break
+		}
+		chars = append(chars, c)
+	}
+	return strings.TrimSpace(string(utf16.Decode(chars)))
+}
+
+// align4 rounds an offset up to a multiple of 4
+func align4(offset int) int {
+	return (offset + 3) &^ 3
+}
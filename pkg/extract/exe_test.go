@@ -0,0 +1,69 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestExeMetadata validates the version resource of the fixtures is read the same on every OS
+func TestExeMetadata(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected ExeInfo
+	}{
+		{
+			path: filepath.Join("testdata", "pwsh.exe"),
+			expected: ExeInfo{
+				ProductName:     "PowerShell",
+				ProductVersion:  "7.3.4 SHA: b59f05d5a1b2fceca231f75c53c203a02edf6203",
+				FileVersion:     "7.3.4.500",
+				CompanyName:     "Microsoft Corporation",
+				FileDescription: "pwsh",
+				Comments:        "PowerShell on Windows top-level project",
+			},
+		},
+		{
+			path: filepath.Join("testdata", "ClassLibrary1.dll"),
+			expected: ExeInfo{
+				ProductName:     "ClassLibrary1",
+				ProductVersion:  "1.0.0.0",
+				FileVersion:     "1.0.0.0",
+				FileDescription: "ClassLibrary1",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		info, err := ExeMetadata(test.path)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.path, err)
+			continue
+		}
+		if info != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.path, test.expected, info)
+		}
+	}
+}
+
+// TestExeMetadataInvalid validates files that are not PEs return an error
+func TestExeMetadataInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.exe")
+	if err := os.WriteFile(path, []byte("MZ not really"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ExeMetadata(path); err == nil {
+		t.Errorf("expected an error for an invalid EXE")
+	}
+	if _, err := ExeMetadata(filepath.Join("testdata", "dummy.msi")); err == nil {
+		t.Errorf("expected an error for an MSI")
+	}
+}
+
+// TestParseVersionInfoTruncated validates a truncated resource returns an error
+func TestParseVersionInfoTruncated(t *testing.T) {
+	if _, err := parseVersionInfo([]byte{0xFF, 0x00, 0x34, 0x00}); err == nil {
+		t.Errorf("expected an error for a truncated resource")
+	}
+}
@@ -0,0 +1,281 @@
+// pkg/extract/icon.go
+
+package extract
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// iconEntry is an image in an icon directory
+type iconEntry struct {
+	width    int
+	height   int
+	bitCount int
+	id       int // resource id in a group, offset in an ICO file
+	size     int
+}
+
+// ExeIcon returns the largest image of the first icon group of an EXE or DLL, encoded as PNG
+func ExeIcon(exePath string) ([]byte, error) {
+	data, err := os.ReadFile(exePath)
+	if err != nil {
+		return nil, err
+	}
+	return iconFromPE(data)
+}
+
+// MsiIcon returns the product icon of an MSI encoded as PNG. The icon named by
+// ARPPRODUCTICON is used, or the first one in the Icon table.
+func MsiIcon(msiPath string) ([]byte, error) {
+	db, err := openMsi(msiPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.table("Icon")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s has no icons", msiPath)
+	}
+
+	name := rows[0].String("Name")
+	if properties, err := db.properties(); err == nil && properties["ARPPRODUCTICON"] != "" {
+		name = properties["ARPPRODUCTICON"]
+	}
+
+	// Binary columns are stored in a stream named after the table and key
+	data, ok, err := db.stream("Icon." + name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s: icon %s not found", msiPath, name)
+	}
+
+	// Icons are stored as ICO files or as the EXE or DLL they came from
+	if bytes.HasPrefix(data, []byte("MZ")) {
+		return iconFromPE(data)
+	}
+	return iconFromICO(data)
+}
+
+// iconFromPE reads the icon resources of a PE file
+func iconFromPE(data []byte) ([]byte, error) {
+	f, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	resources, err := peResources(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// The shell shows the first icon group
+	var group []byte
+	icons := make(map[int][]byte)
+	for _, r := range resources {
+		switch {
+		case r.kind == rtGroupIcon && group == nil:
+			group = r.data
+		case r.kind == rtIcon:
+			icons[r.id] = r.data
+		}
+	}
+	if group == nil {
+		return nil, fmt.Errorf("no icon resources")
+	}
+
+	entries, err := parseIconDir(group, 14)
+	if err != nil {
+		return nil, err
+	}
+	best := largestIcon(entries)
+	data, ok := icons[best.id]
+	if !ok {
+		return nil, fmt.Errorf("icon %d is missing", best.id)
+	}
+	return iconImageToPNG(data)
+}
+
+// iconFromICO reads an ICO file
+func iconFromICO(data []byte) ([]byte, error) {
+	entries, err := parseIconDir(data, 16)
+	if err != nil {
+		return nil, err
+	}
+	best := largestIcon(entries)
+	if best.id < 0 || best.id+best.size > len(data) {
+		return nil, fmt.Errorf("icon image is truncated")
+	}
+	return iconImageToPNG(data[best.id : best.id+best.size])
+}
+
+// parseIconDir reads the entries of an ICO file (16 byte entries with an offset)
+// or an icon group resource (14 byte entries with a resource id)
+func parseIconDir(data []byte, entrySize int) ([]iconEntry, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, fmt.Errorf("invalid icon directory")
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if count == 0 || 6+count*entrySize > len(data) {
+		return nil, fmt.Errorf("invalid icon directory")
+	}
+
+	entries := make([]iconEntry, count)
+	for i := range entries {
+		raw := data[6+i*entrySize:]
+		entry := iconEntry{
+			width:    int(raw[0]),
+			height:   int(raw[1]),
+			bitCount: int(binary.LittleEndian.Uint16(raw[6:])),
+			size:     int(binary.LittleEndian.Uint32(raw[8:])),
+		}
+		// A size of 0 means 256 pixels
+		if entry.width == 0 {
+			entry.width = 256
+		}
+		if entry.height == 0 {
+			entry.height = 256
+		}
+		if entrySize == 14 {
+			entry.id = int(binary.LittleEndian.Uint16(raw[12:]))
+		} else {
+			entry.id = int(binary.LittleEndian.Uint32(raw[12:]))
+		}
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+// largestIcon picks the entry with the most pixels, then the most colors
+func largestIcon(entries []iconEntry) iconEntry {
+	best := entries[0]
+	for _, entry := range entries[1:] {
+		pixels, bestPixels := entry.width*entry.height, best.width*best.height
+		if pixels > bestPixels || pixels == bestPixels && entry.bitCount > best.bitCount {
+			best = entry
+		}
+	}
+	return best
+}
+
+// iconImageToPNG converts an icon image to PNG. Large icons are often
+// stored as PNG already, the others are bitmaps with an AND mask.
+func iconImageToPNG(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, pngSignature) {
+		if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("invalid PNG icon: %v", err)
+		}
+		return data, nil
+	}
+
+	img, err := decodeIconBitmap(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeIconBitmap decodes a BITMAPINFOHEADER image followed by its AND mask.
+// The height in the header covers both, so the image is half as tall.
+func decodeIconBitmap(data []byte) (*image.NRGBA, error) {
+	if len(data) < 40 || binary.LittleEndian.Uint32(data) < 40 {
+		return nil, fmt.Errorf("invalid icon bitmap")
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bitCount := int(binary.LittleEndian.Uint16(data[14:]))
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:]))
+	if width <= 0 || height <= 0 || width > 1024 || height > 1024 {
+		return nil, fmt.Errorf("invalid icon size %dx%d", width, height)
+	}
+
+	// Images with 8 bits or less per pixel index a palette
+	var palette []color.NRGBA
+	offset := headerSize
+	if bitCount <= 8 {
+		if colorsUsed == 0 {
+			colorsUsed = 1 << bitCount
+		}
+		if offset+colorsUsed*4 > len(data) {
+			return nil, fmt.Errorf("icon palette is truncated")
+		}
+		for i := 0; i < colorsUsed; i++ {
+			c := data[offset+i*4:]
+			palette = append(palette, color.NRGBA{R: c[2], G: c[1], B: c[0], A: 0xFF})
+		}
+		offset += colorsUsed * 4
+	}
+
+	stride := (width*bitCount + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	if offset+stride*height > len(data) {
+		return nil, fmt.Errorf("icon bitmap is truncated")
+	}
+	pixels := data[offset : offset+stride*height]
+	var mask []byte
+	if end := offset + stride*height + maskStride*height; end <= len(data) {
+		mask = data[offset+stride*height : end]
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		// Rows are stored bottom up
+		row := pixels[(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch bitCount {
+			case 32:
+				c = color.NRGBA{R: row[x*4+2], G: row[x*4+1], B: row[x*4], A: row[x*4+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{R: row[x*3+2], G: row[x*3+1], B: row[x*3], A: 0xFF}
+			case 8, 4, 1:
+				bit := x * bitCount
+				index := int(row[bit/8]>>(8-bitCount-bit%8)) & (1<<bitCount - 1)
+				if index < len(palette) {
+					c = palette[index]
+				}
+			default:
+				return nil, fmt.Errorf("unsupported icon bit count %d", bitCount)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	// Without an alpha channel, transparency comes from the AND mask
+	if !hasAlpha && mask != nil {
+		for y := 0; y < height; y++ {
+			row := mask[(height-1-y)*maskStride:]
+			for x := 0; x < width; x++ {
+				c := img.NRGBAAt(x, y)
+				c.A = 0xFF
+				if row[x/8]&(0x80>>(x%8)) != 0 {
+					c.A = 0
+				}
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+
+	return img, nil
+}
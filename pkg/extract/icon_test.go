@@ -0,0 +1,239 @@
+package extract
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"path/filepath"
+	"testing"
+)
+
+// makeIconBitmap builds a bottom up icon bitmap with an AND mask.
+// pixel returns the BGRA bytes of a pixel, masked reports if the AND mask hides it.
+func makeIconBitmap(width, height, bitCount int, pixel func(x, y int) []byte, masked func(x, y int) bool) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 40)
+	binary.LittleEndian.PutUint32(header, 40)
+	binary.LittleEndian.PutUint32(header[4:], uint32(width))
+	binary.LittleEndian.PutUint32(header[8:], uint32(height*2))
+	binary.LittleEndian.PutUint16(header[12:], 1)
+	binary.LittleEndian.PutUint16(header[14:], uint16(bitCount))
+	buf.Write(header)
+
+	stride := (width*bitCount + 31) / 32 * 4
+	for y := height - 1; y >= 0; y-- {
+		row := make([]byte, stride)
+		for x := 0; x < width; x++ {
+			copy(row[x*bitCount/8:], pixel(x, y)[:bitCount/8])
+		}
+		buf.Write(row)
+	}
+
+	maskStride := (width + 31) / 32 * 4
+	for y := height - 1; y >= 0; y-- {
+		row := make([]byte, maskStride)
+		for x := 0; x < width; x++ {
+			if masked(x, y) {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		buf.Write(row)
+	}
+	return buf.Bytes()
+}
+
+// makeICO builds an ICO file from bitmaps of the given sizes and bit counts
+func makeICO(sizes, bitCounts []int, images [][]byte) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 6)
+	binary.LittleEndian.PutUint16(header[2:], 1)
+	binary.LittleEndian.PutUint16(header[4:], uint16(len(images)))
+	buf.Write(header)
+
+	offset := 6 + 16*len(images)
+	for i, data := range images {
+		entry := make([]byte, 16)
+		entry[0], entry[1] = byte(sizes[i]), byte(sizes[i])
+		binary.LittleEndian.PutUint16(entry[4:], 1)
+		binary.LittleEndian.PutUint16(entry[6:], uint16(bitCounts[i]))
+		binary.LittleEndian.PutUint32(entry[8:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(entry[12:], uint32(offset))
+		buf.Write(entry)
+		offset += len(data)
+	}
+	for _, data := range images {
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+func decodePNG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+	return img
+}
+
+// TestExeIcon validates the largest image of the fixture's icon group is returned
+func TestExeIcon(t *testing.T) {
+	data, err := ExeIcon(filepath.Join("testdata", "pwsh.exe"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	img := decodePNG(t, data)
+	if size := img.Bounds().Size(); size.X != 256 || size.Y != 256 {
+		t.Errorf("expected a 256x256 icon, got %v", size)
+	}
+}
+
+// TestExeIconAllSizes validates every image in the fixture converts, PNG or bitmap
+func TestExeIconAllSizes(t *testing.T) {
+	f, err := pe.Open(filepath.Join("testdata", "pwsh.exe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	resources, err := peResources(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	count := 0
+	for _, r := range resources {
+		if r.kind != rtIcon {
+			continue
+		}
+		count++
+		data, err := iconImageToPNG(r.data)
+		if err != nil {
+			t.Errorf("icon %d: %v", r.id, err)
+			continue
+		}
+		decodePNG(t, data)
+	}
+	if count != 9 {
+		t.Errorf("expected 9 icons, got %d", count)
+	}
+}
+
+// TestExeIconNoIcons validates an error is returned when there is no icon to extract
+func TestExeIconNoIcons(t *testing.T) {
+	if _, err := ExeIcon(filepath.Join("testdata", "ClassLibrary1.dll")); err == nil {
+		t.Errorf("expected an error for a DLL without icons")
+	}
+	if _, err := ExeIcon(filepath.Join("testdata", "dummy.msi")); err == nil {
+		t.Errorf("expected an error for a file that is not a PE")
+	}
+}
+
+// TestMsiIconNoIcons validates an error is returned for an MSI without an Icon table
+func TestMsiIconNoIcons(t *testing.T) {
+	if _, err := MsiIcon(filepath.Join("testdata", "dummy.msi")); err == nil {
+		t.Errorf("expected an error for an MSI without icons")
+	}
+}
+
+// TestIconFromICO validates the largest size is picked and its alpha channel is kept
+func TestIconFromICO(t *testing.T) {
+	small := makeIconBitmap(16, 16, 24,
+		func(x, y int) []byte { return []byte{0xFF, 0, 0} },
+		func(x, y int) bool { return false })
+	// A horizontal alpha gradient on red, with the top row green to check the orientation
+	large := makeIconBitmap(32, 32, 32,
+		func(x, y int) []byte {
+			if y == 0 {
+				return []byte{0, 0xFF, 0, 0xFF}
+			}
+			return []byte{0, 0, 0xFF, byte(x * 8)}
+		},
+		func(x, y int) bool { return true })
+	ico := makeICO([]int{16, 32}, []int{24, 32}, [][]byte{small, large})
+
+	data, err := iconFromICO(ico)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	img := decodePNG(t, data)
+	if size := img.Bounds().Size(); size.X != 32 || size.Y != 32 {
+		t.Fatalf("expected a 32x32 icon, got %v", size)
+	}
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("expected an NRGBA image, got %T", img)
+	}
+	if c := nrgba.NRGBAAt(5, 0); c.G != 0xFF || c.R != 0 || c.A != 0xFF {
+		t.Errorf("expected an opaque green top row, got %v", c)
+	}
+	// The AND mask is ignored when the image has alpha
+	if c := nrgba.NRGBAAt(10, 10); c.R != 0xFF || c.A != 80 {
+		t.Errorf("expected red with alpha 80, got %v", c)
+	}
+}
+
+// TestIconBitmapMask validates the AND mask sets transparency for images without alpha
+func TestIconBitmapMask(t *testing.T) {
+	bitmap := makeIconBitmap(16, 16, 24,
+		func(x, y int) []byte { return []byte{0xFF, 0, 0} },
+		func(x, y int) bool { return x < 8 })
+
+	img, err := decodeIconBitmap(bitmap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := img.NRGBAAt(2, 3); c.A != 0 {
+		t.Errorf("expected a masked pixel to be transparent, got %v", c)
+	}
+	if c := img.NRGBAAt(12, 3); c.B != 0xFF || c.A != 0xFF {
+		t.Errorf("expected an opaque blue pixel, got %v", c)
+	}
+}
+
+// TestIconPalette validates 4-bit images are read through their palette
+func TestIconPalette(t *testing.T) {
+	var buf bytes.Buffer
+	header := make([]byte, 40)
+	binary.LittleEndian.PutUint32(header, 40)
+	binary.LittleEndian.PutUint32(header[4:], 8)
+	binary.LittleEndian.PutUint32(header[8:], 16)
+	binary.LittleEndian.PutUint16(header[12:], 1)
+	binary.LittleEndian.PutUint16(header[14:], 4)
+	buf.Write(header)
+	palette := make([]byte, 16*4)
+	copy(palette[4:], []byte{0, 0xFF, 0, 0}) // index 1 is green
+	buf.Write(palette)
+	// Each row has the pixels 0, 1, 0, 1, ...
+	for y := 0; y < 8; y++ {
+		buf.Write([]byte{0x01, 0x01, 0x01, 0x01})
+	}
+	buf.Write(make([]byte, 8*4))
+
+	img, err := decodeIconBitmap(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := img.NRGBAAt(1, 0); c.G != 0xFF || c.A != 0xFF {
+		t.Errorf("expected an opaque green pixel, got %v", c)
+	}
+	if c := img.NRGBAAt(0, 0); c.G != 0 || c.A != 0xFF {
+		t.Errorf("expected an opaque black pixel, got %v", c)
+	}
+}
+
+// TestIconInvalid validates truncated icons return errors
+func TestIconInvalid(t *testing.T) {
+	if _, err := iconFromICO([]byte{0, 0, 1, 0}); err == nil {
+		t.Errorf("expected an error for a truncated directory")
+	}
+	bitmap := makeIconBitmap(16, 16, 32,
+		func(x, y int) []byte { return []byte{0, 0, 0, 0xFF} },
+		func(x, y int) bool { return false })
+	if _, err := decodeIconBitmap(bitmap[:100]); err == nil {
+		t.Errorf("expected an error for a truncated bitmap")
+	}
+}
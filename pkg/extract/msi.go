@@ -0,0 +1,383 @@
+// pkg/extract/msi.go
+
+package extract
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Column type flags from the _Columns table
+const (
+	msiTypeValid     = 0x0100
+	msiTypeString    = 0x0800
+	msiTypeNullable  = 0x1000
+	msiTypeTemporary = 0x4000
+)
+
+// msiNameChars are the characters that can be packed into stream names
+const msiNameChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz._"
+
+// MsiInfo is the product information from an MSI database
+type MsiInfo struct {
+	ProductName    string
+	ProductVersion string
+	Manufacturer   string
+	Comments       string
+	ProductCode    string
+	UpgradeCode    string
+}
+
+// msiDatabase reads tables from an MSI without msi.dll, so it works the same on any OS
+type msiDatabase struct {
+	cf          *compoundFile
+	streams     map[string]string // decoded name to stored name
+	strings     []string
+	longStrRefs bool
+	columns     map[string][]msiColumn
+}
+
+// msiColumn describes a table column
+type msiColumn struct {
+	name string
+	kind int
+}
+
+// msiRow is a table row, strings and integers keyed by column name.
+// Null values are absent.
+type msiRow map[string]interface{}
+
+// String returns a string column, or "" if it is null
+func (r msiRow) String(column string) string {
+	s, _ := r[column].(string)
+	return s
+}
+
+// Int returns an integer column and whether it was set
+func (r msiRow) Int(column string) (int, bool) {
+	i, ok := r[column].(int)
+	return i, ok
+}
+
+// MsiMetadata reads the product information from the Property table
+// and the comments from the summary information.
+// On Windows, the WindowsInstaller COM object is used if the native reader fails.
+func MsiMetadata(msiPath string) (MsiInfo, error) {
+	info, err := msiMetadataNative(msiPath)
+	if err != nil {
+		fallback, fallbackErr := msiMetadataPowerShell(msiPath)
+		if fallbackErr != nil {
+			return MsiInfo{}, err
+		}
+		return fallback, nil
+	}
+	return info, nil
+}
+
+// msiMetadataNative reads the product information with the pure Go reader
+func msiMetadataNative(msiPath string) (MsiInfo, error) {
+	db, err := openMsi(msiPath)
+	if err != nil {
+		return MsiInfo{}, err
+	}
+
+	properties, err := db.properties()
+	if err != nil {
+		return MsiInfo{}, err
+	}
+
+	info := MsiInfo{
+		ProductName:    properties["ProductName"],
+		ProductVersion: properties["ProductVersion"],
+		Manufacturer:   properties["Manufacturer"],
+		Comments:       properties["ARPCOMMENTS"],
+		ProductCode:    properties["ProductCode"],
+		UpgradeCode:    properties["UpgradeCode"],
+	}
+	if summary, err := db.summaryInformation(); err == nil && summary[pidComments] != "" {
+		info.Comments = summary[pidComments]
+	}
+
+	if info.ProductName == "" && info.ProductCode == "" {
+		return MsiInfo{}, fmt.Errorf("%s: no product information in the Property table", msiPath)
+	}
+	return info, nil
+}
+
+// openMsi opens an MSI database and loads its string pool and table schemas
+func openMsi(msiPath string) (*msiDatabase, error) {
+	data, err := os.ReadFile(msiPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cf, err := openCompoundFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", msiPath, err)
+	}
+
+	db := &msiDatabase{cf: cf, streams: make(map[string]string)}
+	for stored := range cf.streams {
+		db.streams[decodeStreamName(stored)] = stored
+	}
+
+	if err := db.loadStrings(); err != nil {
+		return nil, fmt.Errorf("%s: %v", msiPath, err)
+	}
+	if err := db.loadColumns(); err != nil {
+		return nil, fmt.Errorf("%s: %v", msiPath, err)
+	}
+	return db, nil
+}
+
+// stream returns a stream by its decoded name, tables are prefixed with "!"
+func (db *msiDatabase) stream(name string) ([]byte, bool, error) {
+	stored, ok := db.streams[name]
+	if !ok {
+		return nil, false, nil
+	}
+	return db.cf.stream(stored)
+}
+
+// loadStrings reads the shared string pool that all tables reference
+func (db *msiDatabase) loadStrings() error {
+	pool, ok, err := db.stream("!_StringPool")
+	if err != nil || !ok {
+		return fmt.Errorf("unable to read the string pool")
+	}
+	data, ok, err := db.stream("!_StringData")
+	if err != nil || !ok {
+		return fmt.Errorf("unable to read the string data")
+	}
+	if len(pool) < 4 {
+		return fmt.Errorf("string pool is too short")
+	}
+
+	codepage := int(binary.LittleEndian.Uint16(pool)) | int(binary.LittleEndian.Uint16(pool[2:])&0x7FFF)<<16
+	db.longStrRefs = binary.LittleEndian.Uint16(pool[2:])&0x8000 != 0
+
+	// Id 0 is the null string
+	db.strings = []string{""}
+	offset := 0
+	count := len(pool) / 4
+	for i := 1; i < count; {
+		length := int(binary.LittleEndian.Uint16(pool[i*4:]))
+		refs := binary.LittleEndian.Uint16(pool[i*4+2:])
+
+		// Unused ids still take an entry
+		if length == 0 && refs == 0 {
+			db.strings = append(db.strings, "")
+			i++
+			continue
+		}
+
+		// Strings over 64k store the high word of the length in the entry before
+		if length == 0 {
+			if i+1 >= count {
+				return fmt.Errorf("string pool is truncated")
+			}
+			length = int(binary.LittleEndian.Uint16(pool[i*4+6:]))<<16 | int(binary.LittleEndian.Uint16(pool[i*4+4:]))
+			i += 2
+		} else {
+			i++
+		}
+
+		if offset+length > len(data) {
+			return fmt.Errorf("string data is truncated")
+		}
+		db.strings = append(db.strings, decodeCodepage(data[offset:offset+length], codepage))
+		offset += length
+	}
+	return nil
+}
+
+// loadColumns reads the schema of every table from _Columns
+func (db *msiDatabase) loadColumns() error {
+	schema := []msiColumn{
+		{"Table", msiTypeValid | msiTypeString | 64},
+		{"Number", msiTypeValid | 2},
+		{"Name", msiTypeValid | msiTypeString | 64},
+		{"Type", msiTypeValid | 2},
+	}
+	rows, err := db.readTable("_Columns", schema)
+	if err != nil {
+		return err
+	}
+
+	db.columns = make(map[string][]msiColumn)
+	for _, row := range rows {
+		kind, _ := row.Int("Type")
+		if kind&msiTypeTemporary != 0 {
+			continue
+		}
+		table := row.String("Table")
+		number, _ := row.Int("Number")
+		columns := db.columns[table]
+		for len(columns) < number {
+			columns = append(columns, msiColumn{})
+		}
+		if number > 0 {
+			columns[number-1] = msiColumn{name: row.String("Name"), kind: kind}
+		}
+		db.columns[table] = columns
+	}
+	return nil
+}
+
+// table returns the rows of a table, or nil if the database does not have it
+func (db *msiDatabase) table(name string) ([]msiRow, error) {
+	columns, ok := db.columns[name]
+	if !ok {
+		return nil, nil
+	}
+	return db.readTable(name, columns)
+}
+
+// readTable decodes a table stream. Values are stored column by column,
+// strings as indexes into the string pool and integers offset by their sign bit.
+func (db *msiDatabase) readTable(name string, columns []msiColumn) ([]msiRow, error) {
+	data, ok, err := db.stream("!" + name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read table %s: %v", name, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	rowSize := 0
+	for _, column := range columns {
+		rowSize += db.columnWidth(column.kind)
+	}
+	if rowSize == 0 {
+		return nil, fmt.Errorf("table %s has no columns", name)
+	}
+	count := len(data) / rowSize
+
+	rows := make([]msiRow, count)
+	for i := range rows {
+		rows[i] = make(msiRow)
+	}
+
+	offset := 0
+	for _, column := range columns {
+		width := db.columnWidth(column.kind)
+		for i := 0; i < count; i++ {
+			raw := readUint(data[offset+i*width:], width)
+			switch {
+			case column.kind&msiTypeString != 0 && column.kind&^msiTypeNullable != msiTypeString|msiTypeValid:
+				if raw != 0 && int(raw) < len(db.strings) {
+					rows[i][column.name] = db.strings[raw]
+				}
+			case column.kind&msiTypeString != 0:
+				// Binary columns reference a stream named after the table and key
+			case raw != 0 && width == 2:
+				rows[i][column.name] = int(int16(raw ^ 0x8000))
+			case raw != 0:
+				rows[i][column.name] = int(int32(raw ^ 0x80000000))
+			}
+		}
+		offset += width * count
+	}
+	return rows, nil
+}
+
+// columnWidth returns how many bytes a column takes in each row
+func (db *msiDatabase) columnWidth(kind int) int {
+	switch {
+	case kind&^msiTypeNullable == msiTypeString|msiTypeValid:
+		return 2
+	case kind&msiTypeString != 0 && db.longStrRefs:
+		return 3
+	case kind&msiTypeString != 0:
+		return 2
+	case kind&0xFF <= 2:
+		return 2
+	default:
+		return 4
+	}
+}
+
+// properties returns the Property table as a map
+func (db *msiDatabase) properties() (map[string]string, error) {
+	rows, err := db.table("Property")
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		return nil, fmt.Errorf("no Property table")
+	}
+
+	properties := make(map[string]string, len(rows))
+	for _, row := range rows {
+		properties[row.String("Property")] = row.String("Value")
+	}
+	return properties, nil
+}
+
+// decodeStreamName unpacks a stream name, where two name characters are stored
+// in one UTF-16 code unit. Table streams get a "!" prefix.
+func decodeStreamName(name string) string {
+	var out strings.Builder
+	for _, c := range name {
+		switch {
+		case c == 0x4840:
+			out.WriteByte('!')
+		case c >= 0x3800 && c < 0x4800:
+			c -= 0x3800
+			out.WriteByte(msiNameChars[c&0x3F])
+			out.WriteByte(msiNameChars[c>>6&0x3F])
+		case c >= 0x4800 && c < 0x4840:
+			out.WriteByte(msiNameChars[c-0x4800])
+		default:
+			out.WriteRune(c)
+		}
+	}
+	return out.String()
+}
+
+// readUint reads a little endian integer of 2, 3 or 4 bytes
+func readUint(data []byte, width int) uint32 {
+	var value uint32
+	for i := width - 1; i >= 0; i-- {
+		value = value<<8 | uint32(data[i])
+	}
+	return value
+}
+
+// cp1252 maps the bytes of Windows-1252 that differ from Latin-1
+var cp1252 = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '‘',
+	0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜',
+	0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// decodeCodepage converts a string from the database codepage.
+// UTF-8 is used as is, other codepages are read as Windows-1252.
+func decodeCodepage(data []byte, codepage int) string {
+	if codepage == 65001 || utf8.Valid(data) && !hasHighBytes(data) {
+		return string(data)
+	}
+	var out strings.Builder
+	for _, b := range data {
+		if r, ok := cp1252[b]; ok {
+			out.WriteRune(r)
+		} else {
+			out.WriteRune(rune(b))
+		}
+	}
+	return out.String()
+}
+
+// hasHighBytes reports whether data has any non-ASCII bytes
+func hasHighBytes(data []byte) bool {
+	for _, b := range data {
+		if b >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+// pkg/extract/msi_files.go
+
+package extract
+
+import (
+	"sort"
+	"strings"
+)
+
+// MsiFile is a file installed by an MSI
+type MsiFile struct {
+	// Path is the target path, rooted at an environment variable such as %ProgramFiles%
+	Path    string
+	Version string
+	Size    int64
+}
+
+// standardFolders maps the Windows Installer folder properties to the
+// environment variables clients expand. 32-bit folders are rendered as
+// they appear on 64-bit Windows.
+var standardFolders = map[string]string{
+	"TARGETDIR":            `%SystemDrive%`,
+	"WindowsVolume":        `%SystemDrive%`,
+	"WindowsFolder":        `%SystemRoot%`,
+	"System64Folder":       `%SystemRoot%\System32`,
+	"SystemFolder":         `%SystemRoot%\SysWOW64`,
+	"ProgramFiles64Folder": `%ProgramFiles%`,
+	"ProgramFilesFolder":   `%ProgramFiles(x86)%`,
+	"CommonFiles64Folder":  `%CommonProgramFiles%`,
+	"CommonFilesFolder":    `%CommonProgramFiles(x86)%`,
+	"CommonAppDataFolder":  `%ProgramData%`,
+	"AppDataFolder":        `%APPDATA%`,
+	"LocalAppDataFolder":   `%LOCALAPPDATA%`,
+}
+
+// MsiFiles returns the files in the File table with their target paths.
+// Files in folders that can't be resolved to a standard folder are skipped.
+func MsiFiles(msiPath string) ([]MsiFile, error) {
+	db, err := openMsi(msiPath)
+	if err != nil {
+		return nil, err
+	}
+
+	directories, err := db.table("Directory")
+	if err != nil {
+		return nil, err
+	}
+	components, err := db.table("Component")
+	if err != nil {
+		return nil, err
+	}
+	files, err := db.table("File")
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[string]string)
+	names := make(map[string]string)
+	for _, row := range directories {
+		id := row.String("Directory")
+		parents[id] = row.String("Directory_Parent")
+		names[id] = targetName(row.String("DefaultDir"))
+	}
+
+	componentDirs := make(map[string]string)
+	for _, row := range components {
+		componentDirs[row.String("Component")] = row.String("Directory_")
+	}
+
+	// Versions of companion files reference another file's key, not a version
+	keys := make(map[string]bool)
+	for _, row := range files {
+		keys[row.String("File")] = true
+	}
+
+	var result []MsiFile
+	for _, row := range files {
+		dir, ok := resolveDirectory(componentDirs[row.String("Component_")], parents, names)
+		if !ok {
+			continue
+		}
+
+		file := MsiFile{Path: dir + `\` + targetName(row.String("FileName"))}
+		if version := row.String("Version"); !keys[version] {
+			file.Version = version
+		}
+		if size, ok := row.Int("FileSize"); ok {
+			file.Size = int64(size)
+		}
+		result = append(result, file)
+	}
+
+	return result, nil
+}
+
+// KeyFiles returns up to limit of the largest versioned EXE and DLL files,
+// which make the most reliable install checks
+func KeyFiles(files []MsiFile, limit int) []MsiFile {
+	var candidates []MsiFile
+	for _, file := range files {
+		lower := strings.ToLower(file.Path)
+		if file.Version == "" || !strings.HasSuffix(lower, ".exe") && !strings.HasSuffix(lower, ".dll") {
+			continue
+		}
+		candidates = append(candidates, file)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Size > candidates[j].Size
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// resolveDirectory builds the target path of a directory from its parents
+func resolveDirectory(id string, parents, names map[string]string) (string, bool) {
+	var segments []string
+	for depth := 0; depth <= len(parents); depth++ {
+		if folder, ok := standardFolders[id]; ok {
+			path := folder
+			for i := len(segments) - 1; i >= 0; i-- {
+				path += `\` + segments[i]
+			}
+			return path, true
+		}
+
+		parent, ok := parents[id]
+		if !ok || parent == "" || parent == id {
+			return "", false
+		}
+		if name := names[id]; name != "." && name != "" {
+			segments = append(segments, name)
+		}
+		id = parent
+	}
+	return "", false
+}
+
+// targetName returns the long target name from a DefaultDir or FileName value,
+// which may hold "target:source" and "short|long" pairs
+func targetName(value string) string {
+	if i := strings.Index(value, ":"); i >= 0 {
+		value = value[:i]
+	}
+	if i := strings.Index(value, "|"); i >= 0 {
+		value = value[i+1:]
+	}
+	return value
+}
@@ -0,0 +1,59 @@
+//go:build windows
+// +build windows
+
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// This abstraction allows us to override when testing
+var execCommand = exec.Command
+
+// msiMetadataPowerShell reads the Property table with the WindowsInstaller COM object.
+// It is much slower than the native reader and fails in constrained language mode,
+// so it is only used when the native reader can't parse the database.
+func msiMetadataPowerShell(msiPath string) (MsiInfo, error) {
+	// Escape single quotes in the file path
+	msiPathEscaped := strings.ReplaceAll(msiPath, `'`, `''`)
+
+	// PowerShell script to extract MSI properties
+	psScript := fmt.Sprintf(`$WindowsInstaller = New-Object -ComObject WindowsInstaller.Installer
+$Database = $WindowsInstaller.GetType().InvokeMember('OpenDatabase', 'InvokeMethod', $null, $WindowsInstaller, @('%s', 0))
+$View = $Database.GetType().InvokeMember('OpenView', 'InvokeMethod', $null, $Database, @('SELECT * FROM Property'))
+$View.GetType().InvokeMember('Execute', 'InvokeMethod', $null, $View, $null)
+$Record = $View.GetType().InvokeMember('Fetch', 'InvokeMethod', $null, $View, $null)
+
+$properties = @{}
+while ($Record -ne $null) {
+    $property = $Record.StringData(1)
+    $value = $Record.StringData(2)
+    $properties[$property] = $value
+    $Record = $View.GetType().InvokeMember('Fetch', 'InvokeMethod', $null, $View, $null)
+}
+
+$properties | ConvertTo-Json -Compress`, msiPathEscaped)
+
+	cmd := execCommand("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", psScript)
+	output, err := cmd.Output()
+	if err != nil {
+		return MsiInfo{}, fmt.Errorf("failed to execute PowerShell script: %v", err)
+	}
+
+	var properties map[string]string
+	if err := json.Unmarshal(output, &properties); err != nil {
+		return MsiInfo{}, fmt.Errorf("failed to parse JSON output: %v", err)
+	}
+
+	return MsiInfo{
+		ProductName:    properties["ProductName"],
+		ProductVersion: properties["ProductVersion"],
+		Manufacturer:   properties["Manufacturer"],
+		Comments:       properties["ARPCOMMENTS"],
+		ProductCode:    properties["ProductCode"],
+		UpgradeCode:    properties["UpgradeCode"],
+	}, nil
+}
@@ -0,0 +1,13 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package extract
+
+import "fmt"
+
+// msiMetadataPowerShell is just a placeholder on darwin, there is no WindowsInstaller COM object
+func msiMetadataPowerShell(msiPath string) (MsiInfo, error) {
+	return MsiInfo{}, fmt.Errorf("the WindowsInstaller COM object is only available on Windows")
+}
@@ -0,0 +1,227 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestMsiMetadata validates the product information is read from the fixture
+func TestMsiMetadata(t *testing.T) {
+	info, err := msiMetadataNative(filepath.Join("testdata", "dummy.msi"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := MsiInfo{
+		ProductName:    "dummy",
+		ProductVersion: "1.0.0",
+		Manufacturer:   "dummy",
+		Comments:       "This installer database contains the logic and data required to install dummy.",
+		ProductCode:    "{01D48E5F-8885-47C2-8D89-793CFC9DE165}",
+		UpgradeCode:    "{A9C9A3FB-AF3C-4A5C-9818-BC9BE1EDCD51}",
+	}
+	if info != expected {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+}
+
+// TestMsiMetadataInvalid validates a file that is not an MSI returns an error
+func TestMsiMetadataInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.msi")
+	if err := os.WriteFile(path, []byte("not an msi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := msiMetadataNative(path); err == nil {
+		t.Errorf("expected an error for an invalid MSI")
+	}
+	if _, err := msiMetadataNative(filepath.Join("testdata", "missing.msi")); err == nil {
+		t.Errorf("expected an error for a missing MSI")
+	}
+}
+
+// TestMsiTables validates the table schemas and rows are decoded
+func TestMsiTables(t *testing.T) {
+	db, err := openMsi(filepath.Join("testdata", "dummy.msi"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rows, err := db.table("Media")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 Media row, got %d", len(rows))
+	}
+	if disk, _ := rows[0].Int("DiskId"); disk != 1 {
+		t.Errorf("expected DiskId 1, got %d", disk)
+	}
+	if cabinet := rows[0].String("Cabinet"); cabinet != "#product.cab" {
+		t.Errorf("expected Cabinet #product.cab, got %s", cabinet)
+	}
+
+	if rows, err := db.table("Registry"); rows != nil || err != nil {
+		t.Errorf("a missing table should return no rows and no error, got %v, %v", rows, err)
+	}
+}
+
+// TestDecodeStreamName validates the packed stream names are decoded
+func TestDecodeStreamName(t *testing.T) {
+	tests := map[string]string{
+		string([]rune{0x4840, 0x3800 + 25 + 53<<6}):      "!Pr",
+		string([]rune{0x4800 + 36}):                      "a",
+		"\x05SummaryInformation":                         "\x05SummaryInformation",
+		string([]rune{0x3800 + 18 + 12<<6, 0x4800 + 63}): "IC_",
+	}
+	for stored, expected := range tests {
+		if name := decodeStreamName(stored); name != expected {
+			t.Errorf("expected %q, got %q", expected, name)
+		}
+	}
+}
+
+// BenchmarkMsiMetadataNative measures the pure Go reader
+func BenchmarkMsiMetadataNative(b *testing.B) {
+	path := filepath.Join("testdata", "dummy.msi")
+	for i := 0; i < b.N; i++ {
+		if _, err := msiMetadataNative(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMsiMetadataPowerShell measures the WindowsInstaller COM object for comparison
+func BenchmarkMsiMetadataPowerShell(b *testing.B) {
+	path, _ := filepath.Abs(filepath.Join("testdata", "dummy.msi"))
+	if _, err := msiMetadataPowerShell(path); err != nil {
+		b.Skipf("PowerShell is not available: %v", err)
+	}
+	for i := 0; i < b.N; i++ {
+		if _, err := msiMetadataPowerShell(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestMsiFiles validates the target paths are resolved from the Directory table
+func TestMsiFiles(t *testing.T) {
+	files, err := MsiFiles(filepath.Join("testdata", "dummy.msi"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []MsiFile{{Path: `%ProgramFiles(x86)%\dummy\ClassLibrary1.dll`, Version: "1.0.0.0", Size: 4608}}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %+v, got %+v", expected, files)
+	}
+}
+
+// TestResolveDirectory validates nested, "." and unknown directories
+func TestResolveDirectory(t *testing.T) {
+	parents := map[string]string{
+		"TARGETDIR":            "",
+		"ProgramFiles64Folder": "TARGETDIR",
+		"VENDOR":               "ProgramFiles64Folder",
+		"INSTALLDIR":           "VENDOR",
+		"BIN":                  "INSTALLDIR",
+		"SAME":                 "INSTALLDIR",
+		"CUSTOM":               "ORPHAN",
+	}
+	names := map[string]string{
+		"TARGETDIR":  "SourceDir",
+		"VENDOR":     "Contoso",
+		"INSTALLDIR": "Widget Pro",
+		"BIN":        "bin",
+		"SAME":       ".",
+		"CUSTOM":     "custom",
+	}
+
+	tests := map[string]string{
+		"BIN":        `%ProgramFiles%\Contoso\Widget Pro\bin`,
+		"SAME":       `%ProgramFiles%\Contoso\Widget Pro`,
+		"INSTALLDIR": `%ProgramFiles%\Contoso\Widget Pro`,
+	}
+	for id, expected := range tests {
+		if path, ok := resolveDirectory(id, parents, names); !ok || path != expected {
+			t.Errorf("%s: expected %s, got %s", id, expected, path)
+		}
+	}
+
+	if _, ok := resolveDirectory("CUSTOM", parents, names); ok {
+		t.Errorf("a directory outside the standard folders should not resolve")
+	}
+}
+
+// TestKeyFiles validates only the largest versioned executables are kept
+func TestKeyFiles(t *testing.T) {
+	files := []MsiFile{
+		{Path: `%ProgramFiles%\Widget\readme.txt`, Version: "", Size: 900000},
+		{Path: `%ProgramFiles%\Widget\widget.exe`, Version: "2.1.0.0", Size: 500000},
+		{Path: `%ProgramFiles%\Widget\helper.DLL`, Version: "2.1.0.0", Size: 700000},
+		{Path: `%ProgramFiles%\Widget\unversioned.dll`, Version: "", Size: 800000},
+		{Path: `%ProgramFiles%\Widget\small.dll`, Version: "2.1.0.0", Size: 1000},
+	}
+
+	keyFiles := KeyFiles(files, 2)
+	if len(keyFiles) != 2 || keyFiles[0].Path != `%ProgramFiles%\Widget\helper.DLL` || keyFiles[1].Path != `%ProgramFiles%\Widget\widget.exe` {
+		t.Errorf("unexpected key files: %+v", keyFiles)
+	}
+}
+
+// TestTargetName validates the long target name is used
+func TestTargetName(t *testing.T) {
+	tests := map[string]string{
+		"cb0qscio.dll|ClassLibrary1.dll": "ClassLibrary1.dll",
+		"PFiles":                         "PFiles",
+		"WIDGET|Widget Pro:SOURCE|Src":   "Widget Pro",
+		".:Source":                       ".",
+	}
+	for value, expected := range tests {
+		if name := targetName(value); name != expected {
+			t.Errorf("%s: expected %s, got %s", value, expected, name)
+		}
+	}
+}
+
+// TestMsiSummary validates the platform, languages and word count of the x86 and x64 fixtures
+func TestMsiSummary(t *testing.T) {
+	tests := map[string]string{
+		"dummy.msi":     "Intel",
+		"dummy-x64.msi": "x64",
+	}
+	for name, platform := range tests {
+		summary, err := MsiSummary(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if summary.Platform != platform {
+			t.Errorf("%s: expected platform %s, got %s", name, platform, summary.Platform)
+		}
+		if !reflect.DeepEqual(summary.Languages, []string{"1033"}) || summary.Language() != "1033" {
+			t.Errorf("%s: expected language 1033, got %v", name, summary.Languages)
+		}
+		if summary.WordCount&MsiCompressed == 0 {
+			t.Errorf("%s: expected the compressed flag, got word count %d", name, summary.WordCount)
+		}
+	}
+}
+
+// TestMsiSummaryLanguage validates language neutral packages have no language
+func TestMsiSummaryLanguage(t *testing.T) {
+	tests := []struct {
+		languages []string
+		expected  string
+	}{
+		{nil, ""},
+		{[]string{"0"}, ""},
+		{[]string{"1033", "1031"}, "1033,1031"},
+	}
+	for _, test := range tests {
+		if language := (MsiSummaryInfo{Languages: test.languages}).Language(); language != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.languages, test.expected, language)
+		}
+	}
+}
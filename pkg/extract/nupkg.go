@@ -0,0 +1,161 @@
+// pkg/extract/nupkg.go
+
+package extract
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Nuspec is the package manifest at the root of a nupkg
+type Nuspec struct {
+	Metadata NuspecMetadata `xml:"metadata"`
+}
+
+// NuspecMetadata holds the fields of a nuspec, including the ones Chocolatey adds
+type NuspecMetadata struct {
+	ID           string             `xml:"id"`
+	Version      string             `xml:"version"`
+	Title        string             `xml:"title"`
+	Authors      string             `xml:"authors"`
+	Description  string             `xml:"description"`
+	Summary      string             `xml:"summary"`
+	Tags         string             `xml:"tags"`
+	ProjectURL   string             `xml:"projectUrl"`
+	LicenseURL   string             `xml:"licenseUrl"`
+	Dependencies NuspecDependencies `xml:"dependencies"`
+}
+
+// NuspecDependencies lists dependencies directly or grouped by target framework
+type NuspecDependencies struct {
+	Dependency []NuspecDependency `xml:"dependency"`
+	Group      []struct {
+		Dependency []NuspecDependency `xml:"dependency"`
+	} `xml:"group"`
+}
+
+// NuspecDependency is a package id and version range
+type NuspecDependency struct {
+	ID      string `xml:"id,attr"`
+	Version string `xml:"version,attr"`
+}
+
+// NupkgInfo is the package information from a nupkg
+type NupkgInfo struct {
+	ID          string
+	Version     string
+	Title       string
+	Authors     string
+	Description string
+	ProjectURL  string
+	LicenseURL  string
+	// Dependencies are package ids, in the order the nuspec lists them
+	Dependencies []string
+	// HasInstallScript is set when tools\chocolateyInstall.ps1 exists,
+	// which may embed its own silent arguments
+	HasInstallScript bool
+}
+
+// NupkgMetadata returns the id, version, authors and description of a nupkg.
+// Empty strings are returned if it cannot be read, use NupkgDetails for the error.
+func NupkgMetadata(nupkgPath string) (string, string, string, string) {
+	info, err := NupkgDetails(nupkgPath)
+	if err != nil {
+		return "", "", "", ""
+	}
+	return info.ID, info.Version, info.Authors, info.Description
+}
+
+// NupkgDetails reads the nuspec and checks for a Chocolatey install script
+func NupkgDetails(nupkgPath string) (NupkgInfo, error) {
+	r, err := zip.OpenReader(nupkgPath)
+	if err != nil {
+		return NupkgInfo{}, fmt.Errorf("%s: %v", nupkgPath, err)
+	}
+	defer r.Close()
+
+	var nuspecFile *zip.File
+	hasInstallScript := false
+	for _, f := range r.File {
+		// Some packagers write backslashes in entry names
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		switch {
+		case !strings.Contains(name, "/") && strings.EqualFold(path.Ext(name), ".nuspec"):
+			nuspecFile = f
+		case strings.EqualFold(name, "tools/chocolateyInstall.ps1"):
+			hasInstallScript = true
+		}
+	}
+	if nuspecFile == nil {
+		return NupkgInfo{}, fmt.Errorf("%s: no .nuspec at the root of the package", nupkgPath)
+	}
+
+	nuspec, err := readNuspec(nuspecFile)
+	if err != nil {
+		return NupkgInfo{}, fmt.Errorf("%s: %v", nupkgPath, err)
+	}
+
+	metadata := nuspec.Metadata
+	info := NupkgInfo{
+		ID:               strings.TrimSpace(metadata.ID),
+		Version:          strings.TrimSpace(metadata.Version),
+		Title:            strings.TrimSpace(metadata.Title),
+		Authors:          strings.TrimSpace(metadata.Authors),
+		Description:      strings.TrimSpace(metadata.Description),
+		ProjectURL:       strings.TrimSpace(metadata.ProjectURL),
+		LicenseURL:       strings.TrimSpace(metadata.LicenseURL),
+		Dependencies:     metadata.Dependencies.ids(),
+		HasInstallScript: hasInstallScript,
+	}
+	if info.Description == "" {
+		info.Description = strings.TrimSpace(metadata.Summary)
+	}
+	if info.ID == "" || info.Version == "" {
+		return NupkgInfo{}, fmt.Errorf("%s: %s is missing the package id or version", nupkgPath, nuspecFile.Name)
+	}
+	return info, nil
+}
+
+// readNuspec decodes a nuspec from the package
+func readNuspec(f *zip.File) (Nuspec, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return Nuspec{}, fmt.Errorf("unable to open %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return Nuspec{}, fmt.Errorf("unable to read %s: %v", f.Name, err)
+	}
+
+	var nuspec Nuspec
+	if err := xml.Unmarshal(content, &nuspec); err != nil {
+		return Nuspec{}, fmt.Errorf("invalid XML in %s: %v", f.Name, err)
+	}
+	return nuspec, nil
+}
+
+// ids returns the unique package ids of every dependency, grouped or not
+func (d NuspecDependencies) ids() []string {
+	all := d.Dependency
+	for _, group := range d.Group {
+		all = append(all, group.Dependency...)
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, dependency := range all {
+		id := strings.TrimSpace(dependency.ID)
+		if id == "" || seen[strings.ToLower(id)] {
+			continue
+		}
+		seen[strings.ToLower(id)] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
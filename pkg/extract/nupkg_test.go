@@ -0,0 +1,70 @@
+package extract
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestNupkgDetails validates the nuspec fields, dependencies and install script are read
+func TestNupkgDetails(t *testing.T) {
+	info, err := NupkgDetails(filepath.Join("testdata", "example.app.1.2.3.nupkg"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := NupkgInfo{
+		ID:               "example.app",
+		Version:          "1.2.3",
+		Title:            "Example App",
+		Authors:          "Example Corp",
+		Description:      "An example application.",
+		ProjectURL:       "https://example.com/app",
+		LicenseURL:       "https://example.com/app/license",
+		Dependencies:     []string{"vcredist140", "dotnetfx"},
+		HasInstallScript: true,
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+}
+
+// TestNupkgDetailsNoDependencies validates a package without dependencies or scripts
+func TestNupkgDetailsNoDependencies(t *testing.T) {
+	info, err := NupkgDetails(filepath.Join("testdata", "example.lib.2.0.0.nupkg"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Dependencies != nil || info.HasInstallScript {
+		t.Errorf("expected no dependencies or install script, got %+v", info)
+	}
+	if info.Description != "A library without dependencies." {
+		t.Errorf("expected the summary as description, got %q", info.Description)
+	}
+}
+
+// TestNupkgDetailsMalformed validates malformed packages return a descriptive error
+func TestNupkgDetailsMalformed(t *testing.T) {
+	_, err := NupkgDetails(filepath.Join("testdata", "malformed.1.0.0.nupkg"))
+	if err == nil || !strings.Contains(err.Error(), "invalid XML in malformed.nuspec") {
+		t.Errorf("expected an invalid XML error, got %v", err)
+	}
+
+	if _, err := NupkgDetails(filepath.Join("testdata", "dummy.msi")); err == nil {
+		t.Errorf("expected an error for a file that is not a nupkg")
+	}
+}
+
+// TestNupkgMetadata validates the wrapper returns the basic fields, and empty strings on error
+func TestNupkgMetadata(t *testing.T) {
+	id, version, authors, description := NupkgMetadata(filepath.Join("testdata", "example.app.1.2.3.nupkg"))
+	if id != "example.app" || version != "1.2.3" || authors != "Example Corp" || description != "An example application." {
+		t.Errorf("unexpected metadata: %q %q %q %q", id, version, authors, description)
+	}
+
+	id, version, authors, description = NupkgMetadata(filepath.Join("testdata", "malformed.1.0.0.nupkg"))
+	if id != "" || version != "" || authors != "" || description != "" {
+		t.Errorf("expected empty strings, got %q %q %q %q", id, version, authors, description)
+	}
+}
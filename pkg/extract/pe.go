@@ -0,0 +1,134 @@
+// pkg/extract/pe.go
+
+package extract
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+)
+
+// Resource types, see winuser.h
+const (
+	rtIcon      = 3
+	rtGroupIcon = 14
+	rtVersion   = 16
+)
+
+// maxResourceDepth is the type, name and language levels of the resource tree
+const maxResourceDepth = 3
+
+// peResource is a resource from the .rsrc section
+type peResource struct {
+	kind int
+	id   int
+	data []byte
+}
+
+// peResources reads every resource with a numeric type from a PE file.
+// Resources with a string name get an id of -1.
+func peResources(f *pe.File) ([]peResource, error) {
+	var dir pe.DataDirectory
+	switch header := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if header.NumberOfRvaAndSizes <= pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			return nil, nil
+		}
+		dir = header.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+	case *pe.OptionalHeader64:
+		if header.NumberOfRvaAndSizes <= pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			return nil, nil
+		}
+		dir = header.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+	default:
+		return nil, fmt.Errorf("missing optional header")
+	}
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, nil
+	}
+
+	// Find the section that holds the resource directory
+	var section *pe.Section
+	for _, s := range f.Sections {
+		if dir.VirtualAddress >= s.VirtualAddress && dir.VirtualAddress < s.VirtualAddress+max32(s.VirtualSize, s.Size) {
+			section = s
+			break
+		}
+	}
+	if section == nil {
+		return nil, fmt.Errorf("resource directory is outside of every section")
+	}
+	data, err := section.Data()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read resource section: %v", err)
+	}
+	base := int(dir.VirtualAddress - section.VirtualAddress)
+	if base >= len(data) {
+		return nil, fmt.Errorf("resource directory is truncated")
+	}
+	rsrc := data[base:]
+
+	var resources []peResource
+	var walk func(offset, depth, kind, id int) error
+	walk = func(offset, depth, kind, id int) error {
+		if depth > maxResourceDepth || offset+16 > len(rsrc) {
+			return fmt.Errorf("invalid resource directory")
+		}
+		count := int(binary.LittleEndian.Uint16(rsrc[offset+12:])) + int(binary.LittleEndian.Uint16(rsrc[offset+14:]))
+		for i := 0; i < count; i++ {
+			entry := offset + 16 + i*8
+			if entry+8 > len(rsrc) {
+				return fmt.Errorf("resource directory is truncated")
+			}
+			name := binary.LittleEndian.Uint32(rsrc[entry:])
+			target := binary.LittleEndian.Uint32(rsrc[entry+4:])
+
+			// The high bit of the name marks a string
+			nameID := int(name & 0xFFFF)
+			if name&0x80000000 != 0 {
+				nameID = -1
+			}
+			entryKind, entryID := kind, id
+			switch depth {
+			case 0:
+				entryKind = nameID
+			case 1:
+				entryID = nameID
+			}
+
+			// The high bit of the target marks a subdirectory
+			if target&0x80000000 != 0 {
+				if err := walk(int(target&0x7FFFFFFF), depth+1, entryKind, entryID); err != nil {
+					return err
+				}
+				continue
+			}
+
+			at := int(target)
+			if at+16 > len(rsrc) || entryKind < 0 {
+				continue
+			}
+			rva := binary.LittleEndian.Uint32(rsrc[at:])
+			size := binary.LittleEndian.Uint32(rsrc[at+4:])
+			start := int(rva) - int(section.VirtualAddress)
+			if start < 0 || start+int(size) > len(data) {
+				continue
+			}
+			resources = append(resources, peResource{kind: entryKind, id: entryID, data: data[start : start+int(size)]})
+		}
+		return nil
+	}
+	if err := walk(0, 0, 0, 0); err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+// max32 returns the larger of two sizes
+func max32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
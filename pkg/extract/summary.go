@@ -0,0 +1,160 @@
+// pkg/extract/summary.go
+
+package extract
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Summary information property ids, see the Windows Installer documentation
+const (
+	pidCodepage  = 1
+	pidComments  = 6
+	pidTemplate  = 7
+	pidWordCount = 15
+)
+
+// Word count flags of the summary information, which describe the source image
+const (
+	MsiShortNames  = 0x1
+	MsiCompressed  = 0x2
+	MsiAdminImage  = 0x4
+	MsiNoElevation = 0x8
+)
+
+// MsiSummaryInfo is the platform and languages an MSI declares in its summary information
+type MsiSummaryInfo struct {
+	// Platform is the architecture from the Template property, an empty platform means Intel
+	Platform string
+	// Languages are the language ids of the Template property, such as 1033.
+	// 0 is a language neutral package.
+	Languages []string
+	// WordCount holds the MsiShortNames, MsiCompressed, MsiAdminImage and MsiNoElevation flags
+	WordCount int
+}
+
+// MsiSummary reads the Template and word count summary properties of an MSI
+// with the pure Go reader, so it works the same on any OS
+func MsiSummary(msiPath string) (MsiSummaryInfo, error) {
+	db, err := openMsi(msiPath)
+	if err != nil {
+		return MsiSummaryInfo{}, err
+	}
+	properties, err := db.summaryInformation()
+	if err != nil {
+		return MsiSummaryInfo{}, fmt.Errorf("%s: %v", msiPath, err)
+	}
+
+	// The Template is the platform and the languages, such as "x64;1033,1031"
+	template := strings.SplitN(properties[pidTemplate], ";", 2)
+	summary := MsiSummaryInfo{Platform: strings.TrimSpace(template[0])}
+	if len(template) == 2 {
+		for _, language := range strings.Split(template[1], ",") {
+			if language = strings.TrimSpace(language); language != "" {
+				summary.Languages = append(summary.Languages, language)
+			}
+		}
+	}
+	fmt.Sscan(properties[pidWordCount], &summary.WordCount)
+	return summary, nil
+}
+
+// Arch returns the architecture of the platform
+func (s MsiSummaryInfo) Arch() (string, error) {
+	platform := strings.ToLower(s.Platform)
+	if platform == "" {
+		return ArchX86, nil
+	}
+	if arch, ok := msiPlatformArch[platform]; ok {
+		return arch, nil
+	}
+	return ArchUnknown, fmt.Errorf("unsupported platform %q", s.Platform)
+}
+
+// Language returns the languages for the language of a pkginfo, such as "1033,1031",
+// or "" for a language neutral package
+func (s MsiSummaryInfo) Language() string {
+	var languages []string
+	for _, language := range s.Languages {
+		if language != "0" {
+			languages = append(languages, language)
+		}
+	}
+	return strings.Join(languages, ",")
+}
+
+// Property value types used by the summary information
+const (
+	vtI2    = 2
+	vtI4    = 3
+	vtLPStr = 30
+)
+
+// summaryInformation reads the string and integer properties of the
+// \x05SummaryInformation property set, integers are formatted as strings
+func (db *msiDatabase) summaryInformation() (map[int]string, error) {
+	data, ok, err := db.cf.stream("\x05SummaryInformation")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no summary information")
+	}
+	return parsePropertySet(data)
+}
+
+// parsePropertySet reads the first section of an OLE property set
+func parsePropertySet(data []byte) (map[int]string, error) {
+	if len(data) < 48 || binary.LittleEndian.Uint16(data) != 0xFFFE {
+		return nil, fmt.Errorf("invalid property set")
+	}
+	section := int(binary.LittleEndian.Uint32(data[44:]))
+	if section+8 > len(data) {
+		return nil, fmt.Errorf("invalid property set section")
+	}
+	count := int(binary.LittleEndian.Uint32(data[section+4:]))
+
+	type entry struct{ id, offset int }
+	var entries []entry
+	for i := 0; i < count; i++ {
+		at := section + 8 + i*8
+		if at+8 > len(data) {
+			return nil, fmt.Errorf("property set is truncated")
+		}
+		entries = append(entries, entry{
+			id:     int(binary.LittleEndian.Uint32(data[at:])),
+			offset: section + int(binary.LittleEndian.Uint32(data[at+4:])),
+		})
+	}
+
+	// The codepage applies to every string, read it first
+	codepage := 0
+	values := make(map[int]string)
+	for pass := 0; pass < 2; pass++ {
+		for _, e := range entries {
+			if (pass == 0) != (e.id == pidCodepage) || e.offset+8 > len(data) {
+				continue
+			}
+			kind := binary.LittleEndian.Uint32(data[e.offset:])
+			value := data[e.offset+4:]
+			switch kind {
+			case vtI2:
+				values[e.id] = fmt.Sprint(int16(binary.LittleEndian.Uint16(value)))
+				if e.id == pidCodepage {
+					codepage = int(binary.LittleEndian.Uint16(value))
+				}
+			case vtI4:
+				values[e.id] = fmt.Sprint(int32(binary.LittleEndian.Uint32(value)))
+			case vtLPStr:
+				length := int(binary.LittleEndian.Uint32(value))
+				if length < 0 || 4+length > len(value) {
+					continue
+				}
+				values[e.id] = strings.TrimRight(decodeCodepage(value[4:4+length], codepage), "\x00")
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,161 @@
+// Package facts gathers what describes this machine, such as its model, build of Windows and
+// free disk, once per run for the report and for the items that depend on the machine
+package facts
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/windowsadmins/gorilla/pkg/extract"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// Facts describe this machine. A fact that couldn't be read is empty.
+type Facts struct {
+	Hostname     string `yaml:"hostname" json:"hostname"`
+	Domain       string `yaml:"domain" json:"domain"`
+	DomainJoined bool   `yaml:"domain_joined" json:"domain_joined"`
+	SerialNumber string `yaml:"serial_number" json:"serial_number"`
+	Model        string `yaml:"model" json:"model"`
+	// OSVersion is the major.minor.build of Windows, such as 10.0.22631
+	OSVersion string `yaml:"os_version" json:"os_version"`
+	// OSBuild is the build with its update revision, such as 22631.3880
+	OSBuild string `yaml:"os_build" json:"os_build"`
+	// Arch is the architecture of Windows as supported_architectures names it, such as x64
+	Arch string `yaml:"arch" json:"arch"`
+	// Chassis is laptop or desktop, or empty for others such as virtual machines
+	Chassis    string `yaml:"chassis" json:"chassis"`
+	FreeDiskMB uint64 `yaml:"free_disk_mb" json:"free_disk_mb"`
+	RAMMB      uint64 `yaml:"ram_mb" json:"ram_mb"`
+	LastBoot   string `yaml:"last_boot" json:"last_boot"`
+	// ConsoleUser is the user logged on at the console, if there is one
+	ConsoleUser string `yaml:"console_user" json:"console_user"`
+}
+
+// gatherer fills in some of the facts
+type gatherer struct {
+	name   string
+	gather func(*Facts) error
+}
+
+var (
+	// Each gatherer runs on its own, so one that fails only leaves its own facts empty.
+	// This abstraction allows us to override when testing
+	gatherers = []gatherer{
+		{"hostname", gatherHostname},
+		{"domain", gatherDomain},
+		{"serial number", gatherSerialNumber},
+		{"model", gatherModel},
+		{"OS version", gatherOSVersion},
+		{"architecture", gatherArch},
+		{"chassis", gatherChassis},
+		{"free disk", gatherFreeDisk},
+		{"memory", gatherMemory},
+		{"last boot", gatherLastBoot},
+		{"console user", gatherConsoleUser},
+	}
+
+	// The facts are gathered once per run
+	once   sync.Once
+	cached Facts
+)
+
+// Gather reads the facts now. The facts that couldn't be read are left empty,
+// and the errors returned name them.
+func Gather() (Facts, []error) {
+	var facts Facts
+	var errs []error
+	for _, g := range gatherers {
+		if err := g.gather(&facts); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", g.name, err))
+		}
+	}
+	return facts, errs
+}
+
+// Get returns the facts, gathered the first time they are asked for in a run.
+// A fact that couldn't be read is logged as a warning and left empty, it never stops the run.
+func Get() Facts {
+	once.Do(func() {
+		var errs []error
+		cached, errs = Gather()
+		for _, err := range errs {
+			logging.Warn("Unable to read a machine fact", "error", err)
+		}
+	})
+	return cached
+}
+
+// Reset forgets the facts, so the next Get gathers them again
+func Reset() {
+	once = sync.Once{}
+	cached = Facts{}
+}
+
+// Map returns the facts by their names in the report, such as os_version
+func (f Facts) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"hostname":      f.Hostname,
+		"domain":        f.Domain,
+		"domain_joined": f.DomainJoined,
+		"serial_number": f.SerialNumber,
+		"model":         f.Model,
+		"os_version":    f.OSVersion,
+		"os_build":      f.OSBuild,
+		"arch":          f.Arch,
+		"chassis":       f.Chassis,
+		"free_disk_mb":  f.FreeDiskMB,
+		"ram_mb":        f.RAMMB,
+		"last_boot":     f.LastBoot,
+		"console_user":  f.ConsoleUser,
+	}
+}
+
+func gatherHostname(facts *Facts) error {
+	hostname, err := os.Hostname()
+	facts.Hostname = hostname
+	return err
+}
+
+// gatherArch reads the architecture of Windows, which for a 32-bit process
+// on 64-bit Windows is in PROCESSOR_ARCHITEW6432 rather than PROCESSOR_ARCHITECTURE
+func gatherArch(facts *Facts) error {
+	for _, variable := range []string{"PROCESSOR_ARCHITEW6432", "PROCESSOR_ARCHITECTURE"} {
+		if arch := os.Getenv(variable); arch != "" {
+			facts.Arch = extract.NormalizeArch(arch)
+			return nil
+		}
+	}
+	facts.Arch = extract.NormalizeArch(runtime.GOARCH)
+	return nil
+}
+
+func gatherConsoleUser(facts *Facts) error {
+	if user, ok := status.ActiveConsoleUser(); ok {
+		facts.ConsoleUser = user.Name
+	}
+	return nil
+}
+
+// chassisKind returns laptop or desktop for the ChassisTypes of Win32_SystemEnclosure,
+// such as "10" or "3,12". Other types, such as 1 for most virtual machines, are empty.
+func chassisKind(chassisTypes string) string {
+	for _, field := range strings.Split(chassisTypes, ",") {
+		chassisType, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			continue
+		}
+		switch chassisType {
+		case 8, 9, 10, 11, 14, 30, 31, 32:
+			return "laptop"
+		case 3, 4, 5, 6, 7, 13, 15, 16, 24, 35, 36:
+			return "desktop"
+		}
+	}
+	return ""
+}
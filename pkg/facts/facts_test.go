@@ -0,0 +1,65 @@
+package facts
+
+import (
+	"errors"
+	"testing"
+)
+
+// useGatherers replaces the gatherers for the duration of the test
+func useGatherers(t *testing.T, fake []gatherer) {
+	origGatherers := gatherers
+	t.Cleanup(func() {
+		gatherers = origGatherers
+		Reset()
+	})
+	gatherers = fake
+	Reset()
+}
+
+// TestGetDegrades validates a fact that can't be read is left empty without
+// losing the others, and the facts are only gathered once per run
+func TestGetDegrades(t *testing.T) {
+	calls := 0
+	useGatherers(t, []gatherer{
+		{"hostname", func(f *Facts) error { calls++; f.Hostname = "PC01"; return nil }},
+		{"serial number", func(f *Facts) error { return errors.New("Invalid class \"Win32_BIOS\"") }},
+		{"OS version", func(f *Facts) error { f.OSVersion, f.OSBuild = "10.0.22631", "22631.3880"; return nil }},
+		{"memory", func(f *Facts) error { f.RAMMB = 16384; return nil }},
+	})
+
+	facts, errs := Gather()
+	if len(errs) != 1 || errs[0].Error() != `serial number: Invalid class "Win32_BIOS"` {
+		t.Errorf("expected the serial number error, got %v", errs)
+	}
+	if facts.Hostname != "PC01" || facts.SerialNumber != "" || facts.OSBuild != "22631.3880" || facts.RAMMB != 16384 {
+		t.Errorf("unexpected facts: %+v", facts)
+	}
+
+	calls = 0
+	Get()
+	if got := Get(); got.Hostname != "PC01" || calls != 1 {
+		t.Errorf("expected the facts gathered once, got %d times: %+v", calls, got)
+	}
+	if values := Get().Map(); values["os_version"] != "10.0.22631" || values["ram_mb"] != uint64(16384) || values["serial_number"] != "" {
+		t.Errorf("unexpected map of the facts: %v", values)
+	}
+}
+
+// TestChassisKind validates the chassis types of laptops and desktops
+func TestChassisKind(t *testing.T) {
+	tests := map[string]string{
+		"10":   "laptop",
+		"31":   "laptop",
+		"3":    "desktop",
+		"35":   "desktop",
+		"1":    "",
+		"":     "",
+		"1,9":  "laptop",
+		"x,13": "desktop",
+	}
+	for chassisTypes, expected := range tests {
+		if actual := chassisKind(chassisTypes); actual != expected {
+			t.Errorf("chassisKind(%q) = %q, want %q", chassisTypes, actual, expected)
+		}
+	}
+}
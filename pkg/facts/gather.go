@@ -0,0 +1,151 @@
+//go:build windows
+// +build windows
+
+package facts
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	kernel32             = windows.NewLazySystemDLL("kernel32.dll")
+	globalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
+	getTickCount64       = kernel32.NewProc("GetTickCount64")
+)
+
+// memoryStatusEx is the MEMORYSTATUSEX structure of GlobalMemoryStatusEx
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+// cimProperty reads a property of a CIM class through PowerShell, such as the SerialNumber of Win32_BIOS.
+// A property with several values, such as ChassisTypes, is joined with commas.
+func cimProperty(class, property string) (string, error) {
+	out, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command",
+		fmt.Sprintf("(Get-CimInstance -ClassName %s).%s -join ','", class, property)).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func gatherDomain(facts *Facts) error {
+	var name *uint16
+	var joinStatus uint32
+	if err := windows.NetGetJoinInformation(nil, &name, &joinStatus); err != nil {
+		return err
+	}
+	defer windows.NetApiBufferFree((*byte)(unsafe.Pointer(name)))
+	if joinStatus == windows.NetSetupDomainName {
+		facts.Domain = windows.UTF16PtrToString(name)
+		facts.DomainJoined = true
+	}
+	return nil
+}
+
+func gatherSerialNumber(facts *Facts) error {
+	serial, err := cimProperty("Win32_BIOS", "SerialNumber")
+	facts.SerialNumber = serial
+	return err
+}
+
+func gatherModel(facts *Facts) error {
+	model, err := cimProperty("Win32_ComputerSystem", "Model")
+	facts.Model = model
+	return err
+}
+
+func gatherChassis(facts *Facts) error {
+	chassisTypes, err := cimProperty("Win32_SystemEnclosure", "ChassisTypes")
+	facts.Chassis = chassisKind(chassisTypes)
+	return err
+}
+
+// gatherOSVersion reads the version of Windows. RtlGetVersion isn't affected by the compatibility
+// manifest, the registry is the fallback. The update revision of the build is only in the registry.
+func gatherOSVersion(facts *Facts) error {
+	key, keyErr := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE)
+	if keyErr == nil {
+		defer key.Close()
+	}
+
+	var build string
+	if info := windows.RtlGetVersion(); info != nil && info.MajorVersion > 0 {
+		facts.OSVersion = fmt.Sprintf("%d.%d.%d", info.MajorVersion, info.MinorVersion, info.BuildNumber)
+		build = fmt.Sprint(info.BuildNumber)
+	} else if keyErr != nil {
+		return keyErr
+	} else {
+		major, _, errMajor := key.GetIntegerValue("CurrentMajorVersionNumber")
+		minor, _, errMinor := key.GetIntegerValue("CurrentMinorVersionNumber")
+		currentBuild, _, errBuild := key.GetStringValue("CurrentBuild")
+		if errMajor != nil || errMinor != nil || errBuild != nil {
+			return errors.New("the version is not in the registry")
+		}
+		facts.OSVersion = fmt.Sprintf("%d.%d.%s", major, minor, currentBuild)
+		build = currentBuild
+	}
+
+	facts.OSBuild = build
+	if keyErr == nil {
+		if revision, _, err := key.GetIntegerValue("UBR"); err == nil {
+			facts.OSBuild = fmt.Sprintf("%s.%d", build, revision)
+		}
+	}
+	return nil
+}
+
+// gatherFreeDisk reads the space available on the system drive
+func gatherFreeDisk(facts *Facts) error {
+	drive := os.Getenv("SystemDrive")
+	if drive == "" {
+		drive = "C:"
+	}
+	dir, err := windows.UTF16PtrFromString(drive + `\`)
+	if err != nil {
+		return err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(dir, &available, &total, &free); err != nil {
+		return err
+	}
+	facts.FreeDiskMB = available / (1024 * 1024)
+	return nil
+}
+
+func gatherMemory(facts *Facts) error {
+	status := memoryStatusEx{}
+	status.length = uint32(unsafe.Sizeof(status))
+	if ret, _, err := globalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); ret == 0 {
+		return err
+	}
+	facts.RAMMB = status.totalPhys / (1024 * 1024)
+	return nil
+}
+
+func gatherLastBoot(facts *Facts) error {
+	if err := getTickCount64.Find(); err != nil {
+		return err
+	}
+	ticks, _, _ := getTickCount64.Call()
+	boot := time.Now().Add(-time.Duration(ticks) * time.Millisecond)
+	facts.LastBoot = boot.Format("2006-01-02 15:04:05 -0700")
+	return nil
+}
@@ -0,0 +1,40 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package facts
+
+// These are just placeholders on darwin, the facts that only Windows has are left empty
+
+func gatherDomain(facts *Facts) error {
+	return nil
+}
+
+func gatherSerialNumber(facts *Facts) error {
+	return nil
+}
+
+func gatherModel(facts *Facts) error {
+	return nil
+}
+
+func gatherChassis(facts *Facts) error {
+	return nil
+}
+
+func gatherOSVersion(facts *Facts) error {
+	return nil
+}
+
+func gatherFreeDisk(facts *Facts) error {
+	return nil
+}
+
+func gatherMemory(facts *Facts) error {
+	return nil
+}
+
+func gatherLastBoot(facts *Facts) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Base command for bat and cmd installers
+var commandCmd = filepath.Join(os.Getenv("WINDIR"), "system32/", "cmd.exe")
+
+// cmdMetacharacters are interpreted by cmd.exe even inside an argument, so they could
+// chain another command onto the script
+const cmdMetacharacters = "&|<>^\r\n"
+
+// batchType returns true for the installer types run by cmd.exe
+func batchType(installerType string) bool {
+	return installerType == "bat" || installerType == "cmd"
+}
+
+// batchCommand builds the cmd.exe command that runs a .bat or .cmd script with its arguments.
+// AutoRun commands are disabled with /d, and arguments cmd.exe would treat as more commands are refused.
+func batchCommand(scriptFile string, arguments []string) (string, []string, error) {
+	for _, arg := range append([]string{scriptFile}, arguments...) {
+		if strings.ContainsAny(arg, cmdMetacharacters) {
+			return "", nil, fmt.Errorf("unsafe character in batch script argument: %q", arg)
+		}
+	}
+	cmdArgs := append([]string{"/d", "/c", scriptFile}, arguments...)
+	return commandCmd, cmdArgs, nil
+}
@@ -0,0 +1,68 @@
+package installer
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+)
+
+// batchItem returns an item installed and uninstalled with cmd scripts
+func batchItem(arguments ...string) catalog.Item {
+	return catalog.Item{
+		Name:        "Legacy",
+		DisplayName: "Legacy App",
+		Version:     "2.0",
+		Installer:   catalog.InstallerItem{Type: "cmd", Location: "apps/legacy/install.cmd", Arguments: arguments},
+		Uninstaller: catalog.InstallerItem{Type: "bat", Location: "apps/legacy/remove.bat"},
+	}
+}
+
+// TestInstallBatch validates cmd scripts run through cmd.exe in their cache directory
+func TestInstallBatch(t *testing.T) {
+	fake := fakeUninstall{}
+	cfg := fake.use(t)
+	var dirs []string
+	runCommand = func(c Command) (string, error) {
+		fake.commands = append(fake.commands, strings.Join(append([]string{c.Path}, c.Arguments...), " "))
+		dirs = append(dirs, c.Dir)
+		return "", nil
+	}
+
+	item := batchItem("/quiet", "INSTALLDIR=C:\\Legacy App")
+	if _, err := installItem(item, "https://example.com/install.cmd", cfg.CachePath); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if _, err := uninstallItem(item, "https://example.com/remove.bat", cfg.CachePath); err != nil {
+		t.Fatalf("uninstall failed: %v", err)
+	}
+
+	scriptDir := filepath.Join(cfg.CachePath, "apps", "legacy")
+	expected := []string{
+		commandCmd + " /d /c " + filepath.Join(scriptDir, "install.cmd") + " /quiet INSTALLDIR=C:\\Legacy App",
+		commandCmd + " /d /c " + filepath.Join(scriptDir, "remove.bat"),
+	}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.commands)
+	}
+	if !reflect.DeepEqual(dirs, []string{scriptDir, scriptDir}) {
+		t.Errorf("expected to run in %s, got %v", scriptDir, dirs)
+	}
+}
+
+// TestInstallBatchUnsafeArguments validates arguments that would chain commands are refused
+func TestInstallBatchUnsafeArguments(t *testing.T) {
+	fake := fakeUninstall{}
+	cfg := fake.use(t)
+
+	for _, arg := range []string{"/quiet & del C:\\*", "a|b", "> out.txt", "^x", "a\nb"} {
+		if _, err := installItem(batchItem(arg), "https://example.com/install.cmd", cfg.CachePath); err == nil {
+			t.Errorf("expected %q to be refused", arg)
+		}
+	}
+	if len(fake.commands) != 0 {
+		t.Errorf("unexpected commands: %v", fake.commands)
+	}
+}
@@ -0,0 +1,153 @@
+package installer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// What to do when a blocking app is running before an install
+const (
+	BlockingSkip      = "skip"
+	BlockingWait      = "wait"
+	BlockingTerminate = "terminate"
+)
+
+// DefaultBlockingTimeout is how long to wait for blocking apps when the item doesn't say
+const DefaultBlockingTimeout = 300
+
+var (
+	// How often the process list is checked, and how long apps get to close before they are killed
+	blockingPoll  = 2 * time.Second
+	terminateWait = 10 * time.Second
+
+	// These abstractions allows us to override when testing
+	runningProcesses = listProcesses
+	closeProcess     = func(name string) error { return taskkill("/IM", name) }
+	killProcess      = func(name string) error { return taskkill("/F", "/IM", name) }
+	sleep            = time.Sleep
+)
+
+// taskkill runs taskkill.exe with its arguments
+func taskkill(arguments ...string) error {
+	_, err := runCommand(newCommand("taskkill.exe", arguments...))
+	return err
+}
+
+// processName returns a blocking app as an executable name, adding .exe if needed
+func processName(app string) string {
+	name := filepath.Base(app)
+	if filepath.Ext(name) == "" {
+		name += ".exe"
+	}
+	return strings.ToLower(name)
+}
+
+// runningBlockingApps returns the blocking apps of an item that are running
+func runningBlockingApps(item catalog.Item) ([]string, error) {
+	processes, err := runningProcesses()
+	if err != nil {
+		return nil, err
+	}
+	running := make(map[string]bool)
+	for _, process := range processes {
+		running[strings.ToLower(process)] = true
+	}
+
+	var blocking []string
+	for _, app := range item.BlockingApps {
+		if name := processName(app); running[name] {
+			blocking = append(blocking, name)
+		}
+	}
+	return blocking, nil
+}
+
+// waitForBlockingApps polls the process list until none of the apps are running or the time is up,
+// and returns the apps still running
+func waitForBlockingApps(item catalog.Item, timeout time.Duration) ([]string, error) {
+	var waited time.Duration
+	for {
+		blocking, err := runningBlockingApps(item)
+		if err != nil || len(blocking) == 0 || waited >= timeout {
+			return blocking, err
+		}
+		sleep(blockingPoll)
+		waited += blockingPoll
+	}
+}
+
+// clearBlockingApps applies the blocking apps action of an item, and returns true
+// when nothing blocks the install anymore
+func clearBlockingApps(item catalog.Item) bool {
+	if len(item.BlockingApps) == 0 {
+		return true
+	}
+	blocking, err := runningBlockingApps(item)
+	if err != nil {
+		logging.Warn("Unable to check for blocking apps:", item.DisplayName, err)
+		return true
+	}
+	if len(blocking) == 0 {
+		return true
+	}
+
+	timeout := time.Duration(item.BlockingAppsTimeout) * time.Second
+	if item.BlockingAppsTimeout <= 0 {
+		timeout = DefaultBlockingTimeout * time.Second
+	}
+
+	// An item past its force_install_after_date doesn't wait for the apps to close
+	action := strings.ToLower(item.BlockingAppsAction)
+	if ForceInstallDue(item) {
+		logging.Warn("Terminating blocking apps, the install is forced:", item.DisplayName, blocking)
+		action = BlockingTerminate
+	}
+	switch action {
+	case BlockingWait:
+		logging.Info("Waiting for blocking apps to close:", item.DisplayName, blocking, timeout)
+		blocking, err = waitForBlockingApps(item, timeout)
+	case BlockingTerminate:
+		blocking, err = terminateBlockingApps(item, blocking)
+	default:
+		action = BlockingSkip
+	}
+
+	if err == nil && len(blocking) > 0 {
+		err = fmt.Errorf("blocking apps running: %s", strings.Join(blocking, ", "))
+	}
+	report.RecordAction(item.Name, item.Version, "blocking_apps_"+action, err)
+	if err != nil {
+		logging.Warn("Skipping install, blocking apps running:", item.DisplayName, err)
+		return false
+	}
+	logging.Info("Blocking apps closed:", item.DisplayName)
+	return true
+}
+
+// terminateBlockingApps asks the apps to close, and kills the ones still running after a grace period
+func terminateBlockingApps(item catalog.Item, blocking []string) ([]string, error) {
+	for _, name := range blocking {
+		logging.Info("Closing blocking app:", name)
+		if err := closeProcess(name); err != nil {
+			logging.Warn("Unable to close blocking app:", name, err)
+		}
+	}
+	blocking, err := waitForBlockingApps(item, terminateWait)
+	if err != nil || len(blocking) == 0 {
+		return blocking, err
+	}
+
+	for _, name := range blocking {
+		logging.Warn("Killing blocking app:", name)
+		if err := killProcess(name); err != nil {
+			logging.Warn("Unable to kill blocking app:", name, err)
+		}
+	}
+	return waitForBlockingApps(item, terminateWait)
+}
@@ -0,0 +1,176 @@
+package installer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// fakeProcesses is a process list that apps leave when closed or killed
+type fakeProcesses struct {
+	running map[string]bool
+	// closes lists the apps that exit when asked to close
+	closes map[string]bool
+	// exitAfter is how long an app keeps running on its own, if it exits at all
+	exitAfter map[string]time.Duration
+	elapsed   time.Duration
+	steps     []string
+}
+
+// use overrides the process functions for the duration of the test
+func (f *fakeProcesses) use(t *testing.T) {
+	origRunning, origClose, origKill, origSleep := runningProcesses, closeProcess, killProcess, sleep
+	t.Cleanup(func() {
+		runningProcesses, closeProcess, killProcess, sleep = origRunning, origClose, origKill, origSleep
+		report.Actions = nil
+	})
+	report.Actions = nil
+
+	runningProcesses = func() ([]string, error) {
+		names := []string{"explorer.exe"}
+		for name, running := range f.running {
+			if exit, ok := f.exitAfter[name]; ok && f.elapsed >= exit {
+				continue
+			}
+			if running {
+				names = append(names, strings.ToUpper(name))
+			}
+		}
+		return names, nil
+	}
+	closeProcess = func(name string) error {
+		f.steps = append(f.steps, "close "+name)
+		if f.closes[name] {
+			f.running[name] = false
+		}
+		return nil
+	}
+	killProcess = func(name string) error {
+		f.steps = append(f.steps, "kill "+name)
+		f.running[name] = false
+		return nil
+	}
+	sleep = func(d time.Duration) {
+		f.elapsed += d
+	}
+}
+
+func blockingItem(action string) catalog.Item {
+	return catalog.Item{
+		Name:                "Agent",
+		DisplayName:         "Agent",
+		Version:             "2.0",
+		BlockingApps:        []string{"agent", "tray.exe"},
+		BlockingAppsAction:  action,
+		BlockingAppsTimeout: 30,
+		Installer:           catalog.InstallerItem{Type: "msi", Location: "apps/Agent.msi"},
+	}
+}
+
+// TestBlockingAppsSkip validates an install is skipped by default while a blocking app runs
+func TestBlockingAppsSkip(t *testing.T) {
+	fake := &fakeProcesses{running: map[string]bool{"agent.exe": true}}
+	fake.use(t)
+
+	if clearBlockingApps(blockingItem("")) {
+		t.Errorf("expected the install to be skipped")
+	}
+	if len(fake.steps) != 0 || fake.elapsed != 0 {
+		t.Errorf("expected no waiting or closing, got %v after %s", fake.steps, fake.elapsed)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].Action != "blocking_apps_skip" || report.Actions[0].Success {
+		t.Errorf("unexpected report: %+v", report.Actions)
+	}
+}
+
+// TestBlockingAppsNotRunning validates nothing is done when no blocking app runs
+func TestBlockingAppsNotRunning(t *testing.T) {
+	fake := &fakeProcesses{running: map[string]bool{"other.exe": true}}
+	fake.use(t)
+
+	if !clearBlockingApps(blockingItem(BlockingTerminate)) {
+		t.Errorf("expected the install to go ahead")
+	}
+	if len(fake.steps) != 0 || len(report.Actions) != 0 {
+		t.Errorf("expected nothing done, got %v and %+v", fake.steps, report.Actions)
+	}
+}
+
+// TestBlockingAppsWait validates the install goes ahead once the app exits within the timeout
+func TestBlockingAppsWait(t *testing.T) {
+	fake := &fakeProcesses{
+		running:   map[string]bool{"tray.exe": true},
+		exitAfter: map[string]time.Duration{"tray.exe": 10 * time.Second},
+	}
+	fake.use(t)
+
+	if !clearBlockingApps(blockingItem(BlockingWait)) {
+		t.Errorf("expected the install to go ahead")
+	}
+	if fake.elapsed != 10*time.Second {
+		t.Errorf("expected to wait 10s, waited %s", fake.elapsed)
+	}
+	if len(report.Actions) != 1 || !report.Actions[0].Success {
+		t.Errorf("unexpected report: %+v", report.Actions)
+	}
+}
+
+// TestBlockingAppsWaitTimeout validates the install is skipped when the app is still running at the timeout
+func TestBlockingAppsWaitTimeout(t *testing.T) {
+	fake := &fakeProcesses{running: map[string]bool{"agent.exe": true}}
+	fake.use(t)
+
+	if clearBlockingApps(blockingItem(BlockingWait)) {
+		t.Errorf("expected the install to be skipped")
+	}
+	if fake.elapsed != 30*time.Second {
+		t.Errorf("expected to wait 30s, waited %s", fake.elapsed)
+	}
+	if len(fake.steps) != 0 {
+		t.Errorf("expected nothing closed, got %v", fake.steps)
+	}
+}
+
+// TestBlockingAppsTerminate validates apps are asked to close, and killed when they don't
+func TestBlockingAppsTerminate(t *testing.T) {
+	fake := &fakeProcesses{
+		running: map[string]bool{"agent.exe": true, "tray.exe": true},
+		closes:  map[string]bool{"tray.exe": true},
+	}
+	fake.use(t)
+
+	if !clearBlockingApps(blockingItem(BlockingTerminate)) {
+		t.Errorf("expected the install to go ahead")
+	}
+
+	// Both are asked to close, in either order, and only the agent is killed
+	if len(fake.steps) != 3 || fake.steps[2] != "kill agent.exe" {
+		t.Errorf("unexpected steps: %v", fake.steps)
+	}
+	if fake.elapsed != terminateWait {
+		t.Errorf("expected to wait %s before killing, waited %s", terminateWait, fake.elapsed)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].Action != "blocking_apps_terminate" || !report.Actions[0].Success {
+		t.Errorf("unexpected report: %+v", report.Actions)
+	}
+}
+
+// TestInstallBlockingApps validates an install with a blocking app running doesn't run the installer
+func TestInstallBlockingApps(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{true}}
+	cfg := fake.use(t)
+	processes := &fakeProcesses{running: map[string]bool{"agent.exe": true}}
+	processes.use(t)
+
+	if result := Install(context.Background(), blockingItem(BlockingSkip), "update", cfg); result != "Blocking apps running" {
+		t.Errorf("expected the install to be blocked, got %q", result)
+	}
+	if !reflect.DeepEqual(fake.calls, []string(nil)) {
+		t.Errorf("expected no installs, got %v", fake.calls)
+	}
+}
@@ -0,0 +1,119 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+var (
+	// commandEcho logs every command at the info level before it runs, for --echo-commands
+	commandEcho bool
+
+	// commandDryRun logs commands in place of running them, for --echo-commands in check only runs
+	commandDryRun bool
+)
+
+// Command is a program the installer runs, with each of its arguments,
+// the working directory it starts in and the user it runs as
+type Command struct {
+	Path      string
+	Arguments []string
+
+	// Dir is the working directory, the current one when empty
+	Dir string
+
+	// User is who the command runs as, the account gorilla runs as when nil
+	User *status.ConsoleUser
+
+	// Log is the item log the output is copied to, none when nil
+	Log io.Writer
+
+	// Context is cancelled when Gorilla shuts down, the command is then given shutdownGrace
+	// to finish before it is killed. A command without one is never killed.
+	Context context.Context
+}
+
+// newCommand returns a command that runs in the current directory as the account gorilla runs as
+func newCommand(path string, arguments ...string) Command {
+	return Command{Path: path, Arguments: arguments}
+}
+
+// String returns the program and each argument as a separate quoted token, exactly as they
+// are passed to the program, followed by the working directory and user when they are set
+func (c Command) String() string {
+	tokens := []string{fmt.Sprintf("%q", c.Path)}
+	for _, argument := range c.Arguments {
+		tokens = append(tokens, fmt.Sprintf("%q", argument))
+	}
+	line := strings.Join(tokens, " ")
+	if c.Dir != "" {
+		line += fmt.Sprintf(" (in %q)", c.Dir)
+	}
+	if c.User != nil {
+		line += fmt.Sprintf(" (as %s)", c.User.Name)
+	}
+	return line
+}
+
+// cachedPayload returns where a payload is downloaded to in the cache. Locations are
+// written with forward slashes, the backslashes of older pkginfos are accepted too.
+func cachedPayload(payload catalog.InstallerItem, cachePath string) string {
+	segments := []string{cachePath}
+	for _, segment := range strings.Split(strings.ReplaceAll(payload.Location, `\`, "/"), "/") {
+		segments = append(segments, catalog.UnescapeSegment(segment))
+	}
+	return filepath.Join(segments...)
+}
+
+// echoPending logs the command that would install or uninstall an item, for --echo-commands
+// in check only runs. Nothing is run, including the commands that compose it.
+func echoPending(item catalog.Item, installerType, cachePath string) {
+	commandDryRun = true
+	defer func() {
+		commandDryRun = false
+	}()
+
+	command, ok, err := pendingCommand(item, installerType, cachePath)
+	switch {
+	case err != nil:
+		logging.Warn("Unable to compose the command for", item.DisplayName, err)
+	case !ok:
+		logging.Info("[CHECK ONLY] The command is only known when it runs:", item.DisplayName)
+	default:
+		logging.Info("[CHECK ONLY] Would run:", command.String())
+	}
+}
+
+// pendingCommand composes the command that would install or uninstall an item, with its payload
+// at the path it is cached at, without downloading it. ok is false for items that are imported
+// rather than run, whose script is only written when it runs, or whose uninstall command is read
+// from the machine when it runs.
+func pendingCommand(item catalog.Item, installerType, cachePath string) (command Command, ok bool, err error) {
+	switch {
+	case installerType != "uninstall" && item.Installer.Type == "reg":
+		return Command{}, false, nil
+	case installerType != "uninstall" && item.Installer.Type == pkginfo.ScriptType,
+		installerType == "uninstall" && item.Uninstaller.Type == pkginfo.ScriptType:
+		// The script is written to a file of its own when it runs
+		return Command{}, false, nil
+	case installerType != "uninstall":
+		command, _, err = installCommand(item, cachedPayload(item.Installer, cachePath))
+	case item.Uninstaller.Type == uninstallerInstalled:
+		command = newCommand(item.Uninstaller.Location, expandArguments(item, item.Uninstaller.Arguments)...)
+	case item.Uninstaller.Location != "" && item.Uninstaller.Type != "nupkg" && item.Uninstaller.Type != "reg":
+		command, _, err = uninstallCommand(item, cachedPayload(item.Uninstaller, cachePath))
+	case item.Uninstaller.Location == "" && item.Installer.Type == "msi" && item.ProductCode != "":
+		command = newCommand(commandMsi, "/x", item.ProductCode, "/qn", "/norestart")
+	default:
+		return Command{}, false, nil
+	}
+	return command, err == nil, err
+}
@@ -0,0 +1,109 @@
+package installer
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/report"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// TestCommandString validates each argument is its own quoted token
+func TestCommandString(t *testing.T) {
+	command := Command{
+		Path:      `C:\Program Files\Example\setup.exe`,
+		Arguments: []string{"/S", `INSTALLDIR="C:\Example App"`, ""},
+	}
+	expected := `"C:\\Program Files\\Example\\setup.exe" "/S" "INSTALLDIR=\"C:\\Example App\"" ""`
+	if line := command.String(); line != expected {
+		t.Errorf("expected %s, got %s", expected, line)
+	}
+
+	command.Dir, command.User = `C:\cache`, &status.ConsoleUser{Name: `EXAMPLE\jdoe`}
+	if line := command.String(); line != expected+` (in "C:\\cache") (as EXAMPLE\jdoe)` {
+		t.Errorf("unexpected command with a directory and user: %s", line)
+	}
+}
+
+// TestPendingCommand validates the commands composed in check only runs use the cache paths
+func TestPendingCommand(t *testing.T) {
+	cachePath := t.TempDir()
+	item := uninstallerItem()
+
+	command, ok, err := pendingCommand(item, "install", cachePath)
+	if err != nil || !ok {
+		t.Fatalf("expected a command, got %v, %v", ok, err)
+	}
+	if command.Path != filepath.Join(cachePath, filepath.FromSlash(item.Installer.Location)) {
+		t.Errorf("expected the cached installer, got %s", command.Path)
+	}
+
+	command, ok, err = pendingCommand(item, "uninstall", cachePath)
+	if err != nil || !ok {
+		t.Fatalf("expected a command, got %v, %v", ok, err)
+	}
+	if command.Path != filepath.Join(cachePath, filepath.FromSlash(item.Uninstaller.Location)) {
+		t.Errorf("expected the cached uninstaller, got %s", command.Path)
+	}
+
+	item.Uninstaller = catalog.InstallerItem{}
+	item.Installer = catalog.InstallerItem{Type: "msi"}
+	item.ProductCode = "{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}"
+	command, ok, _ = pendingCommand(item, "uninstall", cachePath)
+	expected := []string{"/x", "{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}", "/qn", "/norestart"}
+	if !ok || command.Path != commandMsi || !reflect.DeepEqual(command.Arguments, expected) {
+		t.Errorf("expected msiexec /x for the product code, got %v", command)
+	}
+
+	item.Installer = catalog.InstallerItem{Type: "exe"}
+	if _, ok, _ := pendingCommand(item, "uninstall", cachePath); ok {
+		t.Errorf("expected the registry uninstall command to be unknown until it runs")
+	}
+}
+
+// TestInstallCheckOnlyEcho validates a check only run with echo commands downloads and runs nothing
+func TestInstallCheckOnlyEcho(t *testing.T) {
+	fake := fakeUninstall{}
+	cfg := fake.use(t)
+	cfg.CheckOnly, cfg.EchoCommands = true, true
+	t.Cleanup(func() {
+		report.InstalledItems, report.PendingItems = nil, nil
+	})
+
+	item := uninstallerItem()
+	if result := Install(context.Background(), item, "install", cfg); result != "Check only enabled" {
+		t.Errorf("expected a check only result, got %q", result)
+	}
+	if result := Install(context.Background(), item, "uninstall", cfg); result != "Check only enabled" {
+		t.Errorf("expected a check only result, got %q", result)
+	}
+	if len(fake.downloads) != 0 || len(fake.commands) != 0 {
+		t.Errorf("expected nothing downloaded or run, got %v and %v", fake.downloads, fake.commands)
+	}
+	if commandDryRun || commandEcho {
+		t.Errorf("echo left set")
+	}
+}
+
+// TestCachedPayloadSeparators validates locations with backslashes, forward slashes or both are cached at the same path
+func TestCachedPayloadSeparators(t *testing.T) {
+	want := filepath.Join("cache", "apps", "Firefox", "Firefox-128.0.msi")
+	for _, location := range []string{"/apps/Firefox/Firefox-128.0.msi", `\apps\Firefox\Firefox-128.0.msi`, `apps\Firefox/Firefox-128.0.msi`} {
+		if got := cachedPayload(catalog.InstallerItem{Location: location}, "cache"); got != want {
+			t.Errorf("cachedPayload(%q) = %s, want %s", location, got, want)
+		}
+	}
+}
+
+// TestCachedPayloadEscaped validates an escaped location is cached under the name of the file it stands for
+func TestCachedPayloadEscaped(t *testing.T) {
+	want := filepath.Join("cache", "apps", "VC Redist", "VC_redist (x64)+.exe")
+	for _, location := range []string{"apps/VC Redist/VC_redist (x64)+.exe", "apps/VC%20Redist/VC_redist%20%28x64%29%2B.exe"} {
+		if got := cachedPayload(catalog.InstallerItem{Location: location}, "cache"); got != want {
+			t.Errorf("cachedPayload(%q) = %s, want %s", location, got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// diskSpaceFactor is how many times its installer_item_size an install is expected
+// to take on the system drive, for the extracted files and the copy msiexec keeps
+const diskSpaceFactor = 2
+
+var (
+	// systemDrive is where installers put their files
+	systemDrive = os.Getenv("SystemDrive") + `\`
+
+	// This abstraction allows us to override when testing
+	freeSpace = diskFreeSpace
+)
+
+// itemSize returns the installer_item_size of an item in bytes, or 0 if it is unknown.
+// Catalogs made before the installer section have it as a flat field.
+func itemSize(item catalog.Item) int64 {
+	if item.Installer.Size > 0 {
+		return item.Installer.Size * 1024
+	}
+	if size, ok := item.Extras["installer_item_size"].(int); ok && size > 0 {
+		return int64(size) * 1024
+	}
+	return 0
+}
+
+// formatSize writes a number of bytes for people to read
+func formatSize(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// checkDiskSpace returns an error if an item doesn't fit on the disk. The download needs
+// the size of the installer in the cache, unless it is already there, and an install
+// needs diskSpaceFactor times the size on the system drive. Items without a size,
+// or when the free space can't be read, are not held back.
+func checkDiskSpace(item catalog.Item, cachePath string, install bool) error {
+	size := itemSize(item)
+	if size == 0 {
+		return nil
+	}
+
+	var cacheNeed, systemNeed uint64
+	if _, err := os.Stat(cachedPayload(item.Installer, cachePath)); err != nil {
+		cacheNeed = uint64(size)
+	}
+	if install {
+		systemNeed = uint64(size) * diskSpaceFactor
+	}
+
+	// The cache is usually on the system drive, then both are needed there
+	if filepath.VolumeName(filepath.Clean(cachePath)) == filepath.VolumeName(systemDrive) {
+		systemNeed += cacheNeed
+		cacheNeed = 0
+	}
+	for _, need := range []struct {
+		path  string
+		bytes uint64
+	}{{systemDrive, systemNeed}, {cachePath, cacheNeed}} {
+		if need.bytes == 0 {
+			continue
+		}
+		available, err := freeSpace(need.path)
+		if err != nil {
+			logging.Warn("Unable to check the free disk space", "path", need.path, "error", err)
+			continue
+		}
+		if available < need.bytes {
+			return fmt.Errorf("insufficient disk space (need %s, have %s)", formatSize(need.bytes), formatSize(available))
+		}
+	}
+	return nil
+}
+
+// CheckMinimumFreeSpace returns an error if the system drive has less free space than
+// `MinimumFreeSpaceMB`, so a run doesn't start installing on a nearly full disk
+func CheckMinimumFreeSpace(cfg config.Configuration) error {
+	if cfg.MinimumFreeSpaceMB <= 0 {
+		return nil
+	}
+	available, err := freeSpace(systemDrive)
+	if err != nil {
+		logging.Warn("Unable to check the free disk space", "path", systemDrive, "error", err)
+		return nil
+	}
+	minimum := uint64(cfg.MinimumFreeSpaceMB) * 1024 * 1024
+	if available < minimum {
+		return fmt.Errorf("insufficient disk space (need %s, have %s)", formatSize(minimum), formatSize(available))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package installer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// useFreeSpace reports free bytes for every path for the duration of the test
+func useFreeSpace(t *testing.T, free uint64) {
+	origFree := freeSpace
+	t.Cleanup(func() {
+		freeSpace = origFree
+		report.Warnings, report.PendingItems = nil, nil
+	})
+	freeSpace = func(path string) (uint64, error) {
+		return free, nil
+	}
+}
+
+// sizedItem returns a ps1 item with an installer_item_size in kilobytes
+func sizedItem(name string, sizeKB int64) catalog.Item {
+	return catalog.Item{
+		Name:        name,
+		DisplayName: name,
+		Version:     "1.0",
+		Installer:   catalog.InstallerItem{Type: "ps1", Location: "apps/" + name + ".ps1", Size: sizeKB},
+	}
+}
+
+// TestInstallInsufficientSpace validates an item that doesn't fit is skipped and reported,
+// while a smaller item is installed
+func TestInstallInsufficientSpace(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{false}}
+	cfg := fake.use(t)
+	useFreeSpace(t, 100*1024*1024)
+
+	// A 4 GB suite needs the download and twice its size to install
+	if result := InstallChecked(context.Background(), sizedItem("Suite", 4*1024*1024), "install", cfg, true); result != "Insufficient disk space" {
+		t.Errorf("unexpected result: %s", result)
+	}
+	if result := InstallChecked(context.Background(), sizedItem("Tool", 10*1024), "install", cfg, true); result != "" {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	if !reflect.DeepEqual(fake.calls, []string{"install Tool 1.0"}) {
+		t.Errorf("expected only Tool installed, got %v", fake.calls)
+	}
+	expected := "Skipped Suite: insufficient disk space (need 12.0 GB, have 100.0 MB)"
+	if len(report.Warnings) != 1 || report.Warnings[0] != expected {
+		t.Errorf("expected warning %q, got %v", expected, report.Warnings)
+	}
+	if len(report.PendingItems) != 1 {
+		t.Errorf("expected Suite pending, got %d pending items", len(report.PendingItems))
+	}
+}
+
+// TestCheckDiskSpaceCached validates a cached installer only needs the space to install
+func TestCheckDiskSpaceCached(t *testing.T) {
+	useFreeSpace(t, 25*1024*1024)
+	cachePath := t.TempDir()
+	item := sizedItem("Tool", 10*1024)
+
+	if err := checkDiskSpace(item, cachePath, true); err == nil || !strings.Contains(err.Error(), "need 30.0 MB") {
+		t.Errorf("expected the download and install to be needed, got %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(cachePath, "apps"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cachePath, "apps", "Tool.ps1"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDiskSpace(item, cachePath, true); err != nil {
+		t.Errorf("expected the cached item to fit, got %v", err)
+	}
+}
+
+// TestCheckDiskSpaceUnknown validates items without a size are never held back
+func TestCheckDiskSpaceUnknown(t *testing.T) {
+	useFreeSpace(t, 0)
+	if err := checkDiskSpace(sizedItem("Unsized", 0), t.TempDir(), true); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	legacy := sizedItem("Legacy", 0)
+	legacy.Extras = map[string]interface{}{"installer_item_size": 1024}
+	if err := checkDiskSpace(legacy, t.TempDir(), false); err == nil {
+		t.Error("expected the flat installer_item_size to be used")
+	}
+}
+
+// TestCheckMinimumFreeSpace validates MinimumFreeSpaceMB gates the run
+func TestCheckMinimumFreeSpace(t *testing.T) {
+	useFreeSpace(t, 500*1024*1024)
+
+	if err := CheckMinimumFreeSpace(config.Configuration{}); err != nil {
+		t.Errorf("expected no minimum without MinimumFreeSpaceMB, got %v", err)
+	}
+	if err := CheckMinimumFreeSpace(config.Configuration{MinimumFreeSpaceMB: 400}); err != nil {
+		t.Errorf("expected 500 MB to be enough, got %v", err)
+	}
+	err := CheckMinimumFreeSpace(config.Configuration{MinimumFreeSpaceMB: 1024})
+	if err == nil || err.Error() != "insufficient disk space (need 1.0 GB, have 500.0 MB)" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package installer
+
+import (
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+)
+
+// This abstraction allows us to override when testing
+var forceTime = time.Now
+
+// ForceInstallDue returns true when the force_install_after_date of an item has passed,
+// so it is installed even while the user is active or its blocking apps are running
+func ForceInstallDue(item catalog.Item) bool {
+	if item.ForceInstallAfter == "" {
+		return false
+	}
+	after, err := time.Parse(time.RFC3339, item.ForceInstallAfter)
+	if err != nil {
+		return false
+	}
+	return !forceTime().Before(after)
+}
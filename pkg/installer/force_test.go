@@ -0,0 +1,88 @@
+package installer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// useForceTime fixes the time force_install_after_date is compared with for the duration of the test
+func useForceTime(t *testing.T, now time.Time) {
+	origTime := forceTime
+	t.Cleanup(func() {
+		forceTime = origTime
+		report.ForceInstalledItems = nil
+	})
+	forceTime = func() time.Time { return now }
+}
+
+// TestForceInstallDue validates an item is forced once its date has passed
+func TestForceInstallDue(t *testing.T) {
+	useForceTime(t, time.Date(2024, 7, 12, 17, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		date string
+		due  bool
+	}{
+		{"", false},
+		{"2024-07-12T16:59:59Z", true},
+		{"2024-07-12T17:00:00Z", true},
+		{"2024-07-12T18:00:00+02:00", true},
+		{"2024-07-12T17:00:01Z", false},
+		{"next friday", false},
+	}
+	for _, tt := range tests {
+		item := blockingItem("")
+		item.ForceInstallAfter = tt.date
+		if due := ForceInstallDue(item); due != tt.due {
+			t.Errorf("%q: expected %v, got %v", tt.date, tt.due, due)
+		}
+	}
+}
+
+// TestBlockingAppsForced validates blocking apps are terminated instead of skipping a forced install
+func TestBlockingAppsForced(t *testing.T) {
+	useForceTime(t, time.Date(2024, 7, 12, 17, 0, 0, 0, time.UTC))
+	fake := &fakeProcesses{running: map[string]bool{"agent.exe": true}}
+	fake.use(t)
+
+	// Before the date the item is skipped as usual
+	item := blockingItem("")
+	item.ForceInstallAfter = "2024-07-13T00:00:00Z"
+	if clearBlockingApps(item) {
+		t.Errorf("expected the install to be skipped before the date")
+	}
+
+	item.ForceInstallAfter = "2024-07-12T00:00:00Z"
+	if !clearBlockingApps(item) {
+		t.Errorf("expected the forced install to continue")
+	}
+	if !reflect.DeepEqual(fake.steps, []string{"close agent.exe", "kill agent.exe"}) {
+		t.Errorf("unexpected steps: %v", fake.steps)
+	}
+	if len(report.Actions) != 2 || report.Actions[1].Action != "blocking_apps_terminate" {
+		t.Errorf("expected the apps to be terminated in the report, got %+v", report.Actions)
+	}
+}
+
+// TestInstallForcedReported validates a forced install is flagged in the report
+func TestInstallForcedReported(t *testing.T) {
+	useForceTime(t, time.Date(2024, 7, 12, 17, 0, 0, 0, time.UTC))
+	fake := &fakeInstaller{checks: []bool{true}}
+	cfg := fake.use(t)
+
+	item := sizedItem("Patch", 0)
+	item.ForceInstallAfter = "2024-07-12T00:00:00Z"
+	InstallChecked(context.Background(), item, "install", cfg, true)
+	InstallChecked(context.Background(), sizedItem("Tool", 0), "install", cfg, true)
+
+	if len(fake.calls) != 2 {
+		t.Errorf("expected both items installed, got %v", fake.calls)
+	}
+	if len(report.ForceInstalledItems) != 1 {
+		t.Errorf("expected only Patch flagged as force installed, got %v", report.ForceInstalledItems)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package installer
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// diskFreeSpace returns the bytes available to gorilla on the volume of a path
+func diskFreeSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(dir, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
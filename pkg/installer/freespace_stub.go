@@ -0,0 +1,13 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package installer
+
+import "errors"
+
+// diskFreeSpace is just a placeholder on darwin, the free space is never known
+func diskFreeSpace(path string) (uint64, error) {
+	return 0, errors.New("free disk space is only available on Windows")
+}
@@ -3,20 +3,24 @@ package installer
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"path"
 	"path/filepath"
 	"strings"
 	"sync"
 
 	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
 	"github.com/windowsadmins/gorilla/pkg/download"
 	"github.com/windowsadmins/gorilla/pkg/logging"
 	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/progress"
 	"github.com/windowsadmins/gorilla/pkg/report"
+	"github.com/windowsadmins/gorilla/pkg/rollback"
 	"github.com/windowsadmins/gorilla/pkg/status"
 )
 
@@ -25,24 +29,76 @@ var (
 	commandNupkg = filepath.Join(os.Getenv("ProgramData"), "chocolatey/bin/choco.exe")
 	commandMsi   = filepath.Join(os.Getenv("WINDIR"), "system32/", "msiexec.exe")
 	commandPs1   = filepath.Join(os.Getenv("WINDIR"), "system32/", "WindowsPowershell", "v1.0", "powershell.exe")
+	commandReg   = filepath.Join(os.Getenv("WINDIR"), "system32/", "reg.exe")
 
 	// These abstractions allows us to override when testing
 	execCommand       = exec.Command
 	statusCheckStatus = status.CheckStatus
 	runCommand        = runCMD
-
-	// Stores url where we will download an item
-	installerURL   string
-	uninstallerURL string
+	downloadIfNeeded  = download.IfNeeded
 )
 
-// runCommand executes a command and it's argurments in the CMD environment
-func runCMD(command string, arguments []string) (string, error) {
-	cmd := execCommand(command, arguments...)
+// downloadItem downloads a file of an item unless a valid copy is cached, sending the download
+// progress for the item, and returns true when the file is valid
+func downloadItem(item catalog.Item, filePath, url, hash string) bool {
+	defer progress.Track(url, item.Name, item.Version)()
+	return downloadIfNeeded(filePath, url, hash)
+}
+
+// rebootExitCode returns true when a command exited asking for a reboot,
+// with ERROR_SUCCESS_REBOOT_REQUIRED (3010) or ERROR_SUCCESS_REBOOT_INITIATED (1641)
+func rebootExitCode(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	code := exitErr.ExitCode()
+	return code == 3010 || code == 1641
+}
+
+// exitDescription describes how a command exited for the item log
+func exitDescription(err error) string {
+	if err == nil {
+		return "0"
+	}
+	return err.Error()
+}
+
+// runCMD executes a command and its arguments. In a dry run the command is only logged.
+func runCMD(c Command) (string, error) {
+	if commandDryRun {
+		logging.Info("[CHECK ONLY] Would run:", c.String())
+		return "", nil
+	}
+	if echoCommands() {
+		logging.Info("Running:", c.String())
+	}
+
+	cmd := execCommand(c.Path, c.Arguments...)
+	cmd.Dir = c.Dir
 	var cmdOutput string
+
+	// User scoped items run with the token and environment of the logged on user
+	if c.User != nil {
+		closeToken, err := runAsUser(cmd, *c.User)
+		if err != nil {
+			logging.Warn("command:", c.String())
+			logging.Warn("Unable to run as the logged on user:", err)
+			return "", err
+		}
+		defer closeToken()
+	}
+
+	// Copy all of the output to the item log, if one is open
+	output := c.Log
+	if output != nil {
+		fmt.Fprintf(output, "> %s\n", c.String())
+		cmd.Stderr = output
+	}
+
 	cmdReader, err := cmd.StdoutPipe()
 	if err != nil {
-		logging.Warn("command:", command, arguments)
+		logging.Warn("command:", c.String())
 		logging.Warn("Error creating pipe to stdout", err)
 	}
 
@@ -50,13 +106,16 @@ func runCMD(command string, arguments []string) (string, error) {
 	wg.Add(1)
 
 	scanner := bufio.NewScanner(cmdReader)
-	logging.Debug("command:", command, arguments)
+	logging.Debug("command:", c.String())
 	go func() {
 		logging.Debug("Command Output:")
 		logging.Debug("--------------------")
 		for scanner.Scan() {
 			logging.Debug(scanner.Text())
 			cmdOutput = scanner.Text()
+			if output != nil {
+				fmt.Fprintln(output, cmdOutput)
+			}
 		}
 		logging.Debug("--------------------")
 		wg.Done()
@@ -64,16 +123,32 @@ func runCMD(command string, arguments []string) (string, error) {
 
 	err = cmd.Start()
 	if err != nil {
-		logging.Warn("command:", command, arguments)
+		logging.Warn("command:", c.String())
 		logging.Warn("Error running command:", err)
 	}
 
+	// Give the command a chance to finish if Gorilla is asked to shut down
+	stopWatching := func() bool { return false }
+	if err == nil && c.Context != nil {
+		stopWatching = watchShutdown(c.Context, cmd)
+	}
+
 	wg.Wait()
 	err = cmd.Wait()
+	if stopWatching() {
+		err = fmt.Errorf("%w: %v", errInterrupted, err)
+	}
+	if rebootExitCode(err) {
+		logging.Info("Reboot required after:", c.Path)
+		report.RecordRebootRequired()
+	}
 	if err != nil {
-		logging.Warn("command:", command, arguments)
+		logging.Warn("command:", c.String())
 		logging.Warn("Command error:", err)
 	}
+	if output != nil {
+		fmt.Fprintf(output, "exit: %v\n", exitDescription(err))
+	}
 
 	return cmdOutput, err
 }
@@ -81,36 +156,76 @@ func runCMD(command string, arguments []string) (string, error) {
 // Get a Nupkg's id using `choco list`
 func getNupkgID(nupkgDir, versionArg string) string {
 
-	// Compile the arguments needed to get the id
-	command := commandNupkg
-	arguments := []string{"list", versionArg, "--id-only", "-r", "-s", nupkgDir}
-
 	// Run the command and trim the output
-	cmdOut, _ := runCommand(command, arguments)
+	cmdOut, _ := runCommand(newCommand(commandNupkg, "list", versionArg, "--id-only", "--limit-output", "-s", nupkgDir))
 	nupkgID := strings.TrimSpace(cmdOut)
 
 	// The final output should just be the nupkg id
 	return nupkgID
 }
 
-func installItem(item catalog.Item, itemURL, cachePath string) string {
+func installItem(item catalog.Item, itemURL, cachePath string) (string, error) {
 
-	// Determine the paths needed for download and install
-	relPath, fileName := path.Split(item.Installer.Location)
-	absPath := filepath.Join(cachePath, relPath)
-	absFile := filepath.Join(absPath, fileName)
+	// Determine the path needed for download and install
+	absFile := cachedPayload(item.Installer, cachePath)
 
-	// Download the item if it is needed
-	valid := download.IfNeeded(absFile, itemURL, item.Installer.Hash)
-	if !valid {
+	if item.Installer.Type == pkginfo.ScriptType {
+		// A script item runs its script, there is no payload to download
+		scriptFile, err := writeScript(item, item.Installer.Script, cachePath)
+		if err != nil {
+			msg := fmt.Sprint("Unable to write the install script: ", err)
+			logging.Warn(msg)
+			return msg, errors.New(msg)
+		}
+		defer os.Remove(scriptFile)
+		absFile = scriptFile
+	} else if valid := downloadItem(item, absFile, itemURL, item.Installer.Hash); !valid {
+		// Download the item if it is needed
 		msg := fmt.Sprint("Unable to download valid file: ", itemURL)
 		logging.Warn(msg)
-		return msg
+		return msg, errors.New(msg)
+	}
+
+	// A .reg file is imported rather than run
+	if item.Installer.Type == "reg" {
+		return installReg(item, absFile, cachePath)
 	}
 
 	// Determine the install type and command to pass
-	var installCmd string
+	command, msiLog, err := installCommand(item, absFile)
+	if err != nil {
+		logging.Warn(err.Error())
+		return err.Error(), err
+	}
+
+	// Run the command, saving its output to the item log
+	itemLog := startItemLog(item, cachePath)
+	if msiLog {
+		command.Arguments = append(command.Arguments, itemLog.msiArgs()...)
+	}
+	installerOut, errOut := runItemCommand(item, command.Dir, command.Path, command.Arguments)
+	logPath := itemLog.finish(errOut)
+
+	// Write success/failure event to log
+	if errOut != nil {
+		logging.Warn(item.DisplayName, item.Version, "Installation FAILED")
+	} else {
+		logging.Info(item.DisplayName, item.Version, "Installation SUCCESSFUL")
+	}
+
+	// Add the item to InstalledItems in GorillaReport
+	report.RecordInstalled(item)
+	report.RecordActionLog(item.Name, item.Version, "install", logPath, errOut)
+
+	return installerOut, errOut
+}
+
+// installCommand composes the command that installs an item from its payload at absFile.
+// msiLog is set for msiexec, which is given the item log with msiArgs.
+func installCommand(item catalog.Item, absFile string) (Command, bool, error) {
+	var installCmd, workDir string
 	var installArgs []string
+	var msiLog bool
 	if item.Installer.Type == "nupkg" {
 		// choco wants the "id" and parent dir when we install, so we need to determine both
 		logging.Info("Determining nupkg id for", item.DisplayName)
@@ -130,136 +245,149 @@ func installItem(item catalog.Item, itemURL, cachePath string) string {
 		installCmd = commandNupkg
 		if nupkgID != "" && versionArg != "" {
 			// Only use this form if we have an ID and version number
-			installArgs = []string{"install", nupkgID, "-s", nupkgDir, versionArg, "-f", "-y", "-r"}
+			installArgs = []string{"install", nupkgID, "-s", nupkgDir, versionArg, "-f", "--yes", "--limit-output"}
 		} else {
 			// If we dont have an id and version, fallback to the method choco doesn't recommend (but works)
-			installArgs = []string{"install", absFile, "-f", "-y", "-r"}
+			installArgs = []string{"install", absFile, "-f", "--yes", "--limit-output"}
 		}
+		installArgs = append(installArgs, expandArguments(item, item.Installer.Arguments)...)
 
 	} else if item.Installer.Type == "msi" {
 		logging.Info("Installing msi for", item.DisplayName)
 		installCmd = commandMsi
 		installArgs = []string{"/i", absFile, "/qn", "/norestart"}
-		installArgs = append(installArgs, item.Installer.Arguments...)
+		installArgs = append(installArgs, expandArguments(item, item.Installer.Arguments)...)
+		msiLog = true
 
 	} else if item.Installer.Type == "exe" {
 		logging.Info("Installing exe for", item.DisplayName)
 		installCmd = absFile
-		installArgs = item.Installer.Arguments
+		installArgs = expandArguments(item, item.Installer.Arguments)
 
-	} else if item.Installer.Type == "ps1" {
-		logging.Info("Installing ps1 for", item.DisplayName)
+	} else if item.Installer.Type == "ps1" || item.Installer.Type == pkginfo.ScriptType {
+		logging.Info("Installing "+item.Installer.Type+" for", item.DisplayName)
 		installCmd = commandPs1
 		installArgs = []string{"-NoProfile", "-NoLogo", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", absFile}
 
-	} else {
-		msg := fmt.Sprint("Unsupported installer type", item.Installer.Type)
-		logging.Warn(msg)
-		return msg
-	}
-
-	// Run the command
-	installerOut, errOut := runCommand(installCmd, installArgs)
+	} else if batchType(item.Installer.Type) {
+		logging.Info("Installing "+item.Installer.Type+" for", item.DisplayName)
+		var err error
+		installCmd, installArgs, err = batchCommand(absFile, expandArguments(item, item.Installer.Arguments))
+		if err != nil {
+			return Command{}, false, err
+		}
+		// Scripts expect to find the files they ship with next to them
+		workDir = filepath.Dir(absFile)
 
-	// Write success/failure event to log
-	if errOut != nil {
-		logging.Warn(item.DisplayName, item.Version, "Installation FAILED")
 	} else {
-		logging.Info(item.DisplayName, item.Version, "Installation SUCCESSFUL")
+		return Command{}, false, errors.New(fmt.Sprint("Unsupported installer type", item.Installer.Type))
 	}
-
-	// Add the item to InstalledItems in GorillaReport
-	report.InstalledItems = append(report.InstalledItems, item)
-
-	return installerOut
+	return Command{Path: installCmd, Arguments: installArgs, Dir: workDir}, msiLog, nil
 }
 
-func uninstallItem(item catalog.Item, itemURL, cachePath string) string {
+func uninstallItem(item catalog.Item, itemURL, cachePath string) (string, error) {
 
-	// Determine the paths needed for download and uinstall
-	relPath, fileName := path.Split(item.Uninstaller.Location)
-	absPath := filepath.Join(cachePath, relPath)
-	absFile := filepath.Join(absPath, fileName)
+	// Determine the path needed for download and uninstall
+	absFile := cachedPayload(item.Uninstaller, cachePath)
 
-	// Download the item if it is needed
-	valid := download.IfNeeded(absFile, itemURL, item.Uninstaller.Hash)
-	if !valid {
+	// A package is uninstalled by its id, which doesn't need the nupkg
+	if item.Uninstaller.Type == "nupkg" {
+		return uninstallNupkg(item, absFile, itemURL, cachePath)
+	}
+
+	if item.Uninstaller.Type == pkginfo.ScriptType {
+		// A script uninstaller runs its script, there is no payload to download
+		scriptFile, err := writeScript(item, item.Uninstaller.Script, cachePath)
+		if err != nil {
+			msg := fmt.Sprint("Unable to write the uninstall script: ", err)
+			logging.Warn(msg)
+			return msg, errors.New(msg)
+		}
+		defer os.Remove(scriptFile)
+		absFile = scriptFile
+	} else if valid := downloadItem(item, absFile, itemURL, item.Uninstaller.Hash); !valid {
+		// Download the item if it is needed
 		msg := fmt.Sprint("Unable to download valid file: ", itemURL)
 		logging.Warn(msg)
-		return msg
+		return msg, errors.New(msg)
+	}
+
+	// An undo .reg file is imported rather than run
+	if item.Uninstaller.Type == "reg" {
+		return uninstallReg(item, absFile, cachePath)
 	}
 
 	// Determine the uninstall type and build the command
-	var uninstallCmd string
-	var uninstallArgs []string
+	command, msiLog, err := uninstallCommand(item, absFile)
+	if err != nil {
+		logging.Warn(err.Error())
+		return err.Error(), err
+	}
 
-	if item.Uninstaller.Type == "nupkg" {
-		// choco wants the "id" and parent dir when we uninstall, so we need to determine both
-		logging.Info("Determining nupkg id for", item.DisplayName)
-		nupkgDir := filepath.Dir(absFile)
+	// Run the command, saving its output to the item log
+	itemLog := startItemLog(item, cachePath)
+	if msiLog {
+		command.Arguments = append(command.Arguments, itemLog.msiArgs()...)
+	}
+	uninstallerOut, errOut := runItemCommand(item, command.Dir, command.Path, command.Arguments)
 
-		// Since choco recommends the source is a directory,
-		// we need to pass a version to filter unexpected nupkgs (if we have a version)
-		var versionArg string
-		var nupkgID string
-		if item.Version != "" {
-			versionArg = fmt.Sprintf("--version=%s", item.Version)
-			nupkgID = getNupkgID(nupkgDir, versionArg)
-		}
+	// Write success/failure event to log and the report
+	recordUninstall(item, itemLog.finish(errOut), errOut)
 
-		// Now pass the id along with the parent directory
-		logging.Info("Uninstalling nupkg for", item.DisplayName)
-		uninstallCmd = commandNupkg
-		if nupkgID != "" && versionArg != "" {
-			// Only use this form if we have an ID and version number
-			uninstallArgs = []string{"uninstall", nupkgID, "-s", nupkgDir, versionArg, "-f", "-y", "-r"}
-		} else {
-			// If we dont have an id and version, fallback to the method choco doesn't recommend (but works)
-			uninstallArgs = []string{"uninstall", absFile, "-f", "-y", "-r"}
-		}
+	return uninstallerOut, errOut
+}
 
-	} else if item.Uninstaller.Type == "msi" {
+// uninstallCommand composes the command that uninstalls an item with its uninstaller at absFile.
+// msiLog is set for msiexec, which is given the item log with msiArgs.
+func uninstallCommand(item catalog.Item, absFile string) (Command, bool, error) {
+	var uninstallCmd, workDir string
+	var uninstallArgs []string
+	var msiLog bool
+
+	if item.Uninstaller.Type == "msi" {
 		logging.Info("Uninstalling msi for", item.DisplayName)
 		uninstallCmd = commandMsi
 		uninstallArgs = []string{"/x", absFile, "/qn", "/norestart"}
+		msiLog = true
 
 	} else if item.Uninstaller.Type == "exe" {
 		logging.Info("Uninstalling exe for", item.DisplayName)
 		uninstallCmd = absFile
-		uninstallArgs = item.Uninstaller.Arguments
+		uninstallArgs = expandArguments(item, item.Uninstaller.Arguments)
 
-	} else if item.Uninstaller.Type == "ps1" {
-		logging.Info("Uninstalling ps1 for", item.DisplayName)
+	} else if item.Uninstaller.Type == "ps1" || item.Uninstaller.Type == pkginfo.ScriptType {
+		logging.Info("Uninstalling "+item.Uninstaller.Type+" for", item.DisplayName)
 		uninstallCmd = commandPs1
 		uninstallArgs = []string{"-NoProfile", "-NoLogo", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", absFile}
 
-	} else {
-		msg := fmt.Sprint("Unsupported uninstaller type", item.Uninstaller.Type)
-		logging.Warn(msg)
-		return msg
-	}
-
-	// Run the command
-	uninstallerOut, errOut := runCommand(uninstallCmd, uninstallArgs)
+	} else if batchType(item.Uninstaller.Type) {
+		logging.Info("Uninstalling "+item.Uninstaller.Type+" for", item.DisplayName)
+		var err error
+		uninstallCmd, uninstallArgs, err = batchCommand(absFile, expandArguments(item, item.Uninstaller.Arguments))
+		if err != nil {
+			return Command{}, false, err
+		}
+		// Scripts expect to find the files they ship with next to them
+		workDir = filepath.Dir(absFile)
 
-	// Write success/failure event to log
-	if errOut != nil {
-		logging.Warn(item.DisplayName, item.Version, "Uninstallation FAILED")
 	} else {
-		logging.Info(item.DisplayName, item.Version, "Uninstallation SUCCESSFUL")
+		return Command{}, false, errors.New(fmt.Sprint("Unsupported uninstaller type", item.Uninstaller.Type))
 	}
+	return Command{Path: uninstallCmd, Arguments: uninstallArgs, Dir: workDir}, msiLog, nil
 
-	// Add the item to InstalledItems in GorillaReport
-	report.UninstalledItems = append(report.UninstalledItems, item)
-
-	return uninstallerOut
 }
 
 func preinstallScript(catalogItem catalog.Item, cachePath string) (actionNeeded bool, checkErr error) {
 
-	// Write InstallCheckScript to disk as a Powershell file
-	tmpScript := filepath.Join(cachePath, "tmpPostScript.ps1")
-	ioutil.WriteFile(tmpScript, []byte(catalogItem.PreScript), 0755)
+	// Write the script to disk as a Powershell file,
+	// named uniquely since script items may install concurrently
+	scriptFile, err := ioutil.TempFile(cachePath, "tmpPreScript-*.ps1")
+	if err != nil {
+		return false, err
+	}
+	tmpScript := scriptFile.Name()
+	scriptFile.WriteString(expandPlaceholders(catalogItem, catalogItem.PreScript))
+	scriptFile.Close()
 
 	// Build the command to execute the script
 	psCmd := filepath.Join(os.Getenv("WINDIR"), "system32/", "WindowsPowershell", "v1.0", "powershell.exe")
@@ -270,7 +398,7 @@ func preinstallScript(catalogItem catalog.Item, cachePath string) (actionNeeded
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	err := cmd.Run()
+	err = cmd.Run()
 	cmdSuccess := cmd.ProcessState.Success()
 	outStr, errStr := stdout.String(), stderr.String()
 
@@ -287,9 +415,15 @@ func preinstallScript(catalogItem catalog.Item, cachePath string) (actionNeeded
 
 func postinstallScript(catalogItem catalog.Item, cachePath string) (actionNeeded bool, checkErr error) {
 
-	// Write InstallCheckScript to disk as a Powershell file
-	tmpScript := filepath.Join(cachePath, "tmpPostScript.ps1")
-	ioutil.WriteFile(tmpScript, []byte(catalogItem.PostScript), 0755)
+	// Write the script to disk as a Powershell file,
+	// named uniquely since script items may install concurrently
+	scriptFile, err := ioutil.TempFile(cachePath, "tmpPostScript-*.ps1")
+	if err != nil {
+		return false, err
+	}
+	tmpScript := scriptFile.Name()
+	scriptFile.WriteString(expandPlaceholders(catalogItem, catalogItem.PostScript))
+	scriptFile.Close()
 
 	// Build the command to execute the script
 	psCmd := filepath.Join(os.Getenv("WINDIR"), "system32/", "WindowsPowershell", "v1.0", "powershell.exe")
@@ -300,7 +434,7 @@ func postinstallScript(catalogItem catalog.Item, cachePath string) (actionNeeded
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	err := cmd.Run()
+	err = cmd.Run()
 	cmdSuccess := cmd.ProcessState.Success()
 	outStr, errStr := stdout.String(), stderr.String()
 
@@ -323,31 +457,64 @@ var (
 
 // Install determines if action needs to be taken on a item and then
 // calls the appropriate function to install or uninstall
-func Install(item catalog.Item, installerType, urlPackages, cachePath string, checkOnly bool) string {
+func Install(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration) string {
 	// Check the status and determine if any action is needed for this item
-	actionNeeded, err := statusCheckStatus(item, installerType, cachePath)
+	actionNeeded, err := statusCheckStatus(item, installerType, cfg.CachePath)
 	if err != nil {
 		msg := fmt.Sprint("Unable to check status: ", err)
 		logging.Warn(msg)
 		return msg
 	}
+	return InstallChecked(ctx, item, installerType, cfg, actionNeeded)
+}
+
+// InstallChecked installs or uninstalls an item whose status was already checked.
+// When ctx is cancelled, the installer that is running is given a grace period to finish.
+func InstallChecked(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) string {
+	cachePath := cfg.CachePath
+	checkOnly := cfg.CheckOnly
 
 	// If no action is needed, return
 	if !actionNeeded {
 		return "Item not needed"
 	}
 
+	endInstall := beginInstall(item, ctx, cfg.EchoCommands)
+	defer endInstall()
+
 	// Install or uninstall the item
 	if installerType == "install" || installerType == "update" {
 		// Check if checkonly mode is enabled
 		if checkOnly {
-			report.InstalledItems = append(report.InstalledItems, item)
+			report.RecordInstalled(item)
+			report.RecordPending(item)
 			logging.Info("[CHECK ONLY] Skipping actions for", item.DisplayName)
+			if cfg.EchoCommands {
+				echoPending(item, installerType, cachePath)
+			}
 			// Check only mode doesn't perform any action, return
 			return "Check only enabled"
 		} else {
+			// Leave items that don't fit on the disk, smaller items may still
+			if err := checkDiskSpace(item, cachePath, true); err != nil {
+				msg := fmt.Sprintf("Skipped %s: %v", item.Name, err)
+				logging.Warn(msg)
+				report.RecordWarning(msg)
+				report.RecordPending(item)
+				return "Insufficient disk space"
+			}
+			if ForceInstallDue(item) {
+				logging.Info("Force installing, past its force_install_after_date:", item.DisplayName, item.ForceInstallAfter)
+				report.RecordForceInstalled(item)
+			}
 			// Compile the item's URL
-			itemURL := urlPackages + item.Installer.Location
+			itemURL := catalog.ItemURL(cfg, item)
+			// Close or wait for the apps that lock the files of exe and msi installs
+			if item.Installer.Type == "exe" || item.Installer.Type == "msi" {
+				if !clearBlockingApps(item) {
+					return "Blocking apps running"
+				}
+			}
 			// Run PreInstall_Script if needed
 			if item.PreScript != "" {
 				logging.Info("Running Pre-Install script for", item.DisplayName)
@@ -358,8 +525,30 @@ func Install(item catalog.Item, installerType, urlPackages, cachePath string, ch
 				}
 			}
 
+			// Record what is installed now so a failed upgrade can be undone
+			var rollbackManager *rollback.RollbackManager
+			if item.RollbackOnFailure {
+				rollbackManager = newRollback(item, cfg, recordPrevious(item, cachePath))
+			}
+
 			// Run the installer
-			installItemFunc(item, itemURL, cachePath)
+			showNotification(item)
+			installStart := logTime()
+			_, installErr := installItemFunc(item, itemURL, cachePath)
+			if errors.Is(installErr, errInterrupted) {
+				// A killed installer can leave the item half installed, so it is always undone
+				logging.Warn("Installer killed while shutting down, rolling back", item.DisplayName)
+				if rollbackManager == nil {
+					rollbackManager = newRollback(item, cfg, recordPrevious(item, cachePath))
+				}
+				detachShutdown(item)
+				runRollback(item, rollbackManager)
+				return "Interrupted"
+			}
+			if installErr != nil && rollbackManager != nil {
+				// The installer failed on its own, there is nothing new to undo
+				return "Installation failed"
+			}
 
 			// Run PostInstall_Script if needed
 			if item.PostScript != "" {
@@ -367,21 +556,46 @@ func Install(item catalog.Item, installerType, urlPackages, cachePath string, ch
 				postScriptSuccess, err := postinstallScript(item, cachePath)
 				if !postScriptSuccess {
 					logging.Error("Post-Install script error:", err)
+					runRollback(item, rollbackManager)
 					return "PostInstall-Script error"
 				}
 			}
+
+			// Some installers exit 0 having done nothing, so check the status again
+			if installErr == nil && !item.SkipVerification && !verifyInstall(item, installerType, cachePath) {
+				logging.Error("Verification failed after installing", item.DisplayName)
+				report.RecordAction(item.Name, item.Version, "verify", errVerificationFailed)
+				runRollback(item, rollbackManager)
+				return "Verification failed"
+			}
+
+			// Keep the payload for the next upgrade
+			if rollbackManager != nil {
+				if err := saveRollbackPayload(item, cachePath); err != nil {
+					logging.Warn("Unable to record the payload for rollback:", item.DisplayName, err)
+				}
+			}
+			if installErr == nil {
+				report.RecordHistory(item.Name, "install", "", item.Version, item.Installer.Type, logTime().Sub(installStart))
+			}
 		}
 	} else if installerType == "uninstall" {
 		if checkOnly {
-			report.InstalledItems = append(report.InstalledItems, item)
+			report.RecordInstalled(item)
+			report.RecordPending(item)
 			logging.Info("[CHECK ONLY] Skipping actions for", item.DisplayName)
+			if cfg.EchoCommands {
+				echoPending(item, installerType, cachePath)
+			}
 			// Check only mode doesn't perform any action, return
 			return "Check only enabled"
 		} else {
-			// Compile the item's URL
-			itemURL := urlPackages + item.Uninstaller.Location
-			// Run the installer
-			uninstallItemFunc(item, itemURL, cachePath)
+			// Run the uninstaller, downloading it first if needed
+			uninstallStart := logTime()
+			if _, err := uninstall(item, cfg); err != nil {
+				return "Uninstall failed"
+			}
+			report.RecordHistory(item.Name, "uninstall", item.Version, "", uninstallMethod(item), logTime().Sub(uninstallStart))
 		}
 	} else {
 		logging.Warn("Unsupported item type", item.DisplayName, installerType)
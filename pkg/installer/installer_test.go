@@ -0,0 +1,275 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/report"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// fakeExecCommand runs TestHelperProcess instead of the real command
+func fakeExecCommand(command string, args ...string) *exec.Cmd {
+	cs := []string{"-test.run=TestHelperProcess", "--", command}
+	cs = append(cs, args...)
+	cmd := exec.Command(os.Args[0], cs...)
+	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+	return cmd
+}
+
+// unknownProduct is a product code msiexec reports as not installed in TestHelperProcess
+const unknownProduct = "{6F1C8E43-2B7D-4E0A-9C55-000000001605}"
+
+// TestHelperProcess stands in for a failing postinstall script, an installer that
+// doesn't finish when it is run as slow.exe, or msiexec given unknownProduct
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	if len(os.Args) > 3 && os.Args[3] == "slow.exe" {
+		time.Sleep(time.Minute)
+	}
+	for _, arg := range os.Args[3:] {
+		if arg == unknownProduct {
+			os.Exit(1605)
+		}
+	}
+	fmt.Fprintln(os.Stdout, "helper stdout")
+	fmt.Fprintln(os.Stderr, "helper stderr")
+	os.Exit(1)
+}
+
+// fakeInstaller records the installs and uninstalls that would have run
+type fakeInstaller struct {
+	calls        []string
+	uninstallErr error
+	// checks are returned by statusCheckStatus in order, the last one repeats
+	checks []bool
+	// notified are the items the logged on user was told are installing
+	notified []string
+}
+
+// use overrides the package functions for the duration of the test
+func (f *fakeInstaller) use(t *testing.T) config.Configuration {
+	origInstall, origUninstall, origStatus := installItemFunc, uninstallItemFunc, statusCheckStatus
+	origApplication, origExec, origNotify := installedApplication, execCommand, showNotification
+	t.Cleanup(func() {
+		installItemFunc, uninstallItemFunc, statusCheckStatus = origInstall, origUninstall, origStatus
+		installedApplication, execCommand, showNotification = origApplication, origExec, origNotify
+		report.Actions, report.History = nil, nil
+	})
+	report.Actions, report.History = nil, nil
+
+	showNotification = func(item catalog.Item) {
+		f.notified = append(f.notified, item.Name)
+	}
+	installItemFunc = func(item catalog.Item, itemURL, cachePath string) (string, error) {
+		f.calls = append(f.calls, fmt.Sprintf("install %s %s", item.Name, item.Version))
+		return "", nil
+	}
+	uninstallItemFunc = func(item catalog.Item, itemURL, cachePath string) (string, error) {
+		f.calls = append(f.calls, fmt.Sprintf("uninstall %s %s", item.Name, item.Version))
+		return "", f.uninstallErr
+	}
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		check := f.checks[0]
+		if len(f.checks) > 1 {
+			f.checks = f.checks[1:]
+		}
+		return check, nil
+	}
+	installedApplication = func(name string) (status.RegistryApplication, bool) {
+		return status.RegistryApplication{Name: name, Version: "1.0", Uninstall: "uninstall.exe /S"}, true
+	}
+	execCommand = fakeExecCommand
+
+	return config.Configuration{CachePath: t.TempDir(), URL: "https://example.com/"}
+}
+
+func rollbackItem(version string) catalog.Item {
+	return catalog.Item{
+		Name:              "Example",
+		DisplayName:       "Example App",
+		Version:           version,
+		Installer:         catalog.InstallerItem{Type: "exe", Location: "apps/Example-" + version + ".exe"},
+		Uninstaller:       catalog.InstallerItem{Type: "exe", Location: "apps/Example-uninstall.exe"},
+		RollbackOnFailure: true,
+	}
+}
+
+// TestRollbackOnVerificationFailure validates the new version is uninstalled when it does not verify
+func TestRollbackOnVerificationFailure(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{true}}
+	cfg := fake.use(t)
+
+	result := Install(context.Background(), rollbackItem("2.0"), "update", cfg)
+	if result != "Verification failed" {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	expected := []string{"install Example 2.0", "uninstall Example 2.0"}
+	if !reflect.DeepEqual(fake.calls, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.calls)
+	}
+	if len(report.Actions) != 2 || report.Actions[0].Action != "verify" || report.Actions[1].Action != "rollback" || !report.Actions[1].Success {
+		t.Errorf("expected a failed verification and a successful rollback in the report, got %+v", report.Actions)
+	}
+}
+
+// TestRollbackReinstallsPrevious validates the previous cached payload is reinstalled
+// after the new version is removed when the postinstall script fails
+func TestRollbackReinstallsPrevious(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{true}}
+	cfg := fake.use(t)
+
+	// The previous version was installed by Gorilla and is still cached
+	previous := rollbackItem("1.0")
+	if err := saveRollbackPayload(previous, cfg.CachePath); err != nil {
+		t.Fatal(err)
+	}
+	cached := filepath.Join(cfg.CachePath, "apps", "Example-1.0.exe")
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cached, []byte("installer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	item := rollbackItem("2.0")
+	item.PostScript = "exit 1"
+	result := Install(context.Background(), item, "update", cfg)
+	if result != "PostInstall-Script error" {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	expected := []string{"install Example 2.0", "uninstall Example 2.0", "install Example 1.0"}
+	if !reflect.DeepEqual(fake.calls, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.calls)
+	}
+}
+
+// TestRollbackFailureReported validates a failed rollback is in the report
+func TestRollbackFailureReported(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{true}, uninstallErr: errors.New("exit status 1")}
+	cfg := fake.use(t)
+
+	Install(context.Background(), rollbackItem("2.0"), "update", cfg)
+	if len(report.Actions) != 2 || report.Actions[1].Success || report.Actions[1].Error == "" {
+		t.Errorf("expected a failed rollback in the report, got %+v", report.Actions)
+	}
+}
+
+// TestVerificationFailed validates an install whose status check still needs action is a failure
+func TestVerificationFailed(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{true}}
+	cfg := fake.use(t)
+
+	item := rollbackItem("2.0")
+	item.RollbackOnFailure = false
+	if result := InstallChecked(context.Background(), item, "update", cfg, true); result != "Verification failed" {
+		t.Errorf("unexpected result: %s", result)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].Action != "verify" || report.Actions[0].Success {
+		t.Fatalf("expected a failed verification in the report, got %+v", report.Actions)
+	}
+	if report.Actions[0].Error != "installed but verification failed" {
+		t.Errorf("unexpected error: %s", report.Actions[0].Error)
+	}
+}
+
+// TestVerificationPassed validates the status is checked again after the install
+func TestVerificationPassed(t *testing.T) {
+	// The first check finds the item missing, the check after the install finds it
+	fake := &fakeInstaller{checks: []bool{true, false}}
+	cfg := fake.use(t)
+
+	item := rollbackItem("2.0")
+	item.RollbackOnFailure = false
+	if result := Install(context.Background(), item, "update", cfg); result != "" {
+		t.Errorf("unexpected result: %s", result)
+	}
+	if len(report.Actions) != 0 {
+		t.Errorf("expected nothing in the report, got %+v", report.Actions)
+	}
+	if len(report.History) != 1 || report.History[0].ToVersion != "2.0" || report.History[0].Method != "exe" {
+		t.Errorf("expected the install in the history, got %+v", report.History)
+	}
+	if len(fake.notified) != 1 || fake.notified[0] != item.Name {
+		t.Errorf("expected one install notification, got %q", fake.notified)
+	}
+}
+
+// TestSkipVerification validates skip_verification leaves out the check after the install
+func TestSkipVerification(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{true}}
+	cfg := fake.use(t)
+
+	item := rollbackItem("2.0")
+	item.RollbackOnFailure = false
+	item.SkipVerification = true
+	if result := InstallChecked(context.Background(), item, "update", cfg, true); result != "" {
+		t.Errorf("unexpected result: %s", result)
+	}
+	if len(report.Actions) != 0 {
+		t.Errorf("expected nothing in the report, got %+v", report.Actions)
+	}
+}
+
+// TestNoRollbackWhenDisabled validates nothing is undone unless the item opts in
+func TestNoRollbackWhenDisabled(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{true}}
+	cfg := fake.use(t)
+
+	item := rollbackItem("2.0")
+	item.RollbackOnFailure = false
+	item.PostScript = "exit 1"
+	Install(context.Background(), item, "update", cfg)
+
+	expected := []string{"install Example 2.0"}
+	if !reflect.DeepEqual(fake.calls, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.calls)
+	}
+	if len(report.Actions) != 0 {
+		t.Errorf("expected no rollback in the report, got %+v", report.Actions)
+	}
+}
+
+// TestRollbackPayloadSaved validates a verified install is recorded for the next upgrade
+func TestRollbackPayloadSaved(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{true, false}}
+	cfg := fake.use(t)
+
+	item := rollbackItem("2.0")
+	if result := Install(context.Background(), item, "update", cfg); result != "" {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	// The record is only used while the installer is cached
+	if _, err := loadRollbackPayload("Example", cfg.CachePath); err == nil {
+		t.Errorf("expected an error while the installer is not cached")
+	}
+	cached := filepath.Join(cfg.CachePath, "apps", "Example-2.0.exe")
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cached, []byte("installer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := loadRollbackPayload("Example", cfg.CachePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payload.Version != "2.0" || payload.Installer.Location != item.Installer.Location {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+}
@@ -0,0 +1,143 @@
+package installer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// DefaultInstallLogRetention is how many days install logs are kept when the config doesn't say
+const DefaultInstallLogRetention = 14
+
+var (
+	// commandLogs are the open item logs by item name, where the output of the item's commands is copied
+	commandLogs   = make(map[string]io.Writer)
+	commandLogsMu sync.Mutex
+
+	// These abstractions allows us to override when testing
+	logTime      = time.Now
+	debugEnabled = logging.DebugEnabled
+)
+
+// InstallLogsDir returns where the install logs are kept in the cache
+func InstallLogsDir(cachePath string) string {
+	return filepath.Join(cachePath, "logs")
+}
+
+// itemLog is the log of one install or uninstall of an item
+type itemLog struct {
+	item    string
+	path    string
+	msiPath string
+	file    *os.File
+}
+
+// startItemLog opens a log for an install or uninstall of an item, named <item>-<version>-<timestamp>.log,
+// and copies the output of every command run to it until it is finished.
+// A log that can't be opened is only warned about, the install goes ahead without it.
+func startItemLog(item catalog.Item, cachePath string) *itemLog {
+	logsDir := InstallLogsDir(cachePath)
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		logging.Warn("Unable to create the install logs directory:", logsDir, err)
+		return nil
+	}
+
+	name := fmt.Sprintf("%s-%s-%s", logFileName(item.Name), logFileName(item.Version), logTime().Format("20060102-150405"))
+	l := &itemLog{
+		item:    item.Name,
+		path:    filepath.Join(logsDir, name+".log"),
+		msiPath: filepath.Join(logsDir, name+"-msi.log"),
+	}
+	file, err := os.Create(l.path)
+	if err != nil {
+		logging.Warn("Unable to create the install log:", l.path, err)
+		return nil
+	}
+	l.file = file
+	commandLogsMu.Lock()
+	commandLogs[item.Name] = file
+	commandLogsMu.Unlock()
+	return l
+}
+
+// msiArgs returns the arguments that write the verbose msiexec log next to the item log
+func (l *itemLog) msiArgs() []string {
+	if l == nil {
+		return nil
+	}
+	fmt.Fprintf(l.file, "msiexec verbose log: %s\n", l.msiPath)
+	return []string{"/l*v", l.msiPath}
+}
+
+// finish closes the log and returns its path for the report. The logs of successful
+// installs are only kept with debug logging.
+func (l *itemLog) finish(err error) string {
+	if l == nil {
+		return ""
+	}
+	commandLogsMu.Lock()
+	delete(commandLogs, l.item)
+	commandLogsMu.Unlock()
+	l.file.Close()
+
+	if err == nil && !debugEnabled() {
+		os.Remove(l.path)
+		os.Remove(l.msiPath)
+		return ""
+	}
+	return l.path
+}
+
+// itemCommandLog returns the open log of an item, or nil when it has none
+func itemCommandLog(item catalog.Item) io.Writer {
+	commandLogsMu.Lock()
+	defer commandLogsMu.Unlock()
+	return commandLogs[item.Name]
+}
+
+// logFileName replaces the characters Windows doesn't allow in file names
+func logFileName(name string) string {
+	if name == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?* `, r) || r < 32 {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// PruneInstallLogs removes install logs older than the retention in days
+func PruneInstallLogs(cachePath string, retentionDays int) {
+	if retentionDays <= 0 {
+		retentionDays = DefaultInstallLogRetention
+	}
+	cutoff := logTime().AddDate(0, 0, -retentionDays)
+
+	logsDir := InstallLogsDir(cachePath)
+	entries, err := os.ReadDir(logsDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Warn("Unable to read the install logs:", logsDir, err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		logging.Info("Removing old install log:", entry.Name())
+		if err := os.Remove(filepath.Join(logsDir, entry.Name())); err != nil {
+			logging.Warn("Unable to remove install log:", entry.Name(), err)
+		}
+	}
+}
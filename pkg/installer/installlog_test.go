@@ -0,0 +1,131 @@
+package installer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+)
+
+// useLogFakes fixes the log time and debug setting for the duration of the test
+func useLogFakes(t *testing.T, debug bool) {
+	origTime, origDebug, origExec := logTime, debugEnabled, execCommand
+	t.Cleanup(func() {
+		logTime, debugEnabled, execCommand = origTime, origDebug, origExec
+		commandLogs = make(map[string]io.Writer)
+	})
+	logTime = func() time.Time { return time.Date(2024, 7, 9, 14, 30, 0, 0, time.UTC) }
+	debugEnabled = func() bool { return debug }
+	execCommand = fakeExecCommand
+}
+
+// TestItemLogFailure validates the full output of a failed command is kept in the cache
+func TestItemLogFailure(t *testing.T) {
+	useLogFakes(t, false)
+	cachePath := t.TempDir()
+
+	item := catalog.Item{Name: "Example App", Version: "1.0"}
+	itemLog := startItemLog(item, cachePath)
+	command := newCommand("setup.exe", "/S")
+	command.Log = itemCommandLog(item)
+	_, errOut := runCMD(command)
+	logPath := itemLog.finish(errOut)
+
+	expected := filepath.Join(cachePath, "logs", "Example_App-1.0-20240709-143000.log")
+	if logPath != expected {
+		t.Fatalf("expected log %s, got %s", expected, logPath)
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`> "setup.exe" "/S"`, "helper stdout", "helper stderr", "exit: exit status 1"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("log is missing %q:\n%s", want, data)
+		}
+	}
+	if itemCommandLog(item) != nil {
+		t.Error("output is still copied after the log is finished")
+	}
+}
+
+// TestItemLogSuccess validates successful logs are only kept with debug logging
+func TestItemLogSuccess(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		useLogFakes(t, debug)
+		cachePath := t.TempDir()
+
+		itemLog := startItemLog(catalog.Item{Name: "Example", Version: "1.0"}, cachePath)
+		msiArgs := itemLog.msiArgs()
+		logPath := itemLog.finish(nil)
+
+		if debug != (logPath != "") {
+			t.Errorf("debug %v: unexpected log path %q", debug, logPath)
+		}
+		expectedMsi := filepath.Join(cachePath, "logs", "Example-1.0-20240709-143000-msi.log")
+		if len(msiArgs) != 2 || msiArgs[0] != "/l*v" || msiArgs[1] != expectedMsi {
+			t.Errorf("unexpected msiexec log arguments: %v", msiArgs)
+		}
+		entries, _ := os.ReadDir(filepath.Join(cachePath, "logs"))
+		if debug != (len(entries) == 1) {
+			t.Errorf("debug %v: unexpected logs left: %d", debug, len(entries))
+		}
+	}
+}
+
+// TestItemLogUnavailable validates an install goes ahead when its log can't be created
+func TestItemLogUnavailable(t *testing.T) {
+	useLogFakes(t, false)
+	cachePath := filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(cachePath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	itemLog := startItemLog(catalog.Item{Name: "Example", Version: "1.0"}, cachePath)
+	if itemLog != nil || itemLog.msiArgs() != nil || itemLog.finish(errors.New("failed")) != "" {
+		t.Error("expected no item log")
+	}
+}
+
+// TestPruneInstallLogs validates only logs past the retention are removed
+func TestPruneInstallLogs(t *testing.T) {
+	useLogFakes(t, false)
+	cachePath := t.TempDir()
+	logsDir := InstallLogsDir(cachePath)
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	now := logTime()
+	ages := map[string]int{"recent.log": 2, "week.log": 8, "old.log": 20}
+	for name, days := range ages {
+		path := filepath.Join(logsDir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.AddDate(0, 0, -days)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	PruneInstallLogs(cachePath, 7)
+
+	for name, days := range ages {
+		_, err := os.Stat(filepath.Join(logsDir, name))
+		if kept := err == nil; kept != (days < 7) {
+			t.Errorf("%s: kept %v", name, kept)
+		}
+	}
+
+	// The default retention applies when none is configured
+	PruneInstallLogs(cachePath, 0)
+	if _, err := os.Stat(filepath.Join(logsDir, "recent.log")); err != nil {
+		t.Errorf("recent.log was removed with the default retention: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package installer
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// maxNotificationLength is the most characters of a message shown in a notification,
+// about what fits in the body of a toast without it being cut off
+const maxNotificationLength = 200
+
+// toastAppID is the app that shows the notifications. Windows only shows toasts of
+// registered apps, PowerShell is registered on every machine.
+const toastAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// This abstraction allows us to override when testing
+var showNotification = notifyInstall
+
+// notifyInstall tells the logged on user an item is installing, with its user_message
+// or description. Nothing is shown when nobody is logged on.
+func notifyInstall(item catalog.Item) {
+	user, ok := consoleUser()
+	if !ok {
+		return
+	}
+	title, message := notificationText(item)
+	if _, err := runCommand(Command{Path: commandPs1, Arguments: []string{"-NoProfile", "-NonInteractive", "-EncodedCommand", encodeCommand(toastScript(title, message))}, User: &user}); err != nil {
+		logging.Debug("Unable to show the install notification for", item.DisplayName, err)
+	}
+}
+
+// notificationText returns the title and message of the notification for an item.
+// The message is the user_message, or the description, shortened to maxNotificationLength.
+// Without either, the title alone says what is installing.
+func notificationText(item catalog.Item) (title, message string) {
+	name := item.DisplayName
+	if name == "" {
+		name = item.Name
+	}
+	title = strings.TrimSpace(fmt.Sprintf("Installing %s %s", name, item.Version))
+
+	message = item.UserMessage
+	if strings.TrimSpace(message) == "" {
+		message = item.Description
+	}
+	return title, truncateMessage(message, maxNotificationLength)
+}
+
+// truncateMessage puts a message on one line and shortens it to at most max characters,
+// at the end of a word when there is one in its second half
+func truncateMessage(message string, max int) string {
+	message = strings.Join(strings.Fields(message), " ")
+	runes := []rune(message)
+	if len(runes) <= max {
+		return message
+	}
+	cut := string(runes[:max-1])
+	if space := strings.LastIndex(cut, " "); space > len(cut)/2 {
+		cut = cut[:space]
+	}
+	return strings.TrimRight(cut, " .,;:") + "…"
+}
+
+// toastScript returns the PowerShell that shows a toast with a title and message
+func toastScript(title, message string) string {
+	text := "<text>" + html.EscapeString(title) + "</text>"
+	if message != "" {
+		text += "<text>" + html.EscapeString(message) + "</text>"
+	}
+	xml := `<toast><visual><binding template="ToastGeneric">` + text + `</binding></visual></toast>`
+	return strings.Join([]string{
+		"[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null",
+		"[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null",
+		"$xml = New-Object Windows.Data.Xml.Dom.XmlDocument",
+		"$xml.LoadXml('" + strings.ReplaceAll(xml, "'", "''") + "')",
+		"$toast = New-Object Windows.UI.Notifications.ToastNotification $xml",
+		"[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('" + toastAppID + "').Show($toast)",
+	}, "\n")
+}
+
+// encodeCommand returns a script for powershell -EncodedCommand, which takes it as base64 UTF-16LE,
+// so the message is passed without any quoting on the command line
+func encodeCommand(script string) string {
+	units := utf16.Encode([]rune(script))
+	data := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(data[2*i:], u)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
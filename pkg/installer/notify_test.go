@@ -0,0 +1,94 @@
+package installer
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// TestNotificationText validates the user_message is preferred to the description,
+// and the title alone is shown without either
+func TestNotificationText(t *testing.T) {
+	item := catalog.Item{Name: "Zoom", DisplayName: "Zoom Workplace", Version: "6.1.0", Description: "Video meetings"}
+	if title, message := notificationText(item); title != "Installing Zoom Workplace 6.1.0" || message != "Video meetings" {
+		t.Errorf("unexpected notification: %q %q", title, message)
+	}
+
+	item.UserMessage = "IT is updating Zoom to fix a security issue"
+	if _, message := notificationText(item); message != item.UserMessage {
+		t.Errorf("expected the user message, got %q", message)
+	}
+
+	absent := catalog.Item{Name: "Zoom", Version: "6.1.0", UserMessage: "  "}
+	if title, message := notificationText(absent); title != "Installing Zoom 6.1.0" || message != "" {
+		t.Errorf("expected only the title, got %q %q", title, message)
+	}
+}
+
+// TestTruncateMessage validates long messages are put on one line and cut at a word
+func TestTruncateMessage(t *testing.T) {
+	if got := truncateMessage("Restarts\n  Zoom  ", 20); got != "Restarts Zoom" {
+		t.Errorf("unexpected short message: %q", got)
+	}
+
+	long := strings.Repeat("Zoom is updated to fix a security issue. ", 10)
+	got := truncateMessage(long, maxNotificationLength)
+	if len([]rune(got)) > maxNotificationLength || !strings.HasSuffix(got, "…") {
+		t.Errorf("expected at most %d characters ending in an ellipsis, got %d: %q", maxNotificationLength, len([]rune(got)), got)
+	}
+	if cut := strings.TrimSuffix(got, "…"); !strings.HasPrefix(long, cut+" ") {
+		t.Errorf("expected the message cut after a word, got %q", got)
+	}
+
+	if got := truncateMessage(strings.Repeat("é", 30), 10); got != strings.Repeat("é", 9)+"…" {
+		t.Errorf("expected a word longer than the limit cut by character, got %q", got)
+	}
+}
+
+// TestNotifyInstall validates the toast runs as the logged on user, and not at all without one
+func TestNotifyInstall(t *testing.T) {
+	origUser, origRun := consoleUser, runCommand
+	t.Cleanup(func() { consoleUser, runCommand = origUser, origRun })
+
+	var commands []Command
+	runCommand = func(c Command) (string, error) {
+		commands = append(commands, c)
+		return "", nil
+	}
+	item := catalog.Item{Name: "Zoom", Version: "6.1.0", UserMessage: "IT's updating <Zoom>"}
+
+	consoleUser = func() (status.ConsoleUser, bool) { return status.ConsoleUser{}, false }
+	notifyInstall(item)
+	if len(commands) != 0 {
+		t.Fatalf("expected no notification without a logged on user, got %v", commands)
+	}
+
+	consoleUser = func() (status.ConsoleUser, bool) { return status.ConsoleUser{Name: `EXAMPLE\jdoe`, SessionID: 2}, true }
+	notifyInstall(item)
+	if len(commands) != 1 || commands[0].User == nil || commands[0].User.Name != `EXAMPLE\jdoe` {
+		t.Fatalf("expected the notification as the logged on user, got %v", commands)
+	}
+	script := decodeCommand(t, commands[0].Arguments[len(commands[0].Arguments)-1])
+	if !strings.Contains(script, "<text>Installing Zoom 6.1.0</text><text>IT&#39;s updating &lt;Zoom&gt;</text>") {
+		t.Errorf("expected the escaped title and message in the script, got:\n%s", script)
+	}
+}
+
+// decodeCommand reverses encodeCommand
+func decodeCommand(t *testing.T, encoded string) string {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,73 @@
+package installer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// nupkgFallbackID is the package id of an item whose nupkg can't be read, its product code or name
+func nupkgFallbackID(item catalog.Item) string {
+	if item.ProductCode != "" {
+		return item.ProductCode
+	}
+	return item.Name
+}
+
+// nupkgInstalled asks choco whether a package is installed locally, copying its output to the
+// item log. With --limit-output, choco prints each installed package as id|version.
+func nupkgInstalled(item catalog.Item, id string) (bool, error) {
+	listCommand := newCommand(commandNupkg, "list", "--local-only", id, "--exact", "--yes", "--limit-output")
+	listCommand.Log, listCommand.Context = itemCommandLog(item), itemShutdown(item)
+	cmdOut, err := runCommand(listCommand)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(cmdOut, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "|", 2)
+		if len(fields) == 2 && strings.EqualFold(fields[0], id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// uninstallNupkg removes a package with choco uninstall. choco uninstalls from the packages
+// it has installed, wherever they came from, so no source is passed. The package id is read
+// from the cached nupkg, or taken from the item when the nupkg can't be downloaded.
+// A package that is not installed counts as uninstalled.
+func uninstallNupkg(item catalog.Item, absFile, itemURL, cachePath string) (string, error) {
+	var nupkgID string
+	if downloadItem(item, absFile, itemURL, item.Uninstaller.Hash) {
+		if item.Version != "" {
+			logging.Info("Determining nupkg id for", item.DisplayName)
+			nupkgID = getNupkgID(filepath.Dir(absFile), fmt.Sprintf("--version=%s", item.Version))
+		}
+	} else {
+		logging.Warn("Unable to download valid file, uninstalling by the item's package id:", itemURL)
+	}
+	if nupkgID == "" {
+		nupkgID = nupkgFallbackID(item)
+	}
+
+	itemLog := startItemLog(item, cachePath)
+	installed, err := nupkgInstalled(item, nupkgID)
+	if err != nil {
+		logging.Warn("Unable to list the installed packages, uninstalling anyway:", nupkgID, err)
+		installed = true
+	}
+	if !installed {
+		logging.Info("Package is not installed, nothing to uninstall:", item.DisplayName, nupkgID)
+		recordUninstall(item, itemLog.finish(nil), nil)
+		return "", nil
+	}
+
+	logging.Info("Uninstalling nupkg for", item.DisplayName, nupkgID)
+	uninstallArgs := []string{"uninstall", nupkgID, "--yes", "--limit-output"}
+	uninstallerOut, errOut := runItemCommand(item, "", commandNupkg, uninstallArgs)
+	recordUninstall(item, itemLog.finish(errOut), errOut)
+	return uninstallerOut, errOut
+}
@@ -0,0 +1,98 @@
+package installer
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// fakeChoco answers choco list with the packages installed, recording every command
+func fakeChoco(f *fakeUninstall, installed string) {
+	runCommand = func(c Command) (string, error) {
+		arguments := c.Arguments
+		f.commands = append(f.commands, strings.Join(append([]string{"choco"}, arguments...), " "))
+		switch {
+		case len(arguments) > 1 && arguments[1] == "--local-only":
+			return installed, nil
+		case arguments[0] == "list":
+			return "example-pkg\n", nil
+		}
+		return "", nil
+	}
+}
+
+func nupkgItem() catalog.Item {
+	return catalog.Item{
+		Name:        "Example",
+		DisplayName: "Example App",
+		Version:     "1.0",
+		Installer:   catalog.InstallerItem{Type: "nupkg", Location: "apps/Example.nupkg"},
+		Uninstaller: catalog.InstallerItem{Type: "nupkg", Location: "apps/Example.nupkg"},
+	}
+}
+
+// TestUninstallNupkgInstalled validates an installed package is uninstalled by its id, without a source
+func TestUninstallNupkgInstalled(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+	fakeChoco(fake, "Example-Pkg|1.0\n")
+
+	if _, err := uninstall(nupkgItem(), cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"choco list --version=1.0 --id-only --limit-output -s " + filepath.Join(cfg.CachePath, "apps"),
+		"choco list --local-only example-pkg --exact --yes --limit-output",
+		"choco uninstall example-pkg --yes --limit-output",
+	}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Errorf("expected commands %v, got %v", expected, fake.commands)
+	}
+}
+
+// TestUninstallNupkgNotInstalled validates a package that is not installed counts as uninstalled
+func TestUninstallNupkgNotInstalled(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+	fakeChoco(fake, "")
+
+	if _, err := uninstall(nupkgItem(), cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, command := range fake.commands {
+		if strings.HasPrefix(command, "choco uninstall") {
+			t.Errorf("expected no uninstall, got %v", fake.commands)
+		}
+	}
+	if len(report.Actions) != 1 || !report.Actions[0].Success {
+		t.Errorf("expected a successful uninstall to be recorded, got %+v", report.Actions)
+	}
+}
+
+// TestUninstallNupkgMissingCache validates the item name is the package id when the nupkg can't be downloaded
+func TestUninstallNupkgMissingCache(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+	fakeChoco(fake, "Example|1.0\n")
+	downloadIfNeeded = func(filePath, url, hash string) bool {
+		return false
+	}
+
+	if _, err := uninstall(nupkgItem(), cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"choco list --local-only Example --exact --yes --limit-output",
+		"choco uninstall Example --yes --limit-output",
+	}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Errorf("expected commands %v, got %v", expected, fake.commands)
+	}
+}
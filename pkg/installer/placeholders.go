@@ -0,0 +1,104 @@
+package installer
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// placeholderPattern matches %% and the names between percent signs, such as %HOSTNAME% and %CONFIG:LicenseKey%
+var placeholderPattern = regexp.MustCompile(`%%|%([A-Za-z_][A-Za-z0-9_]*(?::[^%\r\n]+)?)%`)
+
+var (
+	// placeholderCache is the value of %GORILLA_CACHE%
+	placeholderCache string
+
+	// placeholderVariables are the values of %CONFIG:name%
+	placeholderVariables map[string]string
+
+	// These abstractions allows us to override when testing
+	placeholderHostname = os.Hostname
+	placeholderSerial   = report.SerialNumber
+)
+
+// Configure sets the cache path and the variables the placeholders of installer arguments and scripts expand to
+func Configure(cfg config.Configuration) {
+	placeholderCache = cfg.CachePath
+	placeholderVariables = cfg.Variables
+}
+
+// expandPlaceholders replaces the placeholders in installer arguments and scripts just before they run:
+//
+//	%GORILLA_CACHE%          the cache path
+//	%GORILLA_ITEM_VERSION%   the version of the item
+//	%HOSTNAME%               the name of this machine
+//	%SERIAL%                 the BIOS serial number
+//	%CONFIG:name%            the variable of that name in the variables of the configuration
+//
+// %% is a literal percent sign, so %%HOSTNAME%% is passed as %HOSTNAME%. A placeholder without
+// a value, such as a misspelled %GORILLA_...% or a missing variable, is left as it is and warned
+// about. Other names between percent signs, such as environment variables, are left for the program.
+func expandPlaceholders(item catalog.Item, s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	return placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "%%" {
+			return "%"
+		}
+		name := match[1 : len(match)-1]
+		if value, ok := placeholderValue(item, name); ok {
+			return value
+		}
+		if strings.HasPrefix(name, "GORILLA_") || strings.HasPrefix(name, "CONFIG:") || name == "HOSTNAME" || name == "SERIAL" {
+			logging.Warn("Unknown placeholder, leaving it as it is:", item.DisplayName, match)
+		}
+		return match
+	})
+}
+
+// placeholderValue returns the value of a placeholder name, without the percent signs
+func placeholderValue(item catalog.Item, name string) (string, bool) {
+	if key := strings.TrimPrefix(name, "CONFIG:"); key != name {
+		if value, ok := placeholderVariables[key]; ok {
+			return value, true
+		}
+		for variable, value := range placeholderVariables {
+			if strings.EqualFold(variable, key) {
+				return value, true
+			}
+		}
+		return "", false
+	}
+
+	switch name {
+	case "GORILLA_CACHE":
+		return placeholderCache, placeholderCache != ""
+	case "GORILLA_ITEM_VERSION":
+		return item.Version, true
+	case "HOSTNAME":
+		hostname, err := placeholderHostname()
+		return hostname, err == nil && hostname != ""
+	case "SERIAL":
+		serial := placeholderSerial()
+		return serial, serial != ""
+	}
+	return "", false
+}
+
+// expandArguments returns the arguments of an item's installer or uninstaller with their placeholders expanded
+func expandArguments(item catalog.Item, arguments []string) []string {
+	if arguments == nil {
+		return nil
+	}
+	expanded := make([]string, len(arguments))
+	for i, argument := range arguments {
+		expanded[i] = expandPlaceholders(item, argument)
+	}
+	return expanded
+}
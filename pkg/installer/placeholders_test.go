@@ -0,0 +1,72 @@
+package installer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// usePlaceholders configures the placeholders with fixed values for the duration of the test
+func usePlaceholders(t *testing.T) {
+	origCache, origVariables, origHostname, origSerial := placeholderCache, placeholderVariables, placeholderHostname, placeholderSerial
+	t.Cleanup(func() {
+		placeholderCache, placeholderVariables, placeholderHostname, placeholderSerial = origCache, origVariables, origHostname, origSerial
+	})
+	Configure(config.Configuration{
+		CachePath: `C:\ProgramData\ManagedInstalls\Cache`,
+		Variables: map[string]string{"LicenseKey": "ABCD-1234"},
+	})
+	placeholderHostname = func() (string, error) { return "PC-042", nil }
+	placeholderSerial = func() string { return "SN-1234" }
+}
+
+// TestExpandPlaceholders validates each placeholder, the %% escape and that other names are left alone
+func TestExpandPlaceholders(t *testing.T) {
+	usePlaceholders(t)
+	item := catalog.Item{Name: "Example", Version: "2.0"}
+
+	tests := []struct {
+		in, want string
+	}{
+		{`LOGDIR=%GORILLA_CACHE%\logs`, `LOGDIR=C:\ProgramData\ManagedInstalls\Cache\logs`},
+		{"/version=%GORILLA_ITEM_VERSION%", "/version=2.0"},
+		{"/name=%HOSTNAME%-%SERIAL%", "/name=PC-042-SN-1234"},
+		{"PIDKEY=%CONFIG:LicenseKey%", "PIDKEY=ABCD-1234"},
+		{"PIDKEY=%CONFIG:licensekey%", "PIDKEY=ABCD-1234"},
+		{"/discount=50%", "/discount=50%"},
+		{"/discount=50%%", "/discount=50%"},
+		{"%%HOSTNAME%%", "%HOSTNAME%"},
+		{"%ProgramFiles%\\Example", "%ProgramFiles%\\Example"},
+		{"%GORILLA_UNKNOWN%", "%GORILLA_UNKNOWN%"},
+		{"%CONFIG:Missing%", "%CONFIG:Missing%"},
+		{"gci | % { $_.Name }", "gci | % { $_.Name }"},
+	}
+	for _, tt := range tests {
+		if got := expandPlaceholders(item, tt.in); got != tt.want {
+			t.Errorf("expandPlaceholders(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestInstallCommandExpandsArguments validates the installer arguments are expanded when the command is composed
+func TestInstallCommandExpandsArguments(t *testing.T) {
+	usePlaceholders(t)
+	item := catalog.Item{
+		Name:      "Example",
+		Version:   "2.0",
+		Installer: catalog.InstallerItem{Type: "exe", Arguments: []string{"/S", "/KEY=%CONFIG:LicenseKey%"}},
+	}
+
+	command, _, err := installCommand(item, `C:\cache\setup.exe`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"/S", "/KEY=ABCD-1234"}; !reflect.DeepEqual(command.Arguments, want) {
+		t.Errorf("unexpected arguments: %q", command.Arguments)
+	}
+	if item.Installer.Arguments[1] != "/KEY=%CONFIG:LicenseKey%" {
+		t.Errorf("the item was changed: %q", item.Installer.Arguments)
+	}
+}
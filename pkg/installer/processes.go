@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package installer
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// listProcesses returns the executable names of the running processes
+func listProcesses() ([]string, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	var names []string
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	err = windows.Process32First(snapshot, &entry)
+	for err == nil {
+		names = append(names, windows.UTF16ToString(entry.ExeFile[:]))
+		err = windows.Process32Next(snapshot, &entry)
+	}
+	if err != windows.ERROR_NO_MORE_FILES {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,11 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package installer
+
+// listProcesses is just a placeholder on darwin, no processes are reported
+func listProcesses() ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,105 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/regfile"
+	"github.com/windowsadmins/gorilla/pkg/report"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+var (
+	// These abstractions allows us to override when testing
+	regApply     = regfile.Apply
+	regDeleteKey = regfile.DeleteKey
+)
+
+// installReg imports the .reg file of a reg item, such as a policy payload
+func installReg(item catalog.Item, absFile, cachePath string) (string, error) {
+	logging.Info("Importing reg for", item.DisplayName)
+	itemLog := startItemLog(item, cachePath)
+	installerOut, errOut := importRegFile(item, absFile)
+	logPath := itemLog.finish(errOut)
+
+	if errOut != nil {
+		logging.Warn(item.DisplayName, item.Version, "Installation FAILED")
+	} else {
+		logging.Info(item.DisplayName, item.Version, "Installation SUCCESSFUL")
+	}
+
+	// Add the item to InstalledItems in GorillaReport
+	report.RecordInstalled(item)
+	report.RecordActionLog(item.Name, item.Version, "install", logPath, errOut)
+
+	return installerOut, errOut
+}
+
+// uninstallReg imports the undo .reg file that is the uninstaller of a reg item
+func uninstallReg(item catalog.Item, absFile, cachePath string) (string, error) {
+	logging.Info("Importing reg uninstaller for", item.DisplayName)
+	itemLog := startItemLog(item, cachePath)
+	uninstallerOut, errOut := importRegFile(item, absFile)
+	recordUninstall(item, itemLog.finish(errOut), errOut)
+	return uninstallerOut, errOut
+}
+
+// importRegFile parses a .reg file and applies it. The file is parsed first so a malformed file
+// changes nothing and its error names the line. Machine items are applied directly, user scoped
+// items are imported with reg.exe as the logged on user, into their HKCU.
+func importRegFile(item catalog.Item, absFile string) (string, error) {
+	keys, err := regfile.ParseFile(absFile)
+	if err != nil {
+		logging.Warn("Unable to import", item.DisplayName, err)
+		logCommandOutput(item, err.Error())
+		return err.Error(), err
+	}
+
+	if status.UserScoped(item) {
+		return runItemCommand(item, "", commandReg, []string{"import", absFile})
+	}
+
+	logCommandOutput(item, fmt.Sprintf("Importing %d keys from %s", len(keys), absFile))
+	if err := regApply(keys); err != nil {
+		if errors.Is(err, regfile.ErrAccessDenied) {
+			logging.Warn("The registry refused", item.DisplayName, "run gorilla as SYSTEM:", err)
+		} else {
+			logging.Warn("Unable to import", item.DisplayName, err)
+		}
+		logCommandOutput(item, err.Error())
+		return err.Error(), err
+	}
+	return "", nil
+}
+
+// uninstallRegistryKeys removes a reg item without an uninstaller by deleting the keys it set
+func uninstallRegistryKeys(item catalog.Item, cachePath string) (string, error) {
+	logging.Info("Deleting the registry keys of", item.DisplayName, strings.Join(item.RegistryKeys, ", "))
+	itemLog := startItemLog(item, cachePath)
+
+	var errOut error
+	for _, key := range item.RegistryKeys {
+		logCommandOutput(item, "Deleting "+key)
+		if err := regDeleteKey(key); err != nil {
+			logging.Warn("Unable to delete", key, err)
+			logCommandOutput(item, err.Error())
+			errOut = err
+			break
+		}
+	}
+	recordUninstall(item, itemLog.finish(errOut), errOut)
+	if errOut != nil {
+		return errOut.Error(), errOut
+	}
+	return "", nil
+}
+
+// logCommandOutput writes a line to the item log, for steps that don't run a command
+func logCommandOutput(item catalog.Item, line string) {
+	if output := itemCommandLog(item); output != nil {
+		fmt.Fprintln(output, line)
+	}
+}
@@ -0,0 +1,162 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/regfile"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// fakeRegistry records the keys applied and deleted by reg items
+type fakeRegistry struct {
+	applied []string
+	deleted []string
+	err     error
+}
+
+// use overrides the registry functions for the duration of the test
+func (f *fakeRegistry) use(t *testing.T) {
+	origApply, origDelete := regApply, regDeleteKey
+	t.Cleanup(func() {
+		regApply, regDeleteKey = origApply, origDelete
+	})
+	regApply = func(keys []regfile.Key) error {
+		for _, key := range keys {
+			f.applied = append(f.applied, key.Path)
+		}
+		return f.err
+	}
+	regDeleteKey = func(path string) error {
+		f.deleted = append(f.deleted, path)
+		return f.err
+	}
+}
+
+const policyReg = "Windows Registry Editor Version 5.00\r\n\r\n[HKEY_LOCAL_MACHINE\\SOFTWARE\\Policies\\Example]\r\n\"Enabled\"=dword:00000001\r\n"
+
+func regItem() catalog.Item {
+	return catalog.Item{
+		Name:         "ExamplePolicy",
+		DisplayName:  "Example Policy",
+		Version:      "1.0",
+		Installer:    catalog.InstallerItem{Type: "reg", Location: "policies/ExamplePolicy.reg"},
+		RegistryKeys: []string{`HKLM\SOFTWARE\Policies\Example`},
+	}
+}
+
+// cacheFile writes a payload to the cache, as if it was downloaded
+func cacheFile(t *testing.T, cachePath, location, data string) string {
+	path := filepath.Join(cachePath, filepath.FromSlash(location))
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestInstallReg validates a .reg file is applied without running a command
+func TestInstallReg(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+	registry := &fakeRegistry{}
+	registry.use(t)
+	t.Cleanup(func() { report.InstalledItems = nil })
+
+	cacheFile(t, cfg.CachePath, regItem().Installer.Location, policyReg)
+	if _, err := installItem(regItem(), catalog.ItemURL(cfg, regItem()), cfg.CachePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(registry.applied, []string{`HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Example`}) {
+		t.Errorf("unexpected keys applied: %v", registry.applied)
+	}
+	if len(fake.commands) != 0 {
+		t.Errorf("expected no commands, got %v", fake.commands)
+	}
+	if len(report.Actions) != 1 || !report.Actions[0].Success {
+		t.Errorf("expected a successful install, got %+v", report.Actions)
+	}
+}
+
+// TestInstallRegMalformed validates a malformed file changes nothing and is reported as malformed
+func TestInstallRegMalformed(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+	registry := &fakeRegistry{}
+	registry.use(t)
+	t.Cleanup(func() { report.InstalledItems = nil })
+
+	cacheFile(t, cfg.CachePath, regItem().Installer.Location, "[HKEY_LOCAL_MACHINE\\SOFTWARE\\Policies\\Example]\r\n")
+	_, err := installItem(regItem(), catalog.ItemURL(cfg, regItem()), cfg.CachePath)
+	if !errors.Is(err, regfile.ErrMalformed) {
+		t.Errorf("expected a malformed file, got %v", err)
+	}
+	if len(registry.applied) != 0 {
+		t.Errorf("expected nothing applied, got %v", registry.applied)
+	}
+}
+
+// TestInstallRegAccessDenied validates a refused change is reported as access denied
+func TestInstallRegAccessDenied(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+	registry := &fakeRegistry{err: regfile.ErrAccessDenied}
+	registry.use(t)
+	t.Cleanup(func() { report.InstalledItems = nil })
+
+	cacheFile(t, cfg.CachePath, regItem().Installer.Location, policyReg)
+	_, err := installItem(regItem(), catalog.ItemURL(cfg, regItem()), cfg.CachePath)
+	if !errors.Is(err, regfile.ErrAccessDenied) || errors.Is(err, regfile.ErrMalformed) {
+		t.Errorf("expected access denied, got %v", err)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].Success {
+		t.Errorf("expected a failed install, got %+v", report.Actions)
+	}
+}
+
+// TestUninstallRegUndo validates the undo .reg file of a reg item is applied to uninstall it
+func TestUninstallRegUndo(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+	registry := &fakeRegistry{}
+	registry.use(t)
+
+	item := regItem()
+	item.Uninstaller = catalog.InstallerItem{Type: "reg", Location: "policies/ExamplePolicy_undo.reg"}
+	cacheFile(t, cfg.CachePath, item.Uninstaller.Location, "Windows Registry Editor Version 5.00\r\n\r\n[-HKEY_LOCAL_MACHINE\\SOFTWARE\\Policies\\Example]\r\n")
+	Install(context.Background(), item, "uninstall", cfg)
+
+	if !reflect.DeepEqual(registry.applied, []string{`HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Example`}) || len(registry.deleted) != 0 {
+		t.Errorf("expected the undo file to be applied, got %v and %v", registry.applied, registry.deleted)
+	}
+	if len(report.Actions) != 1 || !report.Actions[0].Success {
+		t.Errorf("expected a successful uninstall, got %+v", report.Actions)
+	}
+}
+
+// TestUninstallRegistryKeys validates a reg item without an uninstaller is removed by its keys
+func TestUninstallRegistryKeys(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+	registry := &fakeRegistry{}
+	registry.use(t)
+
+	if !CanUninstall(regItem()) {
+		t.Errorf("expected a reg item with registry keys to be uninstallable")
+	}
+	Install(context.Background(), regItem(), "uninstall", cfg)
+
+	if !reflect.DeepEqual(registry.deleted, regItem().RegistryKeys) {
+		t.Errorf("unexpected keys deleted: %v", registry.deleted)
+	}
+	if len(fake.downloads) != 0 || len(fake.commands) != 0 {
+		t.Errorf("expected no downloads or commands, got %v and %v", fake.downloads, fake.commands)
+	}
+}
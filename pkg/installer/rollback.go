@@ -0,0 +1,154 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/report"
+	"github.com/windowsadmins/gorilla/pkg/rollback"
+	"github.com/windowsadmins/gorilla/pkg/status"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// This abstraction allows us to override when testing
+	installedApplication = status.InstalledApplication
+)
+
+// previousInstall is what was installed before an upgrade
+type previousInstall struct {
+	Version string
+
+	// Item is the last payload installed by Gorilla, if it is still cached
+	Item *catalog.Item
+}
+
+// registryName is the name an item has in the uninstall registry
+func registryName(item catalog.Item) string {
+	if item.Check.Registry.Name != "" {
+		return item.Check.Registry.Name
+	}
+	if item.DisplayName != "" {
+		return item.DisplayName
+	}
+	return item.Name
+}
+
+// recordPrevious looks up the installed version of an item,
+// and the payload Gorilla last installed for it
+func recordPrevious(item catalog.Item, cachePath string) previousInstall {
+	var previous previousInstall
+	if app, ok := installedApplication(registryName(item)); ok {
+		previous.Version = app.Version
+		logging.Info("Installed before upgrade:", item.DisplayName, app.Version)
+	}
+
+	payload, err := loadRollbackPayload(item.Name, cachePath)
+	if err != nil {
+		logging.Debug("No payload to roll back to for", item.Name, err)
+	} else if payload.Version != item.Version {
+		previous.Item = payload
+	}
+	return previous
+}
+
+// newRollback registers the actions that undo an install. They run in reverse,
+// so the new version is uninstalled before the previous one is reinstalled.
+func newRollback(item catalog.Item, cfg config.Configuration, previous previousInstall) *rollback.RollbackManager {
+	rollbackManager := &rollback.RollbackManager{}
+
+	if previous.Item != nil {
+		previousItem := *previous.Item
+		rollbackManager.AddRollbackAction(rollback.RollbackAction{
+			Description: fmt.Sprintf("Reinstalling %s %s", previousItem.Name, previousItem.Version),
+			Execute: func() error {
+				_, err := installItemFunc(previousItem, catalog.ItemURL(cfg, previousItem), cfg.CachePath)
+				return err
+			},
+		})
+	}
+
+	rollbackManager.AddRollbackAction(rollback.RollbackAction{
+		Description: fmt.Sprintf("Uninstalling %s %s", item.Name, item.Version),
+		Execute: func() error {
+			return uninstallNewVersion(item, cfg)
+		},
+	})
+	return rollbackManager
+}
+
+// uninstallNewVersion removes a version that was just installed
+func uninstallNewVersion(item catalog.Item, cfg config.Configuration) error {
+	_, err := uninstall(item, cfg)
+	return err
+}
+
+// runRollback undoes an install, if rollback is enabled for it, and reports the result
+func runRollback(item catalog.Item, rollbackManager *rollback.RollbackManager) {
+	if rollbackManager == nil {
+		return
+	}
+	logging.Warn("Rolling back", item.DisplayName, item.Version)
+	err := rollbackManager.ExecuteRollback()
+	if err != nil {
+		logging.Error("Rollback failed for", item.DisplayName, err)
+	} else {
+		logging.Info("Rollback succeeded for", item.DisplayName)
+	}
+	report.RecordAction(item.Name, item.Version, "rollback", err)
+}
+
+// errVerificationFailed is reported when the status check still needs action after an install
+var errVerificationFailed = errors.New("installed but verification failed")
+
+// verifyInstall checks the status again, reading the registry fresh
+func verifyInstall(item catalog.Item, installerType, cachePath string) bool {
+	status.ResetRegistryItems()
+	actionNeeded, err := statusCheckStatus(item, installerType, cachePath)
+	if err != nil {
+		logging.Warn("Unable to verify", item.DisplayName, err)
+		return false
+	}
+	return !actionNeeded
+}
+
+// rollbackPayloadPath is where the last installed payload of an item is recorded
+func rollbackPayloadPath(name, cachePath string) string {
+	return filepath.Join(cachePath, "rollback", name+".yaml")
+}
+
+// saveRollbackPayload records an installed item so the next upgrade can go back to it
+func saveRollbackPayload(item catalog.Item, cachePath string) error {
+	data, err := yaml.Marshal(item)
+	if err != nil {
+		return err
+	}
+	recordPath := rollbackPayloadPath(item.Name, cachePath)
+	if err := os.MkdirAll(filepath.Dir(recordPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(recordPath, data, 0644)
+}
+
+// loadRollbackPayload returns the last installed item, if its installer is still cached
+func loadRollbackPayload(name, cachePath string) (*catalog.Item, error) {
+	data, err := ioutil.ReadFile(rollbackPayloadPath(name, cachePath))
+	if err != nil {
+		return nil, err
+	}
+	var item catalog.Item
+	if err := yaml.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(cachedPayload(item.Installer, cachePath)); err != nil {
+		return nil, fmt.Errorf("payload is no longer cached: %v", err)
+	}
+	return &item, nil
+}
@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package installer
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+
+	"github.com/windowsadmins/gorilla/pkg/status"
+	"golang.org/x/sys/windows"
+)
+
+// runAsUser starts the command with the token and environment of the user logged on
+// in the session. The returned function closes the token once the command has finished.
+func runAsUser(cmd *exec.Cmd, user status.ConsoleUser) (func(), error) {
+	var token windows.Token
+	if err := windows.WTSQueryUserToken(user.SessionID, &token); err != nil {
+		return nil, fmt.Errorf("unable to get the token of %s: %v", user.Name, err)
+	}
+
+	env, err := token.Environ(false)
+	if err != nil {
+		token.Close()
+		return nil, fmt.Errorf("unable to get the environment of %s: %v", user.Name, err)
+	}
+	cmd.Env = env
+	cmd.SysProcAttr = &syscall.SysProcAttr{Token: syscall.Token(token)}
+	return func() { token.Close() }, nil
+}
@@ -0,0 +1,18 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package installer
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// runAsUser is not supported on darwin, user scoped items can't be installed
+func runAsUser(cmd *exec.Cmd, user status.ConsoleUser) (func(), error) {
+	return nil, errors.New("installing as the logged on user is only supported on Windows")
+}
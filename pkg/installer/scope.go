@@ -0,0 +1,36 @@
+package installer
+
+import (
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// This abstraction allows us to override when testing
+var consoleUser = status.ActiveConsoleUser
+
+// itemUser returns the logged on user a user scoped item is installed as, or nil for machine scoped items
+func itemUser(item catalog.Item) (*status.ConsoleUser, error) {
+	if !status.UserScoped(item) {
+		return nil, nil
+	}
+	user, ok := consoleUser()
+	if !ok {
+		return nil, status.ErrNoConsoleUser
+	}
+	logging.Info("Running as the logged on user for", item.DisplayName, user.Name)
+	return &user, nil
+}
+
+// runItemCommand runs an installer or uninstaller of an item in workDir, or the current
+// directory when it is empty, as the logged on user for user scoped items. The command is
+// stopped at shutdown with the install of the item.
+func runItemCommand(item catalog.Item, workDir, command string, arguments []string) (string, error) {
+	user, err := itemUser(item)
+	if err != nil {
+		logging.Warn("Unable to run for", item.DisplayName, err)
+		return err.Error(), err
+	}
+
+	return runCommand(Command{Path: command, Arguments: arguments, Dir: workDir, User: user, Log: itemCommandLog(item), Context: itemShutdown(item)})
+}
@@ -0,0 +1,56 @@
+package installer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// TestInstallUserScope validates user scoped items run as the logged on user, and machine ones don't
+func TestInstallUserScope(t *testing.T) {
+	fake := fakeUninstall{}
+	cfg := fake.use(t)
+	origUser := consoleUser
+	t.Cleanup(func() { consoleUser = origUser })
+	user := status.ConsoleUser{Name: `EXAMPLE\jdoe`, SID: "S-1-5-21-1000", SessionID: 1}
+	consoleUser = func() (status.ConsoleUser, bool) { return user, true }
+
+	var ranAs []*status.ConsoleUser
+	runCommand = func(c Command) (string, error) {
+		ranAs = append(ranAs, c.User)
+		return "", nil
+	}
+
+	item := uninstallerItem()
+	item.InstallScope = status.ScopeUser
+	if _, err := installItem(item, "https://example.com/Example.exe", cfg.CachePath); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	item.InstallScope = ""
+	if _, err := installItem(item, "https://example.com/Example.exe", cfg.CachePath); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	if len(ranAs) != 2 || ranAs[0] == nil || *ranAs[0] != user || ranAs[1] != nil {
+		t.Errorf("unexpected users: %v", ranAs)
+	}
+}
+
+// TestInstallUserScopeNoUser validates a user scoped item fails without running when nobody is logged on
+func TestInstallUserScopeNoUser(t *testing.T) {
+	fake := fakeUninstall{}
+	cfg := fake.use(t)
+	origUser := consoleUser
+	t.Cleanup(func() { consoleUser = origUser })
+	consoleUser = func() (status.ConsoleUser, bool) { return status.ConsoleUser{}, false }
+
+	item := uninstallerItem()
+	item.InstallScope = status.ScopeUser
+	if _, err := installItem(item, "https://example.com/Example.exe", cfg.CachePath); !errors.Is(err, status.ErrNoConsoleUser) {
+		t.Errorf("expected ErrNoConsoleUser, got %v", err)
+	}
+	if len(fake.commands) != 0 {
+		t.Errorf("unexpected commands: %v", fake.commands)
+	}
+}
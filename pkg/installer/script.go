@@ -0,0 +1,29 @@
+package installer
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+)
+
+// writeScript writes the script of a script installer or uninstaller to the cache as a PowerShell
+// file, named uniquely since script items may install concurrently. The caller removes it once it has run.
+func writeScript(item catalog.Item, script, cachePath string) (string, error) {
+	if err := os.MkdirAll(cachePath, 0755); err != nil {
+		return "", err
+	}
+	scriptFile, err := ioutil.TempFile(cachePath, "tmpScript-*.ps1")
+	if err != nil {
+		return "", err
+	}
+	_, err = scriptFile.WriteString(expandPlaceholders(item, script))
+	if closeErr := scriptFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(scriptFile.Name())
+		return "", err
+	}
+	return scriptFile.Name(), nil
+}
@@ -0,0 +1,64 @@
+package installer
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// scriptItem returns an item installed and uninstalled by its scripts
+func scriptItem() catalog.Item {
+	return catalog.Item{
+		Name:        "Wallpaper",
+		DisplayName: "Wallpaper",
+		Version:     "1.0",
+		Installer:   catalog.InstallerItem{Type: "script", Script: "Set-Wallpaper %GORILLA_ITEM_VERSION%"},
+		Uninstaller: catalog.InstallerItem{Type: "script", Script: "Remove-Wallpaper"},
+	}
+}
+
+// TestInstallScript validates the scripts of an item are written to the cache and run with
+// PowerShell, without a download, and removed once they have run
+func TestInstallScript(t *testing.T) {
+	fake := fakeUninstall{}
+	cfg := fake.use(t)
+	var scripts []string
+	runCommand = func(c Command) (string, error) {
+		if c.Path != commandPs1 || c.Arguments[len(c.Arguments)-2] != "-File" {
+			t.Errorf("expected a PowerShell script, got %s", c.String())
+		}
+		script, err := ioutil.ReadFile(c.Arguments[len(c.Arguments)-1])
+		if err != nil {
+			t.Errorf("the script wasn't written: %v", err)
+		}
+		scripts = append(scripts, string(script))
+		return "", nil
+	}
+
+	item := scriptItem()
+	if _, err := installItem(item, catalog.ItemURL(cfg, item), cfg.CachePath); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	Install(context.Background(), item, "uninstall", cfg)
+
+	if !reflect.DeepEqual(scripts, []string{"Set-Wallpaper 1.0", "Remove-Wallpaper"}) {
+		t.Errorf("unexpected scripts: %q", scripts)
+	}
+	if len(fake.downloads) != 0 {
+		t.Errorf("expected no downloads, got %v", fake.downloads)
+	}
+	if len(report.Actions) != 2 || !report.Actions[1].Success {
+		t.Errorf("expected an install and an uninstall, got %+v", report.Actions)
+	}
+	if left, _ := filepath.Glob(filepath.Join(cfg.CachePath, "*.ps1")); len(left) != 0 {
+		t.Errorf("expected the scripts to be removed, got %v", left)
+	}
+	if !CanUninstall(item) {
+		t.Error("expected an item with an uninstall script to be uninstallable")
+	}
+}
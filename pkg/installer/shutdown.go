@@ -0,0 +1,130 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+var (
+	// shutdownContexts are the contexts of the installs under way by item name, cancelled when
+	// Gorilla is asked to shut down. The commands of each item are given shutdownGrace to finish.
+	shutdownContexts = make(map[string]context.Context)
+
+	// commandsMu guards shutdownContexts, commandEcho and graceEnded, which the installs running at once share
+	commandsMu sync.Mutex
+
+	// installsRunning counts the installs under way, the command settings are cleared after the last one
+	installsRunning int
+
+	// graceEnded is closed by EndShutdownGrace to kill the commands still in their grace period.
+	// It is guarded by commandsMu.
+	graceEnded = make(chan struct{})
+
+	// This abstraction allows us to override when testing
+	shutdownGrace = 2 * time.Minute
+)
+
+// EndShutdownGrace kills the commands waiting out their shutdown grace period right away,
+// for when Gorilla is asked to shut down a second time
+func EndShutdownGrace() {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	select {
+	case <-graceEnded:
+	default:
+		close(graceEnded)
+	}
+}
+
+// resetShutdownGrace gives the commands started from now on their grace period again
+func resetShutdownGrace() {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	graceEnded = make(chan struct{})
+}
+
+// beginInstall sets the shutdown context of the commands an install of item runs and their echo,
+// and returns the function that ends the install. The echo is cleared once no other install is running.
+func beginInstall(item catalog.Item, ctx context.Context, echo bool) func() {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	installsRunning++
+	shutdownContexts[item.Name], commandEcho = ctx, echo
+	return func() {
+		commandsMu.Lock()
+		defer commandsMu.Unlock()
+		installsRunning--
+		delete(shutdownContexts, item.Name)
+		if installsRunning == 0 {
+			commandEcho = false
+		}
+	}
+}
+
+// detachShutdown stops the commands of item started from now on being killed at shutdown,
+// for the rollback of an install that was interrupted
+func detachShutdown(item catalog.Item) {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	delete(shutdownContexts, item.Name)
+}
+
+// itemShutdown returns the shutdown context of the install of item under way, nil when there is none
+func itemShutdown(item catalog.Item) context.Context {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	return shutdownContexts[item.Name]
+}
+
+// echoCommands returns true when the commands of the running installs are logged before they run
+func echoCommands() bool {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	return commandEcho
+}
+
+// errInterrupted is returned for a command killed because Gorilla was shutting down
+var errInterrupted = errors.New("interrupted by shutdown")
+
+// watchShutdown kills cmd if it is still running shutdownGrace after ctx is cancelled,
+// or once EndShutdownGrace is called.
+// The returned function is called once cmd exited, and reports whether it was killed.
+func watchShutdown(ctx context.Context, cmd *exec.Cmd) func() bool {
+	commandsMu.Lock()
+	ended := graceEnded
+	commandsMu.Unlock()
+	exited := make(chan struct{})
+	killed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-exited:
+			killed <- false
+			return
+		case <-ctx.Done():
+		}
+
+		logging.Warn("Shutting down, waiting for the command to finish:", cmd.Path, shutdownGrace)
+		timer := time.NewTimer(shutdownGrace)
+		defer timer.Stop()
+		select {
+		case <-exited:
+			killed <- false
+		case <-timer.C:
+			logging.Warn("Killing the command after the shutdown grace period:", cmd.Path)
+			killed <- cmd.Process.Kill() == nil
+		case <-ended:
+			logging.Warn("Killing the command, shutdown was requested again:", cmd.Path)
+			killed <- cmd.Process.Kill() == nil
+		}
+	}()
+	return func() bool {
+		close(exited)
+		return <-killed
+	}
+}
@@ -0,0 +1,123 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// useShutdown runs commands with the grace period for the duration of the test, and returns a cancelled context
+func useShutdown(t *testing.T, grace time.Duration) context.Context {
+	origExec, origGrace := execCommand, shutdownGrace
+	t.Cleanup(func() {
+		execCommand, shutdownGrace = origExec, origGrace
+		resetShutdownGrace()
+	})
+	execCommand, shutdownGrace = fakeExecCommand, grace
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// TestShutdownKillsCommand validates a command still running after the grace period is killed
+func TestShutdownKillsCommand(t *testing.T) {
+	ctx := useShutdown(t, 100*time.Millisecond)
+
+	start := time.Now()
+	_, err := runCMD(Command{Path: "slow.exe", Context: ctx})
+	if !errors.Is(err, errInterrupted) {
+		t.Errorf("expected the command to be interrupted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("expected the command to be killed, it ran for %s", elapsed)
+	}
+}
+
+// TestEndShutdownGrace validates a second shutdown request kills the command without waiting out the grace period
+func TestEndShutdownGrace(t *testing.T) {
+	ctx := useShutdown(t, time.Hour)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(100 * time.Millisecond)
+		EndShutdownGrace()
+	}()
+	defer func() { <-done }()
+
+	start := time.Now()
+	_, err := runCMD(Command{Path: "slow.exe", Context: ctx})
+	if !errors.Is(err, errInterrupted) {
+		t.Errorf("expected the command to be interrupted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("expected the command to be killed, it ran for %s", elapsed)
+	}
+}
+
+// TestShutdownCommandFinishes validates a command that finishes in the grace period keeps its result
+func TestShutdownCommandFinishes(t *testing.T) {
+	ctx := useShutdown(t, time.Minute)
+
+	_, err := runCMD(Command{Path: "setup.exe", Arguments: []string{"/S"}, Context: ctx})
+	if err == nil || errors.Is(err, errInterrupted) {
+		t.Errorf("expected the exit status of the command, got %v", err)
+	}
+}
+
+// TestInstallInterrupted validates an installer killed at shutdown is rolled back
+func TestInstallInterrupted(t *testing.T) {
+	fake := &fakeInstaller{checks: []bool{true}}
+	cfg := fake.use(t)
+	installItemFunc = func(item catalog.Item, itemURL, cachePath string) (string, error) {
+		fake.calls = append(fake.calls, "install "+item.Name+" "+item.Version)
+		return "", errInterrupted
+	}
+
+	item := rollbackItem("2.0")
+	item.RollbackOnFailure = false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result := InstallChecked(ctx, item, "update", cfg, true); result != "Interrupted" {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	expected := []string{"install Example 2.0", "uninstall Example 2.0"}
+	if !reflect.DeepEqual(fake.calls, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.calls)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].Action != "rollback" || !report.Actions[0].Success {
+		t.Errorf("expected a successful rollback in the report, got %+v", report.Actions)
+	}
+}
+
+// TestItemShutdown validates each install carries its own shutdown context, and detaching
+// the rollback of one install leaves the commands of the others to be stopped
+func TestItemShutdown(t *testing.T) {
+	firefox, zoom := catalog.Item{Name: "Firefox"}, catalog.Item{Name: "Zoom"}
+	firefoxCtx, cancelFirefox := context.WithCancel(context.Background())
+	defer cancelFirefox()
+	zoomCtx, cancelZoom := context.WithCancel(context.Background())
+	defer cancelZoom()
+
+	endFirefox := beginInstall(firefox, firefoxCtx, false)
+	endZoom := beginInstall(zoom, zoomCtx, false)
+	if itemShutdown(firefox) != firefoxCtx || itemShutdown(zoom) != zoomCtx {
+		t.Errorf("expected each item to have the context of its install")
+	}
+
+	detachShutdown(firefox)
+	if itemShutdown(firefox) != nil || itemShutdown(zoom) != zoomCtx {
+		t.Errorf("expected only the commands of Firefox detached from the shutdown")
+	}
+
+	endFirefox()
+	endZoom()
+	if itemShutdown(zoom) != nil || installsRunning != 0 {
+		t.Errorf("expected no contexts left once the installs ended")
+	}
+}
@@ -0,0 +1,329 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/report"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// uninstallerInstalled is the uninstaller type for a program already on the machine,
+// such as the uninstaller an application installs or msiexec, which is run without a download
+const uninstallerInstalled = "installed"
+
+// uninstall removes an item with the first method it has: its uninstaller, the product code
+// or payload of the msi it was installed from, the registry keys a reg item set,
+// or the uninstall command in the registry.
+// Payloads are downloaded and verified first if they are not already cached.
+func uninstall(item catalog.Item, cfg config.Configuration) (string, error) {
+	if item.Uninstaller.Type == uninstallerInstalled {
+		return uninstallInstalled(item, cfg.CachePath)
+	}
+	if item.Uninstaller.Type == pkginfo.ScriptType {
+		return uninstallItemFunc(item, "", cfg.CachePath)
+	}
+	if item.Uninstaller.Location != "" {
+		return uninstallItemFunc(item, catalog.UninstallerURL(cfg, item), cfg.CachePath)
+	}
+	if item.Installer.Type == "msi" && item.ProductCode != "" {
+		return uninstallProductCode(item, cfg.CachePath)
+	}
+	if item.Installer.Type == "msi" && item.Installer.Location != "" {
+		return uninstallMsi(item, catalog.ItemURL(cfg, item), cfg.CachePath)
+	}
+	if item.Installer.Type == "reg" && len(item.RegistryKeys) > 0 {
+		return uninstallRegistryKeys(item, cfg.CachePath)
+	}
+	return uninstallRegistry(item, cfg.CachePath)
+}
+
+// uninstallMethod returns how an item is uninstalled for the install history, the type of its
+// uninstaller or, when it has none, of its installer
+func uninstallMethod(item catalog.Item) string {
+	if item.Uninstaller.Type != "" {
+		return item.Uninstaller.Type
+	}
+	return item.Installer.Type
+}
+
+// Download caches the payload an item needs for an install, update or uninstall,
+// verifying its hash, so a later run can act on the item without downloading it
+func Download(item catalog.Item, installerType string, cfg config.Configuration) error {
+	payload, itemURL := item.Installer, catalog.ItemURL(cfg, item)
+	if installerType == "uninstall" {
+		if item.Uninstaller.Type == uninstallerInstalled {
+			return nil
+		}
+		if item.Uninstaller.Location != "" {
+			payload, itemURL = item.Uninstaller, catalog.UninstallerURL(cfg, item)
+		} else if item.Installer.Type != "msi" || item.ProductCode != "" {
+			// The registry uninstall command, registry keys and msi product codes don't need a payload
+			return nil
+		}
+	}
+	if payload.Location == "" {
+		return nil
+	}
+
+	if installerType != "uninstall" {
+		if err := checkDiskSpace(item, cfg.CachePath, false); err != nil {
+			return err
+		}
+	}
+
+	if !downloadItem(item, cachedPayload(payload, cfg.CachePath), itemURL, payload.Hash) {
+		return fmt.Errorf("unable to download valid file: %s", itemURL)
+	}
+	return nil
+}
+
+// CanUninstall returns true when an item has a way to be uninstalled: an uninstaller,
+// the msi it was installed from, the registry keys it set, or an uninstall command in the registry
+func CanUninstall(item catalog.Item) bool {
+	if item.Uninstaller.Location != "" || item.Uninstaller.Runnable() {
+		return true
+	}
+	if item.Installer.Type == "reg" && len(item.RegistryKeys) > 0 {
+		return true
+	}
+	if item.Installer.Type == "msi" && (item.Installer.Location != "" || item.ProductCode != "") {
+		return true
+	}
+	app, ok := installedApplication(registryName(item))
+	return ok && app.Uninstall != ""
+}
+
+// unknownProductExitCode is the exit code of msiexec for a product that is not installed,
+// ERROR_UNKNOWN_PRODUCT (1605). This abstraction allows us to override when testing.
+var unknownProductExitCode = 1605
+
+// uninstallProductCode removes an msi by its product code, which doesn't need the payload.
+// A product that is not installed any more counts as uninstalled.
+func uninstallProductCode(item catalog.Item, cachePath string) (string, error) {
+	code := item.ProductCode
+	logging.Info("Uninstalling msi product code for", item.DisplayName, code)
+	itemLog := startItemLog(item, cachePath)
+	uninstallArgs := append([]string{"/x", code, "/qn", "/norestart"}, itemLog.msiArgs()...)
+	uninstallerOut, errOut := runItemCommand(item, "", commandMsi, uninstallArgs)
+
+	var exitErr *exec.ExitError
+	if errors.As(errOut, &exitErr) && exitErr.ExitCode() == unknownProductExitCode {
+		logging.Info("Product is not installed, nothing to uninstall:", item.DisplayName, code)
+		errOut = nil
+	}
+	recordUninstall(item, itemLog.finish(errOut), errOut)
+	return uninstallerOut, errOut
+}
+
+// uninstallMsi removes an item with the msi it was installed from
+func uninstallMsi(item catalog.Item, itemURL, cachePath string) (string, error) {
+	absFile := cachedPayload(item.Installer, cachePath)
+
+	if !downloadItem(item, absFile, itemURL, item.Installer.Hash) {
+		msg := fmt.Sprint("Unable to download valid file: ", itemURL)
+		logging.Warn(msg)
+		return msg, errors.New(msg)
+	}
+
+	logging.Info("Uninstalling msi for", item.DisplayName)
+	itemLog := startItemLog(item, cachePath)
+	uninstallArgs := append([]string{"/x", absFile, "/qn", "/norestart"}, itemLog.msiArgs()...)
+	uninstallerOut, errOut := runItemCommand(item, "", commandMsi, uninstallArgs)
+	recordUninstall(item, itemLog.finish(errOut), errOut)
+	return uninstallerOut, errOut
+}
+
+// uninstallInstalled removes an item with a program already on the machine
+func uninstallInstalled(item catalog.Item, cachePath string) (string, error) {
+	if item.Uninstaller.Location == "" {
+		msg := fmt.Sprint("No program defined for the installed uninstaller of ", item.Name)
+		logging.Warn(msg)
+		return msg, errors.New(msg)
+	}
+
+	logging.Info("Uninstalling with the installed uninstaller for", item.DisplayName, item.Uninstaller.Location)
+	itemLog := startItemLog(item, cachePath)
+	uninstallCmd, uninstallArgs := item.Uninstaller.Location, expandArguments(item, item.Uninstaller.Arguments)
+	if isMsiexec(uninstallCmd) {
+		uninstallCmd = commandMsi
+		uninstallArgs = append(append([]string{}, uninstallArgs...), itemLog.msiArgs()...)
+	}
+	uninstallerOut, errOut := runItemCommand(item, "", uninstallCmd, uninstallArgs)
+	recordUninstall(item, itemLog.finish(errOut), errOut)
+	return uninstallerOut, errOut
+}
+
+// InstalledUninstaller returns an uninstaller that runs the uninstall command an application
+// registered, or msiexec /x for the product code of an msi, for pkginfos made on a machine
+// the application is installed on. The QuietUninstallString is preferred, otherwise the
+// UninstallString is run with the silent switches of the framework that built it.
+func InstalledUninstaller(app status.RegistryApplication) (catalog.InstallerItem, bool) {
+	if app.ProductCode != "" {
+		return catalog.InstallerItem{
+			Type:      uninstallerInstalled,
+			Location:  "msiexec.exe",
+			Arguments: []string{"/x", app.ProductCode, "/qn", "/norestart"},
+		}, true
+	}
+	if app.QuietUninstall != "" {
+		command, arguments := splitCommandLine(app.QuietUninstall)
+		return catalog.InstallerItem{Type: uninstallerInstalled, Location: command, Arguments: arguments}, true
+	}
+	if app.Uninstall == "" {
+		return catalog.InstallerItem{}, false
+	}
+
+	command, arguments := registryUninstallCommand(app.Uninstall)
+	if command == commandMsi {
+		command = "msiexec.exe"
+	} else {
+		arguments = silentArguments(command, arguments)
+	}
+	return catalog.InstallerItem{Type: uninstallerInstalled, Location: command, Arguments: arguments}, true
+}
+
+// innoUninstaller matches the unins000.exe uninstallers of Inno Setup
+var innoUninstaller = regexp.MustCompile(`^unins\d{3}\.exe$`)
+
+// silentArguments adds the silent switches of the framework an uninstaller was built with,
+// recognized by its name, unless the arguments already have one. Inno Setup names its
+// uninstallers unins000.exe, and NSIS ones usually have "uninst" in their name.
+func silentArguments(command string, arguments []string) []string {
+	for _, argument := range arguments {
+		switch strings.ToUpper(argument) {
+		case "/S", "/SILENT", "/VERYSILENT", "/Q", "/QUIET", "-S", "--SILENT":
+			return arguments
+		}
+	}
+
+	name := strings.ToLower(filepath.Base(strings.Replace(command, `\`, "/", -1)))
+	switch {
+	case innoUninstaller.MatchString(name):
+		return append(arguments, "/VERYSILENT", "/SUPPRESSMSGBOXES", "/NORESTART")
+	case strings.Contains(name, "uninst"):
+		return append(arguments, "/S")
+	default:
+		return arguments
+	}
+}
+
+// uninstallRegistry removes an item with the uninstall command it registered
+func uninstallRegistry(item catalog.Item, cachePath string) (string, error) {
+	app, ok := installedApplication(registryName(item))
+	if !ok || app.Uninstall == "" {
+		msg := fmt.Sprint("No uninstaller defined or registered for ", item.Name)
+		logging.Warn(msg)
+		return msg, errors.New(msg)
+	}
+
+	logging.Info("Uninstalling with the registry uninstall command for", item.DisplayName, app.Uninstall)
+	uninstallCmd, uninstallArgs := registryUninstallCommand(app.Uninstall)
+	itemLog := startItemLog(item, cachePath)
+	uninstallerOut, errOut := runItemCommand(item, "", uninstallCmd, uninstallArgs)
+	recordUninstall(item, itemLog.finish(errOut), errOut)
+	return uninstallerOut, errOut
+}
+
+// registryUninstallCommand turns an UninstallString into a command that runs silently.
+// MSI products are often registered with `MsiExec.exe /I{ProductCode}`, which opens the
+// maintenance dialog, so those are changed to a quiet /X.
+func registryUninstallCommand(uninstallString string) (string, []string) {
+	command, arguments := splitCommandLine(uninstallString)
+	if !isMsiexec(command) {
+		return command, arguments
+	}
+
+	quiet := false
+	for i, argument := range arguments {
+		upper := strings.ToUpper(argument)
+		if strings.HasPrefix(upper, "/I") {
+			arguments[i] = "/X" + argument[2:]
+		}
+		if strings.HasPrefix(upper, "/Q") {
+			quiet = true
+		}
+	}
+	if !quiet {
+		arguments = append(arguments, "/qn", "/norestart")
+	}
+	return commandMsi, arguments
+}
+
+// isMsiexec returns true if a command runs msiexec, with or without its path
+func isMsiexec(command string) bool {
+	base := strings.ToLower(filepath.Base(strings.Replace(command, `\`, "/", -1)))
+	return base == "msiexec.exe" || base == "msiexec"
+}
+
+// splitCommandLine splits a command line into the command and its arguments.
+// The command may be quoted, or unquoted with spaces in its path up to `.exe`.
+func splitCommandLine(commandLine string) (string, []string) {
+	commandLine = strings.TrimSpace(commandLine)
+
+	var command, rest string
+	if strings.HasPrefix(commandLine, `"`) {
+		end := strings.Index(commandLine[1:], `"`)
+		if end < 0 {
+			return strings.Trim(commandLine, `"`), nil
+		}
+		command, rest = commandLine[1:end+1], commandLine[end+2:]
+	} else if end := strings.Index(strings.ToLower(commandLine), ".exe"); end >= 0 {
+		command, rest = commandLine[:end+4], commandLine[end+4:]
+	} else {
+		fields := splitArguments(commandLine)
+		if len(fields) == 0 {
+			return "", nil
+		}
+		return fields[0], fields[1:]
+	}
+	return command, splitArguments(rest)
+}
+
+// splitArguments splits on spaces outside of double quotes and removes the quotes
+func splitArguments(arguments string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuotes, inField := false, false
+	for _, r := range arguments {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			inField = true
+		case r == ' ' && !inQuotes:
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+// recordUninstall logs the result of an uninstall and adds it to the report
+func recordUninstall(item catalog.Item, logPath string, errOut error) {
+	if errOut != nil {
+		logging.Warn(item.DisplayName, item.Version, "Uninstallation FAILED")
+	} else {
+		logging.Info(item.DisplayName, item.Version, "Uninstallation SUCCESSFUL")
+	}
+
+	// Add the item to UninstalledItems in GorillaReport
+	report.RecordUninstalled(item)
+	report.RecordActionLog(item.Name, item.Version, "uninstall", logPath, errOut)
+}
@@ -0,0 +1,383 @@
+package installer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/report"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// fakeUninstall records the downloads and commands of an uninstall
+type fakeUninstall struct {
+	downloads []string
+	commands  []string
+	// uninstall is the command registered for the item, if any
+	uninstall string
+}
+
+// use overrides the package functions for the duration of the test
+func (f *fakeUninstall) use(t *testing.T) config.Configuration {
+	origDownload, origRun, origStatus, origApplication := downloadIfNeeded, runCommand, statusCheckStatus, installedApplication
+	origLogTime := logTime
+	t.Cleanup(func() {
+		downloadIfNeeded, runCommand, statusCheckStatus, installedApplication = origDownload, origRun, origStatus, origApplication
+		logTime = origLogTime
+		report.Actions, report.UninstalledItems = nil, nil
+	})
+	report.Actions, report.UninstalledItems = nil, nil
+	logTime = func() time.Time { return time.Date(2024, 7, 9, 14, 30, 0, 0, time.UTC) }
+
+	// A cached file is used as it is, a missing one is downloaded
+	downloadIfNeeded = func(filePath, url, hash string) bool {
+		if _, err := os.Stat(filePath); err == nil {
+			return true
+		}
+		f.downloads = append(f.downloads, url)
+		os.MkdirAll(filepath.Dir(filePath), 0755)
+		return ioutil.WriteFile(filePath, []byte("payload"), 0644) == nil
+	}
+	runCommand = func(c Command) (string, error) {
+		f.commands = append(f.commands, strings.Join(append([]string{c.Path}, c.Arguments...), " "))
+		return "", nil
+	}
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		return true, nil
+	}
+	installedApplication = func(name string) (status.RegistryApplication, bool) {
+		if f.uninstall == "" {
+			return status.RegistryApplication{}, false
+		}
+		return status.RegistryApplication{Name: name, Version: "1.0", Uninstall: f.uninstall}, true
+	}
+
+	return config.Configuration{CachePath: t.TempDir(), URL: "https://example.com/"}
+}
+
+func uninstallerItem() catalog.Item {
+	return catalog.Item{
+		Name:        "Example",
+		DisplayName: "Example App",
+		Version:     "1.0",
+		Installer:   catalog.InstallerItem{Type: "exe", Location: "apps/Example.exe"},
+		Uninstaller: catalog.InstallerItem{Type: "exe", Location: "apps/Example-uninstall.exe", Arguments: []string{"/S"}},
+	}
+}
+
+// TestUninstallCached validates a cached uninstaller is run without downloading it
+func TestUninstallCached(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+
+	cached := filepath.Join(cfg.CachePath, "apps", "Example-uninstall.exe")
+	os.MkdirAll(filepath.Dir(cached), 0755)
+	if err := ioutil.WriteFile(cached, []byte("payload"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Install(context.Background(), uninstallerItem(), "uninstall", cfg)
+
+	if len(fake.downloads) != 0 {
+		t.Errorf("expected no downloads, got %v", fake.downloads)
+	}
+	if !reflect.DeepEqual(fake.commands, []string{cached + " /S"}) {
+		t.Errorf("unexpected commands: %v", fake.commands)
+	}
+}
+
+// TestUninstallDownloads validates the uninstaller is downloaded when it is not cached
+func TestUninstallDownloads(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+
+	Install(context.Background(), uninstallerItem(), "uninstall", cfg)
+
+	if !reflect.DeepEqual(fake.downloads, []string{catalog.UninstallerURL(cfg, uninstallerItem())}) {
+		t.Errorf("unexpected downloads: %v", fake.downloads)
+	}
+	if len(fake.commands) != 1 || len(report.Actions) != 1 || !report.Actions[0].Success {
+		t.Errorf("expected a successful uninstall, got %v and %+v", fake.commands, report.Actions)
+	}
+}
+
+// TestUninstallMsiInstaller validates an msi without an uninstaller is removed with its installer
+func TestUninstallMsiInstaller(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+
+	item := uninstallerItem()
+	item.Installer = catalog.InstallerItem{Type: "msi", Location: "apps/Example.msi"}
+	item.Uninstaller = catalog.InstallerItem{}
+	Install(context.Background(), item, "uninstall", cfg)
+
+	if !reflect.DeepEqual(fake.downloads, []string{catalog.ItemURL(cfg, item)}) {
+		t.Errorf("unexpected downloads: %v", fake.downloads)
+	}
+	msi := filepath.Join(cfg.CachePath, "apps", "Example.msi")
+	msiLog := filepath.Join(cfg.CachePath, "logs", "Example-1.0-20240709-143000-msi.log")
+	expected := []string{commandMsi + " /x " + msi + " /qn /norestart /l*v " + msiLog}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.commands)
+	}
+}
+
+// TestUninstallProductCode validates an msi with a product code is removed without its payload
+func TestUninstallProductCode(t *testing.T) {
+	fake := &fakeUninstall{uninstall: `"C:\Program Files\Example\uninstall.exe" /S`}
+	cfg := fake.use(t)
+
+	item := uninstallerItem()
+	item.Installer = catalog.InstallerItem{Type: "msi", Location: "apps/Example.msi"}
+	item.ProductCode = "{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}"
+	item.Uninstaller = catalog.InstallerItem{}
+	Install(context.Background(), item, "uninstall", cfg)
+
+	if len(fake.downloads) != 0 {
+		t.Errorf("expected no downloads, got %v", fake.downloads)
+	}
+	msiLog := filepath.Join(cfg.CachePath, "logs", "Example-1.0-20240709-143000-msi.log")
+	expected := []string{commandMsi + " /x {2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11} /qn /norestart /l*v " + msiLog}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.commands)
+	}
+	if err := Download(item, "uninstall", cfg); err != nil || len(fake.downloads) != 0 {
+		t.Errorf("expected nothing to download, got %v %v", err, fake.downloads)
+	}
+}
+
+// TestUninstallUnknownProduct validates msiexec exiting with 1605, product not installed,
+// counts as a successful uninstall
+func TestUninstallUnknownProduct(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+	origExec, origCode := execCommand, unknownProductExitCode
+	t.Cleanup(func() { execCommand, unknownProductExitCode = origExec, origCode })
+	runCommand, execCommand = runCMD, fakeExecCommand
+
+	// Exit codes are truncated to a byte outside of Windows
+	if runtime.GOOS != "windows" {
+		unknownProductExitCode = 1605 & 0xFF
+	}
+
+	item := uninstallerItem()
+	item.Installer = catalog.InstallerItem{Type: "msi"}
+	item.ProductCode = unknownProduct
+	item.Uninstaller = catalog.InstallerItem{}
+	if result := Install(context.Background(), item, "uninstall", cfg); result != "" {
+		t.Errorf("expected the uninstall to succeed, got %q", result)
+	}
+	if len(report.Actions) != 1 || !report.Actions[0].Success {
+		t.Errorf("expected a successful uninstall, got %+v", report.Actions)
+	}
+
+	// Any other exit code is still a failure
+	item.ProductCode = "{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}"
+	if result := Install(context.Background(), item, "uninstall", cfg); result != "Uninstall failed" {
+		t.Errorf("expected the uninstall to fail, got %q", result)
+	}
+}
+
+// TestUninstallRegistryFallback validates the registered uninstall command is used
+// when the item has no uninstaller payload
+func TestUninstallRegistryFallback(t *testing.T) {
+	fake := &fakeUninstall{uninstall: "MsiExec.exe /I{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}"}
+	cfg := fake.use(t)
+
+	item := uninstallerItem()
+	item.Uninstaller = catalog.InstallerItem{}
+	Install(context.Background(), item, "uninstall", cfg)
+
+	if len(fake.downloads) != 0 {
+		t.Errorf("expected no downloads, got %v", fake.downloads)
+	}
+	expected := []string{commandMsi + " /X{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11} /qn /norestart"}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.commands)
+	}
+}
+
+// TestUninstallInstalled validates an installed uninstaller is run from the machine without a download
+func TestUninstallInstalled(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+
+	item := uninstallerItem()
+	item.Uninstaller = catalog.InstallerItem{Type: "installed", Location: `C:\Program Files\Example\uninstall.exe`, Arguments: []string{"/S"}}
+	Install(context.Background(), item, "uninstall", cfg)
+
+	item.Uninstaller = catalog.InstallerItem{Type: "installed", Location: "msiexec.exe", Arguments: []string{"/x", "{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}", "/qn", "/norestart"}}
+	Install(context.Background(), item, "uninstall", cfg)
+
+	if len(fake.downloads) != 0 {
+		t.Errorf("expected no downloads, got %v", fake.downloads)
+	}
+	msiLog := filepath.Join(cfg.CachePath, "logs", "Example-1.0-20240709-143000-msi.log")
+	expected := []string{
+		`C:\Program Files\Example\uninstall.exe /S`,
+		commandMsi + " /x {2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11} /qn /norestart /l*v " + msiLog,
+	}
+	if !reflect.DeepEqual(fake.commands, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.commands)
+	}
+	if err := Download(item, "uninstall", cfg); err != nil || len(fake.downloads) != 0 {
+		t.Errorf("expected nothing to download, got %v %v", err, fake.downloads)
+	}
+}
+
+// TestInstalledUninstaller validates the uninstaller derived from a registered application
+func TestInstalledUninstaller(t *testing.T) {
+	tests := []struct {
+		app      status.RegistryApplication
+		expected catalog.InstallerItem
+	}{
+		{
+			status.RegistryApplication{ProductCode: "{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}", Uninstall: "MsiExec.exe /I{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}"},
+			catalog.InstallerItem{Type: "installed", Location: "msiexec.exe", Arguments: []string{"/x", "{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}", "/qn", "/norestart"}},
+		},
+		{
+			status.RegistryApplication{Uninstall: "MsiExec.exe /X{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11} /quiet"},
+			catalog.InstallerItem{Type: "installed", Location: "msiexec.exe", Arguments: []string{"/X{2B6D6A4F-0E3C-4D63-9C7F-6D1E5E2D1A11}", "/quiet"}},
+		},
+		{
+			status.RegistryApplication{Uninstall: `"C:\Program Files\Example\uninstall.exe" /S`},
+			catalog.InstallerItem{Type: "installed", Location: `C:\Program Files\Example\uninstall.exe`, Arguments: []string{"/S"}},
+		},
+		{
+			status.RegistryApplication{
+				Uninstall:      `"C:\Program Files\Example\uninstall.exe"`,
+				QuietUninstall: `"C:\Program Files\Example\uninstall.exe" /S /quiet`,
+			},
+			catalog.InstallerItem{Type: "installed", Location: `C:\Program Files\Example\uninstall.exe`, Arguments: []string{"/S", "/quiet"}},
+		},
+		{
+			status.RegistryApplication{Uninstall: `"C:\Program Files\Example\Uninst.exe"`},
+			catalog.InstallerItem{Type: "installed", Location: `C:\Program Files\Example\Uninst.exe`, Arguments: []string{"/S"}},
+		},
+		{
+			status.RegistryApplication{Uninstall: `"C:\Program Files\Example\unins000.exe"`},
+			catalog.InstallerItem{Type: "installed", Location: `C:\Program Files\Example\unins000.exe`, Arguments: []string{"/VERYSILENT", "/SUPPRESSMSGBOXES", "/NORESTART"}},
+		},
+		{
+			status.RegistryApplication{Uninstall: `"C:\Program Files\Example\remove.exe" --mode silent`},
+			catalog.InstallerItem{Type: "installed", Location: `C:\Program Files\Example\remove.exe`, Arguments: []string{"--mode", "silent"}},
+		},
+	}
+	for _, test := range tests {
+		uninstaller, ok := InstalledUninstaller(test.app)
+		if !ok || !reflect.DeepEqual(uninstaller, test.expected) {
+			t.Errorf("%s: got %+v", test.app.Uninstall, uninstaller)
+		}
+	}
+	if _, ok := InstalledUninstaller(status.RegistryApplication{Name: "Example"}); ok {
+		t.Errorf("expected no uninstaller without an uninstall command")
+	}
+}
+
+// TestUninstallNothingRegistered validates an item without any uninstall method fails
+func TestUninstallNothingRegistered(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+
+	item := uninstallerItem()
+	item.Uninstaller = catalog.InstallerItem{}
+	if _, err := uninstall(item, cfg); err == nil {
+		t.Errorf("expected an error")
+	}
+	if len(fake.commands) != 0 {
+		t.Errorf("expected no commands, got %v", fake.commands)
+	}
+}
+
+// TestUninstallFailedResult validates a failed uninstall is reported to the caller
+func TestUninstallFailedResult(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+
+	item := uninstallerItem()
+	item.Uninstaller = catalog.InstallerItem{}
+	if result := Install(context.Background(), item, "uninstall", cfg); result != "Uninstall failed" {
+		t.Errorf("expected the uninstall to fail, got %q", result)
+	}
+}
+
+// TestCanUninstall validates the items with and without a way to uninstall them
+func TestCanUninstall(t *testing.T) {
+	fake := &fakeUninstall{}
+	fake.use(t)
+
+	item := uninstallerItem()
+	if !CanUninstall(item) {
+		t.Errorf("expected an item with an uninstaller to be uninstallable")
+	}
+
+	item.Uninstaller = catalog.InstallerItem{}
+	if CanUninstall(item) {
+		t.Errorf("expected an exe item with nothing registered not to be uninstallable")
+	}
+
+	fake.uninstall = `"C:\Program Files\Example\uninstall.exe" /S`
+	if !CanUninstall(item) {
+		t.Errorf("expected an item with a registered uninstall command to be uninstallable")
+	}
+
+	fake.uninstall = ""
+	item.Installer = catalog.InstallerItem{Type: "msi", Location: "apps/Example.msi"}
+	if !CanUninstall(item) {
+		t.Errorf("expected an msi item to be uninstallable")
+	}
+}
+
+// TestDownload validates the payload for each action is cached
+func TestDownload(t *testing.T) {
+	fake := &fakeUninstall{}
+	cfg := fake.use(t)
+
+	item := uninstallerItem()
+	if err := Download(item, "install", cfg); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if err := Download(item, "uninstall", cfg); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	item.Uninstaller = catalog.InstallerItem{}
+	if err := Download(item, "uninstall", cfg); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	expected := []string{catalog.ItemURL(cfg, item), catalog.UninstallerURL(cfg, uninstallerItem())}
+	if !reflect.DeepEqual(fake.downloads, expected) {
+		t.Errorf("expected downloads %v, got %v", expected, fake.downloads)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.CachePath, "apps", "Example.exe")); err != nil {
+		t.Errorf("expected the installer to be cached: %v", err)
+	}
+}
+
+// TestSplitCommandLine validates registered uninstall strings are split into the command and arguments
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		commandLine string
+		command     string
+		arguments   []string
+	}{
+		{`"C:\Program Files\Example\uninstall.exe" /S`, `C:\Program Files\Example\uninstall.exe`, []string{"/S"}},
+		{`C:\Program Files\Example\uninstall.exe /S /D="C:\Program Files\Example"`, `C:\Program Files\Example\uninstall.exe`, []string{"/S", `/D=C:\Program Files\Example`}},
+		{`"C:\Program Files\Example\uninstall.exe"`, `C:\Program Files\Example\uninstall.exe`, nil},
+		{`rundll32 setupapi.dll,InstallHinfSection`, "rundll32", []string{"setupapi.dll,InstallHinfSection"}},
+	}
+	for _, test := range tests {
+		command, arguments := splitCommandLine(test.commandLine)
+		if command != test.command || !reflect.DeepEqual(arguments, test.arguments) {
+			t.Errorf("%s: got %q %q", test.commandLine, command, arguments)
+		}
+	}
+}
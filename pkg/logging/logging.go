@@ -8,6 +8,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/windowsadmins/gorilla/pkg/config"
 )
@@ -62,6 +64,14 @@ func Init(cfg *config.Configuration) error {
 	return nil
 }
 
+// InitLogger initializes the logger and reports any failure on stderr.
+// Commands use it when a logging failure should not stop the run.
+func InitLogger(cfg config.Configuration) {
+	if err := Init(&cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+	}
+}
+
 // Info logs informational messages.
 func Info(message string, keyValues ...interface{}) {
 	logStructured("INFO", message, keyValues...)
@@ -74,6 +84,11 @@ func Debug(message string, keyValues ...interface{}) {
 	}
 }
 
+// DebugEnabled returns true when debug logging is on
+func DebugEnabled() bool {
+	return debug
+}
+
 // Warn logs warning messages.
 func Warn(message string, keyValues ...interface{}) {
 	logStructured("WARN", message, keyValues...)
@@ -118,33 +133,60 @@ func LogErrorDuringInstall(err error, context string) {
 	Error("Installation error", "context", context, "error", err.Error())
 }
 
-// logStructured formats and logs the message with key-value pairs.
-func logStructured(level, message string, keyValues ...interface{}) {
-	// Ensure even number of keyValues
-	if len(keyValues)%2 != 0 {
-		// Append a placeholder for the missing value
-		keyValues = append(keyValues, "MISSING_VALUE")
-	}
+// LogError logs an error along with the context it occurred in.
+func LogError(err error, context string) {
+	Error(context, "error", err)
+}
+
+// keyPattern matches the keys of structured messages, such as "url" or "log_level"
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// isKey returns true when an argument can be the key of a key-value pair
+func isKey(arg interface{}) bool {
+	key, ok := arg.(string)
+	return ok && keyPattern.MatchString(key)
+}
 
-	// Build the key-value string
-	kvPairs := ""
+// isPairs returns true when the arguments of a message are key-value pairs. Messages ending
+// with a colon, such as ("Manifest File:", name), are in the older print style and never are.
+func isPairs(message string, keyValues []interface{}) bool {
+	if len(keyValues)%2 != 0 || strings.HasSuffix(strings.TrimSpace(message), ":") {
+		return false
+	}
 	for i := 0; i < len(keyValues); i += 2 {
-		key, ok := keyValues[i].(string)
-		if !ok {
-			// If the key is not a string, use a placeholder
-			key = fmt.Sprintf("NON_STRING_KEY_%d", i)
+		if !isKey(keyValues[i]) {
+			return false
 		}
-		value := keyValues[i+1]
-		kvPairs += fmt.Sprintf("%s=%v ", key, value)
 	}
+	return true
+}
 
-	// Trim the trailing space
-	if len(kvPairs) > 0 {
-		kvPairs = kvPairs[:len(kvPairs)-1]
+// logStructured formats and logs the message with key-value pairs.
+// Arguments that aren't pairs are printed after the message, separated by spaces.
+func logStructured(level, message string, keyValues ...interface{}) {
+	var args []string
+	if isPairs(message, keyValues) {
+		for i := 0; i < len(keyValues); i += 2 {
+			args = append(args, fmt.Sprintf("%s=%v", keyValues[i], keyValues[i+1]))
+		}
+	} else {
+		for _, arg := range keyValues {
+			args = append(args, fmt.Sprint(arg))
+		}
+	}
+
+	// Fall back to stdout if Init has not been called yet
+	if logger == nil {
+		logger = log.New(os.Stdout, "", log.Ldate|log.Ltime)
 	}
 
 	// Log the structured message
-	logger.Println(fmt.Sprintf("%s: %s %s", level, message, kvPairs))
+	line := fmt.Sprintf("%s: %s", level, strings.TrimRight(message, " "))
+	if len(args) > 0 {
+		line += " " + strings.Join(args, " ")
+	}
+	logger.Println(line)
+	consoleStructured(level, line)
 }
 
 // CloseLogger performs necessary cleanup for the logger.
@@ -155,5 +197,6 @@ func CloseLogger() {
 		if err != nil {
 			fmt.Printf("Failed to close log file: %v\n", err)
 		}
+		logFile = nil
 	}
 }
@@ -0,0 +1,124 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestLogStructured validates key-value pairs are logged as pairs, and the arguments of
+// print style messages are logged after the message as they are
+func TestLogStructured(t *testing.T) {
+	origLogger := logger
+	t.Cleanup(func() { logger = origLogger })
+	var buf bytes.Buffer
+	logger = log.New(&buf, "", 0)
+
+	tests := []struct {
+		message   string
+		keyValues []interface{}
+		expected  string
+	}{
+		{"Starting download", []interface{}{"url", "https://example.com/app.msi"}, "INFO: Starting download url=https://example.com/app.msi"},
+		{"Logger initialized", []interface{}{"log_level", "INFO", "debug", false}, "INFO: Logger initialized log_level=INFO debug=false"},
+		{"Only a message", nil, "INFO: Only a message"},
+		{"Check registry version:", []interface{}{"1.2.3"}, "INFO: Check registry version: 1.2.3"},
+		{"Manifest File:", []interface{}{"site_default", "roles/dev"}, "INFO: Manifest File: site_default roles/dev"},
+		{"Unable to parse yaml manifest: ", []interface{}{"site_default", errors.New("bad yaml")}, "INFO: Unable to parse yaml manifest: site_default bad yaml"},
+		{"Rolling back", []interface{}{"Google Chrome", "1.0"}, "INFO: Rolling back Google Chrome 1.0"},
+		{"Retrying", []interface{}{3, "times"}, "INFO: Retrying 3 times"},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		Info(tt.message, tt.keyValues...)
+		if got := strings.TrimSuffix(buf.String(), "\n"); got != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+// TestCallSites checks the calls to Debug, Info, Warn and Error in the repo. Calls pass either
+// key-value pairs or print style arguments, a call mixing both is an error. The print style calls
+// are listed with go test -v so they can be moved to key-value pairs over time.
+func TestCallSites(t *testing.T) {
+	root := filepath.Join("..", "..")
+	fset := token.NewFileSet()
+	printStyle := 0
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") && path != root {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || !isLoggingCall(call) || len(call.Args) < 2 {
+				return true
+			}
+			keys, notKeys := 0, 0
+			for i := 1; i < len(call.Args); i += 2 {
+				if isKeyLiteral(call.Args[i]) {
+					keys++
+				} else {
+					notKeys++
+				}
+			}
+			switch {
+			case keys > 0 && (notKeys > 0 || len(call.Args)%2 == 0):
+				t.Errorf("%s: mixes key-value pairs with print style arguments", fset.Position(call.Pos()))
+			case keys == 0:
+				printStyle++
+				t.Logf("%s: print style arguments", fset.Position(call.Pos()))
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%d calls with print style arguments", printStyle)
+}
+
+// isLoggingCall returns true for a call to logging.Debug, Info, Warn or Error
+func isLoggingCall(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok || pkg.Name != "logging" {
+		return false
+	}
+	switch sel.Sel.Name {
+	case "Debug", "Info", "Warn", "Error":
+		return true
+	}
+	return false
+}
+
+// isKeyLiteral returns true for a string literal that is a key, such as "url"
+func isKeyLiteral(expr ast.Expr) bool {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return false
+	}
+	value, err := strconv.Unquote(lit.Value)
+	return err == nil && isKey(value)
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// toolMode is set by InitTool, for the admin tools rather than the agent
+	toolMode bool
+	// quiet only prints errors on the console of an admin tool
+	quiet bool
+
+	// Where the admin tools print messages for the user, abstracted for testing
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// ToolFlags adds the --log-file and --quiet flags of the admin tools to the default flag set
+func ToolFlags() (logFile *string, quietConsole *bool) {
+	logFile = flag.String("log-file", "", "Also write the output, with timestamps, to this file.")
+	quietConsole = flag.Bool("quiet", false, "Only print errors on the console.")
+	return logFile, quietConsole
+}
+
+// InitTool sets up logging for the admin tools. Messages are printed plainly on the console
+// as they always were, only errors when quiet, and are also written with timestamps and
+// levels to logFilePath when it is set. Nothing is written to the agent's log.
+func InitTool(logFilePath string, quietConsole bool) error {
+	toolMode, quiet = true, quietConsole
+	logger = log.New(io.Discard, "", 0)
+	if logFilePath == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logFilePath), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	logFile = file
+	logger = log.New(file, "", log.Ldate|log.Ltime)
+	return nil
+}
+
+// Printf prints a message for the user of an admin tool, unless quiet, and logs it at INFO
+func Printf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if !quiet {
+		fmt.Fprint(stdout, message)
+	}
+	writeLog("INFO", message)
+}
+
+// Warnf prints a warning for the user of an admin tool on stderr, unless quiet, and logs it at WARN
+func Warnf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if !quiet {
+		fmt.Fprint(stderr, message)
+	}
+	writeLog("WARN", message)
+}
+
+// Errorf prints an error for the user of an admin tool on stderr, even when quiet, and logs it at ERROR
+func Errorf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	fmt.Fprint(stderr, message)
+	writeLog("ERROR", message)
+}
+
+// writeLog writes a message printed on the console to the log, without its trailing newline
+func writeLog(level, message string) {
+	if logger == nil {
+		return
+	}
+	logger.Println(fmt.Sprintf("%s: %s", level, strings.TrimRight(message, "\n")))
+}
+
+// consoleStructured prints the structured warnings and errors of the packages an admin tool uses,
+// which otherwise only go to its log file
+func consoleStructured(level, line string) {
+	if !toolMode {
+		return
+	}
+	if level == "ERROR" || (level == "WARN" && !quiet) {
+		fmt.Fprintln(stderr, line)
+	}
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useConsole captures what the admin tools print for the duration of the test
+func useConsole(t *testing.T) (*bytes.Buffer, *bytes.Buffer) {
+	origStdout, origStderr, origLogger, origFile := stdout, stderr, logger, logFile
+	t.Cleanup(func() {
+		CloseLogger()
+		stdout, stderr, logger, logFile = origStdout, origStderr, origLogger, origFile
+		toolMode, quiet = false, false
+	})
+	var out, errOut bytes.Buffer
+	stdout, stderr = &out, &errOut
+	return &out, &errOut
+}
+
+// TestInitToolConsole validates messages are printed plainly, with no file by default
+func TestInitToolConsole(t *testing.T) {
+	out, errOut := useConsole(t)
+	if err := InitTool("", false); err != nil {
+		t.Fatal(err)
+	}
+
+	Printf("Catalog %s written\n", "testing")
+	Warnf("Warning: %s\n", "check this")
+	Warn("Unable to read", "path", "setup.exe")
+	Info("Only in the log file")
+
+	if out.String() != "Catalog testing written\n" {
+		t.Errorf("unexpected stdout: %q", out.String())
+	}
+	expected := "Warning: check this\nWARN: Unable to read path=setup.exe\n"
+	if errOut.String() != expected {
+		t.Errorf("expected stderr %q, got %q", expected, errOut.String())
+	}
+}
+
+// TestInitToolQuietLogFile validates quiet prints only errors, while the log file gets everything
+func TestInitToolQuietLogFile(t *testing.T) {
+	out, errOut := useConsole(t)
+	logPath := filepath.Join(t.TempDir(), "logs", "import.log")
+	if err := InitTool(logPath, true); err != nil {
+		t.Fatal(err)
+	}
+
+	Printf("Processing package: %s\n", "Example.msi")
+	Warnf("Warning: no icon\n")
+	Errorf("Error: %v\n", "failed")
+	CloseLogger()
+
+	if out.Len() != 0 || errOut.String() != "Error: failed\n" {
+		t.Errorf("unexpected console output: %q, %q", out.String(), errOut.String())
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"INFO: Processing package: Example.msi\n", "WARN: Warning: no icon\n", "ERROR: Error: failed\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("log file is missing %q:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Package makecatalogs builds the catalogs of a repo from its pkginfos, for the makecatalogs
+// tool and for anything else that needs the catalogs a repo would have.
+package makecatalogs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/repo"
+)
+
+// Catalogs stores catalogs with their respective items.
+type Catalogs map[string][]pkginfo.CatalogItem
+
+// Options are how the catalogs of a repo are built and written
+type Options struct {
+	// Compress also writes each catalog gzip compressed, as `<Catalog>.yaml.gz`
+	Compress bool
+	// FixPaths rewrites the locations with backslashes in the pkginfo files
+	FixPaths bool
+	// StripFields are the pkginfo fields left out of the catalogs
+	StripFields []string
+	// Only are the catalogs written, the others are left as they are. Every catalog is written when it is empty.
+	Only []string
+}
+
+// Scan reads every pkginfo in the pkgsinfo directory of the repo.
+// Locations with backslashes are warned about and fixed in the catalogs,
+// and in the pkginfo files too with fixPaths.
+func Scan(r *repo.Repo, fixPaths bool) ([]pkginfo.PkgsInfo, error) {
+	var pkgsInfos []pkginfo.PkgsInfo
+
+	err := r.WalkPkgsinfo(func(path string, fileContent []byte) error {
+		pkgsInfo, err := pkginfo.Decode(fileContent)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if changed := pkgsInfo.NormalizeLocations(); changed != nil {
+			if err := fixLocations(path, fileContent, changed, fixPaths); err != nil {
+				return err
+			}
+		}
+		pkgsInfos = append(pkgsInfos, pkgsInfo)
+		return nil
+	})
+
+	return pkgsInfos, err
+}
+
+// fixLocations warns about the locations of a pkginfo that use backslashes,
+// and rewrites them with forward slashes when fixPaths is set
+func fixLocations(path string, fileContent []byte, changed []string, fixPaths bool) error {
+	for _, location := range changed {
+		logging.Warnf("Warning: %s has the location %s with backslashes, forward slashes are used in the catalogs.\n", path, location)
+	}
+	if !fixPaths {
+		return nil
+	}
+	fixed, ok, err := pkginfo.FixLocations(fileContent)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if !ok {
+		return nil
+	}
+	if err := os.WriteFile(path, fixed, 0644); err != nil {
+		return fmt.Errorf("unable to fix the locations of %s: %v", path, err)
+	}
+	logging.Printf("Fixed the locations of %s\n", path)
+	return nil
+}
+
+// Build builds catalogs by processing the list of package information,
+// leaving out the fields in stripFields.
+func Build(pkgsInfos []pkginfo.PkgsInfo, stripFields []string) (Catalogs, error) {
+	catalogs := make(Catalogs)
+
+	for _, pkg := range pkgsInfos {
+		item, err := pkg.CatalogItem()
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", pkg.Name, pkg.Version, err)
+		}
+		item.StripFields(stripFields)
+		for _, catalog := range pkg.Catalogs {
+			catalogs[catalog] = append(catalogs[catalog], item)
+		}
+	}
+
+	return catalogs, nil
+}
+
+// only returns the catalogs with one of the names, so the other catalog files are left
+// as they are, and the names no pkginfo is in. Every catalog is returned when names is empty.
+func (c Catalogs) only(names []string) (Catalogs, []string) {
+	if len(names) == 0 {
+		return c, nil
+	}
+	selected := make(Catalogs)
+	var missing []string
+	for _, name := range names {
+		pkgs, ok := c[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		selected[name] = pkgs
+	}
+	return selected, missing
+}
+
+// Write writes the catalogs to YAML files in the catalogs directory of the repo, and to
+// `<Catalog>.yaml.gz` when compress is set.
+func (c Catalogs) Write(r *repo.Repo, compress bool) error {
+
+	for catalog, pkgs := range c {
+		data, err := r.WriteCatalog(catalog, pkgs)
+		if err != nil {
+			return err
+		}
+		filePath, _ := r.CatalogPath(catalog)
+		logging.Printf("Catalog %s written to %s\n", catalog, filePath)
+
+		if !compress {
+			// A compressed catalog left from an earlier run would be stale
+			if err := os.Remove(filePath + ".gz"); err == nil {
+				logging.Printf("Removed stale compressed catalog %s.gz\n", filePath)
+			}
+			continue
+		}
+		size, err := writeCompressed(filePath+".gz", data)
+		if err != nil {
+			return fmt.Errorf("failed to write compressed catalog %s: %v", catalog, err)
+		}
+		logging.Printf("Catalog %s compressed to %s.gz: %d to %d bytes, %.1f%% of the original\n",
+			catalog, filePath, len(data), size, compressionRatio(len(data), size))
+	}
+
+	return nil
+}
+
+// writeCompressed writes data compressed with gzip to path and returns the compressed size
+func writeCompressed(path string, data []byte) (int, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return 0, err
+	}
+	return buf.Len(), nil
+}
+
+// compressionRatio returns the compressed size as a percentage of the original
+func compressionRatio(original, compressed int) float64 {
+	if original == 0 {
+		return 100
+	}
+	return float64(compressed) * 100 / float64(original)
+}
+
+// Make builds and writes the catalogs of a repo.
+// Items are read from the whole repo, and only the catalogs in opts.Only are written when it is set.
+func Make(r *repo.Repo, opts Options) error {
+	logging.Printf("Getting list of pkgsinfo...\n")
+	pkgsInfos, err := Scan(r, opts.FixPaths)
+	if err != nil {
+		return fmt.Errorf("error scanning repo: %v", err)
+	}
+
+	for _, field := range pkginfo.UnstrippableFields(opts.StripFields) {
+		logging.Warnf("Warning: %s is needed to install items, it is kept in the catalogs.\n", field)
+	}
+	catalogs, err := Build(pkgsInfos, opts.StripFields)
+	if err != nil {
+		return fmt.Errorf("error building catalogs: %v", err)
+	}
+
+	selected, missing := catalogs.only(opts.Only)
+	for _, name := range missing {
+		logging.Warnf("Warning: no pkginfo is in catalog %s, it is not written.\n", name)
+	}
+	if err := selected.Write(r, opts.Compress); err != nil {
+		return fmt.Errorf("error writing catalogs: %v", err)
+	}
+
+	return nil
+}
+
+// olderVersion returns true if `a` is a lower version than `b`, comparing the versions
+// that don't parse as text
+func olderVersion(a, b string) bool {
+	if catalog.NewerVersion(b, a) {
+		return true
+	}
+	if catalog.NewerVersion(a, b) {
+		return false
+	}
+	return a < b
+}
+
+// ReportOwners writes a CSV of who imported each pkginfo and when, for auditing the repo.
+func ReportOwners(r *repo.Repo, out io.Writer) error {
+	pkgsInfos, err := Scan(r, false)
+	if err != nil {
+		return fmt.Errorf("error scanning repo: %v", err)
+	}
+	sort.Slice(pkgsInfos, func(i, j int) bool {
+		if pkgsInfos[i].Name != pkgsInfos[j].Name {
+			return pkgsInfos[i].Name < pkgsInfos[j].Name
+		}
+		return olderVersion(pkgsInfos[i].Version, pkgsInfos[j].Version)
+	})
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"name", "version", "owner", "import_date"})
+	for _, pkg := range pkgsInfos {
+		w.Write([]string{pkg.Name, pkg.Version, pkg.ImportedBy, pkg.ImportDate})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,159 @@
+package makecatalogs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/repo"
+)
+
+// testRepo creates a repo with pkginfos in the Production and Testing catalogs
+func testRepo(t *testing.T) *repo.Repo {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"pkgsinfo/Firefox-128.yaml": "name: Firefox\nversion: \"128.0\"\ncatalogs: [Production, Testing]\nnotes: From the vendor\ninstaller:\n  type: msi\n  location: 'apps\\Firefox-128.0.msi'\n",
+		"pkgsinfo/Slack-4.39.yaml":  "name: Slack\nversion: \"4.39\"\ncatalogs: [Testing]\nimported_by: admin\ninstaller:\n  type: msi\n  location: apps/Slack-4.39.msi\n",
+		"catalogs/Production.yaml":  "- name: Old\n  version: \"1.0\"\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := repo.Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// TestMake validates the catalogs are written with forward slash locations and without the
+// stripped fields, and only the catalogs asked for are written
+func TestMake(t *testing.T) {
+	r := testRepo(t)
+	opts := Options{StripFields: pkginfo.DefaultStripFields, Only: []string{"Testing"}, Compress: true}
+	if err := Make(r, opts); err != nil {
+		t.Fatalf("Make failed: %v", err)
+	}
+
+	items, err := r.ReadCatalog("Testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Installer.Location != "apps/Firefox-128.0.msi" {
+		t.Errorf("unexpected Testing catalog: %+v", items)
+	}
+	path, _ := r.CatalogPath("Testing")
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("notes")) || bytes.Contains(data, []byte("imported_by")) {
+		t.Errorf("expected the repo fields stripped:\n%s", data)
+	}
+	if _, err := os.Stat(path + ".gz"); err != nil {
+		t.Errorf("expected a compressed catalog: %v", err)
+	}
+
+	production, _ := r.ReadCatalog("Production")
+	if len(production) != 1 || production[0].Name != "Old" {
+		t.Errorf("expected the Production catalog left as it was, got %+v", production)
+	}
+}
+
+// TestMakeOnly validates the catalogs left out of opts.Only are untouched, and a catalog
+// no pkginfo is in isn't written
+func TestMakeOnly(t *testing.T) {
+	r := testRepo(t)
+	production, _ := r.CatalogPath("Production")
+	before, err := os.ReadFile(production)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Only: []string{"Testing", "Staging"}, Compress: true}
+	if err := Make(r, opts); err != nil {
+		t.Fatalf("Make failed: %v", err)
+	}
+	if after, _ := os.ReadFile(production); !bytes.Equal(before, after) {
+		t.Errorf("expected Production left as it was, got\n%s", after)
+	}
+	if _, err := os.Stat(production + ".gz"); !os.IsNotExist(err) {
+		t.Errorf("expected no compressed Production catalog, got %v", err)
+	}
+	if names, _ := r.CatalogNames(); !reflect.DeepEqual(names, []string{"Production", "Testing"}) {
+		t.Errorf("expected only Testing written, got %v", names)
+	}
+}
+
+// TestOnly validates the catalogs are selected by name, and the names without items are returned
+func TestOnly(t *testing.T) {
+	catalogs := Catalogs{
+		"Production": {{Name: "Firefox"}},
+		"Testing":    {{Name: "Firefox"}, {Name: "Slack"}},
+	}
+	selected, missing := catalogs.only([]string{"Testing", "Staging"})
+	if len(selected) != 1 || len(selected["Testing"]) != 2 || !reflect.DeepEqual(missing, []string{"Staging"}) {
+		t.Errorf("expected Testing selected and Staging missing, got %v %v", selected, missing)
+	}
+	if all, missing := catalogs.only(nil); len(all) != 2 || missing != nil {
+		t.Errorf("expected every catalog without names, got %v %v", all, missing)
+	}
+}
+
+// TestReportOwners validates the owners CSV is sorted by name
+func TestReportOwners(t *testing.T) {
+	var out bytes.Buffer
+	if err := ReportOwners(testRepo(t), &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "name,version,owner,import_date\nFirefox,128.0,,\nSlack,4.39,admin,\n"
+	if out.String() != expected {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
+
+// TestReportOwnersVersions validates the versions of an item are sorted as versions, not as text
+func TestReportOwnersVersions(t *testing.T) {
+	r := testRepo(t)
+	for _, version := range []string{"4.10", "4.9"} {
+		info := pkginfo.PkgsInfo{Name: "Slack", Version: version, ImportedBy: "admin"}
+		if err := r.WritePkgsinfo("Slack-"+version+".yaml", info); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := ReportOwners(r, &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "name,version,owner,import_date\nFirefox,128.0,,\nSlack,4.9,admin,\nSlack,4.10,admin,\nSlack,4.39,admin,\n"
+	if out.String() != expected {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
+
+// TestOlderVersion validates versions are compared as versions, and as text when they don't parse
+func TestOlderVersion(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"4.9", "4.10", true},
+		{"4.10", "4.9", false},
+		{"1.0", "1.0", false},
+		{"beta", "latest", true},
+		{"latest", "beta", false},
+	}
+	for _, tt := range tests {
+		if got := olderVersion(tt.a, tt.b); got != tt.expected {
+			t.Errorf("olderVersion(%q, %q): expected %v, got %v", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package manifest
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/windowsadmins/gorilla/pkg/config"
 	"github.com/windowsadmins/gorilla/pkg/download"
@@ -25,11 +30,13 @@ type Item struct {
 }
 
 // This abstraction allows us to override when testing
-var downloadGet = download.Get
+var downloadGet = download.GetOnce
 
 // Get returns two slices:
 // 1) All manifest objects
-// 2) Aditional catalogs that need to be added to the config
+// 2) Aditional catalogs that need to be added to the config, in priority order.
+// The catalogs of the primary manifest come first, in the order it lists them,
+// then those of the included manifests, in the order they are included.
 func Get(cfg config.Configuration) (manifests []Item, newCatalogs []string) {
 	// Create a slice with the names of all manifests
 	// This is so we can track them before we get the data
@@ -59,14 +66,7 @@ func Get(cfg config.Configuration) (manifests []Item, newCatalogs []string) {
 		workingList := []string{currentManifest}
 
 		// Download the manifest
-		manifestURL := cfg.URL + "manifests/" + currentManifest + ".yaml"
-		logging.Info("Manifest Url:", manifestURL)
-		yamlFile, err := downloadGet(manifestURL)
-		if err != nil {
-			logging.Error("Unable to retrieve manifest: ", err)
-		}
-
-		newManifest := parseManifest(manifestURL, yamlFile)
+		newManifest := getManifest(cfg, currentManifest)
 
 		// Add any includes to our working list
 		workingList = append(workingList, newManifest.Includes...)
@@ -102,13 +102,19 @@ func Get(cfg config.Configuration) (manifests []Item, newCatalogs []string) {
 
 		// If any catalogs are in the manifest, append them to the end of the list
 		for _, newCatalog := range newManifest.Catalogs {
-			// Before adding it, check if it is already on the list
+			// Before adding it, check if it is already on the list,
+			// a catalog keeps the priority it was first given
 			var match bool
 			for _, oldCatalog := range cfg.Catalogs {
 				if oldCatalog == newCatalog {
 					match = true
 				}
 			}
+			for _, oldCatalog := range newCatalogs {
+				if oldCatalog == newCatalog {
+					match = true
+				}
+			}
 			// If "match" is still false, it is not already in the catalog slice
 			if !match {
 				newCatalogs = append(newCatalogs, newCatalog)
@@ -138,10 +144,95 @@ func Get(cfg config.Configuration) (manifests []Item, newCatalogs []string) {
 	return manifests, newCatalogs
 }
 
-func parseManifest(manifestURL string, yamlFile []byte) Item {
-	// Parse the new manifest
+// getManifest downloads and parses a manifest, and stores a copy in the manifests path.
+// If the download fails or doesn't parse, such as a truncated download,
+// the previously stored copy is used instead.
+func getManifest(cfg config.Configuration, name string) Item {
+	segments, err := nameSegments(name)
+	if err != nil {
+		logging.Error("Unable to retrieve manifest: ", err)
+		return Item{}
+	}
+	manifestURL := escapedManifestURL(cfg, segments)
+	cachedManifest := filepath.Join(cfg.ManifestsPath, filepath.Join(segments...)+".yaml")
+
+	logging.Info("Manifest Url:", manifestURL)
+	yamlFile, err := downloadGet(manifestURL)
+	if err != nil {
+		logging.Error("Unable to retrieve manifest: ", err)
+	} else {
+		newManifest, parseErr := decodeManifest(yamlFile)
+		if parseErr == nil {
+			// Keep a copy for the next time the repo is unreachable
+			if cfg.ManifestsPath != "" {
+				if storeErr := download.Store(cachedManifest, yamlFile); storeErr != nil {
+					logging.Warn("Unable to cache manifest:", cachedManifest, storeErr)
+				}
+			}
+			return newManifest
+		}
+		logging.Error("Unable to parse yaml manifest: ", manifestURL, parseErr)
+	}
+
+	// Fall back to the cached copy on disk, or the one before it
+	var newManifest Item
+	if cfg.ManifestsPath != "" {
+		_, cacheErr := download.LastGood(cachedManifest, func(data []byte) (parseErr error) {
+			newManifest, parseErr = decodeManifest(data)
+			return parseErr
+		})
+		if cacheErr == nil {
+			logging.Warn("Using cached copy of manifest:", name)
+		}
+	}
+	return newManifest
+}
+
+// nameSegments splits a manifest name, such as a client identifier like "site/dept/hostname",
+// into its directories and file name. Backslashes separate directories too, and empty segments
+// are dropped. Names that would reach outside the manifests directory are refused.
+func nameSegments(name string) ([]string, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(name, `\`, "/"), "/") {
+		switch {
+		case segment == "":
+			continue
+		case segment == "." || segment == "..":
+			return nil, fmt.Errorf("manifest name %q has a relative path segment", name)
+		case strings.ContainsAny(segment, ":\x00"):
+			return nil, fmt.Errorf("manifest name %q has an invalid character", name)
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("manifest name %q is empty", name)
+	}
+	return segments, nil
+}
+
+// escapedManifestURL returns the URL of a manifest in the manifests directory of the repo, with
+// each segment of its name escaped. Plus signs are escaped too, as IIS reads them as spaces.
+func escapedManifestURL(cfg config.Configuration, segments []string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return strings.TrimRight(cfg.URL, "/") + "/manifests/" + strings.Join(escaped, "/") + ".yaml"
+}
+
+// decodeManifest parses a manifest
+func decodeManifest(yamlFile []byte) (Item, error) {
 	var newManifest Item
+	if len(bytes.TrimSpace(yamlFile)) == 0 {
+		return newManifest, errors.New("empty manifest")
+	}
 	err := yaml.Unmarshal(yamlFile, &newManifest)
+	return newManifest, err
+}
+
+func parseManifest(manifestURL string, yamlFile []byte) Item {
+	// Parse the new manifest
+	newManifest, err := decodeManifest(yamlFile)
 	if err != nil {
 		logging.Error("Unable to parse yaml manifest: ", manifestURL, err)
 	}
@@ -0,0 +1,113 @@
+package manifest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// fakeGet serves manifests by URL, failing for the ones missing
+type fakeGet map[string]string
+
+// use overrides downloadGet for the duration of the test
+func (f fakeGet) use(t *testing.T) {
+	origGet := downloadGet
+	t.Cleanup(func() { downloadGet = origGet })
+	downloadGet = func(url string) ([]byte, error) {
+		content, ok := f[url]
+		if !ok {
+			return nil, errors.New("download status code: 404")
+		}
+		return []byte(content), nil
+	}
+}
+
+const siteDefault = `
+name: site/default
+managed_installs:
+  - "Firefox"
+  - "Chrome"
+`
+
+// TestGetTruncated validates a manifest download that doesn't parse falls back to the last stored copy
+func TestGetTruncated(t *testing.T) {
+	get := fakeGet{"https://repo/manifests/site/default.yaml": siteDefault}
+	get.use(t)
+	cfg := config.Configuration{
+		URL:           "https://repo/",
+		Manifest:      "site/default",
+		ManifestsPath: t.TempDir(),
+	}
+	expected := []string{"Firefox", "Chrome"}
+
+	manifests, _ := Get(cfg)
+	if len(manifests) != 1 || !reflect.DeepEqual(manifests[0].Installs, expected) {
+		t.Fatalf("expected the manifest to be parsed, got %+v", manifests)
+	}
+	cachedManifest := filepath.Join(cfg.ManifestsPath, "site", "default.yaml")
+	if cached, err := os.ReadFile(cachedManifest); err != nil || string(cached) != siteDefault {
+		t.Fatalf("expected the manifest to be stored, got %q %v", cached, err)
+	}
+
+	// Cut off in the middle of an item
+	get["https://repo/manifests/site/default.yaml"] = siteDefault[:len(siteDefault)-5]
+	manifests, _ = Get(cfg)
+	if len(manifests) != 1 || !reflect.DeepEqual(manifests[0].Installs, expected) {
+		t.Errorf("expected the stored manifest to be used, got %+v", manifests)
+	}
+	if cached, _ := os.ReadFile(cachedManifest); string(cached) != siteDefault {
+		t.Errorf("expected the truncated download not to be stored, got %q", cached)
+	}
+
+	// An unreachable repo uses it too
+	delete(get, "https://repo/manifests/site/default.yaml")
+	manifests, _ = Get(cfg)
+	if len(manifests) != 1 || !reflect.DeepEqual(manifests[0].Installs, expected) {
+		t.Errorf("expected the stored manifest to be used, got %+v", manifests)
+	}
+}
+
+// TestGetEscapedNames validates client identifiers and included manifests are escaped in the URL,
+// and stored in the same directories under the manifests path
+func TestGetEscapedNames(t *testing.T) {
+	get := fakeGet{
+		"https://repo/manifests/site/dept%201/host%2B1.yaml": "name: host\nincluded_manifests:\n  - \"groups/café\"\n",
+		"https://repo/manifests/groups/caf%C3%A9.yaml":       "name: café\nmanaged_installs:\n  - Firefox\n",
+	}
+	get.use(t)
+	cfg := config.Configuration{
+		URL:           "https://repo/",
+		Manifest:      `site/dept 1\host+1`,
+		ManifestsPath: t.TempDir(),
+	}
+
+	manifests, _ := Get(cfg)
+	if len(manifests) != 2 || !reflect.DeepEqual(manifests[1].Installs, []string{"Firefox"}) {
+		t.Fatalf("expected both manifests, got %+v", manifests)
+	}
+	for _, path := range []string{
+		filepath.Join(cfg.ManifestsPath, "site", "dept 1", "host+1.yaml"),
+		filepath.Join(cfg.ManifestsPath, "groups", "café.yaml"),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected the manifest to be stored at %s: %v", path, err)
+		}
+	}
+}
+
+// TestNameSegments validates names reaching outside the manifests directory are refused
+func TestNameSegments(t *testing.T) {
+	segments, err := nameSegments("/site//dept/hostname/")
+	if err != nil || !reflect.DeepEqual(segments, []string{"site", "dept", "hostname"}) {
+		t.Errorf("expected site dept hostname, got %v, %v", segments, err)
+	}
+	for _, name := range []string{"../secrets", `site\..\..\hostname`, "site/./hostname", "C:/Windows/hostname", "", "/"} {
+		if _, err := nameSegments(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package pkginfo
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// installedType is the uninstaller type of a program already on the machine,
+// its location is a local path rather than a location in the repo
+const installedType = "installed"
+
+// NormalizeLocation returns a location in the repo with forward slashes,
+// as locations are always written to pkginfos and catalogs
+func NormalizeLocation(location string) string {
+	return strings.ReplaceAll(location, `\`, "/")
+}
+
+// NormalizeLocations changes the backslashes in the installer and uninstaller locations to
+// forward slashes, and returns the locations that were changed
+func (p *PkgsInfo) NormalizeLocations() []string {
+	var changed []string
+	for _, item := range []*InstallerItem{p.Installer, p.Uninstaller} {
+		if item == nil || item.Type == installedType {
+			continue
+		}
+		if normalized := NormalizeLocation(item.Location); normalized != item.Location {
+			changed = append(changed, item.Location)
+			item.Location = normalized
+		}
+	}
+	return changed
+}
+
+// FixLocations rewrites the backslashes in the locations of a pkginfo file to forward slashes.
+// Only the location values are changed, the other fields, their order and comments are kept.
+// changed is false when every location already used forward slashes.
+func FixLocations(data []byte) (fixed []byte, changed bool, err error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, false, fmt.Errorf("failed to decode pkgsinfo: %v", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return data, false, nil
+	}
+	if !normalizeLocationNodes(doc.Content[0]) {
+		return data, false, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, false, fmt.Errorf("failed to encode pkgsinfo: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, false, fmt.Errorf("failed to encode pkgsinfo: %v", err)
+	}
+	return buf.Bytes(), true, nil
+}
+
+// normalizeLocationNodes rewrites the backslashes in the installer and uninstaller locations of
+// a pkginfo mapping, or of each pkginfo in a list, and returns true when any of them changed
+func normalizeLocationNodes(node *yaml.Node) (changed bool) {
+	if node.Kind == yaml.DocumentNode || node.Kind == yaml.SequenceNode {
+		for _, child := range node.Content {
+			changed = normalizeLocationNodes(child) || changed
+		}
+		return changed
+	}
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+
+	fix := func(value *yaml.Node) {
+		if value.Kind == yaml.ScalarNode && strings.Contains(value.Value, `\`) {
+			value.Value = NormalizeLocation(value.Value)
+			value.Style = 0
+			changed = true
+		}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		switch {
+		case key == "installer_item_location":
+			fix(value)
+		case (key == "installer" || key == "uninstaller") && value.Kind == yaml.MappingNode:
+			if mappingValue(value, "type") == installedType {
+				continue
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				if value.Content[j].Value == "location" {
+					fix(value.Content[j+1])
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// mappingValue returns the scalar value of a key in a mapping node
+func mappingValue(mapping *yaml.Node, key string) string {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1].Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package pkginfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestNormalizeLocations validates payload locations get forward slashes and local programs are left alone
+func TestNormalizeLocations(t *testing.T) {
+	info := PkgsInfo{
+		Installer:   &InstallerItem{Type: "msi", Location: `\apps\Firefox\Firefox-128.0.msi`},
+		Uninstaller: &InstallerItem{Type: installedType, Location: `C:\Program Files\Mozilla Firefox\uninstall\helper.exe`},
+	}
+	changed := info.NormalizeLocations()
+	if !reflect.DeepEqual(changed, []string{`\apps\Firefox\Firefox-128.0.msi`}) {
+		t.Errorf("unexpected changed locations: %q", changed)
+	}
+	if info.Installer.Location != "/apps/Firefox/Firefox-128.0.msi" {
+		t.Errorf("unexpected installer location: %s", info.Installer.Location)
+	}
+	if info.Uninstaller.Location != `C:\Program Files\Mozilla Firefox\uninstall\helper.exe` {
+		t.Errorf("the installed uninstaller was changed: %s", info.Uninstaller.Location)
+	}
+
+	forward := PkgsInfo{Installer: &InstallerItem{Location: "/apps/Chrome.msi"}}
+	if changed := forward.NormalizeLocations(); changed != nil {
+		t.Errorf("expected nothing changed, got %q", changed)
+	}
+}
+
+// TestFixLocations validates the locations of a mixed separator pkginfo are rewritten in place
+func TestFixLocations(t *testing.T) {
+	data := []byte(`# Imported by hand
+name: Firefox
+version: "128.0"
+installer:
+  type: msi
+  location: "\\apps\\Firefox-128.0.msi"
+  hash: 0a1b2c
+uninstaller:
+  type: exe
+  location: apps/Firefox/uninstall.exe
+check:
+  file:
+    - path: C:\Program Files\Mozilla Firefox\firefox.exe
+`)
+	fixed, changed, err := FixLocations(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Fatal("expected the installer location to be fixed")
+	}
+	text := string(fixed)
+	for _, want := range []string{"# Imported by hand", "location: /apps/Firefox-128.0.msi", "location: apps/Firefox/uninstall.exe", `C:\Program Files\Mozilla Firefox\firefox.exe`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in:\n%s", want, text)
+		}
+	}
+
+	info, err := Decode(fixed)
+	if err != nil {
+		t.Fatalf("the fixed pkginfo doesn't decode: %v", err)
+	}
+	if info.Version != "128.0" || info.Installer.Hash != "0a1b2c" {
+		t.Errorf("unexpected pkginfo: %+v", info)
+	}
+}
+
+// TestFixLocationsLegacy validates the flat installer_item_location of older pkginfos is fixed too
+func TestFixLocationsLegacy(t *testing.T) {
+	fixed, changed, err := FixLocations([]byte("name: Chrome\ninstaller_item_location: apps\\Chrome.msi\n"))
+	if err != nil || !changed {
+		t.Fatalf("expected a fix, got %v %v", changed, err)
+	}
+	if !strings.Contains(string(fixed), "installer_item_location: apps/Chrome.msi") {
+		t.Errorf("unexpected pkginfo:\n%s", fixed)
+	}
+
+	unchanged := []byte("name: Chrome\ninstaller:\n  location: /apps/Chrome.msi\n")
+	if fixed, changed, _ := FixLocations(unchanged); changed || string(fixed) != string(unchanged) {
+		t.Errorf("expected the pkginfo as it was, got:\n%s", fixed)
+	}
+}
@@ -2,112 +2,148 @@
 package pkginfo
 
 import (
-    "encoding/json"
-    "os"
-    "log"
     "fmt"
-    "golang.org/x/sys/windows/registry"
-	"github.com/windowsadmins/gorilla/pkg/rollback"
+    "log"
+    "os"
+    "path/filepath"
+    "time"
+
+    "gopkg.in/yaml.v3"
 )
 
 const (
     InstallInfoPath = `C:\ProgramData\ManagedInstalls\InstallInfo.yaml`
 )
 
-// GetInstalledVersion retrieves the installed version of the specified software.
-func GetInstalledVersion(softwareName string) (string, error) {
-    // Define the registry keys to search
-    uninstallPaths := []string{
-        `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`,
-        `SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`,
-    }
+var (
+    // This abstraction allows us to override when testing
+    installInfoPath = InstallInfoPath
+)
 
-    // Search both HKEY_LOCAL_MACHINE and HKEY_CURRENT_USER
-    hives := []registry.Key{registry.LOCAL_MACHINE, registry.CURRENT_USER}
-
-    for _, hive := range hives {
-        for _, path := range uninstallPaths {
-            key, err := registry.OpenKey(hive, path, registry.READ)
-            if err != nil {
-                continue
-            }
-            defer key.Close()
-
-            subkeyNames, err := key.ReadSubKeyNames(-1)
-            if err != nil {
-                continue
-            }
-
-            for _, subkeyName := range subkeyNames {
-                subkey, err := registry.OpenKey(key, subkeyName, registry.READ)
-                if err != nil {
-                    continue
-                }
-
-                displayName, _, err := subkey.GetStringValue("DisplayName")
-                if err != nil {
-                    subkey.Close()
-                    continue
-                }
-
-                if displayName == softwareName {
-                    displayVersion, _, err := subkey.GetStringValue("DisplayVersion")
-                    subkey.Close()
-                    if err != nil {
-                        return "", fmt.Errorf("failed to get version for %s: %v", softwareName, err)
-                    }
-                    log.Printf("Found installed version for %s: %s", softwareName, displayVersion)
-                    return displayVersion, nil
-                }
-                subkey.Close()
-            }
-        }
-    }
+// PkgInfo represents the metadata for a package, including dependencies
+type PkgInfo struct {
+    Name         string        `yaml:"name"`
+    DisplayName  string        `yaml:"display_name,omitempty"`
+    Version      string        `yaml:"version"`
+    Dependencies []string      `yaml:"dependencies,omitempty"`
+    Installer    InstallerItem `yaml:"installer,omitempty"`
+}
 
-    // Software not found
-    return "", fmt.Errorf("software %s not found", softwareName)
+// InstallInfo is the record of the items Gorilla has installed, saved as InstallInfo.yaml
+type InstallInfo struct {
+    InstalledItems []InstalledItem `yaml:"installed_items"`
 }
 
-// PkgInfo represents the metadata for a package, including dependencies
-type PkgInfo struct {
-    Name              string   `json:"name"`
-    Version           string   `json:"version"`
-    Dependencies      []string `json:"dependencies"`
-    InstallerLocation string   `json:"installer_location"`
+// InstalledItem is an item in InstallInfo.yaml
+type InstalledItem struct {
+    Name         string    `yaml:"name"`
+    Version      string    `yaml:"version"`
+    InstallTime  time.Time `yaml:"install_time"`
+    Method       string    `yaml:"method"` // The installer type, such as msi, exe or ps1
+    Dependencies []string  `yaml:"dependencies,omitempty"`
 }
 
 // ReadPkgInfo reads and parses the pkgsinfo metadata from the given path.
 func ReadPkgInfo(filePath string) (map[string]interface{}, error) {
-    file, err := os.Open(filePath)
+    data, err := os.ReadFile(filePath)
     if err != nil {
         return nil, fmt.Errorf("failed to open pkgsinfo file: %v", err)
     }
-    defer file.Close()
 
     var pkgInfo map[string]interface{}
-    if err := json.NewDecoder(file).Decode(&pkgInfo); err != nil {
+    if err := yaml.Unmarshal(data, &pkgInfo); err != nil {
         return nil, fmt.Errorf("failed to decode pkgsinfo: %v", err)
     }
+    if pkgInfo == nil {
+        return nil, fmt.Errorf("failed to decode pkgsinfo: %s is empty", filePath)
+    }
 
     return pkgInfo, nil
 }
 
-// InstallDependencies installs all dependencies for the given package
-func InstallDependencies(pkg *PkgInfo) error {
+// ReadInstallInfo reads InstallInfo.yaml from the given path.
+func ReadInstallInfo(filePath string) (InstallInfo, error) {
+    data, err := os.ReadFile(filePath)
+    if err != nil {
+        return InstallInfo{}, fmt.Errorf("failed to open install info file: %v", err)
+    }
+
+    var installInfo InstallInfo
+    if err := yaml.Unmarshal(data, &installInfo); err != nil {
+        return InstallInfo{}, fmt.Errorf("failed to decode install info: %v", err)
+    }
+    return installInfo, nil
+}
+
+// WriteInstallInfo saves InstallInfo.yaml to the given path, creating its directory if needed.
+func WriteInstallInfo(filePath string, installInfo InstallInfo) error {
+    data, err := yaml.Marshal(&installInfo)
+    if err != nil {
+        return fmt.Errorf("failed to encode install info: %v", err)
+    }
+
+    if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+        return fmt.Errorf("failed to create install info directory: %v", err)
+    }
+    return os.WriteFile(filePath, data, 0644)
+}
+
+// UpdateInstallInfo records the items that were installed in InstallInfo.yaml, replacing their
+// earlier entries, and drops the items that were removed. A missing file is started empty.
+func UpdateInstallInfo(installed []InstalledItem, removed []string) error {
+    var installInfo InstallInfo
+    if _, err := os.Stat(installInfoPath); err == nil {
+        if installInfo, err = ReadInstallInfo(installInfoPath); err != nil {
+            return err
+        }
+    }
+
+    drop := make(map[string]bool)
+    for _, name := range removed {
+        drop[name] = true
+    }
+    for _, item := range installed {
+        drop[item.Name] = true
+    }
+    kept := make([]InstalledItem, 0, len(installInfo.InstalledItems)+len(installed))
+    for _, item := range installInfo.InstalledItems {
+        if !drop[item.Name] {
+            kept = append(kept, item)
+        }
+    }
+    installInfo.InstalledItems = append(kept, installed...)
+    return WriteInstallInfo(installInfoPath, installInfo)
+}
+
+// InstallDependencies installs all dependencies for the given package with the provided
+// install function, the dependencies of each dependency first.
+func InstallDependencies(pkg *PkgInfo, install func(*PkgInfo) error) error {
+    return installDependencies(pkg, install, map[string]bool{pkg.Name: true})
+}
+
+// installDependencies keeps track of the packages already visited to stop on cycles
+func installDependencies(pkg *PkgInfo, install func(*PkgInfo) error, visited map[string]bool) error {
     if len(pkg.Dependencies) == 0 {
         log.Printf("No dependencies for package: %s", pkg.Name)
         return nil
     }
 
     for _, dependency := range pkg.Dependencies {
-        log.Printf("Installing dependency: %s for package: %s", dependency, pkg.Name)
+        if visited[dependency] {
+            continue
+        }
+        visited[dependency] = true
+
         depPkg, err := LoadPackageInfo(dependency)
         if err != nil {
             return fmt.Errorf("failed to load dependency %s: %v", dependency, err)
         }
+        if err := installDependencies(depPkg, install, visited); err != nil {
+            return err
+        }
 
-        err = InstallPackage(depPkg)
-        if err != nil {
+        log.Printf("Installing dependency: %s for package: %s", dependency, pkg.Name)
+        if err := install(depPkg); err != nil {
             return fmt.Errorf("failed to install dependency %s: %v", dependency, err)
         }
     }
@@ -116,45 +152,20 @@ func InstallDependencies(pkg *PkgInfo) error {
 
 // LoadPackageInfo loads the package metadata from InstallInfo.yaml
 func LoadPackageInfo(packageName string) (*PkgInfo, error) {
-    file, err := os.Open(InstallInfoPath)
+    installInfo, err := ReadInstallInfo(installInfoPath)
     if err != nil {
-        return nil, fmt.Errorf("failed to open install info file: %v", err)
+        return nil, err
     }
-    defer file.Close()
 
-    var installedPackages []PkgInfo
-    if err := json.NewDecoder(file).Decode(&installedPackages); err != nil {
-        return nil, fmt.Errorf("failed to decode install info: %v", err)
-    }
-
-    for _, pkg := range installedPackages {
-        if pkg.Name == packageName {
-            return &pkg, nil
+    for _, item := range installInfo.InstalledItems {
+        if item.Name == packageName {
+            return &PkgInfo{
+                Name:         item.Name,
+                Version:      item.Version,
+                Dependencies: item.Dependencies,
+                Installer:    InstallerItem{Type: item.Method},
+            }, nil
         }
     }
     return nil, fmt.Errorf("package %s not found", packageName)
 }
-
-// InstallPackage installs the given package, including handling dependencies
-func InstallPackage(pkg *PkgInfo) error {
-	rollbackManager := &rollback.RollbackManager{}
-    log.Printf("Starting installation for package: %s Version: %s", pkg.Name, pkg.Version)
-
-    // Install dependencies first
-    if err := InstallDependencies(pkg); err != nil {
-        rollbackManager.ExecuteRollback()
-		return fmt.Errorf("failed to install dependencies for package %s: %v", pkg.Name, err)
-    }
-
-    // Simulate the installation process
-    log.Printf("Installing package: %s Version: %s", pkg.Name, pkg.Version)
-	rollbackManager.AddRollbackAction(rollback.RollbackAction{Description: "Uninstalling package", Execute: func() error {
-		// Placeholder for uninstall logic
-		log.Printf("Rolling back installation for package: %s", pkg.Name)
-		return nil
-	}})
-
-    // Log the completion of the installation
-    log.Printf("Successfully installed package: %s Version: %s", pkg.Name, pkg.Version)
-    return nil
-}
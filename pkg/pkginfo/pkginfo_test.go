@@ -0,0 +1,180 @@
+package pkginfo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// useInstallInfo writes an InstallInfo.yaml to a temp directory and points LoadPackageInfo at it
+func useInstallInfo(t *testing.T, installInfo InstallInfo) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ManagedInstalls", "InstallInfo.yaml")
+	if err := WriteInstallInfo(path, installInfo); err != nil {
+		t.Fatalf("WriteInstallInfo failed: %v", err)
+	}
+
+	origPath := installInfoPath
+	installInfoPath = path
+	t.Cleanup(func() { installInfoPath = origPath })
+	return path
+}
+
+// TestInstallInfoRoundTrip validates InstallInfo.yaml reads back what was written
+func TestInstallInfoRoundTrip(t *testing.T) {
+	installInfo := InstallInfo{
+		InstalledItems: []InstalledItem{
+			{
+				Name:         "Firefox",
+				Version:      "128.0",
+				InstallTime:  time.Date(2024, 7, 9, 14, 30, 0, 0, time.UTC),
+				Method:       "msi",
+				Dependencies: []string{"VCRedist"},
+			},
+			{
+				Name:        "VCRedist",
+				Version:     "14.40.33810",
+				InstallTime: time.Date(2024, 7, 9, 14, 29, 0, 0, time.UTC),
+				Method:      "exe",
+			},
+		},
+	}
+	path := useInstallInfo(t, installInfo)
+
+	got, err := ReadInstallInfo(path)
+	if err != nil {
+		t.Fatalf("ReadInstallInfo failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, installInfo) {
+		t.Errorf("expected %+v, got %+v", installInfo, got)
+	}
+
+	pkg, err := LoadPackageInfo("Firefox")
+	if err != nil {
+		t.Fatalf("LoadPackageInfo failed: %v", err)
+	}
+	if pkg.Version != "128.0" || !reflect.DeepEqual(pkg.Dependencies, []string{"VCRedist"}) {
+		t.Errorf("unexpected package: %+v", pkg)
+	}
+	if _, err := LoadPackageInfo("Chrome"); err == nil {
+		t.Errorf("expected an error for a package that is not in InstallInfo")
+	}
+}
+
+// TestReadInstallInfoInvalid validates bad YAML and a missing file return errors
+func TestReadInstallInfoInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "InstallInfo.yaml")
+	if err := os.WriteFile(path, []byte("installed_items: {name: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadInstallInfo(path); err == nil {
+		t.Errorf("expected an error for invalid YAML")
+	}
+	if _, err := ReadInstallInfo(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+// TestUpdateInstallInfo validates installed items replace their earlier entries, removed items
+// are dropped, and a missing InstallInfo.yaml is created
+func TestUpdateInstallInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ManagedInstalls", "InstallInfo.yaml")
+	origPath := installInfoPath
+	installInfoPath = path
+	t.Cleanup(func() { installInfoPath = origPath })
+
+	firefox := InstalledItem{Name: "Firefox", Version: "127.0", Method: "msi"}
+	java := InstalledItem{Name: "Java", Version: "8.0", Method: "exe"}
+	if err := UpdateInstallInfo([]InstalledItem{firefox, java}, nil); err != nil {
+		t.Fatalf("UpdateInstallInfo failed: %v", err)
+	}
+
+	firefox.Version = "128.0"
+	chrome := InstalledItem{Name: "Chrome", Version: "126.0", Method: "msi"}
+	if err := UpdateInstallInfo([]InstalledItem{firefox, chrome}, []string{"Java"}); err != nil {
+		t.Fatalf("UpdateInstallInfo failed: %v", err)
+	}
+
+	got, err := ReadInstallInfo(path)
+	if err != nil {
+		t.Fatalf("ReadInstallInfo failed: %v", err)
+	}
+	expected := []InstalledItem{firefox, chrome}
+	if !reflect.DeepEqual(got.InstalledItems, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got.InstalledItems)
+	}
+}
+
+// TestReadPkgInfo validates a pkgsinfo written by gorillaimport is read as YAML
+func TestReadPkgInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Firefox-128.0.yaml")
+	content := []byte(`name: Firefox
+display_name: Mozilla Firefox
+version: "128.0"
+catalogs:
+  - production
+installer:
+  location: /apps/Firefox-128.0.msi
+  hash: 0123abcd
+  type: msi
+dependencies:
+  - VCRedist
+`)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkgInfo, err := ReadPkgInfo(path)
+	if err != nil {
+		t.Fatalf("ReadPkgInfo failed: %v", err)
+	}
+	if pkgInfo["name"] != "Firefox" || pkgInfo["version"] != "128.0" {
+		t.Errorf("unexpected pkgsinfo: %v", pkgInfo)
+	}
+	installer, ok := pkgInfo["installer"].(map[string]interface{})
+	if !ok || installer["type"] != "msi" {
+		t.Errorf("unexpected installer: %v", pkgInfo["installer"])
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.yaml")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPkgInfo(empty); err == nil {
+		t.Errorf("expected an error for an empty pkgsinfo")
+	}
+}
+
+// TestInstallDependencies validates dependencies are installed depth first, once each
+func TestInstallDependencies(t *testing.T) {
+	useInstallInfo(t, InstallInfo{
+		InstalledItems: []InstalledItem{
+			{Name: "Firefox", Version: "128.0", Method: "msi", Dependencies: []string{"VCRedist", "DotNet"}},
+			{Name: "VCRedist", Version: "14.40", Method: "exe", Dependencies: []string{"DotNet"}},
+			{Name: "DotNet", Version: "8.0", Method: "exe", Dependencies: []string{"Firefox"}},
+		},
+	})
+
+	var installed []string
+	install := func(pkg *PkgInfo) error {
+		installed = append(installed, pkg.Name)
+		return nil
+	}
+	pkg := &PkgInfo{Name: "Firefox", Dependencies: []string{"VCRedist", "DotNet"}}
+	if err := InstallDependencies(pkg, install); err != nil {
+		t.Fatalf("InstallDependencies failed: %v", err)
+	}
+
+	expected := []string{"DotNet", "VCRedist"}
+	if !reflect.DeepEqual(installed, expected) {
+		t.Errorf("expected %v, got %v", expected, installed)
+	}
+
+	missing := &PkgInfo{Name: "Chrome", Dependencies: []string{"Updater"}}
+	if err := InstallDependencies(missing, install); err == nil {
+		t.Errorf("expected an error for a missing dependency")
+	}
+}
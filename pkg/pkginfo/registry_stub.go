@@ -0,0 +1,13 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package pkginfo
+
+import "fmt"
+
+// GetInstalledVersion is just a placeholder on darwin, there is no uninstall registry to search
+func GetInstalledVersion(softwareName string) (string, error) {
+	return "", fmt.Errorf("software %s not found", softwareName)
+}
@@ -0,0 +1,450 @@
+package pkginfo
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PkgsInfo is a pkginfo as the authoring tools write it to the pkgsinfo directory of the repo,
+// and as makecatalogs reads it back
+type PkgsInfo struct {
+	Name                 string         `yaml:"name"`
+	DisplayName          string         `yaml:"display_name"`
+	Version              string         `yaml:"version"`
+	Description          string         `yaml:"description"`
+	Catalogs             []string       `yaml:"catalogs"`
+	Category             string         `yaml:"category"`
+	Developer            string         `yaml:"developer"`
+	UnattendedInstall    *bool          `yaml:"unattended_install,omitempty"`
+	UnattendedUninstall  *bool          `yaml:"unattended_uninstall,omitempty"`
+	Dependencies         []string       `yaml:"dependencies,omitempty"`
+	BlockingApps         []string       `yaml:"blocking_apps,omitempty"`
+	BlockingAppsAction   string         `yaml:"blocking_apps_action,omitempty"`
+	BlockingAppsTimeout  int            `yaml:"blocking_apps_timeout_seconds,omitempty"`
+	Installer            *InstallerItem `yaml:"installer,omitempty"`
+	Uninstaller          *InstallerItem `yaml:"uninstaller,omitempty"`
+	Check                *InstallCheck  `yaml:"check,omitempty"`
+	IconName             string         `yaml:"icon_name,omitempty"`
+	SupportedArch        []string       `yaml:"supported_architectures,omitempty"`
+	Language             string         `yaml:"language,omitempty"`
+	MinimumOSVersion     string         `yaml:"minimum_os_version,omitempty"`
+	MaximumOSVersion     string         `yaml:"maximum_os_version,omitempty"`
+	InstallScope         string         `yaml:"install_scope,omitempty"`
+	ProductCode          string         `yaml:"product_code,omitempty"`
+	UpgradeCode          string         `yaml:"upgrade_code,omitempty"`
+	RegistryKeys         []string       `yaml:"registry_keys,omitempty"`
+	RollbackOnFailure    bool           `yaml:"rollback_on_failure,omitempty"`
+	ForceInstallAfter    string         `yaml:"force_install_after_date,omitempty"`
+	SkipVerification     bool           `yaml:"skip_verification,omitempty"`
+	PreinstallScript     string         `yaml:"preinstall_script,omitempty"`
+	PostinstallScript    string         `yaml:"postinstall_script,omitempty"`
+	PreuninstallScript   string         `yaml:"preuninstall_script,omitempty"`
+	PostuninstallScript  string         `yaml:"postuninstall_script,omitempty"`
+	InstallCheckScript   string         `yaml:"installcheck_script,omitempty"`
+	UninstallCheckScript string         `yaml:"uninstallcheck_script,omitempty"`
+	UserMessage          string         `yaml:"user_message,omitempty"`
+
+	// Notes, ImportedBy, ImportDate and SourceURL are for the repo tooling, makecatalogs strips them
+	// from the catalogs by default. SourceURL is where gorillaimport downloaded the installer from.
+	Notes      string `yaml:"notes,omitempty"`
+	ImportedBy string `yaml:"imported_by,omitempty"`
+	ImportDate string `yaml:"import_date,omitempty"`
+	SourceURL  string `yaml:"source_url,omitempty"`
+
+	// Extras holds any fields that are not defined above,
+	// so they are retained when the pkginfo is encoded again
+	Extras map[string]interface{} `yaml:",inline"`
+}
+
+// CatalogItem is an item in a catalog, as makecatalogs writes it and the client reads it
+type CatalogItem struct {
+	Name         string        `yaml:"name"`
+	Dependencies []string      `yaml:"dependencies"`
+	DisplayName  string        `yaml:"display_name"`
+	Check        InstallCheck  `yaml:"check"`
+	Installer    InstallerItem `yaml:"installer"`
+	Uninstaller  InstallerItem `yaml:"uninstaller"`
+	Version      string        `yaml:"version"`
+	BlockingApps []string      `yaml:"blocking_apps"`
+	PreScript    string        `yaml:"preinstall_script"`
+	PostScript   string        `yaml:"postinstall_script"`
+
+	// BlockingAppsAction is what to do when a blocking app is running before an install:
+	// skip the install, wait for the app to close, or terminate it. The default is skip.
+	BlockingAppsAction  string `yaml:"blocking_apps_action,omitempty"`
+	BlockingAppsTimeout int    `yaml:"blocking_apps_timeout_seconds,omitempty"`
+
+	// SupportedArch lists the architectures the item installs on, all of them when empty
+	SupportedArch []string `yaml:"supported_architectures"`
+
+	// Description and UserMessage are shown to the logged on user while the item installs,
+	// UserMessage in place of the description when it is set
+	Description string `yaml:"description,omitempty"`
+	UserMessage string `yaml:"user_message,omitempty"`
+
+	// MinimumOSVersion and MaximumOSVersion limit the Windows versions the item installs on,
+	// compared with the major.minor.build of Windows, such as 10.0.22631
+	MinimumOSVersion string `yaml:"minimum_os_version,omitempty"`
+	MaximumOSVersion string `yaml:"maximum_os_version,omitempty"`
+
+	// InstallScope is machine, the default, or user for items installed in the profile
+	// and HKCU of the logged on user, which are checked and installed as that user
+	InstallScope string `yaml:"install_scope,omitempty"`
+
+	// RollbackOnFailure undoes an install when the postinstall script or verification fails
+	RollbackOnFailure bool `yaml:"rollback_on_failure"`
+
+	// ForceInstallAfter is an RFC 3339 date. Once it has passed, the item is installed
+	// even while the user is active or its blocking apps are running.
+	ForceInstallAfter string `yaml:"force_install_after_date,omitempty"`
+
+	// SkipVerification leaves out the status check after an install, for items
+	// that only show as installed after a reboot
+	SkipVerification bool `yaml:"skip_verification,omitempty"`
+
+	// ProductCode and UpgradeCode identify the msi of an item. Items without a check are
+	// checked by the product code, and msi items are uninstalled by it.
+	ProductCode string `yaml:"product_code,omitempty"`
+	UpgradeCode string `yaml:"upgrade_code,omitempty"`
+
+	// RegistryKeys are the keys a reg item sets, deleted with their subkeys to uninstall it
+	// when it has no uninstaller
+	RegistryKeys []string `yaml:"registry_keys,omitempty"`
+
+	// UnattendedInstall and UnattendedUninstall set to false leave the item to interactive runs,
+	// automatic runs defer it. Catalogs written before the fields were carried leave them unset.
+	UnattendedInstall   *bool `yaml:"unattended_install,omitempty"`
+	UnattendedUninstall *bool `yaml:"unattended_uninstall,omitempty"`
+
+	// Extras holds any fields that are not defined above,
+	// so they are retained when the item is encoded again
+	Extras map[string]interface{} `yaml:",inline"`
+}
+
+// InstallerItem holds information about how to install or uninstall an item
+type InstallerItem struct {
+	Type      string   `yaml:"type"`
+	Location  string   `yaml:"location"`
+	Hash      string   `yaml:"hash"`
+	Size      int64    `yaml:"size,omitempty"` // In kilobytes
+	Arguments []string `yaml:"arguments,omitempty"`
+
+	// ProductCode is where older pkginfos kept the product code of an msi. It is moved to the
+	// product_code of the item when read, which is the only one used.
+	ProductCode string `yaml:"product_code,omitempty"`
+
+	// Script is the PowerShell the script type runs, in place of a payload
+	Script string `yaml:"script,omitempty"`
+}
+
+// ScriptType is the installer and uninstaller type of an item whose whole install is
+// its script, which has no location or hash
+const ScriptType = "script"
+
+// Runnable returns true when an installer has something to run: a payload at its location,
+// or the script of the script type
+func (i InstallerItem) Runnable() bool {
+	if i.Type == ScriptType {
+		return i.Script != ""
+	}
+	return i.Type != "" && i.Location != ""
+}
+
+// InstallCheck holds information about how to check the status of an item
+type InstallCheck struct {
+	File     []FileCheck `yaml:"file,omitempty"`
+	Script   string      `yaml:"script,omitempty"`
+	Registry RegCheck    `yaml:"registry,omitempty"`
+
+	// UninstallScript checks whether an item needs to be uninstalled, in place of the other checks.
+	// It exits 0 when the item is installed, the opposite of Script.
+	UninstallScript string `yaml:"uninstall_script,omitempty"`
+}
+
+// DirectoryCheck is the type of a file check whose path is a directory of content, such as fonts or a plugin pack
+const DirectoryCheck = "directory"
+
+// FileCheck holds information about checking via a file
+type FileCheck struct {
+	Path        string `yaml:"path"`
+	Version     string `yaml:"version,omitempty"`
+	ProductName string `yaml:"product_name,omitempty"`
+	CompanyName string `yaml:"company_name,omitempty"`
+	Hash        string `yaml:"hash,omitempty"`
+
+	// Type is empty for a file, or directory. A directory is installed when it has at least
+	// MinFiles files and MinSizeMB megabytes in it and its subdirectories.
+	Type      string `yaml:"type,omitempty"`
+	MinFiles  int    `yaml:"min_files,omitempty"`
+	MinSizeMB int    `yaml:"min_size_mb,omitempty"`
+}
+
+// RegCheck holds information about checking via registry, either the version of an application
+// by its name, or a value of a key such as one a reg item sets
+type RegCheck struct {
+	Name    string `yaml:"name,omitempty"`
+	Version string `yaml:"version,omitempty"`
+
+	// ExactMatch only matches an application whose display name is Name, ignoring case.
+	// Otherwise the closest display name that contains Name is also a match.
+	ExactMatch bool `yaml:"exact_match,omitempty"`
+
+	// Key and Value are a value that exists when the item is installed.
+	// When Data is set, the value must also have that data, as text.
+	Key   string `yaml:"key,omitempty"`
+	Value string `yaml:"value,omitempty"`
+	Data  string `yaml:"data,omitempty"`
+}
+
+// legacyInstallerFields are the flat installer fields older versions of makepkginfo wrote
+var legacyInstallerFields = []string{"installer_type", "installer_item_location", "installer_item_hash", "installer_item_size"}
+
+// Decode parses a pkginfo, moving the flat installer_item_* fields of older pkginfos into `installer`
+func Decode(data []byte) (PkgsInfo, error) {
+	var info PkgsInfo
+	if err := yaml.Unmarshal(data, &info); err != nil {
+		return PkgsInfo{}, fmt.Errorf("failed to decode pkgsinfo: %v", err)
+	}
+	info.migrateLegacyInstaller()
+	info.migrateProductCode()
+	return info, nil
+}
+
+// migrateProductCode moves the product code older pkginfos set on the installer to the item
+func (p *PkgsInfo) migrateProductCode() {
+	if p.Installer != nil {
+		moveProductCode(&p.ProductCode, p.Installer)
+	}
+}
+
+// MigrateProductCode moves the product code older catalogs set on the installer to the item
+func (c *CatalogItem) MigrateProductCode() {
+	moveProductCode(&c.ProductCode, &c.Installer)
+}
+
+// moveProductCode moves the product code of an installer to productCode, unless it is already set
+func moveProductCode(productCode *string, installer *InstallerItem) {
+	if *productCode == "" {
+		*productCode = installer.ProductCode
+	}
+	installer.ProductCode = ""
+}
+
+// migrateLegacyInstaller moves installer_type, installer_item_location, installer_item_hash
+// and installer_item_size into Installer, unless it is already set
+func (p *PkgsInfo) migrateLegacyInstaller() {
+	if p.Installer != nil {
+		return
+	}
+	found := false
+	installer := &InstallerItem{}
+	for _, field := range legacyInstallerFields {
+		value, ok := p.Extras[field]
+		if !ok {
+			continue
+		}
+		found = true
+		delete(p.Extras, field)
+
+		switch field {
+		case "installer_type":
+			installer.Type = fmt.Sprint(value)
+		case "installer_item_location":
+			installer.Location = fmt.Sprint(value)
+		case "installer_item_hash":
+			installer.Hash = fmt.Sprint(value)
+		case "installer_item_size":
+			if size, ok := value.(int); ok {
+				installer.Size = int64(size)
+			}
+		}
+	}
+	if found {
+		p.Installer = installer
+	}
+	if len(p.Extras) == 0 {
+		p.Extras = nil
+	}
+}
+
+// Encode writes a pkginfo or catalog as canonical YAML, so the same content is always written
+// the same way whichever tool wrote it: fields in the order of the struct, versions as quoted
+// strings, scripts as literal block scalars, locations with forward slashes and no empty fields
+func Encode(v interface{}) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode pkgsinfo: %v", err)
+	}
+	canonicalize(&node)
+	normalizeLocationNodes(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, fmt.Errorf("failed to encode pkgsinfo: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode pkgsinfo: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// requiredFields are written even when they are empty
+var requiredFields = map[string]bool{"name": true, "version": true}
+
+// canonicalize removes the empty fields of every mapping, quotes versions
+// and sets the literal style on every script
+func canonicalize(node *yaml.Node) {
+	for _, child := range node.Content {
+		canonicalize(child)
+	}
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	var content []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if isEmptyNode(value) && !requiredFields[key.Value] {
+			continue
+		}
+		if value.Kind == yaml.ScalarNode && value.Tag == "!!str" {
+			switch {
+			case isVersionField(key.Value):
+				value.Style = yaml.DoubleQuotedStyle
+			case isScriptField(key.Value) && value.Value != "":
+				value.Style = yaml.LiteralStyle
+			}
+		}
+		content = append(content, key, value)
+	}
+	node.Content = content
+}
+
+// isEmptyNode returns true for null, an empty string and an empty list or mapping
+func isEmptyNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Tag == "!!null" || (node.Tag == "!!str" && node.Value == "")
+	case yaml.SequenceNode, yaml.MappingNode:
+		return len(node.Content) == 0
+	}
+	return false
+}
+
+// isVersionField returns true for the fields that hold versions, which are always strings
+// even when they look like a number, such as 1.10
+func isVersionField(field string) bool {
+	return field == "version" || strings.HasSuffix(field, "_os_version")
+}
+
+// isScriptField returns true for the fields that hold PowerShell scripts
+func isScriptField(field string) bool {
+	return field == "script" || strings.HasSuffix(field, "_script")
+}
+
+// CatalogItem returns the pkginfo as an item for a catalog. Fields the client does not
+// use are kept in Extras, the installcheck_script becomes the check script and the
+// uninstallcheck_script the uninstall check script.
+func (p PkgsInfo) CatalogItem() (CatalogItem, error) {
+	var item CatalogItem
+	if err := convert(p, &item); err != nil {
+		return CatalogItem{}, err
+	}
+	if item.Check.Script == "" && p.InstallCheckScript != "" {
+		item.Check.Script = p.InstallCheckScript
+		delete(item.Extras, "installcheck_script")
+	}
+	if item.Check.UninstallScript == "" && p.UninstallCheckScript != "" {
+		item.Check.UninstallScript = p.UninstallCheckScript
+		delete(item.Extras, "uninstallcheck_script")
+	}
+	return item, nil
+}
+
+// Bool returns a pointer to value, for the fields that are left out when unset such as unattended_install
+func Bool(value bool) *bool {
+	return &value
+}
+
+// DefaultStripFields are the pkginfo fields makecatalogs leaves out of the catalogs
+// unless `catalog_strip_fields` is set
+var DefaultStripFields = []string{"notes", "imported_by", "import_date", "source_url"}
+
+// unstrippableFields are the catalog fields the client can't install an item without,
+// which are never stripped
+var unstrippableFields = map[string]bool{
+	"name":         true,
+	"version":      true,
+	"installer":    true,
+	"uninstaller":  true,
+	"check":        true,
+	"dependencies": true,
+}
+
+// UnstrippableFields returns the fields of a strip list that StripFields keeps,
+// so they can be reported once rather than for every item
+func UnstrippableFields(fields []string) []string {
+	var kept []string
+	for _, field := range fields {
+		if unstrippableFields[field] {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// StripFields removes fields the client doesn't use from a catalog item, both the fields
+// kept in Extras and those defined above such as description. The required fields are kept.
+func (c *CatalogItem) StripFields(fields []string) {
+	for _, field := range fields {
+		if unstrippableFields[field] {
+			continue
+		}
+		delete(c.Extras, field)
+		c.clearField(field)
+	}
+	if len(c.Extras) == 0 {
+		c.Extras = nil
+	}
+}
+
+// clearField sets the field of the item with the YAML name to its zero value, when there is one
+func (c *CatalogItem) clearField(name string) {
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		tag := strings.Split(value.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == name {
+			value.Field(i).Set(reflect.Zero(value.Field(i).Type()))
+			return
+		}
+	}
+}
+
+// FromCatalogItem returns a catalog item as a pkginfo, such as for items read back from All.yaml
+func FromCatalogItem(item CatalogItem) (PkgsInfo, error) {
+	var info PkgsInfo
+	if err := convert(item, &info); err != nil {
+		return PkgsInfo{}, err
+	}
+	info.migrateLegacyInstaller()
+	info.migrateProductCode()
+	return info, nil
+}
+
+// convert copies the fields of one struct to the other by their YAML names
+func convert(from, to interface{}) error {
+	data, err := yaml.Marshal(from)
+	if err != nil {
+		return fmt.Errorf("failed to convert %T: %v", from, err)
+	}
+	if err := yaml.Unmarshal(data, to); err != nil {
+		return fmt.Errorf("failed to convert %T: %v", from, err)
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package pkginfo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// importedPkgsInfo is a pkginfo as gorillaimport writes it
+func importedPkgsInfo() PkgsInfo {
+	return PkgsInfo{
+		Name:                "Firefox",
+		DisplayName:         "Mozilla Firefox",
+		Version:             "128.0",
+		Description:         "Web browser",
+		Catalogs:            []string{"testing", "production"},
+		Category:            "Browsers",
+		Developer:           "Mozilla",
+		UnattendedInstall:   Bool(true),
+		UnattendedUninstall: Bool(true),
+		Dependencies:        []string{"VCRedist"},
+		Installer: &InstallerItem{
+			Type:      "msi",
+			Location:  "/apps/Firefox-128.0.msi",
+			Hash:      "0a1b2c",
+			Size:      58000,
+			Arguments: []string{"/qn"},
+		},
+		Uninstaller:          &InstallerItem{Type: "exe", Location: "/apps/Firefox-uninstall.exe", Hash: "3d4e5f"},
+		Check:                &InstallCheck{File: []FileCheck{{Path: `C:\Program Files\Mozilla Firefox\firefox.exe`, Version: "128.0"}}},
+		IconName:             "Firefox.png",
+		SupportedArch:        []string{"x86_64"},
+		MinimumOSVersion:     "10.0.22000",
+		ProductCode:          "{1A2B}",
+		UpgradeCode:          "{3C4D}",
+		PreinstallScript:     "Stop-Process -Name firefox\nexit 0\n",
+		PostuninstallScript:  "Remove-Item $env:TEMP\\firefox -Recurse\n",
+		InstallCheckScript:   "if (Test-Path $path) { exit 1 }\nexit 0\n",
+		UninstallCheckScript: "exit 0\n",
+		UserMessage:          "IT is updating Firefox to fix a security issue",
+		Notes:                "Imported for the browser rollout",
+		ImportedBy:           `EXAMPLE\jdoe`,
+		ImportDate:           "2024-07-09T14:30:00Z",
+		SourceURL:            "https://download.mozilla.org/firefox-128.0.msi",
+	}
+}
+
+// TestPkgsInfoRoundTrip validates a pkginfo written by gorillaimport reads back unchanged
+func TestPkgsInfoRoundTrip(t *testing.T) {
+	info := importedPkgsInfo()
+	data, err := Encode(info)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, info) {
+		t.Errorf("round trip changed the pkginfo:\n%+v\n%+v", info, decoded)
+	}
+}
+
+// TestEncodeLiteralScripts validates scripts are written as literal block scalars
+func TestEncodeLiteralScripts(t *testing.T) {
+	data, err := Encode(importedPkgsInfo())
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	for _, expected := range []string{
+		"preinstall_script: |\n  Stop-Process -Name firefox\n  exit 0\n",
+		"installcheck_script: |\n  if (Test-Path $path) { exit 1 }\n",
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("expected %q in:\n%s", expected, data)
+		}
+	}
+}
+
+// TestDecodeLegacyInstaller validates the flat installer fields of older pkginfos are moved into installer
+func TestDecodeLegacyInstaller(t *testing.T) {
+	data := []byte(`name: 7zip
+version: "23.01"
+installer_type: msi
+installer_item_location: 7z2301-x64.msi
+installer_item_hash: abc123
+installer_item_size: 1532
+`)
+	info, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	expected := &InstallerItem{Type: "msi", Location: "7z2301-x64.msi", Hash: "abc123", Size: 1532}
+	if !reflect.DeepEqual(info.Installer, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info.Installer)
+	}
+	if info.Extras != nil {
+		t.Errorf("expected the legacy fields to be removed, got %v", info.Extras)
+	}
+}
+
+// TestDecodeInstallerProductCode validates a product code older pkginfos set on the installer
+// is moved to the item, and doesn't replace one the item already has
+func TestDecodeInstallerProductCode(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{"name: Zoom\ninstaller:\n  type: msi\n  product_code: \"{5E6F}\"\n", "{5E6F}"},
+		{"name: Zoom\nproduct_code: \"{1A2B}\"\ninstaller:\n  type: msi\n  product_code: \"{5E6F}\"\n", "{1A2B}"},
+		{"name: Zoom\nproduct_code: \"{1A2B}\"\n", "{1A2B}"},
+	}
+	for _, tt := range tests {
+		info, err := Decode([]byte(tt.data))
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if info.ProductCode != tt.expected || (info.Installer != nil && info.Installer.ProductCode != "") {
+			t.Errorf("%q: expected the product code %s on the item only, got %q %+v", tt.data, tt.expected, info.ProductCode, info.Installer)
+		}
+	}
+}
+
+// TestCatalogRoundTrip validates a catalog built from a pkginfo parses as the client reads it,
+// and converts back to the same pkginfo
+func TestCatalogRoundTrip(t *testing.T) {
+	info := importedPkgsInfo()
+	item, err := info.CatalogItem()
+	if err != nil {
+		t.Fatalf("CatalogItem failed: %v", err)
+	}
+
+	if item.Check.Script != info.InstallCheckScript {
+		t.Errorf("expected the installcheck_script as the check script, got %q", item.Check.Script)
+	}
+	if _, ok := item.Extras["uninstallcheck_script"]; ok || item.Check.UninstallScript != info.UninstallCheckScript {
+		t.Errorf("expected the uninstallcheck_script as the uninstall check script, got %q", item.Check.UninstallScript)
+	}
+	if !reflect.DeepEqual(item.Installer, *info.Installer) || item.PreScript != info.PreinstallScript {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if item.ProductCode != info.ProductCode || item.UpgradeCode != info.UpgradeCode {
+		t.Errorf("expected the product and upgrade codes in the catalog item, got %q %q", item.ProductCode, item.UpgradeCode)
+	}
+	if item.Description != info.Description || item.UserMessage != info.UserMessage {
+		t.Errorf("expected the description and user message in the catalog item, got %q %q", item.Description, item.UserMessage)
+	}
+	if item.MinimumOSVersion != info.MinimumOSVersion || item.MaximumOSVersion != "" {
+		t.Errorf("expected the OS versions in the catalog item, got %q %q", item.MinimumOSVersion, item.MaximumOSVersion)
+	}
+	if item.UnattendedInstall == nil || !*item.UnattendedInstall || item.UnattendedUninstall == nil || !*item.UnattendedUninstall {
+		t.Errorf("expected unattended_install and unattended_uninstall in the catalog item, got %v %v", item.UnattendedInstall, item.UnattendedUninstall)
+	}
+	for _, field := range []string{"catalogs", "category", "notes"} {
+		if _, ok := item.Extras[field]; !ok {
+			t.Errorf("expected %s to be kept in the catalog item", field)
+		}
+	}
+
+	// Write the catalog as makecatalogs does and read it as the client does
+	data, err := Encode([]CatalogItem{item})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var parsed []CatalogItem
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("unable to parse the catalog: %v", err)
+	}
+	if len(parsed) != 1 {
+		t.Fatalf("expected one item, got %d", len(parsed))
+	}
+
+	// Empty lists read back as empty rather than nil, so compare what would be written again
+	reencoded, err := Encode([]CatalogItem{parsed[0]})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if string(reencoded) != string(data) {
+		t.Errorf("catalog round trip changed the item:\n%s\n%s", data, reencoded)
+	}
+
+	back, err := FromCatalogItem(parsed[0])
+	if err != nil {
+		t.Fatalf("FromCatalogItem failed: %v", err)
+	}
+	if parsed[0].ProductCode != info.ProductCode || parsed[0].UpgradeCode != info.UpgradeCode {
+		t.Errorf("expected the client to read the product and upgrade codes, got %+v", parsed[0])
+	}
+	if back.Name != info.Name || back.ProductCode != info.ProductCode || back.Check.Script != info.InstallCheckScript {
+		t.Errorf("unexpected pkginfo: %+v", back)
+	}
+}
+
+// TestPkgsInfoImportMetadata validates the import metadata of an existing pkginfo survives re-encoding,
+// along with fields that are not in the schema
+func TestPkgsInfoImportMetadata(t *testing.T) {
+	data := []byte(`name: Firefox
+version: "128.0"
+notes: Pinned for the kiosk fleet
+imported_by: EXAMPLE\jdoe
+import_date: "2024-07-09T14:30:00Z"
+source_url: https://download.mozilla.org/firefox-128.0.msi
+owner_team: endpoint
+`)
+	info, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if info.Notes != "Pinned for the kiosk fleet" || info.ImportedBy != `EXAMPLE\jdoe` || info.ImportDate != "2024-07-09T14:30:00Z" ||
+		info.SourceURL != "https://download.mozilla.org/firefox-128.0.msi" {
+		t.Errorf("unexpected import metadata: %+v", info)
+	}
+
+	reencoded, err := Encode(info)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	decoded, err := Decode(reencoded)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.Notes != info.Notes || decoded.ImportedBy != info.ImportedBy || decoded.ImportDate != info.ImportDate || decoded.SourceURL != info.SourceURL {
+		t.Errorf("re-encoding changed the import metadata:\n%+v\n%+v", info, decoded)
+	}
+	if !reflect.DeepEqual(decoded.Extras, info.Extras) {
+		t.Errorf("expected owner_team to be retained, got %v", decoded.Extras)
+	}
+}
+
+// TestStripFields validates the import metadata is left out of a catalog item
+func TestStripFields(t *testing.T) {
+	item, err := importedPkgsInfo().CatalogItem()
+	if err != nil {
+		t.Fatalf("CatalogItem failed: %v", err)
+	}
+	item.StripFields(DefaultStripFields)
+
+	for _, field := range DefaultStripFields {
+		if _, ok := item.Extras[field]; ok {
+			t.Errorf("expected %s to be stripped", field)
+		}
+	}
+	if _, ok := item.Extras["category"]; !ok {
+		t.Errorf("expected the other fields to be kept, got %v", item.Extras)
+	}
+}
+
+// TestStripDefinedFields validates the fields defined on a catalog item can be stripped,
+// and the fields the client needs are kept and reported
+func TestStripDefinedFields(t *testing.T) {
+	item, err := importedPkgsInfo().CatalogItem()
+	if err != nil {
+		t.Fatalf("CatalogItem failed: %v", err)
+	}
+	fields := []string{"description", "minimum_os_version", "version", "installer"}
+	item.StripFields(fields)
+
+	if item.Description != "" || item.MinimumOSVersion != "" {
+		t.Errorf("expected description and minimum_os_version to be stripped, got %q %q", item.Description, item.MinimumOSVersion)
+	}
+	if item.Version != "128.0" || item.Installer.Location == "" {
+		t.Errorf("expected the version and installer to be kept, got %+v", item)
+	}
+	if kept := UnstrippableFields(fields); !reflect.DeepEqual(kept, []string{"version", "installer"}) {
+		t.Errorf("expected version and installer reported as kept, got %v", kept)
+	}
+}
+
+// TestEncodeGolden validates a pkginfo is written byte for byte as testdata/Firefox-128.0.yaml,
+// and a hand edited copy with other quoting, empty fields and backslashes is written the same way
+func TestEncodeGolden(t *testing.T) {
+	golden, err := os.ReadFile(filepath.Join("testdata", "Firefox-128.0.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Encode(importedPkgsInfo())
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if string(data) != string(golden) {
+		t.Errorf("unexpected pkginfo:\n%s", data)
+	}
+
+	edited, err := os.ReadFile(filepath.Join("testdata", "Firefox-128.0-hand-edited.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Decode(edited)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if data, err = Encode(info); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if string(data) != string(golden) {
+		t.Errorf("the hand edited pkginfo was written differently:\n%s", data)
+	}
+}
+
+// TestEncodeCanonical validates versions are quoted, single line scripts are literal blocks
+// and empty fields are left out, except the name and version
+func TestEncodeCanonical(t *testing.T) {
+	data, err := Encode(PkgsInfo{
+		Name:               "Fonts",
+		Version:            "1.10",
+		Catalogs:           []string{},
+		Installer:          &InstallerItem{Type: "ps1", Location: `scripts\fonts.ps1`},
+		InstallCheckScript: "exit 0",
+	})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	expected := `name: Fonts
+version: "1.10"
+installer:
+  type: ps1
+  location: scripts/fonts.ps1
+installcheck_script: |-
+  exit 0
+`
+	if string(data) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, data)
+	}
+
+	if data, _ := Encode(PkgsInfo{Name: "Empty"}); !strings.Contains(string(data), `version: ""`) {
+		t.Errorf("expected the empty version to be written, got:\n%s", data)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package preflight
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// killProcessTree kills a script and every process it started,
+// so a hung child can't keep the agent waiting on its output
+func killProcessTree(pid int) {
+	exec.Command("taskkill.exe", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+}
@@ -0,0 +1,15 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package preflight
+
+import (
+	"syscall"
+)
+
+// killProcessTree kills the script, on darwin its children are left to exit on their own
+func killProcessTree(pid int) {
+	syscall.Kill(pid, syscall.SIGKILL)
+}
@@ -3,44 +3,157 @@
 package preflight
 
 import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
     "os"
     "os/exec"
     "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/windowsadmins/gorilla/pkg/config"
+    "github.com/windowsadmins/gorilla/pkg/version"
+)
+
+const (
+    // DefaultScriptPath holds preflight.ps1 and preflight.d unless `PreflightPath` is set
+    DefaultScriptPath = `C:\Program Files\Gorilla`
+
+    // FatalExitCode is the lowest exit code of a preflight.d script that aborts the run
+    FatalExitCode = 100
+
+    // DefaultTimeout is how long each script may run unless `PreflightTimeoutSeconds` is set
+    DefaultTimeout = 300 * time.Second
 )
 
-// RunPreflight runs the preflight script if it exists.
-func RunPreflight(verbosity int, logInfo func(string, ...interface{}), logError func(string, ...interface{})) error {
-    scriptPath := `C:\Program Files\Gorilla\preflight.ps1`
+// ErrTimeout is returned when a script is killed for running too long
+var ErrTimeout = errors.New("preflight script timed out")
+
+// This abstraction allows us to override when testing
+var execCommandContext = exec.CommandContext
 
-    // Check if the script exists
-    if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
-        // Script does not exist; nothing to do
-        return nil
+// RunPreflight runs preflight.ps1 if it exists, followed by every script in preflight.d.
+// A failure or timeout of preflight.ps1 aborts the run, scripts in preflight.d only abort it
+// when they time out or exit with FatalExitCode or higher. With `PreflightFailureMode: warn`
+// failures are logged and the run continues.
+func RunPreflight(cfg *config.Configuration, runType string, verbosity int, logInfo func(string, ...interface{}), logError func(string, ...interface{})) error {
+    if cfg == nil {
+        cfg = &config.Configuration{}
     }
 
-    displayName := "preflight"
-    runType := "checkandinstall"
+    basePath := DefaultScriptPath
+    if cfg.PreflightPath != "" {
+        basePath = cfg.PreflightPath
+    }
+    timeout := DefaultTimeout
+    if cfg.PreflightTimeoutSeconds > 0 {
+        timeout = time.Duration(cfg.PreflightTimeoutSeconds) * time.Second
+    }
+    warnOnly := strings.EqualFold(cfg.PreflightFailureMode, "warn")
 
-    logInfo("Performing %s tasks...", displayName)
+    // Tell the scripts about the run
+    env := []string{
+        "GORILLA_RUN_TYPE=" + runType,
+        "GORILLA_VERBOSITY=" + strconv.Itoa(verbosity),
+        "GORILLA_VERSION=" + version.Version().Version,
+    }
+
+    // The single preflight script keeps working and runs first
+    scriptPath := filepath.Join(basePath, "preflight.ps1")
+    if _, err := os.Stat(scriptPath); err == nil {
+        logInfo("Performing %s tasks...", "preflight")
+        if _, err := runScript(scriptPath, runType, env, timeout, verbosity, logInfo, logError); err != nil {
+            if !warnOnly {
+                return err
+            }
+            logError("Warning: preflight failed, continuing: %v", err)
+        }
+    }
+
+    // Scripts in preflight.d run in lexical order
+    scripts, err := filepath.Glob(filepath.Join(basePath, "preflight.d", "*.ps1"))
+    if err != nil {
+        return err
+    }
+    sort.Strings(scripts)
 
-    // Optionally, verify script permissions here
+    for _, script := range scripts {
+        displayName := filepath.Base(script)
+        logInfo("Performing %s tasks...", displayName)
+
+        exitCode, err := runScript(script, runType, env, timeout, verbosity, logInfo, logError)
+        if err == nil {
+            continue
+        }
+        if !warnOnly {
+            if errors.Is(err, ErrTimeout) {
+                return err
+            }
+            if exitCode >= FatalExitCode {
+                return fmt.Errorf("%s exited with fatal code %d", displayName, exitCode)
+            }
+        }
+        logError("Warning: %s failed, continuing: %v", displayName, err)
+    }
+
+    return nil
+}
+
+// runScript runs one script and logs its output. If the script runs longer than
+// timeout, it is killed along with any processes it started.
+// The exit code is -1 if the script did not exit on its own.
+func runScript(scriptPath, runType string, env []string, timeout time.Duration, verbosity int, logInfo func(string, ...interface{}), logError func(string, ...interface{})) (int, error) {
+    displayName := filepath.Base(scriptPath)
+
+    // The command is only cancelled once the whole process tree has been killed
+    killCtx, kill := context.WithCancel(context.Background())
+    defer kill()
 
     // Prepare the command to run the script
-    cmd := exec.Command("powershell.exe", "-ExecutionPolicy", "Bypass", "-File", scriptPath, runType)
+    cmd := execCommandContext(killCtx, "powershell.exe", "-ExecutionPolicy", "Bypass", "-File", scriptPath, runType)
     cmd.Dir = filepath.Dir(scriptPath)
+    if cmd.Env == nil {
+        cmd.Env = os.Environ()
+    }
+    cmd.Env = append(cmd.Env, env...)
 
     // Capture the output
-    output, err := cmd.CombinedOutput()
+    var output bytes.Buffer
+    cmd.Stdout = &output
+    cmd.Stderr = &output
+
+    err := cmd.Start()
+    if err == nil {
+        timer := time.AfterFunc(timeout, func() {
+            killProcessTree(cmd.Process.Pid)
+            kill()
+        })
+        err = cmd.Wait()
+        if !timer.Stop() {
+            err = fmt.Errorf("%w: %s did not finish within %v", ErrTimeout, displayName, timeout)
+        }
+    }
+
     if err != nil {
         logError("%s returned error: %v", displayName, err)
-        logError("%s output: %s", displayName, string(output))
-        return err
+        logError("%s output: %s", displayName, output.String())
+
+        exitCode := -1
+        var exitErr *exec.ExitError
+        if !errors.Is(err, ErrTimeout) && errors.As(err, &exitErr) {
+            exitCode = exitErr.ExitCode()
+        }
+        return exitCode, err
     }
 
     // Log the output
     if verbosity >= 1 {
-        logInfo("%s output: %s", displayName, string(output))
+        logInfo("%s output: %s", displayName, output.String())
     }
 
-    return nil
+    return 0, nil
 }
@@ -0,0 +1,186 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+var (
+	origExecCommandContext = execCommandContext
+
+	// ran records the scripts passed to fakeExecCommandContext in order
+	ran []string
+)
+
+// fakeExecCommandContext runs TestHelperProcess in place of powershell.exe
+func fakeExecCommandContext(ctx context.Context, command string, args ...string) *exec.Cmd {
+	ran = append(ran, filepath.Base(args[len(args)-2]))
+	cs := []string{"-test.run=TestHelperProcess", "--", command}
+	cs = append(cs, args...)
+	cmd := exec.CommandContext(ctx, os.Args[0], cs...)
+	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+	return cmd
+}
+
+// TestHelperProcess stands in for powershell.exe, running the one command in the script:
+// `exit N` exits with N, `sleep N` sleeps N seconds and `env FILE` writes the GORILLA_ variables to FILE
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	script, _ := os.ReadFile(os.Args[len(os.Args)-2])
+	fields := strings.Fields(string(script))
+	if len(fields) != 2 {
+		os.Exit(0)
+	}
+	switch fields[0] {
+	case "exit":
+		code, _ := strconv.Atoi(fields[1])
+		os.Exit(code)
+	case "sleep":
+		seconds, _ := strconv.Atoi(fields[1])
+		time.Sleep(time.Duration(seconds) * time.Second)
+	case "env":
+		var env []string
+		for _, variable := range os.Environ() {
+			if strings.HasPrefix(variable, "GORILLA_") {
+				env = append(env, variable)
+			}
+		}
+		sort.Strings(env)
+		os.WriteFile(fields[1], []byte(strings.Join(env, "\n")), 0644)
+	}
+	os.Exit(0)
+}
+
+// writeScripts creates the scripts under dir
+func writeScripts(t *testing.T, dir string, scripts map[string]string) {
+	for name, content := range scripts {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// runWithFake runs the preflight scripts with fakeExecCommandContext
+func runWithFake(cfg *config.Configuration) error {
+	execCommandContext = fakeExecCommandContext
+	defer func() { execCommandContext = origExecCommandContext }()
+	ran = nil
+
+	noLog := func(string, ...interface{}) {}
+	return RunPreflight(cfg, "auto", 2, noLog, noLog)
+}
+
+// TestRunPreflightOrder validates preflight.ps1 runs first and preflight.d runs in lexical order
+func TestRunPreflightOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeScripts(t, dir, map[string]string{
+		"preflight.ps1":                "",
+		"preflight.d/20-vpn.ps1":       "exit 1",
+		"preflight.d/10-inventory.ps1": "",
+		"preflight.d/30-manifest.ps1":  "",
+		"preflight.d/readme.txt":       "",
+	})
+
+	if err := runWithFake(&config.Configuration{PreflightPath: dir}); err != nil {
+		t.Errorf("a non fatal exit code should not abort the run: %v", err)
+	}
+
+	expected := "preflight.ps1,10-inventory.ps1,20-vpn.ps1,30-manifest.ps1"
+	if strings.Join(ran, ",") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(ran, ","))
+	}
+}
+
+// TestRunPreflightFatal validates a fatal exit code stops the remaining scripts
+func TestRunPreflightFatal(t *testing.T) {
+	dir := t.TempDir()
+	writeScripts(t, dir, map[string]string{
+		"preflight.d/10-vpn.ps1":       "exit 100",
+		"preflight.d/20-inventory.ps1": "",
+	})
+
+	if err := runWithFake(&config.Configuration{PreflightPath: dir}); err == nil {
+		t.Errorf("expected a fatal exit code to abort the run")
+	}
+	if strings.Join(ran, ",") != "10-vpn.ps1" {
+		t.Errorf("scripts after a fatal exit code should not run, got %v", ran)
+	}
+}
+
+// TestRunPreflightScriptFailure validates any failure of preflight.ps1 aborts the run
+func TestRunPreflightScriptFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeScripts(t, dir, map[string]string{
+		"preflight.ps1":                "exit 1",
+		"preflight.d/10-inventory.ps1": "",
+	})
+
+	if err := runWithFake(&config.Configuration{PreflightPath: dir}); err == nil {
+		t.Errorf("expected a failure of preflight.ps1 to abort the run")
+	}
+	if strings.Join(ran, ",") != "preflight.ps1" {
+		t.Errorf("preflight.d should not run after preflight.ps1 fails, got %v", ran)
+	}
+}
+
+// TestRunPreflightTimeout validates a hung script is killed and aborts the run unless failures only warn
+func TestRunPreflightTimeout(t *testing.T) {
+	dir := t.TempDir()
+	writeScripts(t, dir, map[string]string{
+		"preflight.ps1":                "sleep 30",
+		"preflight.d/10-inventory.ps1": "",
+	})
+
+	start := time.Now()
+	err := runWithFake(&config.Configuration{PreflightPath: dir, PreflightTimeoutSeconds: 1})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("script should be killed after the timeout, ran for %v", elapsed)
+	}
+
+	err = runWithFake(&config.Configuration{PreflightPath: dir, PreflightTimeoutSeconds: 1, PreflightFailureMode: "warn"})
+	if err != nil {
+		t.Errorf("a timeout should only warn with PreflightFailureMode warn, got %v", err)
+	}
+	if strings.Join(ran, ",") != "preflight.ps1,10-inventory.ps1" {
+		t.Errorf("preflight.d should run after a warning, got %v", ran)
+	}
+}
+
+// TestRunPreflightEnvironment validates the run context is passed to the script
+func TestRunPreflightEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env.txt")
+	writeScripts(t, dir, map[string]string{"preflight.ps1": "env " + envFile})
+
+	if err := runWithFake(&config.Configuration{PreflightPath: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("unable to read environment: %v", err)
+	}
+	expected := "GORILLA_RUN_TYPE=auto\nGORILLA_VERBOSITY=2\nGORILLA_VERSION=unknown"
+	if string(env) != expected {
+		t.Errorf("expected %q, got %q", expected, string(env))
+	}
+}
@@ -0,0 +1,70 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/extract"
+	"github.com/windowsadmins/gorilla/pkg/facts"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+var (
+	// This abstraction allows us to override when testing
+	machineArch = func() string { return facts.Get().Arch }
+)
+
+// normalizeArch returns the name supported_architectures uses for an architecture
+func normalizeArch(arch string) string {
+	return extract.NormalizeArch(arch)
+}
+
+// supportsArchitecture returns true if the item can be installed on the given architecture.
+// An item without supported_architectures is treated as supporting all of them.
+func supportsArchitecture(item catalog.Item, arch string) bool {
+	if len(item.SupportedArch) == 0 {
+		logging.Debug("No supported_architectures, treating as all architectures:", item.Name)
+		return true
+	}
+	for _, supported := range item.SupportedArch {
+		if normalizeArch(supported) == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedItems returns the items that support this machine, and reports the ones skipped, adding them to result.
+// The OS versions only limit installs and updates, an item is uninstalled from any version of Windows.
+func supportedItems(items []catalog.Item, installType string, result *ProcessResult) []catalog.Item {
+	arch := machineArch()
+	var osVersion string
+	if installType != "uninstall" {
+		osVersion = machineOSVersion()
+	}
+	var supported []catalog.Item
+	for _, item := range items {
+		if !supportsArchitecture(item, arch) {
+			skip(item, installType, fmt.Sprintf("supports %s, this machine is %s", strings.Join(item.SupportedArch, ", "), arch), result)
+			continue
+		}
+		if installType != "uninstall" {
+			if reason := osVersionSkip(item, osVersion); reason != "" {
+				skip(item, installType, reason, result)
+				continue
+			}
+		}
+		supported = append(supported, item)
+	}
+	return supported
+}
+
+// skip warns about and reports an item that can't be checked or installed now, and adds it to result as skipped
+func skip(item catalog.Item, installType, reason string, result *ProcessResult) {
+	msg := fmt.Sprintf("Skipped %s: %s", item.Name, reason)
+	logging.Warn(msg)
+	report.RecordWarning(msg)
+	result.add(ItemResult{Name: item.Name, Version: item.Version, Action: installType, Outcome: OutcomeSkipped, Reason: reason})
+}
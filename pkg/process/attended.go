@@ -0,0 +1,36 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// reasonInteractive is why an automatic run leaves an item to an interactive run
+const reasonInteractive = "requires interactive run"
+
+// requiresInteractive returns true when an automatic run leaves the action on an item to an
+// interactive run, because the item sets unattended_install, or unattended_uninstall for an
+// uninstall, to false. Items that leave them unset are acted on in every run.
+func requiresInteractive(item catalog.Item, installType string, cfg config.Configuration) bool {
+	if !cfg.Unattended {
+		return false
+	}
+	unattended := item.UnattendedInstall
+	if installType == "uninstall" {
+		unattended = item.UnattendedUninstall
+	}
+	return unattended != nil && !*unattended
+}
+
+// deferInteractive records an item left to an interactive run in the report
+func deferInteractive(item catalog.Item, installType string) {
+	msg := fmt.Sprintf("Skipped %s %s %s: %s", installType, item.Name, item.Version, reasonInteractive)
+	logging.Warn(msg)
+	report.RecordWarning(msg)
+	report.RecordPending(item)
+	report.RecordInteractive(item)
+}
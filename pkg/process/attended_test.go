@@ -0,0 +1,97 @@
+package process
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// attendedItem returns an item with unattended_install and unattended_uninstall set, or unset when nil
+func attendedItem(name string, unattendedInstall, unattendedUninstall *bool) catalog.Item {
+	item := testItem(name)
+	item.UnattendedInstall, item.UnattendedUninstall = unattendedInstall, unattendedUninstall
+	return item
+}
+
+// TestRequiresInteractive validates only automatic runs leave items to an interactive run,
+// and only the items that set unattended_install, or unattended_uninstall for an uninstall, to false
+func TestRequiresInteractive(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		unattended          bool
+		unattendedInstall   *bool
+		unattendedUninstall *bool
+		installType         string
+		expected            bool
+	}{
+		{true, &no, nil, "install", true},
+		{true, &no, nil, "update", true},
+		{true, &no, nil, "uninstall", false},
+		{true, &yes, &no, "install", false},
+		{true, &yes, &no, "uninstall", true},
+		{true, nil, nil, "install", false},
+		{true, nil, nil, "uninstall", false},
+		{false, &no, &no, "install", false},
+		{false, &no, &no, "update", false},
+		{false, &no, &no, "uninstall", false},
+	}
+	for _, tt := range tests {
+		item := attendedItem("App", tt.unattendedInstall, tt.unattendedUninstall)
+		cfg := config.Configuration{Unattended: tt.unattended}
+		if got := requiresInteractive(item, tt.installType, cfg); got != tt.expected {
+			t.Errorf("unattended run %v, %s with %v %v: expected %v, got %v", tt.unattended, tt.installType,
+				tt.unattendedInstall, tt.unattendedUninstall, tt.expected, got)
+		}
+	}
+}
+
+// TestInstallsAttended validates an automatic run skips and reports the items with
+// unattended_install false, and a run without --auto installs them
+func TestInstallsAttended(t *testing.T) {
+	installed := recordInstalls(t)
+	t.Cleanup(func() { report.Warnings, report.PendingItems, report.InteractiveItems = nil, nil, nil })
+	yes, no := true, false
+	catalogs := testCatalogs(attendedItem("Driver", &no, nil), attendedItem("Browser", &yes, nil), testItem("Tool"))
+	installs := []string{"Driver", "Browser", "Tool"}
+
+	result := Installs(context.Background(), installs, catalogs, config.Configuration{Unattended: true})
+	if !reflect.DeepEqual(*installed, []string{"Browser", "Tool"}) {
+		t.Errorf("expected Browser and Tool installed, got %v", *installed)
+	}
+	if len(result.Items) != 3 || result.Items[0].Outcome != OutcomeSkipped || result.Items[0].Reason != reasonInteractive {
+		t.Errorf("expected Driver skipped as requiring an interactive run, got %+v", result.Items)
+	}
+	if len(report.InteractiveItems) != 1 || len(report.PendingItems) != 1 || len(report.Warnings) != 1 {
+		t.Errorf("expected Driver reported as interactive and pending, got %v %v", report.InteractiveItems, report.Warnings)
+	}
+
+	*installed = nil
+	Installs(context.Background(), installs, catalogs, config.Configuration{})
+	if !reflect.DeepEqual(*installed, installs) {
+		t.Errorf("expected every item installed without --auto, got %v", *installed)
+	}
+}
+
+// TestInstallsWithoutUnattendedKey validates a pkginfo without unattended_install
+// is installed in an automatic run
+func TestInstallsWithoutUnattendedKey(t *testing.T) {
+	installed := recordInstalls(t)
+	info, err := pkginfo.Decode([]byte("name: Tool\nversion: \"1.0\"\ninstaller:\n  type: msi\n  location: /apps/Tool-1.0.msi\n"))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	item, err := info.CatalogItem()
+	if err != nil {
+		t.Fatalf("CatalogItem failed: %v", err)
+	}
+
+	Installs(context.Background(), []string{"Tool"}, testCatalogs(item), config.Configuration{Unattended: true})
+	if !reflect.DeepEqual(*installed, []string{"Tool"}) {
+		t.Errorf("expected Tool installed in the automatic run, got %v", *installed)
+	}
+}
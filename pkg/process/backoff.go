@@ -0,0 +1,252 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/progress"
+	"github.com/windowsadmins/gorilla/pkg/report"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFailureBackoffCount is how many times in a row an item can fail before
+// it is backed off, unless `FailureBackoffCount` is set
+const DefaultFailureBackoffCount = 3
+
+// failureBackoff is how long an item that keeps failing waits between attempts
+const failureBackoff = 24 * time.Hour
+
+// attemptFormat is how the next attempt of a deferred item is shown
+const attemptFormat = "2006-01-02 15:04:05 -0700"
+
+// reasonDeferred is why an item that keeps failing is skipped until its next attempt
+const reasonDeferred = "deferred after repeated failures"
+
+// failureRecord counts the consecutive failures of a version of an item
+type failureRecord struct {
+	Version     string    `yaml:"version"`
+	Failures    int       `yaml:"failures"`
+	LastAttempt time.Time `yaml:"last_attempt"`
+}
+
+var (
+	// failuresMu guards the failure records, which items installing at the same time update
+	failuresMu sync.Mutex
+
+	// These abstractions allows us to override when testing
+	failuresPath = filepath.Join(os.Getenv("ProgramData"), "ManagedInstalls", "ItemFailures.yaml")
+	timeNow      = time.Now
+)
+
+// ClearFailures removes the failure backoff state, so every item is attempted again
+func ClearFailures() error {
+	if err := os.Remove(failuresPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// loadFailures reads the failure records by item name
+func loadFailures() (map[string]failureRecord, error) {
+	failures := make(map[string]failureRecord)
+	data, err := ioutil.ReadFile(failuresPath)
+	if os.IsNotExist(err) {
+		return failures, nil
+	}
+	if err != nil {
+		return failures, err
+	}
+	if err := yaml.Unmarshal(data, &failures); err != nil {
+		return make(map[string]failureRecord), fmt.Errorf("failed to decode the item failures: %v", err)
+	}
+	return failures, nil
+}
+
+// saveFailures writes the failure records, removing the file when there are none
+func saveFailures(failures map[string]failureRecord) error {
+	if len(failures) == 0 {
+		return ClearFailures()
+	}
+	data, err := yaml.Marshal(failures)
+	if err != nil {
+		return fmt.Errorf("failed to encode the item failures: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(failuresPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(failuresPath, data, 0644)
+}
+
+// backoffCount returns how many consecutive failures back an item off, or 0 when backoff is disabled
+func backoffCount(cfg config.Configuration) int {
+	switch {
+	case cfg.FailureBackoffCount < 0:
+		return 0
+	case cfg.FailureBackoffCount == 0:
+		return DefaultFailureBackoffCount
+	default:
+		return cfg.FailureBackoffCount
+	}
+}
+
+// deferredUntil returns when a backed off item is attempted again, or the zero time
+// if it can be attempted now. A new catalog version is always attempted.
+func deferredUntil(record failureRecord, item catalog.Item, cfg config.Configuration) time.Time {
+	limit := backoffCount(cfg)
+	if limit == 0 || record.Version != item.Version || record.Failures < limit {
+		return time.Time{}
+	}
+	next := record.LastAttempt.Add(failureBackoff)
+	if !timeNow().Before(next) {
+		return time.Time{}
+	}
+	return next
+}
+
+// actionResult returns whether the actions recorded for an item since the first
+// action index include an attempt, and the error of the first one that failed
+func actionResult(item catalog.Item, first int) (attempted, failed bool, err error) {
+	for _, action := range report.ActionsSince(first) {
+		if action.Item != item.Name {
+			continue
+		}
+		attempted = true
+		if !action.Success && !failed {
+			failed = true
+			err = errors.New(action.Error)
+		}
+	}
+	return attempted, failed, err
+}
+
+// installStatus is the status of an install for the progress events
+func installStatus(ctx context.Context, attempted, failed bool) string {
+	switch {
+	case !attempted:
+		return "skipped"
+	case failed && ctx.Err() != nil:
+		return "interrupted"
+	case failed:
+		return "failed"
+	}
+	return "success"
+}
+
+// installChecked installs, uninstalls or updates an item whose status was already checked,
+// unless it failed too many times in a row. Those items are attempted once a day until
+// they succeed or the catalog has a new version.
+func installChecked(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) ItemResult {
+	result := ItemResult{Name: item.Name, Version: item.Version, Action: installerType, item: item}
+	if !actionNeeded {
+		installerInstallChecked(ctx, item, installerType, cfg, actionNeeded)
+		result.Outcome = OutcomeNotNeeded
+		return result
+	}
+	if requiresInteractive(item, installerType, cfg) {
+		deferInteractive(item, installerType)
+		result.Outcome, result.Reason = OutcomeSkipped, reasonInteractive
+		return result
+	}
+	if shuttingDown(ctx, item) {
+		result.Outcome, result.Reason = OutcomeSkipped, "shutting down"
+		return result
+	}
+	if err := diskFilled(item); err != nil {
+		result.Outcome, result.Reason, result.Err = OutcomeSkipped, "disk full", err
+		return result
+	}
+
+	failuresMu.Lock()
+	failures, err := loadFailures()
+	failuresMu.Unlock()
+	if err != nil {
+		logging.Warn("Unable to read the item failures", "error", err)
+	}
+	record, known := failures[item.Name]
+	if until := deferredUntil(record, item, cfg); !until.IsZero() {
+		msg := fmt.Sprintf("%s %s %s, next attempt after %s",
+			item.Name, item.Version, reasonDeferred, until.Format(attemptFormat))
+		logging.Warn(msg)
+		report.RecordWarning(msg)
+		report.RecordPending(item)
+		result.Outcome, result.Reason = OutcomeSkipped, reasonDeferred
+		return result
+	}
+	if cfg.CheckOnly {
+		installerInstallChecked(ctx, item, installerType, cfg, actionNeeded)
+		result.Outcome = OutcomePending
+		return result
+	}
+
+	first := report.ActionCount()
+	start := timeNow()
+	progress.InstallStarted(item.Name, item.Version, installerType)
+	reason := installerInstallChecked(ctx, item, installerType, cfg, actionNeeded)
+	attempted, failed, actionErr := actionResult(item, first)
+	progress.InstallFinished(item.Name, item.Version, installerType, installStatus(ctx, attempted, failed))
+	result.Duration = timeNow().Sub(start)
+	switch {
+	case !attempted:
+		result.Outcome, result.Reason = OutcomeSkipped, reason
+		if reason == "" {
+			result.Reason = "not attempted"
+		}
+		return result
+	case failed:
+		result.Outcome, result.Reason, result.Err = OutcomeFailed, reason, actionErr
+		if ctx.Err() != nil {
+			result.Reason = "interrupted"
+		}
+	default:
+		result.Outcome = OutcomeSucceeded
+	}
+
+	switch {
+	case !failed && !known:
+		return result
+	case failed && ctx.Err() != nil:
+		// An installer stopped by the shutdown is not the item's failure
+		return result
+	}
+	recordFailure(item, failed, cfg)
+	return result
+}
+
+// recordFailure counts a failed attempt of an item, or clears its failures once it succeeds.
+// The records are read again, other items may have finished since this one started.
+func recordFailure(item catalog.Item, failed bool, cfg config.Configuration) {
+	failuresMu.Lock()
+	defer failuresMu.Unlock()
+
+	failures, err := loadFailures()
+	if err != nil {
+		logging.Warn("Unable to read the item failures", "error", err)
+	}
+	if !failed {
+		delete(failures, item.Name)
+	} else {
+		// A new version starts counting again
+		record := failures[item.Name]
+		if record.Version != item.Version {
+			record = failureRecord{Version: item.Version}
+		}
+		record.Failures++
+		record.LastAttempt = timeNow()
+		failures[item.Name] = record
+		if limit := backoffCount(cfg); limit > 0 && record.Failures >= limit {
+			logging.Warn("Backing off after repeated failures:", item.Name, item.Version, record.Failures)
+		}
+	}
+	if err := saveFailures(failures); err != nil {
+		logging.Warn("Unable to save the item failures", "error", err)
+	}
+}
@@ -0,0 +1,169 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// fakeFailures keeps the failure records in a temporary directory with a fixed clock,
+// and fails the installs of the items in failing. It returns the names attempted.
+func fakeFailures(t *testing.T, clock *time.Time, failing map[string]bool) *[]string {
+	var attempted []string
+	origPath, origNow, origInstall, origCheck := failuresPath, timeNow, installerInstallChecked, statusCheckStatus
+	t.Cleanup(func() {
+		failuresPath, timeNow, installerInstallChecked, statusCheckStatus = origPath, origNow, origInstall, origCheck
+		report.Actions, report.Warnings, report.PendingItems = nil, nil, nil
+	})
+	failuresPath = filepath.Join(t.TempDir(), "ItemFailures.yaml")
+	timeNow = func() time.Time { return *clock }
+	installerInstallChecked = func(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) string {
+		attempted = append(attempted, item.Name)
+		var err error
+		if failing[item.Name] {
+			err = errors.New("exit status 1603")
+		}
+		report.RecordAction(item.Name, item.Version, installerType, err)
+		return ""
+	}
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		return true, nil
+	}
+	return &attempted
+}
+
+// runInstalls installs Broken and Working every hour for the number of runs
+func runInstalls(clock *time.Time, catalogs map[int]map[string]catalog.Item, runs int) {
+	for i := 0; i < runs; i++ {
+		Installs(context.Background(), []string{"Broken", "Working"}, catalogs, config.Configuration{})
+		*clock = clock.Add(time.Hour)
+	}
+}
+
+// TestFailureBackoff validates an item is deferred after failing three times in a row,
+// then attempted again once a day
+func TestFailureBackoff(t *testing.T) {
+	clock := time.Date(2024, 7, 9, 12, 0, 0, 0, time.UTC)
+	attempted := fakeFailures(t, &clock, map[string]bool{"Broken": true})
+	broken := testItem("Broken")
+	broken.Version = "1.0"
+	catalogs := testCatalogs(broken, testItem("Working"))
+
+	runInstalls(&clock, catalogs, 5)
+
+	brokenAttempts := 0
+	for _, name := range *attempted {
+		if name == "Broken" {
+			brokenAttempts++
+		}
+	}
+	if brokenAttempts != 3 || len(*attempted) != 8 {
+		t.Errorf("expected Broken attempted 3 times and Working 5 times, got %v", *attempted)
+	}
+	if len(report.Warnings) != 2 || !strings.Contains(report.Warnings[1], "Broken 1.0 deferred after repeated failures") {
+		t.Errorf("unexpected warnings: %v", report.Warnings)
+	}
+	if len(report.PendingItems) != 2 {
+		t.Errorf("expected the deferred item pending, got %d pending items", len(report.PendingItems))
+	}
+
+	// A day after the last attempt, it is attempted again
+	*attempted = nil
+	clock = clock.Add(failureBackoff)
+	runInstalls(&clock, catalogs, 2)
+	if !reflect.DeepEqual(*attempted, []string{"Broken", "Working", "Working"}) {
+		t.Errorf("expected Broken attempted once more, got %v", *attempted)
+	}
+}
+
+// TestFailureBackoffReset validates a new catalog version or a success resets the count
+func TestFailureBackoffReset(t *testing.T) {
+	clock := time.Date(2024, 7, 9, 12, 0, 0, 0, time.UTC)
+	failing := map[string]bool{"Broken": true}
+	attempted := fakeFailures(t, &clock, failing)
+	broken := testItem("Broken")
+	broken.Version = "1.0"
+	runInstalls(&clock, testCatalogs(broken, testItem("Working")), 3)
+
+	// The fixed version is attempted right away and clears the record
+	*attempted = nil
+	broken.Version = "1.1"
+	failing["Broken"] = false
+	runInstalls(&clock, testCatalogs(broken, testItem("Working")), 1)
+	if !reflect.DeepEqual(*attempted, []string{"Broken", "Working"}) {
+		t.Errorf("expected the new version attempted, got %v", *attempted)
+	}
+	if _, err := os.Stat(failuresPath); !os.IsNotExist(err) {
+		t.Errorf("expected the failure records removed, got %v", err)
+	}
+}
+
+// TestClearFailures validates clearing the state lets a deferred item run again
+func TestClearFailures(t *testing.T) {
+	clock := time.Date(2024, 7, 9, 12, 0, 0, 0, time.UTC)
+	attempted := fakeFailures(t, &clock, map[string]bool{"Broken": true})
+	catalogs := testCatalogs(testItem("Broken"), testItem("Working"))
+	runInstalls(&clock, catalogs, 3)
+
+	if err := ClearFailures(); err != nil {
+		t.Fatalf("ClearFailures failed: %v", err)
+	}
+	*attempted = nil
+	runInstalls(&clock, catalogs, 1)
+	if !reflect.DeepEqual(*attempted, []string{"Broken", "Working"}) {
+		t.Errorf("expected Broken attempted after clearing, got %v", *attempted)
+	}
+}
+
+// TestFailureBackoffDisabled validates a negative FailureBackoffCount never defers an item
+func TestFailureBackoffDisabled(t *testing.T) {
+	clock := time.Date(2024, 7, 9, 12, 0, 0, 0, time.UTC)
+	record := failureRecord{Version: "1.0", Failures: 10, LastAttempt: clock}
+	timeNow = func() time.Time { return clock }
+	t.Cleanup(func() { timeNow = time.Now })
+	item := catalog.Item{Name: "Broken", Version: "1.0"}
+
+	if until := deferredUntil(record, item, config.Configuration{FailureBackoffCount: -1}); !until.IsZero() {
+		t.Errorf("expected no backoff, got %v", until)
+	}
+	if until := deferredUntil(record, item, config.Configuration{}); !until.Equal(clock.Add(failureBackoff)) {
+		t.Errorf("expected a backoff until %v, got %v", clock.Add(failureBackoff), until)
+	}
+}
+
+// TestPrintPendingDeferred validates the pending items are listed, and the items that keep
+// failing are marked deferred with their next attempt
+func TestPrintPendingDeferred(t *testing.T) {
+	clock := time.Date(2024, 7, 9, 12, 0, 0, 0, time.UTC)
+	fakeFailures(t, &clock, map[string]bool{"Broken": true})
+	broken := testItem("Broken")
+	broken.Version = "1.0"
+	working := testItem("Working")
+	working.Version = "2.0"
+	runInstalls(&clock, testCatalogs(broken, working), 3)
+
+	var out strings.Builder
+	pending := Pending{Installs: []catalog.Item{broken}, Updates: []catalog.Item{working}}
+	if err := PrintPending(&out, pending, config.Configuration{}); err != nil {
+		t.Fatalf("PrintPending failed: %v", err)
+	}
+	expected := "install Broken 1.0 (deferred after repeated failures, next attempt after 2024-07-10 14:00:00 +0000)\n" +
+		"update Working 2.0\n"
+	if out.String() != expected {
+		t.Errorf("unexpected pending items:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := PrintPending(&out, Pending{}, config.Configuration{}); err != nil || out.String() != "No pending items.\n" {
+		t.Errorf("expected no pending items, got %q %v", out.String(), err)
+	}
+}
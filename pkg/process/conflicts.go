@@ -0,0 +1,98 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/manifest"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// listedItem is an item a manifest lists, with the manifest it came from
+type listedItem struct {
+	name     string
+	manifest string
+	// depth is how many includes the manifest is from the manifest of the machine, lower is more specific
+	depth int
+}
+
+// manifestDepths returns how many includes each manifest is from the manifest of the machine.
+// The manifests are in the order they were read, each after the manifest that first included it.
+// Manifests nothing includes, the manifest of the machine and the local manifests, are at depth 0.
+func manifestDepths(manifests []manifest.Item) map[string]int {
+	depths := make(map[string]int)
+	for _, m := range manifests {
+		depth, ok := depths[m.Name]
+		if !ok {
+			depths[m.Name] = 0
+		}
+		for _, include := range m.Includes {
+			if _, ok := depths[include]; !ok {
+				depths[include] = depth + 1
+			}
+		}
+	}
+	return depths
+}
+
+// appendListed adds the items a manifest lists that are in the catalogs to list.
+// An item already in the list keeps the manifest it was first listed in, the most specific one.
+func appendListed(list []listedItem, names []string, source manifest.Item, depths map[string]int, catalogsMap map[int]map[string]catalog.Item) []listedItem {
+	for _, name := range names {
+		// Check for the first valid item from our catalogs
+		// Continue to the next item in the loop if we get an error
+		if _, err := firstItem(name, catalogsMap); err != nil {
+			logging.LogError(err, "Processing Error")
+			continue
+		}
+		if listedIn(list, name) != nil {
+			continue
+		}
+		list = append(list, listedItem{name: name, manifest: source.Name, depth: depths[source.Name]})
+	}
+	return list
+}
+
+// listedIn returns the entry of an item in a list, or nil when it isn't listed
+func listedIn(list []listedItem, name string) *listedItem {
+	for i := range list {
+		if list[i].name == name {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// resolveConflicts removes the items that are also uninstalled from the installs, uninstalling an
+// item always wins. An uninstall in a more specific manifest overrides the install, such as a
+// machine manifest removing an item its role installs. Otherwise it is a conflict that is warned about.
+func resolveConflicts(installs, uninstalls []listedItem) []listedItem {
+	var resolved []listedItem
+	for _, install := range installs {
+		uninstall := listedIn(uninstalls, install.name)
+		if uninstall == nil {
+			resolved = append(resolved, install)
+			continue
+		}
+		if uninstall.depth < install.depth {
+			logging.Info("Uninstalling, the managed_uninstalls of a more specific manifest override its managed_installs:",
+				install.name, uninstall.manifest, install.manifest)
+			continue
+		}
+		msg := fmt.Sprintf("%s is in the managed_installs of %s and the managed_uninstalls of %s, it is uninstalled",
+			install.name, install.manifest, uninstall.manifest)
+		logging.Warn(msg)
+		report.RecordWarning(msg)
+	}
+	return resolved
+}
+
+// listedNames returns the names of the items in a list
+func listedNames(list []listedItem) []string {
+	var names []string
+	for _, item := range list {
+		names = append(names, item.name)
+	}
+	return names
+}
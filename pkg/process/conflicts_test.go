@@ -0,0 +1,95 @@
+package process
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/manifest"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// TestManifestsConflicts validates an item both installed and uninstalled is only uninstalled,
+// with a warning naming both manifests unless the uninstall is in a more specific manifest
+func TestManifestsConflicts(t *testing.T) {
+	catalogs := testCatalogs(testItem("App"), testItem("Tool"), testItem("Chrome"))
+	tests := []struct {
+		name       string
+		manifests  []manifest.Item
+		installs   []string
+		uninstalls []string
+		warning    string
+	}{
+		{
+			name: "uninstall in a more specific manifest",
+			manifests: []manifest.Item{
+				{Name: "site/lab/pc01", Includes: []string{"roles/dev"}, Uninstalls: []string{"App"}},
+				{Name: "roles/dev", Installs: []string{"App", "Tool"}},
+			},
+			installs:   []string{"Tool"},
+			uninstalls: []string{"App"},
+		},
+		{
+			name: "install in a more specific manifest",
+			manifests: []manifest.Item{
+				{Name: "site/lab/pc01", Includes: []string{"roles/dev"}, Installs: []string{"App"}},
+				{Name: "roles/dev", Uninstalls: []string{"App"}, Installs: []string{"Tool"}},
+			},
+			installs:   []string{"Tool"},
+			uninstalls: []string{"App"},
+			warning:    "App is in the managed_installs of site/lab/pc01 and the managed_uninstalls of roles/dev",
+		},
+		{
+			name: "both in the same manifest",
+			manifests: []manifest.Item{
+				{Name: "site_default", Installs: []string{"App", "Tool"}, Uninstalls: []string{"App"}},
+			},
+			installs:   []string{"Tool"},
+			uninstalls: []string{"App"},
+			warning:    "App is in the managed_installs of site_default and the managed_uninstalls of site_default",
+		},
+		{
+			name: "manifests at the same depth",
+			manifests: []manifest.Item{
+				{Name: "site_default", Includes: []string{"roles/dev", "roles/qa"}},
+				{Name: "roles/dev", Installs: []string{"App"}},
+				{Name: "roles/qa", Uninstalls: []string{"App"}},
+			},
+			uninstalls: []string{"App"},
+			warning:    "App is in the managed_installs of roles/dev and the managed_uninstalls of roles/qa",
+		},
+		{
+			name: "a local manifest uninstalls",
+			manifests: []manifest.Item{
+				{Name: "site_default", Includes: []string{"roles/dev"}},
+				{Name: "roles/dev", Installs: []string{"App", "Tool"}},
+				{Name: "local", Uninstalls: []string{"App"}},
+			},
+			installs:   []string{"Tool"},
+			uninstalls: []string{"App"},
+		},
+		{
+			name: "listed more than once",
+			manifests: []manifest.Item{
+				{Name: "site_default", Includes: []string{"roles/dev"}, Installs: []string{"Tool", "App"}},
+				{Name: "roles/dev", Installs: []string{"App", "Tool", "Missing"}},
+			},
+			installs: []string{"Tool", "App"},
+		},
+	}
+	for _, tt := range tests {
+		report.Warnings = nil
+		installs, uninstalls, updates := Manifests(tt.manifests, catalogs)
+
+		if !reflect.DeepEqual(installs, tt.installs) || !reflect.DeepEqual(uninstalls, tt.uninstalls) || updates != nil {
+			t.Errorf("%s: unexpected lists %v %v %v", tt.name, installs, uninstalls, updates)
+		}
+		switch {
+		case tt.warning == "" && len(report.Warnings) != 0:
+			t.Errorf("%s: unexpected warnings %q", tt.name, report.Warnings)
+		case tt.warning != "" && (len(report.Warnings) != 1 || !strings.HasPrefix(report.Warnings[0], tt.warning)):
+			t.Errorf("%s: expected the warning %q, got %q", tt.name, tt.warning, report.Warnings)
+		}
+	}
+	report.Warnings = nil
+}
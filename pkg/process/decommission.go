@@ -0,0 +1,96 @@
+package process
+
+import (
+	"context"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/installer"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// This abstraction allows us to override when testing
+var installerCanUninstall = installer.CanUninstall
+
+// DecommissionOrder returns the items to remove from a device, each item before its dependencies.
+// Names not in any catalog, such as items only in InstallInfo.yaml, are removed last.
+func DecommissionOrder(names []string, catalogsMap map[int]map[string]catalog.Item) []catalog.Item {
+	var known, unknown []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if _, err := firstItem(name, catalogsMap); err != nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		known = append(known, name)
+	}
+
+	// Reverse the install order, so nothing is removed while an item still needs it
+	order := installOrder(known, catalogsMap)
+	items := make([]catalog.Item, 0, len(order)+len(unknown))
+	for i := len(order) - 1; i >= 0; i-- {
+		items = append(items, order[i])
+	}
+
+	// Items without a catalog entry can still be removed with their registered uninstall command
+	for _, name := range unknown {
+		items = append(items, catalog.Item{Name: name, DisplayName: name})
+	}
+	return items
+}
+
+// Decommission uninstalls the items in order and returns the names of the ones that
+// have to be removed manually, because they have no way to uninstall them or it failed,
+// with what became of each item
+func Decommission(ctx context.Context, items []catalog.Item, cfg config.Configuration) (manual []string, result ProcessResult) {
+	for _, item := range items {
+		itemResult := ItemResult{Name: item.Name, Version: item.Version, Action: "uninstall", item: item}
+		if shuttingDown(ctx, item) {
+			itemResult.Outcome, itemResult.Reason = OutcomeSkipped, "shutting down"
+			result.add(itemResult)
+			continue
+		}
+		if !installerCanUninstall(item) {
+			logging.Warn("No way to uninstall, remove it manually:", item.Name)
+			report.RecordWarning("No way to uninstall " + item.Name + ", remove it manually")
+			manual = append(manual, item.Name)
+			itemResult.Outcome, itemResult.Reason = OutcomeSkipped, "no way to uninstall"
+			result.add(itemResult)
+			continue
+		}
+
+		// Items that are already gone are not uninstalled again
+		if item.Installer.Runnable() || item.Uninstaller.Runnable() {
+			actionNeeded, err := statusCheckStatus(item, "uninstall", cfg.CachePath)
+			if err != nil {
+				logging.Warn("Unable to check status:", item.Name, err)
+			} else if !actionNeeded {
+				logging.Info("Already uninstalled:", item.Name)
+				itemResult.Outcome = OutcomeNotNeeded
+				result.add(itemResult)
+				continue
+			}
+		}
+
+		first := report.ActionCount()
+		start := timeNow()
+		reason := installerInstallChecked(ctx, item, "uninstall", cfg, true)
+		itemResult.Duration = timeNow().Sub(start)
+		if reason != "" {
+			logging.Warn("Uninstall failed, remove it manually:", item.Name, reason)
+			manual = append(manual, item.Name)
+			_, _, itemResult.Err = actionResult(item, first)
+			itemResult.Outcome, itemResult.Reason = OutcomeFailed, reason
+			result.add(itemResult)
+			continue
+		}
+		itemResult.Outcome = OutcomeSucceeded
+		result.add(itemResult)
+	}
+	return manual, result
+}
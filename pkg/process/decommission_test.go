@@ -0,0 +1,67 @@
+package process
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// itemNames returns the names of the items in order
+func itemNames(items []catalog.Item) []string {
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+// TestDecommissionOrder validates items are removed before their dependencies,
+// and items missing from the catalogs last
+func TestDecommissionOrder(t *testing.T) {
+	catalogs := testCatalogs(
+		testItem("App", "Runtime"),
+		testItem("Runtime"),
+		testItem("Tool", "Runtime"),
+	)
+
+	items := DecommissionOrder([]string{"App", "Legacy", "Tool", "Runtime", "App"}, catalogs)
+
+	expected := []string{"Tool", "App", "Runtime", "Legacy"}
+	if names := itemNames(items); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected order %v, got %v", expected, names)
+	}
+}
+
+// TestDecommissionManual validates items that can't be uninstalled, or fail to,
+// are returned for manual removal and the rest are uninstalled
+func TestDecommissionManual(t *testing.T) {
+	uninstalled := recordInstalls(t)
+	origCan, origInstall := installerCanUninstall, installerInstallChecked
+	t.Cleanup(func() { installerCanUninstall, installerInstallChecked = origCan, origInstall })
+	installerCanUninstall = func(item catalog.Item) bool {
+		return item.Name != "Legacy"
+	}
+	recordInstall := installerInstallChecked
+	installerInstallChecked = func(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) string {
+		if item.Name == "Broken" {
+			return "Uninstall failed"
+		}
+		return recordInstall(ctx, item, installerType, cfg, actionNeeded)
+	}
+
+	items := []catalog.Item{testItem("App"), testItem("Broken"), {Name: "Legacy"}}
+	manual, result := Decommission(context.Background(), items, config.Configuration{})
+
+	if !reflect.DeepEqual(*uninstalled, []string{"App"}) {
+		t.Errorf("expected App to be uninstalled, got %v", *uninstalled)
+	}
+	if !reflect.DeepEqual(manual, []string{"Broken", "Legacy"}) {
+		t.Errorf("expected Broken and Legacy to need manual removal, got %v", manual)
+	}
+	if result.Count(OutcomeSucceeded) != 1 || result.Count(OutcomeFailed) != 1 || result.Count(OutcomeSkipped) != 1 {
+		t.Errorf("unexpected result: %+v", result.Items)
+	}
+}
@@ -0,0 +1,92 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// Where an item is in the walk of the dependency graph
+const (
+	unvisited = iota
+	visiting
+	ordered
+	skipped
+)
+
+// dependencyGraph orders items so that each is installed after its dependencies
+type dependencyGraph struct {
+	catalogsMap map[int]map[string]catalog.Item
+	state       map[string]int
+	path        []string
+	order       []catalog.Item
+}
+
+// installOrder returns the items to install with their dependencies, dependencies first.
+// Each item is only returned once, no matter how many items depend on it.
+// Items in a dependency cycle, and the items depending on them, are skipped.
+func installOrder(installs []string, catalogsMap map[int]map[string]catalog.Item) []catalog.Item {
+	graph := &dependencyGraph{
+		catalogsMap: catalogsMap,
+		state:       make(map[string]int),
+	}
+	for _, name := range installs {
+		if err := graph.visit(name); err != nil {
+			logging.LogError(err, "Processing Error")
+		}
+	}
+	return graph.order
+}
+
+// visit adds an item to the order after all of its dependencies
+func (g *dependencyGraph) visit(name string) error {
+	switch g.state[name] {
+	case ordered:
+		return nil
+	case skipped:
+		return fmt.Errorf("skipping %s, a dependency could not be installed", name)
+	case visiting:
+		chain := append(g.pathFrom(name), name)
+		return fmt.Errorf("dependency cycle: %s", strings.Join(chain, " -> "))
+	}
+
+	item, err := firstItem(name, g.catalogsMap)
+	if err != nil {
+		g.state[name] = skipped
+		return err
+	}
+
+	g.state[name] = visiting
+	g.path = append(g.path, name)
+	defer func() { g.path = g.path[:len(g.path)-1] }()
+
+	for _, dependency := range item.Dependencies {
+		// A missing dependency is logged and the item installed without it
+		if _, err := firstItem(dependency, g.catalogsMap); err != nil {
+			logging.LogError(err, "Processing Error")
+			continue
+		}
+		if err := g.visit(dependency); err != nil {
+			g.state[name] = skipped
+			return err
+		}
+	}
+
+	g.state[name] = ordered
+	g.order = append(g.order, item)
+	return nil
+}
+
+// pathFrom returns the part of the current path that starts at the named item
+func (g *dependencyGraph) pathFrom(name string) []string {
+	for i, visited := range g.path {
+		if visited == name {
+			chain := make([]string, len(g.path)-i)
+			copy(chain, g.path[i:])
+			return chain
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package process
+
+import (
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+)
+
+var (
+	// This abstraction allows us to override when testing
+	updateInstallInfo = pkginfo.UpdateInstallInfo
+)
+
+// RecordInstalls saves the items a run installed or updated to InstallInfo.yaml, and removes
+// the ones it uninstalled, so --decommission finds items no longer in the manifests
+func RecordInstalls(result ProcessResult) error {
+	var installed []pkginfo.InstalledItem
+	var removed []string
+	for _, item := range result.Items {
+		if item.Outcome != OutcomeSucceeded {
+			continue
+		}
+		if item.Action == "uninstall" {
+			removed = append(removed, item.Name)
+			continue
+		}
+		installed = append(installed, pkginfo.InstalledItem{
+			Name:         item.Name,
+			Version:      item.Version,
+			InstallTime:  timeNow().UTC(),
+			Method:       item.item.Installer.Type,
+			Dependencies: item.item.Dependencies,
+		})
+	}
+	if len(installed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	return updateInstallInfo(installed, removed)
+}
@@ -0,0 +1,52 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+)
+
+// TestRecordInstalls validates the items a run installed or updated are recorded with their
+// installer type and dependencies, uninstalled items are removed, and nothing else is recorded
+func TestRecordInstalls(t *testing.T) {
+	clock := time.Date(2024, 7, 9, 14, 30, 0, 0, time.UTC)
+	var gotInstalled []pkginfo.InstalledItem
+	var gotRemoved []string
+	calls := 0
+	origUpdate, origNow := updateInstallInfo, timeNow
+	updateInstallInfo = func(installed []pkginfo.InstalledItem, removed []string) error {
+		calls++
+		gotInstalled, gotRemoved = installed, removed
+		return nil
+	}
+	timeNow = func() time.Time { return clock }
+	t.Cleanup(func() { updateInstallInfo, timeNow = origUpdate, origNow })
+
+	firefox := testItem("Firefox", "VCRedist")
+	chrome := testItem("Chrome")
+	result := ProcessResult{Items: []ItemResult{
+		{Name: "Firefox", Version: "1.0", Action: "install", Outcome: OutcomeSucceeded, item: firefox},
+		{Name: "Chrome", Version: "1.0", Action: "update", Outcome: OutcomeSucceeded, item: chrome},
+		{Name: "Java", Version: "1.0", Action: "uninstall", Outcome: OutcomeSucceeded},
+		{Name: "Zoom", Version: "1.0", Action: "install", Outcome: OutcomeFailed},
+		{Name: "Slack", Version: "1.0", Action: "install", Outcome: OutcomePending},
+		{Name: "Teams", Version: "1.0", Action: "uninstall", Outcome: OutcomeSkipped},
+	}}
+	if err := RecordInstalls(result); err != nil {
+		t.Fatalf("RecordInstalls failed: %v", err)
+	}
+
+	expected := []pkginfo.InstalledItem{
+		{Name: "Firefox", Version: "1.0", InstallTime: clock, Method: firefox.Installer.Type, Dependencies: []string{"VCRedist"}},
+		{Name: "Chrome", Version: "1.0", InstallTime: clock, Method: chrome.Installer.Type},
+	}
+	if !reflect.DeepEqual(gotInstalled, expected) || !reflect.DeepEqual(gotRemoved, []string{"Java"}) {
+		t.Errorf("expected %+v and Java removed, got %+v %v", expected, gotInstalled, gotRemoved)
+	}
+
+	if err := RecordInstalls(ProcessResult{Items: result.Items[3:]}); err != nil || calls != 1 {
+		t.Errorf("expected nothing recorded without a succeeded item, got %d calls %v", calls, err)
+	}
+}
@@ -0,0 +1,252 @@
+//go:build integration
+// +build integration
+
+package process
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/download"
+	"github.com/windowsadmins/gorilla/pkg/makecatalogs"
+	"github.com/windowsadmins/gorilla/pkg/manifest"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/repo"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// These tests run the whole chain, from the pkginfos of a repo through makecatalogs to a client run
+// against the repo over HTTP, with only the installer and the status checks faked. Run them with
+//
+//	go test -tags integration ./pkg/process/
+
+// fixturePayloads are the fake installers of the repo, under its pkgs directory
+var fixturePayloads = map[string]string{
+	"apps/Firefox-128.0.msi":    "firefox installer",
+	"apps/Runtime-8.0.msi":      "runtime installer",
+	"apps/Legacy-1.0.msi":       "legacy installer",
+	"apps/Chrome Setup 126.exe": "chrome installer",
+	"apps/Slack-4.39.msi":       "slack installer",
+}
+
+// fixtureFiles are the manifests and pkginfos of the repo, with {{hash:location}} standing for the
+// hash of a payload. The locations use both separators, and the pkginfos have the fields for the
+// repo tooling, as imported pkginfos do.
+var fixtureFiles = map[string]string{
+	"manifests/site_default.yaml": `name: site_default
+catalogs: [Production]
+included_manifests: [site/lab]
+managed_installs: [Firefox]
+managed_uninstalls: [Legacy]
+managed_updates: [Chrome]
+`,
+	"manifests/site/lab.yaml": `name: site/lab
+catalogs: [Testing]
+managed_installs: [Slack]
+`,
+	"pkgsinfo/apps/Firefox-128.0.yaml": `name: Firefox
+version: "128.0"
+catalogs: [Production]
+dependencies: [Runtime]
+notes: Imported for the integration test
+imported_by: admin
+installer:
+  type: msi
+  location: 'apps\Firefox-128.0.msi'
+  hash: {{hash:apps/Firefox-128.0.msi}}
+`,
+	"pkgsinfo/apps/Runtime-8.0.yaml": `name: Runtime
+version: "8.0"
+catalogs: [Production]
+installer:
+  type: msi
+  location: /apps/Runtime-8.0.msi
+  hash: {{hash:apps/Runtime-8.0.msi}}
+`,
+	"pkgsinfo/apps/Legacy-1.0.yaml": `name: Legacy
+version: "1.0"
+catalogs: [Production]
+installer:
+  type: msi
+  location: apps/Legacy-1.0.msi
+  hash: {{hash:apps/Legacy-1.0.msi}}
+uninstaller:
+  type: msi
+  location: apps/Legacy-1.0.msi
+  hash: {{hash:apps/Legacy-1.0.msi}}
+`,
+	"pkgsinfo/apps/Chrome-126.yaml": `name: Chrome
+version: "126.0"
+catalogs: [Production]
+installer:
+  type: exe
+  location: apps/Chrome Setup 126.exe
+  hash: {{hash:apps/Chrome Setup 126.exe}}
+`,
+	"pkgsinfo/apps/Slack-4.39.yaml": `name: Slack
+version: "4.39"
+catalogs: [Testing]
+installer:
+  type: msi
+  location: pkgs/apps/Slack-4.39.msi
+  hash: {{hash:apps/Slack-4.39.msi}}
+`,
+}
+
+// integrationRepo writes the fixture repo to a temporary directory and opens it
+func integrationRepo(t *testing.T) *repo.Repo {
+	t.Helper()
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var hashes []string
+	for location, content := range fixturePayloads {
+		write("pkgs/"+location, content)
+		sum := sha256.Sum256([]byte(content))
+		hashes = append(hashes, "{{hash:"+location+"}}", hex.EncodeToString(sum[:]))
+	}
+	replacer := strings.NewReplacer(hashes...)
+	for name, content := range fixtureFiles {
+		write(name, replacer.Replace(content))
+	}
+
+	r, err := repo.Open(root)
+	if err != nil {
+		t.Fatalf("unable to open the repo: %v", err)
+	}
+	return r
+}
+
+// fakeMachine overrides the status checks with the versions installed on a machine, and the installer
+// with one that downloads and verifies each payload it is given. It returns the payloads downloaded.
+func fakeMachine(t *testing.T, installed map[string]string) *[]string {
+	origInstall, origCheck, origPath := installerInstallChecked, statusCheckStatus, failuresPath
+	t.Cleanup(func() { installerInstallChecked, statusCheckStatus, failuresPath = origInstall, origCheck, origPath })
+	failuresPath = filepath.Join(t.TempDir(), "ItemFailures.yaml")
+
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		version, ok := installed[item.Name]
+		switch installType {
+		case "uninstall":
+			return ok, nil
+		case "update":
+			return ok && version != item.Version, nil
+		}
+		return version != item.Version, nil
+	}
+
+	var downloaded []string
+	dir := t.TempDir()
+	installerInstallChecked = func(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) string {
+		if !actionNeeded {
+			return ""
+		}
+		url, hash := catalog.ItemURL(cfg, item), item.Installer.Hash
+		if installerType == "uninstall" {
+			url, hash = catalog.UninstallerURL(cfg, item), item.Uninstaller.Hash
+		}
+		dest := filepath.Join(dir, item.Name)
+		err := download.Fetch(url, dest)
+		if err == nil && !download.Verify(dest, hash) {
+			err = fmt.Errorf("the payload of %s doesn't match its hash", url)
+		}
+		if err == nil {
+			downloaded = append(downloaded, strings.TrimPrefix(url, cfg.URL))
+		}
+		report.RecordAction(item.Name, item.Version, installerType, err)
+		return ""
+	}
+	return &downloaded
+}
+
+// TestIntegrationRun validates the catalogs makecatalogs writes for a repo are read by a client run
+// against it, and the run takes the actions the manifests ask for with the payloads of the repo
+func TestIntegrationRun(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		r := integrationRepo(t)
+		opts := makecatalogs.Options{StripFields: pkginfo.DefaultStripFields, Compress: compressed}
+		if err := makecatalogs.Make(r, opts); err != nil {
+			t.Fatalf("makecatalogs failed: %v", err)
+		}
+		server := httptest.NewServer(http.FileServer(http.Dir(r.Root())))
+		t.Cleanup(server.Close)
+
+		cfg := config.Configuration{
+			URL:                server.URL + "/",
+			Manifest:           "site_default",
+			CachePath:          t.TempDir(),
+			CatalogsPath:       t.TempDir(),
+			ManifestsPath:      t.TempDir(),
+			CompressedCatalogs: compressed,
+		}
+		manifests, newCatalogs := manifest.Get(cfg)
+		if !reflect.DeepEqual(newCatalogs, []string{"Production", "Testing"}) {
+			t.Fatalf("compressed %v: unexpected catalogs %v", compressed, newCatalogs)
+		}
+		catalogsMap, err := catalog.Get(cfg, newCatalogs)
+		if err != nil {
+			t.Fatalf("compressed %v: unable to get the catalogs: %v", compressed, err)
+		}
+		firefox := catalogsMap[1]["Firefox"]
+		if firefox.Installer.Location != "apps/Firefox-128.0.msi" || firefox.Extras["notes"] != nil {
+			t.Errorf("compressed %v: unexpected catalog item %+v", compressed, firefox)
+		}
+
+		installs, uninstalls, updates := Manifests(manifests, catalogsMap)
+		if !reflect.DeepEqual(installs, []string{"Firefox", "Slack"}) || !reflect.DeepEqual(uninstalls, []string{"Legacy"}) || !reflect.DeepEqual(updates, []string{"Chrome"}) {
+			t.Fatalf("compressed %v: unexpected plan %v %v %v", compressed, installs, uninstalls, updates)
+		}
+
+		downloaded := fakeMachine(t, map[string]string{"Runtime": "8.0", "Legacy": "1.0", "Chrome": "125.0"})
+		var result ProcessResult
+		result.Merge(Installs(context.Background(), installs, catalogsMap, cfg))
+		result.Merge(Uninstalls(context.Background(), uninstalls, catalogsMap, cfg))
+		result.Merge(Updates(context.Background(), updates, catalogsMap, cfg))
+
+		outcomes := make(map[string]string)
+		for _, item := range result.Items {
+			outcomes[item.Action+" "+item.Name] = string(item.Outcome)
+			if item.Err != nil {
+				t.Errorf("compressed %v: %s %s: %v", compressed, item.Action, item.Name, item.Err)
+			}
+		}
+		expected := map[string]string{
+			"install Runtime":  "not_needed",
+			"install Firefox":  "succeeded",
+			"install Slack":    "succeeded",
+			"uninstall Legacy": "succeeded",
+			"update Chrome":    "succeeded",
+		}
+		if !reflect.DeepEqual(outcomes, expected) {
+			t.Errorf("compressed %v: unexpected outcomes %v", compressed, outcomes)
+		}
+		expectedDownloads := []string{
+			"pkgs/apps/Firefox-128.0.msi",
+			"pkgs/apps/Slack-4.39.msi",
+			"pkgs/apps/Legacy-1.0.msi",
+			"pkgs/apps/Chrome%20Setup%20126.exe",
+		}
+		if !reflect.DeepEqual(*downloaded, expectedDownloads) {
+			t.Errorf("compressed %v: unexpected downloads %v", compressed, *downloaded)
+		}
+	}
+}
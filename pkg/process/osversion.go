@@ -0,0 +1,41 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/facts"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+var (
+	// This abstraction allows us to override when testing
+	machineOSVersion = func() string { return facts.Get().OSVersion }
+)
+
+// osVersionSkip returns why an item doesn't install on a version of Windows,
+// or "" when it does. Without a known version of Windows nothing is skipped.
+func osVersionSkip(item catalog.Item, osVersion string) string {
+	if osVersion == "" {
+		if item.MinimumOSVersion != "" || item.MaximumOSVersion != "" {
+			logging.Warn("Unable to tell the version of Windows, not checking the OS versions of", item.Name)
+		}
+		return ""
+	}
+	for _, limit := range []string{item.MinimumOSVersion, item.MaximumOSVersion} {
+		if limit == "" {
+			continue
+		}
+		if err := catalog.ValidVersion(limit); err != nil {
+			logging.Warn("Ignoring invalid OS version", "item", item.Name, "version", limit, "error", err)
+		}
+	}
+
+	if item.MinimumOSVersion != "" && catalog.NewerVersion(item.MinimumOSVersion, osVersion) {
+		return fmt.Sprintf("requires Windows %s or later, this machine is %s", item.MinimumOSVersion, osVersion)
+	}
+	if item.MaximumOSVersion != "" && catalog.NewerVersion(osVersion, item.MaximumOSVersion) {
+		return fmt.Sprintf("supports Windows up to %s, this machine is %s", item.MaximumOSVersion, osVersion)
+	}
+	return ""
+}
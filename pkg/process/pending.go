@@ -0,0 +1,205 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/installer"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/report"
+	"gopkg.in/yaml.v3"
+)
+
+// This abstraction allows us to override when testing
+var installerDownload = installer.Download
+
+// DefaultPendingMaxAge is how old the pending set can be for an install only run when the config doesn't say
+const DefaultPendingMaxAge = 24 * time.Hour
+
+// Pending is the set of items a check only or download only run found to need action,
+// saved as pendinginstalls.yaml for the next install only run. The items carry the version,
+// installer location and hash that were checked, so the install only run installs exactly those.
+type Pending struct {
+	Created    time.Time      `yaml:"created"`
+	Installs   []catalog.Item `yaml:"installs"`
+	Uninstalls []catalog.Item `yaml:"uninstalls"`
+	Updates    []catalog.Item `yaml:"updates"`
+}
+
+// PendingPath returns where the pending set is saved
+func PendingPath(cachePath string) string {
+	return filepath.Join(cachePath, "pendinginstalls.yaml")
+}
+
+// PendingMaxAge returns how old the pending set can be, pending_max_age_hours or the default
+func PendingMaxAge(cfg config.Configuration) time.Duration {
+	if cfg.PendingMaxAgeHours <= 0 {
+		return DefaultPendingMaxAge
+	}
+	return time.Duration(cfg.PendingMaxAgeHours) * time.Hour
+}
+
+// Stale returns true when the pending set is older than maxAge, the items may have changed since
+func (p Pending) Stale(maxAge time.Duration) bool {
+	return timeNow().Sub(p.Created) > maxAge
+}
+
+// CheckedPending returns the items of a check only run that need action as the pending set
+func CheckedPending(result ProcessResult) Pending {
+	pending := Pending{Created: timeNow()}
+	for _, item := range result.Items {
+		if item.Outcome != OutcomePending {
+			continue
+		}
+		switch item.Action {
+		case "install":
+			pending.Installs = append(pending.Installs, item.item)
+		case "uninstall":
+			pending.Uninstalls = append(pending.Uninstalls, item.item)
+		case "update":
+			pending.Updates = append(pending.Updates, item.item)
+		}
+	}
+	return pending
+}
+
+// DownloadOnly checks every item, caches the payloads of the items that need action
+// and saves them as the pending set, without installing anything
+func DownloadOnly(ctx context.Context, installs, uninstalls, updates []string, catalogsMap map[int]map[string]catalog.Item, cfg config.Configuration) (Pending, error) {
+	pending := Pending{
+		Created:    timeNow(),
+		Installs:   neededItems(supportedItems(installOrder(installs, catalogsMap), "install", nil), "install", cfg),
+		Uninstalls: neededItems(supportedItems(validItems(uninstalls, catalogsMap), "uninstall", nil), "uninstall", cfg),
+		Updates:    neededItems(supportedItems(validItems(updates, catalogsMap), "update", nil), "update", cfg),
+	}
+
+	// A failed download is left pending, the install only run tries it again
+	download := func(items []catalog.Item, installerType string) {
+		for _, item := range items {
+			if shuttingDown(ctx, item) || diskFilled(item) != nil {
+				continue
+			}
+			report.RecordPending(item)
+			err := installerDownload(item, installerType, cfg)
+			if err != nil {
+				logging.Warn("Unable to download", item.Name, err)
+				continue
+			}
+			logging.Info("Downloaded for a later", installerType, item.Name, item.Version)
+		}
+	}
+	download(pending.Installs, "install")
+	download(pending.Uninstalls, "uninstall")
+	download(pending.Updates, "update")
+
+	return pending, SavePending(cfg.CachePath, pending)
+}
+
+// neededItems returns the items whose status shows they need action
+func neededItems(items []catalog.Item, installType string, cfg config.Configuration) []catalog.Item {
+	var needed []catalog.Item
+	for _, planned := range plan(items, installType, cfg, nil) {
+		if planned.err != nil {
+			logging.Warn("Unable to check status:", planned.item.Name, planned.err)
+			continue
+		}
+		if planned.actionNeeded {
+			needed = append(needed, planned.item)
+		}
+	}
+	return needed
+}
+
+// SavePending writes the pending set to the cache
+func SavePending(cachePath string, pending Pending) error {
+	data, err := yaml.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to encode the pending items: %v", err)
+	}
+	if err := os.MkdirAll(cachePath, 0755); err != nil {
+		return fmt.Errorf("failed to create the cache directory: %v", err)
+	}
+	return ioutil.WriteFile(PendingPath(cachePath), data, 0644)
+}
+
+// LoadPending reads the pending set saved by a check only or download only run
+func LoadPending(cachePath string) (Pending, error) {
+	var pending Pending
+	data, err := ioutil.ReadFile(PendingPath(cachePath))
+	if err != nil {
+		return pending, err
+	}
+	if err := yaml.Unmarshal(data, &pending); err != nil {
+		return pending, fmt.Errorf("failed to decode the pending items: %v", err)
+	}
+	return pending, nil
+}
+
+// PrintPending writes the action, name and version of every item of the pending set, marking
+// the items deferred after repeated failures with when they are attempted again
+func PrintPending(w io.Writer, pending Pending, cfg config.Configuration) error {
+	failuresMu.Lock()
+	failures, err := loadFailures()
+	failuresMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	list := func(items []catalog.Item, installType string) {
+		for _, item := range items {
+			count++
+			line := fmt.Sprintf("%s %s %s", installType, item.Name, item.Version)
+			if until := deferredUntil(failures[item.Name], item, cfg); !until.IsZero() {
+				line += fmt.Sprintf(" (%s, next attempt after %s)", reasonDeferred, until.Format(attemptFormat))
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	list(pending.Installs, "install")
+	list(pending.Uninstalls, "uninstall")
+	list(pending.Updates, "update")
+	if count == 0 {
+		fmt.Fprintln(w, "No pending items.")
+	}
+	return nil
+}
+
+// InstallPending acts on the pending set, checking each item again first,
+// then removes the pending set unless Gorilla shut down before it was done
+func InstallPending(ctx context.Context, pending Pending, cfg config.Configuration) ProcessResult {
+	var result ProcessResult
+	act := func(items []catalog.Item, installerType string) {
+		for _, planned := range plan(items, installerType, cfg, &result) {
+			if planned.err != nil {
+				logging.Warn("Unable to check status:", planned.item.Name, planned.err)
+				result.add(statusError(planned, installerType))
+				continue
+			}
+			result.add(installChecked(ctx, planned.item, installerType, cfg, planned.actionNeeded))
+		}
+	}
+	act(pending.Installs, "install")
+	act(pending.Uninstalls, "uninstall")
+	act(pending.Updates, "update")
+
+	if ctx.Err() != nil {
+		return result
+	}
+	ClearPending(cfg.CachePath)
+	return result
+}
+
+// ClearPending removes the pending set, once it was installed or a full run made it outdated
+func ClearPending(cachePath string) {
+	if err := os.Remove(PendingPath(cachePath)); err != nil && !os.IsNotExist(err) {
+		logging.Warn("Unable to remove the pending items", "error", err)
+	}
+}
@@ -0,0 +1,134 @@
+package process
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// recordDownloads overrides installerDownload and returns the names downloaded
+func recordDownloads(t *testing.T) *[]string {
+	var downloaded []string
+	origDownload := installerDownload
+	t.Cleanup(func() {
+		installerDownload = origDownload
+		report.PendingItems = nil
+	})
+	installerDownload = func(item catalog.Item, installerType string, cfg config.Configuration) error {
+		downloaded = append(downloaded, installerType+" "+item.Name)
+		return nil
+	}
+	return &downloaded
+}
+
+// TestDownloadOnly validates the payloads of the items that need action are downloaded
+// and saved as pending, without installing anything
+func TestDownloadOnly(t *testing.T) {
+	installed := recordInstalls(t)
+	downloaded := recordDownloads(t)
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		return item.Name != "Current", nil
+	}
+	catalogs := testCatalogs(testItem("App", "Runtime"), testItem("Runtime"), testItem("Current"), testItem("Old"))
+	cfg := config.Configuration{CachePath: t.TempDir()}
+
+	_, err := DownloadOnly(context.Background(), []string{"App", "Current"}, []string{"Old"}, []string{"Current"}, catalogs, cfg)
+	if err != nil {
+		t.Fatalf("DownloadOnly failed: %v", err)
+	}
+
+	if len(*installed) != 0 {
+		t.Errorf("expected nothing installed, got %v", *installed)
+	}
+	expected := []string{"install Runtime", "install App", "uninstall Old"}
+	if !reflect.DeepEqual(*downloaded, expected) {
+		t.Errorf("expected downloads %v, got %v", expected, *downloaded)
+	}
+
+	pending, err := LoadPending(cfg.CachePath)
+	if err != nil {
+		t.Fatalf("LoadPending failed: %v", err)
+	}
+	if names := itemNames(pending.Installs); !reflect.DeepEqual(names, []string{"Runtime", "App"}) {
+		t.Errorf("unexpected pending installs: %v", names)
+	}
+	if names := itemNames(pending.Uninstalls); !reflect.DeepEqual(names, []string{"Old"}) {
+		t.Errorf("unexpected pending uninstalls: %v", names)
+	}
+	if len(pending.Updates) != 0 || len(report.PendingItems) != 3 {
+		t.Errorf("expected 3 pending items, got %+v and %d in the report", pending.Updates, len(report.PendingItems))
+	}
+}
+
+// TestInstallPending validates the pending items are installed and the pending set removed
+func TestInstallPending(t *testing.T) {
+	installed := recordInstalls(t)
+	cfg := config.Configuration{CachePath: t.TempDir()}
+	pending := Pending{Installs: []catalog.Item{testItem("Runtime"), testItem("App")}}
+	if err := SavePending(cfg.CachePath, pending); err != nil {
+		t.Fatalf("SavePending failed: %v", err)
+	}
+
+	InstallPending(context.Background(), pending, cfg)
+
+	if !reflect.DeepEqual(*installed, []string{"Runtime", "App"}) {
+		t.Errorf("expected Runtime and App installed, got %v", *installed)
+	}
+	if _, err := os.Stat(PendingPath(cfg.CachePath)); !os.IsNotExist(err) {
+		t.Errorf("expected the pending set to be removed, got %v", err)
+	}
+}
+
+// TestCheckedPending validates a check only run saves the items that need action, with the
+// version that was checked, and the pending set goes stale after the max age
+func TestCheckedPending(t *testing.T) {
+	clock := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	fakeFailures(t, &clock, nil)
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		return item.Name != "Current", nil
+	}
+	app := testItem("App")
+	app.Version, app.Installer.Hash = "2.0", "abc123"
+	catalogs := testCatalogs(app, testItem("Current"), testItem("Old"))
+	cfg := config.Configuration{CachePath: t.TempDir(), CheckOnly: true}
+
+	var result ProcessResult
+	result.Merge(Installs(context.Background(), []string{"App", "Current"}, catalogs, cfg))
+	result.Merge(Uninstalls(context.Background(), []string{"Old"}, catalogs, cfg))
+	if err := SavePending(cfg.CachePath, CheckedPending(result)); err != nil {
+		t.Fatalf("SavePending failed: %v", err)
+	}
+
+	pending, err := LoadPending(cfg.CachePath)
+	if err != nil {
+		t.Fatalf("LoadPending failed: %v", err)
+	}
+	if !reflect.DeepEqual(itemNames(pending.Installs), []string{"App"}) || !reflect.DeepEqual(itemNames(pending.Uninstalls), []string{"Old"}) || len(pending.Updates) != 0 {
+		t.Errorf("unexpected pending set: %+v", pending)
+	}
+	if app := pending.Installs[0]; app.Version != "2.0" || app.Installer.Hash != "abc123" || app.Installer.Location != "packages/App.msi" {
+		t.Errorf("expected the checked version of App, got %+v", app)
+	}
+	if !pending.Created.Equal(clock) {
+		t.Errorf("expected the pending set created at %s, got %s", clock, pending.Created)
+	}
+
+	maxAge := PendingMaxAge(cfg)
+	clock = clock.Add(maxAge)
+	if pending.Stale(maxAge) {
+		t.Error("expected the pending set to be current at the max age")
+	}
+	clock = clock.Add(time.Minute)
+	if !pending.Stale(maxAge) {
+		t.Error("expected the pending set to be stale after the max age")
+	}
+	if PendingMaxAge(config.Configuration{PendingMaxAgeHours: 4}) != 4*time.Hour {
+		t.Error("expected pending_max_age_hours to set the max age")
+	}
+}
@@ -0,0 +1,55 @@
+package process
+
+import (
+	"sync"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/progress"
+)
+
+// DefaultConcurrentChecks is how many items are checked at once unless `MaxConcurrentChecks` is set
+const DefaultConcurrentChecks = 4
+
+// plannedItem is an item with its status, checked before anything is installed
+type plannedItem struct {
+	item         catalog.Item
+	actionNeeded bool
+	err          error
+}
+
+// plan checks the status of every item, up to MaxConcurrentChecks at a time,
+// and returns the results in the same order as the items. User scoped items
+// are left out, and added to result as skipped, when nobody is logged on to check them for.
+func plan(items []catalog.Item, installType string, cfg config.Configuration, result *ProcessResult) []plannedItem {
+	items = scopedItems(items, installType, result)
+	workers := DefaultConcurrentChecks
+	if cfg.MaxConcurrentChecks > 0 {
+		workers = cfg.MaxConcurrentChecks
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	planned := make([]plannedItem, len(items))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				actionNeeded, err := statusCheckStatus(items[i], installType, cfg.CachePath)
+				planned[i] = plannedItem{item: items[i], actionNeeded: actionNeeded, err: err}
+				progress.ItemEvaluated(items[i].Name, items[i].Version, installType, actionNeeded, err)
+			}
+		}()
+	}
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return planned
+}
@@ -0,0 +1,101 @@
+package process
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// syntheticItems returns a number of independent catalog items
+func syntheticItems(count int) []catalog.Item {
+	items := make([]catalog.Item, count)
+	for i := range items {
+		items[i] = testItem(fmt.Sprintf("Item%03d", i))
+	}
+	return items
+}
+
+// fakeChecks overrides statusCheckStatus with a check that takes some time,
+// and returns the most checks that ran at once
+func fakeChecks(tb testing.TB, delay time.Duration) *int {
+	origCheck := statusCheckStatus
+	tb.Cleanup(func() { statusCheckStatus = origCheck })
+
+	var mu sync.Mutex
+	running, most := 0, 0
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		time.Sleep(delay)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return item.Name != "Item001", nil
+	}
+	return &most
+}
+
+// TestPlanOrder validates results keep the order of the items
+func TestPlanOrder(t *testing.T) {
+	fakeChecks(t, time.Millisecond)
+	items := syntheticItems(20)
+
+	planned := plan(items, "install", config.Configuration{MaxConcurrentChecks: 8}, nil)
+	if len(planned) != len(items) {
+		t.Fatalf("expected %d results, got %d", len(items), len(planned))
+	}
+	for i, result := range planned {
+		if result.item.Name != items[i].Name {
+			t.Errorf("result %d is %s, expected %s", i, result.item.Name, items[i].Name)
+		}
+		if result.actionNeeded != (result.item.Name != "Item001") {
+			t.Errorf("unexpected result for %s: %v", result.item.Name, result.actionNeeded)
+		}
+	}
+}
+
+// TestPlanConcurrency validates no more than MaxConcurrentChecks run at once, 4 by default
+func TestPlanConcurrency(t *testing.T) {
+	tests := map[int]int{0: DefaultConcurrentChecks, 1: 1, 6: 6}
+	for maxChecks, expected := range tests {
+		most := fakeChecks(t, 5*time.Millisecond)
+		plan(syntheticItems(30), "install", config.Configuration{MaxConcurrentChecks: maxChecks}, nil)
+		if *most > expected {
+			t.Errorf("MaxConcurrentChecks %d: %d checks ran at once", maxChecks, *most)
+		}
+	}
+}
+
+// TestPlanEmpty validates nothing is checked without items
+func TestPlanEmpty(t *testing.T) {
+	if planned := plan(nil, "install", config.Configuration{}, nil); len(planned) != 0 {
+		t.Errorf("expected no results, got %v", planned)
+	}
+}
+
+func benchmarkPlan(b *testing.B, maxChecks int) {
+	fakeChecks(b, 100*time.Microsecond)
+	items := syntheticItems(200)
+	cfg := config.Configuration{MaxConcurrentChecks: maxChecks}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		plan(items, "install", cfg, nil)
+	}
+}
+
+// BenchmarkPlanSerial checks 200 items one at a time
+func BenchmarkPlanSerial(b *testing.B) { benchmarkPlan(b, 1) }
+
+// BenchmarkPlanParallel checks 200 items with the default concurrency
+func BenchmarkPlanParallel(b *testing.B) { benchmarkPlan(b, DefaultConcurrentChecks) }
@@ -1,20 +1,36 @@
 package process
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
+
 	"github.com/windowsadmins/gorilla/pkg/catalog"
-	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/download"
 	"github.com/windowsadmins/gorilla/pkg/installer"
+	"github.com/windowsadmins/gorilla/pkg/logging"
 	"github.com/windowsadmins/gorilla/pkg/manifest"
+	"github.com/windowsadmins/gorilla/pkg/status"
 )
 
-// firstItem returns the first occurrence of an item in a map of catalogs
-func firstItem(itemName string, catalogsMap map[int]map[string]catalog.Item) (catalog.Item, error) {
+// CatalogEntry is an item as one catalog has it
+type CatalogEntry struct {
+	// Priority is the key of the catalog in catalogsMap, lower wins
+	Priority int
+	Item     catalog.Item
+	// Valid is false when the entry has no installer or uninstaller to act on
+	Valid bool
+}
+
+// Resolution returns the entries for an item in every catalog that has it, in priority order.
+// The first valid entry is the one used, the valid entries after it are shadowed.
+func Resolution(itemName string, catalogsMap map[int]map[string]catalog.Item) []CatalogEntry {
 	// Get the keys in the map and sort them so we can loop over them in order
 	keys := make([]int, 0)
 	for k := range catalogsMap {
@@ -22,139 +38,188 @@ func firstItem(itemName string, catalogsMap map[int]map[string]catalog.Item) (ca
 	}
 	sort.Ints(keys)
 
-	// loop through each catalog and return if we find a match
+	var entries []CatalogEntry
 	for _, k := range keys {
-		// If
-		if item, exists := catalogsMap[k][itemName]; exists {
-			// If it does exist, we should confirm it is a valid item
-			validInstallItem := (item.Installer.Type != "" && item.Installer.Location != "")
-			validUninstallItem := (item.Uninstaller.Type != "" && item.Uninstaller.Location != "")
-
-			if validInstallItem || validUninstallItem {
-				return item, nil
-			}
+		item, exists := catalogsMap[k][itemName]
+		if !exists {
+			continue
 		}
+		entries = append(entries, CatalogEntry{Priority: k, Item: item, Valid: item.Installer.Runnable() || item.Uninstaller.Runnable()})
 	}
+	return entries
+}
 
-	// return an empty catalog item if we didnt already find and return a match
-	return catalog.Item{}, fmt.Errorf("did not find a valid item in any catalog; Item name: %v", itemName)
+// shadowWarned keeps each newer version in a lower priority catalog from being warned about more than once
+var (
+	shadowWarned   = make(map[string]bool)
+	shadowWarnedMu sync.Mutex
+)
 
+// firstItem returns the first valid occurrence of an item in a map of catalogs.
+// The first catalog wins, even when a later catalog has a newer version of the item,
+// which is only warned about.
+func firstItem(itemName string, catalogsMap map[int]map[string]catalog.Item) (catalog.Item, error) {
+	var first *CatalogEntry
+	for _, entry := range Resolution(itemName, catalogsMap) {
+		if !entry.Valid {
+			continue
+		}
+		if first == nil {
+			entry := entry
+			first = &entry
+			continue
+		}
+		if catalog.NewerVersion(entry.Item.Version, first.Item.Version) {
+			warnShadowed(itemName, *first, entry)
+		}
+	}
+	if first == nil {
+		return catalog.Item{}, fmt.Errorf("did not find a valid item in any catalog; Item name: %v", itemName)
+	}
+	return first.Item, nil
+}
+
+// warnShadowed warns once that a lower priority catalog has a newer version than the one used
+func warnShadowed(itemName string, used, shadowed CatalogEntry) {
+	key := fmt.Sprintf("%s\x00%d\x00%s", itemName, shadowed.Priority, shadowed.Item.Version)
+	shadowWarnedMu.Lock()
+	defer shadowWarnedMu.Unlock()
+	if shadowWarned[key] {
+		return
+	}
+	shadowWarned[key] = true
+	logging.Warn("A lower priority catalog has a newer version", "item", itemName,
+		"version", used.Item.Version, "catalog", used.Priority,
+		"newer_version", shadowed.Item.Version, "newer_catalog", shadowed.Priority)
 }
 
-// Manifests iterates though the first manifest and any included manifests
+// Manifests iterates though the first manifest and any included manifests. Each item is listed
+// once, and an item that is both installed and uninstalled is only uninstalled.
 func Manifests(manifests []manifest.Item, catalogsMap map[int]map[string]catalog.Item) (installs, uninstalls, updates []string) {
-	// Compile all of the installs, uninstalls, and updates into arrays
+	// Compile all of the installs, uninstalls, and updates, with the manifest each came from
+	depths := manifestDepths(manifests)
+	var installed, uninstalled, updated []listedItem
 	for _, manifestItem := range manifests {
-		// Installs
-		for _, item := range manifestItem.Installs {
-			// Check for the first valid item from our catalogs
-			// Continue to the next item in the loop if we get an error
-			_, err := firstItem(item, catalogsMap)
-			if err != nil {
-		logging.LogError(err, "Processing Error")
-				logging.Warn(err)
-				continue
-			}
+		installed = appendListed(installed, manifestItem.Installs, manifestItem, depths, catalogsMap)
+		uninstalled = appendListed(uninstalled, manifestItem.Uninstalls, manifestItem, depths, catalogsMap)
+		updated = appendListed(updated, manifestItem.Updates, manifestItem, depths, catalogsMap)
+	}
+	installed = resolveConflicts(installed, uninstalled)
+	return listedNames(installed), listedNames(uninstalled), listedNames(updated)
+}
 
-			// If we didnt error, append the item to our installs list
-			installs = append(installs, item)
-		}
-		// Uninstalls
-		for _, item := range manifestItem.Uninstalls {
-			// Check for the first valid item from our catalogs
-			// Continue to the next item in the loop if we get an error
-			_, err := firstItem(item, catalogsMap)
-			if err != nil {
-		logging.LogError(err, "Processing Error")
-				logging.Warn(err)
-				continue
-			}
+// These abstractions allows us to override when testing
+var (
+	installerInstallChecked = installer.InstallChecked
+	statusCheckStatus       = status.CheckStatus
+	downloadDiskFull        = download.DiskFull
+)
 
-			// If we didnt error, append the item to our uninstalls list
-			uninstalls = append(uninstalls, item)
+// Installs prepares and then installs an array of items, returning what became of each
+func Installs(ctx context.Context, installs []string, catalogsMap map[int]map[string]catalog.Item, cfg config.Configuration) ProcessResult {
+	var result ProcessResult
+	// Check every item first, then install each once, after its dependencies
+	planned := plan(supportedItems(installOrder(installs, catalogsMap), "install", &result), "install", cfg, &result)
+	for _, itemResult := range schedule(planned, "install", cfg, func(planned plannedItem) ItemResult {
+		if planned.err != nil {
+			logging.Warn("Unable to check status:", planned.item.Name, planned.err)
+			return statusError(planned, "install")
 		}
-		// Updates
-		for _, item := range manifestItem.Updates {
-			// Check for the first valid item from our catalogs
-			// Continue to the next item in the loop if we get an error
-			_, err := firstItem(item, catalogsMap)
-			if err != nil {
-		logging.LogError(err, "Processing Error")
-				logging.Warn(err)
-				continue
-			}
+		return installChecked(ctx, planned.item, "install", cfg, planned.actionNeeded)
+	}) {
+		result.add(itemResult)
+	}
+	return result
+}
 
-			// If we didnt error, append the item to our updates list
-			updates = append(updates, item)
+// Uninstalls prepares and then uninstalls an array of items, returning what became of each
+func Uninstalls(ctx context.Context, uninstalls []string, catalogsMap map[int]map[string]catalog.Item, cfg config.Configuration) ProcessResult {
+	var result ProcessResult
+	// Check every item first, then uninstall the items that are installed
+	planned := plan(supportedItems(validItems(uninstalls, catalogsMap), "uninstall", &result), "uninstall", cfg, &result)
+	for _, itemResult := range schedule(planned, "uninstall", cfg, func(planned plannedItem) ItemResult {
+		if planned.err != nil {
+			logging.Warn("Unable to check status:", planned.item.Name, planned.err)
+			return statusError(planned, "uninstall")
 		}
+		return installChecked(ctx, planned.item, "uninstall", cfg, planned.actionNeeded)
+	}) {
+		result.add(itemResult)
 	}
-	return
+	return result
 }
 
-// This abstraction allows us to override when testing
-var installerInstall = installer.Install
-
-// Installs prepares and then installs an array of items
-func Installs(installs []string, catalogsMap map[int]map[string]catalog.Item, urlPackages, cachePath string, CheckOnly bool) {
-	// Iterate through the installs array, install dependencies, and then the item itself
-	for _, item := range installs {
-		// Get the first valid item from our catalogs
-		// Continue to the next item in the loop if we get an error
-		validItem, err := firstItem(item, catalogsMap)
-		if err != nil {
-		logging.LogError(err, "Processing Error")
-			logging.Warn(err)
-			continue
+// Updates prepares and then updates an array of items, returning what became of each
+func Updates(ctx context.Context, updates []string, catalogsMap map[int]map[string]catalog.Item, cfg config.Configuration) ProcessResult {
+	var result ProcessResult
+	// Iterate through the updates array and update the item **if it is already installed**
+	planned := plan(supportedItems(validItems(updates, catalogsMap), "update", &result), "update", cfg, &result)
+	for _, itemResult := range schedule(planned, "update", cfg, func(planned plannedItem) ItemResult {
+		if planned.err != nil {
+			logging.Warn("Skipping update, unable to check status:", planned.item.Name, planned.err)
+			return statusError(planned, "update")
 		}
-		// Check for dependencies and install if found
-		if len(validItem.Dependencies) > 0 {
-			for _, dependency := range validItem.Dependencies {
-				validDependency, err := firstItem(dependency, catalogsMap)
-				if err != nil {
-		logging.LogError(err, "Processing Error")
-					logging.Warn(err)
-					continue
-				}
-				installerInstall(validDependency, "install", urlPackages, cachePath, CheckOnly)
-			}
+		// Only update items that are already installed and out of date
+		if !planned.actionNeeded {
+			logging.Info("Skipping update, not installed or already up to date:", planned.item.Name)
+			return ItemResult{Name: planned.item.Name, Version: planned.item.Version, Action: "update", Outcome: OutcomeNotNeeded}
 		}
-		// Install the item
-		installerInstall(validItem, "install", urlPackages, cachePath, CheckOnly)
+		// Update the item
+		return installChecked(ctx, planned.item, "update", cfg, true)
+	}) {
+		result.add(itemResult)
 	}
+	return result
 }
 
-// Uninstalls prepares and then installs an array of items
-func Uninstalls(uninstalls []string, catalogsMap map[int]map[string]catalog.Item, urlPackages, cachePath string, CheckOnly bool) {
-	// Iterate through the uninstalls array and uninstall the item
-	for _, item := range uninstalls {
-		// Get the first valid item from our catalogs
-		// Continue to the next item in the loop if we get an error
-		validItem, err := firstItem(item, catalogsMap)
-		if err != nil {
-		logging.LogError(err, "Processing Error")
-			logging.Warn(err)
-			continue
+// ForceInstalls installs and updates only the items past their force_install_after_date,
+// with their dependencies, for auto runs that are otherwise skipped while the user is active
+func ForceInstalls(ctx context.Context, installs, updates []string, catalogsMap map[int]map[string]catalog.Item, cfg config.Configuration) ProcessResult {
+	forced := func(names []string) []string {
+		var due []string
+		for _, item := range validItems(names, catalogsMap) {
+			if installer.ForceInstallDue(item) {
+				due = append(due, item.Name)
+			}
 		}
-		// Uninstall the item
-		installerInstall(validItem, "uninstall", urlPackages, cachePath, CheckOnly)
+		return due
 	}
+	var result ProcessResult
+	if names := forced(installs); len(names) > 0 {
+		result.Merge(Installs(ctx, names, catalogsMap, cfg))
+	}
+	if names := forced(updates); len(names) > 0 {
+		result.Merge(Updates(ctx, names, catalogsMap, cfg))
+	}
+	return result
 }
 
-// Updates prepares and then installs an array of items
-func Updates(updates []string, catalogsMap map[int]map[string]catalog.Item, urlPackages, cachePath string, CheckOnly bool) {
-	// Iterate through the updates array and update the item **if it is already installed**
-	for _, item := range updates {
+// statusError is the result of an item skipped because its status could not be checked
+func statusError(planned plannedItem, installType string) ItemResult {
+	return ItemResult{
+		Name:    planned.item.Name,
+		Version: planned.item.Version,
+		Action:  installType,
+		Outcome: OutcomeSkipped,
+		Reason:  "unable to check status",
+		Err:     planned.err,
+	}
+}
+
+// validItems returns the first valid catalog item for each name, logging the names without one
+func validItems(names []string, catalogsMap map[int]map[string]catalog.Item) []catalog.Item {
+	var items []catalog.Item
+	for _, name := range names {
 		// Get the first valid item from our catalogs
 		// Continue to the next item in the loop if we get an error
-		validItem, err := firstItem(item, catalogsMap)
+		validItem, err := firstItem(name, catalogsMap)
 		if err != nil {
-		logging.LogError(err, "Processing Error")
-			logging.Warn(err)
+			logging.LogError(err, "Processing Error")
 			continue
 		}
-		// Update the item
-		installerInstall(validItem, "update", urlPackages, cachePath, CheckOnly)
+		items = append(items, validItem)
 	}
+	return items
 }
 
 // dirEmpty returns true if the directory is empty
@@ -193,16 +258,21 @@ func fileOld(info os.FileInfo) bool {
 // This abstraction allows us to override when testing
 var osRemove = os.Remove
 
-// CleanUp checks the age of items in the cache and removes if older than 10 days
+// CleanUp checks the age of items in the cache and removes if older than 10 days.
+// Install logs are kept for their own retention and are left to installer.PruneInstallLogs.
 func CleanUp(cachePath string) {
+	logsDir := installer.InstallLogsDir(cachePath)
 
 	// Clean up old files
 	err := filepath.Walk(cachePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-		logging.LogError(err, "Processing Error")
+			logging.LogError(err, "Processing Error")
 			logging.Warn("Failed to access path:", path, err)
 			return err
 		}
+		if info.IsDir() && path == logsDir {
+			return filepath.SkipDir
+		}
 		// If not a directory and older that our limit, delete
 		if !info.IsDir() && fileOld(info) {
 			logging.Info("Cleaning old cached file:", info.Name())
@@ -220,7 +290,7 @@ func CleanUp(cachePath string) {
 	// Clean up empty directories
 	err = filepath.Walk(cachePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-		logging.LogError(err, "Processing Error")
+			logging.LogError(err, "Processing Error")
 			logging.Warn("Failed to access path:", path, err)
 			return err
 		}
@@ -0,0 +1,204 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// testItem returns a valid catalog item with the given dependencies
+func testItem(name string, dependencies ...string) catalog.Item {
+	return catalog.Item{
+		Name:         name,
+		Dependencies: dependencies,
+		Installer:    catalog.InstallerItem{Type: "msi", Location: "packages/" + name + ".msi"},
+	}
+}
+
+// testCatalogs puts the items in a single catalog
+func testCatalogs(items ...catalog.Item) map[int]map[string]catalog.Item {
+	catalogItems := make(map[string]catalog.Item)
+	for _, item := range items {
+		catalogItems[item.Name] = item
+	}
+	return map[int]map[string]catalog.Item{1: catalogItems}
+}
+
+// recordInstalls overrides installerInstall and returns the names installed
+func recordInstalls(t *testing.T) *[]string {
+	var installed []string
+	origInstall, origCheck := installerInstallChecked, statusCheckStatus
+	t.Cleanup(func() { installerInstallChecked, statusCheckStatus = origInstall, origCheck })
+	installerInstallChecked = func(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) string {
+		if actionNeeded {
+			installed = append(installed, item.Name)
+		}
+		return ""
+	}
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		return true, nil
+	}
+	return &installed
+}
+
+// TestInstallsDiamond validates a shared dependency is installed once, before everything that needs it
+func TestInstallsDiamond(t *testing.T) {
+	installed := recordInstalls(t)
+	catalogs := testCatalogs(
+		testItem("App", "Left", "Right"),
+		testItem("Left", "Runtime"),
+		testItem("Right", "Runtime"),
+		testItem("Runtime"),
+		testItem("Tool", "Runtime"),
+	)
+
+	Installs(context.Background(), []string{"App", "Tool", "App"}, catalogs, config.Configuration{})
+
+	expected := []string{"Runtime", "Left", "Right", "App", "Tool"}
+	if !reflect.DeepEqual(*installed, expected) {
+		t.Errorf("expected installs %v, got %v", expected, *installed)
+	}
+}
+
+// TestInstallsCycle validates items in a dependency cycle are skipped and the others installed
+func TestInstallsCycle(t *testing.T) {
+	installed := recordInstalls(t)
+	catalogs := testCatalogs(
+		testItem("A", "B"),
+		testItem("B", "C"),
+		testItem("C", "A"),
+		testItem("Parent", "B"),
+		testItem("Standalone"),
+	)
+
+	Installs(context.Background(), []string{"A", "Parent", "Standalone"}, catalogs, config.Configuration{})
+
+	expected := []string{"Standalone"}
+	if !reflect.DeepEqual(*installed, expected) {
+		t.Errorf("expected installs %v, got %v", expected, *installed)
+	}
+}
+
+// TestInstallsMissingDependency validates a missing dependency does not stop the item or its other dependencies
+func TestInstallsMissingDependency(t *testing.T) {
+	installed := recordInstalls(t)
+	catalogs := testCatalogs(
+		testItem("App", "Missing", "Runtime"),
+		testItem("Runtime"),
+	)
+
+	Installs(context.Background(), []string{"App", "NotInCatalog"}, catalogs, config.Configuration{})
+
+	expected := []string{"Runtime", "App"}
+	if !reflect.DeepEqual(*installed, expected) {
+		t.Errorf("expected installs %v, got %v", expected, *installed)
+	}
+}
+
+// TestDependencyCycleChain validates the cycle error names every item in it
+func TestDependencyCycleChain(t *testing.T) {
+	graph := &dependencyGraph{
+		catalogsMap: testCatalogs(testItem("A", "B"), testItem("B", "A")),
+		state:       make(map[string]int),
+	}
+	err := graph.visit("A")
+	if err == nil || err.Error() != "dependency cycle: A -> B -> A" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestUpdatesOnlyInstalled validates updates are skipped for items that are not installed
+func TestUpdatesOnlyInstalled(t *testing.T) {
+	installed := recordInstalls(t)
+
+	// NotInstalled has no update to do, Outdated is installed with an older version
+	var checked []string
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		checked = append(checked, item.Name+":"+installType)
+		return item.Name == "Outdated", nil
+	}
+	catalogs := testCatalogs(testItem("NotInstalled"), testItem("Outdated"))
+
+	result := Updates(context.Background(), []string{"NotInstalled", "Outdated"}, catalogs, config.Configuration{MaxConcurrentChecks: 1})
+
+	if !reflect.DeepEqual(checked, []string{"NotInstalled:update", "Outdated:update"}) {
+		t.Errorf("unexpected status checks: %v", checked)
+	}
+	if !reflect.DeepEqual(*installed, []string{"Outdated"}) {
+		t.Errorf("expected only Outdated to be updated, got %v", *installed)
+	}
+	if result.Count(OutcomeNotNeeded) != 1 || result.Items[0].Name != "NotInstalled" {
+		t.Errorf("expected NotInstalled not to need an update, got %+v", result.Items)
+	}
+}
+
+// TestUpdatesStatusError validates an update is skipped when its status cannot be checked
+func TestUpdatesStatusError(t *testing.T) {
+	installed := recordInstalls(t)
+
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		return true, errors.New("registry unavailable")
+	}
+
+	result := Updates(context.Background(), []string{"App"}, testCatalogs(testItem("App")), config.Configuration{})
+
+	if len(*installed) != 0 {
+		t.Errorf("expected no updates, got %v", *installed)
+	}
+	if len(result.Items) != 1 || result.Items[0].Outcome != OutcomeSkipped || result.Items[0].Err == nil {
+		t.Errorf("expected App skipped with the status error, got %+v", result.Items)
+	}
+}
+
+// TestForceInstalls validates only the items past their force_install_after_date are installed, with their dependencies
+func TestForceInstalls(t *testing.T) {
+	installed := recordInstalls(t)
+	patch := testItem("Patch", "Runtime")
+	patch.ForceInstallAfter = "2000-01-01T00:00:00Z"
+	later := testItem("Later")
+	later.ForceInstallAfter = "2999-01-01T00:00:00Z"
+	catalogs := testCatalogs(patch, later, testItem("Runtime"), testItem("App"))
+
+	ForceInstalls(context.Background(), []string{"App", "Patch", "Later"}, []string{"App"}, catalogs, config.Configuration{})
+
+	expected := []string{"Runtime", "Patch"}
+	if !reflect.DeepEqual(*installed, expected) {
+		t.Errorf("expected installs %v, got %v", expected, *installed)
+	}
+}
+
+// TestFirstItemPriority validates the first catalog wins, even over a newer version in a later catalog
+func TestFirstItemPriority(t *testing.T) {
+	production, candidate := testItem("App"), testItem("App")
+	production.Version, candidate.Version = "1.0", "2.0"
+	broken := catalog.Item{Name: "Tool", Version: "3.0"}
+	tool := testItem("Tool")
+	tool.Version = "1.0"
+	catalogs := map[int]map[string]catalog.Item{
+		1: {"App": production, "Tool": broken},
+		2: {"App": candidate, "Tool": tool},
+	}
+
+	item, err := firstItem("App", catalogs)
+	if err != nil || item.Version != "1.0" {
+		t.Errorf("expected App 1.0 from the first catalog, got %s %v", item.Version, err)
+	}
+	if !shadowWarned["App\x002\x002.0"] {
+		t.Errorf("expected the newer App in the second catalog to be warned about")
+	}
+
+	// An entry without an installer doesn't shadow the next catalog
+	item, err = firstItem("Tool", catalogs)
+	if err != nil || item.Version != "1.0" {
+		t.Errorf("expected Tool 1.0 from the second catalog, got %s %v", item.Version, err)
+	}
+
+	entries := Resolution("Tool", catalogs)
+	if len(entries) != 2 || entries[0].Priority != 1 || entries[0].Valid || !entries[1].Valid {
+		t.Errorf("unexpected resolution: %+v", entries)
+	}
+}
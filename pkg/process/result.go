@@ -0,0 +1,84 @@
+package process
+
+import (
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+)
+
+// Outcome is what became of an item in a run
+type Outcome string
+
+const (
+	// OutcomeSucceeded is an item that was installed, uninstalled or updated
+	OutcomeSucceeded Outcome = "succeeded"
+	// OutcomeFailed is an item whose installer, uninstaller or verification failed
+	OutcomeFailed Outcome = "failed"
+	// OutcomeSkipped is an item that was not acted on, the reason says why
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomePending is an item that needs action in a check only run
+	OutcomePending Outcome = "pending"
+	// OutcomeNotNeeded is an item that is already installed, uninstalled or up to date
+	OutcomeNotNeeded Outcome = "not_needed"
+)
+
+// ItemResult is the outcome of one item
+type ItemResult struct {
+	Name    string
+	Version string
+	// Action is install, uninstall or update
+	Action  string
+	Outcome Outcome
+	// Reason is why an item was skipped or failed
+	Reason   string
+	Err      error
+	Duration time.Duration
+
+	// item is the catalog item, for the pending actions of a check only run and the install record
+	item catalog.Item
+}
+
+// ProcessResult is what became of each item Installs, Uninstalls and Updates were given, in order
+type ProcessResult struct {
+	Items []ItemResult
+}
+
+// add appends the outcome of an item, to a result that can be nil when nobody needs it
+func (r *ProcessResult) add(item ItemResult) {
+	if r == nil {
+		return
+	}
+	r.Items = append(r.Items, item)
+}
+
+// Merge appends the items of another result, to accumulate the results of a run
+func (r *ProcessResult) Merge(other ProcessResult) {
+	r.Items = append(r.Items, other.Items...)
+}
+
+// Count returns how many items had the outcome
+func (r ProcessResult) Count(outcome Outcome) int {
+	count := 0
+	for _, item := range r.Items {
+		if item.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+// CountAction returns how many items of an action, such as uninstall, had the outcome
+func (r ProcessResult) CountAction(action string, outcome Outcome) int {
+	count := 0
+	for _, item := range r.Items {
+		if item.Action == action && item.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+// Failed returns true if any item failed
+func (r ProcessResult) Failed() bool {
+	return r.Count(OutcomeFailed) > 0
+}
@@ -0,0 +1,84 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// TestInstallsResult validates the result counts the items installed, failed, skipped and not needed
+func TestInstallsResult(t *testing.T) {
+	clock := time.Date(2024, 7, 9, 12, 0, 0, 0, time.UTC)
+	fakeFailures(t, &clock, map[string]bool{"Broken": true})
+	useMachine(t, testMachine{arch: "x64", osVersion: "10.0.22631", loggedOn: true})
+
+	// Current is already installed, Unchecked can't be checked and Blocked is left by the installer
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		switch item.Name {
+		case "Current":
+			return false, nil
+		case "Unchecked":
+			return false, errors.New("registry unavailable")
+		}
+		return true, nil
+	}
+	origInstall := installerInstallChecked
+	installerInstallChecked = func(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) string {
+		if item.Name == "Blocked" {
+			return "Blocking apps running"
+		}
+		return origInstall(ctx, item, installerType, cfg, actionNeeded)
+	}
+	arm := testItem("ArmOnly")
+	arm.SupportedArch = []string{"arm64"}
+	catalogs := testCatalogs(testItem("Working"), testItem("Broken"), testItem("Current"), testItem("Unchecked"), testItem("Blocked"), arm)
+
+	result := Installs(context.Background(), []string{"Working", "Broken", "Current", "Unchecked", "Blocked", "ArmOnly"}, catalogs, config.Configuration{})
+
+	counts := map[Outcome]int{OutcomeSucceeded: 1, OutcomeFailed: 1, OutcomeSkipped: 3, OutcomeNotNeeded: 1, OutcomePending: 0}
+	for outcome, expected := range counts {
+		if got := result.Count(outcome); got != expected {
+			t.Errorf("expected %d %s, got %d: %+v", expected, outcome, got, result.Items)
+		}
+	}
+	if !result.Failed() {
+		t.Errorf("expected the result to have a failure")
+	}
+	reasons := make(map[string]ItemResult)
+	for _, item := range result.Items {
+		reasons[item.Name] = item
+	}
+	if item := reasons["Broken"]; item.Err == nil || item.Err.Error() != "exit status 1603" {
+		t.Errorf("expected the installer error for Broken, got %+v", item)
+	}
+	if item := reasons["Blocked"]; item.Reason != "Blocking apps running" {
+		t.Errorf("expected the installer's reason for Blocked, got %+v", item)
+	}
+	if item := reasons["Unchecked"]; item.Reason != "unable to check status" || item.Err == nil {
+		t.Errorf("expected the status error for Unchecked, got %+v", item)
+	}
+	if item := reasons["ArmOnly"]; item.Outcome != OutcomeSkipped || item.Reason != "supports arm64, this machine is x64" {
+		t.Errorf("expected ArmOnly skipped for its architecture, got %+v", item)
+	}
+}
+
+// TestResultMerge validates the results of a run are accumulated and counted by action
+func TestResultMerge(t *testing.T) {
+	var run ProcessResult
+	run.Merge(ProcessResult{Items: []ItemResult{{Name: "App", Action: "install", Outcome: OutcomeSucceeded}}})
+	run.Merge(ProcessResult{Items: []ItemResult{
+		{Name: "Old", Action: "uninstall", Outcome: OutcomeSucceeded},
+		{Name: "Tool", Action: "update", Outcome: OutcomeNotNeeded},
+	}})
+
+	if len(run.Items) != 3 || run.CountAction("uninstall", OutcomeSucceeded) != 1 || run.Count(OutcomeSucceeded) != 2 {
+		t.Errorf("unexpected result: %+v", run.Items)
+	}
+	if run.Failed() {
+		t.Errorf("expected no failures")
+	}
+}
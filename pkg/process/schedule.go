@@ -0,0 +1,87 @@
+package process
+
+import (
+	"sync"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// DefaultConcurrentScriptInstalls is how many ps1, script and nupkg items install at once
+// unless `MaxConcurrentScriptInstalls` is set
+const DefaultConcurrentScriptInstalls = 2
+
+// concurrentTypes are the installer types whose items can install alongside each other.
+// Windows Installer runs one install at a time, so msi items, and exe installers that
+// are often msi underneath, install on their own.
+var concurrentTypes = map[string]bool{"ps1": true, "script": true, "nupkg": true}
+
+// installsConcurrently returns true for an item that can install alongside other items
+func installsConcurrently(item catalog.Item, installType string) bool {
+	if installType == "uninstall" {
+		return concurrentTypes[item.Uninstaller.Type]
+	}
+	return concurrentTypes[item.Installer.Type]
+}
+
+// concurrentScriptInstalls returns how many ps1, script and nupkg items install at once
+func concurrentScriptInstalls(cfg config.Configuration) int {
+	if cfg.MaxConcurrentScriptInstalls > 0 {
+		return cfg.MaxConcurrentScriptInstalls
+	}
+	return DefaultConcurrentScriptInstalls
+}
+
+// schedule runs each planned item with run and returns the results in the plan order.
+// Items start in the plan order, each after the items before it that it depends on have
+// finished. ps1, script and nupkg items run up to MaxConcurrentScriptInstalls at once, any other
+// item runs on its own, once the items started before it have finished. Items that need
+// no action are run right away, and check only runs, which install nothing, run one at a time.
+func schedule(planned []plannedItem, installType string, cfg config.Configuration, run func(plannedItem) ItemResult) []ItemResult {
+	results := make([]ItemResult, len(planned))
+	limit := concurrentScriptInstalls(cfg)
+	if cfg.CheckOnly {
+		limit = 1
+	}
+
+	// finished is closed once the item at the same index has finished
+	finished := make([]chan struct{}, len(planned))
+	indexes := make(map[string]int, len(planned))
+	for i, p := range planned {
+		finished[i] = make(chan struct{})
+		if _, ok := indexes[p.item.Name]; !ok {
+			indexes[p.item.Name] = i
+		}
+	}
+
+	slots := make(chan struct{}, limit)
+	var running sync.WaitGroup
+	for i, p := range planned {
+		if p.err != nil || !p.actionNeeded || limit == 1 || !installsConcurrently(p.item, installType) {
+			if p.err == nil && p.actionNeeded {
+				running.Wait()
+			}
+			results[i] = run(p)
+			close(finished[i])
+			continue
+		}
+
+		for _, dependency := range p.item.Dependencies {
+			if j, ok := indexes[dependency]; ok && j < i {
+				<-finished[j]
+			}
+		}
+		slots <- struct{}{}
+		logging.Debug("Starting alongside other items:", p.item.Name, p.item.Version)
+		running.Add(1)
+		go func(i int, p plannedItem) {
+			defer running.Done()
+			defer close(finished[i])
+			defer func() { <-slots }()
+			results[i] = run(p)
+		}(i, p)
+	}
+	running.Wait()
+	return results
+}
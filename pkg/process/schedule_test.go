@@ -0,0 +1,115 @@
+package process
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// scriptItem returns a valid ps1 catalog item with the given dependencies
+func scriptItem(name string, dependencies ...string) catalog.Item {
+	item := testItem(name, dependencies...)
+	item.Installer = catalog.InstallerItem{Type: "ps1", Location: "scripts/" + name + ".ps1"}
+	return item
+}
+
+// overlapInstaller is a fake installer that records which items were installing at the same time
+type overlapInstaller struct {
+	mu       sync.Mutex
+	running  map[string]bool
+	finished map[string]bool
+	overlaps map[string][]string
+	order    []string
+}
+
+// use overrides the installer and status check for the duration of the test. Every item
+// installs for a moment, so the items that can overlap do.
+func (f *overlapInstaller) use(t *testing.T) {
+	f.running, f.finished, f.overlaps = make(map[string]bool), make(map[string]bool), make(map[string][]string)
+	origInstall, origCheck, origPath := installerInstallChecked, statusCheckStatus, failuresPath
+	t.Cleanup(func() { installerInstallChecked, statusCheckStatus, failuresPath = origInstall, origCheck, origPath })
+	failuresPath = t.TempDir() + "/ItemFailures.yaml"
+	statusCheckStatus = func(item catalog.Item, installType, cachePath string) (bool, error) {
+		return true, nil
+	}
+	installerInstallChecked = func(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) string {
+		f.mu.Lock()
+		for name := range f.running {
+			f.overlaps[item.Name] = append(f.overlaps[item.Name], name)
+			f.overlaps[name] = append(f.overlaps[name], item.Name)
+		}
+		f.running[item.Name] = true
+		f.order = append(f.order, item.Name)
+		f.mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		f.mu.Lock()
+		delete(f.running, item.Name)
+		f.finished[item.Name] = true
+		f.mu.Unlock()
+		return ""
+	}
+}
+
+// TestScheduleSerialMsi validates msi and exe items never install alongside another item,
+// while script and nupkg items do, and the results keep the plan order
+func TestScheduleSerialMsi(t *testing.T) {
+	fake := &overlapInstaller{}
+	fake.use(t)
+
+	nupkg := testItem("Git")
+	nupkg.Installer = catalog.InstallerItem{Type: "nupkg", Location: "packages/git.nupkg"}
+	exe := testItem("Zoom")
+	exe.Installer.Type = "exe"
+	catalogs := testCatalogs(scriptItem("Fonts"), scriptItem("Printers"), nupkg, testItem("Office"), exe, testItem("Chrome"), scriptItem("Wallpaper"))
+	names := []string{"Fonts", "Printers", "Git", "Office", "Zoom", "Chrome", "Wallpaper"}
+
+	result := Installs(context.Background(), names, catalogs, config.Configuration{MaxConcurrentScriptInstalls: 3})
+
+	for _, name := range []string{"Office", "Zoom", "Chrome"} {
+		if overlaps := fake.overlaps[name]; len(overlaps) > 0 {
+			t.Errorf("%s installed alongside %v", name, overlaps)
+		}
+	}
+	if len(fake.overlaps["Fonts"]) == 0 || len(fake.overlaps["Git"]) == 0 {
+		t.Errorf("expected the script and nupkg items to install together, got %v", fake.overlaps)
+	}
+	if len(result.Items) != len(names) {
+		t.Fatalf("expected %d results, got %+v", len(names), result.Items)
+	}
+	for i, name := range names {
+		if result.Items[i].Name != name {
+			t.Errorf("expected the results in the plan order, got %s at %d", result.Items[i].Name, i)
+		}
+	}
+}
+
+// TestScheduleDependencies validates a script item waits for the items it depends on,
+// and scripts install one at a time when MaxConcurrentScriptInstalls is 1
+func TestScheduleDependencies(t *testing.T) {
+	fake := &overlapInstaller{}
+	fake.use(t)
+	catalogs := testCatalogs(scriptItem("Runtime"), scriptItem("Agent", "Runtime"), scriptItem("Fonts"))
+
+	Installs(context.Background(), []string{"Agent", "Fonts"}, catalogs, config.Configuration{MaxConcurrentScriptInstalls: 4})
+	for _, name := range fake.overlaps["Agent"] {
+		if name == "Runtime" {
+			t.Errorf("Agent installed alongside its dependency, in the order %v", fake.order)
+		}
+	}
+	if len(fake.order) != 3 || fake.order[0] != "Runtime" {
+		t.Errorf("expected Runtime first, got %v", fake.order)
+	}
+
+	serial := &overlapInstaller{}
+	serial.use(t)
+	Installs(context.Background(), []string{"Runtime", "Fonts"}, catalogs, config.Configuration{MaxConcurrentScriptInstalls: 1})
+	if len(serial.overlaps) != 0 {
+		t.Errorf("expected one install at a time, got %v", serial.overlaps)
+	}
+}
@@ -0,0 +1,32 @@
+package process
+
+import (
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+var (
+	// This abstraction allows us to override when testing
+	consoleUser = status.ActiveConsoleUser
+)
+
+// scopedItems returns the items that can be checked now. User scoped items are installed
+// for the logged on user, so they are skipped, reported and added to result when nobody is logged on.
+func scopedItems(items []catalog.Item, installType string, result *ProcessResult) []catalog.Item {
+	var scoped []catalog.Item
+	userChecked, userLoggedOn := false, false
+	for _, item := range items {
+		if status.UserScoped(item) {
+			if !userChecked {
+				_, userLoggedOn = consoleUser()
+				userChecked = true
+			}
+			if !userLoggedOn {
+				skip(item, installType, "installs for the logged on user, and no user is logged on", result)
+				continue
+			}
+		}
+		scoped = append(scoped, item)
+	}
+	return scoped
+}
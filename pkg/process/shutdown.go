@@ -0,0 +1,33 @@
+package process
+
+import (
+	"context"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// shuttingDown returns true once ctx is cancelled, recording the item that needed action
+// as skipped and still pending, so no new item starts while Gorilla shuts down
+func shuttingDown(ctx context.Context, item catalog.Item) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	logging.Warn("Skipped while shutting down:", item.Name, item.Version)
+	report.RecordShutdownSkipped(item)
+	report.RecordPending(item)
+	return true
+}
+
+// diskFilled returns the error of the download that filled the disk, recording the item
+// that needed action as pending, so no new item starts to fail the same way
+func diskFilled(item catalog.Item) error {
+	err := downloadDiskFull()
+	if err == nil {
+		return nil
+	}
+	logging.Warn("Skipped after the disk filled:", item.Name, item.Version)
+	report.RecordPending(item)
+	return err
+}
@@ -0,0 +1,98 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/report"
+)
+
+// cancelAfter cancels the run once the named item is installed
+func cancelAfter(t *testing.T, name string) (context.Context, *[]string) {
+	installed := recordInstalls(t)
+	t.Cleanup(func() { report.ShutdownSkippedItems, report.PendingItems = nil, nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	recordInstall := installerInstallChecked
+	installerInstallChecked = func(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) string {
+		result := recordInstall(ctx, item, installerType, cfg, actionNeeded)
+		if item.Name == name {
+			cancel()
+		}
+		return result
+	}
+	return ctx, installed
+}
+
+// TestInstallsShutdown validates no new item starts once the run is cancelled,
+// and the items left are reported as skipped
+func TestInstallsShutdown(t *testing.T) {
+	ctx, installed := cancelAfter(t, "Runtime")
+	catalogs := testCatalogs(testItem("App", "Runtime"), testItem("Runtime"), testItem("Tool"))
+
+	Installs(ctx, []string{"App", "Tool"}, catalogs, config.Configuration{})
+
+	if !reflect.DeepEqual(*installed, []string{"Runtime"}) {
+		t.Errorf("expected only Runtime installed, got %v", *installed)
+	}
+	if len(report.ShutdownSkippedItems) != 2 || len(report.PendingItems) != 2 {
+		t.Errorf("expected App and Tool skipped and pending, got %v", report.ShutdownSkippedItems)
+	}
+}
+
+// TestInstallPendingShutdown validates the pending set is kept for the items a shutdown left
+func TestInstallPendingShutdown(t *testing.T) {
+	ctx, installed := cancelAfter(t, "Runtime")
+	cfg := config.Configuration{CachePath: t.TempDir()}
+	pending := Pending{Installs: []catalog.Item{testItem("Runtime"), testItem("App")}}
+	if err := SavePending(cfg.CachePath, pending); err != nil {
+		t.Fatalf("SavePending failed: %v", err)
+	}
+
+	InstallPending(ctx, pending, cfg)
+
+	if !reflect.DeepEqual(*installed, []string{"Runtime"}) {
+		t.Errorf("expected only Runtime installed, got %v", *installed)
+	}
+	if _, err := os.Stat(PendingPath(cfg.CachePath)); err != nil {
+		t.Errorf("expected the pending set to be kept, got %v", err)
+	}
+}
+
+// TestInstallsDiskFull validates no new item starts once a download fills the disk,
+// and the items left are skipped as pending
+func TestInstallsDiskFull(t *testing.T) {
+	installed := recordInstalls(t)
+	t.Cleanup(func() { report.PendingItems = nil })
+	origDiskFull := downloadDiskFull
+	t.Cleanup(func() { downloadDiskFull = origDiskFull })
+	var diskErr error
+	downloadDiskFull = func() error { return diskErr }
+	recordInstall := installerInstallChecked
+	installerInstallChecked = func(ctx context.Context, item catalog.Item, installerType string, cfg config.Configuration, actionNeeded bool) string {
+		diskErr = errors.New("disk full while downloading Runtime.msi")
+		return recordInstall(ctx, item, installerType, cfg, actionNeeded)
+	}
+	catalogs := testCatalogs(testItem("App", "Runtime"), testItem("Runtime"), testItem("Tool"))
+
+	result := Installs(context.Background(), []string{"App", "Tool"}, catalogs, config.Configuration{})
+
+	if !reflect.DeepEqual(*installed, []string{"Runtime"}) {
+		t.Errorf("expected only Runtime installed, got %v", *installed)
+	}
+	var skipped int
+	for _, item := range result.Items {
+		if item.Outcome == OutcomeSkipped && item.Reason == "disk full" {
+			skipped++
+		}
+	}
+	if skipped != 2 || len(report.PendingItems) != 2 {
+		t.Errorf("expected App and Tool skipped and pending, got %+v", result.Items)
+	}
+}
@@ -0,0 +1,223 @@
+package process
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/report"
+	"github.com/windowsadmins/gorilla/pkg/status"
+)
+
+// testMachine is the machine items are checked on
+type testMachine struct {
+	arch      string
+	osVersion string
+	loggedOn  bool
+}
+
+// useMachine checks items on the machine for the duration of the test, with no warnings reported yet
+func useMachine(t *testing.T, machine testMachine) {
+	origArch, origVersion, origUser := machineArch, machineOSVersion, consoleUser
+	t.Cleanup(func() {
+		machineArch, machineOSVersion, consoleUser = origArch, origVersion, origUser
+		report.Warnings = nil
+	})
+	machineArch = func() string { return machine.arch }
+	machineOSVersion = func() string { return machine.osVersion }
+	consoleUser = func() (status.ConsoleUser, bool) {
+		return status.ConsoleUser{Name: `EXAMPLE\jdoe`, SID: "S-1-5-21-1000"}, machine.loggedOn
+	}
+	report.Warnings = nil
+}
+
+// archCatalogs returns items with empty, matching and non-matching architectures,
+// checked on an x86_64 machine
+func archCatalogs(t *testing.T) map[int]map[string]catalog.Item {
+	useMachine(t, testMachine{arch: "x86_64", osVersion: "10.0.22631", loggedOn: true})
+
+	anyArch := testItem("AnyArch")
+	matching := testItem("Matching")
+	matching.SupportedArch = []string{"x86", "x64"}
+	other := testItem("ArmOnly")
+	other.SupportedArch = []string{"arm64"}
+	return testCatalogs(anyArch, matching, other)
+}
+
+// checkArchSkips validates ArmOnly was skipped and reported, and the others processed
+func checkArchSkips(t *testing.T, processed []string, result ProcessResult) {
+	t.Helper()
+	if !reflect.DeepEqual(processed, []string{"AnyArch", "Matching"}) {
+		t.Errorf("expected AnyArch and Matching, got %v", processed)
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "ArmOnly: supports arm64, this machine is x86_64") {
+		t.Errorf("unexpected warnings: %v", report.Warnings)
+	}
+	if len(result.Items) == 0 || result.Items[0].Name != "ArmOnly" || result.Items[0].Outcome != OutcomeSkipped {
+		t.Errorf("expected ArmOnly in the result as skipped, got %+v", result.Items)
+	}
+}
+
+// TestInstallsArchitecture validates installs are skipped on unsupported architectures
+func TestInstallsArchitecture(t *testing.T) {
+	installed := recordInstalls(t)
+	catalogs := archCatalogs(t)
+
+	result := Installs(context.Background(), []string{"AnyArch", "Matching", "ArmOnly"}, catalogs, config.Configuration{})
+	checkArchSkips(t, *installed, result)
+}
+
+// TestUninstallsArchitecture validates uninstalls are skipped on unsupported architectures
+func TestUninstallsArchitecture(t *testing.T) {
+	uninstalled := recordInstalls(t)
+	catalogs := archCatalogs(t)
+
+	result := Uninstalls(context.Background(), []string{"AnyArch", "Matching", "ArmOnly"}, catalogs, config.Configuration{})
+	checkArchSkips(t, *uninstalled, result)
+}
+
+// TestUpdatesArchitecture validates updates are skipped on unsupported architectures
+func TestUpdatesArchitecture(t *testing.T) {
+	updated := recordInstalls(t)
+	catalogs := archCatalogs(t)
+
+	result := Updates(context.Background(), []string{"AnyArch", "Matching", "ArmOnly"}, catalogs, config.Configuration{})
+	checkArchSkips(t, *updated, result)
+}
+
+// TestNormalizeArch validates the names used for architectures by different tools
+func TestNormalizeArch(t *testing.T) {
+	tests := map[string]string{
+		"AMD64":  "x86_64",
+		"x64":    "x86_64",
+		"x86_64": "x86_64",
+		"x86":    "x86",
+		"386":    "x86",
+		"ARM64":  "arm64",
+	}
+	for arch, expected := range tests {
+		if normalized := normalizeArch(arch); normalized != expected {
+			t.Errorf("%s: expected %s, got %s", arch, expected, normalized)
+		}
+	}
+}
+
+// osVersionCatalogs returns items limited to other versions of Windows, checked on Windows 11 23H2
+func osVersionCatalogs(t *testing.T) map[int]map[string]catalog.Item {
+	useMachine(t, testMachine{arch: "x86_64", osVersion: "10.0.22631", loggedOn: true})
+
+	anyVersion := testItem("AnyVersion")
+	windows11 := testItem("Windows11")
+	windows11.MinimumOSVersion = "10.0.22000"
+	newerBuild := testItem("NewerBuild")
+	newerBuild.MinimumOSVersion = "10.0.26100"
+	windows10 := testItem("Windows10")
+	windows10.MaximumOSVersion = "10.0.19045"
+	return testCatalogs(anyVersion, windows11, newerBuild, windows10)
+}
+
+// TestInstallsOSVersion validates installs are skipped and reported outside their OS versions
+func TestInstallsOSVersion(t *testing.T) {
+	installed := recordInstalls(t)
+	catalogs := osVersionCatalogs(t)
+
+	result := Installs(context.Background(), []string{"AnyVersion", "Windows11", "NewerBuild", "Windows10"}, catalogs, config.Configuration{})
+	if !reflect.DeepEqual(*installed, []string{"AnyVersion", "Windows11"}) {
+		t.Errorf("expected AnyVersion and Windows11, got %v", *installed)
+	}
+	expected := []string{
+		"Skipped NewerBuild: requires Windows 10.0.26100 or later, this machine is 10.0.22631",
+		"Skipped Windows10: supports Windows up to 10.0.19045, this machine is 10.0.22631",
+	}
+	if !reflect.DeepEqual(report.Warnings, expected) {
+		t.Errorf("expected warnings %v, got %v", expected, report.Warnings)
+	}
+	if result.Count(OutcomeSkipped) < 2 || result.Items[0].Name != "NewerBuild" || result.Items[1].Name != "Windows10" {
+		t.Errorf("expected NewerBuild and Windows10 in the result as skipped, got %+v", result.Items)
+	}
+}
+
+// TestUninstallsOSVersion validates uninstalls are not limited by the OS versions
+func TestUninstallsOSVersion(t *testing.T) {
+	uninstalled := recordInstalls(t)
+	catalogs := osVersionCatalogs(t)
+
+	Uninstalls(context.Background(), []string{"NewerBuild", "Windows10"}, catalogs, config.Configuration{})
+	if !reflect.DeepEqual(*uninstalled, []string{"NewerBuild", "Windows10"}) {
+		t.Errorf("expected NewerBuild and Windows10, got %v", *uninstalled)
+	}
+	if len(report.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", report.Warnings)
+	}
+}
+
+// TestOSVersionSkip validates the comparison of OS versions, and that an unknown version skips nothing
+func TestOSVersionSkip(t *testing.T) {
+	item := testItem("Example")
+	item.MinimumOSVersion = "10.0.22000"
+	item.MaximumOSVersion = "10.0.22631"
+
+	tests := map[string]string{
+		"10.0.19045": "requires Windows 10.0.22000 or later",
+		"10.0.22000": "",
+		"10.0.22631": "",
+		"10.0.26100": "supports Windows up to 10.0.22631",
+		"":           "",
+	}
+	for osVersion, expected := range tests {
+		reason := osVersionSkip(item, osVersion)
+		if (expected == "") != (reason == "") || !strings.HasPrefix(reason, expected) {
+			t.Errorf("%q: expected %q, got %q", osVersion, expected, reason)
+		}
+	}
+
+	item.MinimumOSVersion = "Windows 11"
+	if reason := osVersionSkip(item, "10.0.22631"); reason != "" {
+		t.Errorf("expected an invalid version not to skip the item, got %q", reason)
+	}
+}
+
+// scopeCatalogs returns a machine and a user scoped item, with a user logged on or not
+func scopeCatalogs(t *testing.T, loggedOn bool) map[int]map[string]catalog.Item {
+	useMachine(t, testMachine{arch: "x86_64", osVersion: "10.0.22631", loggedOn: loggedOn})
+
+	userItem := testItem("VSCodeUser")
+	userItem.InstallScope = status.ScopeUser
+	return testCatalogs(testItem("Machine"), userItem)
+}
+
+// TestInstallsUserScopeNoUser validates user scoped items are skipped and reported when nobody is logged on
+func TestInstallsUserScopeNoUser(t *testing.T) {
+	installed := recordInstalls(t)
+	catalogs := scopeCatalogs(t, false)
+
+	result := Installs(context.Background(), []string{"Machine", "VSCodeUser"}, catalogs, config.Configuration{})
+
+	if !reflect.DeepEqual(*installed, []string{"Machine"}) {
+		t.Errorf("expected only Machine, got %v", *installed)
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "VSCodeUser: installs for the logged on user") {
+		t.Errorf("unexpected warnings: %v", report.Warnings)
+	}
+	if len(result.Items) != 2 || result.Items[0].Name != "VSCodeUser" || result.Items[0].Outcome != OutcomeSkipped {
+		t.Errorf("expected VSCodeUser in the result as skipped, got %+v", result.Items)
+	}
+}
+
+// TestInstallsUserScopeLoggedOn validates user scoped items are installed while a user is logged on
+func TestInstallsUserScopeLoggedOn(t *testing.T) {
+	installed := recordInstalls(t)
+	catalogs := scopeCatalogs(t, true)
+
+	Installs(context.Background(), []string{"Machine", "VSCodeUser"}, catalogs, config.Configuration{})
+
+	if !reflect.DeepEqual(*installed, []string{"Machine", "VSCodeUser"}) {
+		t.Errorf("expected Machine and VSCodeUser, got %v", *installed)
+	}
+	if len(report.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", report.Warnings)
+	}
+}
@@ -0,0 +1,35 @@
+package process
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// This abstraction allows us to override when testing
+var hostname = os.Hostname
+
+// SplayDelay picks how long an automatic run waits, up to auto_run_splay_seconds. With
+// auto_run_splay_stable the delay is the same every run for a machine, from its hostname.
+func SplayDelay(cfg config.Configuration) time.Duration {
+	if cfg.AutoRunSplaySeconds <= 0 {
+		return 0
+	}
+	seed := timeNow().UnixNano()
+	if cfg.AutoRunSplayStable {
+		name, err := hostname()
+		if err != nil {
+			logging.Warn("Unable to read the hostname for a stable splay", "error", err)
+		}
+		hash := fnv.New64a()
+		hash.Write([]byte(strings.ToLower(name)))
+		seed = int64(hash.Sum64())
+	}
+	splay := int64(cfg.AutoRunSplaySeconds) * int64(time.Second)
+	return time.Duration(rand.New(rand.NewSource(seed)).Int63n(splay + 1)).Round(time.Second)
+}
@@ -0,0 +1,54 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// useHostname reports the hostname for the duration of the test
+func useHostname(t *testing.T, name string) {
+	origHostname := hostname
+	t.Cleanup(func() { hostname = origHostname })
+	hostname = func() (string, error) { return name, nil }
+}
+
+// TestSplayDelayStable validates a stable splay is the same for a hostname in any case,
+// and stays within auto_run_splay_seconds
+func TestSplayDelayStable(t *testing.T) {
+	cfg := config.Configuration{AutoRunSplaySeconds: 600, AutoRunSplayStable: true}
+	useHostname(t, "LAB-PC-01")
+	delay := SplayDelay(cfg)
+	if delay < 0 || delay > 10*time.Minute {
+		t.Errorf("expected a delay of at most 10 minutes, got %s", delay)
+	}
+	if again := SplayDelay(cfg); again != delay {
+		t.Errorf("expected the same delay every run, got %s then %s", delay, again)
+	}
+
+	useHostname(t, "lab-pc-01")
+	if lower := SplayDelay(cfg); lower != delay {
+		t.Errorf("expected the hostname case ignored, got %s and %s", delay, lower)
+	}
+}
+
+// TestSplayDelayBound validates the random splay stays within auto_run_splay_seconds,
+// and there is none when it is unset
+func TestSplayDelayBound(t *testing.T) {
+	origNow := timeNow
+	t.Cleanup(func() { timeNow = origNow })
+	clock := time.Date(2024, 7, 9, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return clock }
+
+	cfg := config.Configuration{AutoRunSplaySeconds: 30}
+	for i := 0; i < 100; i++ {
+		clock = clock.Add(time.Nanosecond)
+		if delay := SplayDelay(cfg); delay < 0 || delay > 30*time.Second || delay%time.Second != 0 {
+			t.Fatalf("expected whole seconds up to 30, got %s", delay)
+		}
+	}
+	if delay := SplayDelay(config.Configuration{AutoRunSplayStable: true}); delay != 0 {
+		t.Errorf("expected no delay without auto_run_splay_seconds, got %s", delay)
+	}
+}
@@ -0,0 +1,193 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// Event is written as a line of JSON for the UIs that wrap managedsoftwareupdate
+type Event struct {
+	Event        string   `json:"event"`
+	Time         string   `json:"time"`
+	Run          string   `json:"run,omitempty"`
+	Item         string   `json:"item,omitempty"`
+	Version      string   `json:"version,omitempty"`
+	Action       string   `json:"action,omitempty"`
+	ActionNeeded *bool    `json:"action_needed,omitempty"`
+	Percent      *int     `json:"percent,omitempty"`
+	Status       string   `json:"status,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Summary      *Summary `json:"summary,omitempty"`
+}
+
+// Summary is the outcome of a run, sent with run_finished
+type Summary struct {
+	ExitCode    int `json:"exit_code"`
+	Installed   int `json:"installed"`
+	Uninstalled int `json:"uninstalled"`
+	Failed      int `json:"failed"`
+	Pending     int `json:"pending"`
+}
+
+var (
+	// sink is where the events are written, nil unless --progress-pipe is set
+	sink io.WriteCloser
+
+	// downloads are the items the downloads under way are reported for, by URL,
+	// as items installed at the same time each download their own file
+	downloads = make(map[string]downloadItem)
+
+	// mu guards the sink and the downloads, items are checked and installed concurrently
+	mu sync.Mutex
+
+	// This abstraction allows us to override when testing
+	now = time.Now
+)
+
+// Open starts writing events to a file, or to a named pipe such as `\\.\pipe\gorilla`
+// that a UI is listening on
+func Open(path string) error {
+	flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+	if strings.HasPrefix(path, `\\.\pipe\`) {
+		// A pipe is opened as it is, only its server creates it
+		flags = os.O_WRONLY
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	sink = f
+	return nil
+}
+
+// Close stops writing events
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if sink != nil {
+		sink.Close()
+		sink = nil
+	}
+}
+
+// Enabled returns true when events are written, so callers can skip preparing them
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return sink != nil
+}
+
+// emit writes an event. A UI that goes away doesn't stop the run, the events just stop.
+func emit(e Event) {
+	mu.Lock()
+	defer mu.Unlock()
+	if sink == nil {
+		return
+	}
+	e.Time = now().UTC().Format(time.RFC3339)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if _, err := sink.Write(append(data, '\n')); err != nil {
+		logging.Warn("Unable to write progress events, no more will be sent", "error", err)
+		sink.Close()
+		sink = nil
+	}
+}
+
+// RunStarted is sent once the run starts checking items
+func RunStarted(run string) {
+	emit(Event{Event: "run_started", Run: run})
+}
+
+// ItemEvaluated is sent once the status of an item is checked
+func ItemEvaluated(name, itemVersion, action string, actionNeeded bool, err error) {
+	e := Event{Event: "item_evaluated", Item: name, Version: itemVersion, Action: action, ActionNeeded: &actionNeeded}
+	if err != nil {
+		e.Error = err.Error()
+		e.ActionNeeded = nil
+	}
+	emit(e)
+}
+
+// downloadItem is the item a download is for
+type downloadItem struct {
+	name, version string
+}
+
+// Track reports the downloads of url for an item, until the returned function is called
+func Track(url, name, itemVersion string) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	downloads[url] = downloadItem{name: name, version: itemVersion}
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(downloads, url)
+	}
+}
+
+// InstallStarted is sent before an item is installed, updated or uninstalled
+func InstallStarted(name, itemVersion, action string) {
+	emit(Event{Event: "install_started", Item: name, Version: itemVersion, Action: action})
+}
+
+// InstallFinished is sent after an item is installed, updated or uninstalled,
+// with a status of success, failed, skipped or interrupted
+func InstallFinished(name, itemVersion, action, status string) {
+	emit(Event{Event: "install_finished", Item: name, Version: itemVersion, Action: action, Status: status})
+}
+
+// RunFinished is sent when the run ends, with its summary
+func RunFinished(run string, summary Summary, runErr error) {
+	e := Event{Event: "run_finished", Run: run, Summary: &summary}
+	if runErr != nil {
+		e.Error = runErr.Error()
+	}
+	emit(e)
+}
+
+// downloadProgress sends the percentage of the download of url, for the item it is tracked for
+func downloadProgress(url string, percent int) {
+	mu.Lock()
+	item := downloads[url]
+	mu.Unlock()
+	emit(Event{Event: "download_progress", Item: item.name, Version: item.version, Percent: &percent})
+}
+
+// Download returns a reader that sends download_progress as r, the download of url, is read,
+// each time another percent of total arrives. done is how much was downloaded before, when resuming.
+func Download(url string, r io.Reader, done, total int64) io.Reader {
+	if total <= 0 || !Enabled() {
+		return r
+	}
+	return &downloadReader{url: url, r: r, done: done, total: total, percent: -1}
+}
+
+// downloadReader counts the bytes of a download
+type downloadReader struct {
+	url         string
+	r           io.Reader
+	done, total int64
+	percent     int
+}
+
+// Read sends download_progress when the percentage changes
+func (d *downloadReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.done += int64(n)
+	if percent := int(d.done * 100 / d.total); percent != d.percent && percent <= 100 {
+		d.percent = percent
+		downloadProgress(d.url, percent)
+	}
+	return n, err
+}
@@ -0,0 +1,188 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bufferSink collects the events, failing writes once broken is set
+type bufferSink struct {
+	bytes.Buffer
+	broken bool
+	closed bool
+}
+
+func (b *bufferSink) Write(p []byte) (int, error) {
+	if b.broken {
+		return 0, errors.New("pipe is being closed")
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *bufferSink) Close() error {
+	b.closed = true
+	return nil
+}
+
+// events decodes the events written so far
+func (b *bufferSink) events(t *testing.T) []Event {
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// useSink writes the events to a buffer for the duration of the test
+func useSink(t *testing.T) *bufferSink {
+	origNow := now
+	t.Cleanup(func() {
+		sink, now = nil, origNow
+		downloads = make(map[string]downloadItem)
+	})
+	now = func() time.Time { return time.Date(2024, 7, 12, 17, 0, 0, 0, time.UTC) }
+	b := &bufferSink{}
+	sink = b
+	return b
+}
+
+// TestEvents validates the events of a run are written as lines of JSON
+func TestEvents(t *testing.T) {
+	b := useSink(t)
+
+	RunStarted("auto")
+	ItemEvaluated("Firefox", "128.0", "install", true, nil)
+	ItemEvaluated("Zoom", "6.1", "install", false, errors.New("no check"))
+	InstallStarted("Firefox", "128.0", "install")
+	untrack := Track("https://repo/Firefox.msi", "Firefox", "128.0")
+	downloadProgress("https://repo/Firefox.msi", 50)
+	untrack()
+	InstallFinished("Firefox", "128.0", "install", "success")
+	downloadProgress("https://repo/Firefox.msi", 100)
+	RunFinished("auto", Summary{Installed: 1}, nil)
+
+	needed, half, full := true, 50, 100
+	expected := []Event{
+		{Event: "run_started", Run: "auto"},
+		{Event: "item_evaluated", Item: "Firefox", Version: "128.0", Action: "install", ActionNeeded: &needed},
+		{Event: "item_evaluated", Item: "Zoom", Version: "6.1", Action: "install", Error: "no check"},
+		{Event: "install_started", Item: "Firefox", Version: "128.0", Action: "install"},
+		{Event: "download_progress", Item: "Firefox", Version: "128.0", Percent: &half},
+		{Event: "install_finished", Item: "Firefox", Version: "128.0", Action: "install", Status: "success"},
+		{Event: "download_progress", Percent: &full},
+		{Event: "run_finished", Run: "auto", Summary: &Summary{Installed: 1}},
+	}
+	events := b.events(t)
+	for i := range events {
+		if events[i].Time != "2024-07-12T17:00:00Z" {
+			t.Errorf("unexpected time: %s", events[i].Time)
+		}
+		events[i].Time = ""
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %+v, got %+v", expected, events)
+	}
+}
+
+// TestDisabled validates nothing is prepared or written without a sink
+func TestDisabled(t *testing.T) {
+	if Enabled() {
+		t.Fatalf("expected no sink")
+	}
+	RunStarted("auto")
+
+	r := strings.NewReader("payload")
+	if Download("https://repo/payload", r, 0, 7) != io.Reader(r) {
+		t.Errorf("expected the download not to be counted")
+	}
+}
+
+// TestDownload validates the progress is sent once per percent, including what was resumed,
+// for the item each download is tracked for when items download at the same time
+func TestDownload(t *testing.T) {
+	b := useSink(t)
+	defer Track("https://repo/Firefox.msi", "Firefox", "128.0")()
+	defer Track("https://repo/Zoom.msi", "Zoom", "6.1")()
+
+	firefox := Download("https://repo/Firefox.msi", strings.NewReader(strings.Repeat("x", 150)), 50, 200)
+	zoom := Download("https://repo/Zoom.msi", strings.NewReader(strings.Repeat("x", 100)), 0, 100)
+	buf := make([]byte, 10)
+	for {
+		_, firefoxErr := firefox.Read(buf)
+		_, zoomErr := zoom.Read(buf)
+		if firefoxErr == io.EOF && zoomErr == io.EOF {
+			break
+		}
+	}
+
+	var percents []int
+	for _, e := range b.events(t) {
+		if e.Event != "download_progress" || e.Percent == nil {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+		if e.Item == "Zoom" && e.Version == "6.1" {
+			continue
+		}
+		if e.Item != "Firefox" || e.Version != "128.0" {
+			t.Fatalf("unexpected item: %+v", e)
+		}
+		percents = append(percents, *e.Percent)
+	}
+	if len(percents) == 0 || percents[len(percents)-1] != 100 {
+		t.Fatalf("expected the download to finish at 100%%, got %v", percents)
+	}
+	for i := 1; i < len(percents); i++ {
+		if percents[i] <= percents[i-1] || percents[0] < 25 {
+			t.Errorf("expected increasing percentages from 25%%, got %v", percents)
+			break
+		}
+	}
+}
+
+// TestBrokenPipe validates a UI that goes away stops the events without failing the run
+func TestBrokenPipe(t *testing.T) {
+	b := useSink(t)
+	b.broken = true
+
+	RunStarted("auto")
+	if Enabled() || !b.closed {
+		t.Errorf("expected the sink to be closed after a failed write")
+	}
+	RunFinished("auto", Summary{}, nil)
+}
+
+// TestOpen validates events are appended to a file
+func TestOpen(t *testing.T) {
+	t.Cleanup(Close)
+	path := filepath.Join(t.TempDir(), "progress.jsonl")
+	for _, run := range []string{"auto", "checkonly"} {
+		if err := Open(path); err != nil {
+			t.Fatal(err)
+		}
+		RunStarted(run)
+		Close()
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("expected 2 events, got %q", data)
+	}
+}
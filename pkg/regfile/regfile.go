@@ -0,0 +1,347 @@
+// Package regfile reads the .reg files regedit exports and applies them to the registry
+package regfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	// ErrMalformed is returned for a file that is not a .reg file regedit could import
+	ErrMalformed = errors.New("malformed .reg file")
+
+	// ErrAccessDenied is returned when the registry refuses a change,
+	// keys such as HKLM\SOFTWARE need SYSTEM or an administrator
+	ErrAccessDenied = errors.New("access denied")
+)
+
+// The types of registry values, numbered as the registry numbers them
+const (
+	TypeNone         uint32 = 0
+	TypeString       uint32 = 1
+	TypeExpandString uint32 = 2
+	TypeBinary       uint32 = 3
+	TypeDWord        uint32 = 4
+	TypeMultiString  uint32 = 7
+	TypeQWord        uint32 = 11
+)
+
+// Key is a section of a .reg file: a key that is created with the values set or deleted in it,
+// or a key that is deleted with all of its subkeys
+type Key struct {
+	Path   string
+	Delete bool
+	Values []Value
+}
+
+// Value is a value set or deleted in a key. The default value of a key has an empty name.
+type Value struct {
+	Name   string
+	Type   uint32
+	Data   []byte // as the registry stores it
+	Delete bool
+}
+
+// rootKeys are the names of the root keys, by their full and short names
+var rootKeys = map[string]string{
+	"HKEY_LOCAL_MACHINE":  "HKEY_LOCAL_MACHINE",
+	"HKLM":                "HKEY_LOCAL_MACHINE",
+	"HKEY_CURRENT_USER":   "HKEY_CURRENT_USER",
+	"HKCU":                "HKEY_CURRENT_USER",
+	"HKEY_CLASSES_ROOT":   "HKEY_CLASSES_ROOT",
+	"HKCR":                "HKEY_CLASSES_ROOT",
+	"HKEY_USERS":          "HKEY_USERS",
+	"HKU":                 "HKEY_USERS",
+	"HKEY_CURRENT_CONFIG": "HKEY_CURRENT_CONFIG",
+	"HKCC":                "HKEY_CURRENT_CONFIG",
+}
+
+// SplitPath splits a key path into the full name of its root key and the subkey under it,
+// so HKLM\SOFTWARE\Example is HKEY_LOCAL_MACHINE and SOFTWARE\Example
+func SplitPath(path string) (string, string, error) {
+	rootName, subkey := path, ""
+	if i := strings.Index(path, `\`); i >= 0 {
+		rootName, subkey = path[:i], strings.Trim(path[i+1:], `\`)
+	}
+	root, ok := rootKeys[strings.ToUpper(strings.TrimSpace(rootName))]
+	if !ok {
+		return "", "", fmt.Errorf("unknown root key %q", rootName)
+	}
+	return root, subkey, nil
+}
+
+// ParseFile reads and parses a .reg file
+func ParseFile(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ApplyFile parses a .reg file and applies it, so a malformed file changes nothing
+func ApplyFile(path string) error {
+	keys, err := ParseFile(path)
+	if err != nil {
+		return err
+	}
+	return Apply(keys)
+}
+
+// Parse parses a .reg file, as regedit exports it in UTF-16 or as REGEDIT4
+func Parse(data []byte) ([]Key, error) {
+	lines := joinLines(decode(data))
+
+	var keys []Key
+	headerFound := false
+	for _, l := range lines {
+		line := strings.TrimSpace(l.text)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if !headerFound {
+			if line != "Windows Registry Editor Version 5.00" && line != "REGEDIT4" {
+				return nil, fmt.Errorf("%w: line %d: expected the Windows Registry Editor header, got %q", ErrMalformed, l.number, line)
+			}
+			headerFound = true
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%w: line %d: unterminated key %q", ErrMalformed, l.number, line)
+			}
+			path := line[1 : len(line)-1]
+			key := Key{Delete: strings.HasPrefix(path, "-")}
+			root, subkey, err := SplitPath(strings.TrimPrefix(path, "-"))
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrMalformed, l.number, err)
+			}
+			if key.Delete && subkey == "" {
+				return nil, fmt.Errorf("%w: line %d: a root key can't be deleted", ErrMalformed, l.number)
+			}
+			key.Path = strings.TrimSuffix(root+`\`+subkey, `\`)
+			keys = append(keys, key)
+			continue
+		}
+
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%w: line %d: value outside of a key", ErrMalformed, l.number)
+		}
+		current := &keys[len(keys)-1]
+		if current.Delete {
+			return nil, fmt.Errorf("%w: line %d: value in a deleted key", ErrMalformed, l.number)
+		}
+		value, err := parseValue(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrMalformed, l.number, err)
+		}
+		current.Values = append(current.Values, value)
+	}
+	if !headerFound {
+		return nil, fmt.Errorf("%w: the file is empty", ErrMalformed)
+	}
+	return keys, nil
+}
+
+// fileLine is a line of a .reg file, with its continuation lines joined, and where it starts
+type fileLine struct {
+	number int
+	text   string
+}
+
+// decode returns the text of a .reg file, which regedit writes as UTF-16 with a byte order mark
+func decode(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+		data = data[2:]
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(data[2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+	return string(bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf}))
+}
+
+// joinLines splits text into lines, joining the lines regedit wraps long hex values onto with a trailing \
+func joinLines(text string) []fileLine {
+	var lines []fileLine
+	var current *fileLine
+	for i, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if current != nil {
+			current.text += strings.TrimSpace(raw)
+		} else {
+			lines = append(lines, fileLine{number: i + 1, text: raw})
+			current = &lines[len(lines)-1]
+		}
+		if trimmed := strings.TrimRight(current.text, " \t"); strings.HasSuffix(trimmed, `\`) && !strings.HasPrefix(strings.TrimSpace(trimmed), "[") {
+			current.text = strings.TrimSuffix(trimmed, `\`)
+			continue
+		}
+		current = nil
+	}
+	return lines
+}
+
+// parseValue parses a `"name"=data` or `@=data` line
+func parseValue(line string) (Value, error) {
+	var value Value
+	var rest string
+	switch {
+	case strings.HasPrefix(line, "@"):
+		rest = line[1:]
+	case strings.HasPrefix(line, `"`):
+		name, n, err := unquote(line)
+		if err != nil {
+			return Value{}, err
+		}
+		value.Name, rest = name, line[n:]
+	default:
+		return Value{}, fmt.Errorf("expected a key or a value, got %q", line)
+	}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "=") {
+		return Value{}, fmt.Errorf("expected = after the name of %q", value.Name)
+	}
+	data := strings.TrimSpace(rest[1:])
+
+	switch {
+	case data == "-":
+		value.Delete = true
+	case strings.HasPrefix(data, `"`):
+		s, n, err := unquote(data)
+		if err != nil {
+			return Value{}, err
+		}
+		if n != len(data) {
+			return Value{}, fmt.Errorf("unexpected %q after the data of %q", data[n:], value.Name)
+		}
+		value.Type, value.Data = TypeString, encodeString(s)
+	case strings.HasPrefix(strings.ToLower(data), "dword:"):
+		n, err := strconv.ParseUint(strings.TrimSpace(data[len("dword:"):]), 16, 32)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid dword for %q: %v", value.Name, err)
+		}
+		value.Type, value.Data = TypeDWord, make([]byte, 4)
+		binary.LittleEndian.PutUint32(value.Data, uint32(n))
+	case strings.HasPrefix(strings.ToLower(data), "hex"):
+		valueType, raw, err := parseHex(data)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid hex for %q: %v", value.Name, err)
+		}
+		value.Type, value.Data = valueType, raw
+	default:
+		return Value{}, fmt.Errorf("unknown data for %q: %q", value.Name, data)
+	}
+	return value, nil
+}
+
+// unquote reads the quoted string s starts with, where \\ and \" are escapes,
+// and returns it and the length of s it took
+func unquote(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '\\' || s[i+1] == '"') {
+				i++
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string %s", s)
+}
+
+// parseHex parses `hex:` binary data and `hex(N):` data of type N, as comma separated bytes
+func parseHex(data string) (uint32, []byte, error) {
+	valueType := TypeBinary
+	colon := strings.Index(data, ":")
+	if colon < 0 {
+		return 0, nil, fmt.Errorf("missing : in %q", data)
+	}
+	if prefix := strings.ToLower(data[:colon]); prefix != "hex" {
+		if !strings.HasPrefix(prefix, "hex(") || !strings.HasSuffix(prefix, ")") {
+			return 0, nil, fmt.Errorf("unknown type %q", prefix)
+		}
+		n, err := strconv.ParseUint(prefix[len("hex("):len(prefix)-1], 16, 32)
+		if err != nil {
+			return 0, nil, fmt.Errorf("unknown type %q", prefix)
+		}
+		valueType = uint32(n)
+	}
+
+	var out []byte
+	for _, field := range strings.Split(data[colon+1:], ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		b, err := hex.DecodeString(field)
+		if err != nil || len(b) != 1 {
+			return 0, nil, fmt.Errorf("invalid byte %q", field)
+		}
+		out = append(out, b[0])
+	}
+	return valueType, out, nil
+}
+
+// encodeString returns a string as the registry stores it, UTF-16 with a terminating NUL
+func encodeString(s string) []byte {
+	units := append(utf16.Encode([]rune(s)), 0)
+	data := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(data[2*i:], u)
+	}
+	return data
+}
+
+// decodeStrings returns the UTF-16 strings in registry data, separated by NULs
+func decodeStrings(data []byte) []string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	var strs []string
+	for _, s := range strings.Split(string(utf16.Decode(units)), "\x00") {
+		if s != "" {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// String returns the data of a value as text: strings as they are, the lines of a multi-string,
+// numbers in decimal and anything else in hex. This is what registry checks compare.
+func (v Value) String() string {
+	switch v.Type {
+	case TypeString, TypeExpandString:
+		return strings.Join(decodeStrings(v.Data), "")
+	case TypeMultiString:
+		return strings.Join(decodeStrings(v.Data), "\n")
+	case TypeDWord:
+		if len(v.Data) == 4 {
+			return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(v.Data)), 10)
+		}
+	case TypeQWord:
+		if len(v.Data) == 8 {
+			return strconv.FormatUint(binary.LittleEndian.Uint64(v.Data), 10)
+		}
+	}
+	return hex.EncodeToString(v.Data)
+}
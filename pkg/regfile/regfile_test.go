@@ -0,0 +1,136 @@
+package regfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16File encodes a .reg file as regedit exports it
+func utf16File(text string) []byte {
+	units := utf16.Encode([]rune(text))
+	data := []byte{0xff, 0xfe}
+	for _, u := range units {
+		data = append(data, byte(u), byte(u>>8))
+	}
+	return data
+}
+
+// TestParse validates the keys and values of a .reg file are parsed
+func TestParse(t *testing.T) {
+	text := strings.Join([]string{
+		"Windows Registry Editor Version 5.00",
+		"",
+		"; Example policy",
+		`[HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Example]`,
+		`"Name"="C:\\Program Files\\Example \"1\""`,
+		`@="default"`,
+		`"Enabled"=dword:00000001`,
+		`"Blob"=hex:01,02,\`,
+		`  03`,
+		`"Paths"=hex(7):61,00,00,00,62,00,00,00,00,00`,
+		`"Old"=-`,
+		"",
+		`[-HKCU\Software\Example\Legacy]`,
+	}, "\r\n")
+
+	keys, err := Parse(utf16File(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %+v", keys)
+	}
+	if keys[0].Path != `HKEY_LOCAL_MACHINE\SOFTWARE\Policies\Example` || keys[0].Delete {
+		t.Errorf("unexpected key: %+v", keys[0])
+	}
+	if keys[1].Path != `HKEY_CURRENT_USER\Software\Example\Legacy` || !keys[1].Delete {
+		t.Errorf("unexpected deleted key: %+v", keys[1])
+	}
+
+	values := keys[0].Values
+	if len(values) != 6 {
+		t.Fatalf("expected 6 values, got %+v", values)
+	}
+	expected := []struct {
+		name      string
+		valueType uint32
+		text      string
+	}{
+		{"Name", TypeString, `C:\Program Files\Example "1"`},
+		{"", TypeString, "default"},
+		{"Enabled", TypeDWord, "1"},
+		{"Blob", TypeBinary, "010203"},
+		{"Paths", TypeMultiString, "a\nb"},
+	}
+	for i, e := range expected {
+		if values[i].Name != e.name || values[i].Type != e.valueType || values[i].String() != e.text {
+			t.Errorf("expected %s of type %d as %q, got %+v as %q", e.name, e.valueType, e.text, values[i], values[i].String())
+		}
+	}
+	if !values[5].Delete || values[5].Name != "Old" {
+		t.Errorf("expected Old to be deleted, got %+v", values[5])
+	}
+}
+
+// TestParseRegedit4 validates UTF-8 files with the REGEDIT4 header are parsed
+func TestParseRegedit4(t *testing.T) {
+	keys, err := Parse([]byte("REGEDIT4\n\n[HKLM\\SOFTWARE\\Example]\n\"Count\"=dword:0000000a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, 10)
+	want := []Key{{
+		Path:   `HKEY_LOCAL_MACHINE\SOFTWARE\Example`,
+		Values: []Value{{Name: "Count", Type: TypeDWord, Data: data}},
+	}}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected %+v, got %+v", want, keys)
+	}
+}
+
+// TestParseMalformed validates files regedit couldn't import are rejected with the line at fault
+func TestParseMalformed(t *testing.T) {
+	header := "Windows Registry Editor Version 5.00\n"
+	tests := map[string]struct {
+		text string
+		line string
+	}{
+		"empty":           {"", "empty"},
+		"no header":       {"[HKLM\\SOFTWARE]\n", "line 1"},
+		"unknown root":    {header + "[HKXX\\SOFTWARE]\n", "line 2"},
+		"unterminated":    {header + "[HKLM\\SOFTWARE\n", "line 2"},
+		"value first":     {header + "\"Name\"=\"x\"\n", "line 2"},
+		"bad dword":       {header + "[HKLM\\SOFTWARE\\Example]\n\"Count\"=dword:xyz\n", "line 3"},
+		"bad hex":         {header + "[HKLM\\SOFTWARE\\Example]\n\"Blob\"=hex:01,zz\n", "line 3"},
+		"unquoted":        {header + "[HKLM\\SOFTWARE\\Example]\n\"Name=\"x\n", "line 3"},
+		"deleted root":    {header + "[-HKLM]\n", "line 2"},
+		"deleted values":  {header + "[-HKLM\\SOFTWARE\\Example]\n\"Name\"=\"x\"\n", "line 3"},
+		"trailing string": {header + "[HKLM\\SOFTWARE\\Example]\n\"Name\"=\"x\" y\n", "line 3"},
+	}
+	for name, test := range tests {
+		_, err := Parse([]byte(test.text))
+		if !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected a malformed file, got %v", name, err)
+			continue
+		}
+		if errors.Is(err, ErrAccessDenied) || !strings.Contains(err.Error(), test.line) {
+			t.Errorf("%s: expected the error at %s, got %v", name, test.line, err)
+		}
+	}
+}
+
+// TestSplitPath validates the short names of root keys are expanded
+func TestSplitPath(t *testing.T) {
+	root, subkey, err := SplitPath(`hklm\SOFTWARE\Example\`)
+	if err != nil || root != "HKEY_LOCAL_MACHINE" || subkey != `SOFTWARE\Example` {
+		t.Errorf("unexpected split: %q %q %v", root, subkey, err)
+	}
+	if _, _, err := SplitPath(`SOFTWARE\Example`); err == nil {
+		t.Errorf("expected an error for a path without a root key")
+	}
+}
@@ -0,0 +1,174 @@
+//go:build windows
+// +build windows
+
+package regfile
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// registryRoots are the open handles of the root keys, by their full names
+var registryRoots = map[string]registry.Key{
+	"HKEY_LOCAL_MACHINE":  registry.LOCAL_MACHINE,
+	"HKEY_CURRENT_USER":   registry.CURRENT_USER,
+	"HKEY_CLASSES_ROOT":   registry.CLASSES_ROOT,
+	"HKEY_USERS":          registry.USERS,
+	"HKEY_CURRENT_CONFIG": registry.CURRENT_CONFIG,
+}
+
+// procRegSetValueEx sets a value of any type, the registry package only sets the common ones
+var procRegSetValueEx = windows.NewLazySystemDLL("advapi32.dll").NewProc("RegSetValueExW")
+
+// Apply creates and deletes the keys and values of a parsed .reg file, in order
+func Apply(keys []Key) error {
+	for _, key := range keys {
+		root, subkey, err := SplitPath(key.Path)
+		if err != nil {
+			return err
+		}
+		if key.Delete {
+			if err := deleteTree(registryRoots[root], subkey); err != nil {
+				return registryError(key.Path, err)
+			}
+			continue
+		}
+
+		k, _, err := registry.CreateKey(registryRoots[root], subkey, registry.SET_VALUE)
+		if err != nil {
+			return registryError(key.Path, err)
+		}
+		for _, value := range key.Values {
+			if value.Delete {
+				err = k.DeleteValue(value.Name)
+				if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+					err = nil
+				}
+			} else {
+				err = setValue(k, value)
+			}
+			if err != nil {
+				k.Close()
+				return registryError(key.Path+`\`+value.Name, err)
+			}
+		}
+		k.Close()
+	}
+	return nil
+}
+
+// DeleteKey deletes a key with all of its subkeys. A key that doesn't exist is already deleted.
+func DeleteKey(path string) error {
+	root, subkey, err := SplitPath(path)
+	if err != nil {
+		return err
+	}
+	if subkey == "" {
+		return fmt.Errorf("a root key can't be deleted: %s", path)
+	}
+	if err := deleteTree(registryRoots[root], subkey); err != nil {
+		return registryError(path, err)
+	}
+	return nil
+}
+
+// ReadValue reads a value of a key, returning false when the key or the value doesn't exist
+func ReadValue(path, name string) (Value, bool, error) {
+	root, subkey, err := SplitPath(path)
+	if err != nil {
+		return Value{}, false, err
+	}
+	k, err := registry.OpenKey(registryRoots[root], subkey, registry.QUERY_VALUE)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return Value{}, false, nil
+	}
+	if err != nil {
+		return Value{}, false, registryError(path, err)
+	}
+	defer k.Close()
+
+	n, valueType, err := k.GetValue(name, nil)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return Value{}, false, nil
+	}
+	if err != nil {
+		return Value{}, false, registryError(path, err)
+	}
+	data := make([]byte, n)
+	if n > 0 {
+		if n, _, err = k.GetValue(name, data); err != nil {
+			return Value{}, false, registryError(path, err)
+		}
+	}
+	return Value{Name: name, Type: valueType, Data: data[:n]}, true, nil
+}
+
+// KeyExists returns true when a key exists, whether or not it has any values
+func KeyExists(path string) (bool, error) {
+	root, subkey, err := SplitPath(path)
+	if err != nil {
+		return false, err
+	}
+	k, err := registry.OpenKey(registryRoots[root], subkey, registry.QUERY_VALUE)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return false, nil
+	}
+	if err != nil {
+		return false, registryError(path, err)
+	}
+	k.Close()
+	return true, nil
+}
+
+// deleteTree deletes a key after its subkeys, which the registry requires
+func deleteTree(root registry.Key, subkey string) error {
+	k, err := registry.OpenKey(root, subkey, registry.ENUMERATE_SUB_KEYS)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	names, err := k.ReadSubKeyNames(-1)
+	k.Close()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := deleteTree(root, subkey+`\`+name); err != nil {
+			return err
+		}
+	}
+	return registry.DeleteKey(root, subkey)
+}
+
+// setValue sets a value with its type and data as the registry stores them
+func setValue(k registry.Key, value Value) error {
+	name, err := windows.UTF16PtrFromString(value.Name)
+	if err != nil {
+		return err
+	}
+	var data *byte
+	if len(value.Data) > 0 {
+		data = &value.Data[0]
+	}
+	r, _, _ := procRegSetValueEx.Call(uintptr(k), uintptr(unsafe.Pointer(name)), 0,
+		uintptr(value.Type), uintptr(unsafe.Pointer(data)), uintptr(len(value.Data)))
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+// registryError tells a change the registry refused apart from other errors
+func registryError(path string, err error) error {
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+		return fmt.Errorf("%w: %s needs SYSTEM or an administrator: %v", ErrAccessDenied, path, err)
+	}
+	return fmt.Errorf("%s: %v", path, err)
+}
@@ -0,0 +1,31 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package regfile
+
+import "errors"
+
+// errNoRegistry is returned on darwin, which has no registry
+var errNoRegistry = errors.New("the registry is only available on Windows")
+
+// Apply is just a placeholder on darwin
+func Apply(keys []Key) error {
+	return errNoRegistry
+}
+
+// DeleteKey is just a placeholder on darwin
+func DeleteKey(path string) error {
+	return errNoRegistry
+}
+
+// ReadValue is just a placeholder on darwin
+func ReadValue(path, name string) (Value, bool, error) {
+	return Value{}, false, errNoRegistry
+}
+
+// KeyExists is just a placeholder on darwin
+func KeyExists(path string) (bool, error) {
+	return false, errNoRegistry
+}
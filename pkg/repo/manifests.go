@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is a manifest as the admin tools read and write it, and as --export-json writes it
+type Manifest struct {
+	Name              string   `yaml:"name" json:"name"`
+	ManagedInstalls   []string `yaml:"managed_installs" json:"managed_installs"`
+	ManagedUninstalls []string `yaml:"managed_uninstalls" json:"managed_uninstalls"`
+	ManagedUpdates    []string `yaml:"managed_updates" json:"managed_updates"`
+	IncludedManifests []string `yaml:"included_manifests" json:"included_manifests"`
+	Catalogs          []string `yaml:"catalogs" json:"catalogs"`
+
+	// Extras holds the keys that are not defined above, such as the version and installer_location
+	// the client reads, so they are retained when the manifest is written again or exported
+	Extras map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// manifestFields is a Manifest without its JSON methods, to encode and decode the fields defined above
+type manifestFields Manifest
+
+// MarshalJSON writes the extras of a manifest after its other fields, as YAML does
+func (m Manifest) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(manifestFields(m))
+	if err != nil || len(m.Extras) == 0 {
+		return data, err
+	}
+	extras, err := json.Marshal(m.Extras)
+	if err != nil {
+		return nil, err
+	}
+	// Join the two objects, dropping the closing brace of one and the opening brace of the other
+	return append(append(data[:len(data)-1], ','), extras[1:]...), nil
+}
+
+// UnmarshalJSON reads the keys that are not fields of a manifest into its extras
+func (m *Manifest) UnmarshalJSON(data []byte) error {
+	var fields manifestFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var extras map[string]interface{}
+	if err := json.Unmarshal(data, &extras); err != nil {
+		return err
+	}
+	fieldsType := reflect.TypeOf(fields)
+	for i := 0; i < fieldsType.NumField(); i++ {
+		delete(extras, strings.Split(fieldsType.Field(i).Tag.Get("json"), ",")[0])
+	}
+	fields.Extras = extras
+	*m = Manifest(fields)
+	return nil
+}
+
+// Normalize sets the missing lists of a manifest to empty ones, and empty extras to nil,
+// so a manifest compares and encodes the same whether a list was left out or empty
+func (m Manifest) Normalize() Manifest {
+	if len(m.Extras) == 0 {
+		m.Extras = nil
+	}
+	for _, list := range []*[]string{
+		&m.ManagedInstalls, &m.ManagedUninstalls, &m.ManagedUpdates,
+		&m.IncludedManifests, &m.Catalogs,
+	} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	return m
+}
+
+// ManifestPath returns where a manifest is, by its name as the client requests it,
+// such as manifests/site/default.yaml for site/default
+func (r *Repo) ManifestPath(name string) (string, error) {
+	return join(r.ManifestsDir(), name, ".yaml")
+}
+
+// WalkManifests calls fn with the name and path of every manifest
+func (r *Repo) WalkManifests(fn func(name, path string) error) error {
+	return walk(r.ManifestsDir(), ".yaml", fn)
+}
+
+// ManifestNames returns the names of every manifest, sorted
+func (r *Repo) ManifestNames() ([]string, error) {
+	var names []string
+	err := r.WalkManifests(func(name, path string) error {
+		names = append(names, name)
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// ReadManifest reads a manifest by its name
+func (r *Repo) ReadManifest(name string) (Manifest, error) {
+	path, err := r.ManifestPath(name)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return ReadManifestFile(path)
+}
+
+// ReadManifestFile reads the manifest at a path
+func ReadManifestFile(path string) (Manifest, error) {
+	var manifest Manifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return manifest, err
+	}
+	return manifest, nil
+}
+
+// WriteManifest writes a manifest by its name, creating its directory
+func (r *Repo) WriteManifest(name string, manifest Manifest) error {
+	path, err := r.ManifestPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest %s: %v", name, err)
+	}
+	return writeFile(path, data)
+}
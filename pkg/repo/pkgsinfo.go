@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"gopkg.in/yaml.v3"
+)
+
+// PkgsinfoPath returns where a pkginfo is, by its path under pkgsinfo without .yaml,
+// such as apps/Firefox-128.0
+func (r *Repo) PkgsinfoPath(name string) (string, error) {
+	return join(r.PkgsinfoDir(), name, ".yaml")
+}
+
+// WalkPkgsinfo calls fn with the path and contents of every pkginfo file. The files are passed
+// as they are, so a tool can report those that don't decode and rewrite them in place.
+func (r *Repo) WalkPkgsinfo(fn func(path string, data []byte) error) error {
+	return walk(r.PkgsinfoDir(), ".yaml", func(name, path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return fn(path, data)
+	})
+}
+
+// ReadPkgsinfo reads a pkginfo by its name
+func (r *Repo) ReadPkgsinfo(name string) (pkginfo.PkgsInfo, error) {
+	path, err := r.PkgsinfoPath(name)
+	if err != nil {
+		return pkginfo.PkgsInfo{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pkginfo.PkgsInfo{}, err
+	}
+	info, err := pkginfo.Decode(data)
+	if err != nil {
+		return pkginfo.PkgsInfo{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return info, nil
+}
+
+// WritePkgsinfo writes a pkginfo by its name as canonical YAML, creating its directory
+func (r *Repo) WritePkgsinfo(name string, info pkginfo.PkgsInfo) error {
+	path, err := r.PkgsinfoPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := pkginfo.Encode(info)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// CatalogNames returns the names of the catalogs built under catalogs, sorted
+func (r *Repo) CatalogNames() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(r.CatalogsDir(), "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(file), ".yaml"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CatalogPath returns where a catalog is, such as catalogs/Production.yaml
+func (r *Repo) CatalogPath(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid catalog name %q", name)
+	}
+	return join(r.CatalogsDir(), name, ".yaml")
+}
+
+// ReadCatalog reads the items of a built catalog
+func (r *Repo) ReadCatalog(name string) ([]pkginfo.CatalogItem, error) {
+	path, err := r.CatalogPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var items []pkginfo.CatalogItem
+	if err := yaml.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return items, nil
+}
+
+// WriteCatalog writes a catalog as canonical YAML and returns what was written
+func (r *Repo) WriteCatalog(name string, items []pkginfo.CatalogItem) ([]byte, error) {
+	path, err := r.CatalogPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := pkginfo.Encode(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode catalog %s: %v", name, err)
+	}
+	if err := writeFile(path, data); err != nil {
+		return nil, fmt.Errorf("failed to write YAML to %s: %v", path, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,145 @@
+// Package repo reads and writes the Gorilla repo the admin tools work on:
+// its manifests, pkgsinfo, pkgs, catalogs and icons directories
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// The directories of a repo, under its root
+const (
+	ManifestsDirName = "manifests"
+	PkgsinfoDirName  = "pkgsinfo"
+	PkgsDirName      = "pkgs"
+	CatalogsDirName  = "catalogs"
+	IconsDirName     = "icons"
+)
+
+// ErrNoRepo is returned by OpenConfig when the configuration has no repo_path
+var ErrNoRepo = errors.New("no repo path, set repo_path in the configuration or pass the repo path")
+
+// Repo is a Gorilla repo on disk
+type Repo struct {
+	root         string
+	manifestsDir string
+}
+
+// Open returns the repo at path, which must be a directory
+func Open(path string) (*Repo, error) {
+	if path == "" {
+		return nil, ErrNoRepo
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the repo: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("unable to open the repo: %s is not a directory", path)
+	}
+	return &Repo{root: filepath.Clean(path)}, nil
+}
+
+// OpenConfig returns the repo at the repo_path of a configuration
+func OpenConfig(cfg config.Configuration) (*Repo, error) {
+	return Open(cfg.RepoPath)
+}
+
+// ForManifests returns the repo a manifests directory is in, its parent. The manifests are read
+// from manifestsDir even when it isn't named manifests, and it doesn't need to exist yet.
+func ForManifests(manifestsDir string) *Repo {
+	manifestsDir = filepath.Clean(manifestsDir)
+	return &Repo{root: filepath.Dir(manifestsDir), manifestsDir: manifestsDir}
+}
+
+// Root returns the directory of the repo
+func (r *Repo) Root() string {
+	return r.root
+}
+
+// ManifestsDir returns the directory of the manifests
+func (r *Repo) ManifestsDir() string {
+	if r.manifestsDir != "" {
+		return r.manifestsDir
+	}
+	return filepath.Join(r.root, ManifestsDirName)
+}
+
+// PkgsinfoDir returns the directory of the pkginfo files
+func (r *Repo) PkgsinfoDir() string {
+	return filepath.Join(r.root, PkgsinfoDirName)
+}
+
+// PkgsDir returns the directory of the payloads
+func (r *Repo) PkgsDir() string {
+	return filepath.Join(r.root, PkgsDirName)
+}
+
+// CatalogsDir returns the directory of the catalogs makecatalogs builds
+func (r *Repo) CatalogsDir() string {
+	return filepath.Join(r.root, CatalogsDirName)
+}
+
+// IconsDir returns the directory of the item icons
+func (r *Repo) IconsDir() string {
+	return filepath.Join(r.root, IconsDirName)
+}
+
+// ValidName rejects a name that would be outside of its directory once it is joined to it,
+// such as ../Config or an absolute path. Names use forward slashes, such as site/default.
+func ValidName(name string) error {
+	if name == "" || strings.Contains(name, `\`) || path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+		path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("invalid name %q, use names such as site/default", name)
+	}
+	return nil
+}
+
+// join returns where a name is in a directory of the repo, after checking it stays in the directory
+func join(dir, name, ext string) (string, error) {
+	if err := ValidName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)+ext), nil
+}
+
+// PayloadPath returns where a location of a pkginfo, such as /apps/Firefox.msi, is under pkgs
+func (r *Repo) PayloadPath(location string) (string, error) {
+	name := strings.TrimLeft(strings.ReplaceAll(location, `\`, "/"), "/")
+	return join(r.PkgsDir(), name, "")
+}
+
+// walk calls fn with the name, without ext, and the path of every file with the extension
+// under dir. A directory that doesn't exist has no files.
+func walk(dir, ext string, fn func(name, path string) error) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ext {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return fn(strings.TrimSuffix(filepath.ToSlash(rel), ext), path)
+	})
+}
+
+// writeFile writes a file in the repo, creating its directory
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
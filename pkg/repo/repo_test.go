@@ -0,0 +1,180 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+)
+
+// testRepo creates a repo with a manifest, a pkginfo and a catalog
+func testRepo(t *testing.T) *Repo {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"manifests/site_default.yaml":    "name: site_default\nmanaged_installs: [Firefox]\ncatalogs: [Production]\n",
+		"manifests/site/lab.yaml":        "name: site/lab\nincluded_manifests: [site_default]\n",
+		"manifests/notes.txt":            "not a manifest",
+		"pkgsinfo/apps/Firefox-128.yaml": "name: Firefox\nversion: \"128.0\"\ncatalogs: [Production]\ninstaller:\n  type: msi\n  location: /apps/Firefox-128.0.msi\n",
+		"catalogs/Production.yaml":       "- name: Firefox\n  version: \"128.0\"\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := OpenConfig(config.Configuration{RepoPath: root})
+	if err != nil {
+		t.Fatalf("OpenConfig failed: %v", err)
+	}
+	return r
+}
+
+// TestOpen validates a repo only opens at a directory, and its directories are under the root
+func TestOpen(t *testing.T) {
+	if _, err := Open(""); err != ErrNoRepo {
+		t.Errorf("expected ErrNoRepo, got %v", err)
+	}
+	root := t.TempDir()
+	if _, err := Open(filepath.Join(root, "missing")); err == nil {
+		t.Error("expected an error for a repo that doesn't exist")
+	}
+	file := filepath.Join(root, "file")
+	os.WriteFile(file, nil, 0644)
+	if _, err := Open(file); err == nil {
+		t.Error("expected an error for a file")
+	}
+
+	r, err := Open(root)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for dir, expected := range map[string]string{
+		r.ManifestsDir(): "manifests",
+		r.PkgsinfoDir():  "pkgsinfo",
+		r.PkgsDir():      "pkgs",
+		r.CatalogsDir():  "catalogs",
+		r.IconsDir():     "icons",
+	} {
+		if dir != filepath.Join(root, expected) {
+			t.Errorf("expected %s under %s, got %s", expected, root, dir)
+		}
+	}
+
+	manifests := filepath.Join(root, "custom")
+	if r := ForManifests(manifests); r.ManifestsDir() != manifests || r.Root() != root {
+		t.Errorf("unexpected repo for %s: %s %s", manifests, r.Root(), r.ManifestsDir())
+	}
+}
+
+// TestValidName validates names that would leave their directory are rejected
+func TestValidName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"site_default":     true,
+		"site/default":     true,
+		"":                 false,
+		"../Config":        false,
+		"site/../../etc":   false,
+		"/etc/passwd":      false,
+		`site\default`:     false,
+		"site//default":    false,
+		"..":               false,
+		"./site_default":   false,
+		"apps/Firefox.msi": true,
+	} {
+		if err := ValidName(name); (err == nil) != valid {
+			t.Errorf("%q: expected valid %v, got %v", name, valid, err)
+		}
+	}
+
+	r := testRepo(t)
+	if _, err := r.PayloadPath("/../../Config.yaml"); err == nil {
+		t.Error("expected a location outside of pkgs to be rejected")
+	}
+	if path, err := r.PayloadPath(`\apps\Firefox-128.0.msi`); err != nil || path != filepath.Join(r.PkgsDir(), "apps", "Firefox-128.0.msi") {
+		t.Errorf("unexpected payload path %s: %v", path, err)
+	}
+}
+
+// TestManifests validates manifests are listed, read and written by name
+func TestManifests(t *testing.T) {
+	r := testRepo(t)
+	names, err := r.ManifestNames()
+	if err != nil {
+		t.Fatalf("ManifestNames failed: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"site/lab", "site_default"}) {
+		t.Errorf("unexpected manifests: %v", names)
+	}
+
+	manifest, err := r.ReadManifest("site_default")
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+	if !reflect.DeepEqual(manifest.ManagedInstalls, []string{"Firefox"}) || manifest.ManagedUpdates != nil {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+	if manifest.Normalize().ManagedUpdates == nil {
+		t.Error("expected Normalize to set the missing lists")
+	}
+
+	manifest.Name = "site/new/kiosk"
+	if err := r.WriteManifest(manifest.Name, manifest); err != nil {
+		t.Fatalf("WriteManifest failed: %v", err)
+	}
+	if written, err := r.ReadManifest("site/new/kiosk"); err != nil || written.Name != "site/new/kiosk" {
+		t.Errorf("unexpected written manifest %+v: %v", written, err)
+	}
+	if err := r.WriteManifest("../escaped", manifest); err == nil {
+		t.Error("expected a name outside of the manifests to be rejected")
+	}
+}
+
+// TestPkgsinfoAndCatalogs validates pkginfos are walked, read and written canonically,
+// and catalogs are listed, read and written
+func TestPkgsinfoAndCatalogs(t *testing.T) {
+	r := testRepo(t)
+	var paths []string
+	err := r.WalkPkgsinfo(func(path string, data []byte) error {
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(paths, []string{filepath.Join(r.PkgsinfoDir(), "apps", "Firefox-128.yaml")}) {
+		t.Errorf("unexpected pkgsinfo %v: %v", paths, err)
+	}
+
+	info, err := r.ReadPkgsinfo("apps/Firefox-128")
+	if err != nil || info.Installer == nil || info.Installer.Type != "msi" {
+		t.Fatalf("unexpected pkginfo %+v: %v", info, err)
+	}
+	info.Version = "129.0"
+	if err := r.WritePkgsinfo("apps/Firefox-129", info); err != nil {
+		t.Fatalf("WritePkgsinfo failed: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(r.PkgsinfoDir(), "apps", "Firefox-129.yaml"))
+	if expected, _ := pkginfo.Encode(info); string(data) != string(expected) {
+		t.Errorf("expected the canonical pkginfo, got:\n%s", data)
+	}
+
+	if _, err := r.WriteCatalog("Testing", []pkginfo.CatalogItem{{Name: "Chrome", Version: "126.0"}}); err != nil {
+		t.Fatalf("WriteCatalog failed: %v", err)
+	}
+	names, err := r.CatalogNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"Production", "Testing"}) {
+		t.Errorf("unexpected catalogs %v: %v", names, err)
+	}
+	items, err := r.ReadCatalog("Production")
+	if err != nil || len(items) != 1 || items[0].Name != "Firefox" {
+		t.Errorf("unexpected catalog %+v: %v", items, err)
+	}
+	if _, err := r.ReadCatalog("../manifests/site_default"); err == nil {
+		t.Error("expected a catalog outside of the catalogs to be rejected")
+	}
+}
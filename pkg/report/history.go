@@ -0,0 +1,174 @@
+package report
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// HistoryPerItem is how many installs and uninstalls of each item are kept in the history
+	HistoryPerItem = 20
+
+	// recentHistory is how many of the latest history entries are added to the report
+	recentHistory = 20
+)
+
+// HistoryEntry is a successful install or uninstall of an item, kept across runs in InstallHistory.yaml
+type HistoryEntry struct {
+	Time            string  `yaml:"time" json:"time"`
+	Item            string  `yaml:"item" json:"item"`
+	Action          string  `yaml:"action" json:"action"`
+	FromVersion     string  `yaml:"from_version,omitempty" json:"from_version,omitempty"`
+	ToVersion       string  `yaml:"to_version,omitempty" json:"to_version,omitempty"`
+	Method          string  `yaml:"method,omitempty" json:"method,omitempty"`
+	DurationSeconds float64 `yaml:"duration_seconds" json:"duration_seconds"`
+}
+
+var (
+	// History contains the installs and uninstalls of this run, they are added to the history file by End
+	History []HistoryEntry
+
+	// This abstraction allows us to override when testing
+	historyPath = filepath.Join(os.Getenv("ProgramData"), "ManagedInstalls", "InstallHistory.yaml")
+)
+
+// HistoryPath returns where the install history is saved
+func HistoryPath() string {
+	return historyPath
+}
+
+// RecordHistory adds a successful install or uninstall to the history. An install that doesn't
+// say what it upgraded from is given the version of the last install in the history when saved.
+func RecordHistory(item, action, fromVersion, toVersion, method string, duration time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	History = append(History, HistoryEntry{
+		Time:            now().Format("2006-01-02 15:04:05 -0700"),
+		Item:            item,
+		Action:          action,
+		FromVersion:     fromVersion,
+		ToVersion:       toVersion,
+		Method:          method,
+		DurationSeconds: duration.Round(time.Second).Seconds(),
+	})
+}
+
+// ReadHistory returns the saved history, oldest first. A missing file is an empty history.
+func ReadHistory() ([]HistoryEntry, error) {
+	data, err := ioutil.ReadFile(historyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []HistoryEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", historyPath, err)
+	}
+	return entries, nil
+}
+
+// ItemHistory returns the entries of one item, its name is matched without case
+func ItemHistory(entries []HistoryEntry, item string) []HistoryEntry {
+	var matches []HistoryEntry
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Item, item) {
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
+
+// mergeHistory appends the entries of this run to the saved history, keeping the
+// last HistoryPerItem entries of each item
+func mergeHistory(saved, run []HistoryEntry) []HistoryEntry {
+	lastVersion := make(map[string]string)
+	for _, entry := range saved {
+		if entry.Action == "install" {
+			lastVersion[strings.ToLower(entry.Item)] = entry.ToVersion
+		}
+	}
+	entries := append([]HistoryEntry{}, saved...)
+	for _, entry := range run {
+		key := strings.ToLower(entry.Item)
+		if entry.Action == "install" {
+			if entry.FromVersion == "" && lastVersion[key] != entry.ToVersion {
+				entry.FromVersion = lastVersion[key]
+			}
+			lastVersion[key] = entry.ToVersion
+		}
+		entries = append(entries, entry)
+	}
+
+	// Count from the newest, so the oldest entries of an item are dropped
+	counts := make(map[string]int)
+	kept := make([]bool, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		key := strings.ToLower(entries[i].Item)
+		counts[key]++
+		kept[i] = counts[key] <= HistoryPerItem
+	}
+	var merged []HistoryEntry
+	for i, entry := range entries {
+		if kept[i] {
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+// saveHistory adds the entries of this run to the history file and returns the whole history.
+// It is written to a temporary file and renamed, so an interrupted run doesn't lose it.
+func saveHistory() ([]HistoryEntry, error) {
+	saved, err := ReadHistory()
+	if err != nil {
+		return nil, err
+	}
+	if len(History) == 0 {
+		return saved, nil
+	}
+	entries := mergeHistory(saved, History)
+
+	data, err := yaml.Marshal(entries)
+	if err != nil {
+		return entries, fmt.Errorf("unable to encode the history: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(historyPath), 0755); err != nil {
+		return entries, fmt.Errorf("unable to create the history directory: %v", err)
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(historyPath), "InstallHistory-*.yaml")
+	if err != nil {
+		return entries, fmt.Errorf("unable to write the history: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return entries, fmt.Errorf("unable to write the history: %v", err)
+	}
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return entries, fmt.Errorf("unable to write the history: %v", err)
+	}
+	if err := os.Rename(tmpFile.Name(), historyPath); err != nil {
+		return entries, fmt.Errorf("unable to replace the history: %v", err)
+	}
+	return entries, nil
+}
+
+// latestHistory returns the last n entries of a history
+func latestHistory(entries []HistoryEntry, n int) []HistoryEntry {
+	if len(entries) > n {
+		return entries[len(entries)-n:]
+	}
+	return entries
+}
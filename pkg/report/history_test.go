@@ -0,0 +1,60 @@
+package report
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestEndSavesHistory validates the installs of a run are added to the history across runs,
+// and an upgrade is given the version the last install left
+func TestEndSavesHistory(t *testing.T) {
+	resetReport(t)
+
+	RecordHistory("Firefox", "install", "", "127.0", "msi", 42*time.Second)
+	End()
+
+	History = nil
+	RecordHistory("Firefox", "install", "", "128.0", "msi", 1500*time.Millisecond)
+	RecordHistory("Chrome", "uninstall", "126.0", "", "exe", 3*time.Second)
+	End()
+
+	entries, err := ReadHistory()
+	if err != nil {
+		t.Fatalf("unable to read the history: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+	upgrade := entries[1]
+	if upgrade.FromVersion != "127.0" || upgrade.ToVersion != "128.0" || upgrade.Method != "msi" || upgrade.DurationSeconds != 2 {
+		t.Errorf("unexpected upgrade: %+v", upgrade)
+	}
+	if chrome := ItemHistory(entries, "chrome"); len(chrome) != 1 || chrome[0].FromVersion != "126.0" {
+		t.Errorf("unexpected Chrome history: %+v", chrome)
+	}
+	if recent, ok := Items["RecentHistory"].([]HistoryEntry); !ok || len(recent) != 3 {
+		t.Errorf("the report is missing the recent history: %+v", Items["RecentHistory"])
+	}
+}
+
+// TestMergeHistoryCap validates only the latest entries of each item are kept
+func TestMergeHistoryCap(t *testing.T) {
+	var saved []HistoryEntry
+	for i := 0; i < HistoryPerItem; i++ {
+		saved = append(saved, HistoryEntry{Item: "Firefox", Action: "install", ToVersion: fmt.Sprint(i)})
+	}
+	saved = append(saved, HistoryEntry{Item: "Chrome", Action: "install", ToVersion: "1"})
+
+	merged := mergeHistory(saved, []HistoryEntry{{Item: "firefox", Action: "install", ToVersion: "new"}})
+	firefox := ItemHistory(merged, "Firefox")
+	if len(firefox) != HistoryPerItem {
+		t.Fatalf("expected %d Firefox entries, got %d", HistoryPerItem, len(firefox))
+	}
+	if firefox[0].ToVersion != "1" || firefox[len(firefox)-1].FromVersion != fmt.Sprint(HistoryPerItem-1) {
+		t.Errorf("the oldest entry should be dropped: %+v", firefox)
+	}
+	if len(ItemHistory(merged, "Chrome")) != 1 {
+		t.Errorf("other items should be kept: %+v", merged)
+	}
+}
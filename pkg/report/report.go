@@ -1,17 +1,39 @@
 package report
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sync"
 	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/facts"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/retry"
+	"github.com/windowsadmins/gorilla/pkg/utils"
+	"github.com/windowsadmins/gorilla/pkg/version"
+	"gopkg.in/yaml.v3"
 )
 
+// Action is something Gorilla did to an item during the run
+type Action struct {
+	Time    string `yaml:"time" json:"time"`
+	Item    string `yaml:"item" json:"item"`
+	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+	Action  string `yaml:"action" json:"action"`
+	Success bool   `yaml:"success" json:"success"`
+	Error   string `yaml:"error,omitempty" json:"error,omitempty"`
+	Log     string `yaml:"log,omitempty" json:"log,omitempty"`
+}
+
 var (
-	// Items contains the data we will save to GorillaReport
+	// Items contains the data we will save to ManagedInstallReport
 	Items = make(map[string]interface{})
 
 	// InstalledItems contains a list of items we attempted to install
@@ -20,78 +42,340 @@ var (
 	// UninstalledItems contains a list of items we attempted to uninstall
 	UninstalledItems []interface{}
 
+	// ForceInstalledItems contains the items installed after their force_install_after_date
+	ForceInstalledItems []interface{}
+
+	// ShutdownSkippedItems contains the items that needed action but were not started because Gorilla was shutting down
+	ShutdownSkippedItems []interface{}
+
+	// InteractiveItems contains the items an automatic run left to an interactive run,
+	// because they set unattended_install or unattended_uninstall to false
+	InteractiveItems []interface{}
+
+	// Actions contains everything we did to items, in order
+	Actions []Action
+
+	// Errors contains the errors that happened during the run
+	Errors []string
+
+	// Warnings contains problems that did not stop the run, such as items skipped on this machine
+	Warnings []string
+
+	// mu guards the run results, which items installing at the same time add to
+	mu sync.Mutex
+
 	// fakeTime is used to override currentTime when running tests
 	fakeTime time.Time
+
+	// reportURL is where the report is posted, if set
+	reportURL string
+
+	// clientIdentifier names this machine on the server
+	clientIdentifier string
+
+	// These abstractions allows us to override when testing
+	reportPath   = filepath.Join(os.Getenv("ProgramData"), "ManagedInstalls", "ManagedInstallReport.yaml")
+	machineFacts = facts.Get
+	serialNumber = func() string { return machineFacts().SerialNumber }
+	submitRetry  = retry.RetryConfig{MaxRetries: 3, InitialInterval: 5 * time.Second, Multiplier: 2, Jitter: 0.2}
 )
 
-// Start adds the data we already know at the beginning of a run
-func Start() {
+// Configure sets where the report is submitted and how this machine is identified
+func Configure(cfg config.Configuration) {
+	reportURL = cfg.ReportURL
+	clientIdentifier = cfg.ClientIdentifier
+	if clientIdentifier == "" {
+		clientIdentifier = cfg.Manifest
+	}
+}
 
-	// Get the current time
-	currentTime := time.Now().UTC()
+// SerialNumber returns the BIOS serial number of this machine
+func SerialNumber() string {
+	if serial, ok := Items["SerialNumber"].(string); ok && serial != "" {
+		return serial
+	}
+	return serialNumber()
+}
 
-	// If fakeTime is not zero, we should use it instead
+// now returns the current time, or fakeTime if it is set
+func now() time.Time {
 	if !fakeTime.IsZero() {
-		currentTime = fakeTime
+		return fakeTime
 	}
+	return time.Now().UTC()
+}
+
+// Start adds the data we already know at the beginning of a run
+func Start() {
 
-	// Add the end time to our map
-	Items["StartTime"] = fmt.Sprint(currentTime.Format("2006-01-02 15:04:05 -0700"))
+	// Add the start time to our map
+	Items["StartTime"] = fmt.Sprint(now().Format("2006-01-02 15:04:05 -0700"))
 
 	// Store the current user
 	currentUser, userErr := user.Current()
 	if userErr != nil {
 		fmt.Println("Unable to determine current user", userErr)
+	} else {
+		Items["CurrentUser"] = fmt.Sprint(currentUser.Username)
 	}
-	Items["CurrentUser"] = fmt.Sprint(currentUser.Username)
 
 	// Store the hostname
 	hostName, hostErr := os.Hostname()
 	if hostErr != nil {
-		fmt.Println("Unable to determine current time", hostErr)
+		fmt.Println("Unable to determine hostname", hostErr)
 	}
 	Items["HostName"] = fmt.Sprint(hostName)
+
+	// Store what identifies this machine to the server
+	Items["SerialNumber"] = serialNumber()
+	Items["ClientIdentifier"] = clientIdentifier
+	Items["GorillaVersion"] = version.Version().Version
+	Items["GorillaBuild"] = version.Version()
+
+	// Describe the machine, for reporting on models, builds and disk space
+	Items["Facts"] = machineFacts()
 }
 
-// End will compile everything and save to disk
-func End() {
+// RecordAction adds an install, uninstall or other action on an item to the report
+func RecordAction(item, itemVersion, action string, err error) {
+	RecordActionLog(item, itemVersion, action, "", err)
+}
 
-	// Compile everything
+// RecordActionLog adds an action to the report with the path of the log of its output
+func RecordActionLog(item, itemVersion, action, logPath string, err error) {
+	entry := Action{
+		Time:    now().Format("2006-01-02 15:04:05 -0700"),
+		Item:    item,
+		Version: itemVersion,
+		Action:  action,
+		Success: err == nil,
+		Log:     logPath,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	Actions = append(Actions, entry)
+}
+
+// ActionCount returns how many actions have been recorded, to find the ones recorded after it
+func ActionCount() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(Actions)
+}
+
+// ActionsSince returns a copy of the actions recorded after the first count of them
+func ActionsSince(count int) []Action {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Action(nil), Actions[count:]...)
+}
+
+// RecordError adds an error to the report
+func RecordError(message string) {
+	mu.Lock()
+	defer mu.Unlock()
+	Errors = append(Errors, message)
+}
+
+// RecordWarning adds a warning to the report
+func RecordWarning(message string) {
+	mu.Lock()
+	defer mu.Unlock()
+	Warnings = append(Warnings, message)
+}
+
+// RecordInstalled adds an item Gorilla attempted to install to InstalledItems
+func RecordInstalled(item interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	InstalledItems = append(InstalledItems, item)
+}
+
+// RecordUninstalled adds an item Gorilla attempted to uninstall to UninstalledItems
+func RecordUninstalled(item interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	UninstalledItems = append(UninstalledItems, item)
+}
+
+// RecordForceInstalled adds an item installed after its force_install_after_date to ForceInstalledItems
+func RecordForceInstalled(item interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	ForceInstalledItems = append(ForceInstalledItems, item)
+}
+
+// RecordShutdownSkipped adds an item that was not started because Gorilla was shutting down
+func RecordShutdownSkipped(item interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	ShutdownSkippedItems = append(ShutdownSkippedItems, item)
+}
+
+// RecordInteractive adds an item that was left to an interactive run
+func RecordInteractive(item interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	InteractiveItems = append(InteractiveItems, item)
+}
+
+// RecordPending adds an item that needs action but was left to PendingItems
+func RecordPending(item interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	PendingItems = append(PendingItems, item)
+}
+
+// RecordRebootRequired notes an installer asked for a reboot to finish
+func RecordRebootRequired() {
+	mu.Lock()
+	defer mu.Unlock()
+	RebootRequired = true
+}
+
+// RecordPendingReboot notes Windows was waiting for a reboot when the run started, and why
+func RecordPendingReboot(reasons []string) {
+	mu.Lock()
+	defer mu.Unlock()
+	PendingReboot = reasons
+}
+
+// compile adds the run results to Items
+func compile() {
 	Items["InstalledItems"] = InstalledItems
 	Items["UninstalledItems"] = UninstalledItems
+	Items["ForceInstalledItems"] = ForceInstalledItems
+	Items["ShutdownSkippedItems"] = ShutdownSkippedItems
+	Items["InteractiveItems"] = InteractiveItems
+	Items["Actions"] = Actions
+	Items["Errors"] = Errors
+	Items["Warnings"] = Warnings
+	if len(PendingReboot) > 0 {
+		Items["PendingReboot"] = PendingReboot
+	}
+}
 
-	// Get the current time
-	currentTime := time.Now().UTC()
+// End will compile everything, save it to disk and submit it if a ReportURL is configured
+func End() {
 
-	// If fakeTime is not zero, we should use it instead
-	if !fakeTime.IsZero() {
-		currentTime = fakeTime
+	// Compile everything
+	compile()
+
+	// Keep the installs and uninstalls of this run, and report the latest ones
+	history, historyErr := saveHistory()
+	if historyErr != nil {
+		logging.Warn("Unable to save the install history", "path", historyPath, "error", historyErr)
 	}
+	Items["RecentHistory"] = latestHistory(history, recentHistory)
 
-	// Add the end time to our map
-	Items["EndTime"] = fmt.Sprint(currentTime.Format("2006-01-02 15:04:05 -0700"))
+	// Add the end time and duration to our map
+	endTime := now()
+	Items["EndTime"] = fmt.Sprint(endTime.Format("2006-01-02 15:04:05 -0700"))
+	if startTime, ok := Items["StartTime"].(string); ok {
+		if start, err := time.Parse("2006-01-02 15:04:05 -0700", startTime); err == nil {
+			Items["DurationSeconds"] = int(endTime.Sub(start).Seconds())
+		}
+	}
 
-	// Convert it all to json
-	reportJSON, marshalErr := json.Marshal(Items)
+	// Convert it all to yaml
+	reportYAML, marshalErr := yaml.Marshal(Items)
 	if marshalErr != nil {
-		fmt.Println("Unable to create GorillaReport json", marshalErr)
+		fmt.Println("Unable to create ManagedInstallReport yaml", marshalErr)
 	}
 
-	// Write Items to disk as GorillaReport.json
-	reportPath := filepath.Join(os.Getenv("ProgramData"), "gorilla/GorillaReport.json")
-	writeErr := ioutil.WriteFile(reportPath, reportJSON, 0644)
+	// Write Items to disk as ManagedInstallReport.yaml
+	if err := os.MkdirAll(filepath.Dir(reportPath), 0755); err != nil {
+		fmt.Println("Unable to create the report directory:", err)
+	}
+	writeErr := ioutil.WriteFile(reportPath, reportYAML, 0644)
 	if writeErr != nil {
-		fmt.Println("Unable to write GorillaReport.json to disk:", writeErr)
+		fmt.Println("Unable to write ManagedInstallReport.yaml to disk:", writeErr)
 	}
 
+	// A failed submission is logged, it never fails the run
+	if reportURL != "" {
+		if err := Submit(reportURL); err != nil {
+			logging.Warn("Unable to submit the report", "url", reportURL, "error", err)
+		}
+	}
+}
+
+// CheckIn records a metadata only run. The report of the last full run is kept, with
+// LastCheckIn set and the identity of this machine updated, then saved and submitted.
+func CheckIn() {
+	saved := make(map[string]interface{})
+	if data, err := ioutil.ReadFile(reportPath); err == nil {
+		if err := yaml.Unmarshal(data, &saved); err != nil {
+			logging.Warn("Unable to read the last report, starting a new one", "path", reportPath, "error", err)
+			saved = make(map[string]interface{})
+		}
+	}
+	for key, value := range Items {
+		if key != "StartTime" {
+			saved[key] = value
+		}
+	}
+	saved["LastCheckIn"] = now().Format("2006-01-02 15:04:05 -0700")
+	if len(Errors) > 0 {
+		saved["CheckInErrors"] = Errors
+	} else {
+		delete(saved, "CheckInErrors")
+	}
+	Items = saved
+
+	reportYAML, err := yaml.Marshal(Items)
+	if err != nil {
+		fmt.Println("Unable to create ManagedInstallReport yaml", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(reportPath), 0755); err != nil {
+		fmt.Println("Unable to create the report directory:", err)
+	}
+	if err := ioutil.WriteFile(reportPath, reportYAML, 0644); err != nil {
+		fmt.Println("Unable to write ManagedInstallReport.yaml to disk:", err)
+	}
+
+	if reportURL != "" {
+		if err := Submit(reportURL); err != nil {
+			logging.Warn("Unable to submit the report", "url", reportURL, "error", err)
+		}
+	}
+}
+
+// Submit posts the report as JSON, retrying on errors
+func Submit(url string) error {
+	body, err := json.Marshal(Items)
+	if err != nil {
+		return fmt.Errorf("unable to encode the report: %v", err)
+	}
+
+	client := utils.NewClient(30 * time.Second)
+	return retry.Retry(submitRetry, func() error {
+		req, err := utils.NewAuthenticatedRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("server returned %s", resp.Status)
+		}
+		return nil
+	})
 }
 
 // Print writes the report to stdout instead of writing to disk
 // Used in check only mode
 func Print() {
 	// Compile everything
-	Items["InstalledItems"] = InstalledItems
-	Items["UninstalledItems"] = UninstalledItems
+	compile()
 
 	reportJSON, marshalErr := json.MarshalIndent(Items, "", "    ")
 	fmt.Println(string(reportJSON))
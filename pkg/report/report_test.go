@@ -0,0 +1,183 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/config"
+	"github.com/windowsadmins/gorilla/pkg/facts"
+	"gopkg.in/yaml.v3"
+)
+
+// resetReport clears the run record and points the report at a temp directory
+func resetReport(t *testing.T) string {
+	t.Helper()
+	origPath, origStatus, origHistory, origSerial, origRetry, origFacts := reportPath, statusPath, historyPath, serialNumber, submitRetry, machineFacts
+	reportPath = filepath.Join(t.TempDir(), "ManagedInstallReport.yaml")
+	statusPath = filepath.Join(filepath.Dir(reportPath), "status.json")
+	historyPath = filepath.Join(filepath.Dir(reportPath), "InstallHistory.yaml")
+	serialNumber = func() string { return "SN-1234" }
+	machineFacts = func() facts.Facts { return facts.Facts{Hostname: "PC01", Model: "Latitude 7440", Chassis: "laptop"} }
+	submitRetry.InitialInterval = time.Millisecond
+	fakeTime = time.Date(2024, 7, 9, 14, 30, 0, 0, time.UTC)
+
+	Items = make(map[string]interface{})
+	InstalledItems, UninstalledItems, PendingItems, Actions, Errors, Warnings, History = nil, nil, nil, nil, nil, nil, nil
+	RebootRequired, PendingReboot = false, nil
+	reportURL, clientIdentifier = "", ""
+
+	t.Cleanup(func() {
+		reportPath, statusPath, historyPath, serialNumber, submitRetry, machineFacts = origPath, origStatus, origHistory, origSerial, origRetry, origFacts
+		fakeTime = time.Time{}
+		reportURL, clientIdentifier = "", ""
+	})
+	return reportPath
+}
+
+// TestEndWritesYAML validates the run record is saved as ManagedInstallReport.yaml
+func TestEndWritesYAML(t *testing.T) {
+	path := resetReport(t)
+	Configure(config.Configuration{Manifest: "site_default"})
+
+	Start()
+	RecordAction("Firefox", "128.0", "install", nil)
+	RecordAction("Chrome", "126.0", "uninstall", errors.New("exit status 1603"))
+	RecordError("Failed to get manifest items")
+	RecordWarning("Skipped Example: supports arm64, this machine is x86_64")
+	RecordPendingReboot([]string{"Component Based Servicing"})
+	End()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("report was not written: %v", err)
+	}
+	var saved struct {
+		StartTime        string                 `yaml:"StartTime"`
+		EndTime          string                 `yaml:"EndTime"`
+		SerialNumber     string                 `yaml:"SerialNumber"`
+		ClientIdentifier string                 `yaml:"ClientIdentifier"`
+		GorillaVersion   string                 `yaml:"GorillaVersion"`
+		Actions          []Action               `yaml:"Actions"`
+		Errors           []string               `yaml:"Errors"`
+		Warnings         []string               `yaml:"Warnings"`
+		PendingReboot    []string               `yaml:"PendingReboot"`
+		Facts            map[string]interface{} `yaml:"Facts"`
+	}
+	if err := yaml.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+
+	if saved.StartTime != "2024-07-09 14:30:00 +0000" || saved.EndTime != saved.StartTime {
+		t.Errorf("unexpected timings: %s %s", saved.StartTime, saved.EndTime)
+	}
+	if saved.SerialNumber != "SN-1234" || saved.ClientIdentifier != "site_default" {
+		t.Errorf("unexpected identity: %s %s", saved.SerialNumber, saved.ClientIdentifier)
+	}
+	if len(saved.Actions) != 2 || !saved.Actions[0].Success || saved.Actions[1].Error != "exit status 1603" {
+		t.Errorf("unexpected actions: %+v", saved.Actions)
+	}
+	if len(saved.Errors) != 1 || len(saved.Warnings) != 1 {
+		t.Errorf("unexpected errors and warnings: %v %v", saved.Errors, saved.Warnings)
+	}
+	if len(saved.PendingReboot) != 1 || saved.PendingReboot[0] != "Component Based Servicing" {
+		t.Errorf("unexpected pending reboot: %v", saved.PendingReboot)
+	}
+	if saved.Facts["model"] != "Latitude 7440" || saved.Facts["chassis"] != "laptop" {
+		t.Errorf("unexpected facts: %v", saved.Facts)
+	}
+}
+
+// TestSubmit validates the report is posted as JSON and retried after a server error
+func TestSubmit(t *testing.T) {
+	resetReport(t)
+	var requests int32
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("invalid JSON: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	Configure(config.Configuration{ReportURL: server.URL, ClientIdentifier: "lab-42"})
+	Start()
+	RecordAction("Firefox", "128.0", "install", nil)
+	End()
+
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	if received["ClientIdentifier"] != "lab-42" || received["SerialNumber"] != "SN-1234" {
+		t.Errorf("unexpected report: %v", received)
+	}
+	if actions, ok := received["Actions"].([]interface{}); !ok || len(actions) != 1 {
+		t.Errorf("unexpected actions: %v", received["Actions"])
+	}
+}
+
+// TestSubmitFailure validates a server that keeps failing returns an error without stopping End
+func TestSubmitFailure(t *testing.T) {
+	path := resetReport(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	Start()
+	if err := Submit(server.URL); err == nil {
+		t.Errorf("expected an error when the server fails")
+	}
+
+	Configure(config.Configuration{ReportURL: server.URL})
+	End()
+	if _, err := ioutil.ReadFile(path); err != nil {
+		t.Errorf("report should be written when submission fails: %v", err)
+	}
+}
+
+// TestCheckIn validates a metadata only run keeps the last report and only sets when it checked in
+func TestCheckIn(t *testing.T) {
+	path := resetReport(t)
+	Start()
+	RecordAction("Firefox", "128.0", "install", nil)
+	End()
+
+	Items = make(map[string]interface{})
+	Actions = nil
+	fakeTime = fakeTime.Add(15 * time.Minute)
+	Start()
+	CheckIn()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("report was not written: %v", err)
+	}
+	var saved struct {
+		StartTime   string   `yaml:"StartTime"`
+		LastCheckIn string   `yaml:"LastCheckIn"`
+		Actions     []Action `yaml:"Actions"`
+	}
+	if err := yaml.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	if saved.StartTime != "2024-07-09 14:30:00 +0000" || saved.LastCheckIn != "2024-07-09 14:45:00 +0000" {
+		t.Errorf("unexpected timings: %s %s", saved.StartTime, saved.LastCheckIn)
+	}
+	if len(saved.Actions) != 1 || saved.Actions[0].Item != "Firefox" {
+		t.Errorf("the actions of the last run were not kept: %+v", saved.Actions)
+	}
+}
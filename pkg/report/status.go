@@ -0,0 +1,131 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/windowsadmins/gorilla/pkg/version"
+)
+
+// MetadataRun is the run type of a metadata only run, which checks in without checking items
+const MetadataRun = "metadataonly"
+
+// RunStatus summarizes the last run for monitoring agents, saved as status.json.
+// The fields are described in the Monitoring section of the README.
+type RunStatus struct {
+	LastRun             string `json:"last_run"`
+	RunType             string `json:"run_type"`
+	Success             bool   `json:"success"`
+	Pending             int    `json:"pending"`
+	RequiresInteractive int    `json:"requires_interactive"`
+	Failed              int    `json:"failed"`
+	RebootRequired      bool   `json:"reboot_required"`
+	PendingReboot       bool   `json:"pending_reboot"`
+	Version             string `json:"version"`
+	Error               string `json:"error,omitempty"`
+}
+
+var (
+	// PendingItems contains the items that need action but were left, such as in check only mode
+	PendingItems []interface{}
+
+	// RebootRequired is set when an installer asks for a reboot to finish
+	RebootRequired bool
+
+	// PendingReboot contains why Windows was already waiting for a reboot when the run started
+	PendingReboot []string
+
+	// This abstraction allows us to override when testing
+	statusPath = filepath.Join(os.Getenv("ProgramData"), "ManagedInstalls", "status.json")
+)
+
+// StatusPath returns where status.json is saved
+func StatusPath() string {
+	return statusPath
+}
+
+// Status summarizes the run so far. runErr is why the run stopped early, if it did.
+func Status(runType string, runErr error) RunStatus {
+	runStatus := RunStatus{
+		LastRun:             now().Format("2006-01-02T15:04:05Z07:00"),
+		RunType:             runType,
+		Pending:             len(PendingItems),
+		RequiresInteractive: len(InteractiveItems),
+		RebootRequired:      RebootRequired,
+		PendingReboot:       len(PendingReboot) > 0,
+		Version:             version.Version().Version,
+	}
+	for _, action := range Actions {
+		if !action.Success {
+			runStatus.Failed++
+		}
+	}
+
+	// A metadata only run doesn't check items, what the last full run found still holds
+	if runType == MetadataRun {
+		if previous, err := readRunStatus(); err == nil {
+			runStatus.Pending, runStatus.Failed = previous.Pending, previous.Failed
+			runStatus.RequiresInteractive = previous.RequiresInteractive
+			runStatus.RebootRequired = runStatus.RebootRequired || previous.RebootRequired
+			runStatus.PendingReboot = previous.PendingReboot
+		}
+	}
+
+	if runErr != nil {
+		runStatus.Error = runErr.Error()
+	}
+	runStatus.Success = runErr == nil && runStatus.Failed == 0
+	return runStatus
+}
+
+// WriteStatus saves the run summary to status.json. It is written to a temporary file
+// and renamed, so a monitoring agent never reads a partial file.
+func WriteStatus(runType string, runErr error) error {
+	data, err := json.MarshalIndent(Status(runType, runErr), "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode the status: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(statusPath), 0755); err != nil {
+		return fmt.Errorf("unable to create the status directory: %v", err)
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(statusPath), "status-*.json")
+	if err != nil {
+		return fmt.Errorf("unable to write the status: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(append(data, '\n'))
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write the status: %v", err)
+	}
+	if err := os.Chmod(tmpFile.Name(), 0644); err != nil {
+		return fmt.Errorf("unable to write the status: %v", err)
+	}
+	if err := os.Rename(tmpFile.Name(), statusPath); err != nil {
+		return fmt.Errorf("unable to replace the status: %v", err)
+	}
+	return nil
+}
+
+// ReadStatus returns the contents of status.json
+func ReadStatus() ([]byte, error) {
+	return ioutil.ReadFile(statusPath)
+}
+
+// readRunStatus returns the status of the last run
+func readRunStatus() (RunStatus, error) {
+	var runStatus RunStatus
+	data, err := ReadStatus()
+	if err != nil {
+		return runStatus, err
+	}
+	err = json.Unmarshal(data, &runStatus)
+	return runStatus, err
+}
@@ -0,0 +1,111 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// readStatus parses status.json
+func readStatus(t *testing.T) RunStatus {
+	t.Helper()
+	data, err := ReadStatus()
+	if err != nil {
+		t.Fatalf("unable to read status.json: %v", err)
+	}
+	var runStatus RunStatus
+	if err := json.Unmarshal(data, &runStatus); err != nil {
+		t.Fatalf("unable to parse status.json: %v", err)
+	}
+	return runStatus
+}
+
+// TestWriteStatus validates the counts of a run are saved to status.json
+func TestWriteStatus(t *testing.T) {
+	resetReport(t)
+	RecordAction("Firefox", "128.0", "install", nil)
+	RecordAction("Chrome", "126.0", "install", errors.New("exit status 1603"))
+	PendingItems = append(PendingItems, "Zoom", "Slack")
+	RebootRequired = true
+	RecordPendingReboot([]string{"Windows Update"})
+
+	if err := WriteStatus("auto", nil); err != nil {
+		t.Fatalf("WriteStatus failed: %v", err)
+	}
+
+	expected := RunStatus{
+		LastRun:        "2024-07-09T14:30:00Z",
+		RunType:        "auto",
+		Success:        false,
+		Pending:        2,
+		Failed:         1,
+		RebootRequired: true,
+		PendingReboot:  true,
+		Version:        "unknown",
+	}
+	if runStatus := readStatus(t); runStatus != expected {
+		t.Errorf("expected %+v, got %+v", expected, runStatus)
+	}
+}
+
+// TestWriteStatusAbort validates the status is written when a run stops before it starts
+func TestWriteStatusAbort(t *testing.T) {
+	resetReport(t)
+
+	if err := WriteStatus("checkonly", errors.New("preflight script failed")); err != nil {
+		t.Fatalf("WriteStatus failed: %v", err)
+	}
+
+	runStatus := readStatus(t)
+	if runStatus.Success || runStatus.Error != "preflight script failed" || runStatus.RunType != "checkonly" {
+		t.Errorf("expected a failed run with the error, got %+v", runStatus)
+	}
+}
+
+// TestWriteStatusReplaces validates the previous status is replaced and no temporary files are left
+func TestWriteStatusReplaces(t *testing.T) {
+	resetReport(t)
+	if err := WriteStatus("auto", errors.New("offline")); err != nil {
+		t.Fatalf("WriteStatus failed: %v", err)
+	}
+	if err := WriteStatus("auto", nil); err != nil {
+		t.Fatalf("WriteStatus failed: %v", err)
+	}
+
+	if runStatus := readStatus(t); !runStatus.Success || runStatus.Error != "" {
+		t.Errorf("expected the successful run, got %+v", runStatus)
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(StatusPath()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if file.Name() != "status.json" && file.Name() != "ManagedInstallReport.yaml" {
+			t.Errorf("unexpected file left behind: %s", file.Name())
+		}
+	}
+}
+
+// TestWriteStatusMetadataRun validates a metadata only run keeps what the last full run found
+func TestWriteStatusMetadataRun(t *testing.T) {
+	resetReport(t)
+	PendingItems = []interface{}{"Firefox", "Chrome"}
+	RebootRequired = true
+	if err := WriteStatus("auto", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	PendingItems, RebootRequired = nil, false
+	if err := WriteStatus(MetadataRun, nil); err != nil {
+		t.Fatal(err)
+	}
+	runStatus, err := readRunStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runStatus.RunType != MetadataRun || runStatus.Pending != 2 || !runStatus.RebootRequired || !runStatus.Success {
+		t.Errorf("unexpected status: %+v", runStatus)
+	}
+}
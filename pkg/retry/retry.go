@@ -1,10 +1,13 @@
-
 package retry
 
 import (
-    "time"
-    "log"
+    "context"
+    "errors"
     "fmt"
+    "log"
+    "math/rand"
+    "sync"
+    "time"
 )
 
 // RetryConfig defines the configuration for retry attempts
@@ -12,22 +15,138 @@ type RetryConfig struct {
     MaxRetries      int
     InitialInterval time.Duration
     Multiplier      float64
+
+    // Jitter randomizes each interval by up to this fraction of it,
+    // so 0.2 waits between 80% and 120% of the interval
+    Jitter float64
+
+    // MaxElapsedTime stops retrying once the next attempt would start after it, 0 means no limit
+    MaxElapsedTime time.Duration
+
+    // OnRetry is called with the attempt number and error before waiting for the next attempt.
+    // The failure is logged when it is not set.
+    OnRetry func(attempt int, err error)
+}
+
+var (
+    // These abstractions allow us to override when testing
+    sleep      = sleepContext
+    now        = time.Now
+    randFloat  = lockedFloat64
+    randMu     sync.Mutex
+    randSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// permanentError is an error that trying again won't fix
+type permanentError struct {
+    err error
+}
+
+func (p *permanentError) Error() string {
+    return p.err.Error()
+}
+
+func (p *permanentError) Unwrap() error {
+    return p.err
+}
+
+// Permanent wraps an error that trying again won't fix, such as a full disk,
+// so Retry returns it right away instead of attempting the action again
+func Permanent(err error) error {
+    if err == nil {
+        return nil
+    }
+    return &permanentError{err: err}
 }
 
 // Retry retries a given function with exponential backoff
 func Retry(config RetryConfig, action func() error) error {
+    return RetryWithContext(context.Background(), config, action)
+}
+
+// RetryWithContext retries a given function with exponential backoff,
+// stopping as soon as the context is done, even while waiting
+func RetryWithContext(ctx context.Context, config RetryConfig, action func() error) error {
     interval := config.InitialInterval
+    start := now()
 
-    for attempt := 1; attempt <= config.MaxRetries; attempt++ {
-        err := action()
+    maxRetries := config.MaxRetries
+    if maxRetries < 1 {
+        maxRetries = 1
+    }
+
+    var err error
+    attempt := 1
+    for ; ; attempt++ {
+        if ctxErr := ctx.Err(); ctxErr != nil {
+            return canceled(ctxErr, attempt-1, err)
+        }
+
+        err = action()
         if err == nil {
             return nil
         }
+        var permanent *permanentError
+        if errors.As(err, &permanent) {
+            return permanent.err
+        }
+        if attempt >= maxRetries {
+            break
+        }
 
-        log.Printf("[RETRY] Attempt %d/%d failed: %v. Retrying in %s...", attempt, config.MaxRetries, err, interval)
-        time.Sleep(interval)
+        wait := jitter(interval, config.Jitter)
+        if config.MaxElapsedTime > 0 && now().Sub(start)+wait > config.MaxElapsedTime {
+            break
+        }
+
+        if config.OnRetry != nil {
+            config.OnRetry(attempt, err)
+        } else {
+            log.Printf("[RETRY] Attempt %d/%d failed: %v. Retrying in %s...", attempt, maxRetries, err, wait)
+        }
+        if sleepErr := sleep(ctx, wait); sleepErr != nil {
+            return canceled(sleepErr, attempt, err)
+        }
         interval = time.Duration(float64(interval) * config.Multiplier)
     }
 
-    return fmt.Errorf("action failed after %d attempts", config.MaxRetries)
+    return fmt.Errorf("action failed after %d attempts: %w", attempt, err)
+}
+
+// canceled describes a retry stopped by its context
+func canceled(ctxErr error, attempts int, lastErr error) error {
+    if lastErr == nil {
+        return ctxErr
+    }
+    return fmt.Errorf("%w after %d attempts: %v", ctxErr, attempts, lastErr)
+}
+
+// jitter spreads an interval randomly by up to the given fraction
+func jitter(interval time.Duration, fraction float64) time.Duration {
+    if fraction <= 0 {
+        return interval
+    }
+    if fraction > 1 {
+        fraction = 1
+    }
+    return time.Duration(float64(interval) * (1 + fraction*(2*randFloat()-1)))
+}
+
+// sleepContext waits for the duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// lockedFloat64 returns a random number in [0, 1), safe for concurrent retries
+func lockedFloat64() float64 {
+    randMu.Lock()
+    defer randMu.Unlock()
+    return randSource.Float64()
 }
@@ -0,0 +1,168 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock replaces sleep and now, so schedules are checked without waiting
+type fakeClock struct {
+	current time.Time
+	slept   []time.Duration
+}
+
+func (c *fakeClock) use(t *testing.T, random float64) {
+	origSleep, origNow, origRand := sleep, now, randFloat
+	t.Cleanup(func() { sleep, now, randFloat = origSleep, origNow, origRand })
+
+	c.current = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sleep = func(ctx context.Context, d time.Duration) error {
+		c.slept = append(c.slept, d)
+		c.current = c.current.Add(d)
+		return ctx.Err()
+	}
+	now = func() time.Time { return c.current }
+	randFloat = func() float64 { return random }
+}
+
+// failing returns an action that fails a number of times before succeeding
+func failing(failures int, calls *int) func() error {
+	return func() error {
+		*calls++
+		if *calls <= failures {
+			return errors.New("server unavailable")
+		}
+		return nil
+	}
+}
+
+// TestRetrySchedule validates the exponential backoff and the OnRetry callback
+func TestRetrySchedule(t *testing.T) {
+	clock := &fakeClock{}
+	clock.use(t, 0.5)
+
+	var attempts []int
+	config := RetryConfig{
+		MaxRetries:      4,
+		InitialInterval: time.Second,
+		Multiplier:      2,
+		OnRetry:         func(attempt int, err error) { attempts = append(attempts, attempt) },
+	}
+	calls := 0
+	err := Retry(config, failing(10, &calls))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if calls != 4 {
+		t.Errorf("expected 4 attempts, got %d", calls)
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	if !reflect.DeepEqual(clock.slept, expected) {
+		t.Errorf("expected waits %v, got %v", expected, clock.slept)
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Errorf("unexpected OnRetry attempts: %v", attempts)
+	}
+}
+
+// TestRetrySuccess validates retrying stops at the first success
+func TestRetrySuccess(t *testing.T) {
+	clock := &fakeClock{}
+	clock.use(t, 0.5)
+
+	calls := 0
+	config := RetryConfig{MaxRetries: 5, InitialInterval: time.Second, Multiplier: 2}
+	if err := Retry(config, failing(2, &calls)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls != 3 || len(clock.slept) != 2 {
+		t.Errorf("expected 3 attempts and 2 waits, got %d and %v", calls, clock.slept)
+	}
+}
+
+// TestRetryJitter validates the interval is spread by the jitter fraction
+func TestRetryJitter(t *testing.T) {
+	tests := map[float64]time.Duration{
+		0:    800 * time.Millisecond,
+		0.5:  time.Second,
+		0.75: 1100 * time.Millisecond,
+	}
+	for random, expected := range tests {
+		clock := &fakeClock{}
+		clock.use(t, random)
+
+		calls := 0
+		config := RetryConfig{MaxRetries: 2, InitialInterval: time.Second, Multiplier: 2, Jitter: 0.2}
+		Retry(config, failing(10, &calls))
+		if len(clock.slept) != 1 || clock.slept[0] != expected {
+			t.Errorf("random %v: expected %v, got %v", random, expected, clock.slept)
+		}
+	}
+}
+
+// TestRetryMaxElapsedTime validates no attempt starts after the elapsed time limit
+func TestRetryMaxElapsedTime(t *testing.T) {
+	clock := &fakeClock{}
+	clock.use(t, 0.5)
+
+	calls := 0
+	config := RetryConfig{MaxRetries: 10, InitialInterval: time.Second, Multiplier: 2, MaxElapsedTime: 5 * time.Second}
+	if err := Retry(config, failing(10, &calls)); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	// 1s and 2s fit in 5s, the 4s wait after them would not
+	expected := []time.Duration{time.Second, 2 * time.Second}
+	if calls != 3 || !reflect.DeepEqual(clock.slept, expected) {
+		t.Errorf("expected 3 attempts with waits %v, got %d with %v", expected, calls, clock.slept)
+	}
+}
+
+// TestRetryWithContextCanceled validates a canceled context interrupts the wait
+func TestRetryWithContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	action := func() error {
+		calls++
+		cancel()
+		return errors.New("server unavailable")
+	}
+
+	started := time.Now()
+	config := RetryConfig{MaxRetries: 3, InitialInterval: time.Hour, Multiplier: 2}
+	err := RetryWithContext(ctx, config, action)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if calls != 1 || time.Since(started) > time.Minute {
+		t.Errorf("expected one attempt without waiting, got %d in %s", calls, time.Since(started))
+	}
+
+	calls = 0
+	if err := RetryWithContext(ctx, config, action); !errors.Is(err, context.Canceled) || calls != 0 {
+		t.Errorf("expected no attempts with a canceled context, got %d: %v", calls, err)
+	}
+}
+
+// TestRetryPermanent validates a permanent error is returned after one attempt, unwrapped
+func TestRetryPermanent(t *testing.T) {
+	clock := &fakeClock{}
+	clock.use(t, 0.5)
+
+	diskFull := errors.New("disk full")
+	calls := 0
+	err := Retry(RetryConfig{MaxRetries: 3, InitialInterval: time.Second, Multiplier: 2}, func() error {
+		calls++
+		return Permanent(diskFull)
+	})
+	if err != diskFull || calls != 1 || len(clock.slept) != 0 {
+		t.Errorf("expected the error after one attempt, got %d attempts: %v", calls, err)
+	}
+	if Permanent(nil) != nil {
+		t.Error("expected Permanent(nil) to be nil")
+	}
+}
@@ -0,0 +1,43 @@
+// Package runlock keeps runs of managedsoftwareupdate from overlapping, such as a scheduled
+// metadata only run that starts while a full run is installing
+package runlock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked is returned by Acquire when another run holds the lock
+var ErrLocked = errors.New("another run is in progress")
+
+// DefaultPath is the lock every run of managedsoftwareupdate shares
+var DefaultPath = filepath.Join(os.Getenv("ProgramData"), "ManagedInstalls", "managedsoftwareupdate.lock")
+
+// Lock is held from Acquire until it is released or the process exits,
+// a run that crashes never leaves a stale lock
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes the lock at path without waiting, or returns ErrLocked when another run holds it
+func Acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{file: file}, nil
+}
+
+// Release gives up the lock
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
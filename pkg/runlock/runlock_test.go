@@ -0,0 +1,28 @@
+package runlock
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestAcquire validates a second run can't take the lock until the first releases it
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ManagedInstalls", "managedsoftwareupdate.lock")
+
+	first, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("unable to take the lock: %v", err)
+	}
+	if _, err := Acquire(path); err != ErrLocked {
+		t.Fatalf("expected ErrLocked while the lock is held, got %v", err)
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("unable to release the lock: %v", err)
+	}
+	second, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("unable to take the released lock: %v", err)
+	}
+	second.Release()
+}
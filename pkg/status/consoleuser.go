@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package status
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// noSession is returned by WTSGetActiveConsoleSessionId when no session is attached to the console
+const noSession = 0xFFFFFFFF
+
+// consoleUser returns the user logged on at the console, if there is one
+func consoleUser() (ConsoleUser, bool) {
+	sessionID := windows.WTSGetActiveConsoleSessionId()
+	if sessionID == noSession {
+		return ConsoleUser{}, false
+	}
+
+	// There is no token for the session when nobody is logged on at the console
+	var token windows.Token
+	if err := windows.WTSQueryUserToken(sessionID, &token); err != nil {
+		return ConsoleUser{}, false
+	}
+	defer token.Close()
+
+	tokenUser, err := token.GetTokenUser()
+	if err != nil {
+		return ConsoleUser{}, false
+	}
+	user := ConsoleUser{SID: tokenUser.User.Sid.String(), SessionID: sessionID}
+	if account, domain, _, err := tokenUser.User.Sid.LookupAccount(""); err == nil {
+		user.Name = domain + `\` + account
+	}
+	user.Profile, err = token.GetUserProfileDirectory()
+	if err != nil {
+		return ConsoleUser{}, false
+	}
+	return user, true
+}
@@ -0,0 +1,10 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package status
+
+func consoleUser() (ConsoleUser, bool) {
+	return ConsoleUser{}, false
+}
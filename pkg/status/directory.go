@@ -0,0 +1,53 @@
+package status
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/utils"
+)
+
+// checkDirectory checks a file check of the directory type. An install is needed when the directory
+// is missing or has fewer files or megabytes than the check asks for, an update only when it is there
+// but short, and an uninstall when it is there.
+func checkDirectory(checkDir catalog.FileCheck, path, installType string) (actionNeeded bool, checkErr error) {
+	logging.Debug("Check directory path:", path)
+	info, err := os.Stat(utils.LongPath(path))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err != nil || !info.IsDir() {
+		logging.Debug("Directory is missing:", path)
+		return installType == "install", nil
+	}
+	if installType == "uninstall" {
+		return true, nil
+	}
+
+	files, size, err := directoryContents(path)
+	if err != nil {
+		return false, err
+	}
+	logging.Debug("Check directory contents", "path", path, "files", files, "bytes", size)
+	if files < checkDir.MinFiles || size < int64(checkDir.MinSizeMB)*1024*1024 {
+		return true, nil
+	}
+	return false, nil
+}
+
+// directoryContents counts the files in a directory and its subdirectories and adds up their sizes
+func directoryContents(path string) (files int, size int64, err error) {
+	err = filepath.Walk(utils.LongPath(path), func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	return files, size, err
+}
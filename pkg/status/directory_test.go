@@ -0,0 +1,71 @@
+package status
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+)
+
+// TestCheckDirectory validates a directory check needs an install until the directory
+// has enough files and megabytes, and an uninstall whenever it exists
+func TestCheckDirectory(t *testing.T) {
+	root := t.TempDir()
+	writeFiles := func(dir string, count, size int) string {
+		path := filepath.Join(root, dir)
+		if err := os.MkdirAll(filepath.Join(path, "sub"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < count; i++ {
+			name := filepath.Join(path, "sub", strings.Repeat("f", i+1)+".ttf")
+			if err := os.WriteFile(name, make([]byte, size), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+	empty := writeFiles("empty", 0, 0)
+	partial := writeFiles("partial", 2, 1024*1024)
+	full := writeFiles("full", 3, 1024*1024)
+	missing := filepath.Join(root, "missing")
+
+	tests := []struct {
+		name        string
+		path        string
+		installType string
+		expected    bool
+	}{
+		{"empty install", empty, "install", true},
+		{"partial install", partial, "install", true},
+		{"full install", full, "install", false},
+		{"missing install", missing, "install", true},
+		{"partial update", partial, "update", true},
+		{"full update", full, "update", false},
+		{"missing update", missing, "update", false},
+		{"empty uninstall", empty, "uninstall", true},
+		{"full uninstall", full, "uninstall", true},
+		{"missing uninstall", missing, "uninstall", false},
+	}
+	for _, tt := range tests {
+		item := catalog.Item{
+			Name:  "Fonts",
+			Check: catalog.InstallCheck{File: []catalog.FileCheck{{Path: tt.path, Type: pkginfo.DirectoryCheck, MinFiles: 3, MinSizeMB: 3}}},
+		}
+		actionNeeded, err := checkPath(item, tt.installType)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if actionNeeded != tt.expected {
+			t.Errorf("%s: expected action needed %v, got %v", tt.name, tt.expected, actionNeeded)
+		}
+	}
+
+	// Without thresholds an empty directory is installed
+	item := catalog.Item{Name: "Plugins", Check: catalog.InstallCheck{File: []catalog.FileCheck{{Path: empty, Type: pkginfo.DirectoryCheck}}}}
+	if actionNeeded, _ := checkPath(item, "install"); actionNeeded {
+		t.Error("expected an existing directory without thresholds to need no install")
+	}
+}
@@ -0,0 +1,49 @@
+package status
+
+import (
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/regfile"
+)
+
+// rebootKeys are keys that only exist while Windows waits for a reboot, by the reason they give
+var rebootKeys = []struct {
+	path   string
+	reason string
+}{
+	{`HKLM\SOFTWARE\Microsoft\Windows\CurrentVersion\Component Based Servicing\RebootPending`, "Component Based Servicing"},
+	{`HKLM\SOFTWARE\Microsoft\Windows\CurrentVersion\WindowsUpdate\Auto Update\RebootRequired`, "Windows Update"},
+}
+
+// sessionManagerKey has PendingFileRenameOperations while files wait to be replaced at the next boot
+const sessionManagerKey = `HKLM\SYSTEM\CurrentControlSet\Control\Session Manager`
+
+var (
+	// This abstraction allows us to override when testing
+	registryKeyExists = regfile.KeyExists
+)
+
+// PendingReboot returns why Windows is waiting for a reboot, such as to finish Windows Update,
+// or nothing when it isn't. An indicator that can't be read is logged and left out.
+func PendingReboot() []string {
+	var reasons []string
+	for _, key := range rebootKeys {
+		exists, err := registryKeyExists(key.path)
+		if err != nil {
+			logging.Warn("Unable to check for a pending reboot", "key", key.path, "error", err)
+			continue
+		}
+		if exists {
+			reasons = append(reasons, key.reason)
+		}
+	}
+
+	value, found, err := registryReadValue(sessionManagerKey, "PendingFileRenameOperations")
+	if err != nil {
+		logging.Warn("Unable to check for a pending reboot", "key", sessionManagerKey, "error", err)
+	} else if found && strings.TrimSpace(value.String()) != "" {
+		reasons = append(reasons, "Pending file rename operations")
+	}
+	return reasons
+}
@@ -0,0 +1,53 @@
+package status
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/regfile"
+)
+
+// fakeRebootRegistry overrides the registry reads with the keys that exist
+// and the PendingFileRenameOperations data
+func fakeRebootRegistry(t *testing.T, keys map[string]bool, renames string, keyErr error) {
+	origKeyExists, origReadValue := registryKeyExists, registryReadValue
+	t.Cleanup(func() { registryKeyExists, registryReadValue = origKeyExists, origReadValue })
+	registryKeyExists = func(path string) (bool, error) {
+		return keys[path], keyErr
+	}
+	registryReadValue = func(path, name string) (regfile.Value, bool, error) {
+		if path != sessionManagerKey || name != "PendingFileRenameOperations" || renames == "" {
+			return regfile.Value{}, false, nil
+		}
+		return regfile.Value{Name: name, Type: regfile.TypeMultiString, Data: append(utf16Bytes(renames), 0, 0, 0, 0)}, true, nil
+	}
+}
+
+// utf16Bytes encodes ASCII text as the registry stores strings
+func utf16Bytes(text string) []byte {
+	var data []byte
+	for _, c := range []byte(text) {
+		data = append(data, c, 0)
+	}
+	return data
+}
+
+// TestPendingReboot validates each indicator is reported with its reason
+func TestPendingReboot(t *testing.T) {
+	fakeRebootRegistry(t, nil, "", nil)
+	if reasons := PendingReboot(); reasons != nil {
+		t.Errorf("expected no pending reboot, got %v", reasons)
+	}
+
+	fakeRebootRegistry(t, map[string]bool{rebootKeys[1].path: true}, `\??\C:\Windows\Temp\old.dll`, nil)
+	expected := []string{"Windows Update", "Pending file rename operations"}
+	if reasons := PendingReboot(); !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("expected %v, got %v", expected, reasons)
+	}
+
+	fakeRebootRegistry(t, map[string]bool{rebootKeys[0].path: true}, "", errors.New("access denied"))
+	if reasons := PendingReboot(); reasons != nil {
+		t.Errorf("expected the unreadable keys to be left out, got %v", reasons)
+	}
+}
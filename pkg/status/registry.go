@@ -4,6 +4,8 @@
 package status
 
 import (
+	"errors"
+
 	"github.com/windowsadmins/gorilla/pkg/logging"
 	registry "golang.org/x/sys/windows/registry"
 )
@@ -30,17 +32,34 @@ func checkValues(values []string) (valuesExist bool) {
 }
 
 func getUninstallKeys() (installedItems map[string]RegistryApplication, checkErr error) {
-	// Initialize the map we will add any values to
-	installedItems = make(map[string]RegistryApplication)
-
 	// Both Uninstall paths (64 & 32 bits apps)
 	regPaths := []string{`Software\Microsoft\Windows\CurrentVersion\Uninstall`,
 		`Software\Wow6432Node\Microsoft\Windows\CurrentVersion\Uninstall`}
 
+	return readUninstallKeys(registry.LOCAL_MACHINE, regPaths)
+}
+
+// getUserUninstallKeys reads the applications a user installed for themselves,
+// from their HKCU loaded under HKEY_USERS\<SID>
+func getUserUninstallKeys(sid string) (map[string]RegistryApplication, error) {
+	regPaths := []string{sid + `\Software\Microsoft\Windows\CurrentVersion\Uninstall`}
+	return readUninstallKeys(registry.USERS, regPaths)
+}
+
+// readUninstallKeys reads the applications registered under the Uninstall keys of a hive,
+// skipping keys that don't exist
+func readUninstallKeys(root registry.Key, regPaths []string) (installedItems map[string]RegistryApplication, checkErr error) {
+	// Initialize the map we will add any values to
+	installedItems = make(map[string]RegistryApplication)
+
 	for _, regPath := range regPaths {
 
-		// Get the Uninstall key from HKLM
-		key, checkErr := registry.OpenKey(registry.LOCAL_MACHINE, regPath, registry.READ)
+		// Get the Uninstall key from the hive
+		key, checkErr := registry.OpenKey(root, regPath, registry.READ)
+		if errors.Is(checkErr, registry.ErrNotExist) {
+			logging.Debug("No registry key:", regPath)
+			continue
+		}
 		if checkErr != nil {
 			logging.Warn("Unable to read registry key:", checkErr)
 			return installedItems, checkErr
@@ -60,7 +79,7 @@ func getUninstallKeys() (installedItems map[string]RegistryApplication, checkErr
 			//  installedItem is the struct we will store each application in
 			var installedItem RegistryApplication
 			itemKeyName := regPath + `\` + item
-			itemKey, checkErr := registry.OpenKey(registry.LOCAL_MACHINE, itemKeyName, registry.READ)
+			itemKey, checkErr := registry.OpenKey(root, itemKeyName, registry.READ)
 			if checkErr != nil {
 				logging.Warn("Unable to read registry key:", checkErr)
 				return installedItems, checkErr
@@ -94,6 +113,13 @@ func getUninstallKeys() (installedItems map[string]RegistryApplication, checkErr
 					logging.Warn("Unable to read UninstallString", checkErr)
 					return installedItems, checkErr
 				}
+
+				// Publisher and QuietUninstallString are optional, and msi products are registered under their product code
+				installedItem.Publisher, _, _ = itemKey.GetStringValue("Publisher")
+				installedItem.QuietUninstall, _, _ = itemKey.GetStringValue("QuietUninstallString")
+				if windowsInstaller, _, err := itemKey.GetIntegerValue("WindowsInstaller"); err == nil && windowsInstaller == 1 {
+					installedItem.ProductCode = item
+				}
 				installedItems[installedItem.Name] = installedItem
 			}
 		}
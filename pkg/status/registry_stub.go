@@ -8,3 +8,7 @@ package status
 func getUninstallKeys() (map[string]RegistryApplication, error) {
 	return nil, nil
 }
+
+func getUserUninstallKeys(sid string) (map[string]RegistryApplication, error) {
+	return nil, nil
+}
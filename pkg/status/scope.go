@@ -0,0 +1,91 @@
+package status
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+)
+
+const (
+	// ScopeMachine items are installed for every user, the default
+	ScopeMachine = "machine"
+	// ScopeUser items are installed in the profile and HKCU of the user logged on at the console
+	ScopeUser = "user"
+)
+
+// ErrNoConsoleUser is returned when a user scoped item is checked while nobody is logged on
+var ErrNoConsoleUser = errors.New("no user is logged on to install for")
+
+// ConsoleUser is the user logged on at the console, who user scoped items are checked and installed for
+type ConsoleUser struct {
+	Name      string
+	SID       string
+	SessionID uint32
+	Profile   string
+}
+
+var (
+	// ActiveConsoleUser returns the user logged on at the console, if there is one
+	ActiveConsoleUser = consoleUser
+
+	// This abstraction allows us to override when testing
+	userUninstallKeys = getUserUninstallKeys
+)
+
+// UserScoped returns true when an item is installed for the console user rather than the machine
+func UserScoped(item catalog.Item) bool {
+	return strings.EqualFold(strings.TrimSpace(item.InstallScope), ScopeUser)
+}
+
+// scopeUser returns the user an item is checked for, nil for machine scoped items
+func scopeUser(item catalog.Item) (*ConsoleUser, error) {
+	if !UserScoped(item) {
+		return nil, nil
+	}
+	user, ok := ActiveConsoleUser()
+	if !ok {
+		return nil, ErrNoConsoleUser
+	}
+	return &user, nil
+}
+
+// scopedRegistryItems returns the applications registered in HKLM, or in the
+// HKCU of the console user for user scoped items
+func scopedRegistryItems(item catalog.Item) (map[string]RegistryApplication, error) {
+	user, err := scopeUser(item)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return registryItems()
+	}
+	return userUninstallKeys(user.SID)
+}
+
+// userProfileVariable matches the %NAME% variables that point into a user's profile
+var userProfileVariable = regexp.MustCompile(`(?i)%(USERPROFILE|LOCALAPPDATA|APPDATA)%`)
+
+// scopedExpandEnv replaces %NAME% variables in a path. For user scoped items the
+// profile variables point to the console user's profile rather than the one gorilla runs as.
+func scopedExpandEnv(item catalog.Item, path string) (string, error) {
+	user, err := scopeUser(item)
+	if err != nil {
+		return "", err
+	}
+	if user != nil {
+		path = userProfileVariable.ReplaceAllStringFunc(path, func(match string) string {
+			switch strings.ToUpper(match) {
+			case "%LOCALAPPDATA%":
+				return filepath.Join(user.Profile, "AppData", "Local")
+			case "%APPDATA%":
+				return filepath.Join(user.Profile, "AppData", "Roaming")
+			default:
+				return user.Profile
+			}
+		})
+	}
+	return expandEnv(path), nil
+}
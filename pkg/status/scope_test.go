@@ -0,0 +1,116 @@
+package status
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/windowsadmins/gorilla/pkg/catalog"
+)
+
+// fakeHKCU is the HKCU Uninstall key of the console user in the scope tests
+var fakeHKCU = map[string]map[string]RegistryApplication{
+	"S-1-5-21-1000": {
+		"Microsoft Visual Studio Code (User)": {
+			Name:    "Microsoft Visual Studio Code (User)",
+			Version: "1.90.0",
+		},
+	},
+}
+
+// useConsoleUser fakes the console user and their HKCU for the duration of the test,
+// with nobody logged on when profile is empty
+func useConsoleUser(t *testing.T, profile string) {
+	origUser, origKeys, origItems := ActiveConsoleUser, userUninstallKeys, RegistryItems
+	t.Cleanup(func() {
+		ActiveConsoleUser, userUninstallKeys, RegistryItems = origUser, origKeys, origItems
+	})
+
+	// The machine has nothing installed, so only HKCU can satisfy a check
+	RegistryItems = map[string]RegistryApplication{"Other": {Name: "Other", Version: "1.0"}}
+	ActiveConsoleUser = func() (ConsoleUser, bool) {
+		if profile == "" {
+			return ConsoleUser{}, false
+		}
+		return ConsoleUser{Name: `EXAMPLE\jdoe`, SID: "S-1-5-21-1000", SessionID: 1, Profile: profile}, true
+	}
+	userUninstallKeys = func(sid string) (map[string]RegistryApplication, error) {
+		return fakeHKCU[sid], nil
+	}
+}
+
+// userItem returns a user scoped item checked by the given registry version
+func userItem(registryVersion string) catalog.Item {
+	return catalog.Item{
+		Name:         "VSCodeUser",
+		DisplayName:  "VS Code (User)",
+		InstallScope: "User",
+		Check: catalog.InstallCheck{
+			Registry: catalog.RegCheck{Name: "Visual Studio Code (User)", Version: registryVersion},
+		},
+	}
+}
+
+// TestUserScopedRegistry validates user scoped items are checked in the console user's HKCU
+func TestUserScopedRegistry(t *testing.T) {
+	useConsoleUser(t, t.TempDir())
+
+	tests := map[string]bool{"1.90.0": false, "1.80.0": false, "1.91.0": true}
+	for registryVersion, expected := range tests {
+		actionNeeded, err := CheckStatus(userItem(registryVersion), "install", t.TempDir())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", registryVersion, err)
+		}
+		if actionNeeded != expected {
+			t.Errorf("%s: expected actionNeeded %v, got %v", registryVersion, expected, actionNeeded)
+		}
+	}
+
+	// The same item for the machine is not installed
+	machineItem := userItem("1.90.0")
+	machineItem.InstallScope = ScopeMachine
+	if actionNeeded, _ := CheckStatus(machineItem, "install", t.TempDir()); !actionNeeded {
+		t.Error("expected the machine scoped item to need installing")
+	}
+}
+
+// TestUserScopedFile validates profile variables in file checks point to the console user's profile
+func TestUserScopedFile(t *testing.T) {
+	profile := t.TempDir()
+	useConsoleUser(t, profile)
+
+	codePath := filepath.Join(profile, "AppData", "Local", "Programs", "Microsoft VS Code", "Code.exe")
+	if err := os.MkdirAll(filepath.Dir(codePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(codePath, []byte("code"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	item := catalog.Item{
+		Name:         "VSCodeUser",
+		InstallScope: ScopeUser,
+		Check: catalog.InstallCheck{
+			File: []catalog.FileCheck{{Path: "%LOCALAPPDATA%/Programs/Microsoft VS Code/Code.exe"}},
+		},
+	}
+	actionNeeded, err := CheckStatus(item, "install", t.TempDir())
+	if err != nil || actionNeeded {
+		t.Errorf("expected no action for a file in the user's profile, got %v, %v", actionNeeded, err)
+	}
+
+	expanded, _ := scopedExpandEnv(item, "%APPDATA%/x;%UserProfile%/y")
+	if expected := filepath.Join(profile, "AppData", "Roaming") + "/x;" + profile + "/y"; expanded != expected {
+		t.Errorf("expected %s, got %s", expected, expanded)
+	}
+}
+
+// TestUserScopedNoConsoleUser validates user scoped items can't be checked while nobody is logged on
+func TestUserScopedNoConsoleUser(t *testing.T) {
+	useConsoleUser(t, "")
+
+	if _, err := CheckStatus(userItem("1.90.0"), "install", t.TempDir()); !errors.Is(err, ErrNoConsoleUser) {
+		t.Errorf("expected ErrNoConsoleUser, got %v", err)
+	}
+}
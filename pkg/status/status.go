@@ -2,15 +2,23 @@ package status
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/windowsadmins/gorilla/pkg/catalog"
 	"github.com/windowsadmins/gorilla/pkg/download"
 	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/pkginfo"
+	"github.com/windowsadmins/gorilla/pkg/regfile"
+	"github.com/windowsadmins/gorilla/pkg/utils"
 	version "github.com/hashicorp/go-version"
 )
 
@@ -22,6 +30,14 @@ type RegistryApplication struct {
 	Source    string
 	Uninstall string
 	Version   string
+	Publisher string
+
+	// QuietUninstall is the QuietUninstallString some installers, such as NSIS and Inno Setup,
+	// register to uninstall without prompts
+	QuietUninstall string
+
+	// ProductCode is set for applications installed by an msi
+	ProductCode string
 }
 
 // WindowsMetadata contains extended metadata retrieved in the `properties.go`
@@ -33,14 +49,33 @@ type WindowsMetadata struct {
 	versionMinor  int
 	versionPatch  int
 	versionBuild  int
+
+	// locked is set when the file exists but a running app holds it open,
+	// so its product, company and version are unknown
+	locked bool
+}
+
+// ProductName returns the "ProductName" of the file
+func (m WindowsMetadata) ProductName() string {
+	return m.productName
+}
+
+// CompanyName returns the "CompanyName" of the file, its publisher
+func (m WindowsMetadata) CompanyName() string {
+	return m.companyName
 }
 
 var (
 	// RegistryItems contains the status of all of the applications in the registry
 	RegistryItems map[string]RegistryApplication
 
+	// registryMu guards RegistryItems, items may be checked concurrently
+	registryMu sync.Mutex
+
 	// Abstracted functions so we can override these in unit tests
-	execCommand = exec.Command
+	execCommand       = exec.Command
+	registryReadValue = regfile.ReadValue
+	fileMetadata      = GetFileMetadata
 )
 
 // checkRegistry iterates through the local registry and compiles all installed software
@@ -53,31 +88,126 @@ func checkRegistry(catalogItem catalog.Item, installType string) (actionNeeded b
 	}
 
 	logging.Debug("Check registry version:", checkReg.Version)
-	// If needed, populate applications status from the registry
-	if len(RegistryItems) == 0 {
-		RegistryItems, checkErr = getUninstallKeys()
+	// If needed, populate applications status from the registry, of the console user for user scoped items
+	registryApps, checkErr := scopedRegistryItems(catalogItem)
+	if errors.Is(checkErr, ErrNoConsoleUser) {
+		return false, checkErr
 	}
 
-	var installed bool
 	var versionMatch bool
-	for _, regItem := range RegistryItems {
-		// Check if the catalog name is in the registry
-		if strings.Contains(regItem.Name, checkReg.Name) {
-			installed = true
-			logging.Debug("Current installed version:", regItem.Version)
-
-			// Check if the catalog version matches the registry
-			currentVersion, err := version.NewVersion(regItem.Version)
-			if err != nil {
-				logging.Warn("Unable to parse current version", err)
-			}
-			outdated := currentVersion.LessThan(catalogVersion)
-			if !outdated {
-				versionMatch = true
-			}
-			break
+	regItem, installed := bestRegistryMatch(registryApps, checkReg.Name, checkReg.ExactMatch)
+	if installed {
+		logging.Debug("Current installed version:", regItem.Name, regItem.Version)
+
+		// Check if the catalog version matches the registry
+		currentVersion, err := version.NewVersion(regItem.Version)
+		if err != nil {
+			logging.Warn("Unable to parse current version", err)
+		}
+		outdated := currentVersion.LessThan(catalogVersion)
+		if !outdated {
+			versionMatch = true
+		}
+	}
+
+	if installType == "update" && !installed {
+		actionNeeded = false
+	} else if installType == "uninstall" {
+		actionNeeded = installed
+	} else if installed && versionMatch {
+		actionNeeded = false
+	} else {
+		actionNeeded = true
+	}
+
+	return actionNeeded, checkErr
+}
+
+// bestRegistryMatch returns the application a registry check is for. A display name equal to
+// the check name, ignoring case, is preferred. Otherwise the closest name that contains it is
+// used, the shortest, so "Microsoft Edge" is not taken for "Microsoft Edge WebView2 Runtime".
+// Only equal names match when exact is set.
+func bestRegistryMatch(apps map[string]RegistryApplication, name string, exact bool) (RegistryApplication, bool) {
+	if name == "" {
+		return RegistryApplication{}, false
+	}
+	var matches []RegistryApplication
+	for _, app := range apps {
+		if strings.EqualFold(app.Name, name) || (!exact && strings.Contains(app.Name, name)) {
+			matches = append(matches, app)
+		}
+	}
+	if len(matches) == 0 {
+		return RegistryApplication{}, false
+	}
+
+	// The map is in no order, sort so the same match is picked every run
+	sort.Slice(matches, func(i, j int) bool {
+		iExact, jExact := strings.EqualFold(matches[i].Name, name), strings.EqualFold(matches[j].Name, name)
+		if iExact != jExact {
+			return iExact
+		}
+		if len(matches[i].Name) != len(matches[j].Name) {
+			return len(matches[i].Name) < len(matches[j].Name)
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	if len(matches) > 1 {
+		var others []string
+		for _, app := range matches[1:] {
+			others = append(others, app.Name)
 		}
+		logging.Debug("Registry check", name, "matches", matches[0].Name, "over", strings.Join(others, ", "))
+	}
+	return matches[0], true
+}
+
+// checkRegistryValue checks a value of a key, such as one a reg item sets. The item is installed
+// when the value exists and, if the check has data, when the value has that data.
+func checkRegistryValue(catalogItem catalog.Item, installType string) (actionNeeded bool, checkErr error) {
+	checkReg := catalogItem.Check.Registry
+	logging.Debug("Check registry value:", checkReg.Key, checkReg.Value)
+	value, found, err := registryReadValue(checkReg.Key, checkReg.Value)
+	if err != nil {
+		return false, err
+	}
 
+	installed := found
+	if found && checkReg.Data != "" {
+		logging.Debug("Current registry data:", value.String())
+		installed = value.String() == checkReg.Data
+	}
+
+	if installType == "update" && !found {
+		actionNeeded = false
+	} else if installType == "uninstall" {
+		actionNeeded = found
+	} else {
+		actionNeeded = !installed
+	}
+
+	return actionNeeded, nil
+}
+
+// checkProductCode checks an msi item by the product code it is registered under,
+// for items without any other check
+func checkProductCode(catalogItem catalog.Item, installType string) (actionNeeded bool, checkErr error) {
+	logging.Debug("Check product code:", catalogItem.ProductCode)
+	registryApps, checkErr := scopedRegistryItems(catalogItem)
+	if errors.Is(checkErr, ErrNoConsoleUser) {
+		return false, checkErr
+	}
+
+	var installed bool
+	var versionMatch bool
+	for _, regItem := range registryApps {
+		if !strings.EqualFold(regItem.ProductCode, catalogItem.ProductCode) {
+			continue
+		}
+		installed = true
+		logging.Debug("Current installed version:", regItem.Version)
+		versionMatch = !catalog.NewerVersion(catalogItem.Version, regItem.Version)
+		break
 	}
 
 	if installType == "update" && !installed {
@@ -93,11 +223,106 @@ func checkRegistry(catalogItem catalog.Item, installType string) (actionNeeded b
 	return actionNeeded, checkErr
 }
 
+// registryItems returns the applications in the registry, reading them only once
+func registryItems() (map[string]RegistryApplication, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	var err error
+	if len(RegistryItems) == 0 {
+		RegistryItems, err = getUninstallKeys()
+	}
+	return RegistryItems, err
+}
+
+// ResetRegistryItems clears the applications read from the registry,
+// so the next check reads them again
+func ResetRegistryItems() {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	RegistryItems = nil
+}
+
+// InstalledApplications reads the registry again and returns the applications
+// registered under the Uninstall keys of HKLM, by their display name
+func InstalledApplications() (map[string]RegistryApplication, error) {
+	return getUninstallKeys()
+}
+
+// FindApplication reads the registry again and returns the application with a display name,
+// or the only one whose display name contains it, for the authoring tools
+func FindApplication(displayName string) (RegistryApplication, error) {
+	apps, err := InstalledApplications()
+	if err != nil {
+		return RegistryApplication{}, fmt.Errorf("unable to read the installed applications: %v", err)
+	}
+
+	var matches []string
+	for name, app := range apps {
+		if strings.EqualFold(name, displayName) {
+			return app, nil
+		}
+		if strings.Contains(strings.ToLower(name), strings.ToLower(displayName)) {
+			matches = append(matches, name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return RegistryApplication{}, fmt.Errorf("no installed application named %q", displayName)
+	case 1:
+		return apps[matches[0]], nil
+	}
+	sort.Strings(matches)
+	return RegistryApplication{}, fmt.Errorf("%q matches more than one installed application: %s", displayName, strings.Join(matches, ", "))
+}
+
+// InstalledApplication reads the registry again and returns the application
+// whose name contains the given name, matched the same way as registry checks
+func InstalledApplication(name string) (RegistryApplication, bool) {
+	installedItems, err := getUninstallKeys()
+	if err != nil {
+		logging.Warn("Unable to read the installed applications:", err)
+	}
+	return bestRegistryMatch(installedItems, name, false)
+}
+
+// checkScript runs the installcheck script of an item. Exit 0 means the item is not installed:
+// an install is needed, and there is nothing to uninstall. Any other exit code means it is installed.
 func checkScript(catalogItem catalog.Item, cachePath string, installType string) (actionNeeded bool, checkErr error) {
+	cmdSuccess, checkErr := runCheckScript(catalogItem.Check.Script, cachePath)
+	if checkErr != nil {
+		return false, checkErr
+	}
 
-	// Write InstallCheckScript to disk as a Powershell file
-	tmpScript := filepath.Join(cachePath, "tmpCheckScript.ps1")
-	ioutil.WriteFile(tmpScript, []byte(catalogItem.Check.Script), 0755)
+	actionNeeded = false
+	// Application not installed if exit 0
+	if installType == "uninstall" {
+		actionNeeded = !cmdSuccess
+	} else if installType == "install" {
+		actionNeeded = cmdSuccess
+	}
+
+	return actionNeeded, checkErr
+}
+
+// checkUninstallScript runs the uninstallcheck script of an item, for uninstalls only.
+// Exit 0 means the item is installed and needs to be uninstalled, any other exit code means it doesn't.
+func checkUninstallScript(catalogItem catalog.Item, cachePath string) (actionNeeded bool, checkErr error) {
+	return runCheckScript(catalogItem.Check.UninstallScript, cachePath)
+}
+
+// runCheckScript runs a check script with PowerShell and returns true if it exited 0
+func runCheckScript(script, cachePath string) (bool, error) {
+
+	// Write the script to disk as a Powershell file,
+	// named uniquely since items may be checked concurrently
+	scriptFile, err := ioutil.TempFile(cachePath, "tmpCheckScript-*.ps1")
+	if err != nil {
+		return false, err
+	}
+	tmpScript := scriptFile.Name()
+	scriptFile.WriteString(script)
+	scriptFile.Close()
 
 	// Build the command to execute the script
 	psCmd := filepath.Join(os.Getenv("WINDIR"), "system32/", "WindowsPowershell", "v1.0", "powershell.exe")
@@ -108,7 +333,7 @@ func checkScript(catalogItem catalog.Item, cachePath string, installType string)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	err := cmd.Run()
+	err = cmd.Run()
 	cmdSuccess := cmd.ProcessState.Success()
 	outStr, errStr := stdout.String(), stderr.String()
 
@@ -120,15 +345,52 @@ func checkScript(catalogItem catalog.Item, cachePath string, installType string)
 	logging.Debug("stdout:", outStr)
 	logging.Debug("stderr:", errStr)
 
-	actionNeeded = false
-	// Application not installed if exit 0
-	if installType == "uninstall" {
-		actionNeeded = !cmdSuccess
-	} else if installType == "install" {
-		actionNeeded = cmdSuccess
-	}
+	return cmdSuccess, nil
+}
 
-	return actionNeeded, checkErr
+// envVariable matches a Windows style %NAME% environment variable
+var envVariable = regexp.MustCompile(`%([^%]+)%`)
+
+// expandEnv replaces %NAME% variables in a path, such as %ProgramFiles%,
+// leaving variables that are not set unchanged
+func expandEnv(path string) string {
+	return envVariable.ReplaceAllStringFunc(path, func(match string) string {
+		if value, ok := os.LookupEnv(match[1 : len(match)-1]); ok {
+			return value
+		}
+		return match
+	})
+}
+
+// metadataMatches compares a name from the file metadata with the expected name, ignoring case
+func metadataMatches(found, expected string) bool {
+	return strings.EqualFold(strings.TrimSpace(found), strings.TrimSpace(expected))
+}
+
+// fileOwnerMatches returns false when the product name or company name of a file check
+// is set and the metadata of the file has another. A locked file is assumed to match.
+func fileOwnerMatches(checkFile catalog.FileCheck, path string) bool {
+	if checkFile.ProductName == "" && checkFile.CompanyName == "" {
+		return true
+	}
+	metadata := fileMetadata(path)
+	if metadata.locked {
+		logging.Debug("Check file is locked, assuming the product and company name match:", path)
+		return true
+	}
+	if checkFile.ProductName != "" {
+		logging.Debug("Check file product name:", "found", metadata.productName, "expected", checkFile.ProductName)
+		if !metadataMatches(metadata.productName, checkFile.ProductName) {
+			return false
+		}
+	}
+	if checkFile.CompanyName != "" {
+		logging.Debug("Check file company name:", "found", metadata.companyName, "expected", checkFile.CompanyName)
+		if !metadataMatches(metadata.companyName, checkFile.CompanyName) {
+			return false
+		}
+	}
+	return true
 }
 
 func checkPath(catalogItem catalog.Item, installType string) (actionNeeded bool, checkErr error) {
@@ -136,9 +398,27 @@ func checkPath(catalogItem catalog.Item, installType string) (actionNeeded bool,
 
 	// Iterate through all file provided paths
 	for _, checkFile := range catalogItem.Check.File {
-		path := filepath.Clean(checkFile.Path)
+		expanded, err := scopedExpandEnv(catalogItem, checkFile.Path)
+		if err != nil {
+			return false, err
+		}
+		path := filepath.Clean(expanded)
+		if checkFile.Type == pkginfo.DirectoryCheck {
+			needed, err := checkDirectory(checkFile, path, installType)
+			if err != nil {
+				logging.Warn("Unable to check directory:", path, err)
+				break
+			}
+			if needed {
+				actionStore = append(actionStore, true)
+				if installType != "uninstall" {
+					break
+				}
+			}
+			continue
+		}
 		logging.Debug("Check file path:", path)
-		_, err := os.Stat(path)
+		_, err = os.Stat(utils.LongPath(path))
 		if err != nil {
 			if os.IsNotExist(err) {
 
@@ -161,6 +441,17 @@ func checkPath(catalogItem catalog.Item, installType string) (actionNeeded bool,
 
 		} else if err == nil {
 
+			// If a product or company name is set, the file must be from that product or publisher.
+			// Another product's file at the path needs an install, and is not ours to uninstall
+			if !fileOwnerMatches(checkFile, path) {
+				if installType == "uninstall" {
+					logging.Debug("No action needed: Product or company name does not match", path)
+					continue
+				}
+				actionStore = append(actionStore, true)
+				break
+			}
+
 			// When doing an uninstall, and the path exists
 			// perform uninstall
 			if installType == "uninstall" {
@@ -172,7 +463,7 @@ func checkPath(catalogItem catalog.Item, installType string) (actionNeeded bool,
 		// if the hash does not match, we need to install
 		if checkFile.Hash != "" {
 			logging.Debug("Check file hash:", checkFile.Hash)
-			hashMatch := download.Verify(path, checkFile.Hash)
+			hashMatch := download.Verify(utils.LongPath(path), checkFile.Hash)
 			if !hashMatch {
 				actionStore = append(actionStore, true)
 				break
@@ -182,8 +473,13 @@ func checkPath(catalogItem catalog.Item, installType string) (actionNeeded bool,
 		if checkFile.Version != "" {
 			logging.Debug("Check file version:", checkFile.Version)
 
-			// Get the file metadata, and check that it has a value
-			metadata := GetFileMetadata(path)
+			// Get the file metadata, and check that it has a value.
+			// A locked file is installed with an unknown version, which needs no install.
+			metadata := fileMetadata(path)
+			if metadata.locked {
+				logging.Info("Check file is locked by a running app, treating it as installed:", path)
+				break
+			}
 			if metadata.versionString == "" {
 				break
 			}
@@ -225,7 +521,11 @@ func checkPath(catalogItem catalog.Item, installType string) (actionNeeded bool,
 // CheckStatus determines the method for checking status
 func CheckStatus(catalogItem catalog.Item, installType, cachePath string) (actionNeeded bool, checkErr error) {
 
-	if catalogItem.Check.Script != "" {
+	if installType == "uninstall" && catalogItem.Check.UninstallScript != "" {
+		logging.Info("Checking status via uninstall script:", catalogItem.DisplayName)
+		return checkUninstallScript(catalogItem, cachePath)
+
+	} else if catalogItem.Check.Script != "" {
 		logging.Info("Checking status via script:", catalogItem.DisplayName)
 		return checkScript(catalogItem, cachePath, installType)
 
@@ -236,6 +536,14 @@ func CheckStatus(catalogItem catalog.Item, installType, cachePath string) (actio
 	} else if catalogItem.Check.Registry.Version != "" {
 		logging.Info("Checking status via registry:", catalogItem.DisplayName)
 		return checkRegistry(catalogItem, installType)
+
+	} else if catalogItem.Check.Registry.Key != "" {
+		logging.Info("Checking status via registry value:", catalogItem.DisplayName)
+		return checkRegistryValue(catalogItem, installType)
+
+	} else if catalogItem.ProductCode != "" {
+		logging.Info("Checking status via msi product code:", catalogItem.DisplayName)
+		return checkProductCode(catalogItem, installType)
 	}
 
 	logging.Warn("Not enough data to check the current status:", catalogItem.DisplayName)
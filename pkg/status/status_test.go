@@ -1,16 +1,18 @@
 package status
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/windowsadmins/gorilla/pkg/catalog"
-	"github.com/windowsadmins/gorilla/pkg/config"
 	"github.com/windowsadmins/gorilla/pkg/logging"
+	"github.com/windowsadmins/gorilla/pkg/regfile"
 )
 
 var (
@@ -18,16 +20,6 @@ var (
 	origExec          = execCommand
 	origRegistryItems = RegistryItems
 
-	// Temp directory for logging
-	logTmp, _ = ioutil.TempDir("", "gorilla-status_test")
-
-	// Setup a testing Configuration struct
-	cfgVerbose = config.Configuration{
-		Debug:       false,
-		Verbose:     true,
-		AppDataPath: logTmp,
-	}
-
 	// fakeRegistryItems provides fake items for testing checkRegistry
 	fakeRegistryItems = map[string]RegistryApplication{
 		`registryCheckItem`: {
@@ -40,62 +32,22 @@ var (
 		},
 	}
 
-	// These catalog items provide test data
-	pathInstalled = catalog.Item{
-		Check: catalog.InstallCheck{
-			File: []catalog.FileCheck{{
-				Path: `testdata/test_checkPath.msi`,
-				Hash: `cc8f5a895f1c500aa3b4ae35f3878595f4587054a32fa6d7e9f46363525c59f9`,
-			}},
-		},
-	}
-	pathNotInstalled = catalog.Item{
-		Check: catalog.InstallCheck{
-			File: []catalog.FileCheck{{
-				Path: `testdata/test_checkPath.msi`,
-				Hash: `ba7d5a895f1c500aa3b4ae35f3878595f4587054a32fa6d7e9f46363525c59e8`,
-			}},
-		},
-	}
-	pathMissing = catalog.Item{
-		Check: catalog.InstallCheck{
-			File: []catalog.FileCheck{{
-				Path: `testdata/bogus.msi`,
-				Hash: `ba7d5a895f1c500aa3b4ae35f3878595f4587054a32fa6d7e9f46363525c59e8`,
-			}},
-		},
-	}
-	pathMetadataInstalled = catalog.Item{
-		Check: catalog.InstallCheck{
-			File: []catalog.FileCheck{{
-				Path:        `testdata/test.exe`,
-				Version:     `3.2.0.1`,
-				ProductName: `Gorilla Test`,
-			}},
-		},
-	}
-	pathMetadataOutdated = catalog.Item{
-		Check: catalog.InstallCheck{
-			File: []catalog.FileCheck{{
-				Path:        `testdata/test.exe`,
-				Version:     `3.12.0.1`,
-				ProductName: `Gorilla Test`,
-			}},
-		},
-	}
 	scriptActionNoError = catalog.Item{
 		Installer: catalog.InstallerItem{Type: `ps1`},
 	}
-	scriptNoActionNoError = catalog.Item{
-		Installer:   catalog.InstallerItem{Type: `ps1`},
-		DisplayName: `scriptNoActionNoError`,
-	}
 	scriptCheckItem = catalog.Item{
 		Check: catalog.InstallCheck{
 			Script: `echo "pizza"`,
 		},
 		DisplayName: `scriptCheckItem`,
 	}
+	uninstallScriptCheckItem = catalog.Item{
+		Check: catalog.InstallCheck{
+			Script:          `exit 0`,
+			UninstallScript: `exit 0`,
+		},
+		DisplayName: `uninstallScriptCheckItem`,
+	}
 	fileCheckItem = catalog.Item{
 		Check: catalog.InstallCheck{
 			File: []catalog.FileCheck{{
@@ -246,167 +198,249 @@ func TestCheckRegistry(t *testing.T) {
 
 }
 
-// TestCheckScript validates that a script is properly written disk, ran, and then deleted
-// and the status is retrieved properly.
-func TestCheckScript(t *testing.T) {
-	// Override execCommand with our fake version
-	execCommand = fakeExecCommand
+// TestCheckRegistryBestMatch validates overlapping names such as Edge and WebView2
+// are told apart, whichever order the registry is read in
+func TestCheckRegistryBestMatch(t *testing.T) {
 	defer func() {
-		execCommand = origExec
+		RegistryItems = origRegistryItems
 	}()
-
-	// Set cachepath and run checkScript for scriptActionNoError
-	cachepath := fmt.Sprintf("testdata/%s/", statusActionNoError)
-	actionNeeded, err := checkScript(scriptActionNoError, cachepath, "install")
-	if !actionNeeded || err != nil {
-		fmt.Printf("action: %v; error: %v\n", actionNeeded, err)
-		t.Errorf("Expected checkScript to action and no error")
-	}
-
-	// Set cachepath and run checkScript for scriptNoActionNoError
-	cachepath = fmt.Sprintf("testdata/%s/", statusActionNoError)
-	actionNeeded, err = checkScript(scriptActionNoError, cachepath, "uninstall")
-	if actionNeeded || err != nil {
-		fmt.Printf("action: %v; error: %v\n", actionNeeded, err)
-		t.Errorf("Expected checkScript to no action and no error")
-	}
-
-	// Set cachepath and run checkScript for scriptNoActionNoError
-	cachepath = fmt.Sprintf("testdata/%s/", statusNoActionNoError)
-	actionNeeded, err = checkScript(scriptNoActionNoError, cachepath, "install")
-	if actionNeeded || err != nil {
-		fmt.Printf("action: %v; error: %v\n", actionNeeded, err)
-		t.Errorf("Expected checkScript to return no action and no error")
-	}
-
-	// Set cachepath and run checkScript for scriptActionNoError
-	cachepath = fmt.Sprintf("testdata/%s/", statusNoActionNoError)
-	actionNeeded, err = checkScript(scriptNoActionNoError, cachepath, "uninstall")
-	if !actionNeeded || err != nil {
-		fmt.Printf("action: %v; error: %v\n", actionNeeded, err)
-		t.Errorf("Expected checkScript to action and no error")
+	RegistryItems = map[string]RegistryApplication{
+		`Microsoft Edge WebView2 Runtime`: {Name: `Microsoft Edge WebView2 Runtime`, Version: `90.0.818.66`},
+		`Microsoft Edge`:                  {Name: `Microsoft Edge`, Version: `126.0.2592.87`},
+		`Microsoft Edge Update`:           {Name: `Microsoft Edge Update`, Version: `1.3.187.41`},
+		`Contoso Agent (x64)`:             {Name: `Contoso Agent (x64)`, Version: `2.1`},
+		`Contoso Agent Updater (x64)`:     {Name: `Contoso Agent Updater (x64)`, Version: `9.0`},
+	}
+	check := func(name, version string, exact bool) catalog.Item {
+		return catalog.Item{Check: catalog.InstallCheck{Registry: catalog.RegCheck{Name: name, Version: version, ExactMatch: exact}}}
+	}
+
+	tests := []struct {
+		description string
+		item        catalog.Item
+		installType string
+		want        bool
+	}{
+		{"exact name over WebView2, up to date", check(`Microsoft Edge`, `126.0.2592.87`, false), "install", false},
+		{"exact name over WebView2, outdated", check(`Microsoft Edge`, `127.0`, false), "update", true},
+		{"exact name ignoring case", check(`microsoft edge`, `126.0`, false), "install", false},
+		{"shortest partial match", check(`Contoso Agent`, `2.1`, false), "install", false},
+		{"shortest partial match is outdated", check(`Contoso Agent`, `3.0`, false), "update", true},
+		{"exact_match ignores partial matches", check(`Contoso Agent`, `2.1`, true), "install", true},
+		{"exact_match finds the exact name", check(`Microsoft Edge Update`, `1.3.187.41`, true), "install", false},
+		{"exact_match not installed for uninstall", check(`Contoso Agent`, `2.1`, true), "uninstall", false},
+	}
+	for _, tt := range tests {
+		// Repeat, as the map is read in a different order each time
+		for i := 0; i < 20; i++ {
+			actionNeeded, _ := checkRegistry(tt.item, tt.installType)
+			if actionNeeded != tt.want {
+				t.Errorf("%s: actionNeeded %v, expected %v", tt.description, actionNeeded, tt.want)
+				break
+			}
+		}
 	}
 }
 
-// TestCheckPath validates that the status of a path is checked correctly
-func TestCheckPath(t *testing.T) {
-
-	// Run checkPath for pathInstalled
-	// We expect action is not needed; Only error if action needed is true
-	actionNeeded, err := checkPath(pathInstalled, "install")
-	if err != nil {
-		t.Errorf("checkPath failed: %v", err)
-	}
-	if actionNeeded {
-		t.Errorf("actionNeeded: %v; Expected checkPath to return false", actionNeeded)
-	}
-
-	// Run checkPath for file that doesn't exist
-	// We expect action is not needed; Only error if action needed is true
-	actionNeeded, err = checkPath(pathMissing, "update")
-	if err != nil {
-		t.Errorf("checkPath failed: %v", err)
-	}
-	if actionNeeded {
-		t.Errorf("actionNeeded: %v; Expected checkPath to return false", actionNeeded)
-	}
-
-	// Run checkPath for pathNotInstalled
-	// We expect action is needed; Only error if actionNeeded is false
-	actionNeeded, err = checkPath(pathNotInstalled, "install")
-	if err != nil {
-		t.Error(err)
-	}
-	if !actionNeeded {
-		t.Errorf("actionNeeded: %v; Expected checkPath to return true", actionNeeded)
-	}
-
-	// Run checkPath for pathMetadataInstalled
-	// We expect action is not needed; Only error if actionNeeded is true
-	actionNeeded, err = checkPath(pathMetadataInstalled, "install")
-	if err != nil {
-		t.Error(err)
-	}
-	if actionNeeded {
-		t.Errorf("actionNeeded: %v; Expected checkPath to return false", actionNeeded)
-	}
-
-	// Run checkPath for pathMetadataOutdated
-	// We expect action is needed; Only error if actionNeeded is false
-	actionNeeded, err = checkPath(pathMetadataOutdated, "install")
-	if err != nil {
-		t.Error(err)
-	}
-	if !actionNeeded {
-		t.Errorf("actionNeeded: %v; Expected checkPath to return true", actionNeeded)
+// TestCheckRegistryValue validates that a value of a key is checked, with its data when set
+func TestCheckRegistryValue(t *testing.T) {
+	origReadValue := registryReadValue
+	defer func() {
+		registryReadValue = origReadValue
+	}()
+	registryReadValue = func(path, name string) (regfile.Value, bool, error) {
+		if path != `HKLM\SOFTWARE\Policies\Example` || name != "Enabled" {
+			return regfile.Value{}, false, nil
+		}
+		return regfile.Value{Name: name, Type: regfile.TypeDWord, Data: []byte{1, 0, 0, 0}}, true, nil
+	}
+
+	item := func(key, data string) catalog.Item {
+		return catalog.Item{Check: catalog.InstallCheck{Registry: catalog.RegCheck{Key: key, Value: "Enabled", Data: data}}}
+	}
+	tests := []struct {
+		item        catalog.Item
+		installType string
+		expected    bool
+	}{
+		{item(`HKLM\SOFTWARE\Policies\Example`, ""), "install", false},
+		{item(`HKLM\SOFTWARE\Policies\Example`, "1"), "install", false},
+		{item(`HKLM\SOFTWARE\Policies\Example`, "0"), "install", true},
+		{item(`HKLM\SOFTWARE\Policies\Missing`, ""), "install", true},
+		{item(`HKLM\SOFTWARE\Policies\Example`, "0"), "update", true},
+		{item(`HKLM\SOFTWARE\Policies\Missing`, ""), "update", false},
+		{item(`HKLM\SOFTWARE\Policies\Example`, ""), "uninstall", true},
+		{item(`HKLM\SOFTWARE\Policies\Missing`, ""), "uninstall", false},
+	}
+	for _, test := range tests {
+		actionNeeded, err := checkRegistryValue(test.item, test.installType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actionNeeded != test.expected {
+			t.Errorf("%s %s = %q as %s: expected actionNeeded %v", test.item.Check.Registry.Key, test.item.Check.Registry.Value,
+				test.item.Check.Registry.Data, test.installType, test.expected)
+		}
 	}
-
 }
 
-// ExampleCheckStatus_script validates that a script check is ran
-func ExampleCheckStatus_script() {
+// TestCheckScript validates that a script is properly written disk, ran, and then deleted
+// and the status is retrieved properly.
+func TestCheckScript(t *testing.T) {
 	// Override execCommand with our fake version
 	execCommand = fakeExecCommand
-	// Override the verbose setting
-	logging.NewLog(cfgVerbose)
 	defer func() {
 		execCommand = origExec
 	}()
 
-	// Run CheckStatus with an item that has a script check
-	CheckStatus(scriptCheckItem, "install", "testdata/")
-
-	// Output:
-	// Checking status via script: scriptCheckItem
+	// The fake command exits 0 for scripts in the first cachepath, and 1 in the second
+	actionPath := filepath.Join(t.TempDir(), statusActionNoError)
+	noActionPath := filepath.Join(t.TempDir(), statusNoActionNoError)
+	os.MkdirAll(actionPath, 0755)
+	os.MkdirAll(noActionPath, 0755)
+
+	tests := []struct {
+		cachePath   string
+		installType string
+		expected    bool
+	}{
+		{actionPath, "install", true},
+		{actionPath, "uninstall", false},
+		{noActionPath, "install", false},
+		{noActionPath, "uninstall", true},
+	}
+	for _, tt := range tests {
+		actionNeeded, err := checkScript(scriptActionNoError, tt.cachePath, tt.installType)
+		if actionNeeded != tt.expected || err != nil {
+			t.Errorf("%s in %s: expected checkScript to return %v and no error, got %v and %v",
+				tt.installType, filepath.Base(tt.cachePath), tt.expected, actionNeeded, err)
+		}
+	}
 }
 
-// ExampleCheckStatus_file validates that a file check is ran
-func ExampleCheckStatus_file() {
+// TestCheckUninstallScript validates that an uninstall check script needs an uninstall when it exits 0,
+// the opposite of an install check script
+func TestCheckUninstallScript(t *testing.T) {
 	// Override execCommand with our fake version
 	execCommand = fakeExecCommand
-	// Override the verbose setting
-	logging.NewLog(cfgVerbose)
 	defer func() {
 		execCommand = origExec
 	}()
 
-	// Run CheckStatus with an item that has a script check
-	CheckStatus(fileCheckItem, "install", "testdata/")
+	// The fake command exits 0 for scripts in the first cachepath, and 1 in the second
+	actionPath := filepath.Join(t.TempDir(), statusActionNoError)
+	noActionPath := filepath.Join(t.TempDir(), statusNoActionNoError)
+	os.MkdirAll(actionPath, 0755)
+	os.MkdirAll(noActionPath, 0755)
 
-	// Output:
-	// Checking status via file: fileCheckItem
+	actionNeeded, err := checkUninstallScript(uninstallScriptCheckItem, actionPath)
+	if !actionNeeded || err != nil {
+		t.Errorf("Expected checkUninstallScript to action and no error, got %v and %v", actionNeeded, err)
+	}
+	actionNeeded, err = checkUninstallScript(uninstallScriptCheckItem, noActionPath)
+	if actionNeeded || err != nil {
+		t.Errorf("Expected checkUninstallScript to no action and no error, got %v and %v", actionNeeded, err)
+	}
+
+	// The install check script would say there is nothing to uninstall
+	actionNeeded, err = CheckStatus(uninstallScriptCheckItem, "uninstall", actionPath)
+	if !actionNeeded || err != nil {
+		t.Errorf("Expected CheckStatus to use the uninstall check script, got %v and %v", actionNeeded, err)
+	}
+	actionNeeded, err = CheckStatus(uninstallScriptCheckItem, "install", actionPath)
+	if !actionNeeded || err != nil {
+		t.Errorf("Expected CheckStatus to use the install check script for installs, got %v and %v", actionNeeded, err)
+	}
 }
 
-// ExampleCheckStatus_registry validates that a registry check is ran
-func ExampleCheckStatus_registry() {
-	// Override execCommand with our fake version
-	execCommand = fakeExecCommand
-	// Override the verbose setting
-	logging.NewLog(cfgVerbose)
+// TestCheckPath validates that the status of a path is checked correctly
+func TestCheckPath(t *testing.T) {
+	// The file metadata is the same on every OS
+	fileMetadata = func(path string) WindowsMetadata {
+		return WindowsMetadata{
+			productName:   "Gorilla Test",
+			companyName:   "Gorilla Inc",
+			versionString: "3.2.0.1",
+			versionMajor:  3,
+			versionMinor:  2,
+			versionPatch:  0,
+			versionBuild:  1,
+		}
+	}
 	defer func() {
-		execCommand = origExec
+		fileMetadata = GetFileMetadata
 	}()
 
-	// Run CheckStatus with an item that has a script check
-	CheckStatus(registryCheckItem, "install", "testdata/")
-
-	// Output:
-	// Checking status via registry: registryCheckItem
+	dir := t.TempDir()
+	msiPath := filepath.Join(dir, "test_checkPath.msi")
+	exePath := filepath.Join(dir, "test.exe")
+	for _, path := range []string{msiPath, exePath} {
+		if err := ioutil.WriteFile(path, []byte("gorilla test file"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msiHash := fmt.Sprintf("%x", sha256.Sum256([]byte("gorilla test file")))
+	otherHash := `ba7d5a895f1c500aa3b4ae35f3878595f4587054a32fa6d7e9f46363525c59e8`
+
+	tests := []struct {
+		description string
+		check       catalog.FileCheck
+		installType string
+		expected    bool
+	}{
+		{"the hash matches", catalog.FileCheck{Path: msiPath, Hash: msiHash}, "install", false},
+		{"a missing file is not updated", catalog.FileCheck{Path: filepath.Join(dir, "bogus.msi"), Hash: otherHash}, "update", false},
+		{"the hash differs", catalog.FileCheck{Path: msiPath, Hash: otherHash}, "install", true},
+		{"the version and product match", catalog.FileCheck{Path: exePath, Version: "3.2.0.1", ProductName: "Gorilla Test"}, "install", false},
+		{"the version is outdated", catalog.FileCheck{Path: exePath, Version: "3.12.0.1", ProductName: "Gorilla Test"}, "install", true},
+		{"another product's file is at the path", catalog.FileCheck{Path: exePath, Version: "3.2.0.1", ProductName: "Another Product"}, "install", true},
+		{"another product's file is not ours to uninstall", catalog.FileCheck{Path: exePath, Version: "3.2.0.1", ProductName: "Another Product"}, "uninstall", false},
+		{"the company matches regardless of case", catalog.FileCheck{Path: exePath, Version: "3.2.0.1", CompanyName: "gorilla inc"}, "install", false},
+		{"the file is from another publisher", catalog.FileCheck{Path: exePath, Version: "3.2.0.1", ProductName: "Gorilla Test", CompanyName: "Mozilla Corporation"}, "install", true},
+	}
+	for _, tt := range tests {
+		item := catalog.Item{Check: catalog.InstallCheck{File: []catalog.FileCheck{tt.check}}}
+		actionNeeded, err := checkPath(item, tt.installType)
+		if err != nil {
+			t.Errorf("%s: checkPath failed: %v", tt.description, err)
+		}
+		if actionNeeded != tt.expected {
+			t.Errorf("%s: expected checkPath to return %v, got %v", tt.description, tt.expected, actionNeeded)
+		}
+	}
 }
 
-// ExampleCheckStatus_none validates that no check is ran
-func ExampleCheckStatus_none() {
+// TestCheckStatusLogsCheck validates the check each item is checked by is logged
+func TestCheckStatusLogsCheck(t *testing.T) {
 	// Override execCommand with our fake version
 	execCommand = fakeExecCommand
-	// Override the verbose setting
-	logging.NewLog(cfgVerbose)
 	defer func() {
 		execCommand = origExec
 	}()
-
-	// Run CheckStatus with an item that has a script check
-	CheckStatus(noCheckItem, "install", "testdata/")
-
-	// Output:
-	// Not enough data to check the current status: noCheckItem
+	// Log to a file so the messages can be read back
+	logPath := filepath.Join(t.TempDir(), "status.log")
+	if err := logging.InitTool(logPath, true); err != nil {
+		t.Fatal(err)
+	}
+	defer logging.CloseLogger()
+
+	tests := []struct {
+		item     catalog.Item
+		expected string
+	}{
+		{scriptCheckItem, "INFO: Checking status via script: scriptCheckItem"},
+		{fileCheckItem, "INFO: Checking status via file: fileCheckItem"},
+		{registryCheckItem, "INFO: Checking status via registry: registryCheckItem"},
+		{noCheckItem, "WARN: Not enough data to check the current status: noCheckItem"},
+	}
+	for _, tt := range tests {
+		CheckStatus(tt.item, "install", "testdata/")
+		logged, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(logged), tt.expected) {
+			t.Errorf("expected %q to be logged, got:\n%s", tt.expected, logged)
+		}
+	}
 }
@@ -0,0 +1,73 @@
+// pkg/utils/copy.go
+
+package utils
+
+import (
+	"io"
+	"os"
+)
+
+// partialSuffix is added to copies while they are written, the same as downloads,
+// so an interrupted copy is never taken for a complete file
+const partialSuffix = ".partial"
+
+// linkFile creates a hard link.
+// This abstraction allows us to override when testing
+var linkFile = os.Link
+
+// LinkOrCopy puts src at dest as a hard link, which takes no time or space when both are
+// on the same NTFS volume. When a link can't be made, on another volume or a share, src is
+// copied instead. Either way dest is replaced in one rename, never left partly written.
+func LinkOrCopy(src, dest string) error {
+	partialPath := dest + partialSuffix
+	os.Remove(partialPath)
+	if err := linkFile(src, partialPath); err == nil {
+		if err := os.Rename(partialPath, dest); err != nil {
+			os.Remove(partialPath)
+			return err
+		}
+		return nil
+	}
+	_, err := CopyFile(src, dest)
+	return err
+}
+
+// CopyFile copies src to `<dest>.partial`, syncs it to disk, gives it the modification time
+// of src and then renames it to dest. It returns the number of bytes copied.
+func CopyFile(src, dest string) (int64, error) {
+	input, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer input.Close()
+	info, err := input.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	partialPath := dest + partialSuffix
+	output, err := os.Create(partialPath)
+	if err != nil {
+		return 0, err
+	}
+	defer output.Close()
+
+	written, err := io.Copy(output, input)
+	if err == nil {
+		err = output.Sync()
+	}
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(partialPath, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(partialPath, dest)
+	}
+	if err != nil {
+		os.Remove(partialPath)
+		return 0, err
+	}
+	return written, nil
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSource writes a payload with a modification time in the past, so a copy that
+// doesn't preserve it is told apart
+func writeSource(t *testing.T, dir string) (string, time.Time) {
+	t.Helper()
+	src := filepath.Join(dir, "Firefox-128.0.msi")
+	if err := os.WriteFile(src, []byte("msi payload"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 7, 9, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(src, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	return src, modTime
+}
+
+// TestLinkOrCopyLinks validates a file on the same volume is hard linked over an existing copy
+func TestLinkOrCopyLinks(t *testing.T) {
+	dir := t.TempDir()
+	src, _ := writeSource(t, dir)
+	dest := filepath.Join(dir, "cache.msi")
+	if err := os.WriteFile(dest, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LinkOrCopy(src, dest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srcInfo, _ := os.Stat(src)
+	destInfo, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(srcInfo, destInfo) {
+		t.Error("expected dest to be a hard link to src")
+	}
+	if _, err := os.Stat(dest + partialSuffix); !os.IsNotExist(err) {
+		t.Error("the partial file was left behind")
+	}
+}
+
+// TestLinkOrCopyFallback validates a file that can't be linked, as across volumes,
+// is copied with its contents and modification time
+func TestLinkOrCopyFallback(t *testing.T) {
+	origLink := linkFile
+	t.Cleanup(func() { linkFile = origLink })
+	linkFile = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.New("not the same device")}
+	}
+
+	src, modTime := writeSource(t, t.TempDir())
+	dest := filepath.Join(t.TempDir(), "cache.msi")
+	if err := LinkOrCopy(src, dest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srcInfo, _ := os.Stat(src)
+	destInfo, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(srcInfo, destInfo) {
+		t.Error("expected a copy, not a link")
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "msi payload" {
+		t.Errorf("unexpected contents: %q", data)
+	}
+	if !destInfo.ModTime().Equal(modTime) {
+		t.Errorf("expected the modification time %v, got %v", modTime, destInfo.ModTime())
+	}
+}
+
+// TestCopyFileMissingSource validates a failed copy leaves nothing behind
+func TestCopyFileMissingSource(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "cache.msi")
+	if _, err := CopyFile(filepath.Join(dir, "missing.msi"), dest); err == nil {
+		t.Fatal("expected an error for a missing source")
+	}
+	for _, path := range []string{dest, dest + partialSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind", path)
+		}
+	}
+}
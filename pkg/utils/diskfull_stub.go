@@ -0,0 +1,16 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package utils
+
+import (
+	"errors"
+	"syscall"
+)
+
+// IsDiskFull returns whether an error is from writing to a disk without space left
+func IsDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
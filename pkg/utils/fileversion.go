@@ -0,0 +1,31 @@
+// pkg/utils/fileversion.go
+
+package utils
+
+import (
+	"github.com/windowsadmins/gorilla/pkg/extract"
+)
+
+// FileVersion is the version information of an EXE or DLL
+type FileVersion struct {
+	ProductName     string
+	FileVersion     string
+	CompanyName     string
+	FileDescription string
+}
+
+// FileVersionInfo reads the version resource of an EXE or DLL. The resource is parsed
+// directly rather than through version.dll, so the client and the authoring tools read
+// the same values, on any OS. Paths of MAX_PATH characters or more are read with LongPath.
+func FileVersionInfo(path string) (FileVersion, error) {
+	info, err := extract.ExeMetadata(LongPath(path))
+	if err != nil {
+		return FileVersion{}, err
+	}
+	return FileVersion{
+		ProductName:     info.ProductName,
+		FileVersion:     info.FileVersion,
+		CompanyName:     info.CompanyName,
+		FileDescription: info.FileDescription,
+	}, nil
+}
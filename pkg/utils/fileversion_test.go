@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestFileVersionInfo validates the version resource of the extract fixtures is read
+func TestFileVersionInfo(t *testing.T) {
+	tests := map[string]FileVersion{
+		"pwsh.exe": {
+			ProductName:     "PowerShell",
+			FileVersion:     "7.3.4.500",
+			CompanyName:     "Microsoft Corporation",
+			FileDescription: "pwsh",
+		},
+		"ClassLibrary1.dll": {
+			ProductName:     "ClassLibrary1",
+			FileVersion:     "1.0.0.0",
+			FileDescription: "ClassLibrary1",
+		},
+	}
+	for name, expected := range tests {
+		info, err := FileVersionInfo(filepath.Join("..", "extract", "testdata", name))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if info != expected {
+			t.Errorf("%s: expected %+v, got %+v", name, expected, info)
+		}
+	}
+
+	if _, err := FileVersionInfo(filepath.Join("..", "extract", "testdata", "dummy.msi")); err == nil {
+		t.Errorf("expected an error for an MSI")
+	}
+}
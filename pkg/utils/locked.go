@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package utils
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// IsLocked returns whether an error is a sharing or lock violation,
+// for a file that exists but is held open by a running app
+func IsLocked(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
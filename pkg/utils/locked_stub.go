@@ -0,0 +1,11 @@
+// Without a darwin specific build, go tools will try to include Windows libraries and fail
+
+//go:build !windows
+// +build !windows
+
+package utils
+
+// IsLocked is just a placeholder on darwin, files are never locked
+func IsLocked(err error) bool {
+	return false
+}
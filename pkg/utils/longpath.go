@@ -0,0 +1,35 @@
+// pkg/utils/longpath.go
+
+package utils
+
+import (
+	"strings"
+)
+
+// maxPath is the length of a Windows path that needs the long path prefix
+const maxPath = 260
+
+// Prefixes that turn off the MAX_PATH limit of the Windows file APIs
+const (
+	longPathPrefix    = `\\?\`
+	longUNCPathPrefix = `\\?\UNC\`
+)
+
+// LongPath returns a drive or UNC path of MAX_PATH characters or more with the `\\?\` prefix,
+// so the Windows file APIs open it. The prefix turns off the parsing of `/`, `.` and `..`,
+// so the path is given backslashes and must already be clean. Shorter paths, relative paths
+// and paths that already have the prefix are returned unchanged.
+func LongPath(path string) string {
+	if len(path) < maxPath || strings.HasPrefix(path, longPathPrefix) {
+		return path
+	}
+	path = strings.ReplaceAll(path, "/", `\`)
+	switch {
+	case strings.HasPrefix(path, `\\`):
+		return longUNCPathPrefix + path[2:]
+	case len(path) >= 3 && path[1] == ':' && path[2] == '\\':
+		return longPathPrefix + path
+	default:
+		return path
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLongPath validates only drive and UNC paths of MAX_PATH characters or more are prefixed
+func TestLongPath(t *testing.T) {
+	deep := strings.Repeat(`node_modules\`, 20) + "index.js"
+	tests := map[string]string{
+		`C:\Program Files\Gorilla\gorilla.exe`: `C:\Program Files\Gorilla\gorilla.exe`,
+		`C:\app\` + deep:                       `\\?\C:\app\` + deep,
+		`C:/app/` + deep:                       `\\?\C:\app\` + deep,
+		`\\server\share\` + deep:               `\\?\UNC\server\share\` + deep,
+		`\\?\C:\app\` + deep:                   `\\?\C:\app\` + deep,
+		`app\` + deep:                          `app\` + deep,
+	}
+	for path, expected := range tests {
+		if long := LongPath(path); long != expected {
+			t.Errorf("%s: expected %s, got %s", path, expected, long)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLongPathFile validates a file deeper than MAX_PATH is found and its version is read
+func TestLongPathFile(t *testing.T) {
+	dir := t.TempDir()
+	for len(dir) < maxPath {
+		dir = filepath.Join(dir, strings.Repeat("node_modules", 2))
+	}
+	if err := os.MkdirAll(LongPath(dir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join("..", "extract", "testdata", "pwsh.exe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "pwsh.exe")
+	if err := os.WriteFile(LongPath(path), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(LongPath(path)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	info, err := FileVersionInfo(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.FileVersion != "7.3.4.500" {
+		t.Errorf("expected file version 7.3.4.500, got %s", info.FileVersion)
+	}
+}
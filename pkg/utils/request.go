@@ -0,0 +1,65 @@
+// pkg/utils/request.go
+
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/auth"
+	"github.com/windowsadmins/gorilla/pkg/logging"
+)
+
+// This abstraction allows us to override when testing
+var authHeader = auth.Header
+
+// NewAuthenticatedRequest creates a request with the Authorization header
+// from the configured auth provider. If the provider fails, the request is
+// returned without credentials and a warning is logged.
+func NewAuthenticatedRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.ShouldAuthenticate(req.URL) {
+		logging.Debug("Withholding credentials from a host outside the repo", "url", url)
+		return req, nil
+	}
+
+	header, err := authHeader()
+	if err != nil {
+		logging.Warn("Unable to get authentication header, continuing without it", "url", url, "error", err)
+		return req, nil
+	}
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+
+	return req, nil
+}
+
+// NewClient returns an HTTP client for requests to the repo, using the
+// transport required by the configured auth provider
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     auth.Transport(http.DefaultTransport),
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// checkRedirect strips the credentials when a redirect leaves the repo.
+// The default policy keeps them for subdomains and other ports.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if req.Header.Get("Authorization") != "" && !auth.ShouldAuthenticate(req.URL) {
+		logging.Debug("Withholding credentials from a redirect outside the repo", "url", req.URL.String())
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
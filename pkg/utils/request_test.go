@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/windowsadmins/gorilla/pkg/auth"
+	"github.com/windowsadmins/gorilla/pkg/config"
+)
+
+// TestNewAuthenticatedRequest validates the header from the provider is set
+func TestNewAuthenticatedRequest(t *testing.T) {
+	origAuthHeader := authHeader
+	defer func() { authHeader = origAuthHeader }()
+	defer auth.Configure(config.Configuration{})
+	auth.Configure(config.Configuration{URL: "https://example.com/"})
+
+	authHeader = func() (string, error) { return "Bearer abc", nil }
+	req, err := NewAuthenticatedRequest("GET", "https://example.com/catalogs/All.yaml", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Header.Get("Authorization") != "Bearer abc" {
+		t.Errorf("expected %q, got %q", "Bearer abc", req.Header.Get("Authorization"))
+	}
+
+	// A provider failure falls back to an unauthenticated request
+	authHeader = func() (string, error) { return "", fmt.Errorf("token endpoint unavailable") }
+	req, err = NewAuthenticatedRequest("GET", "https://example.com/catalogs/All.yaml", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Errorf("expected no Authorization header, got %q", req.Header.Get("Authorization"))
+	}
+}
+
+// TestCredentialsScopedToRepo validates credentials are only sent to the repo hosts
+func TestCredentialsScopedToRepo(t *testing.T) {
+	origAuthHeader := authHeader
+	defer func() { authHeader = origAuthHeader }()
+	authHeader = func() (string, error) { return "Bearer abc", nil }
+
+	defer auth.Configure(config.Configuration{})
+	auth.Configure(config.Configuration{
+		URL:                 "https://repo.example.com/gorilla/",
+		AuthAdditionalHosts: []string{"files.example.net"},
+	})
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://repo.example.com/gorilla/catalogs/All.yaml", "Bearer abc"},
+		{"https://REPO.example.com:443/gorilla/pkgs/Firefox.msi", "Bearer abc"},
+		{"https://cdn.repo.example.com/pkgs/Firefox.msi", ""},
+		{"https://repo.example.com:8443/pkgs/Firefox.msi", ""},
+		{"http://repo.example.com/pkgs/Firefox.msi", ""},
+		{"https://files.example.net:8443/Firefox.msi", "Bearer abc"},
+		{"https://download.mozilla.org/Firefox.msi", ""},
+	}
+
+	for _, test := range tests {
+		req, err := NewAuthenticatedRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", test.url, err)
+		}
+		if header := req.Header.Get("Authorization"); header != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.url, test.expected, header)
+		}
+	}
+}
+
+// TestUnconfiguredSendsNoCredentials validates no host receives the credentials until the repo is configured
+func TestUnconfiguredSendsNoCredentials(t *testing.T) {
+	origAuthHeader := authHeader
+	defer func() { authHeader = origAuthHeader }()
+	authHeader = func() (string, error) { return "Basic c2VjcmV0", nil }
+	auth.Configure(config.Configuration{})
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	req, err := NewAuthenticatedRequest("GET", server.URL+"/Firefox.msi", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := NewClient(10 * time.Second).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(received) != 1 || received[0] != "" {
+		t.Errorf("expected one request without an Authorization header, got %q", received)
+	}
+}
+
+// TestRedirectStripsCredentials validates a redirect to another host drops the Authorization header
+func TestRedirectStripsCredentials(t *testing.T) {
+	var received string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("Authorization")
+	}))
+	defer cdn.Close()
+
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			t.Errorf("repo should receive the credentials")
+		}
+		// Same host name on another port, the default policy would keep the header
+		http.Redirect(w, r, cdn.URL+"/Firefox.msi", http.StatusFound)
+	}))
+	defer repo.Close()
+
+	origAuthHeader := authHeader
+	defer func() { authHeader = origAuthHeader }()
+	authHeader = func() (string, error) { return "Bearer abc", nil }
+
+	defer auth.Configure(config.Configuration{})
+	auth.Configure(config.Configuration{URL: repo.URL})
+
+	req, err := NewAuthenticatedRequest("GET", repo.URL+"/pkgs/Firefox.msi", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := NewClient(0).Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if received != "" {
+		t.Errorf("redirect target received credentials: %q", received)
+	}
+}
@@ -43,7 +43,14 @@ Available values and defaults to use with ldflags:
 package version
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 // These values are private which ensures they can only be set with the build flags.
@@ -56,38 +63,81 @@ var (
 	appName   = "unknown"
 )
 
+// This abstraction allows us to override when testing
+var stdout io.Writer = os.Stdout
+
 // Info is a structure with version build information about the current application.
 type Info struct {
-	Version   string `json:"version"`
-	Branch    string `json:"branch"`
-	Revision  string `json:"revision"`
-	GoVersion string `json:"go_version"`
-	BuildDate string `json:"build_date"`
+	Name      string `json:"name" yaml:"name"`
+	Version   string `json:"version" yaml:"version"`
+	Branch    string `json:"branch" yaml:"branch"`
+	Revision  string `json:"revision" yaml:"revision"`
+	GoVersion string `json:"go_version" yaml:"go_version"`
+	BuildDate string `json:"build_date" yaml:"build_date"`
 }
 
 // Version returns a structure with the current version information.
+// A binary built without the ldflags is named after its executable and
+// reports the Go version it was compiled with.
 func Version() Info {
-	return Info{
+	info := Info{
+		Name:      appName,
 		Version:   version,
 		Branch:    branch,
 		Revision:  revision,
 		GoVersion: goVersion,
 		BuildDate: buildDate,
 	}
+	if info.Name == "unknown" {
+		info.Name = strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	}
+	if info.GoVersion == "unknown" {
+		info.GoVersion = runtime.Version()
+	}
+	return info
+}
+
+// String returns the version on one line, such as
+// `managedsoftwareupdate 2.1.0 (revision 1a2b3c4, built 2024-07-12T17:00:00, go1.16.15)`
+func (i Info) String() string {
+	return fmt.Sprintf("%s %s (revision %s, built %s, %s)", i.Name, i.Version, i.Revision, i.BuildDate, i.GoVersion)
+}
+
+// Flags adds the --version and --json flags every command has to the default flag set.
+// managedsoftwareupdate also prints its configuration, history and facts as JSON with --json.
+func Flags() (showVersion *bool, asJSON *bool) {
+	showVersion = flag.Bool("version", false, "Print the version and exit.")
+	asJSON = flag.Bool("json", false, "With --version, or --show-config, --history and --facts of managedsoftwareupdate, print the output as JSON.")
+	return showVersion, asJSON
 }
 
-// Print outputs the application name and version string.
+// Print outputs the application name and version string, with the revision, build date and Go version.
 func Print() {
-	v := Version()
-	fmt.Printf("%s %s\n", appName, v.Version)
+	fmt.Fprintln(stdout, Version())
+}
+
+// PrintJSON outputs the version information as JSON.
+func PrintJSON() error {
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(Version())
+}
+
+// Show prints the version for the --version flag, as JSON if asJSON is set.
+func Show(asJSON bool) error {
+	if asJSON {
+		return PrintJSON()
+	}
+	Print()
+	return nil
 }
 
 // PrintFull prints the application name and detailed version information.
 func PrintFull() {
 	v := Version()
-	fmt.Printf("%s %s\n", appName, v.Version)
-	fmt.Printf("  branch: \t%s\n", v.Branch)
-	fmt.Printf("  revision: \t%s\n", v.Revision)
-	fmt.Printf("  build date: \t%s\n", v.BuildDate)
-	fmt.Printf("  go version: \t%s\n", v.GoVersion)
+	fmt.Fprintf(stdout, "%s %s\n", v.Name, v.Version)
+	fmt.Fprintf(stdout, "  branch: \t%s\n", v.Branch)
+	fmt.Fprintf(stdout, "  revision: \t%s\n", v.Revision)
+	fmt.Fprintf(stdout, "  build date: \t%s\n", v.BuildDate)
+	fmt.Fprintf(stdout, "  go version: \t%s\n", v.GoVersion)
 }
@@ -0,0 +1,59 @@
+package version
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// useBuild sets the values the ldflags would for the duration of the test
+func useBuild(t *testing.T, name, ver string) *bytes.Buffer {
+	origName, origVersion, origStdout := appName, version, stdout
+	t.Cleanup(func() {
+		appName, version, stdout = origName, origVersion, origStdout
+	})
+	appName, version = name, ver
+	output := &bytes.Buffer{}
+	stdout = output
+	return output
+}
+
+// TestPrint validates the version line includes the build metadata
+func TestPrint(t *testing.T) {
+	output := useBuild(t, "makecatalogs", "2.1.0")
+	Print()
+
+	expected := "makecatalogs 2.1.0 (revision unknown, built unknown, " + runtime.Version() + ")\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
+
+// TestShowJSON validates --version --json prints every field
+func TestShowJSON(t *testing.T) {
+	output := useBuild(t, "managedsoftwareupdate", "2.1.0")
+	if err := Show(true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var info Info
+	if err := json.Unmarshal(output.Bytes(), &info); err != nil {
+		t.Fatalf("invalid JSON %q: %v", output.String(), err)
+	}
+	if info.Name != "managedsoftwareupdate" || info.Version != "2.1.0" || info.GoVersion != runtime.Version() {
+		t.Errorf("unexpected version: %+v", info)
+	}
+	if !strings.Contains(output.String(), `"build_date": "unknown"`) {
+		t.Errorf("expected the build date in %s", output.String())
+	}
+}
+
+// TestVersionName validates a binary built without the ldflags is named after its executable
+func TestVersionName(t *testing.T) {
+	useBuild(t, "unknown", "unknown")
+	if name := Version().Name; name == "" || name == "unknown" {
+		t.Errorf("expected the executable name, got %q", name)
+	}
+}